@@ -0,0 +1,34 @@
+#![no_main]
+
+use libfuzzer_sys::fuzz_target;
+use opnsense_config_faker::generator::VlanConfig;
+use opnsense_config_faker::xml::roundtrip::check_roundtrip;
+use std::collections::HashSet;
+
+fuzz_target!(|data: &[u8]| {
+    // Each 0xFF-separated chunk describes one VLAN: two bytes of VLAN ID, one
+    // byte of third octet, and the rest as description text
+    let mut ids = HashSet::new();
+    let mut vlans = Vec::new();
+    for chunk in data.split(|&b| b == 0xFF).take(64) {
+        if chunk.len() < 3 {
+            continue;
+        }
+        let vlan_id = 10 + u16::from_le_bytes([chunk[0], chunk[1]]) % 4085;
+        if !ids.insert(vlan_id) {
+            continue;
+        }
+        let network = format!("10.{}.{}.x", chunk[2] % 128, chunk[0]);
+        let description = String::from_utf8_lossy(&chunk[3..]).into_owned();
+        let wan = 1 + chunk[1] % 3;
+        if let Ok(vlan) = VlanConfig::new(vlan_id, network, description, wan) {
+            vlans.push(vlan);
+        }
+    }
+    if vlans.is_empty() {
+        return;
+    }
+
+    let mismatches = check_roundtrip(&vlans);
+    assert!(mismatches.is_empty(), "{mismatches:#?}");
+});
@@ -0,0 +1,214 @@
+//! Review and confirmation before pushing to a live firewall
+//!
+//! [`ApplyPlan`] works out what pushing a set of items would change in the
+//! target's current config.xml: each item is upserted into the section
+//! OPNsense keeps its kind in, matched on the field the transport matches on
+//! (VLAN tag, alias name, or rule description), and the result is compared
+//! with the [diff engine](crate::xml::diff). An [`Approver`] then decides
+//! whether the push goes ahead; [`AutoApprove`] is the `--auto-approve`
+//! escape hatch for unattended runs, while the `apply` command shows the plan
+//! and asks on the terminal.
+
+use crate::Result;
+use crate::apply::{ApplyItem, ApplyItemKind};
+use crate::xml::diff::{diff_leaves, flatten};
+use crate::xml::{ChangeKind, ConfigChange};
+use serde_json::Value;
+
+/// Changes an apply would make to the target's configuration
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct ApplyPlan {
+    /// Value-level differences from the current to the proposed configuration
+    pub changes: Vec<ConfigChange>,
+}
+
+impl ApplyPlan {
+    /// Plan pushing `items` to a target whose configuration is `current`
+    ///
+    /// Only fields the items set are compared; values the firewall fills in
+    /// itself, such as a VLAN's parent device, are not part of the plan.
+    pub fn new(current: &str, items: &[ApplyItem]) -> Result<Self> {
+        let current = flatten(current)?;
+        let mut proposed = current.clone();
+        for item in items {
+            upsert(&mut proposed, item);
+        }
+        Ok(Self {
+            changes: diff_leaves(&current, &proposed),
+        })
+    }
+
+    /// Whether applying would change nothing
+    pub fn is_empty(&self) -> bool {
+        self.changes.is_empty()
+    }
+
+    /// Number of changes of one kind
+    pub fn count(&self, kind: ChangeKind) -> usize {
+        self.changes.iter().filter(|c| c.kind == kind).count()
+    }
+
+    /// One-line summary, e.g. "Plan: 12 to add, 1 to change, 0 to remove."
+    pub fn summary(&self) -> String {
+        if self.is_empty() {
+            return "No changes. The target already matches the configuration.".to_string();
+        }
+        format!(
+            "Plan: {} to add, {} to change, {} to remove.",
+            self.count(ChangeKind::Added),
+            self.count(ChangeKind::Changed),
+            self.count(ChangeKind::Removed)
+        )
+    }
+}
+
+/// Section an item kind is stored in and the field identifying its entries
+fn location(kind: ApplyItemKind) -> (&'static str, &'static str) {
+    match kind {
+        ApplyItemKind::Vlan => ("/opnsense/vlans/vlan", "tag"),
+        ApplyItemKind::Alias => ("/opnsense/OPNsense/Firewall/Alias/aliases/alias", "name"),
+        ApplyItemKind::Rule => (
+            "/opnsense/OPNsense/Firewall/Filter/rules/rule",
+            "description",
+        ),
+    }
+}
+
+/// Set an item's fields on the entry it updates, or on a new entry
+fn upsert(leaves: &mut Vec<(String, String)>, item: &ApplyItem) {
+    let Some(fields) = item.payload.as_object() else {
+        return;
+    };
+    let (section, identity) = location(item.kind);
+    let entries = entries(leaves, section);
+    let existing = fields.get(identity).and_then(leaf_value).and_then(|key| {
+        entries.iter().find(|entry| {
+            let path = format!("{entry}/{identity}");
+            leaves.iter().any(|(p, value)| *p == path && *value == key)
+        })
+    });
+    let entry = match (existing, entries.len()) {
+        (Some(entry), _) => entry.clone(),
+        (None, 0) => section.to_string(),
+        (None, n) => format!("{section}[{}]", n + 1),
+    };
+
+    for (name, value) in fields {
+        let Some(value) = leaf_value(value) else {
+            continue;
+        };
+        let path = format!("{entry}/{name}");
+        match leaves.iter_mut().find(|(p, _)| *p == path) {
+            Some(leaf) => leaf.1 = value,
+            None => leaves.push((path, value)),
+        }
+    }
+}
+
+/// Paths of the entries of a section, e.g. `/opnsense/vlans/vlan[2]`
+fn entries(leaves: &[(String, String)], section: &str) -> Vec<String> {
+    let mut entries: Vec<String> = Vec::new();
+    for (path, _) in leaves {
+        let Some(rest) = path.strip_prefix(section) else {
+            continue;
+        };
+        let index = match rest.strip_prefix('[') {
+            Some(indexed) => match indexed.find(']') {
+                Some(end) => &rest[..end + 2],
+                None => continue,
+            },
+            None if rest.is_empty() || rest.starts_with('/') => "",
+            None => continue,
+        };
+        let entry = format!("{section}{index}");
+        if !entries.contains(&entry) {
+            entries.push(entry);
+        }
+    }
+    entries
+}
+
+/// Text a payload field is stored as in config.xml
+fn leaf_value(value: &Value) -> Option<String> {
+    match value {
+        Value::Null => None,
+        Value::String(text) => Some(text.clone()),
+        Value::Bool(flag) => Some(if *flag { "1" } else { "0" }.to_string()),
+        other => Some(other.to_string()),
+    }
+}
+
+/// Decides whether a reviewed plan may be applied
+pub trait Approver {
+    /// Return `Ok(true)` to push, `Ok(false)` to cancel
+    fn approve(&mut self, plan: &ApplyPlan) -> Result<bool>;
+}
+
+/// Approves every plan without asking (`--auto-approve`)
+#[derive(Debug, Clone, Copy, Default)]
+pub struct AutoApprove;
+
+impl Approver for AutoApprove {
+    fn approve(&mut self, _plan: &ApplyPlan) -> Result<bool> {
+        Ok(true)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::generator::Labels;
+    use serde_json::json;
+
+    const CURRENT: &str = "<opnsense><vlans><vlan uuid=\"a\"><if>igb1</if><tag>100</tag>\
+        <descr>Old</descr></vlan></vlans></opnsense>";
+
+    fn item(kind: ApplyItemKind, payload: Value) -> ApplyItem {
+        ApplyItem {
+            kind,
+            key: "item".to_string(),
+            payload,
+            labels: Labels::new(),
+        }
+    }
+
+    #[test]
+    fn test_plan_upserts_items() {
+        let items = [
+            item(ApplyItemKind::Vlan, json!({ "tag": 100, "descr": "New" })),
+            item(ApplyItemKind::Vlan, json!({ "tag": 200, "descr": "Guest" })),
+            item(ApplyItemKind::Alias, json!({ "name": "A", "type": "host" })),
+            item(
+                ApplyItemKind::Rule,
+                json!({ "description": "R", "log": true }),
+            ),
+        ];
+        let plan = ApplyPlan::new(CURRENT, &items).unwrap();
+        assert_eq!(plan.count(ChangeKind::Added), 6);
+        assert_eq!(plan.count(ChangeKind::Changed), 1);
+        assert_eq!(plan.count(ChangeKind::Removed), 0);
+        assert_eq!(plan.summary(), "Plan: 6 to add, 1 to change, 0 to remove.");
+
+        let paths: Vec<&str> = plan.changes.iter().map(|c| c.path.as_str()).collect();
+        assert!(paths.contains(&"/opnsense/vlans/vlan/descr"));
+        assert!(paths.contains(&"/opnsense/vlans/vlan[2]/tag"));
+        assert!(paths.contains(&"/opnsense/OPNsense/Firewall/Alias/aliases/alias/name"));
+        let log = plan
+            .changes
+            .iter()
+            .find(|c| c.path.ends_with("/log"))
+            .unwrap();
+        assert_eq!(log.new.as_deref(), Some("1"));
+    }
+
+    #[test]
+    fn test_plan_is_empty_when_target_matches() {
+        let items = [item(
+            ApplyItemKind::Vlan,
+            json!({ "tag": 100, "descr": "Old" }),
+        )];
+        let plan = ApplyPlan::new(CURRENT, &items).unwrap();
+        assert!(plan.is_empty());
+        assert!(AutoApprove.approve(&plan).unwrap());
+    }
+}
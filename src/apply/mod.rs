@@ -0,0 +1,753 @@
+//! Chunked, rate-limited apply of generated objects to live firewalls
+//!
+//! Pushing thousands of aliases or rules in one go times out or trips API rate
+//! limits. The [`Applier`] splits the work into batches, paces requests,
+//! retries transient failures with exponential backoff, and records a
+//! checkpoint after every batch so an interrupted run can resume where it
+//! stopped.
+//!
+//! When a snapshot directory is configured, the target's current config.xml is
+//! stored before anything is pushed and can be restored with
+//! [`Applier::rollback`].
+//!
+//! [`Applier::run_with_approval`] first plans what the items change in the
+//! target's current config.xml and pushes only once an
+//! [`Approver`](approval::Approver) accepts the plan.
+//!
+//! The engine is transport-agnostic: batches are handed to an
+//! [`ApplyTransport`](transport::ApplyTransport) supplied by the caller, such
+//! as the [`OpnsenseTransport`](opnsense::OpnsenseTransport) the `apply`
+//! command uses.
+//!
+//! Items built with [`items_from_labeled_vlans`] and
+//! [`items_from_labeled_rules`] carry their VLAN's labels, so
+//! [`select_items`] can narrow a large generated dataset to a tagged subset
+//! before it is pushed.
+
+pub mod approval;
+pub mod opnsense;
+pub mod snapshot;
+pub mod transport;
+
+use crate::Result;
+use crate::generator::{FirewallRule, LabelSelector, LabelSet, Labels, VlanConfig};
+use crate::model::ConfigError;
+use approval::{ApplyPlan, Approver};
+use serde::{Deserialize, Serialize};
+use serde_json::json;
+use sha2::{Digest, Sha256};
+use snapshot::SnapshotStore;
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::time::{Duration, Instant};
+use transport::ApplyTransport;
+
+/// Kind of object pushed to the firewall
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum ApplyItemKind {
+    /// Firewall alias
+    Alias,
+    /// Firewall filter rule
+    Rule,
+    /// VLAN interface
+    Vlan,
+}
+
+/// A single object to push, with a stable key used for checkpointing
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct ApplyItem {
+    /// Object kind
+    pub kind: ApplyItemKind,
+    /// Stable identifier (unique within a run)
+    pub key: String,
+    /// API payload for the object
+    pub payload: serde_json::Value,
+    /// Labels inherited from the object's VLAN; not sent to the firewall
+    #[serde(default, skip_serializing_if = "Labels::is_empty")]
+    pub labels: Labels,
+}
+
+/// Build VLAN and network alias items from VLAN configurations
+pub fn items_from_vlans(configs: &[VlanConfig]) -> Vec<ApplyItem> {
+    items_from_labeled_vlans(configs, &LabelSet::default())
+}
+
+/// Build VLAN and network alias items carrying each VLAN's labels
+pub fn items_from_labeled_vlans(configs: &[VlanConfig], labels: &LabelSet) -> Vec<ApplyItem> {
+    let mut items = Vec::with_capacity(configs.len() * 2);
+    for config in configs {
+        let vlan_labels = labels.get(config.vlan_id).cloned().unwrap_or_default();
+        items.push(ApplyItem {
+            kind: ApplyItemKind::Vlan,
+            key: format!("vlan-{}", config.vlan_id),
+            payload: json!({
+                "tag": config.vlan_id,
+                "descr": config.description,
+            }),
+            labels: vlan_labels.clone(),
+        });
+
+        let network = config
+            .as_ipv4_network()
+            .map(|n| n.to_string())
+            .unwrap_or_else(|_| config.ip_network.clone());
+        items.push(ApplyItem {
+            kind: ApplyItemKind::Alias,
+            key: format!("alias-vlan{}-net", config.vlan_id),
+            payload: json!({
+                "name": format!("VLAN{}_NET", config.vlan_id),
+                "type": "network",
+                "content": network,
+                "description": config.description,
+            }),
+            labels: vlan_labels,
+        });
+    }
+    items
+}
+
+/// Build filter rule items from firewall rules
+pub fn items_from_rules(rules: &[FirewallRule]) -> Vec<ApplyItem> {
+    items_from_labeled_rules(rules, &LabelSet::default())
+}
+
+/// Build filter rule items carrying the labels of each rule's VLAN
+pub fn items_from_labeled_rules(rules: &[FirewallRule], labels: &LabelSet) -> Vec<ApplyItem> {
+    rules
+        .iter()
+        .map(|rule| ApplyItem {
+            kind: ApplyItemKind::Rule,
+            key: format!("rule-{}", rule.rule_id),
+            payload: json!({
+                "action": rule.action.to_lowercase(),
+                "direction": rule.direction.to_lowercase(),
+                "interface": rule.interface,
+                "protocol": rule.protocol.to_lowercase(),
+                "source_net": rule.source,
+                "destination_net": rule.destination,
+                "destination_port": rule.ports,
+                "log": rule.log,
+                "sequence": rule.priority,
+                "description": rule.description,
+            }),
+            labels: rule
+                .vlan_id
+                .and_then(|id| labels.get(id))
+                .cloned()
+                .unwrap_or_default(),
+        })
+        .collect()
+}
+
+/// Keep only the items whose labels satisfy the selector
+pub fn select_items(items: Vec<ApplyItem>, selector: &LabelSelector) -> Vec<ApplyItem> {
+    items
+        .into_iter()
+        .filter(|item| selector.matches(&item.labels))
+        .collect()
+}
+
+/// Tuning options for an apply run
+#[derive(Debug, Clone)]
+pub struct ApplyOptions {
+    /// Number of items sent per request
+    pub batch_size: usize,
+    /// Maximum requests per second (`None` = unlimited)
+    pub requests_per_second: Option<f64>,
+    /// Retries per batch after the first attempt
+    pub max_retries: u32,
+    /// Delay before the first retry; doubles on every further retry
+    pub initial_backoff: Duration,
+    /// Upper bound for the retry delay
+    pub max_backoff: Duration,
+    /// Checkpoint file enabling resume after interruption
+    pub checkpoint: Option<PathBuf>,
+    /// Directory for the pre-apply rollback snapshot (`None` = no snapshot)
+    pub snapshot_dir: Option<PathBuf>,
+}
+
+impl Default for ApplyOptions {
+    fn default() -> Self {
+        Self {
+            batch_size: 50,
+            requests_per_second: Some(2.0),
+            max_retries: 5,
+            initial_backoff: Duration::from_millis(500),
+            max_backoff: Duration::from_secs(30),
+            checkpoint: None,
+            snapshot_dir: None,
+        }
+    }
+}
+
+impl ApplyOptions {
+    /// Validate option values
+    pub fn validate(&self) -> Result<()> {
+        if self.batch_size == 0 {
+            return Err(ConfigError::invalid_parameter(
+                "batch-size",
+                "Batch size must be at least 1",
+            ));
+        }
+        if let Some(rate) = self.requests_per_second
+            && !(rate.is_finite() && rate > 0.0)
+        {
+            return Err(ConfigError::invalid_parameter(
+                "rate",
+                format!("Request rate must be a positive number, got {rate}"),
+            ));
+        }
+        Ok(())
+    }
+}
+
+/// Progress recorded after every successful batch
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct ApplyCheckpoint {
+    /// Fingerprint of the item keys, guarding against resuming a different run
+    pub fingerprint: String,
+    /// Total number of items in the run
+    pub total: usize,
+    /// Number of items already applied
+    pub completed: usize,
+}
+
+impl ApplyCheckpoint {
+    /// Load a checkpoint file if it exists
+    pub fn load(path: &Path) -> Result<Option<Self>> {
+        if !path.exists() {
+            return Ok(None);
+        }
+        let content = fs::read_to_string(path)?;
+        Ok(Some(serde_json::from_str(&content)?))
+    }
+
+    /// Write the checkpoint atomically (write + rename)
+    pub fn save(&self, path: &Path) -> Result<()> {
+        let tmp = path.with_extension("tmp");
+        fs::write(&tmp, serde_json::to_string_pretty(self)?)?;
+        fs::rename(&tmp, path)?;
+        Ok(())
+    }
+}
+
+/// Outcome of an apply run
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct ApplyReport {
+    /// Items skipped because a checkpoint showed them as already applied
+    pub resumed_from: usize,
+    /// Items applied in this run
+    pub items_applied: usize,
+    /// Batches sent successfully in this run
+    pub batches_sent: usize,
+    /// Retries performed across all batches
+    pub retries: u32,
+    /// Snapshot of the target taken before this run pushed anything
+    pub snapshot: Option<PathBuf>,
+}
+
+/// Compute the fingerprint of a run from its item keys
+pub fn fingerprint(items: &[ApplyItem]) -> String {
+    let mut hasher = Sha256::new();
+    for item in items {
+        hasher.update(item.key.as_bytes());
+        hasher.update([0u8]);
+    }
+    hasher
+        .finalize()
+        .iter()
+        .map(|b| format!("{b:02x}"))
+        .collect()
+}
+
+/// Delay before retry number `attempt` (0-based), capped at `max`
+pub fn backoff_delay(attempt: u32, initial: Duration, max: Duration) -> Duration {
+    let factor = 2u32.saturating_pow(attempt);
+    initial.saturating_mul(factor).min(max)
+}
+
+/// Minimum-interval rate limiter
+#[derive(Debug)]
+pub struct RateLimiter {
+    interval: Duration,
+    last: Option<Instant>,
+}
+
+impl RateLimiter {
+    /// Create a limiter for the given request rate (`None` = unlimited)
+    pub fn new(requests_per_second: Option<f64>) -> Self {
+        let interval = requests_per_second
+            .filter(|r| *r > 0.0)
+            .map(|r| Duration::from_secs_f64(1.0 / r))
+            .unwrap_or(Duration::ZERO);
+        Self {
+            interval,
+            last: None,
+        }
+    }
+
+    /// Time to wait before a request issued at `now`, recording it as issued
+    pub fn acquire(&mut self, now: Instant) -> Duration {
+        let wait = match self.last {
+            Some(last) => self
+                .interval
+                .saturating_sub(now.saturating_duration_since(last)),
+            None => Duration::ZERO,
+        };
+        self.last = Some(now + wait);
+        wait
+    }
+}
+
+/// Batching, rate-limited, retrying apply engine
+pub struct Applier<T: ApplyTransport> {
+    transport: T,
+    options: ApplyOptions,
+    sleeper: Box<dyn FnMut(Duration)>,
+}
+
+impl<T: ApplyTransport> Applier<T> {
+    /// Create an applier that sleeps the current thread between requests
+    pub fn new(transport: T, options: ApplyOptions) -> Self {
+        Self {
+            transport,
+            options,
+            sleeper: Box::new(std::thread::sleep),
+        }
+    }
+
+    /// Replace the sleep function (used by tests to avoid real delays)
+    pub fn with_sleeper(mut self, sleeper: impl FnMut(Duration) + 'static) -> Self {
+        self.sleeper = Box::new(sleeper);
+        self
+    }
+
+    /// Access the transport (e.g. to inspect a recording transport)
+    pub fn transport(&self) -> &T {
+        &self.transport
+    }
+
+    /// Consume the applier and return the transport
+    pub fn into_transport(self) -> T {
+        self.transport
+    }
+
+    /// Options of later runs, e.g. to skip the snapshot after a first run
+    pub fn options_mut(&mut self) -> &mut ApplyOptions {
+        &mut self.options
+    }
+
+    /// Push all items, resuming from the checkpoint when one matches
+    pub fn run(&mut self, items: &[ApplyItem]) -> Result<ApplyReport> {
+        self.options.validate()?;
+
+        let fingerprint = fingerprint(items);
+        let mut report = ApplyReport::default();
+
+        let mut completed = 0;
+        if let Some(path) = &self.options.checkpoint
+            && let Some(checkpoint) = ApplyCheckpoint::load(path)?
+        {
+            if checkpoint.fingerprint != fingerprint || checkpoint.total != items.len() {
+                return Err(ConfigError::apply(format!(
+                    "Checkpoint '{}' belongs to a different run; remove it to start over",
+                    path.display()
+                )));
+            }
+            completed = checkpoint.completed.min(items.len());
+            report.resumed_from = completed;
+        }
+
+        // Snapshot only on a fresh run: after a partial apply the target no
+        // longer reflects its original state, so the first snapshot is kept
+        if completed == 0
+            && let Some(dir) = &self.options.snapshot_dir
+        {
+            let config = self.transport.fetch_config().map_err(|e| {
+                ConfigError::apply(format!("Failed to fetch pre-apply snapshot: {e}"))
+            })?;
+            report.snapshot = Some(SnapshotStore::new(dir).save(&config)?);
+        }
+
+        let mut limiter = RateLimiter::new(self.options.requests_per_second);
+
+        for batch in items[completed..].chunks(self.options.batch_size) {
+            let mut attempt = 0;
+            loop {
+                let wait = limiter.acquire(Instant::now());
+                if !wait.is_zero() {
+                    (self.sleeper)(wait);
+                }
+
+                match self.transport.send_batch(batch) {
+                    Ok(()) => break,
+                    Err(e) if e.is_retryable() && attempt < self.options.max_retries => {
+                        (self.sleeper)(backoff_delay(
+                            attempt,
+                            self.options.initial_backoff,
+                            self.options.max_backoff,
+                        ));
+                        attempt += 1;
+                        report.retries += 1;
+                    }
+                    Err(e) => {
+                        return Err(ConfigError::apply(format!(
+                            "Batch starting at item {} failed after {} attempt(s): {e}",
+                            completed + 1,
+                            attempt + 1
+                        )));
+                    }
+                }
+            }
+
+            completed += batch.len();
+            report.items_applied += batch.len();
+            report.batches_sent += 1;
+
+            if let Some(path) = &self.options.checkpoint {
+                ApplyCheckpoint {
+                    fingerprint: fingerprint.clone(),
+                    total: items.len(),
+                    completed,
+                }
+                .save(path)?;
+            }
+        }
+
+        // A finished run leaves nothing to resume
+        if let Some(path) = &self.options.checkpoint
+            && path.exists()
+        {
+            fs::remove_file(path)?;
+        }
+
+        Ok(report)
+    }
+
+    /// Show what `items` change on the target and push once approved
+    ///
+    /// The plan compares the target's current configuration with the same
+    /// configuration after the items are upserted. Nothing is pushed when the
+    /// plan is empty; a declined plan is an error so scripts never mistake a
+    /// cancelled apply for a successful one.
+    pub fn run_with_approval(
+        &mut self,
+        items: &[ApplyItem],
+        approver: &mut dyn Approver,
+    ) -> Result<ApplyReport> {
+        let current = self.transport.fetch_config().map_err(|e| {
+            ConfigError::apply(format!("Failed to fetch the current configuration: {e}"))
+        })?;
+        let plan = ApplyPlan::new(&current, items)?;
+        if plan.is_empty() {
+            return Ok(ApplyReport::default());
+        }
+        if !approver.approve(&plan)? {
+            return Err(ConfigError::apply("Apply cancelled; nothing was pushed"));
+        }
+        self.run(items)
+    }
+
+    /// Restore the target from a snapshot taken by a previous run
+    pub fn rollback(&mut self, snapshot_path: &Path) -> Result<()> {
+        let config = snapshot::load_snapshot(snapshot_path)?;
+        self.transport.restore_config(&config).map_err(|e| {
+            ConfigError::apply(format!(
+                "Failed to restore snapshot '{}': {e}",
+                snapshot_path.display()
+            ))
+        })
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::transport::{RecordingTransport, TransportError};
+    use super::*;
+    use std::cell::RefCell;
+    use std::rc::Rc;
+    use tempfile::TempDir;
+
+    fn sample_items(n: usize) -> Vec<ApplyItem> {
+        (0..n)
+            .map(|i| ApplyItem {
+                kind: ApplyItemKind::Alias,
+                key: format!("alias-{i}"),
+                payload: json!({ "name": format!("A{i}") }),
+                labels: Labels::new(),
+            })
+            .collect()
+    }
+
+    fn fast_options() -> ApplyOptions {
+        ApplyOptions {
+            batch_size: 3,
+            requests_per_second: None,
+            ..ApplyOptions::default()
+        }
+    }
+
+    /// Transport failing a fixed number of times before succeeding
+    struct FlakyTransport {
+        failures_left: u32,
+        fatal: bool,
+        sent: usize,
+    }
+
+    impl ApplyTransport for FlakyTransport {
+        fn send_batch(&mut self, batch: &[ApplyItem]) -> std::result::Result<(), TransportError> {
+            if self.failures_left > 0 {
+                self.failures_left -= 1;
+                return Err(if self.fatal {
+                    TransportError::Fatal("401 Unauthorized".to_string())
+                } else {
+                    TransportError::Retryable("429 Too Many Requests".to_string())
+                });
+            }
+            self.sent += batch.len();
+            Ok(())
+        }
+    }
+
+    #[test]
+    fn test_apply_batches_items() {
+        let mut applier = Applier::new(RecordingTransport::new(), fast_options());
+        let report = applier.run(&sample_items(10)).unwrap();
+
+        assert_eq!(report.batches_sent, 4);
+        assert_eq!(report.items_applied, 10);
+        let sizes: Vec<usize> = applier.transport().batches.iter().map(Vec::len).collect();
+        assert_eq!(sizes, vec![3, 3, 3, 1]);
+    }
+
+    #[test]
+    fn test_apply_retries_with_backoff() {
+        let sleeps = Rc::new(RefCell::new(Vec::new()));
+        let recorded = Rc::clone(&sleeps);
+        let transport = FlakyTransport {
+            failures_left: 3,
+            fatal: false,
+            sent: 0,
+        };
+        let mut applier = Applier::new(transport, fast_options())
+            .with_sleeper(move |d| recorded.borrow_mut().push(d));
+
+        let report = applier.run(&sample_items(3)).unwrap();
+        assert_eq!(report.retries, 3);
+        assert_eq!(applier.transport().sent, 3);
+        assert_eq!(
+            *sleeps.borrow(),
+            vec![
+                Duration::from_millis(500),
+                Duration::from_millis(1000),
+                Duration::from_millis(2000)
+            ]
+        );
+    }
+
+    #[test]
+    fn test_apply_fatal_error_stops_immediately() {
+        let transport = FlakyTransport {
+            failures_left: 1,
+            fatal: true,
+            sent: 0,
+        };
+        let mut applier = Applier::new(transport, fast_options()).with_sleeper(|_| {});
+        assert!(applier.run(&sample_items(3)).is_err());
+        assert_eq!(applier.transport().sent, 0);
+    }
+
+    #[test]
+    fn test_apply_resumes_from_checkpoint() {
+        let dir = TempDir::new().unwrap();
+        let checkpoint = dir.path().join("apply.checkpoint");
+        let items = sample_items(10);
+
+        ApplyCheckpoint {
+            fingerprint: fingerprint(&items),
+            total: items.len(),
+            completed: 6,
+        }
+        .save(&checkpoint)
+        .unwrap();
+
+        let options = ApplyOptions {
+            checkpoint: Some(checkpoint.clone()),
+            ..fast_options()
+        };
+        let mut applier = Applier::new(RecordingTransport::new(), options);
+        let report = applier.run(&items).unwrap();
+
+        assert_eq!(report.resumed_from, 6);
+        assert_eq!(report.items_applied, 4);
+        assert_eq!(applier.transport().batches[0][0].key, "alias-6");
+        assert!(!checkpoint.exists());
+    }
+
+    #[test]
+    fn test_apply_rejects_foreign_checkpoint() {
+        let dir = TempDir::new().unwrap();
+        let checkpoint = dir.path().join("apply.checkpoint");
+        ApplyCheckpoint {
+            fingerprint: "other".to_string(),
+            total: 10,
+            completed: 2,
+        }
+        .save(&checkpoint)
+        .unwrap();
+
+        let options = ApplyOptions {
+            checkpoint: Some(checkpoint),
+            ..fast_options()
+        };
+        let mut applier = Applier::new(RecordingTransport::new(), options);
+        assert!(applier.run(&sample_items(10)).is_err());
+    }
+
+    #[test]
+    fn test_rate_limiter_spaces_requests() {
+        let mut limiter = RateLimiter::new(Some(4.0));
+        let start = Instant::now();
+        assert_eq!(limiter.acquire(start), Duration::ZERO);
+        assert_eq!(limiter.acquire(start), Duration::from_millis(250));
+        assert_eq!(
+            limiter.acquire(start + Duration::from_secs(1)),
+            Duration::ZERO
+        );
+    }
+
+    #[test]
+    fn test_backoff_delay_is_capped() {
+        let initial = Duration::from_millis(100);
+        let max = Duration::from_secs(1);
+        assert_eq!(backoff_delay(0, initial, max), initial);
+        assert_eq!(backoff_delay(3, initial, max), Duration::from_millis(800));
+        assert_eq!(backoff_delay(10, initial, max), max);
+    }
+
+    #[test]
+    fn test_items_from_vlans_and_rules() {
+        let configs = vec![
+            VlanConfig::new(100, "10.1.2.x".to_string(), "IT VLAN 100".to_string(), 1).unwrap(),
+        ];
+        let items = items_from_vlans(&configs);
+        assert_eq!(items.len(), 2);
+        assert_eq!(items[1].payload["content"], "10.1.2.0/24");
+
+        let rules = crate::generator::generate_firewall_rules(
+            &configs,
+            crate::generator::FirewallComplexity::Basic,
+            Some(1),
+            None,
+            None,
+        )
+        .unwrap();
+        assert_eq!(items_from_rules(&rules).len(), rules.len());
+    }
+
+    #[test]
+    fn test_select_items_by_label() {
+        let configs: Vec<VlanConfig> = (0..30)
+            .map(|i| {
+                VlanConfig::new(
+                    100 + i,
+                    format!("10.1.{i}.x"),
+                    format!("IT VLAN {}", 100 + i),
+                    1,
+                )
+                .unwrap()
+            })
+            .collect();
+        let labels = crate::generator::assign_labels(&configs, Some(3));
+        let items = items_from_labeled_vlans(&configs, &labels);
+        assert!(items.iter().all(|item| !item.labels.is_empty()));
+
+        let selected = select_items(items, &"site=branch-01".parse().unwrap());
+        assert!(!selected.is_empty());
+        assert!(selected.len() < 60);
+        assert!(
+            selected
+                .iter()
+                .all(|item| item.labels.get("site") == Some("branch-01"))
+        );
+    }
+
+    #[test]
+    fn test_invalid_options_rejected() {
+        let options = ApplyOptions {
+            batch_size: 0,
+            ..ApplyOptions::default()
+        };
+        assert!(options.validate().is_err());
+    }
+
+    #[test]
+    fn test_apply_takes_snapshot_and_rolls_back() {
+        let dir = TempDir::new().unwrap();
+        let original = "<opnsense><filter/></opnsense>";
+        let options = ApplyOptions {
+            snapshot_dir: Some(dir.path().to_path_buf()),
+            ..fast_options()
+        };
+
+        let mut applier = Applier::new(RecordingTransport::with_config(original), options);
+        let report = applier.run(&sample_items(4)).unwrap();
+        let snapshot = report.snapshot.expect("snapshot should be taken");
+        assert_eq!(fs::read_to_string(&snapshot).unwrap(), original);
+
+        applier.rollback(&snapshot).unwrap();
+        assert_eq!(applier.transport().item_count(), 0);
+        assert_eq!(
+            applier.transport().current_config.as_deref(),
+            Some(original)
+        );
+    }
+
+    /// Approver declining every plan
+    struct Decline;
+
+    impl Approver for Decline {
+        fn approve(&mut self, _plan: &ApplyPlan) -> Result<bool> {
+            Ok(false)
+        }
+    }
+
+    #[test]
+    fn test_apply_waits_for_approval() {
+        let current = "<opnsense><vlans/></opnsense>";
+
+        let mut applier = Applier::new(RecordingTransport::with_config(current), fast_options());
+        assert!(
+            applier
+                .run_with_approval(&sample_items(4), &mut Decline)
+                .is_err()
+        );
+        assert_eq!(applier.transport().item_count(), 0);
+
+        let report = applier
+            .run_with_approval(&sample_items(4), &mut approval::AutoApprove)
+            .unwrap();
+        assert_eq!(report.items_applied, 4);
+
+        let converged = "<opnsense><OPNsense><Firewall><Alias><aliases>\
+            <alias><name>A0</name></alias></aliases></Alias></Firewall></OPNsense></opnsense>";
+        let mut applier = Applier::new(RecordingTransport::with_config(converged), fast_options());
+        let unchanged = applier
+            .run_with_approval(&sample_items(1), &mut approval::AutoApprove)
+            .unwrap();
+        assert_eq!(unchanged.items_applied, 0);
+    }
+
+    #[test]
+    fn test_apply_aborts_when_snapshot_unavailable() {
+        let dir = TempDir::new().unwrap();
+        let options = ApplyOptions {
+            snapshot_dir: Some(dir.path().to_path_buf()),
+            ..fast_options()
+        };
+        let mut applier = Applier::new(RecordingTransport::new(), options);
+        assert!(applier.run(&sample_items(2)).is_err());
+        assert_eq!(applier.transport().item_count(), 0);
+    }
+}
@@ -0,0 +1,513 @@
+//! OPNsense REST API transport
+//!
+//! Requests are made by `curl`, the way signatures are made by `ssh-keygen`,
+//! so no HTTP stack is compiled into the faker. The API key and secret are
+//! handed to curl on stdin rather than on its command line, where other users
+//! of the host could read them.
+//!
+//! Items are upserted: an object whose VLAN tag, alias name, or rule
+//! description already exists on the firewall is updated in place, so
+//! re-applying a dataset converges instead of failing on duplicates. After
+//! every batch the touched subsystems are reconfigured so the changes take
+//! effect. The current config.xml is fetched with the backup API for
+//! snapshots.
+//!
+//! The API cannot upload a whole configuration, so a snapshot is restored
+//! over SSH: it is written to `/conf/config.xml`, with the configuration it
+//! replaces kept in the backup history, and every service is reloaded.
+
+use crate::apply::transport::{ApplyTransport, TransportError};
+use crate::apply::{ApplyItem, ApplyItemKind};
+use serde_json::{Value, json};
+use std::io::{ErrorKind, Write};
+use std::path::{Path, PathBuf};
+use std::process::Output;
+use std::process::{Command, Stdio};
+use std::time::Duration;
+
+/// curl exit codes for failures worth retrying: DNS, connect, timeout, TLS
+/// handshake, empty reply, and send/receive errors
+const RETRYABLE_CURL_CODES: &[i32] = &[5, 6, 7, 28, 35, 52, 55, 56];
+
+/// Shell command installing the configuration read from stdin on the firewall
+const RESTORE_COMMAND: &str = "cat > /conf/config.xml.restore && \
+     cp /conf/config.xml /conf/backup/config-$(date +%s).xml && \
+     mv /conf/config.xml.restore /conf/config.xml && \
+     /usr/local/etc/rc.reload_all";
+
+/// API endpoints of one item kind
+struct Endpoints {
+    /// Controller path, e.g. `firewall/alias`
+    controller: &'static str,
+    /// Actions for search, add, and update
+    search: &'static str,
+    add: &'static str,
+    set: &'static str,
+    /// Action that activates saved changes
+    activate: &'static str,
+    /// Key the object is wrapped in, e.g. `{"alias": {...}}`
+    wrapper: &'static str,
+    /// Field identifying an existing object
+    identity: &'static str,
+}
+
+impl Endpoints {
+    fn of(kind: ApplyItemKind) -> Self {
+        match kind {
+            ApplyItemKind::Vlan => Self {
+                controller: "interfaces/vlan_settings",
+                search: "searchItem",
+                add: "addItem",
+                set: "setItem",
+                activate: "reconfigure",
+                wrapper: "vlan",
+                identity: "tag",
+            },
+            ApplyItemKind::Alias => Self {
+                controller: "firewall/alias",
+                search: "searchItem",
+                add: "addItem",
+                set: "setItem",
+                activate: "reconfigure",
+                wrapper: "alias",
+                identity: "name",
+            },
+            ApplyItemKind::Rule => Self {
+                controller: "firewall/filter",
+                search: "searchRule",
+                add: "addRule",
+                set: "setRule",
+                activate: "apply",
+                wrapper: "rule",
+                identity: "description",
+            },
+        }
+    }
+}
+
+/// Transport pushing items to a firewall's REST API
+#[derive(Debug, Clone)]
+pub struct OpnsenseTransport {
+    base_url: String,
+    api_key: String,
+    api_secret: String,
+    parent_interface: Option<String>,
+    insecure: bool,
+    timeout: Duration,
+    program: PathBuf,
+    ssh: Option<String>,
+    ssh_program: PathBuf,
+}
+
+impl OpnsenseTransport {
+    /// Create a transport for the firewall at `base_url`, e.g. `https://192.168.1.1`
+    pub fn new<S: Into<String>>(base_url: S, api_key: S, api_secret: S) -> Self {
+        Self {
+            base_url: base_url.into().trim_end_matches('/').to_string(),
+            api_key: api_key.into(),
+            api_secret: api_secret.into(),
+            parent_interface: None,
+            insecure: false,
+            timeout: Duration::from_secs(30),
+            program: PathBuf::from("curl"),
+            ssh: None,
+            ssh_program: PathBuf::from("ssh"),
+        }
+    }
+
+    /// Physical device VLANs are created on, e.g. `igb1`
+    pub fn with_parent_interface<S: Into<String>>(mut self, device: S) -> Self {
+        self.parent_interface = Some(device.into());
+        self
+    }
+
+    /// Accept a self-signed certificate, as lab firewalls usually have
+    pub fn with_insecure(mut self, insecure: bool) -> Self {
+        self.insecure = insecure;
+        self
+    }
+
+    /// Timeout of a single request
+    pub fn with_timeout(mut self, timeout: Duration) -> Self {
+        self.timeout = timeout;
+        self
+    }
+
+    /// Run requests with another curl binary
+    pub fn with_program<P: Into<PathBuf>>(mut self, program: P) -> Self {
+        self.program = program.into();
+        self
+    }
+
+    /// SSH destination snapshots are restored through, e.g. `root@192.168.1.1`
+    pub fn with_ssh<S: Into<String>>(mut self, destination: S) -> Self {
+        self.ssh = Some(destination.into());
+        self
+    }
+
+    /// Restore snapshots with another ssh binary
+    pub fn with_ssh_program<P: Into<PathBuf>>(mut self, program: P) -> Self {
+        self.ssh_program = program.into();
+        self
+    }
+
+    /// Body of the add or update request for an item
+    fn body(&self, item: &ApplyItem) -> Result<Value, TransportError> {
+        let endpoints = Endpoints::of(item.kind);
+        let mut object = item.payload.clone();
+        if item.kind == ApplyItemKind::Vlan {
+            let parent = self.parent_interface.as_deref().ok_or_else(|| {
+                TransportError::Fatal("VLANs need a parent interface to be created on".to_string())
+            })?;
+            object["if"] = json!(parent);
+            object["pcp"] = json!(object.get("pcp").cloned().unwrap_or(json!(0)));
+        }
+        Ok(json!({ endpoints.wrapper: object }))
+    }
+
+    /// Create or update one item
+    fn upsert(&self, item: &ApplyItem) -> Result<(), TransportError> {
+        let endpoints = Endpoints::of(item.kind);
+        let body = self.body(item)?;
+        let action = match self.find_uuid(item, &endpoints)? {
+            Some(uuid) => format!("{}/{}", endpoints.set, uuid),
+            None => endpoints.add.to_string(),
+        };
+        let response = self.post(&format!("{}/{action}", endpoints.controller), &body)?;
+        check_saved(&response, &item.key)
+    }
+
+    /// UUID of the object on the firewall matching the item, if any
+    fn find_uuid(
+        &self,
+        item: &ApplyItem,
+        endpoints: &Endpoints,
+    ) -> Result<Option<String>, TransportError> {
+        let identity = match &item.payload[endpoints.identity] {
+            Value::String(value) => value.clone(),
+            Value::Null => return Ok(None),
+            value => value.to_string(),
+        };
+        let response = self.post(
+            &format!("{}/{}", endpoints.controller, endpoints.search),
+            &json!({ "current": 1, "rowCount": -1, "searchPhrase": identity }),
+        )?;
+        let rows = response["rows"].as_array().cloned().unwrap_or_default();
+        Ok(rows.iter().find_map(|row| {
+            let value = match &row[endpoints.identity] {
+                Value::String(value) => value.clone(),
+                value => value.to_string(),
+            };
+            (value == identity)
+                .then(|| row["uuid"].as_str().map(str::to_string))
+                .flatten()
+        }))
+    }
+
+    /// POST a JSON body and parse the JSON response
+    fn post(&self, path: &str, body: &Value) -> Result<Value, TransportError> {
+        let response = self.request("POST", path, Some(body))?;
+        serde_json::from_str(&response)
+            .map_err(|e| TransportError::Fatal(format!("Unexpected response from {path}: {e}")))
+    }
+
+    /// Run one request and return the response body
+    fn request(
+        &self,
+        method: &str,
+        path: &str,
+        body: Option<&Value>,
+    ) -> Result<String, TransportError> {
+        let config = self.curl_config(method, path, body);
+        let mut command = Command::new(&self.program);
+        command.args(["--silent", "--show-error", "--config", "-"]);
+        let output = run_with_input(command, &self.program, &config)?;
+
+        if !output.status.success() {
+            let message = format!(
+                "{method} {path}: {}",
+                String::from_utf8_lossy(&output.stderr).trim()
+            );
+            return Err(match output.status.code() {
+                Some(code) if RETRYABLE_CURL_CODES.contains(&code) => {
+                    TransportError::Retryable(message)
+                }
+                _ => TransportError::Fatal(message),
+            });
+        }
+        split_status(&String::from_utf8_lossy(&output.stdout), method, path)
+    }
+
+    /// curl config file for a request, including the credentials
+    fn curl_config(&self, method: &str, path: &str, body: Option<&Value>) -> String {
+        let mut config = format!(
+            "url = \"{}\"\nuser = \"{}\"\nrequest = \"{method}\"\nmax-time = {}\n\
+             write-out = \"\\n%{{http_code}}\"\n",
+            quote(&format!("{}/api/{path}", self.base_url)),
+            quote(&format!("{}:{}", self.api_key, self.api_secret)),
+            self.timeout.as_secs().max(1),
+        );
+        if let Some(body) = body {
+            config.push_str("header = \"Content-Type: application/json\"\n");
+            config.push_str(&format!("data-binary = \"{}\"\n", quote(&body.to_string())));
+        }
+        if self.insecure {
+            config.push_str("insecure\n");
+        }
+        config
+    }
+}
+
+impl ApplyTransport for OpnsenseTransport {
+    fn send_batch(&mut self, batch: &[ApplyItem]) -> Result<(), TransportError> {
+        let mut touched = Vec::new();
+        for item in batch {
+            self.upsert(item)?;
+            if !touched.contains(&item.kind) {
+                touched.push(item.kind);
+            }
+        }
+        for kind in touched {
+            let endpoints = Endpoints::of(kind);
+            self.post(
+                &format!("{}/{}", endpoints.controller, endpoints.activate),
+                &json!({}),
+            )?;
+        }
+        Ok(())
+    }
+
+    fn fetch_config(&mut self) -> Result<String, TransportError> {
+        self.request("GET", "core/backup/download/this", None)
+    }
+
+    fn restore_config(&mut self, config: &str) -> Result<(), TransportError> {
+        let destination = self.ssh.as_deref().ok_or_else(|| {
+            TransportError::Fatal(
+                "restoring a snapshot needs SSH access to the firewall; \
+                 the API cannot upload a configuration"
+                    .to_string(),
+            )
+        })?;
+        let mut command = Command::new(&self.ssh_program);
+        command.args(["-o", "BatchMode=yes", destination, RESTORE_COMMAND]);
+        let output = run_with_input(command, &self.ssh_program, config)?;
+        if !output.status.success() {
+            return Err(TransportError::Fatal(format!(
+                "ssh {destination}: {}",
+                String::from_utf8_lossy(&output.stderr).trim()
+            )));
+        }
+        Ok(())
+    }
+}
+
+/// Run `command` with `input` on its stdin and capture its output
+fn run_with_input(
+    mut command: Command,
+    program: &Path,
+    input: &str,
+) -> Result<Output, TransportError> {
+    let mut child = command
+        .stdin(Stdio::piped())
+        .stdout(Stdio::piped())
+        .stderr(Stdio::piped())
+        .spawn()
+        .map_err(|e| {
+            TransportError::Fatal(if e.kind() == ErrorKind::NotFound {
+                format!(
+                    "{} is required to reach the firewall but was not found",
+                    program.display()
+                )
+            } else {
+                format!("Failed to run {}: {e}", program.display())
+            })
+        })?;
+    if let Some(mut stdin) = child.stdin.take() {
+        stdin.write_all(input.as_bytes()).map_err(|e| {
+            TransportError::Fatal(format!("Failed to write to {}: {e}", program.display()))
+        })?;
+    }
+    child
+        .wait_with_output()
+        .map_err(|e| TransportError::Fatal(format!("Failed to run {}: {e}", program.display())))
+}
+
+/// Escape a value for a double-quoted curl config string
+fn quote(value: &str) -> String {
+    value.replace('\\', "\\\\").replace('"', "\\\"")
+}
+
+/// Split curl's output into the body and the trailing HTTP status
+fn split_status(output: &str, method: &str, path: &str) -> Result<String, TransportError> {
+    let (body, status) = output.rsplit_once('\n').unwrap_or(("", output));
+    let status: u16 = status.trim().parse().map_err(|_| {
+        TransportError::Fatal(format!("{method} {path}: no HTTP status in curl output"))
+    })?;
+    let message = || format!("{method} {path}: HTTP {status} {}", body.trim());
+    match status {
+        200..=299 => Ok(body.to_string()),
+        408 | 429 | 500..=599 => Err(TransportError::Retryable(message())),
+        401 | 403 => Err(TransportError::Fatal(format!(
+            "{method} {path}: HTTP {status}, check the API key and its privileges"
+        ))),
+        _ => Err(TransportError::Fatal(message())),
+    }
+}
+
+/// Check the `result` of an add or update response
+fn check_saved(response: &Value, key: &str) -> Result<(), TransportError> {
+    if response["result"] == "saved" {
+        return Ok(());
+    }
+    let details = match response.get("validations") {
+        Some(validations) => validations.to_string(),
+        None => response.to_string(),
+    };
+    Err(TransportError::Fatal(format!(
+        "Firewall rejected {key}: {details}"
+    )))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::generator::Labels;
+
+    fn vlan_item() -> ApplyItem {
+        ApplyItem {
+            kind: ApplyItemKind::Vlan,
+            key: "vlan-100".to_string(),
+            payload: json!({ "tag": 100, "descr": "Sales VLAN 100" }),
+            labels: Labels::new(),
+        }
+    }
+
+    #[test]
+    fn test_curl_config_quotes_values() {
+        let transport =
+            OpnsenseTransport::new("https://fw.lab/", "key", "se\"cret").with_insecure(true);
+        let config =
+            transport.curl_config("POST", "firewall/alias/addItem", Some(&json!({"a": "b"})));
+        assert!(config.contains("url = \"https://fw.lab/api/firewall/alias/addItem\"\n"));
+        assert!(config.contains("user = \"key:se\\\"cret\"\n"));
+        assert!(config.contains("data-binary = \"{\\\"a\\\":\\\"b\\\"}\"\n"));
+        assert!(config.ends_with("insecure\n"));
+    }
+
+    #[test]
+    fn test_vlan_body_needs_parent_interface() {
+        let transport = OpnsenseTransport::new("https://fw", "k", "s");
+        assert!(transport.body(&vlan_item()).is_err());
+
+        let body = transport
+            .with_parent_interface("igb1")
+            .body(&vlan_item())
+            .unwrap();
+        assert_eq!(body["vlan"]["if"], "igb1");
+        assert_eq!(body["vlan"]["tag"], 100);
+        assert_eq!(body["vlan"]["pcp"], 0);
+    }
+
+    #[test]
+    fn test_status_classification() {
+        assert_eq!(split_status("{}\n200", "GET", "x").unwrap(), "{}");
+        assert!(
+            split_status("busy\n429", "GET", "x")
+                .unwrap_err()
+                .is_retryable()
+        );
+        assert!(
+            split_status("\n503", "GET", "x")
+                .unwrap_err()
+                .is_retryable()
+        );
+        assert!(
+            !split_status("\n401", "GET", "x")
+                .unwrap_err()
+                .is_retryable()
+        );
+        assert!(
+            !split_status("garbage", "GET", "x")
+                .unwrap_err()
+                .is_retryable()
+        );
+    }
+
+    #[test]
+    fn test_rejected_item_reports_validations() {
+        let response = json!({ "result": "failed", "validations": { "alias.name": "taken" } });
+        let err = check_saved(&response, "alias-1").unwrap_err();
+        assert!(err.to_string().contains("alias.name"));
+        assert!(check_saved(&json!({ "result": "saved" }), "alias-1").is_ok());
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_send_batch_through_curl() {
+        use std::os::unix::fs::PermissionsExt;
+
+        let dir = tempfile::TempDir::new().unwrap();
+        let log = dir.path().join("requests.log");
+        let curl = dir.path().join("curl");
+        std::fs::write(
+            &curl,
+            format!(
+                "#!/bin/sh\nconfig=$(cat)\nprintf '%s\\n' \"$config\" | grep '^url' >> '{}'\n\
+                 case \"$config\" in\n  *searchItem*) printf '{{\"rows\":[{{\"uuid\":\"u-1\",\"tag\":\"100\"}}]}}\\n200' ;;\n  \
+                 *download/this*) printf '<opnsense/>\\n200' ;;\n  \
+                 *) printf '{{\"result\":\"saved\",\"status\":\"ok\"}}\\n200' ;;\nesac\n",
+                log.display()
+            ),
+        )
+        .unwrap();
+        std::fs::set_permissions(&curl, std::fs::Permissions::from_mode(0o755)).unwrap();
+
+        let mut transport = OpnsenseTransport::new("https://fw", "k", "s")
+            .with_parent_interface("igb1")
+            .with_program(&curl);
+        transport.send_batch(&[vlan_item()]).unwrap();
+        assert_eq!(transport.fetch_config().unwrap(), "<opnsense/>");
+
+        let urls = std::fs::read_to_string(&log).unwrap();
+        let urls: Vec<&str> = urls.lines().collect();
+        assert_eq!(
+            urls,
+            [
+                "url = \"https://fw/api/interfaces/vlan_settings/searchItem\"",
+                "url = \"https://fw/api/interfaces/vlan_settings/setItem/u-1\"",
+                "url = \"https://fw/api/interfaces/vlan_settings/reconfigure\"",
+                "url = \"https://fw/api/core/backup/download/this\"",
+            ]
+        );
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_restore_config_over_ssh() {
+        use std::os::unix::fs::PermissionsExt;
+
+        let dir = tempfile::TempDir::new().unwrap();
+        let received = dir.path().join("received.xml");
+        let ssh = dir.path().join("ssh");
+        std::fs::write(
+            &ssh,
+            format!(
+                "#!/bin/sh\n[ \"$3\" = root@fw ] || exit 255\ncat > '{}'\n",
+                received.display()
+            ),
+        )
+        .unwrap();
+        std::fs::set_permissions(&ssh, std::fs::Permissions::from_mode(0o755)).unwrap();
+
+        let mut transport = OpnsenseTransport::new("https://fw", "k", "s");
+        assert!(transport.restore_config("<opnsense/>").is_err());
+
+        let mut transport = transport.with_ssh("root@fw").with_ssh_program(&ssh);
+        transport.restore_config("<opnsense/>").unwrap();
+        assert_eq!(std::fs::read_to_string(&received).unwrap(), "<opnsense/>");
+
+        let mut wrong_host = transport.with_ssh("root@other");
+        assert!(wrong_host.restore_config("<opnsense/>").is_err());
+    }
+}
@@ -0,0 +1,137 @@
+//! Pre-apply configuration snapshots for rollback
+//!
+//! Before anything is pushed, the target's current config.xml is fetched and
+//! stored on disk. Restoring that snapshot returns a shared lab firewall to the
+//! state it was in before the faker touched it.
+
+use crate::Result;
+use crate::model::ConfigError;
+use sha2::{Digest, Sha256};
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::time::{SystemTime, UNIX_EPOCH};
+
+/// File name prefix for stored snapshots
+const SNAPSHOT_PREFIX: &str = "snapshot-";
+
+/// Directory-backed store of configuration snapshots
+#[derive(Debug, Clone)]
+pub struct SnapshotStore {
+    dir: PathBuf,
+}
+
+impl SnapshotStore {
+    /// Create a store rooted at `dir` (created on first save)
+    pub fn new<P: Into<PathBuf>>(dir: P) -> Self {
+        Self { dir: dir.into() }
+    }
+
+    /// Directory snapshots are written to
+    pub fn dir(&self) -> &Path {
+        &self.dir
+    }
+
+    /// Save a snapshot, returning its path
+    ///
+    /// Files are named `snapshot-<unix-seconds>-<sha256 prefix>.xml` so they sort
+    /// chronologically and identical content is easy to spot.
+    pub fn save(&self, config: &str) -> Result<PathBuf> {
+        check_config(config)?;
+        fs::create_dir_all(&self.dir)?;
+
+        let timestamp = SystemTime::now()
+            .duration_since(UNIX_EPOCH)
+            .map(|d| d.as_secs())
+            .unwrap_or_default();
+        let digest = Sha256::digest(config.as_bytes());
+        let short: String = digest.iter().take(6).map(|b| format!("{b:02x}")).collect();
+
+        let path = self
+            .dir
+            .join(format!("{SNAPSHOT_PREFIX}{timestamp}-{short}.xml"));
+        fs::write(&path, config)?;
+        Ok(path)
+    }
+
+    /// List stored snapshots, oldest first
+    pub fn list(&self) -> Result<Vec<PathBuf>> {
+        if !self.dir.exists() {
+            return Ok(Vec::new());
+        }
+        let mut snapshots: Vec<PathBuf> = fs::read_dir(&self.dir)?
+            .filter_map(|entry| entry.ok().map(|e| e.path()))
+            .filter(|p| {
+                p.file_name()
+                    .and_then(|n| n.to_str())
+                    .is_some_and(|n| n.starts_with(SNAPSHOT_PREFIX) && n.ends_with(".xml"))
+            })
+            .collect();
+        snapshots.sort();
+        Ok(snapshots)
+    }
+
+    /// Most recent snapshot, if any
+    pub fn latest(&self) -> Result<Option<PathBuf>> {
+        Ok(self.list()?.pop())
+    }
+}
+
+/// Load a snapshot from disk, checking it still looks like a configuration
+pub fn load_snapshot(path: &Path) -> Result<String> {
+    if !path.exists() {
+        return Err(ConfigError::ConfigNotFound {
+            path: path.display().to_string(),
+        });
+    }
+    let config = fs::read_to_string(path)?;
+    check_config(&config)?;
+    Ok(config)
+}
+
+/// Reject content that is clearly not a config.xml (or encrypted backup)
+fn check_config(config: &str) -> Result<()> {
+    let trimmed = config.trim_start();
+    if trimmed.is_empty() {
+        return Err(ConfigError::apply("Snapshot configuration is empty"));
+    }
+    if !(trimmed.contains("<opnsense") || crate::io::backup::is_encrypted_backup(trimmed)) {
+        return Err(ConfigError::apply(
+            "Snapshot does not contain an OPNsense configuration",
+        ));
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    const CONFIG: &str = "<?xml version=\"1.0\"?>\n<opnsense><system/></opnsense>\n";
+
+    #[test]
+    fn test_save_and_load_snapshot() {
+        let dir = TempDir::new().unwrap();
+        let store = SnapshotStore::new(dir.path().join("snapshots"));
+
+        let path = store.save(CONFIG).unwrap();
+        assert!(path.starts_with(store.dir()));
+        assert_eq!(load_snapshot(&path).unwrap(), CONFIG);
+        assert_eq!(store.latest().unwrap(), Some(path));
+    }
+
+    #[test]
+    fn test_rejects_non_config_content() {
+        let dir = TempDir::new().unwrap();
+        let store = SnapshotStore::new(dir.path());
+        assert!(store.save("").is_err());
+        assert!(store.save("<html></html>").is_err());
+        assert!(store.list().unwrap().is_empty());
+    }
+
+    #[test]
+    fn test_load_missing_snapshot() {
+        let dir = TempDir::new().unwrap();
+        assert!(load_snapshot(&dir.path().join("nope.xml")).is_err());
+    }
+}
@@ -0,0 +1,97 @@
+//! Transport abstraction used by the apply engine
+//!
+//! The engine never talks to a firewall directly; it hands batches to an
+//! [`ApplyTransport`]. The [REST API transport](crate::apply::opnsense) is the
+//! one the CLI uses; embedding tools can plug in their own client.
+
+use crate::apply::ApplyItem;
+use thiserror::Error;
+
+/// Error returned by a transport when pushing a batch
+#[derive(Debug, Error)]
+pub enum TransportError {
+    /// Transient failure (timeout, HTTP 429, 5xx); the batch may be retried
+    #[error("retryable transport error: {0}")]
+    Retryable(String),
+
+    /// Permanent failure (authentication, validation); retrying will not help
+    #[error("fatal transport error: {0}")]
+    Fatal(String),
+}
+
+impl TransportError {
+    /// Whether the failed request may be retried
+    pub fn is_retryable(&self) -> bool {
+        matches!(self, TransportError::Retryable(_))
+    }
+}
+
+/// Destination for batches of generated objects
+pub trait ApplyTransport {
+    /// Push one batch of items; called at most once per rate-limit interval
+    fn send_batch(&mut self, batch: &[ApplyItem]) -> Result<(), TransportError>;
+
+    /// Fetch the target's current config.xml for a pre-apply snapshot
+    fn fetch_config(&mut self) -> Result<String, TransportError> {
+        Err(TransportError::Fatal(
+            "this transport cannot fetch the current configuration".to_string(),
+        ))
+    }
+
+    /// Replace the target's configuration with a previously fetched config.xml
+    fn restore_config(&mut self, _config: &str) -> Result<(), TransportError> {
+        Err(TransportError::Fatal(
+            "this transport cannot restore a configuration".to_string(),
+        ))
+    }
+}
+
+/// Transport that records batches in memory instead of sending them
+///
+/// Useful for dry runs and tests.
+#[derive(Debug, Default)]
+pub struct RecordingTransport {
+    /// Batches received, in order
+    pub batches: Vec<Vec<ApplyItem>>,
+    /// Configuration returned by `fetch_config` and replaced by `restore_config`
+    pub current_config: Option<String>,
+}
+
+impl RecordingTransport {
+    /// Create an empty recording transport
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Create a recording transport that reports the given current configuration
+    pub fn with_config<S: Into<String>>(config: S) -> Self {
+        Self {
+            batches: Vec::new(),
+            current_config: Some(config.into()),
+        }
+    }
+
+    /// Total number of items received
+    pub fn item_count(&self) -> usize {
+        self.batches.iter().map(Vec::len).sum()
+    }
+}
+
+impl ApplyTransport for RecordingTransport {
+    fn send_batch(&mut self, batch: &[ApplyItem]) -> Result<(), TransportError> {
+        self.batches.push(batch.to_vec());
+        Ok(())
+    }
+
+    fn fetch_config(&mut self) -> Result<String, TransportError> {
+        self.current_config
+            .clone()
+            .ok_or_else(|| TransportError::Fatal("no configuration recorded".to_string()))
+    }
+
+    fn restore_config(&mut self, config: &str) -> Result<(), TransportError> {
+        self.current_config = Some(config.to_string());
+        self.batches.clear();
+        Ok(())
+    }
+}
@@ -0,0 +1,449 @@
+//! Apply command - push generated objects to a live firewall
+//!
+//! VLANs are loaded from generated output the same way `--minimize-diff`
+//! reads a previous run, turned into [`ApplyItem`]s, and handed to the
+//! [`Applier`] with an [`OpnsenseTransport`]. `--dry-run` swaps in a
+//! [`RecordingTransport`] to show the batches without contacting anything.
+//! With `--labels` and `--filter`, only the objects of matching VLANs are
+//! pushed.
+//!
+//! Before pushing, the changes are planned against the firewall's current
+//! configuration, listed Terraform-style, and applied only once confirmed
+//! with `yes`; `--auto-approve` skips the review for unattended runs.
+//!
+//! Unless `--no-snapshot` is given, the firewall's configuration is saved
+//! before anything is pushed; `--rollback` restores such a snapshot.
+
+use crate::apply::approval::{ApplyPlan, Approver};
+use crate::apply::opnsense::OpnsenseTransport;
+use crate::apply::transport::RecordingTransport;
+use crate::apply::{
+    Applier, ApplyItem, ApplyItemKind, ApplyOptions, ApplyReport, items_from_labeled_rules,
+    items_from_labeled_vlans, select_items,
+};
+use crate::cli::theme::{self, Role};
+use crate::cli::{ApiTargetArgs, ApplyArgs, GlobalArgs};
+use crate::generator::{LabelSelector, LabelSet};
+use crate::io::csv::read_firewall_rules_csv;
+use crate::io::previous::load_previous_configs;
+use crate::model::ConfigError;
+use crate::xml::ChangeKind;
+use anyhow::{Context, Result};
+use std::fs;
+use std::io::{self, BufRead, IsTerminal, Write};
+use std::path::Path;
+
+/// Execute the apply command
+pub fn execute(args: ApplyArgs, global: &GlobalArgs) -> Result<()> {
+    if let Some(snapshot) = &args.rollback {
+        return rollback(&args.target, snapshot, global);
+    }
+
+    let items = load_items(&args)?;
+    let options = ApplyOptions {
+        batch_size: usize::from(args.batch_size),
+        requests_per_second: (args.rate > 0.0).then_some(args.rate),
+        max_retries: args.max_retries,
+        checkpoint: args.checkpoint.clone(),
+        snapshot_dir: (!args.no_snapshot).then(|| args.snapshot_dir.clone()),
+        ..ApplyOptions::default()
+    };
+
+    if !global.quiet {
+        println!(
+            "{}",
+            theme::paint(Role::Title, "🚀 OPNsense Config Faker - Apply")
+        );
+        println!();
+        print_items(&items);
+    }
+
+    if args.dry_run {
+        let options = ApplyOptions {
+            requests_per_second: None,
+            checkpoint: None,
+            snapshot_dir: None,
+            ..options
+        };
+        let mut applier = Applier::new(RecordingTransport::new(), options);
+        let report = applier.run(&items)?;
+        if !global.quiet {
+            println!(
+                "  Dry run: {} objects in {} batches, nothing was sent",
+                report.items_applied, report.batches_sent
+            );
+        }
+        return Ok(());
+    }
+
+    require_parent_interface(&args.target)?;
+    let mut applier = Applier::new(transport(&args.target)?, options);
+    let report = if args.auto_approve {
+        applier.run(&items)?
+    } else {
+        applier.run_with_approval(&items, &mut PromptApprover::stdio())?
+    };
+    if !global.quiet {
+        print_report(&report);
+    }
+    Ok(())
+}
+
+/// Restore the firewall from a snapshot taken by an earlier apply
+fn rollback(target: &ApiTargetArgs, snapshot: &Path, global: &GlobalArgs) -> Result<()> {
+    if target.ssh.is_none() {
+        return Err(ConfigError::invalid_parameter(
+            "ssh",
+            "--ssh is required to restore a snapshot; the API cannot upload a configuration",
+        )
+        .into());
+    }
+    let mut applier = Applier::new(transport(target)?, ApplyOptions::default());
+    applier.rollback(snapshot)?;
+    if !global.quiet {
+        println!(
+            "{} Restored {}; the firewall is reloading its services",
+            theme::paint(Role::Success, "✅"),
+            snapshot.display()
+        );
+    }
+    Ok(())
+}
+
+/// Build the transport for a firewall from the connection flags
+pub(crate) fn transport(target: &ApiTargetArgs) -> Result<OpnsenseTransport> {
+    let missing = |flag: &str, hint: &str| {
+        ConfigError::invalid_parameter(flag, format!("--{flag} is required{hint}"))
+    };
+    let url = target
+        .url
+        .as_deref()
+        .ok_or_else(|| missing("url", " to reach the firewall"))?;
+    let key = target
+        .api_key
+        .as_deref()
+        .ok_or_else(|| missing("api-key", " (or set OPNSENSE_API_KEY)"))?;
+    let secret = target
+        .api_secret
+        .as_deref()
+        .ok_or_else(|| missing("api-secret", " (or set OPNSENSE_API_SECRET)"))?;
+
+    let mut transport = OpnsenseTransport::new(url, key, secret).with_insecure(target.insecure);
+    if let Some(device) = &target.parent_interface {
+        transport = transport.with_parent_interface(device.as_str());
+    }
+    if let Some(destination) = &target.ssh {
+        transport = transport.with_ssh(destination.as_str());
+    }
+    Ok(transport)
+}
+
+/// Fail before anything is pushed when VLANs would have no parent device
+pub(crate) fn require_parent_interface(target: &ApiTargetArgs) -> Result<()> {
+    if target.parent_interface.is_none() {
+        return Err(ConfigError::invalid_parameter(
+            "parent-interface",
+            "--parent-interface is required to create VLANs on",
+        )
+        .into());
+    }
+    Ok(())
+}
+
+/// Load the VLANs and rules to apply and the items built from them
+fn load_items(args: &ApplyArgs) -> Result<Vec<ApplyItem>> {
+    let input = args
+        .input
+        .as_deref()
+        .context("--input is required unless --rollback is given")?;
+    let configs = load_previous_configs(input, args.backup_passphrase.as_deref())
+        .with_context(|| format!("Failed to load {}", input.display()))?;
+    let labels = match &args.labels {
+        Some(path) => load_labels(path)?,
+        None => LabelSet::default(),
+    };
+    let mut items = items_from_labeled_vlans(&configs, &labels);
+
+    if let Some(path) = &args.firewall_rules {
+        let rules = read_firewall_rules_csv(path)
+            .with_context(|| format!("Failed to read firewall rules from {}", path.display()))?;
+        items.extend(items_from_labeled_rules(&rules, &labels));
+    }
+
+    match args.filter.iter().cloned().reduce(LabelSelector::and) {
+        Some(selector) => Ok(select_items(items, &selector)),
+        None => Ok(items),
+    }
+}
+
+/// Read a labels file written by `generate --labels`
+fn load_labels(path: &Path) -> Result<LabelSet> {
+    let json = fs::read_to_string(path)
+        .with_context(|| format!("Failed to read labels from {}", path.display()))?;
+    serde_json::from_str(&json)
+        .with_context(|| format!("Failed to parse labels in {}", path.display()))
+}
+
+/// Shows the plan and asks for confirmation; only `yes` approves
+struct PromptApprover<R, W> {
+    input: R,
+    output: W,
+    interactive: bool,
+}
+
+impl PromptApprover<io::StdinLock<'static>, io::Stdout> {
+    /// Prompt on the terminal
+    ///
+    /// When stdin is not a terminal nobody can answer, so approval fails
+    /// instead of reading a stray line from a pipe.
+    fn stdio() -> Self {
+        let stdin = io::stdin();
+        let interactive = stdin.is_terminal();
+        Self::new(stdin.lock(), io::stdout(), interactive)
+    }
+}
+
+impl<R: BufRead, W: Write> PromptApprover<R, W> {
+    fn new(input: R, output: W, interactive: bool) -> Self {
+        Self {
+            input,
+            output,
+            interactive,
+        }
+    }
+}
+
+impl<R: BufRead, W: Write> Approver for PromptApprover<R, W> {
+    fn approve(&mut self, plan: &ApplyPlan) -> crate::Result<bool> {
+        write!(self.output, "{}", render_plan(plan))?;
+        if !self.interactive {
+            return Err(ConfigError::apply(
+                "Cannot ask for confirmation without a terminal; use --auto-approve \
+                 to apply unattended",
+            ));
+        }
+
+        write!(
+            self.output,
+            "\n{}\n  Only 'yes' will be accepted to approve.\n\n  Enter a value: ",
+            theme::paint(Role::Heading, "Do you want to apply these changes?")
+        )?;
+        self.output.flush()?;
+
+        let mut answer = String::new();
+        self.input.read_line(&mut answer)?;
+        Ok(answer.trim() == "yes")
+    }
+}
+
+/// Colorized listing of every planned change followed by the summary
+fn render_plan(plan: &ApplyPlan) -> String {
+    let mut out = String::new();
+    for change in &plan.changes {
+        let old = change.old.as_deref().unwrap_or_default();
+        let new = change.new.as_deref().unwrap_or_default();
+        let line = match change.kind {
+            ChangeKind::Added => {
+                theme::paint(Role::Added, format!("  + {} = {new:?}", change.path))
+            }
+            ChangeKind::Changed => theme::paint(
+                Role::Warning,
+                format!("  ~ {} = {old:?} -> {new:?}", change.path),
+            ),
+            ChangeKind::Removed => {
+                theme::paint(Role::Removed, format!("  - {} = {old:?}", change.path))
+            }
+        };
+        out.push_str(&format!("{line}\n"));
+    }
+    if !plan.is_empty() {
+        out.push('\n');
+    }
+    out.push_str(&format!(
+        "{}\n",
+        theme::paint(Role::Heading, plan.summary())
+    ));
+    out
+}
+
+/// Print how many objects of each kind are about to be pushed
+fn print_items(items: &[ApplyItem]) {
+    let count = |kind| items.iter().filter(|item| item.kind == kind).count();
+    println!(
+        "  {} objects: {} VLANs, {} aliases, {} rules",
+        items.len(),
+        count(ApplyItemKind::Vlan),
+        count(ApplyItemKind::Alias),
+        count(ApplyItemKind::Rule)
+    );
+}
+
+fn print_report(report: &ApplyReport) {
+    if let Some(snapshot) = &report.snapshot {
+        println!(
+            "  📸 Saved the previous configuration to {}",
+            snapshot.display()
+        );
+        println!("     Undo with: apply --rollback {}", snapshot.display());
+    }
+    if report.resumed_from > 0 {
+        println!(
+            "  ↩️  Resumed after {} objects applied by an earlier run",
+            report.resumed_from
+        );
+    }
+    println!(
+        "  {} Applied {} objects in {} batches ({} retries)",
+        theme::paint(Role::Success, "✅"),
+        report.items_applied,
+        report.batches_sent,
+        report.retries
+    );
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::generator::vlan::VlanConfig;
+    use crate::generator::{FirewallComplexity, generate_firewall_rules};
+    use crate::io::csv::{write_csv, write_firewall_rules_csv};
+    use tempfile::TempDir;
+
+    fn args(input: &Path) -> ApplyArgs {
+        ApplyArgs {
+            input: Some(input.to_path_buf()),
+            target: ApiTargetArgs::default(),
+            firewall_rules: Some(input.with_file_name("vlans_firewall_rules.csv")),
+            backup_passphrase: None,
+            labels: None,
+            filter: Vec::new(),
+            batch_size: 4,
+            rate: 0.0,
+            max_retries: 0,
+            checkpoint: None,
+            snapshot_dir: input.with_file_name("snapshots"),
+            no_snapshot: false,
+            rollback: None,
+            auto_approve: false,
+            dry_run: true,
+        }
+    }
+
+    fn write_vlans(dir: &Path) -> std::path::PathBuf {
+        let path = dir.join("vlans.csv");
+        let configs = vec![
+            VlanConfig::new(100, "10.1.2.x".to_string(), "IT VLAN 100".to_string(), 1).unwrap(),
+            VlanConfig::new(200, "10.3.4.x".to_string(), "HR VLAN 200".to_string(), 2).unwrap(),
+        ];
+        write_csv(&configs, &path).unwrap();
+        let rules =
+            generate_firewall_rules(&configs, FirewallComplexity::Basic, Some(7), None, None)
+                .unwrap();
+        write_firewall_rules_csv(&rules, dir.join("vlans_firewall_rules.csv")).unwrap();
+        path
+    }
+
+    #[test]
+    fn test_items_include_rules_on_request() {
+        let dir = TempDir::new().unwrap();
+        let input = write_vlans(dir.path());
+
+        let items = load_items(&args(&input)).unwrap();
+        assert_eq!(
+            items
+                .iter()
+                .filter(|i| i.kind == ApplyItemKind::Vlan)
+                .count(),
+            2
+        );
+        assert_eq!(
+            items
+                .iter()
+                .filter(|i| i.kind == ApplyItemKind::Rule)
+                .count(),
+            6
+        );
+
+        let without_rules = ApplyArgs {
+            firewall_rules: None,
+            ..args(&input)
+        };
+        assert_eq!(load_items(&without_rules).unwrap().len(), 4);
+    }
+
+    #[test]
+    fn test_filter_keeps_matching_vlans() {
+        let dir = TempDir::new().unwrap();
+        let input = write_vlans(dir.path());
+        let labels_path = dir.path().join("vlans_labels.json");
+        fs::write(
+            &labels_path,
+            r#"{"batch": "batch-1", "vlans": {"100": {"site": "hq"}, "200": {"site": "branch-01"}}}"#,
+        )
+        .unwrap();
+
+        let filtered = ApplyArgs {
+            labels: Some(labels_path),
+            filter: vec!["site=hq".parse().unwrap()],
+            ..args(&input)
+        };
+        let items = load_items(&filtered).unwrap();
+        assert_eq!(items.len(), 5);
+        assert!(items.iter().all(|i| i.labels.get("site") == Some("hq")));
+        assert!(items.iter().any(|i| i.key == "vlan-100"));
+    }
+
+    #[test]
+    fn test_dry_run_needs_no_firewall() {
+        let dir = TempDir::new().unwrap();
+        let input = write_vlans(dir.path());
+        let global = GlobalArgs {
+            quiet: true,
+            ..GlobalArgs::default()
+        };
+        execute(args(&input), &global).unwrap();
+
+        let live = ApplyArgs {
+            dry_run: false,
+            ..args(&input)
+        };
+        let err = execute(live, &global).unwrap_err();
+        assert!(err.to_string().contains("--parent-interface"));
+        assert!(!input.with_file_name("snapshots").exists());
+    }
+
+    #[test]
+    fn test_prompt_requires_yes() {
+        let current = "<opnsense><vlans/></opnsense>";
+        let dir = TempDir::new().unwrap();
+        let items = load_items(&args(&write_vlans(dir.path()))).unwrap();
+        let plan = ApplyPlan::new(current, &items).unwrap();
+        for (answer, approved) in [("yes\n", true), ("y\n", false), ("\n", false)] {
+            let mut output = Vec::new();
+            let mut approver = PromptApprover::new(answer.as_bytes(), &mut output, true);
+            assert_eq!(approver.approve(&plan).unwrap(), approved);
+            let shown = String::from_utf8(output).unwrap();
+            assert!(shown.contains("/opnsense/vlans/vlan[2]/descr"));
+            assert!(shown.contains("Enter a value:"));
+        }
+
+        let mut output = Vec::new();
+        let mut unattended = PromptApprover::new("yes\n".as_bytes(), &mut output, false);
+        let err = unattended.approve(&plan).unwrap_err();
+        assert!(err.to_string().contains("--auto-approve"));
+    }
+
+    #[test]
+    fn test_rollback_needs_ssh() {
+        let dir = TempDir::new().unwrap();
+        let snapshot = dir.path().join("snapshot-1-abc.xml");
+        let rollback = ApplyArgs {
+            input: None,
+            rollback: Some(snapshot),
+            dry_run: false,
+            ..args(dir.path())
+        };
+        let err = execute(rollback, &GlobalArgs::default()).unwrap_err();
+        assert!(err.to_string().contains("--ssh"));
+    }
+}
@@ -0,0 +1,132 @@
+//! Audit command - check generated configurations for weak or reused secrets
+//!
+//! `audit secrets` reads a configuration, or a directory of them as one
+//! fleet, and reports credentials that miss the complexity requirements or
+//! appear in more than one place; see [`crate::validate::secrets`].
+
+use crate::cli::theme::{self, Role};
+use crate::cli::{AuditArgs, AuditCommand, AuditSecretsArgs, GlobalArgs};
+use crate::model::ConfigError;
+use crate::validate::policy::Policy;
+use crate::validate::secrets::{SecretRules, audit, load_secrets};
+use anyhow::{Context, Result};
+use std::collections::HashSet;
+
+/// Execute the audit command
+pub fn execute(args: AuditArgs, global: &GlobalArgs) -> Result<()> {
+    match args.command {
+        AuditCommand::Secrets(args) => secrets(args, global),
+    }
+}
+
+fn secrets(args: AuditSecretsArgs, global: &GlobalArgs) -> Result<()> {
+    let rules = secret_rules(&args)?;
+    let secrets = load_secrets(&args.input)
+        .with_context(|| format!("Failed to read secrets from {}", args.input.display()))?;
+    let findings = audit(&secrets, &rules);
+
+    if !global.quiet {
+        println!(
+            "{}",
+            theme::paint(Role::Title, "🔐 OPNsense Config Faker - Secret Audit")
+        );
+        println!();
+        let files: HashSet<&str> = secrets.iter().map(|s| s.file.as_str()).collect();
+        println!(
+            "Checked {} secrets in {} file(s): at least {} characters, {} character classes, \
+             {} bits",
+            secrets.len(),
+            files.len(),
+            rules.min_length,
+            rules.min_classes,
+            rules.min_entropy_bits
+        );
+        println!();
+        for finding in &findings {
+            println!("  {} {finding}", theme::paint(Role::Error, "finding"));
+        }
+        if findings.is_empty() {
+            println!(
+                "{} No weak or reused secrets",
+                theme::paint(Role::Success, "✅")
+            );
+        }
+    }
+
+    if !findings.is_empty() {
+        return Err(ConfigError::validation(format!(
+            "Secret audit failed: {} finding(s)",
+            findings.len()
+        ))
+        .into());
+    }
+    Ok(())
+}
+
+/// Requirements from the policy file, overridden by the flags
+fn secret_rules(args: &AuditSecretsArgs) -> Result<SecretRules> {
+    let mut rules = match &args.policy {
+        Some(path) => Policy::load(path)
+            .with_context(|| format!("Failed to load policy: {}", path.display()))?
+            .secret_rules()
+            .unwrap_or_default(),
+        None => SecretRules::default(),
+    };
+    if let Some(min_length) = args.min_length {
+        rules.min_length = min_length;
+    }
+    if let Some(min_classes) = args.min_classes {
+        rules.min_classes = min_classes;
+    }
+    if let Some(min_entropy) = args.min_entropy {
+        rules.min_entropy_bits = min_entropy;
+    }
+    Ok(rules)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use std::path::Path;
+    use tempfile::TempDir;
+
+    fn args(input: &Path, policy: Option<&Path>) -> AuditSecretsArgs {
+        AuditSecretsArgs {
+            input: input.to_path_buf(),
+            policy: policy.map(Path::to_path_buf),
+            min_length: None,
+            min_classes: None,
+            min_entropy: None,
+        }
+    }
+
+    #[test]
+    fn test_audit_secrets_fails_on_shared_psk() {
+        let dir = TempDir::new().unwrap();
+        let psk = "<opnsense><ipsec><psk>q7#Vn2!pLx9@Rt4$Wz</psk></ipsec></opnsense>";
+        fs::write(dir.path().join("fw1.xml"), psk).unwrap();
+        let quiet = GlobalArgs {
+            quiet: true,
+            ..GlobalArgs::default()
+        };
+        assert!(secrets(args(&dir.path().join("fw1.xml"), None), &quiet).is_ok());
+
+        fs::write(dir.path().join("fw2.xml"), psk).unwrap();
+        let err = secrets(args(dir.path(), None), &quiet).unwrap_err();
+        assert!(err.to_string().contains("1 finding(s)"));
+    }
+
+    #[test]
+    fn test_flags_override_policy_rules() {
+        let dir = TempDir::new().unwrap();
+        let policy = dir.path().join("policy.json");
+        fs::write(&policy, r#"{"secrets": {"min_length": 24}}"#).unwrap();
+        let mut args = args(dir.path(), Some(&policy));
+        assert_eq!(secret_rules(&args).unwrap().min_length, 24);
+        assert_eq!(secret_rules(&args).unwrap().min_classes, 3);
+
+        args.min_length = Some(8);
+        assert_eq!(secret_rules(&args).unwrap().min_length, 8);
+    }
+}
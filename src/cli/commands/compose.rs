@@ -0,0 +1,92 @@
+//! Compose command - expand a scenario's snippet blocks into a VLAN CSV
+//!
+//! Large fixtures often repeat the same bundle of VLANs per site. Scenarios
+//! list those bundles as `blocks` referring to snippets in a library
+//! directory; this command instantiates each block and writes the combined
+//! VLANs as CSV, ready to use directly or as `generate --csv-file` input.
+
+use crate::cli::theme::{self, Role};
+use crate::cli::{ComposeArgs, GlobalArgs};
+use crate::io::csv::write_csv;
+use crate::model::scenario::Scenario;
+use crate::model::snippet::SnippetLibrary;
+use anyhow::{Context, Result, bail};
+use std::fs;
+use std::path::PathBuf;
+
+/// Execute the compose command
+pub fn execute(args: ComposeArgs, global: &GlobalArgs) -> Result<()> {
+    let scenario = Scenario::load(&args.scenario)
+        .with_context(|| format!("Failed to load scenario {}", args.scenario.display()))?;
+    if !scenario.is_composed() {
+        bail!(
+            "Scenario '{}' has no blocks; use `generate` for random scenarios",
+            scenario.name
+        );
+    }
+
+    let library = SnippetLibrary::load_dir(&args.snippets)
+        .with_context(|| format!("Failed to load snippets from {}", args.snippets.display()))?;
+    let configs = library
+        .compose(&scenario.blocks)
+        .with_context(|| format!("Failed to compose scenario '{}'", scenario.name))?;
+
+    let output = global
+        .output
+        .clone()
+        .unwrap_or_else(|| PathBuf::from(scenario.composed_csv()));
+    if let Some(parent) = output.parent()
+        && !parent.as_os_str().is_empty()
+    {
+        fs::create_dir_all(parent)
+            .with_context(|| format!("Failed to create {}", parent.display()))?;
+    }
+    write_csv(&configs, &output).with_context(|| format!("Failed to write CSV to {:?}", output))?;
+
+    if !global.quiet {
+        println!(
+            "{}",
+            theme::paint(Role::Success, "🧩 Scenario composed").bold()
+        );
+        println!(
+            "  {} VLANs from {} blocks ({} snippets available)",
+            configs.len(),
+            scenario.blocks.len(),
+            library.len()
+        );
+        println!("  📄 {}", output.display());
+    }
+
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::cli::BuildTool;
+    use crate::cli::commands::init_fixtures::scaffold_fixtures;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_compose_scaffolded_scenario() {
+        let dir = TempDir::new().unwrap();
+        scaffold_fixtures(dir.path(), &BuildTool::Just, false, false).unwrap();
+        let output = dir.path().join("generated/branch-sites.csv");
+
+        let args = ComposeArgs {
+            scenario: dir.path().join("scenarios/branch-sites.json"),
+            snippets: dir.path().join("snippets"),
+        };
+        let global = GlobalArgs {
+            quiet: true,
+            output: Some(output.clone()),
+            ..GlobalArgs::default()
+        };
+        execute(args, &global).unwrap();
+
+        let configs = crate::io::csv::read_csv(&output).unwrap();
+        assert_eq!(configs.len(), 6);
+        assert_eq!(configs[0].description, "Branch A Guest");
+        assert_eq!(configs[5].vlan_id, 122);
+    }
+}
@@ -2,18 +2,16 @@
 
 use crate::Result;
 use crate::cli::CsvArgs;
+use crate::cli::progress;
+use crate::cli::theme::{self, Role};
 use crate::generator::vlan::generate_vlan_configurations;
 use crate::io::csv::write_csv;
-use console::style;
-use indicatif::{ProgressBar, ProgressStyle};
 
 /// Execute the CSV generation command
 pub fn execute(args: CsvArgs) -> Result<()> {
     println!(
         "{}",
-        style("🔧 OPNsense Config Faker - CSV Generator")
-            .bold()
-            .blue()
+        theme::paint(Role::Title, "🔧 OPNsense Config Faker - CSV Generator")
     );
     println!();
 
@@ -26,14 +24,7 @@ pub fn execute(args: CsvArgs) -> Result<()> {
     }
 
     // Set up progress indicator
-    let pb = ProgressBar::new(args.count as u64);
-    pb.set_style(
-        ProgressStyle::default_bar()
-            .template("{spinner:.green} [{elapsed_precise}] [{bar:40.cyan/blue}] {pos}/{len} {msg}")
-            .unwrap()
-            .progress_chars("#>-"),
-    );
-    pb.set_message("Generating VLAN configurations...");
+    let pb = progress::bar(args.count as u64, "Generating VLAN configurations...");
 
     // Generate VLAN configurations
     let configs = generate_vlan_configurations(args.count, args.seed, Some(&pb))?;
@@ -50,7 +41,7 @@ pub fn execute(args: CsvArgs) -> Result<()> {
     ));
 
     println!();
-    println!("{}", style("Summary:").bold());
+    println!("{}", theme::paint(Role::Heading, "Summary:"));
     println!("  📊 Configurations: {}", configs.len());
     println!("  📁 Output file: {}", args.output.display());
     println!(
@@ -1,8 +1,8 @@
 //! Deprecation handlers for legacy command structure
 
+use crate::cli::theme::{self, Role};
 use crate::cli::{CsvArgs, XmlArgs};
 use anyhow::Result;
-use console::style;
 
 /// Handle deprecated CSV command with migration guidance
 pub fn handle_deprecated_csv(args: CsvArgs) -> Result<()> {
@@ -11,15 +11,15 @@ pub fn handle_deprecated_csv(args: CsvArgs) -> Result<()> {
         return Err(crate::model::ConfigError::invalid_parameter("count", e.to_string()).into());
     }
 
-    println!("{}", style("⚠️  DEPRECATED COMMAND").bold().yellow());
+    println!("{}", theme::paint(Role::Warning, "⚠️  DEPRECATED COMMAND"));
     println!();
     println!("The 'csv' subcommand has been replaced with the unified 'generate' command.");
     println!();
-    println!("{}", style("Migration Guide:").bold());
+    println!("{}", theme::paint(Role::Heading, "Migration Guide:"));
     println!("  Old command:");
     println!(
         "    {} csv --count {} --output {} {}{}",
-        style("opnsense-config-faker").cyan(),
+        theme::paint(Role::Accent, "opnsense-config-faker"),
         args.count,
         args.output.display(),
         if args.force { "--force " } else { "" },
@@ -33,7 +33,7 @@ pub fn handle_deprecated_csv(args: CsvArgs) -> Result<()> {
     println!("  New command:");
     println!(
         "    {} generate --format csv --count {} --output {} {}{}",
-        style("opnsense-config-faker").cyan(),
+        theme::paint(Role::Accent, "opnsense-config-faker"),
         args.count,
         args.output.display(),
         if args.force { "--force " } else { "" },
@@ -46,7 +46,7 @@ pub fn handle_deprecated_csv(args: CsvArgs) -> Result<()> {
     println!();
     println!(
         "Use '{}' for more information.",
-        style("opnsense-config-faker generate --help").cyan()
+        theme::paint(Role::Accent, "opnsense-config-faker generate --help")
     );
 
     Err(crate::model::ConfigError::config(
@@ -62,11 +62,11 @@ pub fn handle_deprecated_xml(args: XmlArgs) -> Result<()> {
         return Err(crate::model::ConfigError::invalid_parameter("count", e.to_string()).into());
     }
 
-    println!("{}", style("⚠️  DEPRECATED COMMAND").bold().yellow());
+    println!("{}", theme::paint(Role::Warning, "⚠️  DEPRECATED COMMAND"));
     println!();
     println!("The 'xml' subcommand has been replaced with the unified 'generate' command.");
     println!();
-    println!("{}", style("Migration Guide:").bold());
+    println!("{}", theme::paint(Role::Heading, "Migration Guide:"));
     println!("  Old command:");
 
     let mut old_cmd = format!(
@@ -93,7 +93,7 @@ pub fn handle_deprecated_xml(args: XmlArgs) -> Result<()> {
         old_cmd.push_str(&format!(" --seed {seed}"));
     }
 
-    println!("    {}", style(old_cmd).cyan());
+    println!("    {}", theme::paint(Role::Accent, old_cmd));
     println!();
 
     let mut new_cmd = format!(
@@ -121,11 +121,11 @@ pub fn handle_deprecated_xml(args: XmlArgs) -> Result<()> {
     }
 
     println!("  New command:");
-    println!("    {}", style(new_cmd).cyan());
+    println!("    {}", theme::paint(Role::Accent, new_cmd));
     println!();
     println!(
         "Use '{}' for more information.",
-        style("opnsense-config-faker generate --help").cyan()
+        theme::paint(Role::Accent, "opnsense-config-faker generate --help")
     );
 
     Err(crate::model::ConfigError::config(
@@ -0,0 +1,93 @@
+//! Diff command - compare configurations value by value
+//!
+//! With `--against-default` the baseline is the embedded OPNsense factory
+//! default, so the report lists exactly what a configuration adds to or
+//! changes in a fresh installation.
+
+use crate::cli::{DiffArgs, GlobalArgs, ReportFormat};
+use crate::io::report::Report;
+use crate::xml::{ChangeKind, ConfigChange, FACTORY_DEFAULT_CONFIG, diff_configs};
+use anyhow::{Context, Result};
+use std::fs;
+use std::path::Path;
+
+/// Execute the diff command
+pub fn execute(args: DiffArgs, global: &GlobalArgs) -> Result<()> {
+    let changes = diff(&args)?;
+
+    if args.summary {
+        let mut report = Report::new(["change", "count"]);
+        for kind in [ChangeKind::Added, ChangeKind::Removed, ChangeKind::Changed] {
+            let count = changes.iter().filter(|c| c.kind == kind).count();
+            report.push_row([kind.to_string(), count.to_string()])?;
+        }
+        print!("{}", report.render(args.format)?);
+        return Ok(());
+    }
+
+    let mut report = Report::new(["change", "path", "old", "new"]);
+    for change in &changes {
+        report.push_row([
+            change.kind.to_string(),
+            change.path.clone(),
+            change.old.clone().unwrap_or_default(),
+            change.new.clone().unwrap_or_default(),
+        ])?;
+    }
+    print!("{}", report.render(args.format)?);
+    if args.format == ReportFormat::Table && !global.quiet {
+        println!();
+        println!("{} differences", changes.len());
+    }
+
+    Ok(())
+}
+
+/// Compare the configuration with its baseline
+fn diff(args: &DiffArgs) -> Result<Vec<ConfigChange>> {
+    let config = read(&args.config)?;
+    let baseline = match &args.baseline {
+        Some(path) if !args.against_default => read(path)?,
+        _ => FACTORY_DEFAULT_CONFIG.to_string(),
+    };
+    Ok(diff_configs(&baseline, &config)?)
+}
+
+fn read(path: &Path) -> Result<String> {
+    fs::read_to_string(path).with_context(|| format!("Failed to read {}", path.display()))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::generator::VlanConfig;
+    use crate::xml::config_from_default;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_diff_against_default() {
+        let dir = TempDir::new().unwrap();
+        let path = dir.path().join("firewall_1.xml");
+        let config =
+            VlanConfig::new(100, "10.1.2.x".to_string(), "IT VLAN 100".to_string(), 1).unwrap();
+        fs::write(&path, config_from_default(&[config], 6, None).unwrap()).unwrap();
+
+        let args = DiffArgs {
+            config: path.clone(),
+            baseline: None,
+            against_default: true,
+            format: ReportFormat::Table,
+            summary: false,
+        };
+        let changes = diff(&args).unwrap();
+        assert!(changes.iter().all(|c| c.kind == ChangeKind::Added));
+        assert!(changes.iter().any(|c| c.path == "/opnsense/vlans/vlan/tag"));
+
+        let args = DiffArgs {
+            baseline: Some(path),
+            against_default: false,
+            ..args
+        };
+        assert!(diff(&args).unwrap().is_empty());
+    }
+}
@@ -0,0 +1,103 @@
+//! Extract command - pull values out of generated XML or JSON files
+
+use crate::cli::{ExtractArgs, GlobalArgs, ReportFormat};
+use crate::io::report::Report;
+use crate::query::JsonPointer;
+use crate::query::pointer::display_value;
+use crate::xml::XPath;
+use anyhow::{Context, Result};
+use std::fs::{self, File};
+use std::io::BufReader;
+
+/// Execute the extract command
+pub fn execute(args: ExtractArgs, global: &GlobalArgs) -> Result<()> {
+    let matches = extract(&args)?;
+
+    if args.raw {
+        for (_, value) in &matches {
+            println!("{value}");
+        }
+        return Ok(());
+    }
+
+    let mut report = Report::new(["path", "value"]);
+    for (path, value) in &matches {
+        report.push_row([path.as_str(), value.as_str()])?;
+    }
+    print!("{}", report.render(args.format)?);
+    if args.format == ReportFormat::Table && !global.quiet {
+        println!();
+        println!("{} matches", matches.len());
+    }
+
+    Ok(())
+}
+
+/// Evaluate the XPath or JSON pointer, returning (path, value) pairs in document order
+fn extract(args: &ExtractArgs) -> Result<Vec<(String, String)>> {
+    if let Some(expr) = &args.xpath {
+        // Compile before opening so syntax errors don't wait on a large input
+        let xpath = XPath::parse(expr)?;
+        let file = File::open(&args.input)
+            .with_context(|| format!("Failed to open {}", args.input.display()))?;
+        let matches = xpath
+            .evaluate(BufReader::new(file))
+            .with_context(|| format!("Failed to evaluate XPath on {}", args.input.display()))?;
+        return Ok(matches.into_iter().map(|m| (m.path, m.value)).collect());
+    }
+
+    let pointer = JsonPointer::parse(args.pointer.as_deref().unwrap_or_default())?;
+    let content = fs::read_to_string(&args.input)
+        .with_context(|| format!("Failed to read {}", args.input.display()))?;
+    let document: serde_json::Value = serde_json::from_str(&content)
+        .with_context(|| format!("Failed to parse {} as JSON", args.input.display()))?;
+    Ok(pointer
+        .resolve(&document)
+        .into_iter()
+        .map(|(path, value)| (path, display_value(value)))
+        .collect())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::path::Path;
+    use tempfile::TempDir;
+
+    fn args(input: &Path, xpath: Option<&str>, pointer: Option<&str>) -> ExtractArgs {
+        ExtractArgs {
+            input: input.to_path_buf(),
+            xpath: xpath.map(str::to_string),
+            pointer: pointer.map(str::to_string),
+            format: ReportFormat::Table,
+            raw: false,
+        }
+    }
+
+    #[test]
+    fn test_extract_xpath_and_pointer() {
+        let dir = TempDir::new().unwrap();
+        let xml = dir.path().join("config.xml");
+        fs::write(
+            &xml,
+            "<opnsense><vlans><vlan><tag>10</tag></vlan><vlan><tag>11</tag></vlan></vlans></opnsense>",
+        )
+        .unwrap();
+        let values = extract(&args(&xml, Some("//vlan/tag"), None)).unwrap();
+        assert_eq!(
+            values[1],
+            ("/opnsense/vlans/vlan/tag".to_string(), "11".to_string())
+        );
+
+        let json = dir.path().join("data.json");
+        fs::write(&json, r#"[{"vlan_id": 10}, {"vlan_id": 11}]"#).unwrap();
+        let values = extract(&args(&json, None, Some("/*/vlan_id"))).unwrap();
+        assert_eq!(
+            values,
+            vec![
+                ("/0/vlan_id".to_string(), "10".to_string()),
+                ("/1/vlan_id".to_string(), "11".to_string())
+            ]
+        );
+    }
+}
@@ -0,0 +1,158 @@
+//! Fuzz command - differential checks between emitters and parsers
+//!
+//! `fuzz roundtrip` generates random VLAN sets, emits them through every XML
+//! emitter, parses the output back, and reports values that changed on the
+//! way. Running it in CI catches emitter/parser asymmetries as new sections
+//! are added; the `roundtrip` cargo-fuzz target drives the same checks from
+//! fuzzer input.
+//!
+//! `fuzz sample` prints seeded [`Arbitrary`] fragments as JSON lines for
+//! property-based tests outside this crate.
+
+use crate::cli::theme::{self, Role};
+use crate::cli::{
+    FragmentKind, FuzzArgs, FuzzCommand, FuzzRoundtripArgs, FuzzSampleArgs, GlobalArgs,
+};
+use crate::generator::vlan::DhcpServerConfig;
+use crate::generator::{Arbitrary, FirewallRule, VlanConfig};
+use crate::model::ConfigError;
+use crate::xml::roundtrip::run_roundtrip;
+use anyhow::{Context, Result};
+use serde::Serialize;
+use std::fs;
+
+/// Failed cases printed in full; the rest are only counted
+const SHOWN_FAILURES: usize = 5;
+
+/// Execute the fuzz command
+pub fn execute(args: FuzzArgs, global: &GlobalArgs) -> Result<()> {
+    match args.command {
+        FuzzCommand::Roundtrip(args) => roundtrip(args, global),
+        FuzzCommand::Sample(args) => sample(args, global),
+    }
+}
+
+fn sample(args: FuzzSampleArgs, global: &GlobalArgs) -> Result<()> {
+    let lines = match args.kind {
+        FragmentKind::Vlan => json_lines::<VlanConfig>(&args)?,
+        FragmentKind::FirewallRule => json_lines::<FirewallRule>(&args)?,
+        FragmentKind::DhcpScope => json_lines::<DhcpServerConfig>(&args)?,
+    };
+    match &global.output {
+        Some(path) => fs::write(path, lines)
+            .with_context(|| format!("Failed to write fragments to {}", path.display()))?,
+        None => print!("{lines}"),
+    }
+    Ok(())
+}
+
+/// One JSON object per line for the requested indexes
+fn json_lines<T: Arbitrary + Serialize>(args: &FuzzSampleArgs) -> Result<String> {
+    let mut lines = String::new();
+    for index in (args.start..).take(args.count as usize) {
+        let fragment = T::nth_from_seed(args.seed, index)?;
+        lines.push_str(&serde_json::to_string(&fragment)?);
+        lines.push('\n');
+    }
+    Ok(lines)
+}
+
+fn roundtrip(args: FuzzRoundtripArgs, global: &GlobalArgs) -> Result<()> {
+    if !global.quiet {
+        println!(
+            "{}",
+            theme::paint(Role::Title, "🔁 OPNsense Config Faker - Round-trip Fuzzing")
+        );
+        println!();
+    }
+
+    let report = run_roundtrip(args.iterations, args.seed, args.max_vlans);
+
+    if !report.failures.is_empty() {
+        if !global.quiet {
+            for case in report.failures.iter().take(SHOWN_FAILURES) {
+                println!(
+                    "{} case {} ({} VLANs)",
+                    theme::paint(Role::Error, "❌"),
+                    case.iteration,
+                    case.vlans.len()
+                );
+                for mismatch in &case.mismatches {
+                    println!("  [{}] {}", mismatch.check, mismatch.field);
+                    println!(
+                        "    {} {:?}",
+                        theme::paint(Role::Removed, "-"),
+                        mismatch.expected
+                    );
+                    println!(
+                        "    {} {:?}",
+                        theme::paint(Role::Added, "+"),
+                        mismatch.actual
+                    );
+                }
+            }
+            if report.failures.len() > SHOWN_FAILURES {
+                println!(
+                    "  … and {} more cases",
+                    report.failures.len() - SHOWN_FAILURES
+                );
+            }
+            println!();
+        }
+        return Err(ConfigError::validation(format!(
+            "{} of {} cases did not round-trip; rerun with --seed {} --iterations {}",
+            report.failures.len(),
+            report.iterations,
+            report.root_seed,
+            report.failures[0].iteration + 1
+        ))
+        .into());
+    }
+
+    if !global.quiet {
+        println!(
+            "{} {} cases round-tripped unchanged (seed {})",
+            theme::paint(Role::Success, "✅"),
+            report.iterations,
+            theme::paint(Role::Accent, report.root_seed)
+        );
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_roundtrip_passes_for_seeded_run() {
+        let args = FuzzArgs {
+            command: FuzzCommand::Roundtrip(FuzzRoundtripArgs {
+                iterations: 20,
+                seed: Some(42),
+                max_vlans: 8,
+            }),
+        };
+        let global = GlobalArgs {
+            quiet: true,
+            ..GlobalArgs::default()
+        };
+        execute(args, &global).unwrap();
+    }
+
+    #[test]
+    fn test_sample_windows_are_stable() {
+        let args = |start, count| FuzzSampleArgs {
+            kind: FragmentKind::FirewallRule,
+            seed: 11,
+            count,
+            start,
+        };
+        let all = json_lines::<FirewallRule>(&args(0, 4)).unwrap();
+        let tail = json_lines::<FirewallRule>(&args(2, 2)).unwrap();
+        assert_eq!(all.lines().count(), 4);
+        assert!(all.ends_with(&tail));
+        let rule: FirewallRule = serde_json::from_str(all.lines().next().unwrap()).unwrap();
+        assert_eq!(rule, FirewallRule::from_seed(11).unwrap());
+    }
+}
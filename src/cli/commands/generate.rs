@@ -1,14 +1,42 @@
 //! Generate command implementation - unified CSV and XML generation
 
+use crate::cli::i18n::{Msg, tr, trf};
+use crate::cli::input::read_config;
+use crate::cli::progress;
+use crate::cli::theme::{self, Role, Theme};
+use crate::cli::wizard::{DEFAULT_SESSION_FILE, WizardSession, scenario_from_args};
 use crate::cli::{GenerateArgs, GlobalArgs, OutputFormat};
-use crate::generator::vlan::generate_vlan_configurations;
-use crate::generator::{FirewallComplexity, generate_firewall_rules};
-use crate::io::csv::{read_csv, write_csv, write_firewall_rules_csv};
+use crate::generator::compat::{self, CompatReport, Outcome};
+use crate::generator::vlan::{VlanConfig, address_space_usage, generate_vlan_configurations};
+use crate::generator::{
+    DepartmentPlan, DepartmentUser, DescriptionStyler, DeviceRegistry, FirewallComplexity,
+    FirewallRule, HaNode, HeadcountModel, HostDensity, LabelSelector, LabelSet, LinkLayer, Section,
+    SectionBudgets, SubnetPopulation, Target, Truncation, VlanInterface, VlanType, VpnGenerator,
+    VpnType, assign_interface_profiles, assign_labels, build_lldp_inventory, generate_accounting,
+    generate_dns_overrides, generate_firewall_rules, generate_nested_aliases,
+    generate_threat_feeds, generate_users, generate_vpn_configurations_with, headcount_rules,
+    plan_carp_vips, plan_departments, populate_by_headcount, populate_subnets, render_carp_log,
+    render_carp_vips, render_dns_overrides, render_feed_aliases, render_lldp_neighbors,
+    render_nested_aliases, render_users, simulate_failovers,
+};
+use crate::io::backup::encrypt_config;
+use crate::io::csv::{
+    read_csv, write_accounting_csv, write_csv, write_firewall_rules_csv, write_host_population_csv,
+    write_interface_profiles_csv, write_port_mappings_csv,
+};
+use crate::io::encode::{Dataset, EncoderRegistry};
+use crate::io::previous::load_previous_configs;
+use crate::model::options::PrefixStrategy;
+use crate::model::scenario::ScenarioFormat;
+use crate::simulate::answer_key::AnswerKey;
+use crate::validate::policy::Policy;
+use crate::xml::defaults::PARENT_INTERFACE;
 use crate::xml::template::XmlTemplate;
+use crate::xml::{add_link_layer, config_from_default};
 use anyhow::{Context, Result};
-use console::{Term, style};
-use indicatif::{ProgressBar, ProgressStyle};
-use std::env;
+use console::Term;
+use indicatif::ProgressBar;
+use std::collections::HashSet;
 use std::fs;
 use std::io::{self, Write};
 use std::path::{Path, PathBuf};
@@ -19,6 +47,9 @@ pub fn execute_with_global(mut args: GenerateArgs, global: &GlobalArgs) -> Resul
     if global.no_color {
         args.no_color = true;
     }
+    if args.no_color {
+        theme::init(global.theme, true);
+    }
 
     // Apply global output if specified and not overridden
     if let Some(ref global_output) = global.output {
@@ -41,6 +72,12 @@ pub fn execute(args: GenerateArgs) -> Result<()> {
         quiet: false,
         no_color: args.no_color,
         output: None,
+        keep_temp: false,
+        theme: Theme::default(),
+        lang: None,
+        progress: None,
+        strict_flags: false,
+        recover: false,
     };
 
     execute_with_global(args, &global)
@@ -52,20 +89,24 @@ fn execute_internal(args: GenerateArgs, global: &GlobalArgs) -> Result<()> {
     if !global.quiet {
         println!(
             "{}",
-            style("🔧 OPNsense Config Faker - Configuration Generator")
-                .bold()
-                .blue()
+            theme::paint(
+                Role::Title,
+                "🔧 OPNsense Config Faker - Configuration Generator"
+            )
         );
         println!();
     }
 
     // Handle interactive mode if requested
-    let args = if args.interactive {
-        handle_interactive_mode(args)?
+    let (mut args, session) = if args.interactive {
+        let (args, session) = handle_interactive_mode(args)?;
+        (args, Some(session))
     } else {
-        args
+        (args, None)
     };
 
+    let policy = load_policy(&mut args, global)?;
+
     // Validate arguments based on format
     validate_arguments(&args)?;
 
@@ -74,54 +115,126 @@ fn execute_internal(args: GenerateArgs, global: &GlobalArgs) -> Result<()> {
         return Err(crate::model::ConfigError::invalid_parameter("count", &e).into());
     }
 
+    // Check remaining option combinations through the library validation layer
+    args.to_options().validate()?;
+
+    let compat = resolve_target(&args, global)?;
+
     // Execute based on format
     match args.format {
-        OutputFormat::Csv => execute_csv_generation(&args, global),
-        OutputFormat::Xml => execute_xml_generation(&args, global),
+        OutputFormat::Csv => {
+            execute_csv_generation(&args, compat.as_ref(), policy.as_ref(), global)?
+        }
+        OutputFormat::Xml => execute_xml_generation(&args, policy.as_ref(), global)?,
     }
+
+    // The wizard's answers are only kept until a run completes
+    if let Some(session) = session {
+        session.finish()?;
+    }
+    Ok(())
 }
 
 /// Handle interactive mode prompts for missing required arguments
-fn handle_interactive_mode(mut args: GenerateArgs) -> Result<GenerateArgs> {
+///
+/// Answers are saved to the session file as they are given, so an
+/// interrupted wizard can be resumed.
+fn handle_interactive_mode(mut args: GenerateArgs) -> Result<(GenerateArgs, WizardSession)> {
     let term = Term::stdout();
+    let format = match args.format {
+        OutputFormat::Csv => ScenarioFormat::Csv,
+        OutputFormat::Xml => ScenarioFormat::Xml,
+    };
+    let session_path = args
+        .session
+        .clone()
+        .unwrap_or_else(|| PathBuf::from(DEFAULT_SESSION_FILE));
+    let mut session = WizardSession::open(&session_path, format)
+        .with_context(|| format!("Failed to open wizard session {:?}", session_path))?;
+
+    if session.is_resumed() {
+        print!(
+            "{}",
+            trf(Msg::WizardResume, &[("path", &session.path().display())])
+        );
+        io::stdout().flush()?;
+        if term.read_line()?.trim().eq_ignore_ascii_case("n") {
+            session.reset();
+        }
+    }
 
     match args.format {
         OutputFormat::Csv => {
             if args.output.is_none() {
-                println!("📝 CSV output file not specified.");
-                print!("Enter output filename (default: vlan_configs.csv): ");
-                io::stdout().flush()?;
-                let input = term.read_line()?;
-                args.output = Some(if input.trim().is_empty() {
-                    PathBuf::from("vlan_configs.csv")
-                } else {
-                    PathBuf::from(input.trim())
-                });
+                if session.answers.output.is_none() {
+                    println!("{}", tr(Msg::WizardOutputMissing));
+                    print!("{}", tr(Msg::WizardOutputPrompt));
+                    io::stdout().flush()?;
+                    let input = term.read_line()?;
+                    session.answers.output = Some(if input.trim().is_empty() {
+                        PathBuf::from("vlan_configs.csv")
+                    } else {
+                        PathBuf::from(input.trim())
+                    });
+                    session.save()?;
+                }
+                args.output = session.answers.output.clone();
             }
         }
         OutputFormat::Xml => {
-            if args.base_config.is_none() {
-                println!("📄 Base configuration file required for XML generation.");
-                print!("Enter base config file path: ");
-                io::stdout().flush()?;
-                let input = term.read_line()?;
-                if !input.trim().is_empty() {
-                    args.base_config = Some(PathBuf::from(input.trim()));
+            if args.base_config.is_none() && !args.from_default {
+                if session.answers.base_config.is_none() {
+                    println!("{}", tr(Msg::WizardBaseConfigMissing));
+                    print!("{}", tr(Msg::WizardBaseConfigPrompt));
+                    io::stdout().flush()?;
+                    let input = term.read_line()?;
+                    if !input.trim().is_empty() {
+                        session.answers.base_config = Some(PathBuf::from(input.trim()));
+                        session.save()?;
+                    }
                 }
+                args.base_config = session.answers.base_config.clone();
             }
 
             if args.csv_file.is_none() && args.count == 10 {
-                print!("Enter number of configurations to generate (default: 10): ");
-                io::stdout().flush()?;
-                let input = term.read_line()?;
-                if let Ok(count) = input.trim().parse::<u16>() {
+                if session.answers.count.is_none() {
+                    print!("{}", tr(Msg::WizardCountPrompt));
+                    io::stdout().flush()?;
+                    let input = term.read_line()?;
+                    session.answers.count = Some(input.trim().parse::<u16>().unwrap_or(10));
+                    session.save()?;
+                }
+                if let Some(count) = session.answers.count {
                     args.count = count;
                 }
             }
         }
     }
 
-    Ok(args)
+    if let Some(path) = &args.export_scenario {
+        // Scenarios are always seeded; pick one now so this run matches it
+        if args.seed.is_none() {
+            if session.answers.seed.is_none() {
+                session.answers.seed = Some(rand::random());
+                session.save()?;
+            }
+            args.seed = session.answers.seed;
+        }
+        let name = path
+            .file_stem()
+            .and_then(|s| s.to_str())
+            .unwrap_or("wizard")
+            .to_string();
+        let scenario = scenario_from_args(&args, &name)?;
+        fs::write(path, serde_json::to_string_pretty(&scenario)? + "\n")
+            .with_context(|| format!("Failed to write scenario to {:?}", path))?;
+        println!(
+            "{}",
+            trf(Msg::WizardScenarioWritten, &[("path", &path.display())])
+        );
+    }
+
+    Ok((args, session))
 }
 
 /// Validate arguments based on the selected format
@@ -138,11 +251,11 @@ fn validate_arguments(args: &GenerateArgs) -> Result<()> {
             }
         }
         OutputFormat::Xml => {
-            // XML format requires base config
-            if args.base_config.is_none() {
+            // XML format requires base config unless starting from the factory default
+            if args.base_config.is_none() && !args.from_default {
                 return Err(crate::model::ConfigError::invalid_parameter(
                     "base-config",
-                    "Base configuration file is required for XML format. Use --base-config or -b to specify."
+                    "Base configuration file is required for XML format. Use --base-config or -b to specify, or --from-default."
                 ).into());
             }
 
@@ -160,8 +273,142 @@ fn validate_arguments(args: &GenerateArgs) -> Result<()> {
     Ok(())
 }
 
+/// Load the --policy file and take VLAN IDs from its allowed ranges
+///
+/// An explicit --vlan-range or --csv-file is kept and checked like any other
+/// output.
+fn load_policy(args: &mut GenerateArgs, global: &GlobalArgs) -> Result<Option<Policy>> {
+    let Some(path) = &args.policy else {
+        return Ok(None);
+    };
+    let policy = Policy::load(path).with_context(|| format!("Failed to load policy {:?}", path))?;
+
+    if args.vlan_range.is_none()
+        && args.csv_file.is_none()
+        && let Some(range) = policy.vlan_range_for(args.count)?
+    {
+        if !global.quiet {
+            println!("📏 Policy '{}': VLAN IDs {range}", policy.name());
+        }
+        args.vlan_range = Some(range);
+    }
+    Ok(Some(policy))
+}
+
+/// Move VLAN networks into the policy's allowed prefixes
+fn conform_networks(policy: Option<&Policy>, configs: Vec<VlanConfig>) -> Result<Vec<VlanConfig>> {
+    match policy {
+        Some(policy) => Ok(policy.conform_networks(configs)?),
+        None => Ok(configs),
+    }
+}
+
+/// Drop pass rules naming ports the policy forbids
+fn conform_rules(policy: Option<&Policy>, rules: &mut Vec<FirewallRule>, quiet: bool) {
+    if let Some(policy) = policy {
+        let dropped = policy.conform_rules(rules);
+        if dropped > 0 && !quiet {
+            println!(
+                "📏 Policy '{}': dropped {dropped} rules passing forbidden ports",
+                policy.name()
+            );
+        }
+    }
+}
+
+/// Fail when output about to be written still violates the policy
+fn enforce_policy(
+    policy: Option<&Policy>,
+    vlans: &[VlanConfig],
+    rules: &[FirewallRule],
+) -> Result<()> {
+    let Some(policy) = policy else {
+        return Ok(());
+    };
+    let mut violations = policy.check_vlans(vlans);
+    violations.extend(policy.check_rules(rules));
+    if violations.is_empty() {
+        return Ok(());
+    }
+
+    let mut message = format!(
+        "Generated output violates policy '{}' ({} violations):",
+        policy.name(),
+        violations.len()
+    );
+    for violation in violations.iter().take(10) {
+        message.push_str(&format!("\n  {violation}"));
+    }
+    if violations.len() > 10 {
+        message.push_str(&format!("\n  … {} more", violations.len() - 10));
+    }
+    Err(crate::model::ConfigError::validation(message).into())
+}
+
+/// Release-dependent sections a run generates, checked against a targeted release
+///
+/// VPN tunnels are only generated by the CSV path; XML output holds no
+/// release-dependent sections.
+fn requested_sections(args: &GenerateArgs) -> Vec<Section> {
+    let mut sections = Vec::new();
+    if args.vpn_count.is_some() && matches!(args.format, OutputFormat::Csv) {
+        sections.push(Section::WireGuard);
+    }
+    sections
+}
+
+/// Apply --on-unsupported for the --opnsense-version target and report each section
+fn resolve_target(args: &GenerateArgs, global: &GlobalArgs) -> Result<Option<CompatReport>> {
+    let Some(version) = &args.opnsense_version else {
+        return Ok(None);
+    };
+    let target = Target::parse(version, args.flavor)?;
+    let report = compat::resolve(target, &requested_sections(args), args.on_unsupported)?;
+    if !global.quiet {
+        println!("{}", render_compat(&report));
+    }
+    Ok(Some(report))
+}
+
+/// Colorized listing of every requested section and its outcome
+fn render_compat(report: &CompatReport) -> String {
+    let mut out = format!(
+        "{}\n",
+        theme::paint(Role::Heading, format!("Target: {}", report.target))
+    );
+    if report.sections.is_empty() {
+        out.push_str("  no release-dependent sections requested\n");
+    }
+    for entry in &report.sections {
+        let since = entry.section.since(report.target.flavor);
+        let line = match entry.outcome {
+            Outcome::Supported => {
+                theme::paint(Role::Success, format!("  {:<20} supported", entry.section))
+            }
+            Outcome::Skipped => theme::paint(
+                Role::Warning,
+                format!("  {:<20} skipped (requires {since})", entry.section),
+            ),
+            Outcome::Downgraded(to) => theme::paint(
+                Role::Warning,
+                format!(
+                    "  {:<20} downgraded to {to} (requires {since})",
+                    entry.section
+                ),
+            ),
+        };
+        out.push_str(&format!("{line}\n"));
+    }
+    out
+}
+
 /// Execute CSV generation
-fn execute_csv_generation(args: &GenerateArgs, global: &GlobalArgs) -> Result<()> {
+fn execute_csv_generation(
+    args: &GenerateArgs,
+    compat: Option<&CompatReport>,
+    policy: Option<&Policy>,
+    global: &GlobalArgs,
+) -> Result<()> {
     let output_file = args.output.as_ref().unwrap(); // Validated in validate_arguments
 
     if !global.quiet {
@@ -177,6 +424,8 @@ fn execute_csv_generation(args: &GenerateArgs, global: &GlobalArgs) -> Result<()
         .into());
     }
 
+    let previous = load_minimize_diff_baseline(args, global)?;
+
     // Generate VLAN configurations based on range or count
     let (configs, pb) = if let Some(ref vlan_range_str) = args.vlan_range {
         // Parse VLAN ranges
@@ -203,11 +452,21 @@ fn execute_csv_generation(args: &GenerateArgs, global: &GlobalArgs) -> Result<()
         );
 
         // Generate from ranges
-        let configs = if args.wan_assignments.is_some() {
+        let configs = if let Some(ref previous) = previous {
+            crate::generator::vlan::generate_vlan_configurations_from_ranges_minimizing_diff(
+                previous,
+                &vlan_ranges,
+                args.seed,
+                args.wan_assignments.as_ref(),
+                args.prefix_strategy,
+                Some(&pb),
+            )
+        } else if args.wan_assignments.is_some() || args.prefix_strategy != PrefixStrategy::ClassA {
             crate::generator::vlan::generate_vlan_configurations_from_ranges_with_wan(
                 &vlan_ranges,
                 args.seed,
                 args.wan_assignments.as_ref(),
+                args.prefix_strategy,
                 Some(&pb),
             )
         } else {
@@ -234,11 +493,21 @@ fn execute_csv_generation(args: &GenerateArgs, global: &GlobalArgs) -> Result<()
         );
 
         // Generate VLAN configurations by count
-        let configs = if args.wan_assignments.is_some() {
+        let configs = if let Some(ref previous) = previous {
+            crate::generator::vlan::generate_vlan_configurations_minimizing_diff(
+                previous,
+                args.count,
+                args.seed,
+                args.wan_assignments.as_ref(),
+                args.prefix_strategy,
+                Some(&pb),
+            )
+        } else if args.wan_assignments.is_some() || args.prefix_strategy != PrefixStrategy::ClassA {
             crate::generator::vlan::generate_vlan_configurations_with_wan(
                 args.count,
                 args.seed,
                 args.wan_assignments.as_ref(),
+                args.prefix_strategy,
                 Some(&pb),
             )
         } else {
@@ -248,21 +517,129 @@ fn execute_csv_generation(args: &GenerateArgs, global: &GlobalArgs) -> Result<()
 
         (configs, pb)
     };
+    let configs = conform_networks(policy, configs)?;
 
     pb.set_message("Writing CSV file...");
 
+    // Styling applies to written output; later stages read departments from
+    // the standard descriptions
+    let mut styler = DescriptionStyler::new(args.description_style, args.seed);
+
+    // Labels are assigned over the full dataset so a filtered run emits
+    // exactly the matching objects of an unfiltered one
+    let labeling = Labeling::new(args, &configs);
+    let plans = headcount_plans(args, &configs)?;
+
     // Write to CSV file
-    write_csv(&configs, output_file)
+    let written_vlans = labeling.vlans(&styler.style_vlans(&configs));
+    enforce_policy(policy, &written_vlans, &[])?;
+    write_csv(&written_vlans, output_file)
         .with_context(|| format!("Failed to write CSV to {:?}", output_file))?;
 
+    let selected = labeling.select(&configs);
     pb.finish_with_message(format!(
         "✅ Generated {} VLAN configurations in '{}'",
-        configs.len(),
+        selected.len(),
         output_file.display()
     ));
 
     if !global.quiet {
-        print_csv_summary(&configs, output_file);
+        print_csv_summary(&selected, output_file);
+    }
+
+    if let Some(ref labels) = labeling.labels {
+        let labels_output = companion_path(output_file, "labels")?.with_extension("json");
+        write_labels(
+            &labeling,
+            labels,
+            configs.len(),
+            &labels_output,
+            global.quiet,
+        )?;
+    }
+
+    let mut written_hosts = Vec::new();
+    if let Some(populations) = host_populations(args, &configs, plans.as_deref())? {
+        let hosts_output = companion_path(output_file, "hosts")?;
+        let populations = write_host_population(
+            populations,
+            &labeling,
+            &args.budgets(),
+            &hosts_output,
+            global.quiet,
+        )?;
+        if args.device_fingerprints {
+            let devices_output = companion_path(output_file, "devices")?.with_extension("json");
+            let leases_output = companion_path(output_file, "dhcpd")?.with_extension("leases");
+            write_device_registry(
+                &configs,
+                &populations,
+                args.seed,
+                &devices_output,
+                &leases_output,
+                global.quiet,
+            )?;
+        }
+        written_hosts = populations;
+    }
+
+    if let Some(ref plans) = plans {
+        let users_output = companion_path(output_file, "users")?.with_extension("xml");
+        let users = write_users(plans, args.seed, &labeling, &users_output, global.quiet)?;
+        if let Some(days) = args.radius_accounting {
+            let accounting_output = companion_path(output_file, "accounting")?;
+            write_accounting(
+                args,
+                days,
+                &configs,
+                &users,
+                &accounting_output,
+                global.quiet,
+            )?;
+        }
+    }
+
+    if args.interface_realism {
+        let interfaces = labeling.interfaces(&assign_interface_profiles(&configs, args.seed));
+        let interfaces_output = companion_path(output_file, "interfaces")?;
+        write_interface_profiles(&interfaces, &interfaces_output, global.quiet)?;
+    }
+
+    let mut feed_aliases = 0;
+    if let Some(count) = args.threat_feeds {
+        let feed_dir = companion_path(output_file, "feeds")?.with_extension("");
+        let aliases_output = companion_path(output_file, "feed_aliases")?.with_extension("xml");
+        feed_aliases = write_threat_feeds(args, count, &feed_dir, &aliases_output, global.quiet)?;
+    }
+    if let Some(depth) = args.alias_depth {
+        let aliases_output = companion_path(output_file, "nested_aliases")?.with_extension("xml");
+        write_nested_aliases(
+            args,
+            depth,
+            &written_vlans,
+            feed_aliases,
+            &aliases_output,
+            global.quiet,
+        )?;
+    }
+    if let Some(incidents) = args.carp_events {
+        let carp_output = companion_path(output_file, "carp")?.with_extension("");
+        write_carp_events(args, incidents, &written_vlans, &carp_output, global.quiet)?;
+    }
+    if let Some(count) = args.dns_overrides {
+        let unbound_output = companion_path(output_file, "unbound")?.with_extension("xml");
+        write_dns_overrides(
+            args,
+            count,
+            &written_vlans,
+            &written_hosts,
+            &unbound_output,
+            global.quiet,
+        )?;
+    }
+    if args.lldp_inventory {
+        let lldp_output = companion_path(output_file, "lldp")?;
+        write_lldp_inventory(args, &written_vlans, &lldp_output, global.quiet)?;
     }
 
     // Generate VPN configurations if requested
@@ -278,9 +655,17 @@ fn execute_csv_generation(args: &GenerateArgs, global: &GlobalArgs) -> Result<()
             global.quiet,
         );
 
-        let vpn_configs =
-            crate::generator::vpn::generate_vpn_configurations(vpn_count, args.seed, Some(&vpn_pb))
-                .with_context(|| format!("Failed to generate {} VPN configurations", vpn_count))?;
+        // Tunnels the targeted release lacks are replaced or dropped
+        let wireguard = compat.and_then(|c| c.outcome(Section::WireGuard));
+        let mut generator = VpnGenerator::new_with_seed(args.seed);
+        if let Some(Outcome::Downgraded(_)) = wireguard {
+            generator = generator.with_substitution(VpnType::WireGuard, VpnType::OpenVPN);
+        }
+        let mut vpn_configs = generate_vpn_configurations_with(generator, vpn_count, Some(&vpn_pb))
+            .with_context(|| format!("Failed to generate {} VPN configurations", vpn_count))?;
+        if wireguard == Some(Outcome::Skipped) {
+            vpn_configs.retain(|config| config.vpn_type != VpnType::WireGuard);
+        }
 
         vpn_pb.finish_with_message(format!(
             "✅ Generated {} VPN configurations",
@@ -322,6 +707,7 @@ fn execute_csv_generation(args: &GenerateArgs, global: &GlobalArgs) -> Result<()
     }
 
     // Generate firewall rules if requested
+    let mut written_rules = Vec::new();
     if args.include_firewall_rules {
         if !global.quiet {
             println!();
@@ -340,14 +726,21 @@ fn execute_csv_generation(args: &GenerateArgs, global: &GlobalArgs) -> Result<()
             "Generating firewall rules...",
             global.quiet,
         );
-        let firewall_rules = generate_firewall_rules(
+        let mut firewall_rules = generate_firewall_rules(
             &configs,
             complexity,
             args.seed,
             Some(&firewall_pb),
             args.firewall_rules_per_vlan,
         )?;
+        if let Some(ref plans) = plans {
+            let staff_rules = headcount_rules(&configs, plans, &firewall_rules)?;
+            firewall_rules.extend(staff_rules);
+        }
+        conform_rules(policy, &mut firewall_rules, global.quiet);
 
+        let mut firewall_rules = labeling.select_rules(&firewall_rules);
+        warn_truncation(args.budgets().truncate_rules(&mut firewall_rules));
         firewall_pb.finish_with_message(format!(
             "✅ Generated {} firewall rules",
             firewall_rules.len()
@@ -365,7 +758,9 @@ fn execute_csv_generation(args: &GenerateArgs, global: &GlobalArgs) -> Result<()
             })?;
         let firewall_output = output_file.with_file_name(format!("{stem}_firewall_rules.csv"));
 
-        write_firewall_rules_csv(&firewall_rules, &firewall_output)
+        written_rules = labeling.rules(&styler.style_rules(&firewall_rules));
+        enforce_policy(policy, &[], &written_rules)?;
+        write_firewall_rules_csv(&written_rules, &firewall_output)
             .with_context(|| format!("Failed to write firewall rules to {:?}", firewall_output))?;
 
         if !global.quiet {
@@ -377,13 +772,34 @@ fn execute_csv_generation(args: &GenerateArgs, global: &GlobalArgs) -> Result<()
         }
     }
 
+    if args.answer_key {
+        let answer_key_output = companion_path(output_file, "answer_key")?.with_extension("json");
+        write_answer_key(
+            &written_vlans,
+            &written_rules,
+            args.seed,
+            &answer_key_output,
+            global.quiet,
+        )?;
+    }
+
+    if !args.encode.is_empty() {
+        let dataset = Dataset {
+            vlans: written_vlans,
+            firewall_rules: written_rules,
+        };
+        write_encoded_datasets(&args.encode, &dataset, output_file, global.quiet)?;
+    }
+
     Ok(())
 }
 
 /// Execute XML generation
-fn execute_xml_generation(args: &GenerateArgs, global: &GlobalArgs) -> Result<()> {
-    let base_config = args.base_config.as_ref().unwrap(); // Validated in validate_arguments
-
+fn execute_xml_generation(
+    args: &GenerateArgs,
+    policy: Option<&Policy>,
+    global: &GlobalArgs,
+) -> Result<()> {
     if !global.quiet {
         println!("🔧 Generating OPNsense XML configuration...");
     }
@@ -393,6 +809,8 @@ fn execute_xml_generation(args: &GenerateArgs, global: &GlobalArgs) -> Result<()
         fs::create_dir_all(&args.output_dir)?;
     }
 
+    let previous = load_minimize_diff_baseline(args, global)?;
+
     // Generate or load VLAN configurations
     let configs = if let Some(csv_file) = &args.csv_file {
         if !global.quiet {
@@ -422,11 +840,21 @@ fn execute_xml_generation(args: &GenerateArgs, global: &GlobalArgs) -> Result<()
             global.quiet,
         );
 
-        let configs = if args.wan_assignments.is_some() {
+        let configs = if let Some(ref previous) = previous {
+            crate::generator::vlan::generate_vlan_configurations_from_ranges_minimizing_diff(
+                previous,
+                &vlan_ranges,
+                args.seed,
+                args.wan_assignments.as_ref(),
+                args.prefix_strategy,
+                Some(&pb),
+            )
+        } else if args.wan_assignments.is_some() || args.prefix_strategy != PrefixStrategy::ClassA {
             crate::generator::vlan::generate_vlan_configurations_from_ranges_with_wan(
                 &vlan_ranges,
                 args.seed,
                 args.wan_assignments.as_ref(),
+                args.prefix_strategy,
                 Some(&pb),
             )
         } else {
@@ -456,11 +884,21 @@ fn execute_xml_generation(args: &GenerateArgs, global: &GlobalArgs) -> Result<()
             global.quiet,
         );
 
-        let configs = if args.wan_assignments.is_some() {
+        let configs = if let Some(ref previous) = previous {
+            crate::generator::vlan::generate_vlan_configurations_minimizing_diff(
+                previous,
+                args.count,
+                args.seed,
+                args.wan_assignments.as_ref(),
+                args.prefix_strategy,
+                Some(&pb),
+            )
+        } else if args.wan_assignments.is_some() || args.prefix_strategy != PrefixStrategy::ClassA {
             crate::generator::vlan::generate_vlan_configurations_with_wan(
                 args.count,
                 args.seed,
                 args.wan_assignments.as_ref(),
+                args.prefix_strategy,
                 Some(&pb),
             )
         } else {
@@ -472,11 +910,23 @@ fn execute_xml_generation(args: &GenerateArgs, global: &GlobalArgs) -> Result<()
         configs
     };
 
+    let configs = conform_networks(policy, configs)?;
+
     if !global.quiet {
         println!("📝 Processing {} configurations...", configs.len());
     }
 
+    // Styling applies to written output; firewall rules read departments
+    // from the standard descriptions
+    let mut styler = DescriptionStyler::new(args.description_style, args.seed);
+
+    // Labels are assigned over the full dataset so a filtered run emits
+    // exactly the matching objects of an unfiltered one
+    let labeling = Labeling::new(args, &configs);
+    let plans = headcount_plans(args, &configs)?;
+
     // Generate firewall rules if requested
+    let mut written_rules = Vec::new();
     let firewall_rules = if args.include_firewall_rules {
         if !global.quiet {
             println!("🔥 Generating firewall rules...");
@@ -494,21 +944,30 @@ fn execute_xml_generation(args: &GenerateArgs, global: &GlobalArgs) -> Result<()
             "Generating firewall rules...",
             global.quiet,
         );
-        let rules = generate_firewall_rules(
+        let mut rules = generate_firewall_rules(
             &configs,
             complexity,
             args.seed,
             Some(&firewall_pb),
             args.firewall_rules_per_vlan,
         )?;
+        if let Some(ref plans) = plans {
+            let staff_rules = headcount_rules(&configs, plans, &rules)?;
+            rules.extend(staff_rules);
+        }
+        conform_rules(policy, &mut rules, global.quiet);
 
+        let mut rules = labeling.select_rules(&rules);
+        warn_truncation(args.budgets().truncate_rules(&mut rules));
         firewall_pb.finish_with_message(format!("✅ Generated {} firewall rules", rules.len()));
 
         // Write firewall rules to CSV for reference
         let firewall_csv = args
             .output_dir
             .join(format!("firewall_{}_rules.csv", args.firewall_nr));
-        write_firewall_rules_csv(&rules, &firewall_csv)?;
+        written_rules = labeling.rules(&styler.style_rules(&rules));
+        enforce_policy(policy, &[], &written_rules)?;
+        write_firewall_rules_csv(&written_rules, &firewall_csv)?;
         if !global.quiet {
             println!("📄 Firewall rules CSV: {}", firewall_csv.display());
         }
@@ -518,29 +977,239 @@ fn execute_xml_generation(args: &GenerateArgs, global: &GlobalArgs) -> Result<()
         None
     };
 
+    let interfaces = args
+        .interface_realism
+        .then(|| assign_interface_profiles(&configs, args.seed));
+    let styled = styler.style_vlans(&configs);
+    let selected = labeling.select(&configs);
+    enforce_policy(policy, &labeling.vlans(&styled), &[])?;
+
+    let links = LinkLayer::plan(
+        args.laggs.unwrap_or(0),
+        args.bridges.unwrap_or(0),
+        args.seed,
+    )?;
+
+    match &args.base_config {
+        Some(base_config) => write_template_xml(
+            args,
+            base_config,
+            &styled,
+            &labeling,
+            interfaces.as_deref(),
+            &links,
+            global,
+        )?,
+        None => write_default_xml(
+            args,
+            &labeling.vlans(&styled),
+            interfaces.as_deref(),
+            &links,
+            global,
+        )?,
+    }
+
+    if !global.quiet {
+        print_xml_summary(&selected, &args.output_dir, args.firewall_nr);
+    }
+
+    if let Some(ref labels) = labeling.labels {
+        let labels_output = args
+            .output_dir
+            .join(format!("firewall_{}_labels.json", args.firewall_nr));
+        write_labels(
+            &labeling,
+            labels,
+            configs.len(),
+            &labels_output,
+            global.quiet,
+        )?;
+    }
+
+    let mut written_hosts = Vec::new();
+    if let Some(populations) = host_populations(args, &configs, plans.as_deref())? {
+        let hosts_output = args
+            .output_dir
+            .join(format!("firewall_{}_hosts.csv", args.firewall_nr));
+        let populations = write_host_population(
+            populations,
+            &labeling,
+            &args.budgets(),
+            &hosts_output,
+            global.quiet,
+        )?;
+        if args.device_fingerprints {
+            let devices_output = args
+                .output_dir
+                .join(format!("firewall_{}_devices.json", args.firewall_nr));
+            let leases_output = args
+                .output_dir
+                .join(format!("firewall_{}_dhcpd.leases", args.firewall_nr));
+            write_device_registry(
+                &configs,
+                &populations,
+                args.seed,
+                &devices_output,
+                &leases_output,
+                global.quiet,
+            )?;
+        }
+        written_hosts = populations;
+    }
+
+    if let Some(ref plans) = plans {
+        let users_output = args
+            .output_dir
+            .join(format!("firewall_{}_users.xml", args.firewall_nr));
+        let users = write_users(plans, args.seed, &labeling, &users_output, global.quiet)?;
+        if let Some(days) = args.radius_accounting {
+            let accounting_output = args
+                .output_dir
+                .join(format!("firewall_{}_accounting.csv", args.firewall_nr));
+            write_accounting(
+                args,
+                days,
+                &configs,
+                &users,
+                &accounting_output,
+                global.quiet,
+            )?;
+        }
+    }
+
+    if let Some(ref interfaces) = interfaces {
+        let interfaces_output = args
+            .output_dir
+            .join(format!("firewall_{}_interfaces.csv", args.firewall_nr));
+        write_interface_profiles(
+            &labeling.interfaces(interfaces),
+            &interfaces_output,
+            global.quiet,
+        )?;
+    }
+
+    let mut feed_aliases = 0;
+    if let Some(count) = args.threat_feeds {
+        let feed_dir = args
+            .output_dir
+            .join(format!("firewall_{}_feeds", args.firewall_nr));
+        let aliases_output = args
+            .output_dir
+            .join(format!("firewall_{}_feed_aliases.xml", args.firewall_nr));
+        feed_aliases = write_threat_feeds(args, count, &feed_dir, &aliases_output, global.quiet)?;
+    }
+    if let Some(depth) = args.alias_depth {
+        let aliases_output = args
+            .output_dir
+            .join(format!("firewall_{}_nested_aliases.xml", args.firewall_nr));
+        write_nested_aliases(
+            args,
+            depth,
+            &labeling.vlans(&styled),
+            feed_aliases,
+            &aliases_output,
+            global.quiet,
+        )?;
+    }
+    if let Some(incidents) = args.carp_events {
+        let carp_output = args
+            .output_dir
+            .join(format!("firewall_{}_carp", args.firewall_nr));
+        let vlans = labeling.vlans(&styled);
+        write_carp_events(args, incidents, &vlans, &carp_output, global.quiet)?;
+    }
+    if let Some(count) = args.dns_overrides {
+        let unbound_output = args
+            .output_dir
+            .join(format!("firewall_{}_unbound.xml", args.firewall_nr));
+        let vlans = labeling.vlans(&styled);
+        write_dns_overrides(
+            args,
+            count,
+            &vlans,
+            &written_hosts,
+            &unbound_output,
+            global.quiet,
+        )?;
+    }
+    if args.lldp_inventory {
+        let lldp_output = args
+            .output_dir
+            .join(format!("firewall_{}_lldp.csv", args.firewall_nr));
+        let vlans = labeling.vlans(&styled);
+        write_lldp_inventory(args, &vlans, &lldp_output, global.quiet)?;
+    }
+
+    if args.answer_key {
+        let answer_key_output = args
+            .output_dir
+            .join(format!("firewall_{}_answer_key.json", args.firewall_nr));
+        write_answer_key(
+            &labeling.vlans(&styled),
+            &written_rules,
+            args.seed,
+            &answer_key_output,
+            global.quiet,
+        )?;
+    }
+
+    // Print firewall summary if rules were generated
+    if let Some(ref rules) = firewall_rules {
+        let firewall_csv = args
+            .output_dir
+            .join(format!("firewall_{}_rules.csv", args.firewall_nr));
+        if !global.quiet {
+            print_firewall_summary(rules, &firewall_csv);
+        }
+    }
+
+    Ok(())
+}
+
+/// Write one XML file per selected VLAN from the base configuration template
+fn write_template_xml(
+    args: &GenerateArgs,
+    base_config: &Path,
+    styled: &[VlanConfig],
+    labeling: &Labeling,
+    interfaces: Option<&[VlanInterface]>,
+    links: &LinkLayer,
+    global: &GlobalArgs,
+) -> Result<()> {
     // Load base XML template
-    let base_xml = fs::read_to_string(base_config)
-        .with_context(|| format!("Failed to read base config file: {:?}", base_config))?;
+    let base_xml = read_config(base_config, args.backup_passphrase.as_deref(), global)
+        .with_context(|| format!("Failed to load base config file: {:?}", base_config))?;
     let template = XmlTemplate::new(base_xml)
         .with_context(|| "Failed to create XML template from base configuration")?;
 
     // Set up progress for XML generation
     let pb = create_progress_bar(
-        configs.len() as u64,
+        labeling.select(styled).len() as u64,
         "Generating XML configurations...",
         global.quiet,
     );
 
-    // Generate XML configurations
-    for (index, config) in configs.iter().enumerate() {
+    // Generate XML configurations; OPT numbering follows the full dataset so
+    // filtered VLANs keep their interface names
+    for (index, config) in styled.iter().enumerate() {
+        if !labeling.keeps(Some(config.vlan_id)) {
+            continue;
+        }
+        let config = &labeling.annotate_vlan(config);
         pb.set_message(format!("Processing VLAN {}", config.vlan_id));
 
         // Generate XML for this configuration
-        let output_xml = template.apply_configuration(
-            config,
-            args.firewall_nr,
-            args.opt_counter + index as u16,
-        )?;
+        let opt_counter = args.opt_counter + index as u16;
+        let output_xml = match interfaces {
+            Some(interfaces) => template.apply_configuration_with_interface(
+                config,
+                &interfaces[index].profile,
+                args.firewall_nr,
+                opt_counter,
+            )?,
+            None => template.apply_configuration(config, args.firewall_nr, opt_counter)?,
+        };
+        let output_xml = add_link_layer(&output_xml, links)?;
 
         // Write output file
         let output_file = args.output_dir.join(format!(
@@ -556,67 +1225,129 @@ fn execute_xml_generation(args: &GenerateArgs, global: &GlobalArgs) -> Result<()
             .into());
         }
 
+        // Wrap in the encrypted backup format when a passphrase is given
+        let output_xml = match args.backup_passphrase.as_deref() {
+            Some(passphrase) => encrypt_config(
+                &output_xml,
+                passphrase,
+                args.seed,
+                backup_index(args.firewall_nr, config.vlan_id),
+            )
+            .with_context(|| format!("Failed to encrypt {}", output_file.display()))?,
+            None => output_xml,
+        };
+
         fs::write(&output_file, output_xml)?;
         pb.inc(1);
     }
 
     pb.finish_with_message("✅ XML configurations generated");
+    Ok(())
+}
+
+/// Salt index of an encrypted output file, unique per firewall and VLAN
+///
+/// The single-file output uses VLAN 0, which no VLAN file can have.
+fn backup_index(firewall_nr: u16, vlan_id: u16) -> u64 {
+    (u64::from(firewall_nr) << 16) | u64::from(vlan_id)
+}
+
+/// Write a single XML file: the factory default with the VLANs added
+fn write_default_xml(
+    args: &GenerateArgs,
+    configs: &[VlanConfig],
+    interfaces: Option<&[VlanInterface]>,
+    links: &LinkLayer,
+    global: &GlobalArgs,
+) -> Result<()> {
+    let output_file = args
+        .output_dir
+        .join(format!("firewall_{}.xml", args.firewall_nr));
+    if output_file.exists() && !args.force {
+        return Err(crate::model::ConfigError::config(format!(
+            "Output file '{}' already exists. Use --force to overwrite.",
+            output_file.display()
+        ))
+        .into());
+    }
+
+    let output_xml = config_from_default(configs, args.opt_counter, interfaces)
+        .with_context(|| "Failed to extend the factory default configuration")?;
+    let output_xml = add_link_layer(&output_xml, links)?;
+    let output_xml = match args.backup_passphrase.as_deref() {
+        Some(passphrase) => encrypt_config(
+            &output_xml,
+            passphrase,
+            args.seed,
+            backup_index(args.firewall_nr, 0),
+        )
+        .with_context(|| format!("Failed to encrypt {}", output_file.display()))?,
+        None => output_xml,
+    };
+    fs::write(&output_file, output_xml)?;
 
     if !global.quiet {
-        print_xml_summary(&configs, &args.output_dir, args.firewall_nr);
+        println!(
+            "✅ Factory default extended with {} VLANs: {}",
+            configs.len(),
+            output_file.display()
+        );
     }
+    Ok(())
+}
 
-    // Print firewall summary if rules were generated
-    if let Some(ref rules) = firewall_rules {
-        let firewall_csv = args
-            .output_dir
-            .join(format!("firewall_{}_rules.csv", args.firewall_nr));
-        if !global.quiet {
-            print_firewall_summary(rules, &firewall_csv);
-        }
+/// Load the previous run used by --minimize-diff, if requested
+fn load_minimize_diff_baseline(
+    args: &GenerateArgs,
+    global: &GlobalArgs,
+) -> Result<Option<Vec<crate::generator::vlan::VlanConfig>>> {
+    let Some(previous_path) = args.previous.as_ref().filter(|_| args.minimize_diff) else {
+        return Ok(None);
+    };
+
+    let previous = load_previous_configs(previous_path, args.backup_passphrase.as_deref())
+        .with_context(|| {
+            format!(
+                "Failed to load previous output: {}",
+                previous_path.display()
+            )
+        })?;
+
+    if !global.quiet {
+        println!(
+            "♻️  Minimizing diff against {} ({} previous configurations)",
+            previous_path.display(),
+            previous.len()
+        );
     }
 
-    Ok(())
+    Ok(Some(previous))
 }
 
-/// Create a progress bar with consistent styling
+/// Create a progress bar in the selected progress mode
 fn create_progress_bar(total: u64, message: &str, quiet: bool) -> ProgressBar {
     if quiet {
         return ProgressBar::hidden();
     }
 
-    let pb = ProgressBar::new(total);
-
-    // Check if we should disable progress bar for non-interactive terminals
-    if env::var("NO_COLOR").is_ok() || env::var("TERM").unwrap_or_default() == "dumb" {
-        pb.set_style(ProgressStyle::default_spinner().template("{msg}").unwrap());
-    } else {
-        pb.set_style(
-            ProgressStyle::default_bar()
-                .template(
-                    "{spinner:.green} [{elapsed_precise}] [{bar:40.cyan/blue}] {pos}/{len} {msg}",
-                )
-                .unwrap()
-                .progress_chars("#>-"),
-        );
-    }
-
-    pb.set_message(message.to_string());
-    pb
+    progress::bar(total, message)
 }
 
 /// Print summary for CSV generation
 fn print_csv_summary(configs: &[crate::generator::vlan::VlanConfig], output_file: &Path) {
     println!();
-    println!("{}", style("Summary:").bold());
-    println!("  📊 Configurations: {}", configs.len());
-    println!("  📁 Output file: {}", output_file.display());
+    println!("{}", theme::paint(Role::Heading, tr(Msg::SummaryHeading)));
+    println!(
+        "{}",
+        trf(Msg::SummaryConfigurations, &[("count", &configs.len())])
+    );
+    println!(
+        "{}",
+        trf(Msg::SummaryOutputFile, &[("path", &output_file.display())])
+    );
     if !configs.is_empty() {
-        println!(
-            "  🏷️  VLAN IDs: {} - {}",
-            configs.iter().map(|c| c.vlan_id).min().unwrap_or(0),
-            configs.iter().map(|c| c.vlan_id).max().unwrap_or(0)
-        );
+        print_vlan_id_range(configs);
+        print_address_space_usage(configs);
     }
 }
 
@@ -627,23 +1358,735 @@ fn print_xml_summary(
     firewall_nr: u16,
 ) {
     println!();
-    println!("{}", style("Summary:").bold());
-    println!("  📊 Configurations: {}", configs.len());
-    println!("  📁 Output directory: {}", output_dir.display());
+    println!("{}", theme::paint(Role::Heading, tr(Msg::SummaryHeading)));
+    println!(
+        "{}",
+        trf(Msg::SummaryConfigurations, &[("count", &configs.len())])
+    );
+    println!(
+        "{}",
+        trf(
+            Msg::SummaryOutputDirectory,
+            &[("path", &output_dir.display())]
+        )
+    );
     if !configs.is_empty() {
+        print_vlan_id_range(configs);
+        print_address_space_usage(configs);
+    }
+    println!(
+        "{}",
+        trf(Msg::SummaryFirewallNumber, &[("number", &firewall_nr)])
+    );
+}
+
+fn print_vlan_id_range(configs: &[crate::generator::vlan::VlanConfig]) {
+    let min = configs.iter().map(|c| c.vlan_id).min().unwrap_or(0);
+    let max = configs.iter().map(|c| c.vlan_id).max().unwrap_or(0);
+    println!(
+        "{}",
+        trf(Msg::SummaryVlanIds, &[("min", &min), ("max", &max)])
+    );
+}
+
+/// Print how much of each RFC 1918 class the configurations consume
+fn print_address_space_usage(configs: &[crate::generator::vlan::VlanConfig]) {
+    for usage in address_space_usage(configs).classes_in_use() {
+        println!("  🌐 Address space: {usage}");
+    }
+}
+
+/// Department plans for --headcount, over every generated VLAN
+fn headcount_plans(
+    args: &GenerateArgs,
+    configs: &[VlanConfig],
+) -> Result<Option<Vec<DepartmentPlan>>> {
+    if !args.headcount {
+        return Ok(None);
+    }
+    let model = match &args.headcount_model {
+        Some(path) => HeadcountModel::load(path)
+            .with_context(|| format!("Failed to load headcount model {}", path.display()))?,
+        None => HeadcountModel::default(),
+    };
+    Ok(Some(plan_departments(&model, configs)))
+}
+
+/// Hosts of every VLAN for --host-density or --headcount, if either is set
+fn host_populations(
+    args: &GenerateArgs,
+    configs: &[VlanConfig],
+    plans: Option<&[DepartmentPlan]>,
+) -> Result<Option<Vec<SubnetPopulation>>> {
+    if let Some(percent) = args.host_density {
+        let density = HostDensity::from_percent(percent)?;
+        return Ok(Some(populate_subnets(configs, density, args.seed)?));
+    }
+    Ok(plans
+        .map(|plans| populate_by_headcount(configs, plans, args.seed))
+        .transpose()?)
+}
+
+/// Write the hosts CSV
+///
+/// Subnets are populated for every VLAN and then filtered, so the hosts of a
+/// selected VLAN do not depend on the selection.
+fn write_host_population(
+    populations: Vec<SubnetPopulation>,
+    labeling: &Labeling,
+    budgets: &SectionBudgets,
+    output_file: &Path,
+    quiet: bool,
+) -> Result<Vec<SubnetPopulation>> {
+    let mut populations: Vec<SubnetPopulation> = populations
+        .into_iter()
+        .filter(|p| labeling.keeps(Some(p.vlan_id)))
+        .collect();
+    warn_truncation(budgets.truncate_reservations(&mut populations));
+    write_host_population_csv(&populations, output_file)
+        .with_context(|| format!("Failed to write hosts to {:?}", output_file))?;
+
+    if !quiet {
+        print_host_density_summary(&populations, output_file);
+    }
+    Ok(populations)
+}
+
+/// Write the --carp-events VIPs and logs of both nodes and the timeline
+///
+/// Files are named after `prefix` with `_primary.xml`, `_backup.log`,
+/// `_events.json`, and so on appended.
+fn write_carp_events(
+    args: &GenerateArgs,
+    incidents: u16,
+    vlans: &[VlanConfig],
+    prefix: &Path,
+    quiet: bool,
+) -> Result<()> {
+    let vips = plan_carp_vips(vlans)?;
+    let timeline = simulate_failovers(&vips, incidents, args.seed)?;
+    let cluster = format!("fw{:02}", args.firewall_nr);
+    let output = |suffix: &str| {
+        let mut name = prefix.as_os_str().to_os_string();
+        name.push(format!("_{suffix}"));
+        PathBuf::from(name)
+    };
+
+    let mut written = Vec::new();
+    for node in HaNode::ALL {
+        let vips_output = output(&format!("{}.xml", node.as_str()));
+        fs::write(&vips_output, render_carp_vips(&vips, node, args.seed))
+            .with_context(|| format!("Failed to write CARP VIPs to {:?}", vips_output))?;
+        let log_output = output(&format!("{}.log", node.as_str()));
+        fs::write(&log_output, render_carp_log(&timeline, node, &cluster))
+            .with_context(|| format!("Failed to write CARP log to {:?}", log_output))?;
+        written.extend([vips_output, log_output]);
+    }
+    let events_output = output("events.json");
+    fs::write(
+        &events_output,
+        serde_json::to_string_pretty(&timeline)? + "\n",
+    )
+    .with_context(|| format!("Failed to write CARP events to {:?}", events_output))?;
+
+    if !quiet {
+        let failovers = timeline
+            .incidents
+            .iter()
+            .filter(|incident| incident.node == HaNode::Primary)
+            .count();
+        println!();
+        println!("{}", theme::paint(Role::Heading, "CARP Failover Summary:"));
         println!(
-            "  🏷️  VLAN IDs: {} - {}",
-            configs.iter().map(|c| c.vlan_id).min().unwrap_or(0),
-            configs.iter().map(|c| c.vlan_id).max().unwrap_or(0)
+            "  🔁 Incidents: {} ({failovers} failing over)",
+            timeline.incidents.len()
         );
+        println!(
+            "  📈 State changes: {} on {} VIPs",
+            timeline.events.len(),
+            vips.len()
+        );
+        for path in &written {
+            println!("  📁 {}", path.display());
+        }
+        println!("  📁 Events: {}", events_output.display());
+    }
+    Ok(())
+}
+
+/// Write the --dns-overrides Unbound section and its records as JSON
+fn write_dns_overrides(
+    args: &GenerateArgs,
+    count: u32,
+    vlans: &[VlanConfig],
+    populations: &[SubnetPopulation],
+    unbound_output: &Path,
+    quiet: bool,
+) -> Result<()> {
+    let overrides = generate_dns_overrides(vlans, populations, count, args.seed)?;
+    fs::write(unbound_output, render_dns_overrides(&overrides, args.seed))
+        .with_context(|| format!("Failed to write host overrides to {:?}", unbound_output))?;
+    let json_output = unbound_output.with_extension("json");
+    fs::write(
+        &json_output,
+        serde_json::to_string_pretty(&overrides)? + "\n",
+    )
+    .with_context(|| format!("Failed to write host overrides to {:?}", json_output))?;
+
+    if !quiet {
+        println!();
+        println!("{}", theme::paint(Role::Heading, "DNS Override Summary:"));
+        println!(
+            "  🌐 Host overrides: {} ({} wildcards), {} aliases",
+            overrides.hosts.len(),
+            overrides.wildcards(),
+            overrides.aliases()
+        );
+        println!("  🚫 Names rejected as taken: {}", overrides.collisions);
+        println!("  📁 Unbound section: {}", unbound_output.display());
+        println!("  📁 Records: {}", json_output.display());
+    }
+    Ok(())
+}
+
+/// Write the --lldp-inventory port mappings and neighbor tables
+///
+/// VLANs hang off the factory default's LAN device, as in --from-default
+/// output, and are numbered from --opt-counter.
+fn write_lldp_inventory(
+    args: &GenerateArgs,
+    vlans: &[VlanConfig],
+    lldp_output: &Path,
+    quiet: bool,
+) -> Result<()> {
+    let firewall = format!("fw{:02}", args.firewall_nr);
+    let inventory = build_lldp_inventory(
+        vlans,
+        &firewall,
+        PARENT_INTERFACE,
+        args.opt_counter,
+        args.seed,
+    )?;
+    write_port_mappings_csv(&inventory.mappings, lldp_output)
+        .with_context(|| format!("Failed to write port mappings to {:?}", lldp_output))?;
+    let json_output = lldp_output.with_extension("json");
+    let neighbors = render_lldp_neighbors(&inventory);
+    fs::write(
+        &json_output,
+        serde_json::to_string_pretty(&neighbors)? + "\n",
+    )
+    .with_context(|| format!("Failed to write LLDP neighbors to {:?}", json_output))?;
+
+    if !quiet {
+        println!();
+        println!(
+            "{}",
+            theme::paint(Role::Heading, "Switch Inventory Summary:")
+        );
+        println!(
+            "  🔌 Switches: 1 core, {} access; {} VLAN interfaces mapped",
+            inventory.access.len(),
+            inventory.mappings.len()
+        );
+        println!("  📁 Port mappings: {}", lldp_output.display());
+        println!("  📁 LLDP neighbors: {}", json_output.display());
+    }
+    Ok(())
+}
+
+/// Write the --headcount users and department groups
+///
+/// Users are generated for every VLAN and then filtered, so user IDs do not
+/// depend on the selection.
+fn write_users(
+    plans: &[DepartmentPlan],
+    seed: Option<u64>,
+    labeling: &Labeling,
+    output_file: &Path,
+    quiet: bool,
+) -> Result<Vec<DepartmentUser>> {
+    let users: Vec<DepartmentUser> = generate_users(plans, seed)
+        .into_iter()
+        .filter(|user| labeling.keeps(Some(user.vlan_id)))
+        .collect();
+    fs::write(output_file, render_users(&users))
+        .with_context(|| format!("Failed to write users to {:?}", output_file))?;
+
+    if !quiet {
+        let departments: HashSet<&str> = users.iter().map(|u| u.department.as_str()).collect();
+        let devices: u32 = plans
+            .iter()
+            .filter(|plan| labeling.keeps(Some(plan.vlan_id)))
+            .map(|plan| u32::from(plan.devices))
+            .sum();
+        println!();
+        println!("{}", theme::paint(Role::Heading, "Headcount Summary:"));
+        println!(
+            "  👥 Users: {} in {} departments",
+            users.len(),
+            departments.len()
+        );
+        println!("  🖥️  Planned devices: {devices}");
+        println!("  📁 Users file: {}", output_file.display());
     }
-    println!("  🔧 Firewall number: {firewall_nr}");
+    Ok(users)
+}
+
+/// Write the --radius-accounting history as CSV and JSON
+fn write_accounting(
+    args: &GenerateArgs,
+    days: u16,
+    configs: &[VlanConfig],
+    users: &[DepartmentUser],
+    output_file: &Path,
+    quiet: bool,
+) -> Result<()> {
+    let records = generate_accounting(configs, users, days, args.portal_limits(), args.seed)?;
+    write_accounting_csv(&records, output_file)
+        .with_context(|| format!("Failed to write accounting records to {:?}", output_file))?;
+    let json_output = output_file.with_extension("json");
+    fs::write(&json_output, serde_json::to_string_pretty(&records)? + "\n")
+        .with_context(|| format!("Failed to write accounting records to {:?}", json_output))?;
+
+    if !quiet {
+        let hours: u64 = records
+            .iter()
+            .map(|r| u64::from(r.session_time))
+            .sum::<u64>()
+            / 3600;
+        let octets: u64 = records
+            .iter()
+            .map(|r| r.input_octets + r.output_octets)
+            .sum();
+        println!();
+        println!(
+            "{}",
+            theme::paint(Role::Heading, "RADIUS Accounting Summary:")
+        );
+        println!(
+            "  📶 Sessions: {} over {days} days ({hours} hours online)",
+            records.len()
+        );
+        println!(
+            "  📊 Traffic: {:.1} GiB",
+            octets as f64 / f64::from(1u32 << 30)
+        );
+        println!(
+            "  📁 Output files: {}, {}",
+            output_file.display(),
+            json_output.display()
+        );
+    }
+    Ok(())
+}
+
+/// Write the --device-fingerprints registry and lease file
+fn write_device_registry(
+    configs: &[VlanConfig],
+    populations: &[SubnetPopulation],
+    seed: Option<u64>,
+    devices_output: &Path,
+    leases_output: &Path,
+    quiet: bool,
+) -> Result<()> {
+    let registry = DeviceRegistry::from_populations(configs, populations, seed);
+    let json = serde_json::to_string_pretty(&registry)?;
+    fs::write(devices_output, json + "\n")
+        .with_context(|| format!("Failed to write devices to {:?}", devices_output))?;
+    fs::write(leases_output, registry.render_leases())
+        .with_context(|| format!("Failed to write DHCP leases to {:?}", leases_output))?;
+
+    if !quiet {
+        let leases = registry
+            .devices
+            .iter()
+            .filter(|d| d.lease.is_some())
+            .count();
+        let classes: Vec<String> = registry
+            .class_counts()
+            .into_iter()
+            .filter(|(_, count)| *count > 0)
+            .map(|(class, count)| format!("{class} {count}"))
+            .collect();
+        println!();
+        println!(
+            "{}",
+            theme::paint(Role::Heading, "Device Fingerprint Summary:")
+        );
+        println!(
+            "  🖥️  Devices: {} ({leases} dynamic leases)",
+            registry.devices.len()
+        );
+        println!("  🧬 Classes: {}", classes.join(", "));
+        println!(
+            "  📁 Output files: {}, {}",
+            devices_output.display(),
+            leases_output.display()
+        );
+    }
+    Ok(())
+}
+
+/// Warn about objects dropped to stay within a --max-* budget
+fn warn_truncation(truncation: Option<Truncation>) {
+    if let Some(truncation) = truncation {
+        eprintln!(
+            "{} {truncation}",
+            theme::paint(Role::Warning, "warning[budget]:").for_stderr()
+        );
+    }
+}
+
+/// Print summary for host density population
+fn print_host_density_summary(populations: &[SubnetPopulation], output_file: &Path) {
+    let hosts: usize = populations.iter().map(|p| p.occupied()).sum();
+    let reservations: usize = populations.iter().map(|p| p.reservations.len()).sum();
+    let utilizations: Vec<f64> = populations
+        .iter()
+        .map(|p| p.utilization() * 100.0)
+        .collect();
+
+    println!();
+    println!("{}", theme::paint(Role::Heading, "Host Density Summary:"));
+    println!("  🖥️  Hosts: {hosts} ({reservations} DHCP reservations)");
+    if !utilizations.is_empty() {
+        let min = utilizations.iter().cloned().fold(f64::MAX, f64::min);
+        let max = utilizations.iter().cloned().fold(f64::MIN, f64::max);
+        let mean = utilizations.iter().sum::<f64>() / utilizations.len() as f64;
+        println!("  📈 Subnet utilization: min {min:.1}%, mean {mean:.1}%, max {max:.1}%");
+    }
+    println!("  📁 Output file: {}", output_file.display());
+}
+
+/// Write the --threat-feeds blocklists and the URL-table aliases using them
+///
+/// Returns the number of aliases written.
+fn write_threat_feeds(
+    args: &GenerateArgs,
+    count: u16,
+    feed_dir: &Path,
+    aliases_output: &Path,
+    quiet: bool,
+) -> Result<usize> {
+    let mut feeds = generate_threat_feeds(count, args.seed)?;
+    // Each feed is fetched by one alias
+    warn_truncation(args.budgets().truncate_aliases(&mut feeds));
+    fs::create_dir_all(feed_dir)
+        .with_context(|| format!("Failed to create feed directory {:?}", feed_dir))?;
+    for feed in &feeds {
+        let path = feed_dir.join(feed.file_name());
+        fs::write(&path, feed.render())
+            .with_context(|| format!("Failed to write feed {:?}", path))?;
+    }
+
+    let base_url = match &args.feed_url {
+        Some(url) => url.clone(),
+        None => {
+            let dir = std::path::absolute(feed_dir)
+                .with_context(|| format!("Failed to resolve {:?}", feed_dir))?;
+            format!("file://{}", dir.display().to_string().replace('\\', "/"))
+        }
+    };
+    fs::write(
+        aliases_output,
+        render_feed_aliases(&feeds, &base_url, args.seed),
+    )
+    .with_context(|| format!("Failed to write feed aliases to {:?}", aliases_output))?;
+
+    if !quiet {
+        let entries: usize = feeds.iter().map(|f| f.entries.len()).sum();
+        println!();
+        println!("{}", theme::paint(Role::Heading, "Threat Feed Summary:"));
+        println!("  🛡️  Feeds: {} ({entries} entries)", feeds.len());
+        println!("  🔗 Alias URL base: {base_url}");
+        println!("  📁 Feed directory: {}", feed_dir.display());
+        println!("  📁 Alias file: {}", aliases_output.display());
+    }
+    Ok(feeds.len())
+}
+
+/// Write the --alias-depth hierarchy and its expected flattened content
+///
+/// `feed_aliases` already count against --max-aliases. Aliases are ordered
+/// leaves first, so truncation never leaves a reference dangling.
+fn write_nested_aliases(
+    args: &GenerateArgs,
+    depth: u8,
+    vlans: &[VlanConfig],
+    feed_aliases: usize,
+    aliases_output: &Path,
+    quiet: bool,
+) -> Result<()> {
+    let mut aliases = generate_nested_aliases(vlans, depth, args.seed)?;
+    let budgets = SectionBudgets {
+        max_aliases: args.max_aliases.map(|max| max.saturating_sub(feed_aliases)),
+        ..args.budgets()
+    };
+    warn_truncation(budgets.truncate_aliases(&mut aliases));
+    fs::write(aliases_output, render_nested_aliases(&aliases, args.seed))
+        .with_context(|| format!("Failed to write nested aliases to {:?}", aliases_output))?;
+    let json_output = aliases_output.with_extension("json");
+    fs::write(&json_output, serde_json::to_string_pretty(&aliases)? + "\n")
+        .with_context(|| format!("Failed to write nested aliases to {:?}", json_output))?;
+
+    if !quiet {
+        let deepest = aliases.iter().map(|a| a.level).max().unwrap_or(0);
+        println!();
+        println!("{}", theme::paint(Role::Heading, "Nested Alias Summary:"));
+        println!(
+            "  🗂️  Aliases: {} ({deepest} levels above the VLAN aliases)",
+            aliases.len()
+        );
+        println!("  📁 Alias file: {}", aliases_output.display());
+        println!("  📁 Flattened content: {}", json_output.display());
+    }
+    Ok(())
+}
+
+/// Write the dataset once per --encode encoder
+fn write_encoded_datasets(
+    names: &[String],
+    dataset: &Dataset,
+    output_file: &Path,
+    quiet: bool,
+) -> Result<()> {
+    let registry = EncoderRegistry::default();
+    if !quiet {
+        println!();
+        println!("{}", theme::paint(Role::Heading, "Encoded Datasets:"));
+    }
+    for name in names {
+        let encoder = registry.require(name)?;
+        let path = companion_path(output_file, "dataset")?.with_extension(encoder.extension());
+        let encoded = encoder
+            .encode(dataset)
+            .with_context(|| format!("Failed to encode dataset as {name}"))?;
+        fs::write(&path, &encoded)
+            .with_context(|| format!("Failed to write {name} dataset to {:?}", path))?;
+
+        if !quiet {
+            let note = if encoder.is_experimental() {
+                " (experimental)"
+            } else {
+                ""
+            };
+            println!(
+                "  📦 {name}{note}: {} ({} bytes)",
+                path.display(),
+                encoded.len()
+            );
+        }
+    }
+    Ok(())
+}
+
+/// Path next to a CSV output file with `_{suffix}` appended to its stem
+fn companion_path(output_file: &Path, suffix: &str) -> Result<PathBuf> {
+    let stem = output_file
+        .file_stem()
+        .and_then(|s| s.to_str())
+        .ok_or_else(|| {
+            crate::model::ConfigError::invalid_parameter(
+                "output",
+                "Output file path must have a valid filename",
+            )
+        })?;
+    Ok(output_file.with_file_name(format!("{stem}_{suffix}.csv")))
+}
+
+/// Write the interface profiles CSV for --interface-realism
+fn write_interface_profiles(
+    interfaces: &[VlanInterface],
+    output_file: &Path,
+    quiet: bool,
+) -> Result<()> {
+    write_interface_profiles_csv(interfaces, output_file)
+        .with_context(|| format!("Failed to write interface profiles to {:?}", output_file))?;
+
+    if !quiet {
+        print_interface_summary(interfaces, output_file);
+    }
+    Ok(())
+}
+
+/// Print summary for interface profile assignment
+fn print_interface_summary(interfaces: &[VlanInterface], output_file: &Path) {
+    println!();
+    println!(
+        "{}",
+        theme::paint(Role::Heading, "Interface Profile Summary:")
+    );
+    for vlan_type in VlanType::ALL {
+        let count = interfaces
+            .iter()
+            .filter(|i| i.profile.vlan_type == vlan_type)
+            .count();
+        if count > 0 {
+            let profile = vlan_type.profile();
+            let mss = profile
+                .mss
+                .map(|mss| format!(", MSS {mss}"))
+                .unwrap_or_default();
+            println!(
+                "  🔌 {vlan_type}: {count} (MTU {}{mss}, PCP {})",
+                profile.mtu, profile.pcp
+            );
+        }
+    }
+    println!("  📁 Output file: {}", output_file.display());
+}
+
+/// Labels and label selection for --labels and --filter
+struct Labeling {
+    /// Labels of every generated VLAN, when --labels is set
+    labels: Option<LabelSet>,
+    /// Combined --filter selector
+    selector: Option<LabelSelector>,
+}
+
+impl Labeling {
+    fn new(args: &GenerateArgs, configs: &[VlanConfig]) -> Self {
+        Self {
+            labels: args.labels.then(|| assign_labels(configs, args.seed)),
+            selector: args.label_selector(),
+        }
+    }
+
+    /// Whether objects of the VLAN are emitted
+    fn keeps(&self, vlan_id: Option<u16>) -> bool {
+        match (&self.labels, &self.selector) {
+            (Some(labels), Some(selector)) => labels.selects(vlan_id, selector),
+            _ => true,
+        }
+    }
+
+    /// Selected VLANs, descriptions unchanged
+    fn select(&self, configs: &[VlanConfig]) -> Vec<VlanConfig> {
+        configs
+            .iter()
+            .filter(|c| self.keeps(Some(c.vlan_id)))
+            .cloned()
+            .collect()
+    }
+
+    /// Selected firewall rules, descriptions unchanged
+    fn select_rules(&self, rules: &[FirewallRule]) -> Vec<FirewallRule> {
+        rules
+            .iter()
+            .filter(|r| self.keeps(r.vlan_id))
+            .cloned()
+            .collect()
+    }
+
+    /// VLAN with its labels appended to the description
+    fn annotate_vlan(&self, config: &VlanConfig) -> VlanConfig {
+        let mut config = config.clone();
+        if let Some(labels) = self.labels.as_ref().and_then(|l| l.get(config.vlan_id)) {
+            config.description = labels.annotate(&config.description);
+        }
+        config
+    }
+
+    /// Selected VLANs with labeled descriptions
+    fn vlans(&self, configs: &[VlanConfig]) -> Vec<VlanConfig> {
+        self.select(configs)
+            .iter()
+            .map(|c| self.annotate_vlan(c))
+            .collect()
+    }
+
+    /// Selected firewall rules with labeled descriptions
+    fn rules(&self, rules: &[FirewallRule]) -> Vec<FirewallRule> {
+        let mut rules = self.select_rules(rules);
+        if let Some(ref labels) = self.labels {
+            for rule in &mut rules {
+                if let Some(rule_labels) = rule.vlan_id.and_then(|id| labels.get(id)) {
+                    rule.description = rule_labels.annotate(&rule.description);
+                }
+            }
+        }
+        rules
+    }
+
+    /// Selected interface profiles
+    fn interfaces(&self, interfaces: &[VlanInterface]) -> Vec<VlanInterface> {
+        interfaces
+            .iter()
+            .filter(|i| self.keeps(Some(i.vlan_id)))
+            .copied()
+            .collect()
+    }
+}
+
+/// Write the labels of the selected VLANs as JSON for --labels
+fn write_labels(
+    labeling: &Labeling,
+    labels: &LabelSet,
+    total: usize,
+    output_file: &Path,
+    quiet: bool,
+) -> Result<()> {
+    let selected = LabelSet {
+        batch: labels.batch.clone(),
+        vlans: labels
+            .vlans
+            .iter()
+            .filter(|(id, _)| labeling.keeps(Some(**id)))
+            .map(|(id, l)| (*id, l.clone()))
+            .collect(),
+    };
+    let json = serde_json::to_string_pretty(&selected)?;
+    fs::write(output_file, json + "\n")
+        .with_context(|| format!("Failed to write labels to {:?}", output_file))?;
+
+    if !quiet {
+        println!();
+        println!("{}", theme::paint(Role::Heading, "Label Summary:"));
+        println!("  🏷️  Batch: {}", selected.batch);
+        match labeling.selector {
+            Some(_) => println!("  🔎 Selected VLANs: {} of {total}", selected.vlans.len()),
+            None => println!("  🔎 Labeled VLANs: {total}"),
+        }
+        println!("  📁 Output file: {}", output_file.display());
+    }
+    Ok(())
+}
+
+/// Write the intended reachability of the written VLANs and rules
+fn write_answer_key(
+    vlans: &[VlanConfig],
+    rules: &[FirewallRule],
+    seed: Option<u64>,
+    output_file: &Path,
+    quiet: bool,
+) -> Result<()> {
+    let key = AnswerKey::build(vlans, rules, seed);
+    let json = serde_json::to_string_pretty(&key)?;
+    fs::write(output_file, json + "\n")
+        .with_context(|| format!("Failed to write answer key to {:?}", output_file))?;
+
+    if !quiet {
+        let reachable = key
+            .reachability
+            .iter()
+            .filter(|r| r.allowed().next().is_some());
+        println!();
+        println!("{}", theme::paint(Role::Heading, "Answer Key Summary:"));
+        println!(
+            "  🎯 Pairs: {} ({} with at least one allowed service)",
+            key.reachability.len(),
+            reachable.count()
+        );
+        println!("  🧪 Services per pair: {}", key.services.len());
+        println!("  📁 Output file: {}", output_file.display());
+    }
+    Ok(())
 }
 
 /// Print summary for firewall rule generation
 fn print_firewall_summary(rules: &[crate::generator::FirewallRule], output_file: &Path) {
     println!();
-    println!("{}", style("Firewall Rules Summary:").bold());
+    println!("{}", theme::paint(Role::Heading, "Firewall Rules Summary:"));
     println!("  🔥 Total rules: {}", rules.len());
     println!("  📁 Output file: {}", output_file.display());
 
@@ -673,3 +2116,22 @@ fn print_firewall_summary(rules: &[crate::generator::FirewallRule], output_file:
         .len();
     println!("  🏷️  VLANs with rules: {}", vlan_count);
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::generator::{Flavor, UnsupportedPolicy};
+
+    #[test]
+    fn test_render_compat_lists_outcomes() {
+        let target = Target::parse("23.7", Flavor::Community).unwrap();
+        let sections = [Section::WireGuard];
+        let report = compat::resolve(target, &sections, UnsupportedPolicy::Downgrade).unwrap();
+        let rendered = render_compat(&report);
+        assert!(rendered.contains("Target: "));
+        assert!(rendered.contains("downgraded to openvpn"));
+
+        let report = compat::resolve(target, &[], UnsupportedPolicy::Error).unwrap();
+        assert!(render_compat(&report).contains("no release-dependent sections"));
+    }
+}
@@ -0,0 +1,422 @@
+//! Init-fixtures command - scaffold a version-controlled fixture repository
+//!
+//! Encodes the recommended workflow for teams versioning generated fixtures:
+//! seeded scenario files, a lock file pinning the generator version, a build
+//! target that regenerates everything, and `.gitattributes` for large XML.
+//! A starter snippet library shows how scenarios compose reusable VLAN
+//! bundles.
+
+use crate::cli::theme::{self, Role};
+use crate::cli::{BuildTool, GlobalArgs, InitFixturesArgs};
+use crate::generator::SectionBudgets;
+use crate::model::ConfigError;
+use crate::model::scenario::{Scenario, ScenarioFormat};
+use crate::model::snippet::{ParamValue, Params, Snippet, SnippetInstance, SnippetVlan};
+use anyhow::{Context, Result};
+use serde::Serialize;
+use std::fs;
+use std::path::{Path, PathBuf};
+
+/// Name of the lock file written at the fixture root
+pub const LOCK_FILE_NAME: &str = "fixtures.lock";
+
+/// Directory holding scenario definitions
+const SCENARIO_DIR: &str = "scenarios";
+
+/// Directory holding snippet definitions, the `compose` default
+pub const SNIPPET_DIR: &str = "snippets";
+
+/// Directory generated output is written to
+const GENERATED_DIR: &str = "generated";
+
+/// Minimal base configuration used by the XML scenario
+const BASE_CONFIG: &str = r#"<?xml version="1.0"?>
+<opnsense>
+  <version>24.7</version>
+  <system>
+    <hostname>fixture-fw</hostname>
+    <domain>example.internal</domain>
+  </system>
+  <interfaces>
+    <lan>
+      <if>em0</if>
+      <descr>LAN</descr>
+      <enable>1</enable>
+      <ipaddr>192.168.1.1</ipaddr>
+      <subnet>24</subnet>
+    </lan>
+    <wan>
+      <if>em1</if>
+      <descr>WAN</descr>
+      <enable>1</enable>
+      <ipaddr>dhcp</ipaddr>
+    </wan>
+  </interfaces>
+  <vlans>
+    <vlan>
+      <vlanid>{{VLAN_ID}}</vlanid>
+      <descr>{{DESCRIPTION}}</descr>
+      <subnet>{{IP_NETWORK}}</subnet>
+      <wan>{{WAN_ASSIGNMENT}}</wan>
+    </vlan>
+  </vlans>
+</opnsense>
+"#;
+
+/// Lock file contents pinning the generator and scenario seeds
+#[derive(Debug, Serialize)]
+struct FixtureLock {
+    lock_version: u32,
+    generator_version: String,
+    scenarios: Vec<LockedScenario>,
+}
+
+/// Lock entry for one scenario
+#[derive(Debug, Serialize)]
+struct LockedScenario {
+    name: String,
+    file: String,
+    seed: u64,
+}
+
+/// Execute the init-fixtures command
+pub fn execute(args: InitFixturesArgs, global: &GlobalArgs) -> Result<()> {
+    let created = scaffold_fixtures(&args.dir, &args.build_tool, args.lfs, args.force)
+        .with_context(|| format!("Failed to scaffold fixtures in {}", args.dir.display()))?;
+
+    if !global.quiet {
+        println!(
+            "{}",
+            theme::paint(Role::Success, "📦 Fixture repository initialized").bold()
+        );
+        for path in &created {
+            println!("  📄 {}", path.display());
+        }
+        println!();
+        println!(
+            "Next: run `{}` in {} and commit the result.",
+            match args.build_tool {
+                BuildTool::Just => "just fixtures",
+                BuildTool::Make => "make fixtures",
+            },
+            args.dir.display()
+        );
+    }
+
+    Ok(())
+}
+
+/// Default scenarios written into a new fixture repository
+pub fn default_scenarios() -> Vec<Scenario> {
+    vec![
+        Scenario {
+            name: "small-csv".to_string(),
+            description: "Small VLAN dataset for quick unit-level checks".to_string(),
+            format: ScenarioFormat::Csv,
+            count: 10,
+            seed: 42,
+            output: format!("{GENERATED_DIR}/small-csv.csv"),
+            base_config: None,
+            include_firewall_rules: false,
+            blocks: Vec::new(),
+            budgets: SectionBudgets::default(),
+        },
+        Scenario {
+            name: "xml-with-rules".to_string(),
+            description: "OPNsense XML configurations with firewall rules".to_string(),
+            format: ScenarioFormat::Xml,
+            count: 5,
+            seed: 1337,
+            output: format!("{GENERATED_DIR}/xml-with-rules"),
+            base_config: Some("base/config.xml".to_string()),
+            include_firewall_rules: true,
+            blocks: Vec::new(),
+            budgets: SectionBudgets::default(),
+        },
+        Scenario {
+            name: "branch-sites".to_string(),
+            description: "Branch sites composed from the guest VLAN bundle".to_string(),
+            format: ScenarioFormat::Csv,
+            count: 0,
+            seed: 7,
+            output: format!("{GENERATED_DIR}/branch-sites.csv"),
+            base_config: None,
+            include_firewall_rules: false,
+            blocks: [("Branch A", 110, 21), ("Branch B", 120, 22)]
+                .into_iter()
+                .map(|(site, vlan, octet)| SnippetInstance {
+                    snippet: "guest-bundle".to_string(),
+                    params: Params::from([
+                        ("site".to_string(), ParamValue::Text(site.to_string())),
+                        ("vlan".to_string(), ParamValue::Number(vlan)),
+                        ("octet".to_string(), ParamValue::Number(octet)),
+                    ]),
+                })
+                .collect(),
+            budgets: SectionBudgets::default(),
+        },
+    ]
+}
+
+/// Default snippets written into a new fixture repository
+pub fn default_snippets() -> Vec<Snippet> {
+    let vlan = |vlan_id: &str, third_octet: u8, name: &str| SnippetVlan {
+        vlan_id: vlan_id.to_string(),
+        ip_network: format!("10.{{octet}}.{third_octet}.x"),
+        description: format!("{{site}} {name}"),
+        wan_assignment: 1,
+    };
+    vec![Snippet {
+        name: "guest-bundle".to_string(),
+        description: "Standard guest, IoT, and voice VLANs of a site".to_string(),
+        params: Params::from([("site".to_string(), ParamValue::Text("Site".to_string()))]),
+        vlans: vec![
+            vlan("{vlan}", 1, "Guest"),
+            vlan("{vlan+1}", 2, "IoT"),
+            vlan("{vlan+2}", 3, "Voice"),
+        ],
+    }]
+}
+
+/// Scaffold a fixture repository, returning the files created
+pub fn scaffold_fixtures(
+    dir: &Path,
+    build_tool: &BuildTool,
+    lfs: bool,
+    force: bool,
+) -> crate::Result<Vec<PathBuf>> {
+    let scenarios = default_scenarios();
+    let lock_path = dir.join(LOCK_FILE_NAME);
+
+    if lock_path.exists() && !force {
+        return Err(ConfigError::config(format!(
+            "'{}' is already a fixture repository. Use --force to overwrite.",
+            dir.display()
+        )));
+    }
+
+    fs::create_dir_all(dir.join(SCENARIO_DIR))?;
+    fs::create_dir_all(dir.join(SNIPPET_DIR))?;
+    fs::create_dir_all(dir.join("base"))?;
+    fs::create_dir_all(dir.join(GENERATED_DIR))?;
+
+    let mut files: Vec<(PathBuf, String)> = Vec::new();
+
+    for scenario in &scenarios {
+        let json = serde_json::to_string_pretty(scenario)?;
+        files.push((scenario_path(scenario), format!("{json}\n")));
+    }
+
+    for snippet in default_snippets() {
+        let json = serde_json::to_string_pretty(&snippet)?;
+        files.push((
+            Path::new(SNIPPET_DIR).join(format!("{}.json", snippet.name)),
+            format!("{json}\n"),
+        ));
+    }
+
+    files.push((PathBuf::from("base/config.xml"), BASE_CONFIG.to_string()));
+
+    let lock = FixtureLock {
+        lock_version: 1,
+        generator_version: crate::VERSION.to_string(),
+        scenarios: scenarios
+            .iter()
+            .map(|s| LockedScenario {
+                name: s.name.clone(),
+                file: scenario_path(s).to_string_lossy().replace('\\', "/"),
+                seed: s.seed,
+            })
+            .collect(),
+    };
+    files.push((
+        PathBuf::from(LOCK_FILE_NAME),
+        format!("{}\n", serde_json::to_string_pretty(&lock)?),
+    ));
+
+    match build_tool {
+        BuildTool::Just => files.push((PathBuf::from("justfile"), render_justfile(&scenarios))),
+        BuildTool::Make => files.push((PathBuf::from("Makefile"), render_makefile(&scenarios))),
+    }
+
+    files.push((PathBuf::from(".gitattributes"), render_gitattributes(lfs)));
+    files.push((
+        PathBuf::from(format!("{GENERATED_DIR}/.gitkeep")),
+        String::new(),
+    ));
+
+    let mut created = Vec::with_capacity(files.len());
+    for (relative, content) in files {
+        let path = dir.join(&relative);
+        fs::write(&path, content)?;
+        created.push(path);
+    }
+
+    Ok(created)
+}
+
+/// Relative path of a scenario file
+fn scenario_path(scenario: &Scenario) -> PathBuf {
+    Path::new(SCENARIO_DIR).join(format!("{}.json", scenario.name))
+}
+
+/// Render the command lines regenerating a scenario
+fn render_commands(scenario: &Scenario) -> Vec<String> {
+    let file = scenario_path(scenario).to_string_lossy().replace('\\', "/");
+    scenario
+        .to_commands(&file)
+        .into_iter()
+        .map(|command| {
+            let args: Vec<String> = command
+                .into_iter()
+                .map(|arg| {
+                    if arg.contains(' ') {
+                        format!("\"{arg}\"")
+                    } else {
+                        arg
+                    }
+                })
+                .collect();
+            format!("$(FAKER) --quiet {}", args.join(" "))
+        })
+        .collect()
+}
+
+/// Render a justfile with one recipe per scenario and an aggregate target
+fn render_justfile(scenarios: &[Scenario]) -> String {
+    let mut out = String::new();
+    out.push_str("# Regenerate versioned fixtures. Scenario seeds are pinned in fixtures.lock.\n");
+    out.push_str(
+        "faker := env_var_or_default(\"OPNSENSE_CONFIG_FAKER\", \"opnsense-config-faker\")\n\n",
+    );
+
+    let names: Vec<String> = scenarios
+        .iter()
+        .map(|s| format!("fixture-{}", s.name))
+        .collect();
+    out.push_str(&format!("fixtures: {}\n\n", names.join(" ")));
+
+    for scenario in scenarios {
+        out.push_str(&format!("# {}\n", scenario.description));
+        out.push_str(&format!("fixture-{}:\n", scenario.name));
+        for command in render_commands(scenario) {
+            out.push_str(&format!(
+                "    {}\n",
+                command.replace("$(FAKER)", "{{faker}}")
+            ));
+        }
+        out.push('\n');
+    }
+
+    out
+}
+
+/// Render a Makefile with one target per scenario and an aggregate target
+fn render_makefile(scenarios: &[Scenario]) -> String {
+    let mut out = String::new();
+    out.push_str("# Regenerate versioned fixtures. Scenario seeds are pinned in fixtures.lock.\n");
+    out.push_str("FAKER ?= opnsense-config-faker\n\n");
+
+    let names: Vec<String> = scenarios
+        .iter()
+        .map(|s| format!("fixture-{}", s.name))
+        .collect();
+    out.push_str(&format!(".PHONY: fixtures {}\n\n", names.join(" ")));
+    out.push_str(&format!("fixtures: {}\n\n", names.join(" ")));
+
+    for scenario in scenarios {
+        out.push_str(&format!("# {}\n", scenario.description));
+        out.push_str(&format!("fixture-{}:\n", scenario.name));
+        for command in render_commands(scenario) {
+            out.push_str(&format!("\t{command}\n"));
+        }
+        out.push('\n');
+    }
+
+    out
+}
+
+/// Render .gitattributes tuned for large generated XML
+fn render_gitattributes(lfs: bool) -> String {
+    let mut out = String::new();
+    out.push_str("# Keep line endings stable so regenerated fixtures stay byte-identical\n");
+    out.push_str("*.xml text eol=lf\n");
+    out.push_str("*.csv text eol=lf\n");
+    out.push_str("*.json text eol=lf\n\n");
+    out.push_str("# Generated output is machine-written; collapse it in reviews\n");
+    out.push_str(&format!("{GENERATED_DIR}/** linguist-generated=true\n"));
+    if lfs {
+        out.push_str(&format!(
+            "{GENERATED_DIR}/**/*.xml filter=lfs diff=lfs merge=lfs -text\n"
+        ));
+    } else {
+        out.push_str(&format!("{GENERATED_DIR}/**/*.xml -diff\n"));
+    }
+    out
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::model::snippet::SnippetLibrary;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_scaffold_creates_expected_files() {
+        let dir = TempDir::new().unwrap();
+        let root = dir.path().join("fixtures");
+        scaffold_fixtures(&root, &BuildTool::Just, false, false).unwrap();
+
+        for file in [
+            "scenarios/small-csv.json",
+            "scenarios/xml-with-rules.json",
+            "scenarios/branch-sites.json",
+            "snippets/guest-bundle.json",
+            "base/config.xml",
+            "fixtures.lock",
+            "justfile",
+            ".gitattributes",
+            "generated/.gitkeep",
+        ] {
+            assert!(root.join(file).exists(), "missing {file}");
+        }
+
+        let scenario = Scenario::load(root.join("scenarios/xml-with-rules.json")).unwrap();
+        assert_eq!(scenario.seed, 1337);
+
+        let justfile = fs::read_to_string(root.join("justfile")).unwrap();
+        assert!(justfile.contains("fixtures: fixture-small-csv fixture-xml-with-rules"));
+        assert!(justfile.contains("{{faker}} --quiet generate --format csv"));
+        assert!(justfile.contains(
+            "{{faker}} --quiet compose scenarios/branch-sites.json --output generated/branch-sites.csv"
+        ));
+
+        let composed = Scenario::load(root.join("scenarios/branch-sites.json")).unwrap();
+        let library = SnippetLibrary::load_dir(root.join("snippets")).unwrap();
+        assert_eq!(library.compose(&composed.blocks).unwrap().len(), 6);
+
+        let lock = fs::read_to_string(root.join("fixtures.lock")).unwrap();
+        assert!(lock.contains(crate::VERSION));
+    }
+
+    #[test]
+    fn test_scaffold_makefile_and_lfs() {
+        let dir = TempDir::new().unwrap();
+        scaffold_fixtures(dir.path(), &BuildTool::Make, true, false).unwrap();
+
+        let makefile = fs::read_to_string(dir.path().join("Makefile")).unwrap();
+        assert!(makefile.contains("\t$(FAKER) --quiet generate --format xml"));
+        assert!(!dir.path().join("justfile").exists());
+
+        let attributes = fs::read_to_string(dir.path().join(".gitattributes")).unwrap();
+        assert!(attributes.contains("filter=lfs"));
+    }
+
+    #[test]
+    fn test_scaffold_refuses_existing_without_force() {
+        let dir = TempDir::new().unwrap();
+        scaffold_fixtures(dir.path(), &BuildTool::Just, false, false).unwrap();
+        assert!(scaffold_fixtures(dir.path(), &BuildTool::Just, false, false).is_err());
+        assert!(scaffold_fixtures(dir.path(), &BuildTool::Just, false, true).is_ok());
+    }
+}
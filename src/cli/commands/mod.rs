@@ -1,8 +1,25 @@
 //! CLI command implementations
 
+pub mod apply;
+pub mod audit;
 pub mod completions;
+pub mod compose;
 pub mod csv;
 pub mod deprecated;
+pub mod diff;
+pub mod export;
+pub mod extract;
+pub mod fuzz;
 pub mod generate;
+pub mod init_fixtures;
+pub mod query;
+pub mod release_pack;
+pub mod repro_check;
+pub mod schema;
+pub mod score;
+pub mod simulate;
+pub mod soak;
+pub mod summary;
 pub mod validate;
+pub mod view;
 pub mod xml;
@@ -0,0 +1,33 @@
+//! Query command - filter VLANs, rules, and hosts in generated output
+
+use crate::cli::{GlobalArgs, QueryArgs, ReportFormat};
+use crate::query::{Expr, QueryIndex};
+use anyhow::{Context, Result};
+
+/// Execute the query command
+pub fn execute(args: QueryArgs, global: &GlobalArgs) -> Result<()> {
+    // Parse before loading so syntax errors don't wait on a large input
+    let expr = args.filter.as_deref().map(Expr::parse).transpose()?;
+
+    let index = QueryIndex::load(&args.input)
+        .with_context(|| format!("Failed to load {}", args.input.display()))?;
+    let report = index.query(args.kind, expr.as_ref())?;
+
+    if args.count {
+        println!("{}", report.rows().len());
+        return Ok(());
+    }
+
+    print!("{}", report.render(args.format)?);
+    if args.format == ReportFormat::Table && !global.quiet {
+        println!();
+        println!(
+            "{} of {} {} matched",
+            report.rows().len(),
+            index.len(args.kind),
+            args.kind.plural()
+        );
+    }
+
+    Ok(())
+}
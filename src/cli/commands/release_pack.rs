@@ -0,0 +1,460 @@
+//! Release-pack command - build a versioned fixture pack for publishing
+//!
+//! Other projects' test suites want ready-made OPNsense fixtures rather than
+//! the generator. A pack holds one directory per curated profile with the
+//! VLAN CSV and the configuration built from the factory default, plus a
+//! manifest recording how every profile was generated, a human-readable
+//! summary, and a `SHA256SUMS` file, so the directory can be uploaded as a
+//! release artifact and verified by its consumers. With `--sign-key` the
+//! manifest is also signed; see [`crate::io::signing`].
+
+use crate::cli::commands::generate;
+use crate::cli::theme::{self, Role};
+use crate::cli::{GenerateArgs, GlobalArgs, ReleasePackArgs};
+use crate::io::csv::read_csv;
+use crate::io::signing::{Signer, sign_file};
+use crate::model::ConfigError;
+use crate::utils::repro::{FileDigest, digest_tree};
+use anyhow::{Context, Result};
+use clap::Parser;
+use serde::Serialize;
+use std::fs;
+use std::path::{Path, PathBuf};
+
+/// Manifest file written at the pack root
+pub const MANIFEST_FILE: &str = "manifest.json";
+
+/// Checksum file written at the pack root, in `sha256sum` format
+pub const CHECKSUM_FILE: &str = "SHA256SUMS";
+
+/// Summary file written at the pack root
+const SUMMARY_FILE: &str = "SUMMARY.md";
+
+/// VLAN CSV written in each profile directory
+const VLAN_CSV: &str = "vlans.csv";
+
+/// Firewall rule CSV written next to the XML configuration
+const RULES_CSV: &str = "firewall_1_rules.csv";
+
+/// Curated fixture profile
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct PackProfile {
+    /// Name used with --profiles and as the directory name
+    pub name: &'static str,
+    /// What the profile models
+    pub description: &'static str,
+    /// Number of VLANs
+    pub count: u16,
+    /// Generation seed, fixed so every release of a version is identical
+    pub seed: u64,
+    /// RFC 1918 prefix strategy of the VLAN networks
+    pub prefix_strategy: &'static str,
+    /// Firewall rule complexity
+    pub complexity: &'static str,
+    /// Subnet occupancy of the generated hosts, if any
+    pub host_density: Option<u8>,
+}
+
+/// Profiles available to release-pack, in pack order
+pub const PROFILES: &[PackProfile] = &[
+    PackProfile {
+        name: "small",
+        description: "Small office with a handful of VLANs and basic rules",
+        count: 8,
+        seed: 101,
+        prefix_strategy: "class-c",
+        complexity: "basic",
+        host_density: None,
+    },
+    PackProfile {
+        name: "campus",
+        description: "Campus network with mixed address classes and populated subnets",
+        count: 120,
+        seed: 202,
+        prefix_strategy: "mixed",
+        complexity: "intermediate",
+        host_density: Some(40),
+    },
+    PackProfile {
+        name: "datacenter",
+        description: "Datacenter with many VLANs and an advanced rule base",
+        count: 900,
+        seed: 303,
+        prefix_strategy: "class-a",
+        complexity: "advanced",
+        host_density: Some(25),
+    },
+];
+
+/// Look up a profile by name
+pub fn find_profile(name: &str) -> Result<&'static PackProfile> {
+    PROFILES.iter().find(|p| p.name == name).ok_or_else(|| {
+        let names: Vec<&str> = PROFILES.iter().map(|p| p.name).collect();
+        ConfigError::invalid_parameter(
+            "profiles",
+            format!("Unknown profile '{name}'; available: {}", names.join(", ")),
+        )
+        .into()
+    })
+}
+
+impl PackProfile {
+    /// Generate invocations building this profile in `dir`: VLAN CSV, then XML
+    ///
+    /// The XML run reads the CSV so both describe the same VLANs.
+    pub fn runs(&self, dir: &Path) -> [Vec<String>; 2] {
+        let csv = dir.join(VLAN_CSV).display().to_string();
+        let mut csv_run = vec![
+            "--format".to_string(),
+            "csv".to_string(),
+            "--count".to_string(),
+            self.count.to_string(),
+            "--seed".to_string(),
+            self.seed.to_string(),
+            "--prefix-strategy".to_string(),
+            self.prefix_strategy.to_string(),
+            "--output".to_string(),
+            csv.clone(),
+        ];
+        if let Some(density) = self.host_density {
+            csv_run.extend(["--host-density".to_string(), density.to_string()]);
+        }
+
+        let xml_run = vec![
+            "--format".to_string(),
+            "xml".to_string(),
+            "--from-default".to_string(),
+            "--csv-file".to_string(),
+            csv,
+            "--seed".to_string(),
+            self.seed.to_string(),
+            "--include-firewall-rules".to_string(),
+            "--firewall-rule-complexity".to_string(),
+            self.complexity.to_string(),
+            "--output-dir".to_string(),
+            dir.display().to_string(),
+        ];
+        [csv_run, xml_run]
+    }
+}
+
+/// Pack manifest
+#[derive(Debug, Serialize)]
+pub struct PackManifest {
+    /// Pack version
+    pub version: String,
+    /// Version of the generator that built the pack
+    pub generator_version: String,
+    /// Profiles in the pack
+    pub profiles: Vec<ProfileEntry>,
+}
+
+/// Manifest entry of one profile
+#[derive(Debug, Serialize)]
+pub struct ProfileEntry {
+    /// Profile name, also its directory
+    pub name: String,
+    /// What the profile models
+    pub description: String,
+    /// Generation seed
+    pub seed: u64,
+    /// Number of VLANs
+    pub vlans: usize,
+    /// Lowest and highest VLAN ID
+    pub vlan_ids: Option<(u16, u16)>,
+    /// Number of firewall rules
+    pub firewall_rules: usize,
+    /// Generate arguments of each run, relative to the profile directory
+    pub generate: Vec<Vec<String>>,
+    /// Files of the profile with their digests
+    pub files: Vec<ManifestFile>,
+    /// Combined digest over the profile's files
+    pub digest: String,
+}
+
+/// File recorded in the manifest
+#[derive(Debug, Serialize)]
+pub struct ManifestFile {
+    /// Path relative to the profile directory
+    pub path: String,
+    /// Lowercase hex SHA-256
+    pub sha256: String,
+}
+
+impl From<&FileDigest> for ManifestFile {
+    fn from(file: &FileDigest) -> Self {
+        Self {
+            path: file.path.clone(),
+            sha256: file.sha256.clone(),
+        }
+    }
+}
+
+/// Execute the release-pack command
+pub fn execute(args: ReleasePackArgs, global: &GlobalArgs) -> Result<()> {
+    let version = args
+        .pack_version
+        .clone()
+        .unwrap_or_else(|| env!("CARGO_PKG_VERSION").to_string());
+
+    if !global.quiet {
+        println!(
+            "{}",
+            theme::paint(Role::Title, "📦 OPNsense Config Faker - Release Pack")
+        );
+        println!();
+    }
+
+    let signing = args.sign_key.as_deref().map(|key| (args.signer, key));
+    let pack_dir = build_pack(
+        &args.profiles,
+        &args.out,
+        &version,
+        args.force,
+        signing,
+        global,
+    )?;
+
+    if !global.quiet {
+        println!();
+        println!(
+            "{} {}",
+            theme::paint(Role::Success, "✅ Pack written to"),
+            theme::paint(Role::Accent, pack_dir.display())
+        );
+        println!("  📄 {MANIFEST_FILE}, {SUMMARY_FILE}, {CHECKSUM_FILE}");
+        if let Some((signer, _)) = signing {
+            println!("  🔏 {MANIFEST_FILE}.sig, verify with:");
+            println!("     {}", signer.verify_hint(MANIFEST_FILE));
+        }
+    }
+    Ok(())
+}
+
+/// Directory name of a pack version
+pub fn pack_name(version: &str) -> String {
+    format!("opnsense-fixtures-{version}")
+}
+
+/// Build the pack for `profiles` below `out` and return its directory
+///
+/// With `signing`, the manifest is signed before the checksums are written,
+/// so `SHA256SUMS` covers the signature too.
+pub fn build_pack(
+    profiles: &[String],
+    out: &Path,
+    version: &str,
+    force: bool,
+    signing: Option<(Signer, &Path)>,
+    global: &GlobalArgs,
+) -> Result<PathBuf> {
+    if version.is_empty() || version.contains(['/', '\\']) || version.starts_with('.') {
+        return Err(ConfigError::invalid_parameter(
+            "pack-version",
+            format!("'{version}' cannot be used in a directory name"),
+        )
+        .into());
+    }
+    let mut selected: Vec<&PackProfile> = Vec::new();
+    for name in profiles {
+        let profile = find_profile(name.trim())?;
+        if !selected.contains(&profile) {
+            selected.push(profile);
+        }
+    }
+    if selected.is_empty() {
+        return Err(ConfigError::invalid_parameter("profiles", "No profiles selected").into());
+    }
+
+    let pack_dir = out.join(pack_name(version));
+    if pack_dir.exists() {
+        if !force {
+            return Err(ConfigError::config(format!(
+                "Pack {} already exists. Use --force to rebuild it.",
+                pack_dir.display()
+            ))
+            .into());
+        }
+        fs::remove_dir_all(&pack_dir)
+            .with_context(|| format!("Failed to remove {}", pack_dir.display()))?;
+    }
+    fs::create_dir_all(&pack_dir)
+        .with_context(|| format!("Failed to create {}", pack_dir.display()))?;
+
+    let run_global = GlobalArgs {
+        quiet: true,
+        keep_temp: global.keep_temp,
+        ..GlobalArgs::default()
+    };
+    let mut entries = Vec::with_capacity(selected.len());
+    for profile in selected {
+        if !global.quiet {
+            println!(
+                "🔧 Building profile '{}' ({} VLANs)",
+                profile.name, profile.count
+            );
+        }
+        let entry = build_profile(profile, &pack_dir, &run_global)
+            .with_context(|| format!("Failed to build profile '{}'", profile.name))?;
+        entries.push(entry);
+    }
+
+    let manifest = PackManifest {
+        version: version.to_string(),
+        generator_version: env!("CARGO_PKG_VERSION").to_string(),
+        profiles: entries,
+    };
+    let manifest_path = pack_dir.join(MANIFEST_FILE);
+    fs::write(
+        &manifest_path,
+        serde_json::to_string_pretty(&manifest)? + "\n",
+    )?;
+    if let Some((signer, key)) = signing {
+        sign_file(signer, key, &manifest_path)
+            .with_context(|| format!("Failed to sign {}", manifest_path.display()))?;
+    }
+    fs::write(
+        pack_dir.join(SUMMARY_FILE),
+        render_summary(&manifest, signing.map(|(signer, _)| signer)),
+    )?;
+
+    // Checksums cover everything written so far, manifest and summary included
+    let sums: String = digest_tree(&pack_dir)?
+        .files()
+        .iter()
+        .map(|file| format!("{}  {}\n", file.sha256, file.path))
+        .collect();
+    fs::write(pack_dir.join(CHECKSUM_FILE), sums)?;
+
+    Ok(pack_dir)
+}
+
+fn build_profile(
+    profile: &PackProfile,
+    pack_dir: &Path,
+    global: &GlobalArgs,
+) -> Result<ProfileEntry> {
+    let dir = pack_dir.join(profile.name);
+    fs::create_dir_all(&dir)?;
+    for run in profile.runs(&dir) {
+        let mut args = GenerateArgs::try_parse_from(
+            std::iter::once("generate").chain(run.iter().map(String::as_str)),
+        )
+        .map_err(|e| ConfigError::invalid_parameter("profile", e.to_string().trim_end()))?;
+        args.force = true;
+        generate::execute_with_global(args, global)?;
+    }
+
+    let configs = read_csv(dir.join(VLAN_CSV))?;
+    let vlan_ids = configs
+        .iter()
+        .map(|c| c.vlan_id)
+        .min()
+        .zip(configs.iter().map(|c| c.vlan_id).max());
+    let firewall_rules = fs::read_to_string(dir.join(RULES_CSV))
+        .map(|content| content.lines().skip(1).filter(|l| !l.is_empty()).count())
+        .unwrap_or(0);
+    let digest = digest_tree(&dir)?;
+
+    Ok(ProfileEntry {
+        name: profile.name.to_string(),
+        description: profile.description.to_string(),
+        seed: profile.seed,
+        vlans: configs.len(),
+        vlan_ids,
+        firewall_rules,
+        generate: profile.runs(Path::new(".")).into(),
+        files: digest.files().iter().map(ManifestFile::from).collect(),
+        digest: digest.combined().to_string(),
+    })
+}
+
+/// Markdown overview of the pack for release notes and browsing
+fn render_summary(manifest: &PackManifest, signer: Option<Signer>) -> String {
+    let mut out = format!(
+        "# OPNsense fixture pack {}\n\nGenerated by opnsense-config-faker {}. \
+         Verify the files with `sha256sum -c {CHECKSUM_FILE}`.",
+        manifest.version, manifest.generator_version
+    );
+    if let Some(signer) = signer {
+        out.push_str(&format!(
+            " The manifest is signed; verify it with `{}`.",
+            signer.verify_hint(MANIFEST_FILE)
+        ));
+    }
+    out.push_str("\n\n");
+    out.push_str("| Profile | Description | VLANs | VLAN IDs | Firewall rules | Seed |\n");
+    out.push_str("| ------- | ----------- | ----- | -------- | -------------- | ---- |\n");
+    for profile in &manifest.profiles {
+        let ids = profile
+            .vlan_ids
+            .map(|(min, max)| format!("{min}-{max}"))
+            .unwrap_or_else(|| "-".to_string());
+        out.push_str(&format!(
+            "| `{}` | {} | {} | {ids} | {} | {} |\n",
+            profile.name, profile.description, profile.vlans, profile.firewall_rules, profile.seed
+        ));
+    }
+    for profile in &manifest.profiles {
+        out.push_str(&format!("\n## {}\n\n", profile.name));
+        for file in &profile.files {
+            out.push_str(&format!("- `{}/{}`\n", profile.name, file.path));
+        }
+    }
+    out
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    fn quiet() -> GlobalArgs {
+        GlobalArgs {
+            quiet: true,
+            ..GlobalArgs::default()
+        }
+    }
+
+    #[test]
+    fn test_unknown_profile_rejected() {
+        let dir = TempDir::new().unwrap();
+        let err = build_pack(
+            &["tiny".to_string()],
+            dir.path(),
+            "1.0",
+            false,
+            None,
+            &quiet(),
+        );
+        assert!(
+            err.unwrap_err()
+                .to_string()
+                .contains("small, campus, datacenter")
+        );
+    }
+
+    #[test]
+    fn test_small_pack_is_complete_and_reproducible() {
+        let dir = TempDir::new().unwrap();
+        let profiles = ["small".to_string()];
+        let pack = build_pack(&profiles, dir.path(), "1.0", false, None, &quiet()).unwrap();
+        assert_eq!(pack, dir.path().join("opnsense-fixtures-1.0"));
+
+        let manifest: serde_json::Value =
+            serde_json::from_str(&fs::read_to_string(pack.join(MANIFEST_FILE)).unwrap()).unwrap();
+        let small = &manifest["profiles"][0];
+        assert_eq!(small["vlans"], 8);
+        assert!(small["firewall_rules"].as_u64().unwrap() > 0);
+        assert_eq!(small["generate"][0][9], "./vlans.csv");
+
+        let sums = fs::read_to_string(pack.join(CHECKSUM_FILE)).unwrap();
+        assert!(sums.contains("  small/firewall_1.xml\n"));
+        assert!(sums.contains(&format!("  {MANIFEST_FILE}\n")));
+
+        // Existing packs are only replaced with force, and rebuild identically
+        assert!(build_pack(&profiles, dir.path(), "1.0", false, None, &quiet()).is_err());
+        build_pack(&profiles, dir.path(), "1.0", true, None, &quiet()).unwrap();
+        assert_eq!(fs::read_to_string(pack.join(CHECKSUM_FILE)).unwrap(), sums);
+    }
+}
@@ -0,0 +1,221 @@
+//! Repro-check command - verify seeded generation is byte-for-byte reproducible
+//!
+//! Runs `generate` several times with identical arguments, each in its own
+//! temporary workspace, and compares SHA-256 digests of every output file.
+//! The combined digest is independent of platform and output location, so CI
+//! jobs on Linux, macOS, and Windows can pass one job's digest to the others
+//! with `--expect`.
+
+use crate::cli::commands::generate;
+use crate::cli::theme::{self, Role};
+use crate::cli::{GenerateArgs, GlobalArgs, OutputFormat, ReproCheckArgs};
+use crate::model::ConfigError;
+use crate::utils::repro::{TreeDigest, digest_tree};
+use crate::utils::workspace::Workspace;
+use anyhow::{Context, Result};
+use clap::Parser;
+use std::path::Path;
+
+/// Seed used when the generate arguments do not specify one
+pub const DEFAULT_SEED: u64 = 42;
+
+/// File name of the CSV output inside each run's workspace
+const CSV_OUTPUT_NAME: &str = "vlans.csv";
+
+/// Execute the repro-check command
+pub fn execute(args: ReproCheckArgs, global: &GlobalArgs) -> Result<()> {
+    if args.runs < 2 {
+        return Err(ConfigError::invalid_parameter("runs", "At least 2 runs are needed").into());
+    }
+
+    // Parse once up front so argument errors surface before any run
+    let probe = parse_generate_args(&args.generate_args)?;
+    let seed = probe.seed.unwrap_or(DEFAULT_SEED);
+
+    if !global.quiet {
+        println!(
+            "{}",
+            theme::paint(
+                Role::Title,
+                "🔁 OPNsense Config Faker - Reproducibility Check"
+            )
+        );
+        println!();
+        println!(
+            "Running generate {} times with seed {seed}: {}",
+            args.runs,
+            args.generate_args.join(" ")
+        );
+    }
+
+    let mut digests: Vec<TreeDigest> = Vec::with_capacity(args.runs as usize);
+    for run in 1..=args.runs {
+        let workspace = Workspace::create("repro-check", global.keep_temp)?;
+        let generate_args = prepare_run(&args.generate_args, seed, workspace.path())?;
+        let run_global = GlobalArgs {
+            quiet: true,
+            keep_temp: global.keep_temp,
+            ..GlobalArgs::default()
+        };
+        generate::execute_with_global(generate_args, &run_global)
+            .with_context(|| format!("Generation failed in run {run}"))?;
+
+        let digest = digest_tree(workspace.path())
+            .with_context(|| format!("Failed to digest output of run {run}"))?;
+        if !global.quiet {
+            println!(
+                "  Run {run}: {} files, {}",
+                digest.files().len(),
+                digest.combined()
+            );
+            if workspace.is_kept() {
+                println!("    kept: {}", workspace.path().display());
+            }
+        }
+        digests.push(digest);
+    }
+
+    let first = &digests[0];
+    if first.files().is_empty() {
+        return Err(ConfigError::config("Generation produced no output files").into());
+    }
+
+    for (index, digest) in digests.iter().enumerate().skip(1) {
+        let differing = first.differing_files(digest);
+        if !differing.is_empty() {
+            if !global.quiet {
+                for path in &differing {
+                    println!("  {} {path}", theme::paint(Role::Removed, "differs:"));
+                }
+            }
+            return Err(ConfigError::validation(format!(
+                "Run {} produced different output than run 1 ({} of {} files differ)",
+                index + 1,
+                differing.len(),
+                first.files().len()
+            ))
+            .into());
+        }
+    }
+
+    if let Some(expected) = &args.expect
+        && !expected.trim().eq_ignore_ascii_case(first.combined())
+    {
+        return Err(ConfigError::validation(format!(
+            "Combined digest {} does not match expected {}",
+            first.combined(),
+            expected.trim()
+        ))
+        .into());
+    }
+
+    if !global.quiet {
+        println!();
+        println!(
+            "{} {} runs produced identical output",
+            theme::paint(Role::Success, "✅"),
+            args.runs
+        );
+        println!(
+            "Combined digest: {}",
+            theme::paint(Role::Accent, first.combined())
+        );
+    } else {
+        // The digest is the result; print it even when quiet so scripts can capture it
+        println!("{}", first.combined());
+    }
+
+    Ok(())
+}
+
+/// Parse the arguments given after `--` as generate arguments
+fn parse_generate_args(raw: &[String]) -> Result<GenerateArgs> {
+    GenerateArgs::try_parse_from(std::iter::once("generate").chain(raw.iter().map(String::as_str)))
+        .map_err(|e| {
+            ConfigError::invalid_parameter("generate arguments", e.to_string().trim_end()).into()
+        })
+}
+
+/// Build the generate arguments for one run writing into `dir`
+fn prepare_run(raw: &[String], seed: u64, dir: &Path) -> Result<GenerateArgs> {
+    let mut args = parse_generate_args(raw)?;
+    args.seed = Some(seed);
+    args.force = true;
+    args.interactive = false;
+    match args.format {
+        OutputFormat::Csv => args.output = Some(dir.join(CSV_OUTPUT_NAME)),
+        OutputFormat::Xml => {
+            args.output = None;
+            args.output_dir = dir.to_path_buf();
+        }
+    }
+    Ok(args)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn raw(args: &[&str]) -> Vec<String> {
+        args.iter().map(|a| a.to_string()).collect()
+    }
+
+    #[test]
+    fn test_prepare_run_redirects_output_and_pins_seed() {
+        let dir = Path::new("ws");
+        let args = prepare_run(
+            &raw(&[
+                "--format",
+                "csv",
+                "--count",
+                "5",
+                "--output",
+                "elsewhere.csv",
+            ]),
+            DEFAULT_SEED,
+            dir,
+        )
+        .unwrap();
+        assert_eq!(args.seed, Some(DEFAULT_SEED));
+        assert_eq!(args.output, Some(dir.join(CSV_OUTPUT_NAME)));
+        assert!(args.force);
+
+        let args =
+            prepare_run(&raw(&["--format", "xml", "--base-config", "b.xml"]), 7, dir).unwrap();
+        assert_eq!(args.output_dir, dir.to_path_buf());
+        assert_eq!(args.seed, Some(7));
+    }
+
+    #[test]
+    fn test_invalid_generate_args_rejected() {
+        assert!(parse_generate_args(&raw(&["--format", "yaml"])).is_err());
+    }
+
+    #[test]
+    fn test_seeded_csv_generation_is_reproducible() {
+        let args = ReproCheckArgs {
+            runs: 3,
+            expect: None,
+            generate_args: raw(&["--format", "csv", "--count", "20", "--seed", "9"]),
+        };
+        let global = GlobalArgs {
+            quiet: true,
+            ..GlobalArgs::default()
+        };
+        execute(args, &global).unwrap();
+    }
+
+    #[test]
+    fn test_expect_mismatch_fails() {
+        let args = ReproCheckArgs {
+            runs: 2,
+            expect: Some("0".repeat(64)),
+            generate_args: raw(&["--format", "csv", "--count", "3"]),
+        };
+        let global = GlobalArgs {
+            quiet: true,
+            ..GlobalArgs::default()
+        };
+        assert!(execute(args, &global).is_err());
+    }
+}
@@ -0,0 +1,59 @@
+//! Schema command - export schemas of the faker's input files
+//!
+//! The schemas come from the installed binary, so editors and CI validators
+//! that fetch them stay in sync with the fields this version accepts.
+
+use crate::cli::{GlobalArgs, SchemaArgs, SchemaCommand, SchemaExportArgs, SchemaFormat};
+use crate::model::schema::json_schema;
+use anyhow::{Context, Result};
+use std::fs;
+
+/// Execute the schema command
+pub fn execute(args: SchemaArgs, global: &GlobalArgs) -> Result<()> {
+    match args.command {
+        SchemaCommand::Export(args) => export(args, global),
+    }
+}
+
+fn export(args: SchemaExportArgs, global: &GlobalArgs) -> Result<()> {
+    let schema = match args.format {
+        SchemaFormat::JsonSchema => json_schema(args.kind.into()),
+    };
+    let rendered = format!("{}\n", serde_json::to_string_pretty(&schema)?);
+
+    match &global.output {
+        Some(path) => fs::write(path, rendered)
+            .with_context(|| format!("Failed to write schema to {}", path.display()))?,
+        None => print!("{rendered}"),
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::cli::SchemaType;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_export_writes_schema_to_output() {
+        let dir = TempDir::new().unwrap();
+        let path = dir.path().join("seed.schema.json");
+        let global = GlobalArgs {
+            output: Some(path.clone()),
+            ..GlobalArgs::default()
+        };
+        let args = SchemaArgs {
+            command: SchemaCommand::Export(SchemaExportArgs {
+                kind: SchemaType::Seed,
+                format: SchemaFormat::JsonSchema,
+            }),
+        };
+        execute(args, &global).unwrap();
+
+        let schema: serde_json::Value =
+            serde_json::from_str(&fs::read_to_string(&path).unwrap()).unwrap();
+        assert_eq!(schema["type"], "array");
+        assert!(schema["$id"].as_str().unwrap().ends_with(":seed"));
+    }
+}
@@ -0,0 +1,156 @@
+//! Score command - rate a configuration's health with a tunable model
+//!
+//! See [`crate::validate::score`] for how the score is composed.
+
+use crate::cli::commands::validate::print_finding;
+use crate::cli::input::read_config;
+use crate::cli::theme::{self, Role};
+use crate::cli::{GlobalArgs, ScoreArgs};
+use crate::model::ConfigError;
+use crate::validate::lint::{LintRuleFile, LintRuleSet};
+use crate::validate::score::{ScoreModel, ScoreReport, score};
+use anyhow::{Context, Result};
+use std::fs;
+
+/// Findings listed in the summary; the JSON report has all of them
+const SHOWN_FINDINGS: usize = 10;
+
+/// Execute the score command
+pub fn execute(args: ScoreArgs, global: &GlobalArgs) -> Result<()> {
+    let mut model = match &args.model {
+        Some(path) => ScoreModel::load(path)
+            .with_context(|| format!("Failed to load scoring model: {}", path.display()))?,
+        None => ScoreModel::default(),
+    };
+    if let Some(min_score) = args.min_score {
+        model.threshold = f64::from(min_score);
+    }
+    let mut rules = LintRuleSet::new(model.lint.rules.clone())
+        .context("Invalid lint rule in the scoring model")?;
+    for path in &args.rules {
+        LintRuleFile::load(path)
+            .and_then(|file| rules.extend(file.rules))
+            .with_context(|| format!("Failed to load lint rules: {}", path.display()))?;
+    }
+
+    let content = read_config(&args.input, None, global)?;
+    let report = score(&content, &model, &rules)
+        .with_context(|| format!("Failed to score {}", args.input.display()))?;
+
+    if !global.quiet {
+        print_summary(&report);
+    }
+    if let Some(path) = &global.output {
+        fs::write(
+            path,
+            format!("{}\n", serde_json::to_string_pretty(&report)?),
+        )
+        .with_context(|| format!("Failed to write score report to {}", path.display()))?;
+        if !global.quiet {
+            println!("📄 Report written to {}", path.display());
+        }
+    }
+
+    if !report.passed {
+        return Err(ConfigError::validation(format!(
+            "Score {:.1} is below the threshold of {:.1}",
+            report.score, report.threshold
+        ))
+        .into());
+    }
+    Ok(())
+}
+
+fn print_summary(report: &ScoreReport) {
+    println!("{}", theme::paint(Role::Heading, "Health Score:"));
+    let (role, icon) = if report.passed {
+        (Role::Success, "✅")
+    } else {
+        (Role::Error, "❌")
+    };
+    println!(
+        "  {} {:.1} / 100 (threshold {:.1})",
+        theme::paint(role, icon),
+        report.score,
+        report.threshold
+    );
+    for component in &report.components {
+        println!(
+            "  {:<11} {:>5.1}  (weight {})",
+            component.name, component.score, component.weight
+        );
+    }
+
+    println!();
+    println!("{}", theme::paint(Role::Heading, "Complexity:"));
+    for metric in &report.metrics {
+        let range = match (metric.target.min, metric.target.max) {
+            (Some(min), Some(max)) => format!("{min}-{max}"),
+            (Some(min), None) => format!(">= {min}"),
+            (None, Some(max)) => format!("<= {max}"),
+            (None, None) => "any".to_string(),
+        };
+        println!(
+            "  {:<22} {:>8.2}  target {range:<10} {:>5.1}",
+            metric.name, metric.value, metric.score
+        );
+    }
+
+    println!();
+    println!("{}", theme::paint(Role::Heading, "Coverage:"));
+    for subsystem in &report.subsystems {
+        let mark = if subsystem.entries > 0 { "✓" } else { "·" };
+        println!(
+            "  {mark} {:<15} {:>6} entries  (weight {})",
+            subsystem.name, subsystem.entries, subsystem.weight
+        );
+    }
+
+    if !report.findings.is_empty() {
+        println!();
+        println!("{}", theme::paint(Role::Heading, "Lint Findings:"));
+        for finding in report.findings.iter().take(SHOWN_FINDINGS) {
+            print_finding(finding);
+        }
+        if report.findings.len() > SHOWN_FINDINGS {
+            println!("  … {} more", report.findings.len() - SHOWN_FINDINGS);
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::xml::FACTORY_DEFAULT_CONFIG;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_score_writes_report_and_enforces_threshold() {
+        let dir = TempDir::new().unwrap();
+        let input = dir.path().join("config.xml");
+        fs::write(&input, FACTORY_DEFAULT_CONFIG).unwrap();
+        let model = dir.path().join("model.json");
+        fs::write(&model, r#"{"threshold": 0, "coverage": {"interfaces": 1}}"#).unwrap();
+        let output = dir.path().join("score.json");
+        let global = GlobalArgs {
+            quiet: true,
+            output: Some(output.clone()),
+            ..GlobalArgs::default()
+        };
+        let args = |min_score| ScoreArgs {
+            input: input.clone(),
+            model: Some(model.clone()),
+            rules: Vec::new(),
+            min_score,
+        };
+        execute(args(None), &global).unwrap();
+
+        let report: serde_json::Value =
+            serde_json::from_str(&fs::read_to_string(&output).unwrap()).unwrap();
+        assert_eq!(report["passed"], true);
+        assert_eq!(report["components"].as_array().unwrap().len(), 3);
+        assert_eq!(report["subsystems"][0]["name"], "interfaces");
+
+        assert!(execute(args(Some(100)), &global).is_err());
+    }
+}
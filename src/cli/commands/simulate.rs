@@ -0,0 +1,250 @@
+//! Simulate command - evaluate traffic against generated configurations
+//!
+//! `simulate path` follows one flow through the VLANs, firewall rules, and
+//! port forwards of generated output and reports the verdict together with
+//! every rule that matched; see [`crate::simulate`]. `simulate change`
+//! reports which flows of a traffic matrix an added rule would affect; see
+//! [`crate::simulate::change`].
+
+use crate::cli::theme::{self, Role};
+use crate::cli::{
+    ExpectedVerdict, GlobalArgs, SimulateArgs, SimulateChangeArgs, SimulateCommand,
+    SimulatePathArgs,
+};
+use crate::model::ConfigError;
+use crate::simulate::change::{ImpactKind, analyze_change, parse_rule_spec, sample_flows};
+use crate::simulate::{Flow, NetworkModel, PathTrace, Verdict, rule_label};
+use anyhow::{Context, Result};
+use std::path::Path;
+
+/// Affected flows printed per kind; the rest are only counted
+const SHOWN_IMPACTS: usize = 10;
+
+/// Execute the simulate command
+pub fn execute(args: SimulateArgs, global: &GlobalArgs) -> Result<()> {
+    match args.command {
+        SimulateCommand::Path(args) => path(args, global),
+        SimulateCommand::Change(args) => change(args, global),
+    }
+}
+
+fn load_model(input: &Path) -> Result<NetworkModel> {
+    let model = NetworkModel::load(input)
+        .with_context(|| format!("Failed to load generated output: {}", input.display()))?;
+    if model.vlans().is_empty() {
+        return Err(ConfigError::validation(format!(
+            "No VLANs found in {}; pass a generated VLAN CSV, XML, or output directory",
+            input.display()
+        ))
+        .into());
+    }
+    Ok(model)
+}
+
+fn path(args: SimulatePathArgs, global: &GlobalArgs) -> Result<()> {
+    let model = load_model(&args.input)?;
+    let flow = Flow {
+        source: args.from,
+        destination: args.to,
+        protocol: args.protocol.as_str().to_string(),
+        port: args.port,
+    };
+    let trace = model.trace(&flow);
+
+    if !global.quiet {
+        print_trace(&model, &trace);
+    }
+
+    let passed = trace.verdict == Verdict::Pass;
+    match args.expect {
+        Some(ExpectedVerdict::Pass) if !passed => Err(ConfigError::validation(format!(
+            "Expected {flow} to pass, but it is {}: {}",
+            trace.verdict, trace.reason
+        ))
+        .into()),
+        Some(ExpectedVerdict::Block) if passed => Err(ConfigError::validation(format!(
+            "Expected {flow} to be blocked, but it passes: {}",
+            trace.reason
+        ))
+        .into()),
+        _ => Ok(()),
+    }
+}
+
+fn print_trace(model: &NetworkModel, trace: &PathTrace) {
+    println!(
+        "{}",
+        theme::paint(Role::Title, "🧭 OPNsense Config Faker - Path Simulation")
+    );
+    println!();
+    println!("Flow: {}", theme::paint(Role::Accent, &trace.flow));
+    if let Some((translated, _)) = &trace.translated {
+        println!("NAT:  {}", theme::paint(Role::Accent, translated));
+    }
+    println!(
+        "Path: {} → {}",
+        trace.ingress,
+        trace.egress.as_deref().unwrap_or("(no route)")
+    );
+
+    for check in &trace.checks {
+        println!();
+        let stage = if check.ingress {
+            "in on"
+        } else {
+            "out through"
+        };
+        let heading = format!("Rules {stage} {}:", check.interface);
+        println!("{}", theme::paint(Role::Heading, heading));
+        if check.matched.is_empty() {
+            println!("  no matching rules");
+        }
+        for &index in &check.matched {
+            let rule = &model.rules()[index];
+            let marker = match check.decided_by {
+                Some(decided) if decided == index => "→",
+                Some(_) => " ",
+                // Egress passes leave the decision to the ingress rule
+                None => "·",
+            };
+            println!(
+                "  {marker} #{:<3} {:<6} {} → {} {} {}  {}",
+                rule.priority,
+                rule.action,
+                rule.source,
+                rule.destination,
+                rule.protocol,
+                rule.ports,
+                rule_label(model, index)
+            );
+        }
+    }
+
+    println!();
+    let verdict = match trace.verdict {
+        Verdict::Pass => theme::paint(Role::Success, "✅ PASS"),
+        Verdict::Block => theme::paint(Role::Error, "❌ BLOCK"),
+        Verdict::NotRouted => theme::paint(Role::Warning, "⚠️  NOT ROUTED"),
+    };
+    println!("{verdict}: {}", trace.reason);
+}
+
+fn change(args: SimulateChangeArgs, global: &GlobalArgs) -> Result<()> {
+    let rule = parse_rule_spec(&args.add_rule)?;
+    let model = load_model(&args.input)?;
+    let flows = sample_flows(&model, args.samples, args.seed);
+    let report = analyze_change(&model, rule, &flows);
+    if global.quiet {
+        return Ok(());
+    }
+
+    println!(
+        "{}",
+        theme::paint(Role::Title, "🧭 OPNsense Config Faker - Rule Change Impact")
+    );
+    println!();
+    println!("Rule:  {}", theme::paint(Role::Accent, &args.add_rule));
+    println!(
+        "Flows: {} traced from {} VLANs (seed {})",
+        report.flows,
+        model.vlans().len(),
+        args.seed
+    );
+
+    for (kind, title) in [
+        (ImpactKind::VerdictChange, "Verdict changes"),
+        (ImpactKind::TakesOver, "Now decided by the new rule"),
+        (
+            ImpactKind::Shadowed,
+            "Matching, but decided by an earlier rule",
+        ),
+    ] {
+        let impacts: Vec<_> = report.impacts.iter().filter(|i| i.kind == kind).collect();
+        println!();
+        println!(
+            "{}",
+            theme::paint(Role::Heading, format!("{title} ({}):", impacts.len()))
+        );
+        for impact in impacts.iter().take(SHOWN_IMPACTS) {
+            let other = impact
+                .other_rule
+                .map(|index| rule_label(&model, index))
+                .unwrap_or_else(|| "default deny".to_string());
+            let outcome = match kind {
+                ImpactKind::VerdictChange => format!(
+                    "{} → {}, was {other}",
+                    theme::paint(Role::Removed, impact.before),
+                    theme::paint(Role::Added, impact.after)
+                ),
+                ImpactKind::TakesOver => format!("{}, was {other}", impact.after),
+                ImpactKind::Shadowed => format!("{}, by {other}", impact.after),
+            };
+            println!("  [{kind}] {}: {outcome}", impact.flow);
+        }
+        if impacts.len() > SHOWN_IMPACTS {
+            println!("  … and {} more", impacts.len() - SHOWN_IMPACTS);
+        }
+    }
+
+    if !report.retired_rules.is_empty() {
+        println!();
+        println!(
+            "{}",
+            theme::paint(Role::Warning, "Rules no longer deciding any traced flow:")
+        );
+        for &index in &report.retired_rules {
+            println!("  {}", rule_label(&model, index));
+        }
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::cli::FlowProtocol;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_simulate_path_expectations() {
+        let dir = TempDir::new().unwrap();
+        fs::write(
+            dir.path().join("vlans.csv"),
+            "VLAN,IP Range,Beschreibung,WAN\n120,10.10.20.x,Sales,1\n340,192.168.40.x,Servers,1\n",
+        )
+        .unwrap();
+        fs::write(
+            dir.path().join("vlans_firewall_rules.csv"),
+            "rule_id,source,destination,protocol,ports,action,direction,description,log,\
+             vlan_id,priority,interface\n\
+             r1,10.10.20.x,any,tcp,\"80,443\",pass,out,Allow web,true,120,1,vlan120\n",
+        )
+        .unwrap();
+        let args = |port, expect| SimulatePathArgs {
+            from: "10.10.20.5".parse().unwrap(),
+            to: "192.168.40.10".parse().unwrap(),
+            port: Some(port),
+            protocol: FlowProtocol::Tcp,
+            input: dir.path().to_path_buf(),
+            expect: Some(expect),
+        };
+        let quiet = GlobalArgs {
+            quiet: true,
+            ..GlobalArgs::default()
+        };
+
+        assert!(path(args(443, ExpectedVerdict::Pass), &quiet).is_ok());
+        assert!(path(args(22, ExpectedVerdict::Block), &quiet).is_ok());
+        let err = path(args(22, ExpectedVerdict::Pass), &quiet).unwrap_err();
+        assert!(err.to_string().contains("default deny"));
+
+        let change_args = SimulateChangeArgs {
+            add_rule: "block tcp from 10.10.20.x to any port 443 on vlan120".to_string(),
+            input: dir.path().to_path_buf(),
+            samples: 100,
+            seed: 0,
+        };
+        assert!(change(change_args, &quiet).is_ok());
+    }
+}
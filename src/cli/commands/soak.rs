@@ -0,0 +1,357 @@
+//! Soak command - continuously emit slightly evolved configurations
+//!
+//! Simulates ongoing operational change for testing drift-detection and
+//! backup systems over hours or days. Each iteration applies a few changes
+//! with a [`ChurnEngine`] and rewrites the target directory:
+//!
+//! - `vlans.csv` with the current VLANs, replaced atomically
+//! - `firewall_1_vlan_<id>.xml` per VLAN when a base configuration is given;
+//!   unchanged files are left untouched and removed VLANs are deleted
+//! - `changes.jsonl`, one line per iteration listing the changes made
+//!
+//! With `--apply`, each iteration is also pushed to a lab firewall through
+//! the same [`Applier`] and transport the `apply` command uses.
+
+use crate::apply::transport::ApplyTransport;
+use crate::apply::{Applier, ApplyOptions, items_from_vlans};
+use crate::cli::commands::apply::{require_parent_interface, transport};
+use crate::cli::theme::{self, Role};
+use crate::cli::{GlobalArgs, SoakArgs};
+use crate::generator::vlan::{VlanConfig, generate_vlan_configurations};
+use crate::generator::{ChurnEngine, ChurnEvent};
+use crate::io::csv::write_csv;
+use crate::xml::template::XmlTemplate;
+use anyhow::{Context, Result};
+use serde_json::json;
+use std::collections::{HashMap, HashSet};
+use std::fs::{self, OpenOptions};
+use std::io::Write;
+use std::path::{Path, PathBuf};
+use std::thread;
+use std::time::{Duration, SystemTime, UNIX_EPOCH};
+
+/// Firewall number used in XML file names
+const FIREWALL_NR: u16 = 1;
+
+/// OPT interface number of the first VLAN
+const FIRST_OPT: u16 = 6;
+
+/// Directory under the target the firewall's configuration is saved to
+const SNAPSHOT_DIR: &str = "snapshots";
+
+/// Execute the soak command
+pub fn execute(args: SoakArgs, global: &GlobalArgs) -> Result<()> {
+    let mut applier = if args.apply {
+        require_parent_interface(&args.firewall)?;
+        let options = ApplyOptions {
+            snapshot_dir: Some(args.target.join(SNAPSHOT_DIR)),
+            ..ApplyOptions::default()
+        };
+        Some(Applier::new(transport(&args.firewall)?, options))
+    } else {
+        None
+    };
+    run(&args, global, applier.as_mut(), thread::sleep)
+}
+
+/// Run the soak loop, waiting between iterations with `sleep`
+///
+/// When an applier is given, each iteration's new and changed VLANs are
+/// pushed through it after they are written.
+fn run<T: ApplyTransport>(
+    args: &SoakArgs,
+    global: &GlobalArgs,
+    mut applier: Option<&mut Applier<T>>,
+    mut sleep: impl FnMut(Duration),
+) -> Result<()> {
+    fs::create_dir_all(&args.target)
+        .with_context(|| format!("Failed to create {}", args.target.display()))?;
+
+    let template = match &args.base_config {
+        Some(path) => {
+            let base_xml = fs::read_to_string(path)
+                .with_context(|| format!("Failed to read base config file: {:?}", path))?;
+            Some(XmlTemplate::new(base_xml)?)
+        }
+        None => None,
+    };
+
+    let initial = generate_vlan_configurations(args.count, args.seed, None)
+        .with_context(|| format!("Failed to generate {} VLAN configurations", args.count))?;
+    let mut engine = ChurnEngine::new(initial, args.seed);
+    let mut writer = SoakWriter::new(&args.target, template);
+
+    if !global.quiet {
+        println!(
+            "{}",
+            theme::paint(Role::Title, "🔁 OPNsense Config Faker - Soak")
+        );
+        println!();
+        println!(
+            "Writing to {} every {}s{}; press Ctrl-C to stop",
+            args.target.display(),
+            args.interval.as_secs(),
+            args.iterations
+                .map(|n| format!(" for {n} iterations"))
+                .unwrap_or_default()
+        );
+        println!("  Iteration 0: {} VLANs", engine.configs().len());
+    }
+    writer.write(engine.configs(), 0, &[])?;
+    if let Some(applier) = applier.as_deref_mut() {
+        push(applier, engine.configs(), global.quiet)?;
+        // The first snapshot is the firewall as it was before the soak
+        applier.options_mut().snapshot_dir = None;
+    }
+
+    while args.iterations.is_none_or(|n| engine.iteration() < n) {
+        sleep(args.interval);
+        let events = engine.step()?;
+        writer.write(engine.configs(), engine.iteration(), &events)?;
+
+        if !global.quiet {
+            println!(
+                "  Iteration {}: {} changes, {} VLANs",
+                engine.iteration(),
+                events.len(),
+                engine.configs().len()
+            );
+            for event in &events {
+                println!("    {event}");
+            }
+        }
+
+        if let Some(applier) = applier.as_deref_mut() {
+            let touched: HashSet<u16> = events
+                .iter()
+                .filter(|e| !matches!(e, ChurnEvent::Removed { .. }))
+                .map(ChurnEvent::vlan_id)
+                .collect();
+            let changed: Vec<VlanConfig> = engine
+                .configs()
+                .iter()
+                .filter(|c| touched.contains(&c.vlan_id))
+                .cloned()
+                .collect();
+            push(applier, &changed, global.quiet)?;
+        }
+    }
+
+    Ok(())
+}
+
+/// Push VLANs and their network aliases to the firewall
+fn push<T: ApplyTransport>(
+    applier: &mut Applier<T>,
+    configs: &[VlanConfig],
+    quiet: bool,
+) -> Result<()> {
+    if configs.is_empty() {
+        return Ok(());
+    }
+    let report = applier
+        .run(&items_from_vlans(configs))
+        .context("Failed to apply the iteration to the firewall")?;
+    if !quiet {
+        if let Some(snapshot) = &report.snapshot {
+            println!(
+                "    📸 Saved the firewall's configuration to {}",
+                snapshot.display()
+            );
+        }
+        println!(
+            "    Applied {} objects in {} batches",
+            report.items_applied, report.batches_sent
+        );
+    }
+    Ok(())
+}
+
+/// Writes each iteration's configuration to the target directory
+struct SoakWriter {
+    target: PathBuf,
+    template: Option<XmlTemplate>,
+    /// OPT interface numbers by VLAN ID, fixed when a VLAN first appears
+    opt_numbers: HashMap<u16, u16>,
+    next_opt: u16,
+}
+
+impl SoakWriter {
+    fn new(target: &Path, template: Option<XmlTemplate>) -> Self {
+        Self {
+            target: target.to_path_buf(),
+            template,
+            opt_numbers: HashMap::new(),
+            next_opt: FIRST_OPT,
+        }
+    }
+
+    fn write(
+        &mut self,
+        configs: &[VlanConfig],
+        iteration: u64,
+        events: &[ChurnEvent],
+    ) -> Result<()> {
+        // Write then rename so watchers never see a half-written file
+        let csv_path = self.target.join("vlans.csv");
+        let partial = self.target.join(".vlans.csv.partial");
+        write_csv(configs, &partial)
+            .with_context(|| format!("Failed to write CSV to {:?}", partial))?;
+        fs::rename(&partial, &csv_path)
+            .with_context(|| format!("Failed to replace {}", csv_path.display()))?;
+
+        if self.template.is_some() {
+            self.write_xml(configs, events)?;
+        }
+
+        let timestamp = SystemTime::now()
+            .duration_since(UNIX_EPOCH)
+            .map(|d| d.as_secs())
+            .unwrap_or_default();
+        let entry = json!({
+            "iteration": iteration,
+            "timestamp": timestamp,
+            "vlans": configs.len(),
+            "changes": events,
+        });
+        let log_path = self.target.join("changes.jsonl");
+        let mut log = OpenOptions::new()
+            .create(true)
+            .append(true)
+            .open(&log_path)
+            .with_context(|| format!("Failed to open {}", log_path.display()))?;
+        writeln!(log, "{entry}")?;
+        Ok(())
+    }
+
+    /// Rewrite changed VLAN XML files and delete those of removed VLANs
+    fn write_xml(&mut self, configs: &[VlanConfig], events: &[ChurnEvent]) -> Result<()> {
+        let Some(template) = &self.template else {
+            return Ok(());
+        };
+
+        for event in events {
+            if let ChurnEvent::Removed { vlan_id } = event {
+                let path = self.xml_path(*vlan_id);
+                if path.exists() {
+                    fs::remove_file(&path)
+                        .with_context(|| format!("Failed to remove {}", path.display()))?;
+                }
+            }
+        }
+
+        for config in configs {
+            // Stable numbering keeps other files unchanged when a VLAN is removed
+            let opt = *self.opt_numbers.entry(config.vlan_id).or_insert_with(|| {
+                let opt = self.next_opt;
+                self.next_opt += 1;
+                opt
+            });
+            let xml = template.apply_configuration(config, FIREWALL_NR, opt)?;
+            let path = self.xml_path(config.vlan_id);
+            if fs::read_to_string(&path).ok().as_deref() != Some(xml.as_str()) {
+                fs::write(&path, xml)
+                    .with_context(|| format!("Failed to write {}", path.display()))?;
+            }
+        }
+        Ok(())
+    }
+
+    fn xml_path(&self, vlan_id: u16) -> PathBuf {
+        self.target
+            .join(format!("firewall_{FIREWALL_NR}_vlan_{vlan_id}.xml"))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::apply::transport::RecordingTransport;
+    use crate::cli::ApiTargetArgs;
+    use tempfile::TempDir;
+
+    fn args(target: &Path, base_config: Option<PathBuf>) -> SoakArgs {
+        SoakArgs {
+            interval: Duration::from_secs(300),
+            target: target.to_path_buf(),
+            count: 5,
+            iterations: Some(3),
+            base_config,
+            seed: Some(42),
+            apply: false,
+            firewall: ApiTargetArgs::default(),
+        }
+    }
+
+    fn quiet() -> GlobalArgs {
+        GlobalArgs {
+            quiet: true,
+            ..GlobalArgs::default()
+        }
+    }
+
+    #[test]
+    fn test_soak_writes_each_iteration() {
+        let dir = TempDir::new().unwrap();
+        let base = dir.path().join("base.xml");
+        fs::write(
+            &base,
+            "<vlan><tag>{{VLAN_ID}}</tag><descr>{{DESCRIPTION}}</descr></vlan>",
+        )
+        .unwrap();
+        let target = dir.path().join("out");
+
+        let mut sleeps = Vec::new();
+        run::<RecordingTransport>(&args(&target, Some(base)), &quiet(), None, |d| {
+            sleeps.push(d)
+        })
+        .unwrap();
+        assert_eq!(sleeps, vec![Duration::from_secs(300); 3]);
+
+        let log = fs::read_to_string(target.join("changes.jsonl")).unwrap();
+        assert_eq!(log.lines().count(), 4);
+
+        let configs = crate::io::csv::read_csv(target.join("vlans.csv")).unwrap();
+        let xml_files = fs::read_dir(&target)
+            .unwrap()
+            .filter_map(|e| e.ok())
+            .filter(|e| e.path().extension().is_some_and(|ext| ext == "xml"))
+            .count();
+        assert_eq!(xml_files, configs.len());
+        assert!(!target.join(".vlans.csv.partial").exists());
+    }
+
+    #[test]
+    fn test_soak_is_reproducible_with_seed() {
+        let first = TempDir::new().unwrap();
+        let second = TempDir::new().unwrap();
+        run::<RecordingTransport>(&args(first.path(), None), &quiet(), None, |_| {}).unwrap();
+        run::<RecordingTransport>(&args(second.path(), None), &quiet(), None, |_| {}).unwrap();
+        assert_eq!(
+            fs::read_to_string(first.path().join("vlans.csv")).unwrap(),
+            fs::read_to_string(second.path().join("vlans.csv")).unwrap()
+        );
+    }
+
+    #[test]
+    fn test_soak_applies_changes_to_firewall() {
+        let dir = TempDir::new().unwrap();
+        let options = ApplyOptions {
+            requests_per_second: None,
+            snapshot_dir: Some(dir.path().join(SNAPSHOT_DIR)),
+            ..ApplyOptions::default()
+        };
+        let mut applier = Applier::new(RecordingTransport::with_config("<opnsense/>"), options)
+            .with_sleeper(|_| {});
+
+        let target = dir.path();
+        run(&args(target, None), &quiet(), Some(&mut applier), |_| {}).unwrap();
+
+        // Every initial VLAN and alias, then only what later iterations touched
+        let batches = &applier.transport().batches;
+        assert_eq!(batches[0].len(), 10);
+        assert!(applier.transport().item_count() >= 10);
+        let snapshots = fs::read_dir(dir.path().join(SNAPSHOT_DIR)).unwrap().count();
+        assert_eq!(snapshots, 1);
+    }
+}
@@ -0,0 +1,25 @@
+//! Summary command - count the records in generated output
+
+use crate::cli::{GlobalArgs, ReportFormat, SummaryArgs};
+use crate::query::{QueryIndex, RecordKind};
+use anyhow::{Context, Result};
+use clap::ValueEnum;
+
+/// Execute the summary command
+pub fn execute(args: SummaryArgs, global: &GlobalArgs) -> Result<()> {
+    let index = QueryIndex::load(&args.input)
+        .with_context(|| format!("Failed to load {}", args.input.display()))?;
+    let report = index.summary()?;
+
+    print!("{}", report.render(args.format)?);
+    if args.format == ReportFormat::Table && !global.quiet {
+        println!();
+        let total: usize = RecordKind::value_variants()
+            .iter()
+            .map(|kind| index.len(*kind))
+            .sum();
+        println!("{total} records in {}", args.input.display());
+    }
+
+    Ok(())
+}
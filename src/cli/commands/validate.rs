@@ -3,12 +3,18 @@
 //! This module provides validation functionality for both CSV and XML configuration data,
 //! ensuring consistency, correctness, and compliance with OPNsense standards.
 
-use crate::cli::{GlobalArgs, ValidateArgs, ValidationFormat};
+use crate::cli::i18n::{Msg, tr, trf};
+use crate::cli::input::read_config;
+use crate::cli::progress;
+use crate::cli::theme::{self, Role};
+use crate::cli::{GlobalArgs, ReportFormat, ValidateArgs, ValidationFormat};
+use crate::io::report::Report;
 use crate::model::ConfigError;
 use crate::validate::ValidationEngine;
+use crate::validate::lint::{LintFinding, LintRuleFile, LintRuleSet, Severity};
+use crate::validate::policy::{Policy, PolicyViolation};
 use anyhow::{Context, Result};
-use indicatif::{ProgressBar, ProgressStyle};
-use std::env;
+use indicatif::ProgressBar;
 use std::fs;
 use std::path::Path;
 
@@ -36,6 +42,14 @@ pub fn execute(args: ValidateArgs, global: &GlobalArgs) -> Result<()> {
         println!();
     }
 
+    if !args.rules.is_empty() && matches!(format, ValidationFormat::Csv) {
+        return Err(ConfigError::invalid_parameter(
+            "rules",
+            "Lint rules apply to XML configurations only",
+        )
+        .into());
+    }
+
     // Validate based on format
     match format {
         ValidationFormat::Csv => validate_csv(&args, global),
@@ -103,15 +117,28 @@ fn validate_csv(args: &ValidateArgs, global: &GlobalArgs) -> Result<()> {
 
     if !global.quiet {
         if error_count == 0 {
-            println!("🎉 All configurations are valid!");
+            println!("{}", tr(Msg::ValidationPassed));
         } else {
-            println!("⚠️  Found {} validation errors", error_count);
+            println!(
+                "{}",
+                trf(Msg::ValidationErrorsFound, &[("count", &error_count)])
+            );
         }
     }
 
+    let policy_violations = match &args.policy {
+        Some(path) => report_policy(
+            args,
+            path,
+            |policy| Ok(policy.check_vlans(&configs)),
+            global,
+        )?,
+        None => 0,
+    };
+
     // Write report if requested
     if let Some(report_path) = &args.report {
-        write_validation_report(report_path, &valid_configs, error_count)?;
+        write_validation_report(report_path, &valid_configs, error_count, args.report_format)?;
         if !global.quiet {
             println!("📄 Validation report written to: {}", report_path.display());
         }
@@ -124,8 +151,7 @@ fn validate_csv(args: &ValidateArgs, global: &GlobalArgs) -> Result<()> {
         ))
         .into());
     }
-
-    Ok(())
+    fail_on_policy_violations(policy_violations)
 }
 
 /// Validate XML configuration data
@@ -136,7 +162,7 @@ fn validate_xml(args: &ValidateArgs, global: &GlobalArgs) -> Result<()> {
     }
 
     // For now, just verify the file is valid XML
-    let content = fs::read_to_string(&args.input)?;
+    let content = read_config(&args.input, args.backup_passphrase.as_deref(), global)?;
 
     let mut reader = quick_xml::Reader::from_str(&content);
     let mut buf = Vec::new();
@@ -158,9 +184,114 @@ fn validate_xml(args: &ValidateArgs, global: &GlobalArgs) -> Result<()> {
         println!("✅ File is valid XML");
     }
 
+    if !args.rules.is_empty() {
+        lint_xml(args, &content, global)?;
+    }
+
+    let policy_violations = match &args.policy {
+        Some(path) => report_policy(args, path, |policy| policy.check_xml(&content), global)?,
+        None => 0,
+    };
+    fail_on_policy_violations(policy_violations)
+}
+
+/// Load the --policy file, run `check`, and print the violations found
+fn report_policy(
+    args: &ValidateArgs,
+    path: &Path,
+    check: impl FnOnce(&Policy) -> crate::Result<Vec<PolicyViolation>>,
+    global: &GlobalArgs,
+) -> Result<usize> {
+    let policy =
+        Policy::load(path).with_context(|| format!("Failed to load policy: {}", path.display()))?;
+    let violations = check(&policy)?;
+
+    if !global.quiet {
+        println!();
+        println!(
+            "{}",
+            theme::paint(Role::Heading, format!("Policy '{}':", policy.name()))
+        );
+        for violation in violations.iter().take(args.max_errors as usize) {
+            println!("  {} {violation}", theme::paint(Role::Error, "violation"));
+        }
+        if violations.len() > args.max_errors as usize {
+            println!("  … {} more", violations.len() - args.max_errors as usize);
+        }
+        if violations.is_empty() {
+            println!("  {}", theme::paint(Role::Success, "No violations"));
+        }
+    }
+    Ok(violations.len())
+}
+
+fn fail_on_policy_violations(count: usize) -> Result<()> {
+    if count > 0 {
+        return Err(
+            ConfigError::validation(format!("Policy failed: {count} violation(s) found")).into(),
+        );
+    }
+    Ok(())
+}
+
+/// Check XML content against the --rules files
+fn lint_xml(args: &ValidateArgs, content: &str, global: &GlobalArgs) -> Result<()> {
+    let mut rules = LintRuleSet::default();
+    for path in &args.rules {
+        LintRuleFile::load(path)
+            .and_then(|file| rules.extend(file.rules))
+            .with_context(|| format!("Failed to load lint rules: {}", path.display()))?;
+    }
+
+    let findings = rules.check(content)?;
+    let count = |severity: Severity| findings.iter().filter(|f| f.severity == severity).count();
+    let errors = count(Severity::Error);
+
+    if !global.quiet {
+        println!();
+        println!("{}", theme::paint(Role::Heading, "Lint Results:"));
+        for finding in findings.iter().take(args.max_errors as usize) {
+            print_finding(finding);
+        }
+        if findings.len() > args.max_errors as usize {
+            println!("  … {} more", findings.len() - args.max_errors as usize);
+        }
+        println!(
+            "  {} rules checked: {errors} errors, {} warnings, {} info",
+            rules.len(),
+            count(Severity::Warning),
+            count(Severity::Info)
+        );
+    }
+
+    if errors > 0 {
+        return Err(ConfigError::validation(format!(
+            "Lint failed: {errors} rule violation(s) with error severity"
+        ))
+        .into());
+    }
     Ok(())
 }
 
+pub(crate) fn print_finding(finding: &LintFinding) {
+    let role = match finding.severity {
+        Severity::Error => Role::Error,
+        Severity::Warning => Role::Warning,
+        Severity::Info => Role::Accent,
+    };
+    let location = if finding.path.is_empty() {
+        String::new()
+    } else {
+        format!(" {}", finding.path)
+    };
+    println!(
+        "  {} [{}]{location}: {}",
+        theme::paint(role, finding.severity),
+        finding.rule,
+        finding.message
+    );
+}
+
 /// Determine input format from file extension or explicit format
 fn determine_format(input: &Path, format: &ValidationFormat) -> Result<ValidationFormat> {
     match format {
@@ -177,29 +308,20 @@ fn determine_format(input: &Path, format: &ValidationFormat) -> Result<Validatio
     }
 }
 
-/// Create a progress bar with consistent styling
+/// Create a progress spinner in the selected progress mode
 fn create_progress_bar(message: &str) -> ProgressBar {
-    let pb = ProgressBar::new_spinner();
-
-    if env::var("NO_COLOR").is_ok() || env::var("TERM").unwrap_or_default() == "dumb" {
-        pb.set_style(ProgressStyle::default_spinner().template("{msg}").unwrap());
-    } else {
-        pb.set_style(
-            ProgressStyle::default_spinner()
-                .template("{spinner:.green} {elapsed_precise} {msg}")
-                .unwrap(),
-        );
-    }
-
-    pb.set_message(message.to_string());
-    pb
+    progress::spinner(message)
 }
 
 /// Write validation report to file
+///
+/// Without an explicit report format the legacy plain-text report is written;
+/// otherwise the shared report renderer produces table, CSV, or JSON output.
 fn write_validation_report(
     path: &Path,
     configs: &[crate::generator::VlanConfig],
     error_count: u32,
+    format: Option<ReportFormat>,
 ) -> Result<()> {
     // Ensure parent directories exist
     if let Some(parent) = path.parent() {
@@ -208,20 +330,37 @@ fn write_validation_report(
         })?;
     }
 
-    let report_content = format!(
-        "Validation Report\n\
-         ================\n\
-         \n\
-         Valid configurations: {}\n\
-         Error count: {}\n\
-         \n\
-         Valid VLAN configurations:\n",
-        configs.len(),
-        error_count
-    );
+    let report_content = match format {
+        Some(format) => validation_summary(configs, error_count)?.render(format)?,
+        None => format!(
+            "Validation Report\n\
+             ================\n\
+             \n\
+             Valid configurations: {}\n\
+             Error count: {}\n\
+             \n\
+             Valid VLAN configurations:\n",
+            configs.len(),
+            error_count
+        ),
+    };
 
     fs::write(path, report_content)
         .with_context(|| format!("writing validation report to {}", path.display()))?;
 
     Ok(())
 }
+
+/// Build the validation summary as a metric/value report
+fn validation_summary(
+    configs: &[crate::generator::VlanConfig],
+    error_count: u32,
+) -> crate::Result<Report> {
+    let mut report = Report::new(["metric", "value"]);
+    report.push_row([
+        "valid_configurations".to_string(),
+        configs.len().to_string(),
+    ])?;
+    report.push_row(["error_count".to_string(), error_count.to_string()])?;
+    Ok(report)
+}
@@ -0,0 +1,353 @@
+//! View command - browse a configuration in the terminal
+//!
+//! Generated fixtures easily reach tens of megabytes, far beyond what is
+//! comfortable to review in a text editor. The viewer shows the parsed
+//! [element tree](crate::xml::tree) with collapsible sections, searches names,
+//! values, and attributes, and follows cross-references from a rule to the
+//! aliases and interfaces it uses and from an alias to nested aliases. It never
+//! modifies the file.
+
+use crate::cli::input::read_config;
+use crate::cli::theme::{self, Role};
+use crate::cli::{GlobalArgs, ViewArgs};
+use crate::xml::tree::ConfigTree;
+use anyhow::{Context, Result, bail};
+use console::{Key, Term};
+
+/// Key help shown when there is no status message
+const HELP: &str =
+    "↑↓ move  ←→ fold  / search  n next  Tab follow reference  Backspace back  q quit";
+
+/// Execute the view command
+pub fn execute(args: ViewArgs, global: &GlobalArgs) -> Result<()> {
+    let content = read_config(&args.input, None, global)?;
+    let tree = ConfigTree::parse(&content)
+        .with_context(|| format!("Failed to parse {}", args.input.display()))?;
+
+    let term = Term::stdout();
+    if !term.is_term() {
+        bail!(
+            "view needs an interactive terminal; use `extract` or `query` to read \
+             configurations from scripts"
+        );
+    }
+
+    let mut viewer = Viewer::new(tree);
+    if let Some(query) = &args.search {
+        viewer.search(query);
+    }
+
+    term.hide_cursor()?;
+    let result = run(&term, &mut viewer);
+    term.clear_screen()?;
+    term.show_cursor()?;
+    result
+}
+
+/// Draw and handle keys until the user quits
+fn run(term: &Term, viewer: &mut Viewer) -> Result<()> {
+    loop {
+        let (height, width) = term.size();
+        let (height, width) = (usize::from(height), usize::from(width));
+        term.clear_screen()?;
+        term.write_str(&viewer.render(width, height).join("\n"))?;
+
+        match viewer.handle(term.read_key()?, height) {
+            Action::Continue => {}
+            Action::Quit => return Ok(()),
+            Action::Search => {
+                term.move_cursor_to(0, height.saturating_sub(1))?;
+                term.clear_line()?;
+                term.write_str("/")?;
+                term.show_cursor()?;
+                let query = term.read_line()?;
+                term.hide_cursor()?;
+                viewer.search(query.trim());
+            }
+        }
+    }
+}
+
+/// What the main loop does after a key
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum Action {
+    Continue,
+    Search,
+    Quit,
+}
+
+/// Browsing state over a parsed configuration
+struct Viewer {
+    tree: ConfigTree,
+    expanded: Vec<bool>,
+    /// Visible nodes in display order
+    rows: Vec<usize>,
+    /// Index of the selected row
+    cursor: usize,
+    /// Index of the first row on screen
+    offset: usize,
+    query: String,
+    /// Nodes to return to with Backspace
+    history: Vec<usize>,
+    /// Node whose references are being followed and the reference shown last
+    follow: Option<(usize, usize)>,
+    status: String,
+}
+
+impl Viewer {
+    /// Start with the document element expanded and its sections collapsed
+    fn new(tree: ConfigTree) -> Self {
+        let mut expanded = vec![false; tree.len()];
+        expanded[0] = true;
+        let mut viewer = Self {
+            tree,
+            expanded,
+            rows: Vec::new(),
+            cursor: 0,
+            offset: 0,
+            query: String::new(),
+            history: Vec::new(),
+            follow: None,
+            status: String::new(),
+        };
+        viewer.refresh_rows();
+        viewer
+    }
+
+    fn selected(&self) -> usize {
+        self.rows[self.cursor]
+    }
+
+    /// Recompute the visible rows after folding
+    fn refresh_rows(&mut self) {
+        let selected = self.rows.get(self.cursor).copied();
+        self.rows.clear();
+        let mut pending = vec![0];
+        while let Some(id) = pending.pop() {
+            self.rows.push(id);
+            if self.expanded[id] {
+                pending.extend(self.tree.node(id).children.iter().rev());
+            }
+        }
+        self.cursor = selected
+            .and_then(|id| self.rows.iter().position(|&row| row == id))
+            .unwrap_or(0);
+    }
+
+    /// Expand the ancestors of a node and select it
+    fn reveal(&mut self, id: usize) {
+        for ancestor in self.tree.ancestors(id) {
+            self.expanded[ancestor] = true;
+        }
+        self.refresh_rows();
+        if let Some(row) = self.rows.iter().position(|&row| row == id) {
+            self.cursor = row;
+        }
+    }
+
+    /// Select another node, remembering the current one for Backspace
+    fn jump(&mut self, id: usize) {
+        self.history.push(self.selected());
+        self.reveal(id);
+    }
+
+    fn handle(&mut self, key: Key, height: usize) -> Action {
+        let page = height.saturating_sub(2).max(1);
+        let last = self.rows.len() - 1;
+        self.status.clear();
+        match key {
+            Key::Char('q') | Key::Escape => return Action::Quit,
+            Key::ArrowUp | Key::Char('k') => self.cursor = self.cursor.saturating_sub(1),
+            Key::ArrowDown | Key::Char('j') => self.cursor = (self.cursor + 1).min(last),
+            Key::PageUp => self.cursor = self.cursor.saturating_sub(page),
+            Key::PageDown => self.cursor = (self.cursor + page).min(last),
+            Key::Home | Key::Char('g') => self.cursor = 0,
+            Key::End | Key::Char('G') => self.cursor = last,
+            Key::ArrowRight | Key::Char('l') => self.set_expanded(true),
+            Key::Enter | Key::Char(' ') => {
+                let id = self.selected();
+                self.set_expanded(!self.expanded[id]);
+            }
+            Key::ArrowLeft | Key::Char('h') => {
+                let id = self.selected();
+                if self.expanded[id] && id != 0 {
+                    self.set_expanded(false);
+                } else if let Some(parent) = self.tree.node(id).parent {
+                    self.reveal(parent);
+                }
+            }
+            Key::Char('/') => return Action::Search,
+            Key::Char('n') => {
+                let query = self.query.clone();
+                self.search(&query);
+            }
+            Key::Tab | Key::Char('r') => self.follow_reference(),
+            Key::Backspace | Key::Char('b') => match self.history.pop() {
+                Some(id) => self.reveal(id),
+                None => self.status = "Nothing to go back to".to_string(),
+            },
+            _ => {}
+        }
+        Action::Continue
+    }
+
+    fn set_expanded(&mut self, expanded: bool) {
+        let id = self.selected();
+        if !self.tree.node(id).children.is_empty() {
+            self.expanded[id] = expanded;
+            self.refresh_rows();
+        }
+    }
+
+    /// Select the next node matching `query` after the selected one
+    fn search(&mut self, query: &str) {
+        if query.is_empty() {
+            return;
+        }
+        self.query = query.to_string();
+        match self.tree.search(query, self.selected()) {
+            Some(id) => self.jump(id),
+            None => self.status = format!("No match for '{query}'"),
+        }
+    }
+
+    /// Jump to a node the selected one refers to
+    ///
+    /// Returning with Backspace and pressing Tab again moves on to the next
+    /// reference of the same node.
+    fn follow_reference(&mut self) {
+        let origin = self.selected();
+        let references = self.tree.references(origin);
+        if references.is_empty() {
+            self.status = "No references from this element".to_string();
+            return;
+        }
+        let index = match self.follow {
+            Some((node, shown)) if node == origin => (shown + 1) % references.len(),
+            _ => 0,
+        };
+        self.follow = Some((origin, index));
+        self.jump(references[index]);
+        self.status = format!(
+            "Reference {} of {}: {}",
+            index + 1,
+            references.len(),
+            self.tree.node(references[index]).path
+        );
+    }
+
+    /// Screen lines: the selected path, the visible rows, and a status line
+    fn render(&mut self, width: usize, height: usize) -> Vec<String> {
+        let body = height.saturating_sub(2).max(1);
+        if self.cursor < self.offset {
+            self.offset = self.cursor;
+        } else if self.cursor >= self.offset + body {
+            self.offset = self.cursor + 1 - body;
+        }
+
+        let path = &self.tree.node(self.selected()).path;
+        let mut lines = vec![theme::paint(Role::Heading, clip(path, width)).to_string()];
+        for (row, &id) in self.rows.iter().enumerate().skip(self.offset).take(body) {
+            let line = clip(&self.describe(id), width.saturating_sub(2));
+            lines.push(if row == self.cursor {
+                format!("> {}", console::style(line).reverse())
+            } else {
+                format!("  {line}")
+            });
+        }
+        lines.resize(body + 1, String::new());
+        let status = if self.status.is_empty() {
+            HELP
+        } else {
+            self.status.as_str()
+        };
+        lines.push(theme::paint(Role::Accent, clip(status, width)).to_string());
+        lines
+    }
+
+    /// One row: indentation, fold marker, name, attributes, and value
+    fn describe(&self, id: usize) -> String {
+        let node = self.tree.node(id);
+        let marker = match (node.children.is_empty(), self.expanded[id]) {
+            (true, _) => ' ',
+            (false, true) => '▾',
+            (false, false) => '▸',
+        };
+        let mut line = format!("{}{marker} {}", "  ".repeat(node.depth), node.name);
+        for (name, value) in &node.attributes {
+            line.push_str(&format!(" {name}=\"{value}\""));
+        }
+        if !node.children.is_empty() && !self.expanded[id] {
+            line.push_str(&format!(" ({} children)", node.children.len()));
+        }
+        if let Some(value) = node.value.as_deref().filter(|v| !v.is_empty()) {
+            // Multi-line values such as alias content are shown on one line
+            let value: Vec<&str> = value.split_whitespace().collect();
+            line.push_str(&format!(" = {}", value.join(" ")));
+        }
+        line
+    }
+}
+
+fn clip(text: &str, width: usize) -> String {
+    console::truncate_str(text, width, "…").into_owned()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const CONFIG: &str = "<opnsense>\
+        <interfaces><opt6><descr>Sales</descr></opt6></interfaces>\
+        <filter><rule><interface>opt6</interface><source><address>NETS</address></source></rule></filter>\
+        <aliases><alias><name>NETS</name><content>10.1.0.0/24</content></alias></aliases>\
+        </opnsense>";
+
+    fn viewer() -> Viewer {
+        Viewer::new(ConfigTree::parse(CONFIG).unwrap())
+    }
+
+    fn path(viewer: &Viewer) -> &str {
+        &viewer.tree.node(viewer.selected()).path
+    }
+
+    #[test]
+    fn test_sections_start_collapsed() {
+        let mut viewer = viewer();
+        assert_eq!(viewer.rows.len(), 4);
+        viewer.handle(Key::ArrowDown, 24);
+        viewer.handle(Key::ArrowRight, 24);
+        assert_eq!(viewer.rows.len(), 5);
+        viewer.handle(Key::ArrowLeft, 24);
+        assert_eq!(viewer.rows.len(), 4);
+        assert_eq!(viewer.handle(Key::Char('q'), 24), Action::Quit);
+    }
+
+    #[test]
+    fn test_follow_references_and_back() {
+        let mut viewer = viewer();
+        viewer.search("rule");
+        assert_eq!(path(&viewer), "/opnsense/filter/rule");
+
+        viewer.handle(Key::Tab, 24);
+        assert_eq!(path(&viewer), "/opnsense/interfaces/opt6");
+        viewer.handle(Key::Backspace, 24);
+        viewer.handle(Key::Tab, 24);
+        assert_eq!(path(&viewer), "/opnsense/aliases/alias");
+        assert!(viewer.status.starts_with("Reference 2 of 2"));
+
+        viewer.handle(Key::Backspace, 24);
+        viewer.handle(Key::Backspace, 24);
+        assert_eq!(path(&viewer), "/opnsense");
+    }
+
+    #[test]
+    fn test_render_fits_screen() {
+        let mut viewer = viewer();
+        viewer.search("content");
+        let lines = viewer.render(40, 6);
+        assert_eq!(lines.len(), 6);
+        assert!(lines.iter().any(|l| l.contains("content = 10.1.0.0/24")));
+        assert!(lines.iter().all(|l| console::measure_text_width(l) <= 42));
+    }
+}
@@ -2,20 +2,18 @@
 
 use crate::Result;
 use crate::cli::XmlArgs;
+use crate::cli::progress;
+use crate::cli::theme::{self, Role};
 use crate::generator::vlan::generate_vlan_configurations;
 use crate::io::csv::read_csv;
 use crate::xml::template::XmlTemplate;
-use console::style;
-use indicatif::{ProgressBar, ProgressStyle};
 use std::fs;
 
 /// Execute the XML generation command
 pub fn execute(args: XmlArgs) -> Result<()> {
     println!(
         "{}",
-        style("🔧 OPNsense Config Faker - XML Generator")
-            .bold()
-            .blue()
+        theme::paint(Role::Title, "🔧 OPNsense Config Faker - XML Generator")
     );
     println!();
 
@@ -38,16 +36,7 @@ pub fn execute(args: XmlArgs) -> Result<()> {
     } else if let Some(count) = args.count {
         println!("🔄 Generating {count} VLAN configurations...");
 
-        let pb = ProgressBar::new(count as u64);
-        pb.set_style(
-            ProgressStyle::default_bar()
-                .template(
-                    "{spinner:.green} [{elapsed_precise}] [{bar:40.cyan/blue}] {pos}/{len} {msg}",
-                )
-                .unwrap()
-                .progress_chars("#>-"),
-        );
-        pb.set_message("Generating configurations...");
+        let pb = progress::bar(count as u64, "Generating configurations...");
 
         let configs = generate_vlan_configurations(count, args.seed, Some(&pb))?;
         pb.finish_with_message("✅ Configurations generated");
@@ -66,14 +55,7 @@ pub fn execute(args: XmlArgs) -> Result<()> {
     let template = XmlTemplate::new(base_xml)?;
 
     // Set up progress for XML generation
-    let pb = ProgressBar::new(configs.len() as u64);
-    pb.set_style(
-        ProgressStyle::default_bar()
-            .template("{spinner:.green} [{elapsed_precise}] [{bar:40.cyan/blue}] {pos}/{len} {msg}")
-            .unwrap()
-            .progress_chars("#>-"),
-    );
-    pb.set_message("Generating XML configurations...");
+    let pb = progress::bar(configs.len() as u64, "Generating XML configurations...");
 
     // Generate XML configurations
     for (index, config) in configs.iter().enumerate() {
@@ -106,7 +88,7 @@ pub fn execute(args: XmlArgs) -> Result<()> {
     pb.finish_with_message("✅ XML configurations generated");
 
     println!();
-    println!("{}", style("Summary:").bold());
+    println!("{}", theme::paint(Role::Heading, "Summary:"));
     println!("  📊 Configurations: {}", configs.len());
     println!("  📁 Output directory: {}", args.output_dir.display());
     println!(
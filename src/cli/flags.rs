@@ -0,0 +1,258 @@
+//! Compatibility shims for renamed flags
+//!
+//! Renaming a flag would silently break scripts and CI jobs that still pass
+//! the old name. Instead, the old spelling is listed in [`FLAG_SHIMS`] and
+//! rewritten to the new one before the command line is parsed, and every
+//! rewrite is reported as a [`FlagDeprecation`] warning on stderr. With
+//! `--strict-flags` the deprecated usage is rejected instead, so automation
+//! can make sure it is ready before a shim is removed.
+//!
+//! Arguments after `--` are passed on unchanged.
+
+use crate::Result;
+use crate::cli::Cli;
+use crate::cli::theme::{self, Role};
+use crate::model::ConfigError;
+use clap::CommandFactory;
+use std::ffi::OsString;
+use std::fmt;
+
+/// Old flag name that is still accepted for a subcommand
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct FlagShim {
+    /// Subcommand the flag belongs to
+    pub command: &'static str,
+    /// Deprecated long name, without the leading dashes
+    pub old: &'static str,
+    /// Current long name, without the leading dashes
+    pub new: &'static str,
+    /// Release that drops the shim
+    pub removed_in: &'static str,
+}
+
+/// Renamed flags that are still accepted
+pub const FLAG_SHIMS: &[FlagShim] = &[
+    FlagShim {
+        command: "generate",
+        old: "complexity",
+        new: "firewall-rule-complexity",
+        removed_in: "1.0.0",
+    },
+    FlagShim {
+        command: "generate",
+        old: "rules-per-vlan",
+        new: "firewall-rules-per-vlan",
+        removed_in: "1.0.0",
+    },
+    FlagShim {
+        command: "generate",
+        old: "firewall-number",
+        new: "firewall-nr",
+        removed_in: "1.0.0",
+    },
+    FlagShim {
+        command: "validate",
+        old: "lint-rules",
+        new: "rules",
+        removed_in: "1.0.0",
+    },
+];
+
+/// Use of a deprecated flag found on the command line
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct FlagDeprecation {
+    /// Subcommand the flag was given to
+    pub command: &'static str,
+    /// Deprecated long name
+    pub old: &'static str,
+    /// Long name it was rewritten to
+    pub new: &'static str,
+    /// Release that drops the shim
+    pub removed_in: &'static str,
+}
+
+impl fmt::Display for FlagDeprecation {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "{} --{} is deprecated, use --{} (removed in {})",
+            self.command, self.old, self.new, self.removed_in
+        )
+    }
+}
+
+impl From<&FlagShim> for FlagDeprecation {
+    fn from(shim: &FlagShim) -> Self {
+        Self {
+            command: shim.command,
+            old: shim.old,
+            new: shim.new,
+            removed_in: shim.removed_in,
+        }
+    }
+}
+
+/// Rewrite deprecated flags to their current names
+///
+/// `args` is the full command line including the program name. Both
+/// `--old value` and `--old=value` are rewritten; a flag only matches the
+/// shims of the subcommand it follows.
+pub fn apply_shims<I>(args: I) -> (Vec<OsString>, Vec<FlagDeprecation>)
+where
+    I: IntoIterator<Item = OsString>,
+{
+    // Global flags whose value could otherwise be taken for the subcommand
+    let valued: Vec<String> = Cli::command()
+        .get_arguments()
+        .filter(|arg| arg.get_action().takes_values())
+        .flat_map(|arg| {
+            let long = arg.get_long().map(|long| format!("--{long}"));
+            let short = arg.get_short().map(|short| format!("-{short}"));
+            long.into_iter().chain(short)
+        })
+        .collect();
+    let mut command: Option<String> = None;
+    let mut skip_value = false;
+    let mut passthrough = false;
+    let mut rewritten = Vec::new();
+    let mut deprecations = Vec::new();
+
+    for (index, arg) in args.into_iter().enumerate() {
+        let text = match arg.to_str() {
+            Some(text) if index > 0 && !passthrough => text,
+            _ => {
+                rewritten.push(arg);
+                continue;
+            }
+        };
+        if text == "--" {
+            passthrough = true;
+            rewritten.push(arg);
+            continue;
+        }
+
+        if command.is_none() {
+            if text.starts_with('-') {
+                skip_value = valued.iter().any(|flag| flag == text);
+            } else if std::mem::take(&mut skip_value) {
+                // Value of a global flag
+            } else {
+                command = Some(text.to_string());
+            }
+        }
+        let shim = text.strip_prefix("--").and_then(|flag| {
+            let (name, value) = match flag.split_once('=') {
+                Some((name, value)) => (name, Some(value)),
+                None => (flag, None),
+            };
+            FLAG_SHIMS
+                .iter()
+                .find(|shim| Some(shim.command) == command.as_deref() && shim.old == name)
+                .map(|shim| (shim, value))
+        });
+
+        match shim {
+            Some((shim, value)) => {
+                let flag = match value {
+                    Some(value) => format!("--{}={value}", shim.new),
+                    None => format!("--{}", shim.new),
+                };
+                rewritten.push(OsString::from(flag));
+                deprecations.push(FlagDeprecation::from(shim));
+            }
+            None => rewritten.push(arg),
+        }
+    }
+    (rewritten, deprecations)
+}
+
+/// Warn about deprecated flags, or reject them with `--strict-flags`
+pub fn report(deprecations: &[FlagDeprecation], strict: bool) -> Result<()> {
+    if deprecations.is_empty() {
+        return Ok(());
+    }
+    if strict {
+        let used: Vec<String> = deprecations
+            .iter()
+            .map(|d| format!("--{} (use --{})", d.old, d.new))
+            .collect();
+        return Err(ConfigError::invalid_parameter(
+            "strict-flags",
+            format!("Deprecated flags are not allowed: {}", used.join(", ")),
+        ));
+    }
+    for deprecation in deprecations {
+        eprintln!(
+            "{} {deprecation}",
+            theme::paint(Role::Warning, "warning[deprecated-flag]:").for_stderr()
+        );
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn shim(args: &[&str]) -> (Vec<String>, Vec<FlagDeprecation>) {
+        let (args, deprecations) = apply_shims(args.iter().map(OsString::from));
+        let args = args.into_iter().map(|a| a.into_string().unwrap()).collect();
+        (args, deprecations)
+    }
+
+    #[test]
+    fn test_shims_name_real_flags() {
+        let cli = Cli::command();
+        for shim in FLAG_SHIMS {
+            let command = cli.find_subcommand(shim.command).unwrap();
+            let longs: Vec<&str> = command
+                .get_arguments()
+                .filter_map(|a| a.get_long())
+                .collect();
+            assert!(longs.contains(&shim.new), "--{} does not exist", shim.new);
+            assert!(!longs.contains(&shim.old), "--{} is still a flag", shim.old);
+        }
+    }
+
+    #[test]
+    fn test_apply_shims_rewrites_per_command() {
+        let (args, deprecations) = shim(&[
+            "faker",
+            "--theme",
+            "default",
+            "generate",
+            "--complexity",
+            "advanced",
+            "--firewall-number=3",
+        ]);
+        assert_eq!(
+            args,
+            [
+                "faker",
+                "--theme",
+                "default",
+                "generate",
+                "--firewall-rule-complexity",
+                "advanced",
+                "--firewall-nr=3"
+            ]
+        );
+        assert_eq!(deprecations.len(), 2);
+        assert_eq!(
+            deprecations[0].to_string(),
+            "generate --complexity is deprecated, use --firewall-rule-complexity (removed in 1.0.0)"
+        );
+
+        // Other subcommands and arguments after -- are left alone
+        let (args, deprecations) = shim(&["faker", "repro-check", "--", "--complexity", "basic"]);
+        assert_eq!(
+            args,
+            ["faker", "repro-check", "--", "--complexity", "basic"]
+        );
+        assert!(deprecations.is_empty());
+
+        let (_, deprecations) = shim(&["faker", "validate", "--lint-rules", "rules.json"]);
+        assert!(report(&deprecations, true).is_err());
+        assert!(report(&deprecations, false).is_ok());
+    }
+}
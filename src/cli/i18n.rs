@@ -0,0 +1,420 @@
+//! Localization of user-facing CLI messages
+//!
+//! Commands look messages up by [`Msg`] key through [`tr`] and [`trf`]
+//! instead of embedding English text, so the language selected with `--lang`
+//! or taken from the locale environment (`LC_ALL`, `LC_MESSAGES`, `LANG`)
+//! applies to the wizard prompts, summaries, and top-level error messages.
+//!
+//! Each language is one exhaustive `match` over [`Msg`], so a message added
+//! without a translation fails to compile. Placeholders in `{name}` form are
+//! filled in by [`trf`]. Messages not yet routed through this module, such as
+//! the detailed causes of errors, stay in English.
+
+use clap::ValueEnum;
+use std::env;
+use std::fmt::Display;
+use std::sync::atomic::{AtomicU8, Ordering};
+
+/// Active language, stored as its discriminant
+static ACTIVE_LANG: AtomicU8 = AtomicU8::new(Lang::En as u8);
+
+/// Language of CLI messages
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq, ValueEnum)]
+#[repr(u8)]
+pub enum Lang {
+    /// English
+    #[default]
+    En = 0,
+    /// German (Deutsch)
+    De = 1,
+    /// Spanish (Español)
+    Es = 2,
+}
+
+impl Lang {
+    fn from_u8(value: u8) -> Self {
+        match value {
+            1 => Lang::De,
+            2 => Lang::Es,
+            _ => Lang::En,
+        }
+    }
+
+    /// Language of a POSIX locale name such as `de_DE.UTF-8`
+    ///
+    /// Returns `None` for locales without a catalog, including `C` and `POSIX`.
+    pub fn from_locale(locale: &str) -> Option<Self> {
+        let language = locale
+            .split(['_', '.', '@', '-'])
+            .next()
+            .unwrap_or_default()
+            .to_ascii_lowercase();
+        match language.as_str() {
+            "en" => Some(Lang::En),
+            "de" => Some(Lang::De),
+            "es" => Some(Lang::Es),
+            _ => None,
+        }
+    }
+
+    /// Text of a message in this language
+    pub fn text(self, msg: Msg) -> &'static str {
+        match self {
+            Lang::En => en(msg),
+            Lang::De => de(msg),
+            Lang::Es => es(msg),
+        }
+    }
+}
+
+/// Select the message language
+///
+/// `lang` is the `--lang` flag. Call once at startup, before any output.
+pub fn init(lang: Option<Lang>) {
+    let lang = resolve_lang(lang, |name| env::var(name).ok());
+    ACTIVE_LANG.store(lang as u8, Ordering::Relaxed);
+}
+
+/// Decide the message language from the flag and environment
+///
+/// Precedence: `--lang`, then the first set one of `LC_ALL`, `LC_MESSAGES`,
+/// and `LANG`. A locale without a catalog selects English rather than
+/// falling through to the next variable, as the C library does.
+pub fn resolve_lang<F>(lang: Option<Lang>, var: F) -> Lang
+where
+    F: Fn(&str) -> Option<String>,
+{
+    if let Some(lang) = lang {
+        return lang;
+    }
+    ["LC_ALL", "LC_MESSAGES", "LANG"]
+        .into_iter()
+        .filter_map(&var)
+        .find(|value| !value.is_empty())
+        .and_then(|locale| Lang::from_locale(&locale))
+        .unwrap_or_default()
+}
+
+/// Currently selected language
+pub fn current() -> Lang {
+    Lang::from_u8(ACTIVE_LANG.load(Ordering::Relaxed))
+}
+
+/// Text of a message in the active language
+pub fn tr(msg: Msg) -> &'static str {
+    current().text(msg)
+}
+
+/// Text of a message in the active language with `{name}` placeholders filled
+pub fn trf(msg: Msg, args: &[(&str, &dyn Display)]) -> String {
+    fill(tr(msg), args)
+}
+
+fn fill(template: &str, args: &[(&str, &dyn Display)]) -> String {
+    let mut text = template.to_string();
+    for (name, value) in args {
+        text = text.replace(&format!("{{{name}}}"), &value.to_string());
+    }
+    text
+}
+
+/// Key of a localized message
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub enum Msg {
+    /// Top-level error of the generate command
+    GenerateFailed,
+    /// Top-level error of the completions command
+    CompletionsFailed,
+    /// Top-level error of the validate command
+    ValidateFailed,
+    /// Top-level error of the init-fixtures command
+    InitFixturesFailed,
+    /// Top-level error of the repro-check command
+    ReproCheckFailed,
+    /// Top-level error of the query command
+    QueryFailed,
+    /// Top-level error of the summary command
+    SummaryFailed,
+    /// Top-level error of the extract command
+    ExtractFailed,
+    /// Top-level error of the soak command
+    SoakFailed,
+    /// Top-level error of the diff command
+    DiffFailed,
+    /// Top-level error of the compose command
+    ComposeFailed,
+    /// Top-level error of the schema command
+    SchemaFailed,
+    /// Top-level error of the view command
+    ViewFailed,
+    /// Top-level error of the fuzz command
+    FuzzFailed,
+    /// Top-level error of the release-pack command
+    ReleasePackFailed,
+    /// Top-level error of the audit command
+    AuditFailed,
+    /// Top-level error of the simulate command
+    SimulateFailed,
+    /// Top-level error of the export command
+    ExportFailed,
+    /// Top-level error of the score command
+    ScoreFailed,
+    /// Top-level error of the apply command
+    ApplyFailed,
+    /// Top-level error of the deprecated csv command
+    CsvCommandFailed,
+    /// Top-level error of the deprecated xml command
+    XmlCommandFailed,
+
+    /// Offer to resume a wizard session; `{path}`
+    WizardResume,
+    /// Wizard notice that the CSV output file is missing
+    WizardOutputMissing,
+    /// Wizard prompt for the CSV output file
+    WizardOutputPrompt,
+    /// Wizard notice that a base configuration is required
+    WizardBaseConfigMissing,
+    /// Wizard prompt for the base configuration
+    WizardBaseConfigPrompt,
+    /// Wizard prompt for the number of VLANs
+    WizardCountPrompt,
+    /// Wizard confirmation of the exported scenario; `{path}`
+    WizardScenarioWritten,
+
+    /// Heading of the generation summary
+    SummaryHeading,
+    /// Number of generated configurations; `{count}`
+    SummaryConfigurations,
+    /// CSV output file; `{path}`
+    SummaryOutputFile,
+    /// XML output directory; `{path}`
+    SummaryOutputDirectory,
+    /// Range of generated VLAN IDs; `{min}`, `{max}`
+    SummaryVlanIds,
+    /// Firewall number of XML output; `{number}`
+    SummaryFirewallNumber,
+
+    /// Every validated configuration is valid
+    ValidationPassed,
+    /// Number of validation errors found; `{count}`
+    ValidationErrorsFound,
+}
+
+fn en(msg: Msg) -> &'static str {
+    match msg {
+        Msg::GenerateFailed => "Failed to generate configurations",
+        Msg::CompletionsFailed => "Failed to generate shell completions",
+        Msg::ValidateFailed => "Failed to validate configurations",
+        Msg::InitFixturesFailed => "Failed to initialize fixture repository",
+        Msg::ReproCheckFailed => "Failed to check reproducibility",
+        Msg::QueryFailed => "Failed to query configurations",
+        Msg::SummaryFailed => "Failed to summarize generated output",
+        Msg::ExtractFailed => "Failed to extract values",
+        Msg::SoakFailed => "Failed to run soak",
+        Msg::DiffFailed => "Failed to compare configurations",
+        Msg::ComposeFailed => "Failed to compose scenario",
+        Msg::SchemaFailed => "Failed to export schema",
+        Msg::ViewFailed => "Failed to view configuration",
+        Msg::FuzzFailed => "Failed to run round-trip fuzzing",
+        Msg::ReleasePackFailed => "Failed to build release pack",
+        Msg::AuditFailed => "Failed to audit configuration",
+        Msg::SimulateFailed => "Failed to simulate traffic",
+        Msg::ExportFailed => "Failed to export configuration",
+        Msg::ScoreFailed => "Failed to score configuration",
+        Msg::ApplyFailed => "Failed to apply configuration",
+        Msg::CsvCommandFailed => "Failed to process CSV command",
+        Msg::XmlCommandFailed => "Failed to process XML command",
+
+        Msg::WizardResume => "↩️  Found saved answers in {path}. Resume? [Y/n]: ",
+        Msg::WizardOutputMissing => "📝 CSV output file not specified.",
+        Msg::WizardOutputPrompt => "Enter output filename (default: vlan_configs.csv): ",
+        Msg::WizardBaseConfigMissing => "📄 Base configuration file required for XML generation.",
+        Msg::WizardBaseConfigPrompt => "Enter base config file path: ",
+        Msg::WizardCountPrompt => "Enter number of configurations to generate (default: 10): ",
+        Msg::WizardScenarioWritten => "📋 Scenario written to {path}",
+
+        Msg::SummaryHeading => "Summary:",
+        Msg::SummaryConfigurations => "  📊 Configurations: {count}",
+        Msg::SummaryOutputFile => "  📁 Output file: {path}",
+        Msg::SummaryOutputDirectory => "  📁 Output directory: {path}",
+        Msg::SummaryVlanIds => "  🏷️  VLAN IDs: {min} - {max}",
+        Msg::SummaryFirewallNumber => "  🔧 Firewall number: {number}",
+
+        Msg::ValidationPassed => "🎉 All configurations are valid!",
+        Msg::ValidationErrorsFound => "⚠️  Found {count} validation errors",
+    }
+}
+
+fn de(msg: Msg) -> &'static str {
+    match msg {
+        Msg::GenerateFailed => "Konfigurationen konnten nicht generiert werden",
+        Msg::CompletionsFailed => "Shell-Vervollständigungen konnten nicht erzeugt werden",
+        Msg::ValidateFailed => "Konfigurationen konnten nicht validiert werden",
+        Msg::InitFixturesFailed => "Fixture-Repository konnte nicht initialisiert werden",
+        Msg::ReproCheckFailed => "Reproduzierbarkeit konnte nicht geprüft werden",
+        Msg::QueryFailed => "Konfigurationen konnten nicht abgefragt werden",
+        Msg::SummaryFailed => "Ausgabe konnte nicht zusammengefasst werden",
+        Msg::ExtractFailed => "Werte konnten nicht extrahiert werden",
+        Msg::SoakFailed => "Dauertest konnte nicht ausgeführt werden",
+        Msg::DiffFailed => "Konfigurationen konnten nicht verglichen werden",
+        Msg::ComposeFailed => "Szenario konnte nicht zusammengestellt werden",
+        Msg::SchemaFailed => "Schema konnte nicht exportiert werden",
+        Msg::ViewFailed => "Konfiguration konnte nicht angezeigt werden",
+        Msg::FuzzFailed => "Round-Trip-Fuzzing konnte nicht ausgeführt werden",
+        Msg::ReleasePackFailed => "Release-Paket konnte nicht erstellt werden",
+        Msg::AuditFailed => "Konfiguration konnte nicht geprüft werden",
+        Msg::SimulateFailed => "Datenverkehr konnte nicht simuliert werden",
+        Msg::ExportFailed => "Konfiguration konnte nicht exportiert werden",
+        Msg::ScoreFailed => "Konfiguration konnte nicht bewertet werden",
+        Msg::ApplyFailed => "Konfiguration konnte nicht angewendet werden",
+        Msg::CsvCommandFailed => "CSV-Befehl konnte nicht verarbeitet werden",
+        Msg::XmlCommandFailed => "XML-Befehl konnte nicht verarbeitet werden",
+
+        Msg::WizardResume => "↩️  Gespeicherte Antworten in {path} gefunden. Fortsetzen? [J/n]: ",
+        Msg::WizardOutputMissing => "📝 Keine CSV-Ausgabedatei angegeben.",
+        Msg::WizardOutputPrompt => "Name der Ausgabedatei (Standard: vlan_configs.csv): ",
+        Msg::WizardBaseConfigMissing => {
+            "📄 Für die XML-Generierung wird eine Basiskonfiguration benötigt."
+        }
+        Msg::WizardBaseConfigPrompt => "Pfad der Basiskonfiguration: ",
+        Msg::WizardCountPrompt => "Anzahl der zu generierenden Konfigurationen (Standard: 10): ",
+        Msg::WizardScenarioWritten => "📋 Szenario nach {path} geschrieben",
+
+        Msg::SummaryHeading => "Zusammenfassung:",
+        Msg::SummaryConfigurations => "  📊 Konfigurationen: {count}",
+        Msg::SummaryOutputFile => "  📁 Ausgabedatei: {path}",
+        Msg::SummaryOutputDirectory => "  📁 Ausgabeverzeichnis: {path}",
+        Msg::SummaryVlanIds => "  🏷️  VLAN-IDs: {min} - {max}",
+        Msg::SummaryFirewallNumber => "  🔧 Firewall-Nummer: {number}",
+
+        Msg::ValidationPassed => "🎉 Alle Konfigurationen sind gültig!",
+        Msg::ValidationErrorsFound => "⚠️  {count} Validierungsfehler gefunden",
+    }
+}
+
+fn es(msg: Msg) -> &'static str {
+    match msg {
+        Msg::GenerateFailed => "No se pudieron generar las configuraciones",
+        Msg::CompletionsFailed => "No se pudieron generar los autocompletados de la shell",
+        Msg::ValidateFailed => "No se pudieron validar las configuraciones",
+        Msg::InitFixturesFailed => "No se pudo inicializar el repositorio de fixtures",
+        Msg::ReproCheckFailed => "No se pudo comprobar la reproducibilidad",
+        Msg::QueryFailed => "No se pudieron consultar las configuraciones",
+        Msg::SummaryFailed => "No se pudo resumir la salida generada",
+        Msg::ExtractFailed => "No se pudieron extraer los valores",
+        Msg::SoakFailed => "No se pudo ejecutar la prueba de resistencia",
+        Msg::DiffFailed => "No se pudieron comparar las configuraciones",
+        Msg::ComposeFailed => "No se pudo componer el escenario",
+        Msg::SchemaFailed => "No se pudo exportar el esquema",
+        Msg::ViewFailed => "No se pudo mostrar la configuración",
+        Msg::FuzzFailed => "No se pudo ejecutar el fuzzing de ida y vuelta",
+        Msg::ReleasePackFailed => "No se pudo crear el paquete de publicación",
+        Msg::AuditFailed => "No se pudo auditar la configuración",
+        Msg::SimulateFailed => "No se pudo simular el tráfico",
+        Msg::ExportFailed => "No se pudo exportar la configuración",
+        Msg::ScoreFailed => "No se pudo puntuar la configuración",
+        Msg::ApplyFailed => "No se pudo aplicar la configuración",
+        Msg::CsvCommandFailed => "No se pudo procesar el comando CSV",
+        Msg::XmlCommandFailed => "No se pudo procesar el comando XML",
+
+        Msg::WizardResume => {
+            "↩️  Se encontraron respuestas guardadas en {path}. ¿Continuar? [S/n]: "
+        }
+        Msg::WizardOutputMissing => "📝 No se indicó el archivo CSV de salida.",
+        Msg::WizardOutputPrompt => {
+            "Nombre del archivo de salida (predeterminado: vlan_configs.csv): "
+        }
+        Msg::WizardBaseConfigMissing => {
+            "📄 La generación XML requiere un archivo de configuración base."
+        }
+        Msg::WizardBaseConfigPrompt => "Ruta del archivo de configuración base: ",
+        Msg::WizardCountPrompt => "Número de configuraciones a generar (predeterminado: 10): ",
+        Msg::WizardScenarioWritten => "📋 Escenario escrito en {path}",
+
+        Msg::SummaryHeading => "Resumen:",
+        Msg::SummaryConfigurations => "  📊 Configuraciones: {count}",
+        Msg::SummaryOutputFile => "  📁 Archivo de salida: {path}",
+        Msg::SummaryOutputDirectory => "  📁 Directorio de salida: {path}",
+        Msg::SummaryVlanIds => "  🏷️  IDs de VLAN: {min} - {max}",
+        Msg::SummaryFirewallNumber => "  🔧 Número de firewall: {number}",
+
+        Msg::ValidationPassed => "🎉 ¡Todas las configuraciones son válidas!",
+        Msg::ValidationErrorsFound => "⚠️  Se encontraron {count} errores de validación",
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::collections::HashMap;
+
+    fn lookup(vars: &[(&str, &str)]) -> impl Fn(&str) -> Option<String> {
+        let map: HashMap<String, String> = vars
+            .iter()
+            .map(|(k, v)| (k.to_string(), v.to_string()))
+            .collect();
+        move |name| map.get(name).cloned()
+    }
+
+    #[test]
+    fn test_resolve_lang_precedence() {
+        assert_eq!(resolve_lang(None, lookup(&[])), Lang::En);
+        assert_eq!(
+            resolve_lang(None, lookup(&[("LANG", "de_DE.UTF-8")])),
+            Lang::De
+        );
+        assert_eq!(
+            resolve_lang(Some(Lang::Es), lookup(&[("LANG", "de_DE.UTF-8")])),
+            Lang::Es
+        );
+        assert_eq!(
+            resolve_lang(None, lookup(&[("LC_ALL", "es_ES"), ("LANG", "de_DE")])),
+            Lang::Es
+        );
+        assert_eq!(
+            resolve_lang(
+                None,
+                lookup(&[("LC_ALL", ""), ("LC_MESSAGES", "de"), ("LANG", "es")])
+            ),
+            Lang::De
+        );
+        // A set locale without a catalog does not fall through
+        assert_eq!(
+            resolve_lang(None, lookup(&[("LC_ALL", "C"), ("LANG", "de_DE")])),
+            Lang::En
+        );
+        assert_eq!(Lang::from_locale("fr_FR.UTF-8"), None);
+    }
+
+    #[test]
+    fn test_placeholders_survive_translation() {
+        for lang in [Lang::De, Lang::Es] {
+            for msg in [
+                Msg::WizardResume,
+                Msg::SummaryVlanIds,
+                Msg::ValidationErrorsFound,
+            ] {
+                let placeholders = |text: &str| {
+                    let mut names: Vec<String> = text
+                        .split('{')
+                        .skip(1)
+                        .filter_map(|part| part.split_once('}').map(|(name, _)| name.into()))
+                        .collect();
+                    names.sort();
+                    names
+                };
+                assert_eq!(
+                    placeholders(lang.text(msg)),
+                    placeholders(Lang::En.text(msg))
+                );
+            }
+        }
+        assert_eq!(
+            fill(
+                Lang::De.text(Msg::SummaryVlanIds),
+                &[("min", &10), ("max", &20)]
+            ),
+            "  🏷️  VLAN-IDs: 10 - 20"
+        );
+    }
+}
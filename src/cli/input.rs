@@ -0,0 +1,64 @@
+//! Reading configuration files named on the command line
+//!
+//! Commands read input configurations through [`read_config`] so encrypted
+//! backups and `--recover` work the same everywhere. Without `--recover` a
+//! damaged file is rejected as before; with it, the file is salvaged by
+//! [`crate::xml::recover`] and every repair is reported on stderr.
+
+use crate::cli::GlobalArgs;
+use crate::cli::theme::{self, Role};
+use crate::io::backup::read_config_content;
+use crate::xml::recover::{recover, recover_bytes};
+use anyhow::{Context, Result, bail};
+use std::fs;
+use std::path::Path;
+
+/// Read a configuration, decrypting encrypted backups
+pub fn read_config(path: &Path, passphrase: Option<&str>, global: &GlobalArgs) -> Result<String> {
+    let bytes = fs::read(path).with_context(|| format!("Failed to read {}", path.display()))?;
+    let recovery = match String::from_utf8(bytes) {
+        Ok(content) => {
+            let content = read_config_content(content, passphrase)
+                .with_context(|| format!("Failed to decrypt {}", path.display()))?;
+            if !global.recover {
+                return Ok(content);
+            }
+            recover(&content)
+        }
+        Err(e) if global.recover => recover_bytes(e.as_bytes()),
+        Err(_) => bail!(
+            "{} is not valid UTF-8; use --recover to salvage it",
+            path.display()
+        ),
+    };
+
+    for repair in &recovery.repairs {
+        eprintln!(
+            "{} {}: {repair}",
+            theme::paint(Role::Warning, "warning[recover]:").for_stderr(),
+            path.display()
+        );
+    }
+    Ok(recovery.content)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_damaged_input_needs_recover() {
+        let dir = TempDir::new().unwrap();
+        let path = dir.path().join("config.xml");
+        fs::write(&path, b"<opnsense><system><hostname>fw\xff01</hostname>").unwrap();
+
+        assert!(read_config(&path, None, &GlobalArgs::default()).is_err());
+        let global = GlobalArgs {
+            recover: true,
+            ..GlobalArgs::default()
+        };
+        let content = read_config(&path, None, &global).unwrap();
+        assert!(content.ends_with("</hostname></system></opnsense>\n"));
+    }
+}
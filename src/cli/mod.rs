@@ -1,14 +1,32 @@
 //! Command-line interface for OPNsense Config Faker
 
+use crate::generator::{
+    DescriptionStyles, Flavor, LabelSelector, PortalLimits, SectionBudgets, UnsupportedPolicy,
+};
+use crate::io::signing::Signer;
+use crate::model::options::GenerationOptions;
+use crate::model::scenario::ScenarioFormat;
+use crate::model::schema::SchemaKind;
+use crate::query::RecordKind;
 use clap::{Parser, Subcommand, ValueEnum};
+use std::net::Ipv4Addr;
 use std::path::PathBuf;
+use std::time::Duration;
+
+pub use crate::io::report::ReportFormat;
+pub use crate::model::options::{MAX_UNIQUE_VLAN_IDS, PrefixStrategy, parse_vlan_range};
+pub use i18n::Lang;
+pub use progress::ProgressMode;
+pub use theme::Theme;
 
 pub mod commands;
 pub mod error;
-
-/// Maximum number of unique VLAN IDs that can be generated
-/// VLAN IDs range from 10-4094, giving us 4085 unique values
-pub const MAX_UNIQUE_VLAN_IDS: u16 = 4085;
+pub mod flags;
+pub mod i18n;
+pub mod input;
+pub mod progress;
+pub mod theme;
+pub mod wizard;
 
 /// OPNsense Config Faker - Generate realistic network configuration test data
 #[derive(Parser)]
@@ -59,6 +77,57 @@
     opnsense-config-faker validate --input data.csv
     opnsense-config-faker validate --input config.xml --format xml
 
+  Scaffold a versioned fixture repository:
+    opnsense-config-faker init-fixtures ./fixtures
+
+  Check that seeded output is reproducible:
+    opnsense-config-faker repro-check -- --format csv --count 50 --seed 7
+
+  Query generated output:
+    opnsense-config-faker query --input output --where "subnet overlaps 10.20.0.0/16"
+
+  Extract values from a generated config:
+    opnsense-config-faker extract --input output/firewall_1.xml --xpath '//dhcpd/*/range'
+
+  Simulate ongoing configuration change:
+    opnsense-config-faker soak --interval 5m --target ./out/
+
+  Show what a generated config adds to the factory default:
+    opnsense-config-faker diff output/firewall_1.xml --against-default
+
+  Compose a scenario from reusable snippet blocks:
+    opnsense-config-faker compose scenarios/branch-sites.json --snippets snippets/
+
+  Export the scenario schema for editor validation:
+    opnsense-config-faker schema export --type scenario --format jsonschema > scenario.schema.json
+
+  Browse a large generated config:
+    opnsense-config-faker view output/firewall_1.xml
+
+  Check that emitted XML parses back unchanged:
+    opnsense-config-faker fuzz roundtrip --iterations 10000 --seed 42
+
+  Build a fixture pack for publishing:
+    opnsense-config-faker release-pack --profiles small,campus,datacenter --out packs/
+
+  Audit generated secrets for weak or shared credentials:
+    opnsense-config-faker audit secrets --input output/
+
+  Check whether traffic between generated hosts would pass:
+    opnsense-config-faker simulate path --from 10.10.20.5 --to 192.168.40.10 --port 443
+
+  Preview which flows a new rule would affect:
+    opnsense-config-faker simulate change --add-rule "block tcp from 10.10.20.x to any port 445 on vlan120"
+
+  Export the dependency graph of a generated config:
+    opnsense-config-faker export graph --input output/firewall_1.xml --format json
+
+  Score a configuration's health with a custom model:
+    opnsense-config-faker score --input output/firewall_1.xml --model score-model.yaml
+
+  Push generated VLANs and aliases to a lab firewall:
+    opnsense-config-faker apply --input output/firewall_1.xml --url https://192.168.1.1 --parent-interface igb1
+
   Use global flags:
     opnsense-config-faker --quiet generate --count 10 --format csv
     opnsense-config-faker --no-color generate --count 10 --format xml --base-config config.xml"#)]
@@ -83,6 +152,40 @@ pub enum Commands {
     },
     /// Validate configuration data for consistency and correctness
     Validate(ValidateArgs),
+    /// Scaffold a version-controlled fixture repository
+    InitFixtures(InitFixturesArgs),
+    /// Verify that seeded generation is byte-for-byte reproducible
+    ReproCheck(ReproCheckArgs),
+    /// Query VLANs, firewall rules, or hosts in generated output
+    Query(QueryArgs),
+    /// Count the VLANs, firewall rules, and hosts in generated output
+    Summary(SummaryArgs),
+    /// Extract values from generated XML with XPath or from JSON with a JSON pointer
+    Extract(ExtractArgs),
+    /// Continuously emit slightly evolved configurations to simulate operational change
+    Soak(SoakArgs),
+    /// Compare two configurations, or one against the OPNsense factory default
+    Diff(DiffArgs),
+    /// Expand a scenario's snippet blocks into a VLAN CSV
+    Compose(ComposeArgs),
+    /// Export schemas of the faker's input files
+    Schema(SchemaArgs),
+    /// Browse a configuration interactively in the terminal
+    View(ViewArgs),
+    /// Round-trip emitted XML and sample random model fragments for tests
+    Fuzz(FuzzArgs),
+    /// Build a versioned fixture pack of curated profiles for publishing
+    ReleasePack(ReleasePackArgs),
+    /// Audit configurations for weak or reused credentials
+    Audit(AuditArgs),
+    /// Evaluate traffic against the generated firewall, NAT, and routing model
+    Simulate(SimulateArgs),
+    /// Export derived views of a configuration, such as its dependency graph
+    Export(ExportArgs),
+    /// Score a configuration's health and realism with a tunable model
+    Score(ScoreArgs),
+    /// Push generated VLANs, aliases, and rules to a live OPNsense firewall
+    Apply(ApplyArgs),
     /// DEPRECATED: Use 'generate --format csv' instead
     #[command(hide = true)]
     Csv(CsvArgs),
@@ -105,6 +208,42 @@ pub struct GlobalArgs {
     /// Global output file or directory (overrides command-specific output)
     #[arg(short, long, global = true)]
     pub output: Option<PathBuf>,
+
+    /// Keep temporary workspaces for debugging instead of removing them
+    #[arg(long, global = true)]
+    pub keep_temp: bool,
+
+    /// Color theme for terminal output
+    #[arg(long, global = true, value_enum, default_value = "default")]
+    pub theme: Theme,
+
+    /// Language of CLI messages
+    ///
+    /// Defaults to the language of LC_ALL, LC_MESSAGES, or LANG; languages
+    /// without a catalog fall back to English.
+    #[arg(long, global = true, value_enum)]
+    pub lang: Option<Lang>,
+
+    /// How progress is reported
+    ///
+    /// Plain mode writes occasional single-line updates without control
+    /// sequences, for screen readers and log files; auto uses it whenever
+    /// stderr is not a terminal. OPNSENSE_CONFIG_FAKER_PROGRESS sets the
+    /// mode when the flag is not given.
+    #[arg(long, global = true, value_enum, value_name = "MODE")]
+    pub progress: Option<ProgressMode>,
+
+    /// Reject deprecated flag names instead of accepting them with a warning
+    #[arg(long, global = true)]
+    pub strict_flags: bool,
+
+    /// Salvage damaged input configurations instead of rejecting them
+    ///
+    /// Drops a byte-order mark, interleaved log lines, and data after the
+    /// document, and closes a truncated document, reporting every change as
+    /// a warning.
+    #[arg(long, global = true)]
+    pub recover: bool,
 }
 
 /// Output format for generated configurations
@@ -165,6 +304,14 @@ pub struct GenerateArgs {
     #[arg(short, long)]
     pub base_config: Option<PathBuf>,
 
+    /// Start from the embedded OPNsense factory default instead of a base config (XML format only)
+    ///
+    /// Writes a single firewall_<NR>.xml that is the stock configuration with
+    /// the generated VLANs, interfaces, and DHCP ranges added, the way real
+    /// configurations evolve.
+    #[arg(long, conflicts_with = "base_config")]
+    pub from_default: bool,
+
     /// Use existing CSV file for configuration data (XML format only)
     #[arg(long, conflicts_with = "count")]
     pub csv_file: Option<PathBuf>,
@@ -195,6 +342,22 @@ pub struct GenerateArgs {
     #[arg(short, long)]
     pub interactive: bool,
 
+    /// File the interactive answers are saved to
+    ///
+    /// Every answer is saved as soon as it is given, so an interrupted wizard
+    /// can be resumed by running it again. The file is removed after a
+    /// successful run. Defaults to .opnsense-config-faker-wizard.json in the
+    /// current directory.
+    #[arg(long, value_name = "FILE", requires = "interactive")]
+    pub session: Option<PathBuf>,
+
+    /// Write the completed wizard answers as a scenario file
+    ///
+    /// The scenario is seeded; without --seed a seed is chosen and used for
+    /// this run as well, so the scenario reproduces its output.
+    #[arg(long, value_name = "FILE", requires = "interactive")]
+    pub export_scenario: Option<PathBuf>,
+
     /// Include firewall rules in generated configurations
     #[arg(long)]
     pub include_firewall_rules: bool,
@@ -203,6 +366,25 @@ pub struct GenerateArgs {
     #[arg(long)]
     pub firewall_rules_per_vlan: Option<u16>,
 
+    /// Most firewall rules to emit across all VLANs
+    ///
+    /// Every VLAN keeps its highest-priority rules before any VLAN keeps
+    /// more; dropped rules are reported as a warning. Caps for sections a
+    /// run does not generate have no effect.
+    #[arg(long, value_name = "N")]
+    pub max_rules: Option<usize>,
+
+    /// Most aliases to emit, keeping the first ones
+    #[arg(long, value_name = "N")]
+    pub max_aliases: Option<usize>,
+
+    /// Most DHCP reservations to emit across all VLANs
+    ///
+    /// Every VLAN keeps its lowest-address reservations first. Hosts whose
+    /// reservation is dropped keep their DNS override and alias membership.
+    #[arg(long, value_name = "N")]
+    pub max_reservations: Option<usize>,
+
     /// Firewall rule complexity level (basic, intermediate, advanced)
     #[arg(long, default_value = "intermediate")]
     pub firewall_rule_complexity: String,
@@ -222,6 +404,257 @@ pub struct GenerateArgs {
     /// WAN assignment strategy for VLANs
     #[arg(long, value_enum)]
     pub wan_assignments: Option<WanAssignmentStrategy>,
+
+    /// RFC 1918 ranges used for VLAN networks
+    #[arg(long, value_enum, default_value = "class-a")]
+    pub prefix_strategy: PrefixStrategy,
+
+    /// Target occupancy of each subnet as a percentage of usable addresses
+    ///
+    /// Populates every VLAN with DHCP reservations, DNS host overrides, and
+    /// host alias members, varying per subnet around this target. The hosts
+    /// are written to a separate hosts CSV file.
+    #[arg(
+        long,
+        value_name = "PERCENT",
+        group = "hosts",
+        value_parser = clap::value_parser!(u8).range(0..=100)
+    )]
+    pub host_density: Option<u8>,
+
+    /// Scale users, hosts, and firewall rules with per-department headcounts
+    ///
+    /// Each VLAN gets its department's share of people, written as local
+    /// users and groups to `<name>_users.xml`, and hosts in proportion
+    /// instead of --host-density. With --include-firewall-rules, larger
+    /// departments also get more rules.
+    #[arg(long, group = "hosts")]
+    pub headcount: bool,
+
+    /// JSON file with headcounts replacing the built-in ones
+    ///
+    /// Holds `departments` (name to headcount), `default` for departments
+    /// not listed, and `devices_per_user`.
+    #[arg(long, value_name = "FILE", requires = "headcount")]
+    pub headcount_model: Option<PathBuf>,
+
+    /// Also write this many days of RADIUS accounting history (1-90)
+    ///
+    /// One Stop record per session of every --headcount user, ending at
+    /// 2024-01-01 00:00:00 UTC, written as `<name>_accounting.csv` and
+    /// `<name>_accounting.json`. Sessions respect --session-timeout and
+    /// --idle-timeout.
+    #[arg(
+        long,
+        value_name = "DAYS",
+        requires = "headcount",
+        value_parser = clap::value_parser!(u16).range(1..=90)
+    )]
+    pub radius_accounting: Option<u16>,
+
+    /// Captive portal hard timeout, or voucher validity, in minutes
+    #[arg(
+        long,
+        value_name = "MINUTES",
+        default_value_t = 480,
+        requires = "radius_accounting",
+        value_parser = clap::value_parser!(u32).range(1..=10080)
+    )]
+    pub session_timeout: u32,
+
+    /// Captive portal idle timeout in minutes
+    #[arg(
+        long,
+        value_name = "MINUTES",
+        default_value_t = 30,
+        requires = "radius_accounting",
+        value_parser = clap::value_parser!(u32).range(1..=10080)
+    )]
+    pub idle_timeout: u32,
+
+    /// Give every generated host a device class, OS, and DHCP fingerprint
+    ///
+    /// Writes the device registry as `<name>_devices.json` and the dynamic
+    /// pool's leases, carrying the same fingerprints, as `<name>_dhcpd.leases`.
+    #[arg(long, requires = "hosts")]
+    pub device_fingerprints: bool,
+
+    /// Assign each VLAN a type (data, voice, storage, management, guest, or
+    /// PPPoE) with matching MTU, MSS clamping, and 802.1p priority
+    ///
+    /// Storage VLANs get jumbo frames, PPPoE uplinks an MTU of 1492 with MSS
+    /// clamping, and voice VLANs PCP 5. The profiles are written to a separate
+    /// interfaces CSV file and fill the {{MTU}}, {{MSS}}, {{VLAN_PCP}}, and
+    /// {{VLAN_TYPE}} base config placeholders.
+    #[arg(long)]
+    pub interface_realism: bool,
+
+    /// Wording of generated descriptions: standard, terse, verbose, or ticket
+    ///
+    /// A single style applies to every section; use SECTION=STYLE to set the
+    /// vlan and rule sections separately, e.g. "terse" or "verbose,rule=ticket".
+    #[arg(
+        long,
+        value_name = "STYLE",
+        default_value = "standard",
+        value_parser = parse_description_styles
+    )]
+    pub description_style: DescriptionStyles,
+
+    /// Tag generated objects with site, tier, and batch labels
+    ///
+    /// Labels are appended to VLAN and firewall rule descriptions and written
+    /// to a separate labels JSON file. Firewall rules, hosts, and interfaces
+    /// inherit the labels of their VLAN.
+    #[arg(long)]
+    pub labels: bool,
+
+    /// Emit only objects whose labels match, e.g. "site=hq" or "tier!=core"
+    ///
+    /// Terms are comma-separated; repeat the flag or combine terms to require
+    /// all of them. The dataset is generated in full first, so the subset is
+    /// identical to the same objects in an unfiltered run.
+    #[arg(long, value_name = "SELECTOR", requires = "labels", value_parser = parse_label_selector)]
+    pub filter: Vec<LabelSelector>,
+
+    /// Number of synthetic threat-intel feed files to generate
+    ///
+    /// Writes host and network blocklists next to the output, plus URL-table
+    /// aliases referencing them, so alias refresh can be tested without
+    /// internet access. Entries come from the 198.18.0.0/15 benchmark range.
+    #[arg(long, value_name = "COUNT", value_parser = clap::value_parser!(u16).range(1..=64))]
+    pub threat_feeds: Option<u16>,
+
+    /// Base URL the feed files are served from, e.g. "http://192.168.1.10:8000/feeds"
+    ///
+    /// Defaults to a file:// URL of the generated feed directory.
+    #[arg(long, value_name = "URL", requires = "threat_feeds")]
+    pub feed_url: Option<String>,
+
+    /// Also write host and network aliases nested this many levels deep (1-8)
+    ///
+    /// Each VLAN gets a network and a host alias; groups of them are nested
+    /// into groups of groups up to the given depth, some sharing members or
+    /// mixing in literal addresses. The aliases are written next to the
+    /// output as `<name>_nested_aliases.xml`, and their expected flattened
+    /// content as `<name>_nested_aliases.json`.
+    #[arg(long, value_name = "DEPTH", value_parser = clap::value_parser!(u8).range(1..=8))]
+    pub alias_depth: Option<u8>,
+
+    /// Also write an HA pair's CARP VIPs and logs of this many failovers (1-50)
+    ///
+    /// Each VLAN gets a CARP VIP on its gateway address, written for both
+    /// nodes as `<name>_carp_primary.xml` and `<name>_carp_backup.xml`. The
+    /// state changes and notifications each node logs during the failovers
+    /// go to `<name>_carp_primary.log` and `<name>_carp_backup.log`, and the
+    /// incidents with every state change to `<name>_carp_events.json`.
+    #[arg(long, value_name = "COUNT", value_parser = clap::value_parser!(u16).range(1..=50))]
+    pub carp_events: Option<u16>,
+
+    /// Also write an Unbound section with this many more host overrides and aliases (1-50000)
+    ///
+    /// Mixes A records, wildcard records for application subdomains, and
+    /// aliases of other overrides, none reusing a name of a generated host or
+    /// DHCP reservation. The section, holding the --host-density or
+    /// --headcount hosts as well, is written as `<name>_unbound.xml` and its
+    /// records as `<name>_unbound.json`.
+    #[arg(long, value_name = "COUNT", value_parser = clap::value_parser!(u32).range(1..=50_000))]
+    pub dns_overrides: Option<u32>,
+
+    /// Also write which switch ports every VLAN interface connects to
+    ///
+    /// The VLAN parent is trunked to a core switch, and each department's
+    /// VLANs reach their hosts through access switches uplinked to the core.
+    /// The mapping is written as `<name>_lldp.csv`, and the neighbor table of
+    /// the firewall and every switch, as `lldpctl -f json` prints it, as
+    /// `<name>_lldp.json`.
+    #[arg(long)]
+    pub lldp_inventory: bool,
+
+    /// Number of LACP LAGG interfaces to add (XML format only)
+    ///
+    /// Each LAGG bundles two to eight dedicated ports and carries an LACP
+    /// rate, hash policy, and strict mode, as switch-integration
+    /// documentation expects.
+    #[arg(long, value_name = "COUNT", value_parser = clap::value_parser!(u8).range(1..=16))]
+    pub laggs: Option<u8>,
+
+    /// Number of two-port bridges with spanning tree to add (XML format only)
+    ///
+    /// Each bridge carries an STP or RSTP priority, hello time, forward
+    /// delay, max age, and hold count within IEEE 802.1D limits.
+    #[arg(long, value_name = "COUNT", value_parser = clap::value_parser!(u8).range(1..=16))]
+    pub bridges: Option<u8>,
+
+    /// Also write the dataset with this encoder: xml, json, or protobuf (CSV format only)
+    ///
+    /// Each encoding is written next to the output as `<name>_dataset.<ext>`
+    /// and holds the same VLANs and firewall rules as the CSV files. The
+    /// protobuf encoding is experimental. Repeat the flag for several encodings.
+    #[arg(long, value_name = "ENCODER")]
+    pub encode: Vec<String>,
+
+    /// Organizational policy file the generated output must conform to
+    ///
+    /// VLAN IDs are taken from the policy's allowed ranges, networks are moved
+    /// into its allowed prefixes, and pass rules naming forbidden ports are
+    /// dropped. Output that still violates the policy fails the run.
+    #[arg(long, value_name = "FILE")]
+    pub policy: Option<PathBuf>,
+
+    /// Also write an answer key of the intended reachability between VLANs
+    ///
+    /// The JSON file lists, for every pair of VLANs and from every VLAN to
+    /// the internet, which services the generated rules pass and which rule
+    /// decides, so analysis tools can be scored against it. It is written
+    /// next to the output as `<name>_answer_key.json`.
+    #[arg(long, requires = "include_firewall_rules")]
+    pub answer_key: bool,
+
+    /// OPNsense release to generate for, e.g. "24.7", or "24.10" with --flavor business
+    ///
+    /// Every release-dependent section is checked against the release that
+    /// introduced it and a per-section support report is printed;
+    /// --on-unsupported decides what happens to sections the release lacks.
+    #[arg(long, value_name = "VERSION")]
+    pub opnsense_version: Option<String>,
+
+    /// Edition of the targeted release
+    #[arg(
+        long,
+        value_enum,
+        default_value = "community",
+        requires = "opnsense_version"
+    )]
+    pub flavor: Flavor,
+
+    /// What to do with sections the targeted release does not support
+    #[arg(
+        long,
+        value_enum,
+        value_name = "POLICY",
+        default_value = "error",
+        requires = "opnsense_version"
+    )]
+    pub on_unsupported: UnsupportedPolicy,
+
+    /// Passphrase for the OPNsense encrypted backup format (XML format only)
+    ///
+    /// When set, generated XML files are written as encrypted backups and an
+    /// encrypted base configuration is decrypted before use.
+    #[arg(long)]
+    pub backup_passphrase: Option<String>,
+
+    /// Reproduce unchanged configurations from a previous run exactly
+    ///
+    /// Only the delta (e.g. additional VLANs) is newly generated, keeping
+    /// version-controlled fixtures reviewable. Requires --previous.
+    #[arg(long, requires = "previous")]
+    pub minimize_diff: bool,
+
+    /// Previous output to reuse with --minimize-diff (CSV file, XML file, or XML directory)
+    #[arg(long, requires = "minimize_diff", conflicts_with = "csv_file")]
+    pub previous: Option<PathBuf>,
 }
 
 impl GenerateArgs {
@@ -243,6 +676,82 @@ pub fn validate(&self) -> Result<(), String> {
         Ok(())
     }
 
+    /// Library-level options equivalent to these arguments
+    pub fn to_options(&self) -> GenerationOptions {
+        // clap always fills in the default count; it only applies when no
+        // VLAN range or CSV input replaces it
+        let count = if self.vlan_range.is_some() || self.csv_file.is_some() {
+            None
+        } else {
+            Some(self.count)
+        };
+
+        GenerationOptions {
+            format: match self.format {
+                OutputFormat::Csv => ScenarioFormat::Csv,
+                OutputFormat::Xml => ScenarioFormat::Xml,
+            },
+            count,
+            vlan_range: self.vlan_range.clone(),
+            base_config: self.base_config.clone(),
+            from_default: self.from_default,
+            csv_file: self.csv_file.clone(),
+            firewall_nr: self.firewall_nr,
+            opt_counter: self.opt_counter,
+            include_firewall_rules: self.include_firewall_rules,
+            firewall_rules_per_vlan: self.firewall_rules_per_vlan,
+            firewall_rule_complexity: self.firewall_rule_complexity.clone(),
+            backup_passphrase: self.backup_passphrase.clone(),
+            minimize_diff: self.minimize_diff,
+            previous: self.previous.clone(),
+            prefix_strategy: self.prefix_strategy,
+            host_density: self.host_density,
+            headcount: self.headcount,
+            headcount_model: self.headcount_model.clone(),
+            radius_accounting: self.radius_accounting,
+            portal_limits: self.portal_limits(),
+            interface_realism: self.interface_realism,
+            description_styles: self.description_style,
+            labels: self.labels,
+            label_filter: self.label_selector(),
+            threat_feeds: self.threat_feeds,
+            feed_url: self.feed_url.clone(),
+            alias_depth: self.alias_depth,
+            carp_events: self.carp_events,
+            dns_overrides: self.dns_overrides,
+            lldp_inventory: self.lldp_inventory,
+            laggs: self.laggs,
+            bridges: self.bridges,
+            encoders: self.encode.clone(),
+            opnsense_version: self.opnsense_version.clone(),
+            flavor: self.flavor,
+            on_unsupported: self.on_unsupported,
+            budgets: self.budgets(),
+        }
+    }
+
+    /// Captive portal limits from --session-timeout and --idle-timeout
+    pub fn portal_limits(&self) -> PortalLimits {
+        PortalLimits {
+            hard_timeout: self.session_timeout,
+            idle_timeout: self.idle_timeout,
+        }
+    }
+
+    /// Section caps from --max-rules, --max-aliases, and --max-reservations
+    pub fn budgets(&self) -> SectionBudgets {
+        SectionBudgets {
+            max_rules: self.max_rules,
+            max_aliases: self.max_aliases,
+            max_reservations: self.max_reservations,
+        }
+    }
+
+    /// Combined --filter selector, if any
+    pub fn label_selector(&self) -> Option<LabelSelector> {
+        self.filter.iter().cloned().reduce(LabelSelector::and)
+    }
+
     /// Validate VLAN range format and values
     fn validate_vlan_range(&self, vlan_range: &str) -> Result<(), String> {
         let ranges = parse_vlan_range(vlan_range)
@@ -378,6 +887,718 @@ pub struct ValidateArgs {
     /// Output validation report to file
     #[arg(long)]
     pub report: Option<PathBuf>,
+
+    /// Format of the validation report (table, csv, or json)
+    #[arg(long, value_enum, requires = "report")]
+    pub report_format: Option<ReportFormat>,
+
+    /// Passphrase used to decrypt an OPNsense encrypted backup before validation
+    #[arg(long)]
+    pub backup_passphrase: Option<String>,
+
+    /// YAML file of user-defined lint rules to check XML input against
+    ///
+    /// Each rule selects nodes with an XPath and states a predicate over
+    /// value, path, and count that every node must satisfy. Repeat to combine
+    /// rule files; error-severity violations fail validation.
+    #[arg(long, value_name = "FILE")]
+    pub rules: Vec<PathBuf>,
+
+    /// Organizational policy file to check VLANs and firewall rules against
+    ///
+    /// Reports VLAN IDs, networks, quotas, forbidden ports, and names the
+    /// policy does not allow; any violation fails validation.
+    #[arg(long, value_name = "FILE")]
+    pub policy: Option<PathBuf>,
+}
+
+/// Arguments for the init-fixtures command
+#[derive(Parser)]
+pub struct InitFixturesArgs {
+    /// Directory to scaffold the fixture repository in
+    #[arg(default_value = "fixtures")]
+    pub dir: PathBuf,
+
+    /// Build tool used for the regeneration target
+    #[arg(long, value_enum, default_value = "just")]
+    pub build_tool: BuildTool,
+
+    /// Track generated XML with Git LFS in .gitattributes
+    #[arg(long)]
+    pub lfs: bool,
+
+    /// Overwrite an existing fixture repository
+    #[arg(short = 'F', long)]
+    pub force: bool,
+}
+
+/// Arguments for the repro-check command
+#[derive(Parser)]
+pub struct ReproCheckArgs {
+    /// Number of generation runs to compare
+    #[arg(long, default_value_t = 2)]
+    #[arg(value_parser = clap::value_parser!(u8).range(2..=20))]
+    pub runs: u8,
+
+    /// Expected combined SHA-256 digest, e.g. printed by a run on another platform
+    #[arg(long, value_name = "SHA256")]
+    pub expect: Option<String>,
+
+    /// Arguments for the generate command, given after `--`
+    ///
+    /// Output locations are managed by repro-check. A seed of 42 is used when
+    /// none is given.
+    #[arg(last = true, required = true, value_name = "GENERATE_ARGS")]
+    pub generate_args: Vec<String>,
+}
+
+/// Arguments for the query command
+#[derive(Parser)]
+pub struct QueryArgs {
+    /// Generated CSV file, XML file, or output directory to query
+    #[arg(short, long)]
+    pub input: PathBuf,
+
+    /// Filter expression, e.g. "subnet overlaps 10.20.0.0/16" or "duplicate subnet"
+    ///
+    /// Compare fields with =, !=, <, <=, >, >=, contains, overlaps, or within;
+    /// combine with and, or, not, and parentheses. "duplicate FIELD" matches
+    /// records sharing a value with another record. Without --where every
+    /// record is listed.
+    #[arg(short = 'w', long = "where", value_name = "EXPR")]
+    pub filter: Option<String>,
+
+    /// Kind of record to query
+    #[arg(short, long, value_enum, default_value = "vlan")]
+    pub kind: RecordKind,
+
+    /// Output format
+    #[arg(short = 'f', long, value_enum, default_value = "table")]
+    pub format: ReportFormat,
+
+    /// Print only the number of matching records
+    #[arg(long)]
+    pub count: bool,
+}
+
+/// Arguments for the summary command
+#[derive(Parser)]
+pub struct SummaryArgs {
+    /// Generated CSV file, XML file, or output directory to summarize
+    #[arg(short, long)]
+    pub input: PathBuf,
+
+    /// Output format
+    #[arg(short = 'f', long, value_enum, default_value = "table")]
+    pub format: ReportFormat,
+}
+
+/// Arguments for the extract command
+#[derive(Parser)]
+pub struct ExtractArgs {
+    /// XML or JSON file to extract from
+    #[arg(short, long)]
+    pub input: PathBuf,
+
+    /// XPath for XML input, e.g. "//dhcpd/*/range" or "//vlan/@uuid"
+    ///
+    /// Absolute paths of element names and *, joined by / or //, optionally
+    /// ending in @attribute or text(). Predicates are not supported.
+    #[arg(long, conflicts_with = "pointer", required_unless_present = "pointer")]
+    pub xpath: Option<String>,
+
+    /// JSON pointer for JSON input, e.g. "/0/subnet"; a * segment matches every element
+    #[arg(long, value_name = "POINTER")]
+    pub pointer: Option<String>,
+
+    /// Output format
+    #[arg(short = 'f', long, value_enum, default_value = "table")]
+    pub format: ReportFormat,
+
+    /// Print only the values, one per line
+    #[arg(long, conflicts_with = "format")]
+    pub raw: bool,
+}
+
+/// Arguments for the soak command
+#[derive(Parser)]
+pub struct SoakArgs {
+    /// Time between iterations, e.g. "30s", "5m", "2h", or "1d"
+    #[arg(long, default_value = "5m", value_parser = parse_interval)]
+    pub interval: Duration,
+
+    /// Directory the evolving configuration is written to
+    #[arg(long)]
+    pub target: PathBuf,
+
+    /// Number of VLANs in the initial configuration
+    #[arg(short, long, default_value_t = 10)]
+    #[arg(value_parser = clap::value_parser!(u16).range(1..=4085))]
+    pub count: u16,
+
+    /// Stop after this many iterations instead of running until interrupted
+    #[arg(long)]
+    pub iterations: Option<u64>,
+
+    /// Base OPNsense configuration XML; also writes one XML file per VLAN
+    #[arg(short, long)]
+    pub base_config: Option<PathBuf>,
+
+    /// Random seed for a reproducible series of configurations
+    #[arg(long)]
+    pub seed: Option<u64>,
+
+    /// Also push every iteration to a lab firewall through the apply engine
+    ///
+    /// The first iteration pushes every VLAN with its network alias, later
+    /// ones only the VLANs they added or changed; removed VLANs are left on
+    /// the firewall. Its configuration is saved to `<target>/snapshots` before
+    /// the first push, for `apply --rollback`.
+    #[arg(long)]
+    pub apply: bool,
+
+    /// Firewall the iterations are pushed to with --apply
+    #[command(flatten)]
+    pub firewall: ApiTargetArgs,
+}
+
+/// Arguments for the diff command
+#[derive(Parser)]
+pub struct DiffArgs {
+    /// Configuration to compare (the new side)
+    pub config: PathBuf,
+
+    /// Configuration to compare against (the old side)
+    #[arg(required_unless_present = "against_default")]
+    pub baseline: Option<PathBuf>,
+
+    /// Compare against the embedded OPNsense factory-default configuration
+    #[arg(long, conflicts_with = "baseline")]
+    pub against_default: bool,
+
+    /// Output format
+    #[arg(short = 'f', long, value_enum, default_value = "table")]
+    pub format: ReportFormat,
+
+    /// Report only the number of added, removed, and changed values
+    #[arg(long)]
+    pub summary: bool,
+}
+
+/// Arguments for the compose command
+///
+/// The CSV is written to the scenario's output, or to the global --output.
+#[derive(Parser)]
+pub struct ComposeArgs {
+    /// Scenario file whose blocks are expanded
+    pub scenario: PathBuf,
+
+    /// Directory of snippet definitions
+    #[arg(long, default_value = "snippets")]
+    pub snippets: PathBuf,
+}
+
+/// Arguments for the view command
+///
+/// Keys: arrows or hjkl to move and fold, / to search, n for the next match,
+/// Tab to follow a reference (rule to alias to members), Backspace to go back,
+/// and q to quit.
+#[derive(Parser)]
+pub struct ViewArgs {
+    /// Configuration to browse
+    pub input: PathBuf,
+
+    /// Start at the first element matching this text
+    #[arg(long, value_name = "TEXT")]
+    pub search: Option<String>,
+}
+
+/// Arguments for the fuzz command
+#[derive(Parser)]
+pub struct FuzzArgs {
+    #[command(subcommand)]
+    pub command: FuzzCommand,
+}
+
+/// Fuzzing harnesses
+#[derive(Subcommand)]
+pub enum FuzzCommand {
+    /// Emit random VLAN sets as XML, parse them back, and compare
+    Roundtrip(FuzzRoundtripArgs),
+    /// Print seeded random model fragments as JSON lines for external test suites
+    Sample(FuzzSampleArgs),
+}
+
+/// Arguments for fuzz roundtrip
+///
+/// Exits with an error when any emitted value does not parse back unchanged.
+/// Rerunning with the reported seed repeats the failing cases.
+#[derive(Parser)]
+pub struct FuzzRoundtripArgs {
+    /// Number of random cases to check
+    #[arg(short = 'n', long, default_value = "1000")]
+    pub iterations: u32,
+
+    /// Seed for reproducible cases
+    #[arg(long)]
+    pub seed: Option<u64>,
+
+    /// Largest number of VLANs in one case
+    #[arg(long, default_value = "16", value_parser = clap::value_parser!(u16).range(1..=512))]
+    pub max_vlans: u16,
+}
+
+/// Arguments for fuzz sample
+///
+/// Prints one JSON object per line. Fragment `i` depends only on the kind,
+/// the seed, and `i`, so property-based tests in other languages can shrink
+/// or replay a case from its seed and index.
+#[derive(Parser)]
+pub struct FuzzSampleArgs {
+    /// Kind of fragment
+    #[arg(value_enum)]
+    pub kind: FragmentKind,
+
+    /// Seed of the sequence
+    #[arg(long)]
+    pub seed: u64,
+
+    /// Number of fragments
+    #[arg(short = 'n', long, default_value = "1")]
+    pub count: u32,
+
+    /// Index of the first fragment
+    #[arg(long, default_value = "0")]
+    pub start: u64,
+}
+
+/// Model fragment printed by fuzz sample
+#[derive(Clone, Copy, Debug, PartialEq, Eq, ValueEnum)]
+pub enum FragmentKind {
+    /// VLAN with a valid ID and RFC 1918 network
+    Vlan,
+    /// Firewall rule as generated for a VLAN
+    FirewallRule,
+    /// DHCP scope of a VLAN
+    DhcpScope,
+}
+
+/// Arguments for the release-pack command
+///
+/// Writes `<out>/opnsense-fixtures-<version>/` with one directory per profile
+/// (VLAN CSV, factory-default based XML configuration, firewall rules), a
+/// manifest, a summary, and SHA256SUMS. Profiles are seeded, so a pack
+/// version always has the same contents.
+#[derive(Parser)]
+pub struct ReleasePackArgs {
+    /// Profiles to include: small, campus, datacenter
+    #[arg(long, value_delimiter = ',', default_value = "small,campus,datacenter")]
+    pub profiles: Vec<String>,
+
+    /// Directory the pack directory is created in
+    #[arg(long, value_name = "DIR", default_value = "packs")]
+    pub out: PathBuf,
+
+    /// Version of the pack [default: the generator version]
+    #[arg(long, value_name = "VERSION")]
+    pub pack_version: Option<String>,
+
+    /// Replace an existing pack of the same version
+    #[arg(short = 'F', long)]
+    pub force: bool,
+
+    /// Sign manifest.json with this key, writing manifest.json.sig
+    ///
+    /// The manifest records the generator version, the profiles, and the
+    /// SHA-256 of every file, so its signature attests the whole pack.
+    #[arg(long, value_name = "KEY")]
+    pub sign_key: Option<PathBuf>,
+
+    /// Kind of signing key
+    #[arg(long, value_enum, default_value = "ssh", requires = "sign_key")]
+    pub signer: Signer,
+}
+
+/// Arguments for the audit command
+#[derive(Parser)]
+pub struct AuditArgs {
+    #[command(subcommand)]
+    pub command: AuditCommand,
+}
+
+/// Audits
+#[derive(Subcommand)]
+pub enum AuditCommand {
+    /// Check credential complexity and reuse across a fleet
+    Secrets(AuditSecretsArgs),
+}
+
+/// Arguments for audit secrets
+///
+/// Complexity requirements come from the `secrets` section of --policy,
+/// overridden by the individual flags. Exits with an error when any secret
+/// is weak or used in more than one place.
+#[derive(Parser)]
+pub struct AuditSecretsArgs {
+    /// Configuration file, or directory of XML configurations audited as a fleet
+    #[arg(short, long)]
+    pub input: PathBuf,
+
+    /// Policy file whose `secrets` section sets the requirements
+    #[arg(long, value_name = "FILE")]
+    pub policy: Option<PathBuf>,
+
+    /// Fewest characters of a secret [default: 16]
+    #[arg(long)]
+    pub min_length: Option<usize>,
+
+    /// Fewest character classes (lowercase, uppercase, digits, symbols) [default: 3]
+    #[arg(long, value_parser = clap::value_parser!(u8).range(1..=4))]
+    pub min_classes: Option<u8>,
+
+    /// Lowest estimated entropy in bits [default: 64]
+    #[arg(long, value_name = "BITS")]
+    pub min_entropy: Option<u32>,
+}
+
+/// Arguments for the simulate command
+#[derive(Parser)]
+pub struct SimulateArgs {
+    #[command(subcommand)]
+    pub command: SimulateCommand,
+}
+
+/// Simulations
+#[derive(Subcommand)]
+pub enum SimulateCommand {
+    /// Report whether a flow would pass and which rules match it
+    Path(SimulatePathArgs),
+    /// Report which flows of a traffic matrix a new rule would affect
+    Change(SimulateChangeArgs),
+}
+
+/// Arguments for simulate path
+#[derive(Parser)]
+pub struct SimulatePathArgs {
+    /// Source address
+    #[arg(long, value_name = "IP")]
+    pub from: Ipv4Addr,
+
+    /// Destination address
+    #[arg(long, value_name = "IP")]
+    pub to: Ipv4Addr,
+
+    /// Destination port
+    #[arg(long)]
+    pub port: Option<u16>,
+
+    /// Protocol of the flow
+    #[arg(long, value_enum, default_value = "tcp")]
+    pub protocol: FlowProtocol,
+
+    /// Generated output: VLAN CSV, rules CSV, XML, or a directory of them
+    #[arg(short, long, default_value = "output")]
+    pub input: PathBuf,
+
+    /// Exit with an error unless the verdict is this
+    #[arg(long, value_enum)]
+    pub expect: Option<ExpectedVerdict>,
+}
+
+/// Arguments for simulate change
+///
+/// The rule is written as `<pass|block|reject> [tcp|udp|icmp|any] from <addr>
+/// to <addr> [port <ports>] on <interface> [priority <n>]`; without a
+/// priority it goes first on its interface.
+#[derive(Parser)]
+pub struct SimulateChangeArgs {
+    /// Rule to add, e.g. "block tcp from 10.10.20.x to any port 445 on vlan120"
+    #[arg(long, value_name = "SPEC")]
+    pub add_rule: String,
+
+    /// Generated output: VLAN CSV, rules CSV, XML, or a directory of them
+    #[arg(short, long, default_value = "output")]
+    pub input: PathBuf,
+
+    /// Largest number of flows traced from the traffic matrix
+    #[arg(long, default_value = "2000")]
+    pub samples: usize,
+
+    /// Seed for sampling the traffic matrix
+    #[arg(long, default_value = "0")]
+    pub seed: u64,
+}
+
+/// Protocol of a simulated flow
+#[derive(Clone, Copy, Debug, PartialEq, Eq, ValueEnum)]
+pub enum FlowProtocol {
+    Tcp,
+    Udp,
+    Icmp,
+}
+
+impl FlowProtocol {
+    /// Name as used in firewall rules
+    pub fn as_str(self) -> &'static str {
+        match self {
+            FlowProtocol::Tcp => "tcp",
+            FlowProtocol::Udp => "udp",
+            FlowProtocol::Icmp => "icmp",
+        }
+    }
+}
+
+/// Verdict --expect requires
+#[derive(Clone, Copy, Debug, PartialEq, Eq, ValueEnum)]
+pub enum ExpectedVerdict {
+    /// The flow reaches its destination
+    Pass,
+    /// The flow is blocked or not routed
+    Block,
+}
+
+/// Arguments for the export command
+#[derive(Parser)]
+pub struct ExportArgs {
+    #[command(subcommand)]
+    pub command: ExportCommand,
+}
+
+/// Export operations
+#[derive(Subcommand)]
+pub enum ExportCommand {
+    /// Export the object dependency graph for impact-analysis tooling
+    Graph(ExportGraphArgs),
+}
+
+/// Arguments for export graph
+///
+/// Edges run from rules to the interfaces, aliases, and addresses they use,
+/// from aliases to nested aliases and hosts, from interfaces to VLANs and
+/// ports, from VLANs to their parents, and from services to certificates
+/// and their authorities. The graph is printed to stdout, or written to the
+/// global --output.
+#[derive(Parser)]
+pub struct ExportGraphArgs {
+    /// Configuration to export
+    #[arg(short, long)]
+    pub input: PathBuf,
+
+    /// Graph format
+    #[arg(short = 'f', long, value_enum, default_value = "graphml")]
+    pub format: GraphFormat,
+}
+
+/// Arguments for the score command
+///
+/// The score is the weighted mean of a lint, a complexity, and a coverage
+/// component, each from 0 to 100. The model file (YAML) tunes weights,
+/// thresholds, rules, and targets; without one the built-in model is used.
+/// A summary is printed unless --quiet; the full report is written as JSON
+/// to the global --output. Fails when the score is below the threshold.
+#[derive(Parser)]
+pub struct ScoreArgs {
+    /// Configuration to score
+    #[arg(short, long)]
+    pub input: PathBuf,
+
+    /// Scoring model file
+    #[arg(short, long, value_name = "FILE")]
+    pub model: Option<PathBuf>,
+
+    /// Additional lint rule files, checked alongside the model's rules
+    #[arg(long, value_name = "FILE")]
+    pub rules: Vec<PathBuf>,
+
+    /// Lowest passing score, overriding the model's threshold
+    #[arg(long, value_name = "SCORE", value_parser = clap::value_parser!(u8).range(0..=100))]
+    pub min_score: Option<u8>,
+}
+
+/// Serialization of an exported graph
+#[derive(Clone, Copy, Debug, PartialEq, Eq, ValueEnum)]
+pub enum GraphFormat {
+    /// GraphML, read by yEd, Gephi, and NetworkX
+    Graphml,
+    /// JSON with node and edge lists
+    Json,
+}
+
+/// Arguments for the schema command
+#[derive(Parser)]
+pub struct SchemaArgs {
+    #[command(subcommand)]
+    pub command: SchemaCommand,
+}
+
+/// Schema operations
+#[derive(Subcommand)]
+pub enum SchemaCommand {
+    /// Print the schema of an input file for editors and CI validators
+    Export(SchemaExportArgs),
+}
+
+/// Arguments for schema export
+///
+/// The schema is printed to stdout, or written to the global --output.
+#[derive(Parser)]
+pub struct SchemaExportArgs {
+    /// Input file to describe
+    #[arg(long = "type", value_enum)]
+    pub kind: SchemaType,
+
+    /// Schema language
+    #[arg(short = 'f', long, value_enum, default_value = "jsonschema")]
+    pub format: SchemaFormat,
+}
+
+/// Input file a schema is exported for
+#[derive(Clone, Copy, Debug, PartialEq, Eq, ValueEnum)]
+pub enum SchemaType {
+    /// VLAN seed data read by generate --csv-file
+    Seed,
+    /// Scenario definitions read by compose
+    Scenario,
+}
+
+impl From<SchemaType> for SchemaKind {
+    fn from(kind: SchemaType) -> Self {
+        match kind {
+            SchemaType::Seed => SchemaKind::Seed,
+            SchemaType::Scenario => SchemaKind::Scenario,
+        }
+    }
+}
+
+/// Schema language for schema export
+#[derive(Clone, Copy, Debug, PartialEq, Eq, ValueEnum)]
+pub enum SchemaFormat {
+    /// JSON Schema (draft 2020-12)
+    #[value(name = "jsonschema")]
+    JsonSchema,
+}
+
+/// Build tool for generated fixture targets
+#[derive(Clone, Debug, ValueEnum)]
+pub enum BuildTool {
+    /// Generate a justfile
+    Just,
+    /// Generate a Makefile
+    Make,
+}
+
+/// Arguments for the apply command
+///
+/// VLANs are read from generated output and each is pushed as a VLAN
+/// interface and a network alias, in rate-limited batches that are retried
+/// with backoff when the firewall is busy. With --checkpoint, an interrupted
+/// apply resumes where it stopped. The firewall's configuration is saved to
+/// the snapshot directory first; --rollback restores such a snapshot.
+#[derive(Parser)]
+pub struct ApplyArgs {
+    /// Generated output to apply (CSV file, XML file, or XML directory)
+    #[arg(short, long, required_unless_present = "rollback")]
+    pub input: Option<PathBuf>,
+
+    /// Firewall to apply to
+    #[command(flatten)]
+    pub target: ApiTargetArgs,
+
+    /// Firewall rules CSV written by `generate --include-firewall-rules` to push as well
+    ///
+    /// That is `<name>_firewall_rules.csv` next to a CSV output, or
+    /// `firewall_<N>_rules.csv` in an XML output directory.
+    #[arg(long, value_name = "FILE")]
+    pub firewall_rules: Option<PathBuf>,
+
+    /// Passphrase of an encrypted XML input
+    #[arg(long)]
+    pub backup_passphrase: Option<String>,
+
+    /// Labels file written by `generate --labels` for the input
+    #[arg(long, value_name = "FILE")]
+    pub labels: Option<PathBuf>,
+
+    /// Apply only objects whose labels match, e.g. "site=hq" or "tier!=core"
+    ///
+    /// Terms are comma-separated; repeat the flag or combine terms to require
+    /// all of them. Firewall rules are kept when the labels of their VLAN
+    /// match.
+    #[arg(long, value_name = "SELECTOR", requires = "labels", value_parser = parse_label_selector)]
+    pub filter: Vec<LabelSelector>,
+
+    /// Objects sent per batch
+    #[arg(long, default_value_t = 50)]
+    #[arg(value_parser = clap::value_parser!(u16).range(1..))]
+    pub batch_size: u16,
+
+    /// Maximum batches per second; 0 disables the limit
+    #[arg(long, default_value_t = 2.0)]
+    pub rate: f64,
+
+    /// Retries of a failed batch, with exponential backoff
+    #[arg(long, default_value_t = 5)]
+    pub max_retries: u32,
+
+    /// Progress file an interrupted apply resumes from
+    #[arg(long, value_name = "FILE")]
+    pub checkpoint: Option<PathBuf>,
+
+    /// Directory the firewall's configuration is saved to before pushing
+    #[arg(long, value_name = "DIR", default_value = "snapshots")]
+    pub snapshot_dir: PathBuf,
+
+    /// Push without saving a snapshot first
+    #[arg(long)]
+    pub no_snapshot: bool,
+
+    /// Restore the firewall from a snapshot instead of applying (needs --ssh)
+    #[arg(long, value_name = "SNAPSHOT", conflicts_with_all = ["input", "dry_run"])]
+    pub rollback: Option<PathBuf>,
+
+    /// Push without showing the plan and asking for confirmation
+    ///
+    /// Otherwise the firewall's current configuration is fetched, the changes
+    /// the push would make are listed, and only "yes" applies them.
+    #[arg(long)]
+    pub auto_approve: bool,
+
+    /// Show what would be pushed without contacting the firewall
+    #[arg(long)]
+    pub dry_run: bool,
+}
+
+/// Connection to a firewall's REST API
+///
+/// Requests are made with curl, which must be installed.
+#[derive(Parser, Default)]
+pub struct ApiTargetArgs {
+    /// Base URL of the firewall, e.g. https://192.168.1.1
+    #[arg(long, value_name = "URL")]
+    pub url: Option<String>,
+
+    /// API key of a user allowed to edit VLANs, aliases, and rules
+    #[arg(long, env = "OPNSENSE_API_KEY", hide_env_values = true)]
+    pub api_key: Option<String>,
+
+    /// Secret of the API key
+    #[arg(long, env = "OPNSENSE_API_SECRET", hide_env_values = true)]
+    pub api_secret: Option<String>,
+
+    /// Physical device VLANs are created on, e.g. igb1
+    #[arg(long, value_name = "DEVICE")]
+    pub parent_interface: Option<String>,
+
+    /// Accept a self-signed certificate, as lab firewalls usually have
+    #[arg(long)]
+    pub insecure: bool,
+
+    /// SSH destination for restoring snapshots, e.g. root@192.168.1.1
+    ///
+    /// The API cannot upload a whole configuration, so a snapshot is copied
+    /// to /conf/config.xml over SSH and the firewall reloads it.
+    #[arg(long, value_name = "DEST")]
+    pub ssh: Option<String>,
 }
 
 /// Validation input format
@@ -391,65 +1612,45 @@ pub enum ValidationFormat {
     Xml,
 }
 
-/// Parse VLAN range specification into individual ranges
-/// Supports formats like "100-150", "10,20,30-40", "100"
-pub fn parse_vlan_range(range_str: &str) -> Result<Vec<(u16, u16)>, String> {
-    let mut ranges = Vec::new();
-
-    for part in range_str.split(',') {
-        let part = part.trim();
-        if part.is_empty() {
-            continue;
-        }
-
-        if part.contains('-') {
-            let parts: Vec<&str> = part.split('-').collect();
-            if parts.len() != 2 {
-                return Err(format!("Invalid range format: '{}'", part));
-            }
-
-            let start: u16 = parts[0]
-                .trim()
-                .parse()
-                .map_err(|_| format!("Invalid start VLAN ID: '{}'", parts[0]))?;
-            let end: u16 = parts[1]
-                .trim()
-                .parse()
-                .map_err(|_| format!("Invalid end VLAN ID: '{}'", parts[1]))?;
-
-            if start > end {
-                return Err(format!(
-                    "Start VLAN ID {} must be less than or equal to end VLAN ID {}",
-                    start, end
-                ));
-            }
-
-            if !(10..=4094).contains(&start) || !(10..=4094).contains(&end) {
-                return Err(format!(
-                    "VLAN IDs must be between 10 and 4094, got range {}-{}",
-                    start, end
-                ));
-            }
-
-            ranges.push((start, end));
-        } else {
-            let vlan_id: u16 = part
-                .parse()
-                .map_err(|_| format!("Invalid VLAN ID: '{}'", part))?;
+/// Parse a --description-style specification
+fn parse_description_styles(spec: &str) -> Result<DescriptionStyles, String> {
+    spec.parse()
+        .map_err(|e: crate::model::ConfigError| e.to_string())
+}
 
-            if !(10..=4094).contains(&vlan_id) {
-                return Err(format!("VLAN ID {} must be between 10 and 4094", vlan_id));
-            }
+/// Parse a --filter label selector
+fn parse_label_selector(spec: &str) -> Result<LabelSelector, String> {
+    spec.parse()
+        .map_err(|e: crate::model::ConfigError| e.to_string())
+}
 
-            ranges.push((vlan_id, vlan_id));
+/// Parse a --interval duration such as "90s", "5m", "2h", or "1d"
+///
+/// A bare number is taken as seconds.
+pub fn parse_interval(spec: &str) -> Result<Duration, String> {
+    let spec = spec.trim();
+    let split = spec
+        .find(|c: char| !c.is_ascii_digit())
+        .unwrap_or(spec.len());
+    let (number, unit) = spec.split_at(split);
+    let number: u64 = number
+        .parse()
+        .map_err(|_| format!("'{spec}' is not a duration like 30s, 5m, 2h, or 1d"))?;
+    let seconds = match unit {
+        "" | "s" => number,
+        "m" => number.saturating_mul(60),
+        "h" => number.saturating_mul(3600),
+        "d" => number.saturating_mul(86400),
+        _ => {
+            return Err(format!(
+                "unknown unit '{unit}' in '{spec}'; use s, m, h, or d"
+            ));
         }
+    };
+    if seconds == 0 {
+        return Err("interval must be at least one second".to_string());
     }
-
-    if ranges.is_empty() {
-        return Err("No valid VLAN ranges found".to_string());
-    }
-
-    Ok(ranges)
+    Ok(Duration::from_secs(seconds))
 }
 
 #[cfg(test)]
@@ -457,22 +1658,14 @@ mod tests {
     use super::*;
 
     #[test]
-    fn test_parse_vlan_range() {
-        // Test single VLAN
-        let ranges = parse_vlan_range("100").unwrap();
-        assert_eq!(ranges, vec![(100, 100)]);
-
-        // Test simple range
-        let ranges = parse_vlan_range("100-150").unwrap();
-        assert_eq!(ranges, vec![(100, 150)]);
-
-        // Test multiple ranges
-        let ranges = parse_vlan_range("10,20-30,40").unwrap();
-        assert_eq!(ranges, vec![(10, 10), (20, 30), (40, 40)]);
-
-        // Test invalid range
-        assert!(parse_vlan_range("150-100").is_err());
-        assert!(parse_vlan_range("5-10").is_err()); // Below minimum
-        assert!(parse_vlan_range("4095-5000").is_err()); // Above maximum
+    fn test_parse_interval() {
+        assert_eq!(parse_interval("30s"), Ok(Duration::from_secs(30)));
+        assert_eq!(parse_interval("5m"), Ok(Duration::from_secs(300)));
+        assert_eq!(parse_interval("2h"), Ok(Duration::from_secs(7200)));
+        assert_eq!(parse_interval("1d"), Ok(Duration::from_secs(86400)));
+        assert_eq!(parse_interval("45"), Ok(Duration::from_secs(45)));
+        assert!(parse_interval("0m").is_err());
+        assert!(parse_interval("5w").is_err());
+        assert!(parse_interval("m").is_err());
     }
 }
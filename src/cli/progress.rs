@@ -0,0 +1,297 @@
+//! Progress output modes
+//!
+//! Commands create progress indicators through [`bar`] and [`spinner`] so the
+//! mode selected with `--progress` applies everywhere. Besides the redrawn
+//! bar, a plain mode writes occasional single-line updates without ANSI
+//! control sequences, which screen readers and log files can follow. When
+//! stderr is not a terminal, `auto` selects plain updates.
+
+use crate::cli::theme;
+use clap::ValueEnum;
+use indicatif::{ProgressBar, ProgressDrawTarget, ProgressStyle, TermLike};
+use std::env;
+use std::io::{self, IsTerminal, Write};
+use std::sync::Mutex;
+use std::sync::atomic::{AtomicU8, Ordering};
+use std::time::{Duration, Instant};
+
+/// Environment variable selecting the mode when --progress is not given
+pub const PROGRESS_ENV: &str = "OPNSENSE_CONFIG_FAKER_PROGRESS";
+
+/// Minimum time between two plain updates of the same step
+const PLAIN_INTERVAL: Duration = Duration::from_secs(2);
+
+/// Active mode, stored as its discriminant
+static ACTIVE_MODE: AtomicU8 = AtomicU8::new(ProgressMode::Auto as u8);
+
+/// How progress is reported
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq, ValueEnum)]
+#[repr(u8)]
+pub enum ProgressMode {
+    /// Bars on a terminal, plain updates otherwise
+    #[default]
+    Auto = 0,
+    /// Redrawn progress bars and spinners
+    Bar = 1,
+    /// Periodic single-line text updates without control sequences
+    Plain = 2,
+    /// No progress output
+    None = 3,
+}
+
+impl ProgressMode {
+    fn from_u8(value: u8) -> Self {
+        match value {
+            1 => ProgressMode::Bar,
+            2 => ProgressMode::Plain,
+            3 => ProgressMode::None,
+            _ => ProgressMode::Auto,
+        }
+    }
+}
+
+/// Select the progress mode
+///
+/// `mode` is the `--progress` flag. Call once at startup, before any output.
+pub fn init(mode: Option<ProgressMode>) {
+    let mode = resolve_mode(mode, io::stderr().is_terminal(), |name| env::var(name).ok());
+    ACTIVE_MODE.store(mode as u8, Ordering::Relaxed);
+}
+
+/// Decide the progress mode from the flag, environment, and terminal
+///
+/// Precedence: `--progress`, then [`PROGRESS_ENV`]; `auto` (or an
+/// unrecognized value) becomes bars on a terminal and plain updates otherwise.
+pub fn resolve_mode<F>(mode: Option<ProgressMode>, is_terminal: bool, var: F) -> ProgressMode
+where
+    F: Fn(&str) -> Option<String>,
+{
+    let mode = mode
+        .or_else(|| var(PROGRESS_ENV).and_then(|v| ProgressMode::from_str(v.trim(), true).ok()))
+        .unwrap_or_default();
+    match mode {
+        ProgressMode::Auto if is_terminal => ProgressMode::Bar,
+        ProgressMode::Auto => ProgressMode::Plain,
+        other => other,
+    }
+}
+
+/// Currently selected mode, resolved to bar, plain, or none
+pub fn current() -> ProgressMode {
+    match ProgressMode::from_u8(ACTIVE_MODE.load(Ordering::Relaxed)) {
+        ProgressMode::Auto => resolve_mode(None, io::stderr().is_terminal(), |_| None),
+        mode => mode,
+    }
+}
+
+/// Progress bar for `total` steps
+pub fn bar(total: u64, message: &str) -> ProgressBar {
+    let pb = match current() {
+        ProgressMode::Auto | ProgressMode::Bar => {
+            let pb = ProgressBar::new(total);
+            // The theme falls back to a plain template when colors are disabled
+            pb.set_style(theme::progress_bar_style());
+            pb
+        }
+        ProgressMode::Plain => {
+            let pb = ProgressBar::with_draw_target(Some(total), plain_target());
+            pb.set_style(plain_style("{msg} [{pos}/{len}]"));
+            pb
+        }
+        ProgressMode::None => ProgressBar::hidden(),
+    };
+    pb.set_message(message.to_string());
+    pb
+}
+
+/// Spinner for work of unknown length
+pub fn spinner(message: &str) -> ProgressBar {
+    let pb = match current() {
+        ProgressMode::Auto | ProgressMode::Bar => {
+            let pb = ProgressBar::new_spinner();
+            pb.set_style(theme::spinner_style());
+            pb
+        }
+        ProgressMode::Plain => {
+            let pb = ProgressBar::with_draw_target(None, plain_target());
+            pb.set_style(plain_style("{msg}"));
+            pb
+        }
+        ProgressMode::None => ProgressBar::hidden(),
+    };
+    pb.set_message(message.to_string());
+    pb
+}
+
+fn plain_target() -> ProgressDrawTarget {
+    ProgressDrawTarget::term_like(Box::new(PlainLines::new(io::stderr(), PLAIN_INTERVAL)))
+}
+
+fn plain_style(template: &str) -> ProgressStyle {
+    ProgressStyle::default_bar()
+        .template(template)
+        .unwrap_or_else(|_| ProgressStyle::default_bar())
+}
+
+/// Draw target that appends lines instead of redrawing them
+///
+/// indicatif redraws many times a second; a line is only written when the
+/// message changes, the step count completes, or [`PLAIN_INTERVAL`] has
+/// passed since the previous line. Cursor movement and clearing are ignored.
+struct PlainLines<W> {
+    state: Mutex<PlainState<W>>,
+    interval: Duration,
+}
+
+struct PlainState<W> {
+    out: W,
+    last_line: String,
+    last_written: Option<Instant>,
+}
+
+impl<W> std::fmt::Debug for PlainLines<W> {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        f.debug_struct("PlainLines")
+            .field("interval", &self.interval)
+            .finish_non_exhaustive()
+    }
+}
+
+impl<W: Write> PlainLines<W> {
+    fn new(out: W, interval: Duration) -> Self {
+        Self {
+            state: Mutex::new(PlainState {
+                out,
+                last_line: String::new(),
+                last_written: None,
+            }),
+            interval,
+        }
+    }
+
+    fn offer(&self, line: &str) -> io::Result<()> {
+        let line = line.trim_end();
+        let mut state = self.state.lock().unwrap_or_else(|e| e.into_inner());
+        if line.is_empty() || line == state.last_line {
+            return Ok(());
+        }
+
+        let (message, count) = split_count(line);
+        let due = state
+            .last_written
+            .is_none_or(|at| at.elapsed() >= self.interval);
+        let changed_step = message != split_count(&state.last_line).0;
+        let complete = count.is_some_and(|(pos, len)| pos == len);
+        if due || changed_step || complete {
+            writeln!(state.out, "{line}")?;
+            state.last_line = line.to_string();
+            state.last_written = Some(Instant::now());
+        }
+        Ok(())
+    }
+}
+
+/// Split a plain line into its message and `[pos/len]` counter
+fn split_count(line: &str) -> (&str, Option<(u64, u64)>) {
+    let Some((message, counter)) = line.rsplit_once(" [") else {
+        return (line, None);
+    };
+    let count = counter
+        .strip_suffix(']')
+        .and_then(|c| c.split_once('/'))
+        .and_then(|(pos, len)| Some((pos.parse().ok()?, len.parse().ok()?)));
+    match count {
+        Some(count) => (message, Some(count)),
+        None => (line, None),
+    }
+}
+
+impl<W: Write + Send + 'static> TermLike for PlainLines<W> {
+    fn width(&self) -> u16 {
+        // Wide enough that indicatif never truncates a message
+        1024
+    }
+
+    fn move_cursor_up(&self, _n: usize) -> io::Result<()> {
+        Ok(())
+    }
+
+    fn move_cursor_down(&self, _n: usize) -> io::Result<()> {
+        Ok(())
+    }
+
+    fn move_cursor_right(&self, _n: usize) -> io::Result<()> {
+        Ok(())
+    }
+
+    fn move_cursor_left(&self, _n: usize) -> io::Result<()> {
+        Ok(())
+    }
+
+    fn write_line(&self, s: &str) -> io::Result<()> {
+        self.offer(s)
+    }
+
+    fn write_str(&self, s: &str) -> io::Result<()> {
+        self.offer(s)
+    }
+
+    fn clear_line(&self) -> io::Result<()> {
+        Ok(())
+    }
+
+    fn flush(&self) -> io::Result<()> {
+        self.state
+            .lock()
+            .unwrap_or_else(|e| e.into_inner())
+            .out
+            .flush()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_resolve_mode_precedence() {
+        let env = |value: &'static str| {
+            move |name: &str| (name == PROGRESS_ENV).then(|| value.to_string())
+        };
+        assert_eq!(resolve_mode(None, true, |_| None), ProgressMode::Bar);
+        assert_eq!(resolve_mode(None, false, |_| None), ProgressMode::Plain);
+        assert_eq!(resolve_mode(None, true, env("plain")), ProgressMode::Plain);
+        assert_eq!(resolve_mode(None, false, env("none")), ProgressMode::None);
+        assert_eq!(resolve_mode(None, false, env("bogus")), ProgressMode::Plain);
+        assert_eq!(
+            resolve_mode(Some(ProgressMode::Bar), false, env("none")),
+            ProgressMode::Bar
+        );
+    }
+
+    #[test]
+    fn test_plain_lines_throttle_redraws() {
+        let lines = PlainLines::new(Vec::new(), Duration::from_secs(3600));
+        for line in [
+            "Generating VLANs [0/3]",
+            "Generating VLANs [1/3]",
+            "Generating VLANs [1/3]",
+            "Generating VLANs [2/3]",
+            "Generating VLANs [3/3]",
+            "Writing CSV file... [3/3]",
+            "",
+        ] {
+            lines.move_cursor_up(1).unwrap();
+            lines.clear_line().unwrap();
+            lines.write_str(line).unwrap();
+        }
+
+        let out = lines.state.into_inner().unwrap().out;
+        let out = String::from_utf8(out).unwrap();
+        assert_eq!(
+            out,
+            "Generating VLANs [0/3]\nGenerating VLANs [3/3]\nWriting CSV file... [3/3]\n"
+        );
+        assert!(!out.contains('\x1b'));
+    }
+}
@@ -0,0 +1,253 @@
+//! Central terminal styling: color themes and color enablement
+//!
+//! Commands never pick colors directly. They style text by semantic [`Role`]
+//! through [`paint`] and take progress bar styles from this module, so the
+//! selected [`Theme`] and the color switches (`--no-color`, `NO_COLOR`,
+//! `FORCE_COLOR`, `TERM=dumb`) apply uniformly to headers, summaries,
+//! progress bars, and diff output.
+
+use clap::ValueEnum;
+use console::{Color, Style, StyledObject};
+use indicatif::ProgressStyle;
+use std::env;
+use std::sync::atomic::{AtomicU8, Ordering};
+
+/// Active theme, stored as its discriminant
+static ACTIVE_THEME: AtomicU8 = AtomicU8::new(Theme::Default as u8);
+
+/// Color palette for terminal output
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq, ValueEnum)]
+#[repr(u8)]
+pub enum Theme {
+    /// Standard palette
+    #[default]
+    Default = 0,
+    /// Bold, bright colors for low-vision users and washed-out terminals
+    HighContrast = 1,
+    /// Blue/orange palette distinguishable with red-green color blindness
+    ColorblindSafe = 2,
+}
+
+/// Semantic role of a piece of styled text
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub enum Role {
+    /// Command banner
+    Title,
+    /// Section heading such as "Summary:"
+    Heading,
+    /// Successful outcome
+    Success,
+    /// Warning or deprecation notice
+    Warning,
+    /// Failure
+    Error,
+    /// Commands, paths, and other highlighted values
+    Accent,
+    /// Added lines in diff output
+    Added,
+    /// Removed lines in diff output
+    Removed,
+}
+
+impl Theme {
+    fn from_u8(value: u8) -> Self {
+        match value {
+            1 => Theme::HighContrast,
+            2 => Theme::ColorblindSafe,
+            _ => Theme::Default,
+        }
+    }
+
+    /// Style used for a role in this theme
+    pub fn style(self, role: Role) -> Style {
+        let base = Style::new();
+        match (self, role) {
+            (Theme::Default, Role::Title) => base.bold().blue(),
+            (Theme::Default, Role::Heading) => base.bold(),
+            (Theme::Default, Role::Success) => base.green(),
+            (Theme::Default, Role::Warning) => base.bold().yellow(),
+            (Theme::Default, Role::Error) => base.bold().red(),
+            (Theme::Default, Role::Accent) => base.cyan(),
+            (Theme::Default, Role::Added) => base.green(),
+            (Theme::Default, Role::Removed) => base.red(),
+
+            (Theme::HighContrast, Role::Title) => base.bold().white().bright().underlined(),
+            (Theme::HighContrast, Role::Heading) => base.bold().white().bright(),
+            (Theme::HighContrast, Role::Success) => base.bold().green().bright(),
+            (Theme::HighContrast, Role::Warning) => base.bold().yellow().bright(),
+            (Theme::HighContrast, Role::Error) => base.bold().red().bright(),
+            (Theme::HighContrast, Role::Accent) => base.bold().cyan().bright(),
+            (Theme::HighContrast, Role::Added) => base.bold().green().bright(),
+            (Theme::HighContrast, Role::Removed) => base.bold().red().bright(),
+
+            // Okabe-Ito inspired: blue for good/added, orange for bad/removed
+            (Theme::ColorblindSafe, Role::Title) => base.bold().blue(),
+            (Theme::ColorblindSafe, Role::Heading) => base.bold(),
+            (Theme::ColorblindSafe, Role::Success) => base.fg(Color::Color256(33)),
+            (Theme::ColorblindSafe, Role::Warning) => base.bold().fg(Color::Color256(220)),
+            (Theme::ColorblindSafe, Role::Error) => base.bold().fg(Color::Color256(208)),
+            (Theme::ColorblindSafe, Role::Accent) => base.fg(Color::Color256(75)),
+            (Theme::ColorblindSafe, Role::Added) => base.fg(Color::Color256(33)),
+            (Theme::ColorblindSafe, Role::Removed) => base.fg(Color::Color256(208)),
+        }
+    }
+
+    /// Spinner and bar colors in indicatif template syntax
+    fn progress_colors(self) -> (&'static str, &'static str) {
+        match self {
+            Theme::Default => ("green", "cyan/blue"),
+            Theme::HighContrast => ("white.bold", "white.bold/black"),
+            Theme::ColorblindSafe => ("33", "33/208"),
+        }
+    }
+}
+
+/// Select the theme and decide whether colors are emitted
+///
+/// `no_color` is the `--no-color` flag. Call once at startup, before any output.
+pub fn init(theme: Theme, no_color: bool) {
+    ACTIVE_THEME.store(theme as u8, Ordering::Relaxed);
+    if let Some(enabled) = resolve_colors(no_color, |name| env::var(name).ok()) {
+        console::set_colors_enabled(enabled);
+        console::set_colors_enabled_stderr(enabled);
+    }
+}
+
+/// Decide color output from the flag and environment
+///
+/// Returns `Some(true)` to force colors, `Some(false)` to disable them, and
+/// `None` to keep terminal auto-detection. Precedence: `--no-color`, then
+/// `FORCE_COLOR` (`0`/`false` disables), then `NO_COLOR` (set to any value,
+/// even empty), then `TERM=dumb`.
+pub fn resolve_colors<F>(no_color: bool, var: F) -> Option<bool>
+where
+    F: Fn(&str) -> Option<String>,
+{
+    if no_color {
+        return Some(false);
+    }
+    if let Some(force) = var("FORCE_COLOR") {
+        return Some(!matches!(force.trim(), "0" | "false"));
+    }
+    if var("NO_COLOR").is_some() {
+        return Some(false);
+    }
+    if var("TERM").is_some_and(|t| t == "dumb") {
+        return Some(false);
+    }
+    None
+}
+
+/// Currently selected theme
+pub fn current() -> Theme {
+    Theme::from_u8(ACTIVE_THEME.load(Ordering::Relaxed))
+}
+
+/// Style a value for stdout according to its role and the active theme
+pub fn paint<D>(role: Role, value: D) -> StyledObject<D> {
+    current().style(role).apply_to(value)
+}
+
+/// Progress bar style for determinate work
+///
+/// Falls back to a message-only template when colors are disabled, matching
+/// the plain output expected in CI logs and dumb terminals.
+pub fn progress_bar_style() -> ProgressStyle {
+    if !console::colors_enabled_stderr() {
+        return plain_style();
+    }
+    let (spinner, bar) = current().progress_colors();
+    ProgressStyle::default_bar()
+        .template(&format!(
+            "{{spinner:.{spinner}}} [{{elapsed_precise}}] [{{bar:40.{bar}}}] {{pos}}/{{len}} {{msg}}"
+        ))
+        .unwrap_or_else(|_| ProgressStyle::default_bar())
+        .progress_chars("#>-")
+}
+
+/// Spinner style for work of unknown length
+pub fn spinner_style() -> ProgressStyle {
+    if !console::colors_enabled_stderr() {
+        return plain_style();
+    }
+    let (spinner, _) = current().progress_colors();
+    ProgressStyle::default_spinner()
+        .template(&format!(
+            "{{spinner:.{spinner}}} {{elapsed_precise}} {{msg}}"
+        ))
+        .unwrap_or_else(|_| ProgressStyle::default_spinner())
+}
+
+fn plain_style() -> ProgressStyle {
+    ProgressStyle::default_spinner()
+        .template("{msg}")
+        .unwrap_or_else(|_| ProgressStyle::default_spinner())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::collections::HashMap;
+
+    fn lookup(vars: &[(&str, &str)]) -> impl Fn(&str) -> Option<String> {
+        let map: HashMap<String, String> = vars
+            .iter()
+            .map(|(k, v)| (k.to_string(), v.to_string()))
+            .collect();
+        move |name| map.get(name).cloned()
+    }
+
+    #[test]
+    fn test_resolve_colors_precedence() {
+        assert_eq!(resolve_colors(false, lookup(&[])), None);
+        assert_eq!(
+            resolve_colors(true, lookup(&[("FORCE_COLOR", "1")])),
+            Some(false)
+        );
+        assert_eq!(
+            resolve_colors(false, lookup(&[("FORCE_COLOR", "1"), ("NO_COLOR", "1")])),
+            Some(true)
+        );
+        assert_eq!(
+            resolve_colors(false, lookup(&[("FORCE_COLOR", "0")])),
+            Some(false)
+        );
+        assert_eq!(
+            resolve_colors(false, lookup(&[("NO_COLOR", "1")])),
+            Some(false)
+        );
+        // Set but empty still disables, as before the theme support
+        assert_eq!(
+            resolve_colors(false, lookup(&[("NO_COLOR", "")])),
+            Some(false)
+        );
+        assert_eq!(
+            resolve_colors(false, lookup(&[("TERM", "dumb")])),
+            Some(false)
+        );
+    }
+
+    #[test]
+    fn test_themes_distinguish_added_and_removed() {
+        for theme in [Theme::Default, Theme::HighContrast, Theme::ColorblindSafe] {
+            let added = theme.style(Role::Added).force_styling(true).apply_to("x");
+            let removed = theme.style(Role::Removed).force_styling(true).apply_to("x");
+            assert_ne!(added.to_string(), removed.to_string(), "{theme:?}");
+        }
+    }
+
+    #[test]
+    fn test_colorblind_theme_avoids_red_green() {
+        let success = Theme::ColorblindSafe
+            .style(Role::Success)
+            .force_styling(true)
+            .apply_to("ok")
+            .to_string();
+        let green = Style::new()
+            .green()
+            .force_styling(true)
+            .apply_to("ok")
+            .to_string();
+        assert_ne!(success, green);
+    }
+}
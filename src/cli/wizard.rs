@@ -0,0 +1,241 @@
+//! Saved answers of the interactive generate wizard
+//!
+//! `generate --interactive` records every answer in a session file as soon as
+//! it is given. When the wizard is interrupted, the next interactive run in
+//! the same directory offers to resume and skips the questions already
+//! answered. The answers, together with the other generate arguments, can be
+//! exported as a [`Scenario`] so an interactively explored setup becomes a
+//! declarative, versionable fixture definition.
+
+use crate::Result;
+use crate::cli::{GenerateArgs, OutputFormat};
+use crate::model::ConfigError;
+use crate::model::scenario::{Scenario, ScenarioFormat};
+use serde::{Deserialize, Serialize};
+use std::fs;
+use std::path::{Path, PathBuf};
+
+/// Session file used when --session is not given
+pub const DEFAULT_SESSION_FILE: &str = ".opnsense-config-faker-wizard.json";
+
+/// Answers given so far; `None` means the question is still open
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct WizardAnswers {
+    /// Format the answers apply to; a session for another format is not resumed
+    pub format: ScenarioFormat,
+    /// CSV output file
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub output: Option<PathBuf>,
+    /// Base configuration for XML output
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub base_config: Option<PathBuf>,
+    /// Number of VLANs for XML output
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub count: Option<u16>,
+    /// Seed chosen for a scenario export, kept so a resumed run matches it
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub seed: Option<u64>,
+}
+
+impl WizardAnswers {
+    /// No answers yet
+    pub fn new(format: ScenarioFormat) -> Self {
+        Self {
+            format,
+            output: None,
+            base_config: None,
+            count: None,
+            seed: None,
+        }
+    }
+
+    /// Whether any question has been answered
+    pub fn is_empty(&self) -> bool {
+        *self == Self::new(self.format)
+    }
+}
+
+/// Wizard answers backed by a session file
+#[derive(Debug)]
+pub struct WizardSession {
+    path: PathBuf,
+    /// Answers given so far
+    pub answers: WizardAnswers,
+    resumed: bool,
+}
+
+impl WizardSession {
+    /// Open the session at `path`, picking up saved answers for `format`
+    ///
+    /// A missing file, or one saved for another format, starts an empty
+    /// session.
+    pub fn open(path: &Path, format: ScenarioFormat) -> Result<Self> {
+        let saved = if path.exists() {
+            let content = fs::read_to_string(path)?;
+            let answers: WizardAnswers = serde_json::from_str(&content).map_err(|e| {
+                ConfigError::config(format!(
+                    "Wizard session {} is corrupt ({e}); delete it to start over",
+                    path.display()
+                ))
+            })?;
+            Some(answers).filter(|a| a.format == format && !a.is_empty())
+        } else {
+            None
+        };
+
+        Ok(Self {
+            path: path.to_path_buf(),
+            resumed: saved.is_some(),
+            answers: saved.unwrap_or_else(|| WizardAnswers::new(format)),
+        })
+    }
+
+    /// Whether saved answers were found
+    pub fn is_resumed(&self) -> bool {
+        self.resumed
+    }
+
+    /// Session file path
+    pub fn path(&self) -> &Path {
+        &self.path
+    }
+
+    /// Discard saved answers and start over
+    pub fn reset(&mut self) {
+        self.answers = WizardAnswers::new(self.answers.format);
+        self.resumed = false;
+    }
+
+    /// Write the answers atomically (write + rename)
+    pub fn save(&self) -> Result<()> {
+        let tmp = self.path.with_extension("tmp");
+        fs::write(&tmp, serde_json::to_string_pretty(&self.answers)?)?;
+        fs::rename(&tmp, &self.path)?;
+        Ok(())
+    }
+
+    /// Remove the session file once the run has completed
+    pub fn finish(self) -> Result<()> {
+        if self.path.exists() {
+            fs::remove_file(&self.path)?;
+        }
+        Ok(())
+    }
+}
+
+/// Scenario reproducing a wizard-completed generate run
+///
+/// Scenarios carry the format, count, seed, output, base configuration, and
+/// firewall rule flag; runs using options a scenario cannot express (VLAN
+/// ranges or CSV input) are refused rather than exported incompletely.
+pub fn scenario_from_args(args: &GenerateArgs, name: &str) -> Result<Scenario> {
+    for (set, option) in [
+        (args.vlan_range.is_some(), "--vlan-range"),
+        (args.csv_file.is_some(), "--csv-file"),
+    ] {
+        if set {
+            return Err(ConfigError::invalid_parameter(
+                "export-scenario",
+                format!("Scenarios cannot express {option}; export a count-based run instead"),
+            ));
+        }
+    }
+    let seed = args.seed.ok_or_else(|| {
+        ConfigError::invalid_parameter("export-scenario", "Scenarios are always seeded")
+    })?;
+
+    let (format, output) = match args.format {
+        OutputFormat::Csv => (
+            ScenarioFormat::Csv,
+            args.output
+                .as_deref()
+                .unwrap_or(Path::new("vlan_configs.csv")),
+        ),
+        OutputFormat::Xml => (ScenarioFormat::Xml, args.output_dir.as_path()),
+    };
+    let scenario = Scenario {
+        name: name.to_string(),
+        description: "Exported from the interactive generate wizard".to_string(),
+        format,
+        count: args.count,
+        seed,
+        output: output.display().to_string(),
+        base_config: args.base_config.as_ref().map(|p| p.display().to_string()),
+        include_firewall_rules: args.include_firewall_rules,
+        blocks: Vec::new(),
+        budgets: args.budgets(),
+    };
+    scenario.validate()?;
+    Ok(scenario)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use clap::Parser;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_session_resumes_saved_answers() {
+        let dir = TempDir::new().unwrap();
+        let path = dir.path().join("wizard.json");
+
+        let mut session = WizardSession::open(&path, ScenarioFormat::Xml).unwrap();
+        assert!(!session.is_resumed());
+        session.answers.base_config = Some(PathBuf::from("config.xml"));
+        session.save().unwrap();
+
+        let resumed = WizardSession::open(&path, ScenarioFormat::Xml).unwrap();
+        assert!(resumed.is_resumed());
+        assert_eq!(
+            resumed.answers.base_config,
+            Some(PathBuf::from("config.xml"))
+        );
+        assert_eq!(resumed.answers.count, None);
+
+        // Answers for another format do not apply
+        assert!(
+            !WizardSession::open(&path, ScenarioFormat::Csv)
+                .unwrap()
+                .is_resumed()
+        );
+
+        resumed.finish().unwrap();
+        assert!(!path.exists());
+    }
+
+    #[test]
+    fn test_scenario_export() {
+        let args = GenerateArgs::try_parse_from([
+            "generate",
+            "--format",
+            "xml",
+            "--base-config",
+            "config.xml",
+            "--count",
+            "25",
+            "--seed",
+            "7",
+            "--include-firewall-rules",
+        ])
+        .unwrap();
+        let scenario = scenario_from_args(&args, "lab").unwrap();
+        assert_eq!(scenario.count, 25);
+        assert_eq!(scenario.seed, 7);
+        assert_eq!(scenario.output, "output");
+        assert_eq!(scenario.base_config.as_deref(), Some("config.xml"));
+        assert!(scenario.include_firewall_rules);
+
+        let ranged = GenerateArgs::try_parse_from([
+            "generate",
+            "--format",
+            "csv",
+            "--vlan-range",
+            "100-110",
+            "--seed",
+            "7",
+        ])
+        .unwrap();
+        assert!(scenario_from_args(&ranged, "lab").is_err());
+    }
+}
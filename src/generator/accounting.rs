@@ -0,0 +1,270 @@
+//! Historical RADIUS accounting records
+//!
+//! Usage-reporting dashboards are built on RADIUS accounting (RFC 2866):
+//! one Stop record per session with its duration, traffic, and the reason
+//! it ended. [`generate_accounting`] writes such a history for the users of a
+//! `--headcount` run, over the days leading up to [`LEASE_SNAPSHOT`], so the
+//! records line up with the generated DHCP leases.
+//!
+//! Sessions follow the captive portal limits in [`PortalLimits`]: none lasts
+//! longer than the hard timeout, and a session left idle ends that many
+//! minutes after the last traffic, as the portal would end it. Staff are
+//! mostly present on weekdays during office hours.
+
+use crate::Result;
+use crate::generator::fingerprint::{LEASE_SNAPSHOT, civil_from_days};
+use crate::generator::headcount::DepartmentUser;
+use crate::generator::{RngStreams, VlanConfig};
+use crate::model::ConfigError;
+use rand::prelude::*;
+use serde::{Deserialize, Serialize};
+use std::collections::HashMap;
+
+/// Longest supported accounting window in days
+pub const MAX_ACCOUNTING_DAYS: u16 = 90;
+
+/// Longest supported portal timeout in minutes, one week
+pub const MAX_PORTAL_TIMEOUT: u32 = 10_080;
+
+/// Captive portal session limits the records respect
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct PortalLimits {
+    /// Hard timeout in minutes; also the validity of a voucher
+    pub hard_timeout: u32,
+    /// Idle timeout in minutes
+    pub idle_timeout: u32,
+}
+
+impl Default for PortalLimits {
+    fn default() -> Self {
+        Self {
+            hard_timeout: 480,
+            idle_timeout: 30,
+        }
+    }
+}
+
+/// Why a session ended (Acct-Terminate-Cause)
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub enum TerminateCause {
+    /// The user logged out
+    #[serde(rename = "User-Request")]
+    UserRequest,
+    /// No traffic for the idle timeout
+    #[serde(rename = "Idle-Timeout")]
+    IdleTimeout,
+    /// The hard timeout was reached
+    #[serde(rename = "Session-Timeout")]
+    SessionTimeout,
+}
+
+/// Accounting Stop record of one session
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct AccountingRecord {
+    /// Acct-Session-Id
+    pub session_id: String,
+    /// User-Name
+    pub user_name: String,
+    /// NAS-IP-Address, the gateway of the user's VLAN
+    pub nas_ip_address: String,
+    /// NAS-Port-Id, the interface of the user's VLAN
+    pub nas_port_id: String,
+    /// Framed-IP-Address, from the VLAN's dynamic pool
+    pub framed_ip_address: String,
+    /// Calling-Station-Id, the client MAC
+    pub calling_station_id: String,
+    /// Session start, RFC 3339 in UTC
+    pub start_time: String,
+    /// Event-Timestamp of the Stop record, seconds since the epoch
+    pub event_timestamp: u64,
+    /// Acct-Session-Time in seconds
+    pub session_time: u32,
+    /// Acct-Input-Octets, sent by the client
+    pub input_octets: u64,
+    /// Acct-Output-Octets, sent to the client
+    pub output_octets: u64,
+    /// Acct-Input-Packets
+    pub input_packets: u64,
+    /// Acct-Output-Packets
+    pub output_packets: u64,
+    /// Acct-Terminate-Cause
+    pub terminate_cause: TerminateCause,
+}
+
+/// Generate `days` of accounting history for `users`, ordered by start time
+pub fn generate_accounting(
+    configs: &[VlanConfig],
+    users: &[DepartmentUser],
+    days: u16,
+    limits: PortalLimits,
+    seed: Option<u64>,
+) -> Result<Vec<AccountingRecord>> {
+    if !(1..=MAX_ACCOUNTING_DAYS).contains(&days) {
+        return Err(ConfigError::invalid_parameter(
+            "accounting_days",
+            format!("{days} is outside the supported range 1-{MAX_ACCOUNTING_DAYS}"),
+        ));
+    }
+    for (name, minutes) in [
+        ("session_timeout", limits.hard_timeout),
+        ("idle_timeout", limits.idle_timeout),
+    ] {
+        if !(1..=MAX_PORTAL_TIMEOUT).contains(&minutes) {
+            return Err(ConfigError::invalid_parameter(
+                name,
+                format!("{minutes} minutes is outside the supported range 1-{MAX_PORTAL_TIMEOUT}"),
+            ));
+        }
+    }
+    let vlans: HashMap<u16, &VlanConfig> = configs.iter().map(|c| (c.vlan_id, c)).collect();
+    let first_day = LEASE_SNAPSHOT / 86400 - u64::from(days);
+    let mut records = Vec::new();
+
+    for user in users {
+        let Some(vlan) = vlans.get(&user.vlan_id) else {
+            continue;
+        };
+        let base = vlan.network_base()?;
+        let gateway = vlan.gateway_ip()?;
+        let mac = format!(
+            "02-01-{:02X}-{:02X}-{:02X}-{:02X}",
+            user.uid >> 24,
+            (user.uid >> 16) & 0xff,
+            (user.uid >> 8) & 0xff,
+            user.uid & 0xff
+        );
+        let mut rng = RngStreams::new(seed).stream_for("radius-accounting", u64::from(user.uid));
+
+        for day in first_day..first_day + u64::from(days) {
+            // 1970-01-01 was a Thursday; weekday 0 is Sunday
+            let weekend = matches!((day + 4) % 7, 0 | 6);
+            if !rng.random_bool(if weekend { 0.1 } else { 0.9 }) {
+                continue;
+            }
+            let framed_ip = format!("{base}.{}", rng.random_range(100..=200));
+            // Office hours 07:00-19:00, sessions back to back at most
+            let mut clock = 7 * 3600 + rng.random_range(0..3 * 3600);
+            for _ in 0..rng.random_range(1..=3) {
+                if clock >= 19 * 3600 {
+                    break;
+                }
+                let record = session(&mut rng, limits, day * 86400 + clock);
+                if record.event_timestamp > LEASE_SNAPSHOT {
+                    break;
+                }
+                clock += u64::from(record.session_time) + rng.random_range(600..7200);
+                records.push(AccountingRecord {
+                    user_name: user.name.clone(),
+                    nas_ip_address: gateway.clone(),
+                    nas_port_id: format!("vlan{}", user.vlan_id),
+                    framed_ip_address: framed_ip.clone(),
+                    calling_station_id: mac.clone(),
+                    ..record
+                });
+            }
+        }
+    }
+    records.sort_by(|a, b| a.start_time.cmp(&b.start_time));
+    Ok(records)
+}
+
+/// Draw one session starting at `start`, without user and network fields
+fn session<R: Rng + ?Sized>(rng: &mut R, limits: PortalLimits, start: u64) -> AccountingRecord {
+    let hard = limits.hard_timeout * 60;
+    let active = rng.random_range(5 * 60..=10 * 3600);
+    let (session_time, cause) = if rng.random_bool(0.25) {
+        // Traffic stopped; the portal waits out the idle timeout
+        let active = active.min(hard);
+        let ended = active + limits.idle_timeout * 60;
+        if ended >= hard {
+            (hard, TerminateCause::SessionTimeout)
+        } else {
+            (ended, TerminateCause::IdleTimeout)
+        }
+    } else if active >= hard {
+        (hard, TerminateCause::SessionTimeout)
+    } else {
+        (active, TerminateCause::UserRequest)
+    };
+
+    // Bytes per active second, downloads outweighing uploads
+    let transferring = u64::from(session_time.min(active));
+    let output_octets = transferring * rng.random_range(2_000..60_000);
+    let input_octets = output_octets / rng.random_range(4..12);
+    AccountingRecord {
+        session_id: format!("{:016X}", rng.random::<u64>()),
+        user_name: String::new(),
+        nas_ip_address: String::new(),
+        nas_port_id: String::new(),
+        framed_ip_address: String::new(),
+        calling_station_id: String::new(),
+        start_time: rfc3339(start),
+        event_timestamp: start + u64::from(session_time),
+        session_time,
+        input_octets,
+        output_octets,
+        input_packets: input_octets.div_ceil(400),
+        output_packets: output_octets.div_ceil(1200),
+        terminate_cause: cause,
+    }
+}
+
+/// Time as `YYYY-MM-DDTHH:MM:SSZ`
+pub(crate) fn rfc3339(secs: u64) -> String {
+    let (year, month, day) = civil_from_days(secs / 86400);
+    let time = secs % 86400;
+    format!(
+        "{year:04}-{month:02}-{day:02}T{:02}:{:02}:{:02}Z",
+        time / 3600,
+        time % 3600 / 60,
+        time % 60
+    )
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::generator::headcount::{HeadcountModel, generate_users, plan_departments};
+
+    #[test]
+    fn test_sessions_respect_portal_limits() {
+        let configs = vec![
+            VlanConfig::new(150, "10.9.1.x".to_string(), "Legal VLAN 150".to_string(), 1).unwrap(),
+        ];
+        let users = generate_users(
+            &plan_departments(&HeadcountModel::default(), &configs),
+            None,
+        );
+        let limits = PortalLimits {
+            hard_timeout: 120,
+            idle_timeout: 15,
+        };
+        let records = generate_accounting(&configs, &users, 14, limits, Some(2)).unwrap();
+        assert_eq!(
+            records,
+            generate_accounting(&configs, &users, 14, limits, Some(2)).unwrap()
+        );
+        assert!(records.len() > users.len() * 5);
+
+        for record in &records {
+            assert!(record.session_time <= 120 * 60);
+            assert!(record.event_timestamp <= LEASE_SNAPSHOT);
+            assert!(record.start_time.as_str() >= "2023-12-18T07:00:00Z");
+            assert_eq!(record.nas_ip_address, "10.9.1.1");
+            if record.terminate_cause == TerminateCause::IdleTimeout {
+                assert!(record.session_time >= 15 * 60);
+            }
+        }
+        assert!(
+            records
+                .iter()
+                .any(|r| r.terminate_cause == TerminateCause::SessionTimeout)
+        );
+        assert!(generate_accounting(&configs, &users, 0, limits, None).is_err());
+    }
+
+    #[test]
+    fn test_rfc3339() {
+        assert_eq!(rfc3339(LEASE_SNAPSHOT - 1), "2023-12-31T23:59:59Z");
+    }
+}
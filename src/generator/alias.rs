@@ -0,0 +1,291 @@
+//! Nested alias hierarchies
+//!
+//! OPNsense aliases may list other aliases, which firewall tooling has to
+//! flatten into addresses before it can reason about a rule. Flattening is a
+//! common source of bugs: members reached along two paths, literal entries
+//! mixed with alias names, or hierarchies deeper than a tool's recursion
+//! limit. [`generate_nested_aliases`] builds such hierarchies over the
+//! generated VLANs and records the expected flattened content of every alias,
+//! so downstream tools can be checked against it.
+//!
+//! Level 0 holds a network alias and a host alias per VLAN. Every alias of
+//! level `n` lists at least one alias of level `n - 1`, so the hierarchy is
+//! exactly `depth` levels deep above the leaves; some also list an alias of
+//! any lower level or a literal address from the documentation ranges.
+//! Aliases are ordered leaves first, so any prefix of the list only refers to
+//! aliases within it.
+
+use crate::Result;
+use crate::generator::{RngStreams, VlanConfig};
+use crate::model::ConfigError;
+use crate::xml::template::escape_xml_string;
+use rand::prelude::*;
+use serde::{Deserialize, Serialize};
+use std::collections::{BTreeSet, HashMap};
+
+/// Deepest supported nesting above the leaves
+pub const MAX_ALIAS_DEPTH: u8 = 8;
+
+/// Most aliases of one level listed by a group of the next
+const GROUP_SIZE: usize = 3;
+
+/// OPNsense alias type
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum AliasType {
+    /// Host addresses; may list host aliases
+    Host,
+    /// Networks; may list host and network aliases
+    Network,
+}
+
+impl AliasType {
+    /// Value of the alias's `<type>` element
+    pub fn as_str(self) -> &'static str {
+        match self {
+            AliasType::Host => "host",
+            AliasType::Network => "network",
+        }
+    }
+}
+
+/// A generated alias
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct NestedAlias {
+    /// Alias name
+    pub name: String,
+    /// Alias type
+    #[serde(rename = "type")]
+    pub alias_type: AliasType,
+    /// Nesting level, zero for aliases listing only addresses
+    pub level: u8,
+    /// Entries as written: addresses, networks, and alias names
+    pub content: Vec<String>,
+    /// Addresses and networks after resolving every nested alias, sorted
+    pub flattened: Vec<String>,
+    /// Alias description
+    pub description: String,
+}
+
+/// Generate aliases nested `depth` levels above per-VLAN leaves
+pub fn generate_nested_aliases(
+    vlans: &[VlanConfig],
+    depth: u8,
+    seed: Option<u64>,
+) -> Result<Vec<NestedAlias>> {
+    if !(1..=MAX_ALIAS_DEPTH).contains(&depth) {
+        return Err(ConfigError::invalid_parameter(
+            "alias_depth",
+            format!("Alias depth {depth} is outside the supported range 1-{MAX_ALIAS_DEPTH}"),
+        ));
+    }
+    let mut rng = RngStreams::new(seed).stream("nested-aliases");
+    let mut aliases = Vec::with_capacity(vlans.len() * 3);
+
+    for vlan in vlans {
+        let base = vlan.network_base()?;
+        let network = format!("{base}.0/24");
+        let mut hosts = BTreeSet::new();
+        let host_count = rng.random_range(2..=4);
+        while hosts.len() < host_count {
+            hosts.insert(rng.random_range(10..100u8));
+        }
+        aliases.push(leaf(
+            format!("NET_V{}", vlan.vlan_id),
+            AliasType::Network,
+            vec![network],
+            format!("{} network", vlan.description),
+        ));
+        aliases.push(leaf(
+            format!("HOSTS_V{}", vlan.vlan_id),
+            AliasType::Host,
+            hosts.iter().map(|host| format!("{base}.{host}")).collect(),
+            format!("{} servers", vlan.description),
+        ));
+    }
+
+    let mut below: Vec<usize> = (0..aliases.len()).collect();
+    for level in 1..=depth {
+        if below.is_empty() {
+            break;
+        }
+        let count = below.len().div_ceil(GROUP_SIZE);
+        let mut groups: Vec<Vec<usize>> = vec![Vec::new(); count];
+        below.shuffle(&mut rng);
+        for (position, &member) in below.iter().enumerate() {
+            groups[position % count].push(member);
+        }
+
+        let first = aliases.len();
+        for (index, mut members) in groups.into_iter().enumerate() {
+            // A second path to an alias already listed elsewhere
+            if rng.random_bool(0.5) {
+                let shared = rng.random_range(0..first);
+                if !members.contains(&shared) {
+                    members.push(shared);
+                }
+            }
+            let alias_type = if members
+                .iter()
+                .any(|&m| aliases[m].alias_type == AliasType::Network)
+            {
+                AliasType::Network
+            } else {
+                AliasType::Host
+            };
+            let mut content: Vec<String> =
+                members.iter().map(|&m| aliases[m].name.clone()).collect();
+            if rng.random_bool(0.3) {
+                content.push(match alias_type {
+                    AliasType::Host => format!("192.0.2.{}", rng.random_range(1..=254)),
+                    AliasType::Network => format!("198.51.100.{}/28", rng.random_range(0..16) * 16),
+                });
+            }
+            content.shuffle(&mut rng);
+
+            let flattened = flatten(&content, &aliases);
+            aliases.push(NestedAlias {
+                name: format!("GROUP_L{level}_{:02}", index + 1),
+                alias_type,
+                level,
+                description: format!("Level {level} group of {} entries", content.len()),
+                content,
+                flattened,
+            });
+        }
+        below = (first..aliases.len()).collect();
+    }
+    Ok(aliases)
+}
+
+fn leaf(
+    name: String,
+    alias_type: AliasType,
+    content: Vec<String>,
+    description: String,
+) -> NestedAlias {
+    NestedAlias {
+        name,
+        alias_type,
+        level: 0,
+        flattened: content.clone(),
+        content,
+        description,
+    }
+}
+
+/// Resolve alias names among `content` to the flattened content of `known`
+fn flatten(content: &[String], known: &[NestedAlias]) -> Vec<String> {
+    let by_name: HashMap<&str, &NestedAlias> = known
+        .iter()
+        .map(|alias| (alias.name.as_str(), alias))
+        .collect();
+    let mut flattened = BTreeSet::new();
+    for entry in content {
+        match by_name.get(entry.as_str()) {
+            Some(alias) => flattened.extend(alias.flattened.iter().cloned()),
+            None => {
+                flattened.insert(entry.clone());
+            }
+        }
+    }
+    flattened.into_iter().collect()
+}
+
+/// Render aliases as an OPNsense `<aliases>` section
+pub fn render_nested_aliases(aliases: &[NestedAlias], seed: Option<u64>) -> String {
+    let mut rng = RngStreams::new(seed).stream("nested-alias-uuids");
+    let mut out = String::from("<aliases>\n");
+    for alias in aliases {
+        let uuid = uuid::Builder::from_random_bytes(rng.random()).into_uuid();
+        out.push_str(&format!(
+            "  <alias uuid=\"{uuid}\">\n    <enabled>1</enabled>\n    <name>{}</name>\n    \
+             <type>{}</type>\n    <proto/>\n    <interface/>\n    <counters>0</counters>\n    \
+             <updatefreq/>\n    <content>{}</content>\n    \
+             <description>{}</description>\n  </alias>\n",
+            alias.name,
+            alias.alias_type.as_str(),
+            escape_xml_string(&alias.content.join("\n")),
+            escape_xml_string(&alias.description)
+        ));
+    }
+    out.push_str("</aliases>\n");
+    out
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::xml::graph::{DependencyGraph, Relation};
+    use crate::xml::tree::ConfigTree;
+
+    fn vlans() -> Vec<VlanConfig> {
+        (0..7)
+            .map(|i| {
+                VlanConfig::new(
+                    100 + i,
+                    format!("10.4.{i}.x"),
+                    format!("IT VLAN {}", 100 + i),
+                    1,
+                )
+                .unwrap()
+            })
+            .collect()
+    }
+
+    #[test]
+    fn test_hierarchy_has_requested_depth_and_resolves() {
+        let aliases = generate_nested_aliases(&vlans(), 4, Some(5)).unwrap();
+        assert_eq!(
+            aliases,
+            generate_nested_aliases(&vlans(), 4, Some(5)).unwrap()
+        );
+        assert_eq!(aliases.iter().map(|a| a.level).max(), Some(4));
+        assert_eq!(aliases.iter().filter(|a| a.level == 0).count(), 14);
+
+        for (index, alias) in aliases.iter().enumerate() {
+            // Every listed alias comes earlier, one level down at least once
+            let listed: Vec<&NestedAlias> = alias
+                .content
+                .iter()
+                .filter_map(|entry| aliases[..index].iter().find(|a| &a.name == entry))
+                .collect();
+            if alias.level > 0 {
+                assert!(listed.iter().any(|a| a.level == alias.level - 1));
+            }
+            if alias.alias_type == AliasType::Host {
+                assert!(listed.iter().all(|a| a.alias_type == AliasType::Host));
+            }
+        }
+        // The top level reaches every VLAN network
+        let top: BTreeSet<&String> = aliases
+            .iter()
+            .filter(|a| a.level == 4)
+            .flat_map(|a| &a.flattened)
+            .collect();
+        assert!((0..7).all(|i| top.contains(&format!("10.4.{i}.0/24"))));
+        assert!(generate_nested_aliases(&vlans(), 0, None).is_err());
+    }
+
+    #[test]
+    fn test_rendered_aliases_reference_each_other() {
+        let aliases = generate_nested_aliases(&vlans(), 2, Some(1)).unwrap();
+        let xml = format!(
+            "<opnsense>{}</opnsense>",
+            render_nested_aliases(&aliases, Some(1))
+        );
+        let graph = DependencyGraph::from_tree(&ConfigTree::parse(&xml).unwrap());
+        let uses = graph
+            .edges
+            .iter()
+            .filter(|e| e.relation == Relation::UsesAlias)
+            .count();
+        let listed = aliases
+            .iter()
+            .flat_map(|a| &a.content)
+            .filter(|entry| aliases.iter().any(|a| &a.name == *entry))
+            .count();
+        assert!(listed > 0);
+        assert_eq!(uses, listed);
+    }
+}
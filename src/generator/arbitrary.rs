@@ -0,0 +1,136 @@
+//! Seeded arbitrary model fragments for property-based tests
+//!
+//! Property-based tests in other projects often need one valid OPNsense
+//! object rather than a whole configuration. [`Arbitrary`] draws a random but
+//! valid instance of a model type, in the spirit of Go's `quick.Generator`,
+//! and [`Arbitrary::from_seed`] always gives the same instance for the same
+//! seed:
+//!
+//! ```rust
+//! use opnsense_config_faker::generator::{Arbitrary, FirewallRule};
+//!
+//! let rule = FirewallRule::from_seed(7)?;
+//! assert!(rule.validate().is_ok());
+//! assert_eq!(rule, FirewallRule::from_seed(7)?);
+//! # Ok::<(), Box<dyn std::error::Error>>(())
+//! ```
+//!
+//! Values are drawn from [`RngStreams`], so they do not depend on anything
+//! else generated in the same process. Test suites outside Rust, such as Go
+//! fuzzers, get the same values as JSON lines from `fuzz sample`.
+
+use crate::Result;
+use crate::generator::departments::DEPARTMENTS;
+use crate::generator::vlan::DhcpServerConfig;
+use crate::generator::{
+    FirewallComplexity, FirewallRule, RngStreams, VlanConfig, generate_firewall_rules,
+};
+use crate::model::ConfigError;
+use rand::prelude::*;
+
+/// Model types with random valid instances
+pub trait Arbitrary: Sized {
+    /// Name of the [`RngStreams`] stream seeded instances are drawn from
+    const STREAM: &'static str;
+
+    /// Draw a random valid instance
+    fn arbitrary<R: Rng + ?Sized>(rng: &mut R) -> Result<Self>;
+
+    /// Instance for a seed
+    fn from_seed(seed: u64) -> Result<Self> {
+        Self::nth_from_seed(seed, 0)
+    }
+
+    /// `index`-th instance of the sequence for a seed
+    ///
+    /// Every index has its own stream, so taking more instances never
+    /// changes the earlier ones.
+    fn nth_from_seed(seed: u64, index: u64) -> Result<Self> {
+        let mut rng = RngStreams::new(Some(seed)).stream_for(Self::STREAM, index);
+        Self::arbitrary(&mut rng)
+    }
+}
+
+impl Arbitrary for VlanConfig {
+    const STREAM: &'static str = "arbitrary-vlan";
+
+    fn arbitrary<R: Rng + ?Sized>(rng: &mut R) -> Result<Self> {
+        let vlan_id = rng.random_range(10..=4094);
+        let prefix = match rng.random_range(0..3) {
+            0 => format!(
+                "10.{}.{}",
+                rng.random_range(0..=255),
+                rng.random_range(0..=255)
+            ),
+            1 => format!(
+                "172.{}.{}",
+                rng.random_range(16..=31),
+                rng.random_range(0..=255)
+            ),
+            _ => format!("192.168.{}", rng.random_range(0..=255)),
+        };
+        let ip_network = format!("{prefix}.x");
+        let department = DEPARTMENTS[rng.random_range(0..DEPARTMENTS.len())];
+        let description = format!("{department} VLAN {vlan_id}");
+        let wan_assignment = rng.random_range(1..=3);
+        VlanConfig::new(vlan_id, ip_network, description, wan_assignment)
+    }
+}
+
+impl Arbitrary for FirewallRule {
+    const STREAM: &'static str = "arbitrary-firewall-rule";
+
+    /// One rule of those generated for an arbitrary VLAN
+    fn arbitrary<R: Rng + ?Sized>(rng: &mut R) -> Result<Self> {
+        let vlan = VlanConfig::arbitrary(rng)?;
+        let complexity = [
+            FirewallComplexity::Basic,
+            FirewallComplexity::Intermediate,
+            FirewallComplexity::Advanced,
+        ][rng.random_range(0..3)];
+        let mut rules =
+            generate_firewall_rules(&[vlan], complexity, Some(rng.random()), None, None)?;
+        if rules.is_empty() {
+            return Err(ConfigError::config(format!(
+                "No {complexity:?} firewall rules generated for an arbitrary VLAN"
+            )));
+        }
+        let index = rng.random_range(0..rules.len());
+        Ok(rules.swap_remove(index))
+    }
+}
+
+impl Arbitrary for DhcpServerConfig {
+    const STREAM: &'static str = "arbitrary-dhcp-scope";
+
+    /// DHCP scope of an arbitrary VLAN
+    fn arbitrary<R: Rng + ?Sized>(rng: &mut R) -> Result<Self> {
+        VlanConfig::arbitrary(rng)?.dhcp_server_config()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_fragments_are_valid_and_reproducible() {
+        for index in 0..50 {
+            let vlan = VlanConfig::nth_from_seed(3, index).unwrap();
+            assert!(vlan.validate().is_ok());
+            assert_eq!(vlan, VlanConfig::nth_from_seed(3, index).unwrap());
+
+            let rule = FirewallRule::nth_from_seed(3, index).unwrap();
+            assert!(rule.validate().is_ok());
+            assert_eq!(rule, FirewallRule::nth_from_seed(3, index).unwrap());
+
+            let scope = DhcpServerConfig::nth_from_seed(3, index).unwrap();
+            assert_eq!(scope, DhcpServerConfig::nth_from_seed(3, index).unwrap());
+            assert!(scope.range_start < scope.range_end);
+        }
+        assert_ne!(
+            FirewallRule::from_seed(1).unwrap(),
+            FirewallRule::from_seed(2).unwrap()
+        );
+    }
+}
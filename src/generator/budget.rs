@@ -0,0 +1,209 @@
+//! Per-section size caps for generated output
+//!
+//! Fixtures are often tuned to a UI page size or a performance threshold.
+//! [`SectionBudgets`] caps how many firewall rules, aliases, and DHCP
+//! reservations a run emits. Truncation is deterministic and spread evenly:
+//! every VLAN keeps its first rules and reservations before any VLAN keeps
+//! more, so a capped run is a prefix-wise subset of the uncapped one.
+
+use crate::generator::{FirewallRule, SubnetPopulation};
+use serde::{Deserialize, Serialize};
+use std::collections::HashMap;
+use std::fmt;
+use std::hash::Hash;
+
+/// Caps on the number of objects per section
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub struct SectionBudgets {
+    /// Most firewall rules across all VLANs
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub max_rules: Option<usize>,
+    /// Most aliases
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub max_aliases: Option<usize>,
+    /// Most DHCP static reservations across all VLANs
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub max_reservations: Option<usize>,
+}
+
+/// Objects dropped to stay within a budget
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct Truncation {
+    /// Section that was capped
+    pub section: &'static str,
+    /// The cap
+    pub budget: usize,
+    /// Objects generated before truncation
+    pub generated: usize,
+}
+
+impl Truncation {
+    /// Number of objects dropped
+    pub fn dropped(&self) -> usize {
+        self.generated - self.budget
+    }
+}
+
+impl fmt::Display for Truncation {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "{} budget of {} reached, dropped {} of {} generated",
+            self.section,
+            self.budget,
+            self.dropped(),
+            self.generated
+        )
+    }
+}
+
+impl SectionBudgets {
+    /// Whether no section is capped
+    pub fn is_unlimited(&self) -> bool {
+        *self == Self::default()
+    }
+
+    /// Keep at most `max_rules` rules, the highest-priority ones of each VLAN first
+    pub fn truncate_rules(&self, rules: &mut Vec<FirewallRule>) -> Option<Truncation> {
+        let budget = self.max_rules.filter(|&max| max < rules.len())?;
+        let generated = rules.len();
+        let keep = spread_evenly(rules.iter().map(|r| r.vlan_id), budget);
+        let mut index = 0;
+        rules.retain(|_| {
+            index += 1;
+            keep[index - 1]
+        });
+        Some(Truncation {
+            section: "rules",
+            budget,
+            generated,
+        })
+    }
+
+    /// Keep the first `max_aliases` aliases
+    pub fn truncate_aliases<T>(&self, aliases: &mut Vec<T>) -> Option<Truncation> {
+        let budget = self.max_aliases.filter(|&max| max < aliases.len())?;
+        let generated = aliases.len();
+        aliases.truncate(budget);
+        Some(Truncation {
+            section: "aliases",
+            budget,
+            generated,
+        })
+    }
+
+    /// Keep at most `max_reservations` reservations, the lowest addresses of
+    /// each VLAN first
+    ///
+    /// Hosts whose reservation is dropped keep their host override and alias
+    /// membership.
+    pub fn truncate_reservations(
+        &self,
+        populations: &mut [SubnetPopulation],
+    ) -> Option<Truncation> {
+        let generated: usize = populations.iter().map(|p| p.reservations.len()).sum();
+        let budget = self.max_reservations.filter(|&max| max < generated)?;
+        let groups = populations
+            .iter()
+            .enumerate()
+            .flat_map(|(index, p)| std::iter::repeat_n(index, p.reservations.len()));
+        let mut keep = spread_evenly(groups, budget).into_iter();
+        for population in populations.iter_mut() {
+            population
+                .reservations
+                .retain(|_| keep.next().unwrap_or(false));
+        }
+        Some(Truncation {
+            section: "reservations",
+            budget,
+            generated,
+        })
+    }
+}
+
+/// Which items to keep so that every group keeps its first items before any
+/// group keeps more; items are given in order by their group
+fn spread_evenly<K: Eq + Hash>(groups: impl Iterator<Item = K>, budget: usize) -> Vec<bool> {
+    let mut seen: HashMap<K, usize> = HashMap::new();
+    let mut ranked: Vec<(usize, usize)> = groups
+        .enumerate()
+        .map(|(index, group)| {
+            let rank = seen.entry(group).or_default();
+            *rank += 1;
+            (*rank, index)
+        })
+        .collect();
+    let mut keep = vec![false; ranked.len()];
+    ranked.sort_unstable();
+    for &(_, index) in ranked.iter().take(budget) {
+        keep[index] = true;
+    }
+    keep
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::generator::VlanConfig;
+    use crate::generator::density::{HostDensity, populate_subnets};
+    use crate::generator::firewall::{FirewallComplexity, generate_firewall_rules};
+
+    fn configs() -> Vec<VlanConfig> {
+        (0..3)
+            .map(|i| {
+                VlanConfig::new(
+                    100 + i,
+                    format!("10.1.{i}.x"),
+                    format!("IT VLAN {}", 100 + i),
+                    1,
+                )
+                .unwrap()
+            })
+            .collect()
+    }
+
+    #[test]
+    fn test_rules_are_truncated_evenly_per_vlan() {
+        let mut rules =
+            generate_firewall_rules(&configs(), FirewallComplexity::Basic, Some(1), None, None)
+                .unwrap();
+        let budgets = SectionBudgets {
+            max_rules: Some(7),
+            ..SectionBudgets::default()
+        };
+        let truncation = budgets.truncate_rules(&mut rules).unwrap();
+        assert_eq!(truncation.dropped(), 2);
+        assert_eq!(rules.len(), 7);
+        // Every VLAN keeps its first two rules; only the first VLAN a third
+        let per_vlan: Vec<usize> = (100..103)
+            .map(|id| rules.iter().filter(|r| r.vlan_id == Some(id)).count())
+            .collect();
+        assert_eq!(per_vlan, [3, 2, 2]);
+        assert!(rules.iter().all(|r| r.priority <= 3));
+        assert_eq!(budgets.truncate_rules(&mut rules), None);
+    }
+
+    #[test]
+    fn test_reservations_are_truncated_deterministically() {
+        let density = HostDensity::from_percent(50).unwrap();
+        let budgets = SectionBudgets {
+            max_reservations: Some(30),
+            ..SectionBudgets::default()
+        };
+        let capped = || {
+            let mut populations = populate_subnets(&configs(), density, Some(9)).unwrap();
+            budgets.truncate_reservations(&mut populations).unwrap();
+            populations
+        };
+        let populations = capped();
+        let total: usize = populations.iter().map(|p| p.reservations.len()).sum();
+        assert_eq!(total, 30);
+        assert_eq!(populations, capped());
+        // Hosts stay, only their static mappings go
+        assert!(
+            populations
+                .iter()
+                .all(|p| p.occupied() > p.reservations.len())
+        );
+    }
+}
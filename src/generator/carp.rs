@@ -0,0 +1,601 @@
+//! CARP failover timelines for HA pairs
+//!
+//! Failover-detection tooling is tested by replaying what an HA pair logs
+//! while it fails over. [`plan_carp_vips`] gives every VLAN a CARP virtual IP
+//! shared by a primary and a backup node, and [`simulate_failovers`] draws a
+//! sequence of incidents, each a node reboot, a VLAN link going down, or
+//! maintenance mode, together with every state change CARP makes on both
+//! nodes. [`render_carp_log`] writes the kernel messages and notifications a
+//! node logs for them in OPNsense's RFC 5424 log format; the timeline itself
+//! serves as the answer key.
+//!
+//! The VIP takes the VLAN gateway address; the nodes use `.2` and `.3`.
+//! Preemption is enabled, as OPNsense's HA setup recommends, so a demoted
+//! primary hands over every VIP, not just the affected one, and takes them
+//! back once it recovers.
+
+use crate::Result;
+use crate::generator::accounting::rfc3339;
+use crate::generator::fingerprint::LEASE_SNAPSHOT;
+use crate::generator::{RngStreams, VlanConfig};
+use crate::model::ConfigError;
+use crate::xml::template::escape_xml_string;
+use rand::prelude::*;
+use serde::{Deserialize, Serialize};
+use std::fmt;
+
+/// Most incidents in one timeline
+pub const MAX_CARP_INCIDENTS: u16 = 50;
+
+/// Time reserved for each incident; incidents never overlap
+const INCIDENT_SPACING: u64 = 6 * 3600;
+
+/// Advertisement interval in seconds; a master is timed out after three
+const ADVBASE: u64 = 1;
+
+/// Demotion for a failed interface, a pfsync bulk update, or maintenance mode
+const DEMOTION: i32 = 240;
+
+/// Node of an HA pair
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum HaNode {
+    /// Preferred master, advskew 0
+    Primary,
+    /// Standby, advskew 100
+    Backup,
+}
+
+impl HaNode {
+    /// Both nodes, primary first
+    pub const ALL: [HaNode; 2] = [HaNode::Primary, HaNode::Backup];
+
+    /// Node name as used in file names
+    pub fn as_str(self) -> &'static str {
+        match self {
+            HaNode::Primary => "primary",
+            HaNode::Backup => "backup",
+        }
+    }
+
+    /// Advertisement skew; the lower one wins
+    pub fn advskew(self) -> u8 {
+        match self {
+            HaNode::Primary => 0,
+            HaNode::Backup => 100,
+        }
+    }
+
+    /// Hostname of the node in a cluster, e.g. `fw01a`
+    pub fn hostname(self, cluster: &str) -> String {
+        match self {
+            HaNode::Primary => format!("{cluster}a"),
+            HaNode::Backup => format!("{cluster}b"),
+        }
+    }
+
+    fn index(self) -> usize {
+        self as usize
+    }
+}
+
+/// CARP state of a VIP on one node
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "UPPERCASE")]
+pub enum CarpState {
+    /// Interface down
+    Init,
+    /// Standing by
+    Backup,
+    /// Answering for the VIP
+    Master,
+}
+
+impl fmt::Display for CarpState {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(match self {
+            CarpState::Init => "INIT",
+            CarpState::Backup => "BACKUP",
+            CarpState::Master => "MASTER",
+        })
+    }
+}
+
+/// CARP virtual IP of a VLAN
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct CarpVip {
+    /// VLAN the VIP belongs to
+    pub vlan_id: u16,
+    /// Virtual host ID, unique per interface
+    pub vhid: u8,
+    /// Interface the VIP is configured on
+    pub interface: String,
+    /// Virtual address, the VLAN gateway
+    pub address: String,
+    /// Interface address of the primary
+    pub primary_address: String,
+    /// Interface address of the backup
+    pub backup_address: String,
+    /// VIP description
+    pub description: String,
+}
+
+/// One VIP per VLAN, with VHIDs 1-255 assigned in order
+pub fn plan_carp_vips(configs: &[VlanConfig]) -> Result<Vec<CarpVip>> {
+    configs
+        .iter()
+        .enumerate()
+        .map(|(index, config)| {
+            let base = config.network_base()?;
+            Ok(CarpVip {
+                vlan_id: config.vlan_id,
+                vhid: (index % 255) as u8 + 1,
+                interface: format!("vlan{}", config.vlan_id),
+                address: config.gateway_ip()?,
+                primary_address: format!("{base}.2"),
+                backup_address: format!("{base}.3"),
+                description: format!("{} CARP", config.description),
+            })
+        })
+        .collect()
+}
+
+/// Render the VIPs of one node as an OPNsense `<virtualip>` section
+///
+/// Both nodes get the same UUIDs and passwords, as configuration sync
+/// leaves them; only the advertisement skew differs.
+pub fn render_carp_vips(vips: &[CarpVip], node: HaNode, seed: Option<u64>) -> String {
+    let mut rng = RngStreams::new(seed).stream("carp-vips");
+    let mut out = String::from("<virtualip>\n");
+    for vip in vips {
+        let uuid = uuid::Builder::from_random_bytes(rng.random()).into_uuid();
+        let password = format!("{:032x}", rng.random::<u128>());
+        out.push_str(&format!(
+            "  <vip uuid=\"{uuid}\">\n    <interface>{}</interface>\n    <mode>carp</mode>\n    \
+             <subnet>{}</subnet>\n    <subnet_bits>24</subnet_bits>\n    <vhid>{}</vhid>\n    \
+             <advbase>{ADVBASE}</advbase>\n    <advskew>{}</advskew>\n    \
+             <password>{password}</password>\n    <descr>{}</descr>\n  </vip>\n",
+            escape_xml_string(&vip.interface),
+            escape_xml_string(&vip.address),
+            vip.vhid,
+            node.advskew(),
+            escape_xml_string(&vip.description)
+        ));
+    }
+    out.push_str("</virtualip>\n");
+    out
+}
+
+/// What went wrong in an incident
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(tag = "kind", rename_all = "kebab-case")]
+pub enum IncidentKind {
+    /// The node restarted
+    Reboot,
+    /// The node lost the link of one VLAN
+    LinkDown {
+        /// VLAN whose link went down
+        vlan_id: u16,
+    },
+    /// The node was put into persistent CARP maintenance mode
+    Maintenance,
+}
+
+/// A failure of one node, from `start` until it recovered at `end`
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Incident {
+    /// What happened
+    #[serde(flatten)]
+    pub kind: IncidentKind,
+    /// Node affected
+    pub node: HaNode,
+    /// Seconds since the epoch the incident began
+    pub start: u64,
+    /// Seconds since the epoch the node recovered
+    pub end: u64,
+}
+
+/// A change of a node's demotion counter
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Demotion {
+    /// Seconds since the epoch
+    pub time: u64,
+    /// Node demoted
+    pub node: HaNode,
+    /// Change of the counter
+    pub change: i32,
+    /// Counter after the change
+    pub total: i32,
+    /// Cause as logged by the kernel
+    pub reason: String,
+    /// Index of the incident causing it
+    pub incident: usize,
+}
+
+/// A CARP state change of one VIP on one node
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct CarpEvent {
+    /// Seconds since the epoch
+    pub time: u64,
+    /// Node changing state
+    pub node: HaNode,
+    /// VIP changing state
+    pub vhid: u8,
+    /// Interface of the VIP
+    pub interface: String,
+    /// State before
+    pub from: CarpState,
+    /// State after
+    pub to: CarpState,
+    /// Cause as logged by the kernel
+    pub reason: String,
+    /// Index of the incident causing it
+    pub incident: usize,
+}
+
+/// Incidents and everything both nodes did about them
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct CarpTimeline {
+    /// VIPs of the pair
+    pub vips: Vec<CarpVip>,
+    /// Incidents in time order
+    pub incidents: Vec<Incident>,
+    /// Demotion changes in time order
+    pub demotions: Vec<Demotion>,
+    /// State changes in time order
+    pub events: Vec<CarpEvent>,
+}
+
+/// Draw `count` incidents ending before the lease snapshot and their events
+///
+/// Incidents mostly hit the primary; those hitting the backup make no VIP
+/// fail over, which tooling must not report as a failover either.
+pub fn simulate_failovers(vips: &[CarpVip], count: u16, seed: Option<u64>) -> Result<CarpTimeline> {
+    if !(1..=MAX_CARP_INCIDENTS).contains(&count) {
+        return Err(ConfigError::invalid_parameter(
+            "carp_events",
+            format!("{count} is outside the supported range 1-{MAX_CARP_INCIDENTS}"),
+        ));
+    }
+    if vips.is_empty() {
+        return Err(ConfigError::invalid_parameter(
+            "carp_events",
+            "an HA pair needs at least one VLAN",
+        ));
+    }
+
+    let mut rng = RngStreams::new(seed).stream("carp-incidents");
+    let mut pair = Pair::new(vips);
+    let window_start = LEASE_SNAPSHOT - u64::from(count) * INCIDENT_SPACING;
+    for index in 0..usize::from(count) {
+        let start = window_start + index as u64 * INCIDENT_SPACING + rng.random_range(0..4 * 3600);
+        let end = start + rng.random_range(90..=600);
+        let node = if rng.random_bool(0.8) {
+            HaNode::Primary
+        } else {
+            HaNode::Backup
+        };
+        let kind = match rng.random_range(0..3) {
+            0 => IncidentKind::Reboot,
+            1 => IncidentKind::LinkDown {
+                vlan_id: vips[rng.random_range(0..vips.len())].vlan_id,
+            },
+            _ => IncidentKind::Maintenance,
+        };
+        pair.incident = index;
+        pair.play(kind, node, start, end)?;
+        pair.timeline.incidents.push(Incident {
+            kind,
+            node,
+            start,
+            end,
+        });
+    }
+
+    let mut timeline = pair.timeline;
+    timeline.events.sort_by_key(|event| event.time);
+    Ok(timeline)
+}
+
+/// State of both nodes while a timeline is simulated
+struct Pair<'a> {
+    vips: &'a [CarpVip],
+    states: [Vec<CarpState>; 2],
+    link_up: [Vec<bool>; 2],
+    demotion: [i32; 2],
+    incident: usize,
+    timeline: CarpTimeline,
+}
+
+impl<'a> Pair<'a> {
+    /// Healthy pair with the primary master of every VIP
+    fn new(vips: &'a [CarpVip]) -> Self {
+        Self {
+            vips,
+            states: [
+                vec![CarpState::Master; vips.len()],
+                vec![CarpState::Backup; vips.len()],
+            ],
+            link_up: [vec![true; vips.len()], vec![true; vips.len()]],
+            demotion: [0; 2],
+            incident: 0,
+            timeline: CarpTimeline {
+                vips: vips.to_vec(),
+                incidents: Vec::new(),
+                demotions: Vec::new(),
+                events: Vec::new(),
+            },
+        }
+    }
+
+    fn play(&mut self, kind: IncidentKind, node: HaNode, start: u64, end: u64) -> Result<()> {
+        let n = node.index();
+        match kind {
+            IncidentKind::Reboot => {
+                self.link_up[n].fill(false);
+                self.settle(start);
+                self.link_up[n].fill(true);
+                self.demote(end, node, DEMOTION, "pfsync bulk start");
+                self.settle(end);
+                self.demote(end + 2, node, -DEMOTION, "pfsync bulk done");
+                self.settle(end + 2);
+            }
+            IncidentKind::LinkDown { vlan_id } => {
+                let v = self
+                    .vips
+                    .iter()
+                    .position(|vip| vip.vlan_id == vlan_id)
+                    .ok_or_else(|| {
+                        ConfigError::config(format!("VLAN {vlan_id} has no CARP VIP"))
+                    })?;
+                self.demote(start, node, DEMOTION, "interface down");
+                self.link_up[n][v] = false;
+                self.settle(start);
+                self.demote(end, node, -DEMOTION, "interface up");
+                self.link_up[n][v] = true;
+                self.settle(end);
+            }
+            IncidentKind::Maintenance => {
+                self.demote(start, node, DEMOTION, "sysctl");
+                self.settle(start);
+                self.demote(end, node, -DEMOTION, "sysctl");
+                self.settle(end);
+            }
+        }
+        Ok(())
+    }
+
+    fn demote(&mut self, time: u64, node: HaNode, change: i32, reason: &str) {
+        self.demotion[node.index()] += change;
+        self.timeline.demotions.push(Demotion {
+            time,
+            node,
+            change,
+            total: self.demotion[node.index()],
+            reason: reason.to_string(),
+            incident: self.incident,
+        });
+    }
+
+    /// Move every VIP to the state CARP converges on after `time`
+    fn settle(&mut self, time: u64) {
+        for v in 0..self.vips.len() {
+            let master = HaNode::ALL
+                .into_iter()
+                .filter(|node| self.link_up[node.index()][v])
+                .min_by_key(|node| (self.demotion[node.index()], node.advskew()));
+            let before = [self.states[0][v], self.states[1][v]];
+            for node in HaNode::ALL {
+                let n = node.index();
+                let to = if !self.link_up[n][v] {
+                    CarpState::Init
+                } else if master == Some(node) {
+                    CarpState::Master
+                } else {
+                    CarpState::Backup
+                };
+                let mut from = before[n];
+                if from == to {
+                    continue;
+                }
+                // An interface coming up always starts as backup
+                if from == CarpState::Init {
+                    self.push(
+                        time,
+                        node,
+                        v,
+                        from,
+                        CarpState::Backup,
+                        "hardware interface up",
+                    );
+                    from = CarpState::Backup;
+                    if to == CarpState::Backup {
+                        continue;
+                    }
+                }
+                // A master that went silent is noticed after three intervals
+                let other = 1 - n;
+                let timed_out = before[other] != CarpState::Master || !self.link_up[other][v];
+                let (at, reason) = match to {
+                    CarpState::Init => (time, "hardware interface down"),
+                    CarpState::Master if timed_out => (time + 3 * ADVBASE, "master timed out"),
+                    CarpState::Master => (time + ADVBASE, "preempting a slower master"),
+                    CarpState::Backup => (time + ADVBASE, "more frequent advertisement received"),
+                };
+                self.push(at, node, v, from, to, reason);
+            }
+        }
+    }
+
+    fn push(
+        &mut self,
+        time: u64,
+        node: HaNode,
+        v: usize,
+        from: CarpState,
+        to: CarpState,
+        reason: &str,
+    ) {
+        let vip = &self.vips[v];
+        self.states[node.index()][v] = to;
+        self.timeline.events.push(CarpEvent {
+            time,
+            node,
+            vhid: vip.vhid,
+            interface: vip.interface.clone(),
+            from,
+            to,
+            reason: reason.to_string(),
+            incident: self.incident,
+        });
+    }
+}
+
+/// Render what one node logged, in OPNsense's RFC 5424 log format
+///
+/// Every state change is a kernel message; a VIP becoming master or backup
+/// is also announced by the `opnsense` notification hook.
+pub fn render_carp_log(timeline: &CarpTimeline, node: HaNode, cluster: &str) -> String {
+    let mut lines: Vec<(u64, &str, String)> = Vec::new();
+    for demotion in timeline.demotions.iter().filter(|d| d.node == node) {
+        lines.push((
+            demotion.time,
+            "kernel",
+            format!(
+                "carp: demoted by {} to {} ({})",
+                demotion.change, demotion.total, demotion.reason
+            ),
+        ));
+    }
+    for event in timeline.events.iter().filter(|e| e.node == node) {
+        lines.push((
+            event.time,
+            "kernel",
+            format!(
+                "carp: {}@{}: {} -> {} ({})",
+                event.vhid, event.interface, event.from, event.to, event.reason
+            ),
+        ));
+        let vip = timeline
+            .vips
+            .iter()
+            .find(|vip| vip.vhid == event.vhid && vip.interface == event.interface);
+        if let Some(vip) = vip
+            && event.to != CarpState::Init
+        {
+            lines.push((
+                event.time,
+                "opnsense",
+                format!(
+                    "Carp cluster member \"{} - {} (vhid {})\" has resumed the state \"{}\" \
+                     for vhid {}",
+                    vip.address, vip.description, vip.vhid, event.to, vip.vhid
+                ),
+            ));
+        }
+    }
+    lines.sort_by_key(|(time, _, _)| *time);
+
+    let hostname = node.hostname(cluster);
+    let mut out = String::new();
+    for (sequence, (time, app, message)) in lines.into_iter().enumerate() {
+        // kern.notice and user.notice
+        let priority = if app == "kernel" { 5 } else { 13 };
+        out.push_str(&format!(
+            "<{priority}>1 {} {hostname} {app} - - [meta sequenceId=\"{}\"] {message}\n",
+            rfc3339(time),
+            sequence + 1
+        ));
+    }
+    out
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn vips() -> Vec<CarpVip> {
+        let configs: Vec<VlanConfig> = (0..4)
+            .map(|i| {
+                VlanConfig::new(
+                    200 + i,
+                    format!("10.7.{i}.x"),
+                    format!("IT VLAN {}", 200 + i),
+                    1,
+                )
+                .unwrap()
+            })
+            .collect();
+        plan_carp_vips(&configs).unwrap()
+    }
+
+    #[test]
+    fn test_primary_link_down_fails_over_every_vip() {
+        let vips = vips();
+        let mut pair = Pair::new(&vips);
+        pair.play(
+            IncidentKind::LinkDown { vlan_id: 201 },
+            HaNode::Primary,
+            1000,
+            1300,
+        );
+
+        let at = |time: u64, node: HaNode| {
+            pair.timeline
+                .events
+                .iter()
+                .filter(|e| e.time == time && e.node == node)
+                .map(|e| (e.vhid, e.from, e.to))
+                .collect::<Vec<_>>()
+        };
+        assert_eq!(
+            at(1000, HaNode::Primary),
+            [(2, CarpState::Master, CarpState::Init)]
+        );
+        assert_eq!(
+            at(1003, HaNode::Backup),
+            [(2, CarpState::Backup, CarpState::Master)]
+        );
+        // The demoted primary hands over the other VIPs as well, and takes
+        // everything back once the link returns
+        assert_eq!(at(1001, HaNode::Backup).len(), 3);
+        assert_eq!(at(1301, HaNode::Primary).len(), 4);
+        assert!(pair.states[0].iter().all(|&s| s == CarpState::Master));
+        assert!(pair.states[1].iter().all(|&s| s == CarpState::Backup));
+        assert_eq!(pair.demotion, [0, 0]);
+    }
+
+    #[test]
+    fn test_timeline_is_consistent_and_logged() {
+        let vips = vips();
+        let timeline = simulate_failovers(&vips, 12, Some(4)).unwrap();
+        assert_eq!(timeline, simulate_failovers(&vips, 12, Some(4)).unwrap());
+        assert_eq!(timeline.incidents.len(), 12);
+        assert!(timeline.events.iter().all(|e| e.time < LEASE_SNAPSHOT));
+
+        // Events replay from a healthy pair back to one
+        let healthy = [vec![CarpState::Master; 4], vec![CarpState::Backup; 4]];
+        let mut states = healthy.clone();
+        for event in &timeline.events {
+            let v = usize::from(event.vhid) - 1;
+            assert_eq!(states[event.node.index()][v], event.from);
+            states[event.node.index()][v] = event.to;
+        }
+        assert_eq!(states, healthy);
+
+        let log = render_carp_log(&timeline, HaNode::Primary, "fw01");
+        let kernel = log.lines().filter(|l| l.contains(" fw01a kernel ")).count();
+        let primary_events = timeline
+            .events
+            .iter()
+            .filter(|e| e.node == HaNode::Primary)
+            .count();
+        let primary_demotions = timeline
+            .demotions
+            .iter()
+            .filter(|d| d.node == HaNode::Primary)
+            .count();
+        assert_eq!(kernel, primary_events + primary_demotions);
+        assert!(log.starts_with("<5>1 2023-12-"));
+    }
+}
@@ -0,0 +1,269 @@
+//! Gradual evolution of a generated configuration over time
+//!
+//! Drift-detection and backup systems need a configuration that keeps
+//! changing the way a production firewall does: a VLAN is added here, a
+//! description is reworded there. [`ChurnEngine`] holds the current set of
+//! VLANs and applies a few small, plausible changes on each [`step`], so a
+//! soak run produces a long series of slightly evolved configurations.
+//!
+//! [`step`]: ChurnEngine::step
+
+use crate::Result;
+use crate::generator::RngStreams;
+use crate::generator::vlan::{VlanConfig, VlanGenerator};
+use rand::prelude::*;
+use rand_chacha::ChaCha8Rng;
+use serde::{Deserialize, Serialize};
+use std::fmt;
+
+/// Most VLANs a configuration can hold (IDs 10-4094)
+const MAX_VLANS: usize = 4085;
+
+/// Change kinds with their relative frequency
+const CHANGE_WEIGHTS: [(ChangeKind, u32); 4] = [
+    (ChangeKind::Rename, 40),
+    (ChangeKind::MoveWan, 25),
+    (ChangeKind::Add, 20),
+    (ChangeKind::Remove, 15),
+];
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum ChangeKind {
+    Add,
+    Remove,
+    Rename,
+    MoveWan,
+}
+
+/// One change applied by a churn step
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(tag = "change", rename_all = "snake_case")]
+pub enum ChurnEvent {
+    /// A new VLAN was added
+    Added { vlan_id: u16, ip_network: String },
+    /// A VLAN was removed
+    Removed { vlan_id: u16 },
+    /// A VLAN's description changed
+    Renamed {
+        vlan_id: u16,
+        from: String,
+        to: String,
+    },
+    /// A VLAN moved to another WAN
+    WanMoved { vlan_id: u16, from: u8, to: u8 },
+}
+
+impl ChurnEvent {
+    /// VLAN the change applies to
+    pub fn vlan_id(&self) -> u16 {
+        match self {
+            ChurnEvent::Added { vlan_id, .. }
+            | ChurnEvent::Removed { vlan_id }
+            | ChurnEvent::Renamed { vlan_id, .. }
+            | ChurnEvent::WanMoved { vlan_id, .. } => *vlan_id,
+        }
+    }
+}
+
+impl fmt::Display for ChurnEvent {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            ChurnEvent::Added {
+                vlan_id,
+                ip_network,
+            } => write!(f, "added VLAN {vlan_id} ({ip_network})"),
+            ChurnEvent::Removed { vlan_id } => write!(f, "removed VLAN {vlan_id}"),
+            ChurnEvent::Renamed { vlan_id, from, to } => {
+                write!(f, "renamed VLAN {vlan_id}: '{from}' -> '{to}'")
+            }
+            ChurnEvent::WanMoved { vlan_id, from, to } => {
+                write!(f, "moved VLAN {vlan_id} from WAN {from} to WAN {to}")
+            }
+        }
+    }
+}
+
+/// Evolves a set of VLAN configurations a few changes at a time
+///
+/// The number of VLANs drifts between half and twice the initial count.
+/// Removed VLAN IDs and networks are never reused, so every added VLAN is
+/// unambiguously new to a drift detector.
+pub struct ChurnEngine {
+    configs: Vec<VlanConfig>,
+    generator: VlanGenerator,
+    rng: ChaCha8Rng,
+    min_vlans: usize,
+    max_vlans: usize,
+    iteration: u64,
+}
+
+impl ChurnEngine {
+    /// Start from an initial configuration
+    ///
+    /// Changes are drawn from RNGs seeded with `seed`, so a seeded soak run
+    /// produces the same series of configurations every time.
+    pub fn new(configs: Vec<VlanConfig>, seed: Option<u64>) -> Self {
+        let streams = RngStreams::new(seed);
+        let mut generator = VlanGenerator::new(Some(streams.stream("churn-vlans").random()));
+        for config in &configs {
+            generator.reserve(config);
+        }
+        let rng = streams.stream("churn");
+        let initial = configs.len();
+
+        Self {
+            configs,
+            generator,
+            rng,
+            min_vlans: (initial / 2).max(1),
+            max_vlans: (initial * 2).clamp(1, MAX_VLANS),
+            iteration: 0,
+        }
+    }
+
+    /// Current configurations
+    pub fn configs(&self) -> &[VlanConfig] {
+        &self.configs
+    }
+
+    /// Number of steps taken so far
+    pub fn iteration(&self) -> u64 {
+        self.iteration
+    }
+
+    /// Apply one to three changes and return them
+    pub fn step(&mut self) -> Result<Vec<ChurnEvent>> {
+        self.iteration += 1;
+        let changes = self.rng.random_range(1..=3);
+        let mut events = Vec::with_capacity(changes);
+        for _ in 0..changes {
+            if let Some(event) = self.change()? {
+                events.push(event);
+            }
+        }
+        Ok(events)
+    }
+
+    /// Apply a single change; returns `None` when nothing could change
+    fn change(&mut self) -> Result<Option<ChurnEvent>> {
+        let total: u32 = CHANGE_WEIGHTS.iter().map(|(_, weight)| weight).sum();
+        let mut roll = self.rng.random_range(0..total);
+        let mut kind = ChangeKind::Rename;
+        for (candidate, weight) in CHANGE_WEIGHTS {
+            if roll < weight {
+                kind = candidate;
+                break;
+            }
+            roll -= weight;
+        }
+
+        // Keep the VLAN count within bounds by rewording instead
+        let kind = match kind {
+            ChangeKind::Add if self.configs.len() >= self.max_vlans => ChangeKind::Rename,
+            ChangeKind::Remove if self.configs.len() <= self.min_vlans => ChangeKind::Rename,
+            kind => kind,
+        };
+
+        if kind == ChangeKind::Add {
+            let config = self.generator.generate_single()?;
+            let event = ChurnEvent::Added {
+                vlan_id: config.vlan_id,
+                ip_network: config.ip_network.clone(),
+            };
+            self.configs.push(config);
+            return Ok(Some(event));
+        }
+        if self.configs.is_empty() {
+            return Ok(None);
+        }
+
+        let index = self.rng.random_range(0..self.configs.len());
+        let event = match kind {
+            ChangeKind::Remove => {
+                let config = self.configs.remove(index);
+                ChurnEvent::Removed {
+                    vlan_id: config.vlan_id,
+                }
+            }
+            ChangeKind::MoveWan => {
+                let config = &mut self.configs[index];
+                let from = config.wan_assignment;
+                let to = (from + self.rng.random_range(0..2)) % 3 + 1;
+                config.wan_assignment = to;
+                ChurnEvent::WanMoved {
+                    vlan_id: config.vlan_id,
+                    from,
+                    to,
+                }
+            }
+            ChangeKind::Rename | ChangeKind::Add => {
+                let vlan_id = self.configs[index].vlan_id;
+                let from = self.configs[index].description.clone();
+                let Some(to) = (0..8)
+                    .map(|_| self.generator.generate_description(vlan_id))
+                    .find(|description| *description != from)
+                else {
+                    return Ok(None);
+                };
+                self.configs[index].description = to.clone();
+                ChurnEvent::Renamed { vlan_id, from, to }
+            }
+        };
+        Ok(Some(event))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::generator::vlan::generate_vlan_configurations;
+    use std::collections::HashSet;
+
+    #[test]
+    fn test_steps_are_seeded() {
+        let initial = generate_vlan_configurations(10, Some(42), None).unwrap();
+        let mut first = ChurnEngine::new(initial.clone(), Some(7));
+        let mut second = ChurnEngine::new(initial, Some(7));
+        for _ in 0..20 {
+            assert_eq!(first.step().unwrap(), second.step().unwrap());
+        }
+        assert_eq!(first.configs(), second.configs());
+        assert_eq!(first.iteration(), 20);
+    }
+
+    #[test]
+    fn test_churn_keeps_configs_valid_and_bounded() {
+        let initial = generate_vlan_configurations(8, Some(1), None).unwrap();
+        let mut engine = ChurnEngine::new(initial, Some(3));
+        let mut seen_ids = HashSet::new();
+        for _ in 0..200 {
+            for event in engine.step().unwrap() {
+                if let ChurnEvent::Added { vlan_id, .. } = event {
+                    // Added VLANs are never ones removed earlier
+                    assert!(seen_ids.insert(vlan_id));
+                }
+            }
+            let configs = engine.configs();
+            assert!((4..=16).contains(&configs.len()));
+            let ids: HashSet<u16> = configs.iter().map(|c| c.vlan_id).collect();
+            assert_eq!(ids.len(), configs.len());
+            for config in configs {
+                config.validate().unwrap();
+            }
+        }
+    }
+
+    #[test]
+    fn test_wan_moves_change_the_wan() {
+        let initial = generate_vlan_configurations(5, Some(9), None).unwrap();
+        let mut engine = ChurnEngine::new(initial, Some(9));
+        for _ in 0..100 {
+            for event in engine.step().unwrap() {
+                if let ChurnEvent::WanMoved { from, to, .. } = event {
+                    assert_ne!(from, to);
+                    assert!((1..=3).contains(&to));
+                }
+            }
+        }
+    }
+}
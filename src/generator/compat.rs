@@ -0,0 +1,353 @@
+//! Support matrix for targeted OPNsense releases
+//!
+//! Fixture pipelines often generate for several OPNsense releases. A
+//! [`Target`] names one release and flavor; [`resolve`] checks every section a
+//! run would generate against the release that introduced it and applies an
+//! [`UnsupportedPolicy`] to the ones the target lacks, so an unsupported
+//! section is skipped, replaced by an older equivalent, or rejected up front
+//! instead of producing a configuration the target cannot load.
+//!
+//! Community releases ship in January and July (`24.1`, `24.7`), Business
+//! Edition releases in April and October (`24.4`, `24.10`).
+
+use crate::Result;
+use crate::model::ConfigError;
+use clap::ValueEnum;
+use std::fmt;
+use std::str::FromStr;
+
+/// OPNsense edition
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq, ValueEnum)]
+pub enum Flavor {
+    /// Community edition, released in January and July
+    #[default]
+    Community,
+    /// Business Edition, released in April and October
+    Business,
+}
+
+impl Flavor {
+    /// Months in which releases of this flavor ship
+    fn release_months(&self) -> [u8; 2] {
+        match self {
+            Flavor::Community => [1, 7],
+            Flavor::Business => [4, 10],
+        }
+    }
+
+    /// Oldest release that can be targeted
+    pub fn oldest(&self) -> OpnsenseVersion {
+        match self {
+            Flavor::Community => OpnsenseVersion::new(22, 1),
+            Flavor::Business => OpnsenseVersion::new(22, 4),
+        }
+    }
+}
+
+impl fmt::Display for Flavor {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(match self {
+            Flavor::Community => "community",
+            Flavor::Business => "business",
+        })
+    }
+}
+
+/// Release number such as `24.7`
+#[derive(Clone, Copy, Debug, PartialEq, Eq, PartialOrd, Ord, Hash)]
+pub struct OpnsenseVersion {
+    /// Two-digit release year
+    pub year: u8,
+    /// Release month
+    pub month: u8,
+}
+
+impl OpnsenseVersion {
+    /// Version for a release year and month
+    pub const fn new(year: u8, month: u8) -> Self {
+        Self { year, month }
+    }
+}
+
+impl FromStr for OpnsenseVersion {
+    type Err = String;
+
+    fn from_str(s: &str) -> std::result::Result<Self, Self::Err> {
+        // Point releases such as 24.7.3 share the feature set of 24.7
+        let mut parts = s.trim().split('.');
+        let (Some(year), Some(month)) = (parts.next(), parts.next()) else {
+            return Err(format!("'{s}' is not a release such as 24.7"));
+        };
+        let year: u8 = year
+            .parse()
+            .map_err(|_| format!("'{s}' has an invalid release year"))?;
+        let month: u8 = month
+            .parse()
+            .map_err(|_| format!("'{s}' has an invalid release month"))?;
+        if !(1..=12).contains(&month) {
+            return Err(format!("'{s}' has an invalid release month"));
+        }
+        if parts.any(|p| p.parse::<u16>().is_err()) {
+            return Err(format!("'{s}' has an invalid point release"));
+        }
+        Ok(Self::new(year, month))
+    }
+}
+
+impl fmt::Display for OpnsenseVersion {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "{}.{}", self.year, self.month)
+    }
+}
+
+/// Release a run generates for
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub struct Target {
+    /// Targeted release
+    pub version: OpnsenseVersion,
+    /// Edition of the release
+    pub flavor: Flavor,
+}
+
+impl Target {
+    /// Target a release, checking that the flavor ships such a release
+    pub fn new(version: OpnsenseVersion, flavor: Flavor) -> Result<Self> {
+        if !flavor.release_months().contains(&version.month) {
+            let [first, second] = flavor.release_months();
+            return Err(ConfigError::invalid_parameter(
+                "opnsense_version",
+                format!("{flavor} releases are numbered YY.{first} or YY.{second}, got {version}"),
+            ));
+        }
+        if version < flavor.oldest() {
+            return Err(ConfigError::invalid_parameter(
+                "opnsense_version",
+                format!(
+                    "{version} is older than the oldest supported {flavor} release {}",
+                    flavor.oldest()
+                ),
+            ));
+        }
+        Ok(Self { version, flavor })
+    }
+
+    /// Parse a release number and target it
+    pub fn parse(version: &str, flavor: Flavor) -> Result<Self> {
+        let version = version
+            .parse()
+            .map_err(|e: String| ConfigError::invalid_parameter("opnsense_version", e))?;
+        Self::new(version, flavor)
+    }
+
+    /// Whether the target release includes a section
+    pub fn supports(&self, section: Section) -> bool {
+        self.version >= section.since(self.flavor)
+    }
+}
+
+impl fmt::Display for Target {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "OPNsense {} ({})", self.version, self.flavor)
+    }
+}
+
+/// What to do with a section the target does not support
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq, ValueEnum)]
+pub enum UnsupportedPolicy {
+    /// Leave the section out
+    Skip,
+    /// Refuse to generate anything
+    #[default]
+    Error,
+    /// Generate an older equivalent instead, or leave the section out if none exists
+    Downgrade,
+}
+
+/// A part of the generated output whose support depends on the release
+///
+/// Everything else the faker generates is available in every release that can
+/// be targeted, so only these sections are checked.
+#[derive(Clone, Copy, Debug, PartialEq, Eq, Hash)]
+pub enum Section {
+    /// OpenVPN tunnels, available in every targetable release
+    OpenVpn,
+    /// WireGuard tunnels, part of the core system since 24.1
+    WireGuard,
+}
+
+impl Section {
+    /// Name used in reports
+    pub fn name(&self) -> &'static str {
+        match self {
+            Section::OpenVpn => "openvpn",
+            Section::WireGuard => "wireguard",
+        }
+    }
+
+    /// First release of a flavor that includes the section
+    pub fn since(&self, flavor: Flavor) -> OpnsenseVersion {
+        match (self, flavor) {
+            (Section::WireGuard, Flavor::Community) => OpnsenseVersion::new(24, 1),
+            (Section::WireGuard, Flavor::Business) => OpnsenseVersion::new(24, 4),
+            (Section::OpenVpn, _) => flavor.oldest(),
+        }
+    }
+
+    /// Older section generated instead under [`UnsupportedPolicy::Downgrade`]
+    pub fn downgrade(&self) -> Option<Section> {
+        match self {
+            Section::WireGuard => Some(Section::OpenVpn),
+            Section::OpenVpn => None,
+        }
+    }
+}
+
+impl fmt::Display for Section {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(self.name())
+    }
+}
+
+/// How a requested section is generated for the target
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub enum Outcome {
+    /// Generated as requested
+    Supported,
+    /// Left out
+    Skipped,
+    /// Replaced by an older equivalent
+    Downgraded(Section),
+}
+
+/// Outcome for one requested section
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub struct SectionReport {
+    /// Requested section
+    pub section: Section,
+    /// What happens to it
+    pub outcome: Outcome,
+}
+
+/// Per-section outcomes of a run for a target
+#[derive(Clone, Debug, PartialEq, Eq)]
+pub struct CompatReport {
+    /// Release generated for
+    pub target: Target,
+    /// Requested sections in request order
+    pub sections: Vec<SectionReport>,
+}
+
+impl CompatReport {
+    /// Outcome of a section, `None` when it was not requested
+    pub fn outcome(&self, section: Section) -> Option<Outcome> {
+        self.sections
+            .iter()
+            .find(|r| r.section == section)
+            .map(|r| r.outcome)
+    }
+
+    /// Whether the target lacks any requested section
+    pub fn is_degraded(&self) -> bool {
+        self.sections
+            .iter()
+            .any(|r| r.outcome != Outcome::Supported)
+    }
+}
+
+/// Decide how each requested section is generated for the target
+///
+/// With [`UnsupportedPolicy::Error`] every unsupported section is listed in
+/// one error before anything is generated.
+pub fn resolve(
+    target: Target,
+    requested: &[Section],
+    policy: UnsupportedPolicy,
+) -> Result<CompatReport> {
+    let unsupported: Vec<&Section> = requested.iter().filter(|s| !target.supports(**s)).collect();
+    if policy == UnsupportedPolicy::Error && !unsupported.is_empty() {
+        let sections: Vec<String> = unsupported
+            .iter()
+            .map(|s| format!("{s} (requires {})", s.since(target.flavor)))
+            .collect();
+        return Err(ConfigError::invalid_parameter(
+            "opnsense_version",
+            format!(
+                "{target} does not support {}; use --on-unsupported skip or downgrade",
+                sections.join(", ")
+            ),
+        ));
+    }
+
+    let sections = requested
+        .iter()
+        .map(|&section| {
+            let outcome = if target.supports(section) {
+                Outcome::Supported
+            } else {
+                match section.downgrade() {
+                    Some(older)
+                        if policy == UnsupportedPolicy::Downgrade && target.supports(older) =>
+                    {
+                        Outcome::Downgraded(older)
+                    }
+                    _ => Outcome::Skipped,
+                }
+            };
+            SectionReport { section, outcome }
+        })
+        .collect();
+    Ok(CompatReport { target, sections })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const VPN: &[Section] = &[Section::WireGuard];
+
+    #[test]
+    fn test_target_parsing() {
+        let target = Target::parse("24.7.3", Flavor::Community).unwrap();
+        assert_eq!(target.version, OpnsenseVersion::new(24, 7));
+        assert!(Target::parse("24.4", Flavor::Community).is_err());
+        assert!(Target::parse("24.4", Flavor::Business).is_ok());
+        assert!(Target::parse("21.7", Flavor::Community).is_err());
+        assert!(Target::parse("24", Flavor::Community).is_err());
+        assert!(Target::parse("24.13", Flavor::Community).is_err());
+    }
+
+    #[test]
+    fn test_wireguard_support_by_flavor() {
+        let community = Target::parse("24.1", Flavor::Community).unwrap();
+        let business = Target::parse("23.10", Flavor::Business).unwrap();
+        assert!(community.supports(Section::WireGuard));
+        assert!(!business.supports(Section::WireGuard));
+        assert!(business.supports(Section::OpenVpn));
+    }
+
+    #[test]
+    fn test_policies() {
+        let target = Target::parse("23.7", Flavor::Community).unwrap();
+
+        let error = resolve(target, VPN, UnsupportedPolicy::Error).unwrap_err();
+        assert!(error.to_string().contains("wireguard (requires 24.1)"));
+
+        let skip = resolve(target, VPN, UnsupportedPolicy::Skip).unwrap();
+        assert_eq!(skip.outcome(Section::WireGuard), Some(Outcome::Skipped));
+        assert_eq!(skip.outcome(Section::OpenVpn), None);
+        assert!(skip.is_degraded());
+
+        let downgrade = resolve(target, VPN, UnsupportedPolicy::Downgrade).unwrap();
+        assert_eq!(
+            downgrade.outcome(Section::WireGuard),
+            Some(Outcome::Downgraded(Section::OpenVpn))
+        );
+
+        let current = Target::parse("24.7", Flavor::Community).unwrap();
+        assert!(
+            !resolve(current, VPN, UnsupportedPolicy::Error)
+                .unwrap()
+                .is_degraded()
+        );
+    }
+}
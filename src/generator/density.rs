@@ -0,0 +1,273 @@
+//! Host density modeling for generated subnets
+//!
+//! Generated VLANs otherwise look almost empty: one or two department
+//! reservations per /24. [`populate_subnets`] fills each subnet to a sampled
+//! utilization around a target [`HostDensity`], producing DHCP reservations,
+//! DNS host overrides, and alias members so capacity-planning tools see a
+//! realistic spread of occupancy instead of a constant.
+
+use crate::Result;
+use crate::generator::RngStreams;
+use crate::generator::vlan::{StaticReservation, VlanConfig};
+use crate::model::ConfigError;
+use rand::prelude::*;
+use serde::{Deserialize, Serialize};
+use std::ops::RangeInclusive;
+
+/// Usable host addresses per /24 (.2-.254; .1 is the gateway)
+pub const USABLE_HOSTS: u16 = 253;
+
+/// Host octets available to generated hosts
+const HOST_OCTETS: RangeInclusive<u8> = 2..=254;
+
+/// Dynamic DHCP pool; OPNsense rejects static mappings inside it
+pub(crate) const DHCP_POOL: RangeInclusive<u8> = 100..=200;
+
+/// Target fraction of usable addresses occupied in each subnet
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub struct HostDensity {
+    fill: f64,
+}
+
+impl HostDensity {
+    /// Create a density from a fraction between 0.0 and 1.0
+    pub fn new(fill: f64) -> Result<Self> {
+        if !(0.0..=1.0).contains(&fill) {
+            return Err(ConfigError::invalid_parameter(
+                "host_density",
+                format!("fill must be between 0.0 and 1.0, got {fill}"),
+            ));
+        }
+        Ok(Self { fill })
+    }
+
+    /// Create a density from a percentage between 0 and 100
+    pub fn from_percent(percent: u8) -> Result<Self> {
+        Self::new(f64::from(percent) / 100.0)
+    }
+
+    /// Mean fraction of usable addresses occupied
+    pub fn fill(&self) -> f64 {
+        self.fill
+    }
+
+    /// Draw one subnet's utilization
+    ///
+    /// Triangular around the target, narrowing toward empty and full so the
+    /// mean stays at the target and the result never leaves 0.0..=1.0.
+    fn sample<R: Rng + ?Sized>(&self, rng: &mut R) -> f64 {
+        let spread = self.fill.min(1.0 - self.fill);
+        let offset = (rng.random::<f64>() + rng.random::<f64>() - 1.0) * spread;
+        (self.fill + offset).clamp(0.0, 1.0)
+    }
+}
+
+/// DNS host override (Unbound) for a generated host
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+pub struct HostOverride {
+    /// Host part of the name
+    pub hostname: String,
+    /// Domain the host belongs to
+    pub domain: String,
+    /// Address the name resolves to
+    pub ip_addr: String,
+}
+
+/// Hosts occupying one VLAN subnet
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+pub struct SubnetPopulation {
+    /// VLAN the subnet belongs to
+    pub vlan_id: u16,
+    /// DHCP static mappings for hosts outside the dynamic pool
+    pub reservations: Vec<StaticReservation>,
+    /// DNS host overrides, one per host
+    pub host_overrides: Vec<HostOverride>,
+    /// Host addresses for the VLAN's host alias, in address order
+    pub alias_members: Vec<String>,
+}
+
+impl SubnetPopulation {
+    /// Number of occupied host addresses
+    pub fn occupied(&self) -> usize {
+        self.alias_members.len()
+    }
+
+    /// Fraction of usable addresses occupied
+    pub fn utilization(&self) -> f64 {
+        self.occupied() as f64 / f64::from(USABLE_HOSTS)
+    }
+
+    /// Name of the firewall alias holding [`Self::alias_members`]
+    pub fn alias_name(&self) -> String {
+        format!("VLAN{}_HOSTS", self.vlan_id)
+    }
+}
+
+/// Hardware address of a generated host
+///
+/// Locally administered and derived from VLAN and host, so it is unique
+/// across the whole run.
+pub(crate) fn host_mac(vlan_id: u16, octet: u8) -> String {
+    format!(
+        "02:00:{:02x}:{:02x}:00:{:02x}",
+        vlan_id >> 8,
+        vlan_id & 0xff,
+        octet
+    )
+}
+
+/// Populate one subnet using the given random source
+pub fn populate_subnet<R: Rng + ?Sized>(
+    config: &VlanConfig,
+    density: HostDensity,
+    rng: &mut R,
+) -> Result<SubnetPopulation> {
+    let hosts = (density.sample(rng) * f64::from(USABLE_HOSTS)).round() as usize;
+    populate_subnet_hosts(config, hosts, rng)
+}
+
+/// Populate one subnet with a fixed number of hosts, at most [`USABLE_HOSTS`]
+pub fn populate_subnet_hosts<R: Rng + ?Sized>(
+    config: &VlanConfig,
+    hosts: usize,
+    rng: &mut R,
+) -> Result<SubnetPopulation> {
+    let base = config.network_base()?;
+    let department = config
+        .description
+        .split(' ')
+        .next()
+        .unwrap_or("unknown")
+        .to_lowercase();
+    let domain = config.dhcp_domain_name();
+
+    let mut octets: Vec<u8> = HOST_OCTETS.collect();
+    let (chosen, _) = octets.partial_shuffle(rng, hosts);
+    let mut chosen = chosen.to_vec();
+    chosen.sort_unstable();
+
+    let mut population = SubnetPopulation {
+        vlan_id: config.vlan_id,
+        reservations: Vec::new(),
+        host_overrides: Vec::with_capacity(chosen.len()),
+        alias_members: Vec::with_capacity(chosen.len()),
+    };
+    for octet in chosen {
+        let ip_addr = format!("{base}.{octet}");
+        let hostname = format!("{department}-host-{octet:03}");
+
+        if !DHCP_POOL.contains(&octet) {
+            population.reservations.push(StaticReservation {
+                mac: host_mac(config.vlan_id, octet),
+                ip_addr: ip_addr.clone(),
+                hostname: hostname.clone(),
+            });
+        }
+        population.host_overrides.push(HostOverride {
+            hostname,
+            domain: domain.clone(),
+            ip_addr: ip_addr.clone(),
+        });
+        population.alias_members.push(ip_addr);
+    }
+
+    Ok(population)
+}
+
+/// Populate every subnet, reproducibly when a seed is given
+pub fn populate_subnets(
+    configs: &[VlanConfig],
+    density: HostDensity,
+    seed: Option<u64>,
+) -> Result<Vec<SubnetPopulation>> {
+    let mut rng = RngStreams::new(seed).stream("subnet-hosts");
+    configs
+        .iter()
+        .map(|config| populate_subnet(config, density, &mut rng))
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn configs(count: u16) -> Vec<VlanConfig> {
+        (0..count)
+            .map(|i| {
+                VlanConfig::new(
+                    100 + i,
+                    format!("10.1.{i}.x"),
+                    format!("IT VLAN {}", 100 + i),
+                    1,
+                )
+                .unwrap()
+            })
+            .collect()
+    }
+
+    #[test]
+    fn test_host_density_rejects_out_of_range() {
+        assert!(HostDensity::new(-0.1).is_err());
+        assert!(HostDensity::new(1.5).is_err());
+        assert!(HostDensity::new(f64::NAN).is_err());
+        assert!(HostDensity::from_percent(101).is_err());
+        assert_eq!(HostDensity::from_percent(40).unwrap().fill(), 0.4);
+    }
+
+    #[test]
+    fn test_empty_and_full_extremes() {
+        let configs = configs(3);
+        let empty = populate_subnets(&configs, HostDensity::new(0.0).unwrap(), Some(1)).unwrap();
+        assert!(empty.iter().all(|p| p.occupied() == 0));
+
+        let full = populate_subnets(&configs, HostDensity::new(1.0).unwrap(), Some(1)).unwrap();
+        for population in &full {
+            assert_eq!(population.occupied(), USABLE_HOSTS as usize);
+            // Everything outside .100-.200 can be reserved
+            assert_eq!(population.reservations.len(), 152);
+        }
+    }
+
+    #[test]
+    fn test_utilization_varies_around_target() {
+        let populations =
+            populate_subnets(&configs(200), HostDensity::new(0.4).unwrap(), Some(42)).unwrap();
+        let utilizations: Vec<f64> = populations.iter().map(|p| p.utilization()).collect();
+        let mean = utilizations.iter().sum::<f64>() / utilizations.len() as f64;
+        assert!((mean - 0.4).abs() < 0.05, "mean utilization {mean}");
+
+        let min = utilizations.iter().cloned().fold(f64::MAX, f64::min);
+        let max = utilizations.iter().cloned().fold(f64::MIN, f64::max);
+        assert!(max - min > 0.2, "expected a spread, got {min}..{max}");
+    }
+
+    #[test]
+    fn test_hosts_avoid_gateway_and_dhcp_pool() {
+        let populations =
+            populate_subnets(&configs(5), HostDensity::new(0.8).unwrap(), Some(7)).unwrap();
+        for population in &populations {
+            assert!(!population.alias_members.iter().any(|ip| ip.ends_with(".1")));
+            for reservation in &population.reservations {
+                let octet: u8 = reservation
+                    .ip_addr
+                    .rsplit('.')
+                    .next()
+                    .unwrap()
+                    .parse()
+                    .unwrap();
+                assert!(!DHCP_POOL.contains(&octet));
+            }
+            assert_eq!(population.host_overrides.len(), population.occupied());
+        }
+    }
+
+    #[test]
+    fn test_seeded_population_is_reproducible() {
+        let configs = configs(4);
+        let density = HostDensity::new(0.5).unwrap();
+        assert_eq!(
+            populate_subnets(&configs, density, Some(9)).unwrap(),
+            populate_subnets(&configs, density, Some(9)).unwrap()
+        );
+    }
+}
@@ -0,0 +1,421 @@
+//! Description style templates for generated VLANs and firewall rules
+//!
+//! Real configurations describe the same objects very differently: some
+//! organizations use terse codes, some write sentences, and some prefix every
+//! change with a ticket number. [`DescriptionStyler`] rewrites the standard
+//! generated descriptions into one of these [`DescriptionStyle`]s, chosen for
+//! all sections at once or per section with [`DescriptionStyles`], so parsers
+//! can be tested against each of them.
+//!
+//! Styling is applied to output only. Generators keep producing the standard
+//! form, which later stages use to recover the department of a VLAN.
+
+use crate::Result;
+use crate::generator::departments;
+use crate::generator::{FirewallRule, RngStreams, VlanConfig};
+use crate::model::ConfigError;
+use clap::ValueEnum;
+use rand::prelude::*;
+use rand_chacha::ChaCha8Rng;
+use std::collections::BTreeMap;
+use std::fmt;
+use std::str::FromStr;
+
+/// Wording of generated descriptions
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq, Hash, ValueEnum)]
+pub enum DescriptionStyle {
+    /// "Sales VLAN 100", "Allow Sales DNS queries - ..."
+    #[default]
+    Standard,
+    /// "SLS-V0100", "SLS-V0100 ALLOW DNS-QUERIES"
+    Terse,
+    /// "Sales department network on VLAN 100"
+    Verbose,
+    /// "[NET-4821] Sales VLAN 100", sharing the ticket with the VLAN's rules
+    Ticket,
+}
+
+impl fmt::Display for DescriptionStyle {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(match self {
+            DescriptionStyle::Standard => "standard",
+            DescriptionStyle::Terse => "terse",
+            DescriptionStyle::Verbose => "verbose",
+            DescriptionStyle::Ticket => "ticket",
+        })
+    }
+}
+
+/// Description style of each output section
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq)]
+pub struct DescriptionStyles {
+    /// VLAN descriptions
+    pub vlan: DescriptionStyle,
+    /// Firewall rule descriptions
+    pub rule: DescriptionStyle,
+}
+
+impl DescriptionStyles {
+    /// The same style for every section
+    pub fn uniform(style: DescriptionStyle) -> Self {
+        Self {
+            vlan: style,
+            rule: style,
+        }
+    }
+
+    /// Whether any section differs from the standard style
+    pub fn is_standard(&self) -> bool {
+        *self == Self::default()
+    }
+}
+
+impl FromStr for DescriptionStyles {
+    type Err = ConfigError;
+
+    /// Parse `STYLE`, `SECTION=STYLE,...`, or a mix such as `verbose,rule=ticket`
+    ///
+    /// A bare style sets every section; `SECTION=STYLE` entries override it.
+    /// Sections are `vlan` and `rule`.
+    fn from_str(spec: &str) -> Result<Self> {
+        let mut styles = Self::default();
+        let mut overrides = Vec::new();
+
+        for part in spec.split(',').map(str::trim).filter(|p| !p.is_empty()) {
+            match part.split_once('=') {
+                Some((section, style)) => overrides.push((section.trim(), parse_style(style)?)),
+                None => styles = Self::uniform(parse_style(part)?),
+            }
+        }
+        for (section, style) in overrides {
+            match section.to_ascii_lowercase().as_str() {
+                "vlan" | "vlans" => styles.vlan = style,
+                "rule" | "rules" => styles.rule = style,
+                other => {
+                    return Err(ConfigError::invalid_parameter(
+                        "description_style",
+                        format!("unknown section '{other}'; expected vlan or rule"),
+                    ));
+                }
+            }
+        }
+        Ok(styles)
+    }
+}
+
+fn parse_style(name: &str) -> Result<DescriptionStyle> {
+    <DescriptionStyle as ValueEnum>::from_str(name.trim(), true).map_err(|_| {
+        ConfigError::invalid_parameter(
+            "description_style",
+            format!("unknown style '{name}'; expected standard, terse, verbose, or ticket"),
+        )
+    })
+}
+
+/// Rule actions produced by the firewall generator
+const RULE_ACTIONS: &[&str] = &["Allow", "Block", "Rate-limited"];
+
+/// Department names that may appear in rule descriptions besides [`departments::DEPARTMENTS`]
+const EXTRA_RULE_DEPARTMENTS: &[&str] = &["Guest", "Lab", "Test"];
+
+/// Rewrites standard descriptions into the configured styles
+pub struct DescriptionStyler {
+    styles: DescriptionStyles,
+    rng: ChaCha8Rng,
+    tickets: BTreeMap<u16, String>,
+}
+
+impl DescriptionStyler {
+    /// Create a styler; ticket numbers are drawn from `seed`
+    pub fn new(styles: DescriptionStyles, seed: Option<u64>) -> Self {
+        Self {
+            styles,
+            rng: RngStreams::new(seed).stream("description-tickets"),
+            tickets: BTreeMap::new(),
+        }
+    }
+
+    /// Copies of `configs` with styled descriptions
+    pub fn style_vlans(&mut self, configs: &[VlanConfig]) -> Vec<VlanConfig> {
+        configs
+            .iter()
+            .map(|config| {
+                let mut styled = config.clone();
+                styled.description = self.vlan_description(config);
+                styled
+            })
+            .collect()
+    }
+
+    /// Copies of `rules` with styled descriptions
+    pub fn style_rules(&mut self, rules: &[FirewallRule]) -> Vec<FirewallRule> {
+        rules
+            .iter()
+            .map(|rule| {
+                let mut styled = rule.clone();
+                styled.description = self.rule_description(rule);
+                styled
+            })
+            .collect()
+    }
+
+    /// Styled description of one VLAN
+    ///
+    /// Descriptions not in the standard `"<department> VLAN <id>"` form, such
+    /// as ones read from an input CSV, only receive ticket prefixes.
+    pub fn vlan_description(&mut self, config: &VlanConfig) -> String {
+        let standard = &config.description;
+        let department = standard
+            .strip_suffix(&format!(" VLAN {}", config.vlan_id))
+            .filter(|d| !d.is_empty());
+
+        match (self.styles.vlan, department) {
+            (DescriptionStyle::Standard, _) => standard.clone(),
+            (DescriptionStyle::Ticket, _) => {
+                format!("[{}] {standard}", self.ticket(config.vlan_id))
+            }
+            (DescriptionStyle::Terse, Some(department)) => {
+                format!("{}-V{:04}", department_code(department), config.vlan_id)
+            }
+            (DescriptionStyle::Verbose, Some(department)) => {
+                format!("{department} department network on VLAN {}", config.vlan_id)
+            }
+            (_, None) => standard.clone(),
+        }
+    }
+
+    /// Styled description of one firewall rule
+    ///
+    /// Descriptions not in the generator's `"<Action> <department> <service> -
+    /// <note>"` form only receive ticket prefixes.
+    pub fn rule_description(&mut self, rule: &FirewallRule) -> String {
+        let standard = &rule.description;
+        let style = self.styles.rule;
+        if style == DescriptionStyle::Standard {
+            return standard.clone();
+        }
+        if style == DescriptionStyle::Ticket {
+            return match rule.vlan_id {
+                Some(vlan_id) => format!("[{}] {standard}", self.ticket(vlan_id)),
+                None => standard.clone(),
+            };
+        }
+
+        let Some(parts) = RuleDescription::parse(standard) else {
+            return standard.clone();
+        };
+        match style {
+            DescriptionStyle::Terse => {
+                let scope = match rule.vlan_id {
+                    Some(vlan_id) => {
+                        format!("{}-V{vlan_id:04}", department_code(parts.department))
+                    }
+                    None => department_code(parts.department),
+                };
+                format!(
+                    "{scope} {} {}",
+                    parts.action.to_ascii_uppercase(),
+                    parts.service.to_ascii_uppercase().replace(' ', "-")
+                )
+            }
+            _ => {
+                let network = match rule.vlan_id {
+                    Some(vlan_id) => format!(" on VLAN {vlan_id}"),
+                    None => String::new(),
+                };
+                let note = parts.note.map(|n| format!(" ({n})")).unwrap_or_default();
+                format!(
+                    "{} {} for the {} department network{network}{note}",
+                    parts.action, parts.service, parts.department
+                )
+            }
+        }
+    }
+
+    /// Ticket shared by a VLAN and its rules
+    fn ticket(&mut self, vlan_id: u16) -> String {
+        let rng = &mut self.rng;
+        self.tickets
+            .entry(vlan_id)
+            .or_insert_with(|| format!("NET-{}", rng.random_range(1000..10000)))
+            .clone()
+    }
+}
+
+/// Parts of a standard rule description
+struct RuleDescription<'a> {
+    action: &'a str,
+    department: &'a str,
+    service: &'a str,
+    note: Option<&'a str>,
+}
+
+impl<'a> RuleDescription<'a> {
+    fn parse(description: &'a str) -> Option<Self> {
+        let (summary, note) = match description.split_once(" - ") {
+            Some((summary, note)) => (summary, Some(note.trim()).filter(|n| !n.is_empty())),
+            None => (description, None),
+        };
+        let (action, rest) = summary.split_once(' ')?;
+        if !RULE_ACTIONS.contains(&action) {
+            return None;
+        }
+        // Longest name first so "Customer Service" wins over a shorter match
+        let department = departments::all_departments()
+            .iter()
+            .chain(EXTRA_RULE_DEPARTMENTS)
+            .copied()
+            .filter(|d| {
+                rest.strip_prefix(d)
+                    .is_some_and(|after| after.starts_with(' '))
+            })
+            .max_by_key(|d| d.len())?;
+        let service = rest[department.len()..].trim();
+        if service.is_empty() {
+            return None;
+        }
+        Some(Self {
+            action,
+            department,
+            service,
+            note,
+        })
+    }
+}
+
+/// Short uppercase code for a department, e.g. "Sales" -> "SLS"
+pub fn department_code(department: &str) -> String {
+    const CODES: &[(&str, &str)] = &[
+        ("Sales", "SLS"),
+        ("IT", "IT"),
+        ("HR", "HR"),
+        ("Finance", "FIN"),
+        ("Marketing", "MKT"),
+        ("Operations", "OPS"),
+        ("Engineering", "ENG"),
+        ("Support", "SUP"),
+        ("Legal", "LGL"),
+        ("Procurement", "PRC"),
+        ("Security", "SEC"),
+        ("Development", "DEV"),
+        ("QA", "QA"),
+        ("Research", "RND"),
+        ("Training", "TRN"),
+        ("Management", "MGT"),
+        ("Accounting", "ACC"),
+        ("Customer Service", "CS"),
+        ("Logistics", "LOG"),
+        ("Production", "PRD"),
+        ("Guest", "GST"),
+        ("Lab", "LAB"),
+        ("Test", "TST"),
+    ];
+    CODES
+        .iter()
+        .find(|(name, _)| name.eq_ignore_ascii_case(department))
+        .map(|(_, code)| code.to_string())
+        .unwrap_or_else(|| {
+            department
+                .chars()
+                .filter(char::is_ascii_alphanumeric)
+                .take(4)
+                .collect::<String>()
+                .to_ascii_uppercase()
+        })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn vlan(id: u16, description: &str) -> VlanConfig {
+        VlanConfig::new(id, "10.1.2.x".to_string(), description.to_string(), 1).unwrap()
+    }
+
+    fn rule(description: &str, vlan_id: Option<u16>) -> FirewallRule {
+        FirewallRule::new(
+            "rule_0001".to_string(),
+            "10.1.2.0/24".to_string(),
+            "any".to_string(),
+            "udp".to_string(),
+            "53".to_string(),
+            "pass".to_string(),
+            "out".to_string(),
+            description.to_string(),
+            true,
+            vlan_id,
+            1,
+            "vlan100".to_string(),
+        )
+        .unwrap()
+    }
+
+    #[test]
+    fn test_parse_styles_spec() {
+        assert_eq!(
+            "terse".parse::<DescriptionStyles>().unwrap(),
+            DescriptionStyles::uniform(DescriptionStyle::Terse)
+        );
+        let styles: DescriptionStyles = "verbose, rule=ticket".parse().unwrap();
+        assert_eq!(styles.vlan, DescriptionStyle::Verbose);
+        assert_eq!(styles.rule, DescriptionStyle::Ticket);
+        let styles: DescriptionStyles = "rule=terse".parse().unwrap();
+        assert_eq!(styles.vlan, DescriptionStyle::Standard);
+        assert!("fancy".parse::<DescriptionStyles>().is_err());
+        assert!("nat=terse".parse::<DescriptionStyles>().is_err());
+    }
+
+    #[test]
+    fn test_vlan_styles() {
+        let config = vlan(100, "Customer Service VLAN 100");
+        let style = |s| {
+            let mut styler = DescriptionStyler::new(DescriptionStyles::uniform(s), Some(1));
+            styler.vlan_description(&config)
+        };
+        assert_eq!(
+            style(DescriptionStyle::Standard),
+            "Customer Service VLAN 100"
+        );
+        assert_eq!(style(DescriptionStyle::Terse), "CS-V0100");
+        assert_eq!(
+            style(DescriptionStyle::Verbose),
+            "Customer Service department network on VLAN 100"
+        );
+        assert!(style(DescriptionStyle::Ticket).starts_with("[NET-"));
+
+        // Non-standard descriptions are left alone
+        let custom = vlan(7, "ISP uplink");
+        let mut styler =
+            DescriptionStyler::new(DescriptionStyles::uniform(DescriptionStyle::Terse), None);
+        assert_eq!(styler.vlan_description(&custom), "ISP uplink");
+    }
+
+    #[test]
+    fn test_rule_styles_share_vlan_ticket() {
+        let description = "Allow Customer Service DNS queries - alpha beta";
+        let mut styler =
+            DescriptionStyler::new(DescriptionStyles::uniform(DescriptionStyle::Terse), Some(1));
+        assert_eq!(
+            styler.rule_description(&rule(description, Some(100))),
+            "CS-V0100 ALLOW DNS-QUERIES"
+        );
+
+        let mut styler = DescriptionStyler::new(
+            DescriptionStyles::uniform(DescriptionStyle::Verbose),
+            Some(1),
+        );
+        assert_eq!(
+            styler.rule_description(&rule(description, Some(100))),
+            "Allow DNS queries for the Customer Service department network on VLAN 100 (alpha beta)"
+        );
+
+        let mut styler = DescriptionStyler::new(
+            DescriptionStyles::uniform(DescriptionStyle::Ticket),
+            Some(1),
+        );
+        let vlan_description = styler.vlan_description(&vlan(100, "Sales VLAN 100"));
+        let rule_description = styler.rule_description(&rule(description, Some(100)));
+        let ticket = &vlan_description[..vlan_description.find(']').unwrap() + 1];
+        assert!(rule_description.starts_with(ticket));
+    }
+}
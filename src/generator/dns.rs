@@ -0,0 +1,318 @@
+//! Bulk Unbound host overrides
+//!
+//! DNS-management UIs are rarely tried with more than a handful of host
+//! overrides. [`generate_dns_overrides`] produces thousands of them over the
+//! generated VLANs: plain A records, wildcard records (`*` as host name) for
+//! application subdomains, and alias records pointing at a host, which is how
+//! OPNsense's Unbound expresses CNAME-style names.
+//!
+//! Names are checked against each other and against the names the run
+//! already resolves, the `--host-density`/`--headcount` hosts and the DHCP
+//! reservations, so no override shadows or duplicates a generated host. Some
+//! candidates deliberately reuse the generated naming scheme; the rejected
+//! ones are counted in [`DnsOverrides::collisions`].
+
+use crate::Result;
+use crate::generator::density::SubnetPopulation;
+use crate::generator::{RngStreams, VlanConfig};
+use crate::model::ConfigError;
+use crate::xml::template::escape_xml_string;
+use rand::prelude::*;
+use serde::{Deserialize, Serialize};
+use std::collections::HashSet;
+
+/// Most overrides one run generates, aliases included
+pub const MAX_DNS_OVERRIDES: u32 = 50_000;
+
+/// Service names host overrides are drawn from
+const SERVICES: &[&str] = &[
+    "api", "app", "backup", "build", "cache", "crm", "db", "erp", "files", "git", "grafana",
+    "intranet", "ldap", "mail", "ntp", "print", "proxy", "sso", "vpn", "wiki",
+];
+
+/// Roles in the names of DHCP reservations, see [`VlanConfig::static_reservations`]
+const RESERVATION_ROLES: &[&str] = &["server", "printer", "workstation", "display", "device"];
+
+/// Subdomains wildcard records are placed under
+const WILDCARD_ZONES: &[&str] = &["apps", "dev", "k8s", "preview", "staging"];
+
+/// An alias of a host override, resolving to the host's address
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct OverrideAlias {
+    /// Host part of the alias
+    pub hostname: String,
+    /// Domain of the alias, not necessarily the host's
+    pub domain: String,
+    /// Alias description
+    pub description: String,
+}
+
+/// An Unbound host override
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct UnboundHost {
+    /// Host part of the name, `*` for a wildcard record
+    pub hostname: String,
+    /// Domain of the record
+    pub domain: String,
+    /// Address the name resolves to
+    pub ip_addr: String,
+    /// Override description
+    pub description: String,
+    /// Names resolving to the same address
+    pub aliases: Vec<OverrideAlias>,
+}
+
+impl UnboundHost {
+    /// Whether the record answers every name below its domain
+    pub fn is_wildcard(&self) -> bool {
+        self.hostname == "*"
+    }
+}
+
+/// Generated host overrides with their collision count
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct DnsOverrides {
+    /// Host overrides, generated hosts first
+    pub hosts: Vec<UnboundHost>,
+    /// Candidate names rejected because they were already taken
+    pub collisions: usize,
+}
+
+impl DnsOverrides {
+    /// Number of wildcard records
+    pub fn wildcards(&self) -> usize {
+        self.hosts.iter().filter(|h| h.is_wildcard()).count()
+    }
+
+    /// Number of alias records
+    pub fn aliases(&self) -> usize {
+        self.hosts.iter().map(|h| h.aliases.len()).sum()
+    }
+}
+
+/// Generate `count` overrides and aliases over `vlans`
+///
+/// The hosts of `populations` become overrides first, as they would in the
+/// firewall's own configuration, and do not count toward `count`.
+pub fn generate_dns_overrides(
+    vlans: &[VlanConfig],
+    populations: &[SubnetPopulation],
+    count: u32,
+    seed: Option<u64>,
+) -> Result<DnsOverrides> {
+    if !(1..=MAX_DNS_OVERRIDES).contains(&count) {
+        return Err(ConfigError::invalid_parameter(
+            "dns_overrides",
+            format!("{count} is outside the supported range 1-{MAX_DNS_OVERRIDES}"),
+        ));
+    }
+    if vlans.is_empty() {
+        return Err(ConfigError::validation(
+            "DNS overrides need at least one VLAN",
+        ));
+    }
+
+    let mut taken = HashSet::new();
+    for vlan in vlans {
+        let domain = vlan.dhcp_domain_name();
+        for reservation in vlan.static_reservations()? {
+            taken.insert(fqdn(&reservation.hostname, &domain));
+        }
+    }
+    let mut hosts = Vec::new();
+    for population in populations {
+        for host in &population.host_overrides {
+            taken.insert(fqdn(&host.hostname, &host.domain));
+            hosts.push(UnboundHost {
+                hostname: host.hostname.clone(),
+                domain: host.domain.clone(),
+                ip_addr: host.ip_addr.clone(),
+                description: format!("Generated host on VLAN {}", population.vlan_id),
+                aliases: Vec::new(),
+            });
+        }
+    }
+
+    let mut rng = RngStreams::new(seed).stream("dns-overrides");
+    let first = hosts.len();
+    let width = count.max(99);
+    let mut collisions = 0;
+    let mut produced = 0;
+    while produced < count {
+        let vlan = &vlans[rng.random_range(0..vlans.len())];
+        let domain = vlan.dhcp_domain_name();
+        let department = domain.split('.').next().unwrap_or("unknown").to_string();
+        let roll = rng.random::<f64>();
+
+        let (hostname, domain) = if roll < 0.05 {
+            let zone = WILDCARD_ZONES.choose(&mut rng).copied().unwrap_or("apps");
+            ("*".to_string(), format!("{zone}.{domain}"))
+        } else if roll < 0.15 {
+            // The generated hosts' schemes, as an admin adding a known host would
+            let hostname = if rng.random_bool(0.8) {
+                format!("{department}-host-{:03}", rng.random_range(2..=254))
+            } else {
+                let role = RESERVATION_ROLES
+                    .choose(&mut rng)
+                    .copied()
+                    .unwrap_or("device");
+                format!("{role}-{department}-{:02}", rng.random_range(1..=3))
+            };
+            (hostname, domain)
+        } else {
+            let service = SERVICES.choose(&mut rng).copied().unwrap_or("app");
+            (
+                format!("{service}-{:02}", rng.random_range(1..=width)),
+                domain,
+            )
+        };
+        if !taken.insert(fqdn(&hostname, &domain)) {
+            collisions += 1;
+            continue;
+        }
+
+        // Aliases attach to earlier plain overrides, possibly in another domain
+        let targets = hosts.len() - first;
+        if hostname != "*" && targets > 0 && rng.random_bool(0.3) {
+            let target = first + rng.random_range(0..targets);
+            let host = &mut hosts[target];
+            if !host.is_wildcard() {
+                let description = format!("Alias of {}", fqdn(&host.hostname, &host.domain));
+                host.aliases.push(OverrideAlias {
+                    hostname,
+                    domain,
+                    description,
+                });
+                produced += 1;
+                continue;
+            }
+        }
+
+        let base = vlan.network_base()?;
+        // Outside the dynamic pool, where servers get fixed addresses
+        let octet = if rng.random_bool(0.5) {
+            rng.random_range(2..100)
+        } else {
+            rng.random_range(201..=254)
+        };
+        let description = if hostname == "*" {
+            format!("Wildcard for {domain}")
+        } else {
+            format!("{} override on VLAN {}", department, vlan.vlan_id)
+        };
+        hosts.push(UnboundHost {
+            hostname,
+            domain,
+            ip_addr: format!("{base}.{octet}"),
+            description,
+            aliases: Vec::new(),
+        });
+        produced += 1;
+    }
+
+    Ok(DnsOverrides { hosts, collisions })
+}
+
+/// Lowercase fully qualified name, for comparisons
+fn fqdn(hostname: &str, domain: &str) -> String {
+    format!("{hostname}.{domain}").to_ascii_lowercase()
+}
+
+/// Render overrides as an OPNsense `<unboundplus>` section
+///
+/// Aliases refer to their host by UUID, as in OPNsense's own configuration.
+pub fn render_dns_overrides(overrides: &DnsOverrides, seed: Option<u64>) -> String {
+    let mut rng = RngStreams::new(seed).stream("dns-override-uuids");
+    let mut hosts = String::from("  <hosts>\n");
+    let mut aliases = String::from("  <aliases>\n");
+    for host in &overrides.hosts {
+        let uuid = uuid::Builder::from_random_bytes(rng.random()).into_uuid();
+        hosts.push_str(&format!(
+            "    <host uuid=\"{uuid}\">\n      <enabled>1</enabled>\n      \
+             <hostname>{}</hostname>\n      <domain>{}</domain>\n      <rr>A</rr>\n      \
+             <mxprio/>\n      <mx/>\n      <server>{}</server>\n      \
+             <description>{}</description>\n    </host>\n",
+            escape_xml_string(&host.hostname),
+            escape_xml_string(&host.domain),
+            escape_xml_string(&host.ip_addr),
+            escape_xml_string(&host.description)
+        ));
+        for alias in &host.aliases {
+            let alias_uuid = uuid::Builder::from_random_bytes(rng.random()).into_uuid();
+            aliases.push_str(&format!(
+                "    <alias uuid=\"{alias_uuid}\">\n      <enabled>1</enabled>\n      \
+                 <host>{uuid}</host>\n      <hostname>{}</hostname>\n      \
+                 <domain>{}</domain>\n      <description>{}</description>\n    </alias>\n",
+                escape_xml_string(&alias.hostname),
+                escape_xml_string(&alias.domain),
+                escape_xml_string(&alias.description)
+            ));
+        }
+    }
+    hosts.push_str("  </hosts>\n");
+    aliases.push_str("  </aliases>\n");
+    format!("<unboundplus>\n{hosts}{aliases}</unboundplus>\n")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::generator::{HostDensity, populate_subnets};
+
+    fn vlans() -> Vec<VlanConfig> {
+        ["Sales", "IT", "Finance"]
+            .iter()
+            .enumerate()
+            .map(|(i, department)| {
+                let id = 100 + i as u16;
+                VlanConfig::new(
+                    id,
+                    format!("10.6.{i}.x"),
+                    format!("{department} VLAN {id}"),
+                    1,
+                )
+                .unwrap()
+            })
+            .collect()
+    }
+
+    #[test]
+    fn test_names_are_unique_and_avoid_generated_hosts() {
+        let vlans = vlans();
+        let populations =
+            populate_subnets(&vlans, HostDensity::new(0.9).unwrap(), Some(3)).unwrap();
+        let overrides = generate_dns_overrides(&vlans, &populations, 3000, Some(3)).unwrap();
+        assert_eq!(
+            overrides,
+            generate_dns_overrides(&vlans, &populations, 3000, Some(3)).unwrap()
+        );
+
+        let generated: usize = populations.iter().map(|p| p.occupied()).sum();
+        let added = overrides.hosts.len() - generated + overrides.aliases();
+        assert_eq!(added, 3000);
+        assert!(overrides.wildcards() > 0);
+        assert!(overrides.aliases() > 0);
+        assert!(overrides.collisions > 0);
+
+        let mut names = HashSet::new();
+        for host in &overrides.hosts {
+            assert!(names.insert(fqdn(&host.hostname, &host.domain)));
+            for alias in &host.aliases {
+                assert!(!host.is_wildcard());
+                assert!(names.insert(fqdn(&alias.hostname, &alias.domain)));
+            }
+        }
+        // DHCP reservation names are never reused
+        assert!(!names.contains("server-it-01.it.company.local"));
+        assert!(generate_dns_overrides(&vlans, &[], 0, None).is_err());
+    }
+
+    #[test]
+    fn test_render_links_aliases_to_hosts() {
+        let overrides = generate_dns_overrides(&vlans(), &[], 200, Some(8)).unwrap();
+        let xml = render_dns_overrides(&overrides, Some(8));
+        assert_eq!(xml.matches("<host uuid=").count(), overrides.hosts.len());
+        assert_eq!(xml.matches("<alias uuid=").count(), overrides.aliases());
+        assert!(xml.contains("<hostname>*</hostname>"));
+    }
+}
@@ -0,0 +1,255 @@
+//! Synthetic threat-intel feeds for URL-table aliases
+//!
+//! OPNsense URL-table aliases periodically download lists of hosts or
+//! networks, typically threat-intel blocklists. [`generate_threat_feeds`]
+//! produces fake lists in the same plain format (one address or CIDR per
+//! line, `#` comments) and [`render_feed_aliases`] the aliases pointing at
+//! them, so alias-refresh jobs can be tested without reaching the internet.
+//!
+//! Every entry lies in 198.18.0.0/15, the range reserved for benchmarking
+//! (RFC 2544), so a generated blocklist can never block a real host.
+
+use crate::Result;
+use crate::generator::RngStreams;
+use crate::model::ConfigError;
+use crate::xml::template::escape_xml_string;
+use rand::prelude::*;
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeSet;
+use std::net::Ipv4Addr;
+
+/// First address of the range feed entries are drawn from
+const FEED_RANGE_START: u32 = u32::from_be_bytes([198, 18, 0, 0]);
+
+/// Number of addresses in 198.18.0.0/15
+const FEED_RANGE_SIZE: u32 = 1 << 17;
+
+/// Maximum number of feeds per run
+pub const MAX_THREAT_FEEDS: u16 = 64;
+
+/// Content of a feed
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum FeedKind {
+    /// Individual host addresses
+    Hosts,
+    /// Networks in CIDR notation
+    Networks,
+}
+
+/// Feed names, kinds, and descriptions, used in order
+const CATALOGUE: &[(&str, FeedKind, &str)] = &[
+    (
+        "botnet-c2",
+        FeedKind::Hosts,
+        "Botnet command-and-control hosts",
+    ),
+    (
+        "scanners",
+        FeedKind::Hosts,
+        "Internet-wide scanning sources",
+    ),
+    (
+        "spam-networks",
+        FeedKind::Networks,
+        "Networks sending unsolicited mail",
+    ),
+    ("tor-exits", FeedKind::Hosts, "Anonymizing proxy exit nodes"),
+    (
+        "phishing",
+        FeedKind::Hosts,
+        "Phishing and credential-harvesting hosts",
+    ),
+    (
+        "hijacked-networks",
+        FeedKind::Networks,
+        "Hijacked and bulletproof-hosting networks",
+    ),
+    (
+        "malware-distribution",
+        FeedKind::Hosts,
+        "Malware distribution hosts",
+    ),
+    (
+        "bruteforce",
+        FeedKind::Hosts,
+        "SSH and VPN brute-force sources",
+    ),
+];
+
+/// A generated blocklist
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct ThreatFeed {
+    /// Feed name, also the file stem
+    pub name: String,
+    /// Whether entries are hosts or networks
+    pub kind: FeedKind,
+    /// What the feed lists
+    pub description: String,
+    /// Addresses or CIDR networks in ascending order
+    pub entries: Vec<String>,
+}
+
+impl ThreatFeed {
+    /// File name the feed is written to
+    pub fn file_name(&self) -> String {
+        format!("{}.txt", self.name)
+    }
+
+    /// Name of the URL-table alias referencing the feed
+    pub fn alias_name(&self) -> String {
+        format!("FEED_{}", self.name.replace('-', "_").to_uppercase())
+    }
+
+    /// Feed file contents: a comment header followed by one entry per line
+    pub fn render(&self) -> String {
+        let mut out = format!(
+            "# {}: {}\n# Synthetic data generated by opnsense-config-faker (198.18.0.0/15)\n\
+             # Entries: {}\n",
+            self.alias_name(),
+            self.description,
+            self.entries.len()
+        );
+        for entry in &self.entries {
+            out.push_str(entry);
+            out.push('\n');
+        }
+        out
+    }
+}
+
+/// Generate `count` feeds
+///
+/// Each feed draws from its own [`RngStreams`] stream, so the feeds of a
+/// seeded run do not depend on the rest of the generated data.
+pub fn generate_threat_feeds(count: u16, seed: Option<u64>) -> Result<Vec<ThreatFeed>> {
+    if !(1..=MAX_THREAT_FEEDS).contains(&count) {
+        return Err(ConfigError::invalid_parameter(
+            "threat_feeds",
+            format!("Feed count must be between 1 and {MAX_THREAT_FEEDS}, got {count}"),
+        ));
+    }
+
+    let streams = RngStreams::new(seed);
+    let feeds = (0..usize::from(count))
+        .map(|index| {
+            let (name, kind, description) = CATALOGUE[index % CATALOGUE.len()];
+            let round = index / CATALOGUE.len();
+            let mut rng = streams.stream_for("threat-feeds", index as u64);
+            ThreatFeed {
+                name: match round {
+                    0 => name.to_string(),
+                    n => format!("{name}-{}", n + 1),
+                },
+                kind,
+                description: description.to_string(),
+                entries: match kind {
+                    FeedKind::Hosts => random_hosts(&mut rng),
+                    FeedKind::Networks => random_networks(&mut rng),
+                },
+            }
+        })
+        .collect();
+    Ok(feeds)
+}
+
+fn random_hosts<R: Rng + ?Sized>(rng: &mut R) -> Vec<String> {
+    let target = rng.random_range(25..=250);
+    let mut hosts = BTreeSet::new();
+    while hosts.len() < target {
+        let address = FEED_RANGE_START + rng.random_range(0..FEED_RANGE_SIZE);
+        if !matches!(address & 0xff, 0 | 255) {
+            hosts.insert(address);
+        }
+    }
+    hosts
+        .into_iter()
+        .map(|a| Ipv4Addr::from(a).to_string())
+        .collect()
+}
+
+fn random_networks<R: Rng + ?Sized>(rng: &mut R) -> Vec<String> {
+    let target = rng.random_range(5..=50);
+    let mut networks = BTreeSet::new();
+    while networks.len() < target {
+        let prefix: u32 = rng.random_range(22..=28);
+        let size = 1u32 << (32 - prefix);
+        let address = FEED_RANGE_START + rng.random_range(0..FEED_RANGE_SIZE / size) * size;
+        networks.insert((address, prefix));
+    }
+    networks
+        .into_iter()
+        .map(|(address, prefix)| format!("{}/{prefix}", Ipv4Addr::from(address)))
+        .collect()
+}
+
+/// URL-table aliases for the feeds, as an OPNsense `<aliases>` section
+///
+/// `base_url` is where the feed files are reachable, e.g. a `file://`
+/// directory or an HTTP server in the lab; each alias fetches
+/// `{base_url}/{file_name}` once a day.
+pub fn render_feed_aliases(feeds: &[ThreatFeed], base_url: &str, seed: Option<u64>) -> String {
+    let mut rng = RngStreams::new(seed).stream("threat-feed-aliases");
+    let base_url = base_url.trim_end_matches('/');
+
+    let mut out = String::from("<aliases>\n");
+    for feed in feeds {
+        let uuid = uuid::Builder::from_random_bytes(rng.random()).into_uuid();
+        out.push_str(&format!(
+            "  <alias uuid=\"{uuid}\">\n    <enabled>1</enabled>\n    <name>{}</name>\n    \
+             <type>urltable</type>\n    <proto/>\n    <interface/>\n    <counters>0</counters>\n    \
+             <updatefreq>1</updatefreq>\n    <content>{}</content>\n    \
+             <description>{}</description>\n  </alias>\n",
+            feed.alias_name(),
+            escape_xml_string(&format!("{base_url}/{}", feed.file_name())),
+            escape_xml_string(&feed.description)
+        ));
+    }
+    out.push_str("</aliases>\n");
+    out
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use ipnetwork::Ipv4Network;
+
+    #[test]
+    fn test_feeds_are_seeded_and_named() {
+        let feeds = generate_threat_feeds(10, Some(42)).unwrap();
+        assert_eq!(feeds, generate_threat_feeds(10, Some(42)).unwrap());
+        assert_eq!(feeds[0].alias_name(), "FEED_BOTNET_C2");
+        assert_eq!(feeds[8].name, "botnet-c2-2");
+        assert_ne!(feeds[0].entries, feeds[8].entries);
+        assert!(generate_threat_feeds(0, None).is_err());
+    }
+
+    #[test]
+    fn test_entries_stay_in_benchmark_range() {
+        let range: Ipv4Network = "198.18.0.0/15".parse().unwrap();
+        for feed in generate_threat_feeds(8, Some(7)).unwrap() {
+            assert!(!feed.entries.is_empty());
+            for entry in &feed.entries {
+                let network: Ipv4Network = entry.parse().unwrap();
+                assert!(range.contains(network.network()), "{entry} outside range");
+                assert_eq!(network.prefix() == 32, feed.kind == FeedKind::Hosts);
+            }
+            let rendered = feed.render();
+            let lines = rendered.lines().filter(|l| !l.starts_with('#')).count();
+            assert_eq!(lines, feed.entries.len());
+        }
+    }
+
+    #[test]
+    fn test_render_feed_aliases() {
+        let feeds = generate_threat_feeds(2, Some(1)).unwrap();
+        let xml = render_feed_aliases(&feeds, "http://10.0.0.5:8080/feeds/", Some(1));
+        assert!(xml.contains("<type>urltable</type>"));
+        assert!(xml.contains("<content>http://10.0.0.5:8080/feeds/scanners.txt</content>"));
+        assert_eq!(
+            xml,
+            render_feed_aliases(&feeds, "http://10.0.0.5:8080/feeds/", Some(1))
+        );
+        crate::xml::diff::flatten(&xml).unwrap();
+    }
+}
@@ -0,0 +1,394 @@
+//! Device classes and DHCP fingerprints for generated hosts
+//!
+//! [`DeviceRegistry::from_populations`] gives every host of a
+//! [`SubnetPopulation`] a device class and an operating system, together
+//! with the DHCP parameter request list (option 55) and vendor class
+//! (option 60) that system sends. NAC and profiling tools identify
+//! endpoints by these options, so the same host always carries the same
+//! fingerprint in the registry JSON and in the lease file rendered by
+//! [`DeviceRegistry::render_leases`].
+
+use crate::generator::RngStreams;
+use crate::generator::density::{DHCP_POOL, SubnetPopulation, host_mac};
+use crate::generator::vlan::VlanConfig;
+use rand::prelude::*;
+use serde::{Deserialize, Serialize};
+use std::fmt;
+use std::fmt::Write as _;
+
+/// Time leases are rendered at: 2024-01-01 00:00:00 UTC
+///
+/// Fixed so seeded runs write identical lease files; every lease is active
+/// at this time.
+pub const LEASE_SNAPSHOT: u64 = 1_704_067_200;
+
+/// Kind of endpoint a generated host is
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash, Serialize, Deserialize)]
+#[serde(rename_all = "kebab-case")]
+pub enum DeviceClass {
+    /// Desktop computer
+    Workstation,
+    /// Portable computer
+    Laptop,
+    /// Smartphone or tablet
+    Phone,
+    /// Desk phone
+    VoipPhone,
+    /// Network printer
+    Printer,
+    /// IP camera
+    Camera,
+    /// Server
+    Server,
+}
+
+impl DeviceClass {
+    /// Every class, in registry order
+    pub const ALL: [DeviceClass; 7] = [
+        DeviceClass::Workstation,
+        DeviceClass::Laptop,
+        DeviceClass::Phone,
+        DeviceClass::VoipPhone,
+        DeviceClass::Printer,
+        DeviceClass::Camera,
+        DeviceClass::Server,
+    ];
+
+    /// Share of generated hosts in this class, in percent
+    fn weight(&self) -> u32 {
+        match self {
+            DeviceClass::Workstation => 35,
+            DeviceClass::Laptop => 25,
+            DeviceClass::Phone => 15,
+            DeviceClass::VoipPhone => 8,
+            DeviceClass::Printer => 5,
+            DeviceClass::Camera => 5,
+            DeviceClass::Server => 7,
+        }
+    }
+
+    /// Draw a class according to the weights
+    fn pick<R: Rng + ?Sized>(rng: &mut R) -> Self {
+        let total: u32 = Self::ALL.iter().map(Self::weight).sum();
+        let mut pick = rng.random_range(0..total);
+        for class in Self::ALL {
+            if pick < class.weight() {
+                return class;
+            }
+            pick -= class.weight();
+        }
+        DeviceClass::Workstation
+    }
+
+    /// Operating systems seen in this class and their DHCP options
+    pub fn profiles(&self) -> &'static [DhcpProfile] {
+        match self {
+            DeviceClass::Workstation => &[
+                DhcpProfile {
+                    os: "Windows 11",
+                    parameter_request_list: "1,3,6,15,31,33,43,44,46,47,119,121,249,252",
+                    vendor_class: Some("MSFT 5.0"),
+                },
+                DhcpProfile {
+                    os: "Ubuntu 22.04",
+                    parameter_request_list: "1,2,6,12,15,26,28,121,3,33,40,41,42,119,249,252,17",
+                    vendor_class: None,
+                },
+            ],
+            DeviceClass::Laptop => &[
+                DhcpProfile {
+                    os: "Windows 10",
+                    parameter_request_list: "1,3,6,15,31,33,43,44,46,47,119,121,249,252",
+                    vendor_class: Some("MSFT 5.0"),
+                },
+                DhcpProfile {
+                    os: "macOS 14",
+                    parameter_request_list: "1,121,3,6,15,108,114,119,252,95,44,46",
+                    vendor_class: None,
+                },
+            ],
+            DeviceClass::Phone => &[
+                DhcpProfile {
+                    os: "iOS 17",
+                    parameter_request_list: "1,121,3,6,15,108,114,119,252",
+                    vendor_class: None,
+                },
+                DhcpProfile {
+                    os: "Android 14",
+                    parameter_request_list: "1,3,6,15,26,28,51,58,59,43,114,108",
+                    vendor_class: Some("android-dhcp-14"),
+                },
+            ],
+            DeviceClass::VoipPhone => &[DhcpProfile {
+                os: "Polycom UC Software",
+                parameter_request_list: "1,28,66,6,15,3,35,150,42,7,2,4,12",
+                vendor_class: Some("Polycom-VVX411"),
+            }],
+            DeviceClass::Printer => &[DhcpProfile {
+                os: "HP JetDirect",
+                parameter_request_list: "1,3,44,6,7,12,15,22,54,58,59,69,18,144",
+                vendor_class: Some("Hewlett-Packard JetDirect"),
+            }],
+            DeviceClass::Camera => &[DhcpProfile {
+                os: "Embedded Linux (BusyBox)",
+                parameter_request_list: "1,3,6,12,15,28,42",
+                vendor_class: Some("udhcp 1.31.1"),
+            }],
+            DeviceClass::Server => &[DhcpProfile {
+                os: "Red Hat Enterprise Linux 9",
+                parameter_request_list: "1,28,2,3,15,6,119,12,44,47,26,121,42",
+                vendor_class: None,
+            }],
+        }
+    }
+}
+
+impl fmt::Display for DeviceClass {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(match self {
+            DeviceClass::Workstation => "workstation",
+            DeviceClass::Laptop => "laptop",
+            DeviceClass::Phone => "phone",
+            DeviceClass::VoipPhone => "voip-phone",
+            DeviceClass::Printer => "printer",
+            DeviceClass::Camera => "camera",
+            DeviceClass::Server => "server",
+        })
+    }
+}
+
+/// DHCP options an operating system sends when requesting a lease
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct DhcpProfile {
+    /// Operating system label
+    pub os: &'static str,
+    /// Option 55, the parameter request list, in the order the client sends it
+    pub parameter_request_list: &'static str,
+    /// Option 60, if the client sends one
+    pub vendor_class: Option<&'static str>,
+}
+
+/// A generated host with its device fingerprint
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Device {
+    /// VLAN the host is in
+    pub vlan_id: u16,
+    /// Host name, as in the host override
+    pub hostname: String,
+    /// Host address
+    pub ip_addr: String,
+    /// Hardware address
+    pub mac: String,
+    /// Device class
+    pub class: DeviceClass,
+    /// Operating system label
+    pub os: String,
+    /// DHCP option 55 as a comma-separated list
+    pub dhcp_fingerprint: String,
+    /// DHCP option 60
+    pub vendor_class: Option<String>,
+    /// Dynamic lease, for hosts inside the DHCP pool
+    pub lease: Option<Lease>,
+}
+
+/// Lease of a host in the dynamic pool, in Unix seconds
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Lease {
+    /// Start of the lease
+    pub starts: u64,
+    /// End of the lease
+    pub ends: u64,
+}
+
+/// Fingerprinted devices of a run
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub struct DeviceRegistry {
+    /// Devices in VLAN and address order
+    pub devices: Vec<Device>,
+}
+
+impl DeviceRegistry {
+    /// Fingerprint every host of the populations
+    ///
+    /// Each VLAN draws from its own stream of `seed`, so filtering VLANs
+    /// leaves the devices of the others unchanged.
+    pub fn from_populations(
+        configs: &[VlanConfig],
+        populations: &[SubnetPopulation],
+        seed: Option<u64>,
+    ) -> Self {
+        let streams = RngStreams::new(seed);
+        let mut devices = Vec::new();
+
+        for population in populations {
+            let mut rng = streams.stream_for("devices", u64::from(population.vlan_id));
+            let lease_time = configs
+                .iter()
+                .find(|c| c.vlan_id == population.vlan_id)
+                .map_or(86400, VlanConfig::dhcp_lease_time);
+
+            for host in &population.host_overrides {
+                let class = DeviceClass::pick(&mut rng);
+                let profiles = class.profiles();
+                let profile = profiles[rng.random_range(0..profiles.len())];
+
+                let octet: u8 = host
+                    .ip_addr
+                    .rsplit('.')
+                    .next()
+                    .and_then(|o| o.parse().ok())
+                    .unwrap_or_default();
+                let reservation = population
+                    .reservations
+                    .iter()
+                    .find(|r| r.ip_addr == host.ip_addr);
+                let lease = DHCP_POOL.contains(&octet).then(|| {
+                    // Staggered renewals, all active at the snapshot
+                    let elapsed = rng.random_range(0..u64::from(lease_time));
+                    Lease {
+                        starts: LEASE_SNAPSHOT - elapsed,
+                        ends: LEASE_SNAPSHOT - elapsed + u64::from(lease_time),
+                    }
+                });
+
+                devices.push(Device {
+                    vlan_id: population.vlan_id,
+                    hostname: host.hostname.clone(),
+                    ip_addr: host.ip_addr.clone(),
+                    mac: reservation
+                        .map(|r| r.mac.clone())
+                        .unwrap_or_else(|| host_mac(population.vlan_id, octet)),
+                    class,
+                    os: profile.os.to_string(),
+                    dhcp_fingerprint: profile.parameter_request_list.to_string(),
+                    vendor_class: profile.vendor_class.map(str::to_string),
+                    lease,
+                });
+            }
+        }
+
+        Self { devices }
+    }
+
+    /// Number of devices per class
+    pub fn class_counts(&self) -> Vec<(DeviceClass, usize)> {
+        DeviceClass::ALL
+            .into_iter()
+            .map(|class| {
+                (
+                    class,
+                    self.devices.iter().filter(|d| d.class == class).count(),
+                )
+            })
+            .collect()
+    }
+
+    /// Leases of the pool devices in ISC dhcpd format (`dhcpd.leases(5)`)
+    ///
+    /// The fingerprint options are recorded with `set` statements, as an
+    /// `on commit` hook in `dhcpd.conf` would store them for profiling.
+    pub fn render_leases(&self) -> String {
+        let mut out = String::from(
+            "# The format of this file is documented in the dhcpd.leases(5) manual page.\n",
+        );
+        for device in &self.devices {
+            let Some(lease) = device.lease else {
+                continue;
+            };
+            let _ = writeln!(out, "\nlease {} {{", device.ip_addr);
+            let _ = writeln!(out, "  starts {};", lease_timestamp(lease.starts));
+            let _ = writeln!(out, "  ends {};", lease_timestamp(lease.ends));
+            let _ = writeln!(out, "  cltt {};", lease_timestamp(lease.starts));
+            out.push_str("  binding state active;\n  next binding state free;\n");
+            let _ = writeln!(out, "  hardware ethernet {};", device.mac);
+            if let Some(vendor_class) = &device.vendor_class {
+                let _ = writeln!(out, "  set vendor-class-identifier = \"{vendor_class}\";");
+            }
+            let _ = writeln!(
+                out,
+                "  set parameter-request-list = \"{}\";",
+                device.dhcp_fingerprint
+            );
+            let _ = writeln!(out, "  client-hostname \"{}\";", device.hostname);
+            out.push_str("}\n");
+        }
+        out
+    }
+}
+
+/// Lease time as `<weekday> YYYY/MM/DD HH:MM:SS` in UTC, weekday 0 being Sunday
+fn lease_timestamp(secs: u64) -> String {
+    let days = secs / 86400;
+    let time = secs % 86400;
+    // 1970-01-01 was a Thursday
+    let weekday = (days + 4) % 7;
+    let (year, month, day) = civil_from_days(days);
+    format!(
+        "{weekday} {year:04}/{month:02}/{day:02} {:02}:{:02}:{:02}",
+        time / 3600,
+        time % 3600 / 60,
+        time % 60
+    )
+}
+
+/// Gregorian date of a day count since 1970-01-01
+pub(crate) fn civil_from_days(days: u64) -> (u64, u64, u64) {
+    // Shift to an era starting 0000-03-01 so leap days end each year
+    let z = days + 719_468;
+    let era = z / 146_097;
+    let day_of_era = z % 146_097;
+    let year_of_era =
+        (day_of_era - day_of_era / 1460 + day_of_era / 36_524 - day_of_era / 146_096) / 365;
+    let day_of_year = day_of_era - (365 * year_of_era + year_of_era / 4 - year_of_era / 100);
+    let shifted_month = (5 * day_of_year + 2) / 153;
+    let day = day_of_year - (153 * shifted_month + 2) / 5 + 1;
+    let month = if shifted_month < 10 {
+        shifted_month + 3
+    } else {
+        shifted_month - 9
+    };
+    let year = era * 400 + year_of_era + u64::from(month <= 2);
+    (year, month, day)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::generator::density::{HostDensity, populate_subnets};
+
+    #[test]
+    fn test_registry_is_consistent_with_leases() {
+        let configs = vec![
+            VlanConfig::new(120, "10.10.20.x".to_string(), "IT VLAN 120".to_string(), 1).unwrap(),
+        ];
+        let populations =
+            populate_subnets(&configs, HostDensity::from_percent(60).unwrap(), Some(5)).unwrap();
+        let registry = DeviceRegistry::from_populations(&configs, &populations, Some(5));
+
+        assert_eq!(registry.devices.len(), populations[0].occupied());
+        assert_eq!(
+            registry,
+            DeviceRegistry::from_populations(&configs, &populations, Some(5))
+        );
+
+        let leases = registry.render_leases();
+        for device in &registry.devices {
+            let in_pool = leases.contains(&format!("lease {} {{", device.ip_addr));
+            assert_eq!(in_pool, device.lease.is_some());
+            let profile = device
+                .class
+                .profiles()
+                .iter()
+                .find(|p| p.os == device.os)
+                .unwrap();
+            assert_eq!(device.dhcp_fingerprint, profile.parameter_request_list);
+        }
+        assert!(leases.contains("set parameter-request-list = \"1,"));
+    }
+
+    #[test]
+    fn test_lease_timestamp_format() {
+        assert_eq!(lease_timestamp(LEASE_SNAPSHOT), "1 2024/01/01 00:00:00");
+        assert_eq!(lease_timestamp(951_827_696), "2 2000/02/29 12:34:56");
+    }
+}
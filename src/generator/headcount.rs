@@ -0,0 +1,414 @@
+//! Department headcount model
+//!
+//! Generated objects otherwise scale with the VLAN count alone, so a Legal
+//! VLAN gets as many hosts and rules as a Sales VLAN. A [`HeadcountModel`]
+//! assigns every department a number of people, and [`plan_departments`]
+//! derives the users, devices, and extra firewall rules of each VLAN from it,
+//! so every subsystem grows with the same headcount: Sales with 200 people
+//! gets twenty times the users, reservations, and more rules than Legal
+//! with 10.
+//!
+//! A department's headcount is split evenly across its VLANs. Departments
+//! are recognized by the start of the VLAN description, as generated VLANs
+//! are described as `"<department> VLAN <id>"`.
+
+use crate::Result;
+use crate::generator::density::{SubnetPopulation, USABLE_HOSTS, populate_subnet_hosts};
+use crate::generator::departments::DEPARTMENTS;
+use crate::generator::{FirewallRule, RngStreams, VlanConfig};
+use crate::model::ConfigError;
+use crate::xml::template::escape_xml_string;
+use fake::Fake;
+use fake::faker::name::en::{FirstName, LastName};
+use serde::{Deserialize, Serialize};
+use std::collections::{BTreeMap, HashMap, HashSet};
+use std::path::Path;
+
+/// People per extra firewall rule of a VLAN
+pub const USERS_PER_RULE: u32 = 25;
+
+/// First uid and gid OPNsense assigns to local users and groups
+pub const FIRST_ID: u32 = 2000;
+
+/// Services opened by the extra rules, in the order VLANs gain them
+const STAFF_SERVICES: &[(&str, &str, &str)] = &[
+    ("HTTPS", "tcp", "443"),
+    ("SSH", "tcp", "22"),
+    ("IMAPS", "tcp", "993"),
+    ("mail submission", "tcp", "587"),
+    ("RDP", "tcp", "3389"),
+    ("SMB", "tcp", "445"),
+    ("LDAPS", "tcp", "636"),
+    ("Kerberos", "tcp", "88"),
+    ("SIP", "udp", "5060"),
+    ("MS SQL", "tcp", "1433"),
+    ("PostgreSQL", "tcp", "5432"),
+    ("HTTP proxy", "tcp", "8080"),
+];
+
+/// Built-in headcount of each department in [`DEPARTMENTS`]
+const DEFAULT_HEADCOUNTS: &[(&str, u32)] = &[
+    ("Sales", 200),
+    ("IT", 40),
+    ("HR", 15),
+    ("Finance", 30),
+    ("Marketing", 60),
+    ("Operations", 80),
+    ("Engineering", 150),
+    ("Support", 120),
+    ("Legal", 10),
+    ("Procurement", 12),
+    ("Security", 20),
+    ("Development", 100),
+    ("QA", 35),
+    ("Research", 45),
+    ("Training", 8),
+    ("Management", 25),
+    ("Accounting", 20),
+    ("Customer Service", 90),
+    ("Logistics", 50),
+    ("Production", 180),
+];
+
+/// People per department and devices per person
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+#[serde(default, deny_unknown_fields)]
+pub struct HeadcountModel {
+    /// Headcount by department name
+    pub departments: BTreeMap<String, u32>,
+    /// Headcount of departments not listed
+    pub default: u32,
+    /// Devices per person, e.g. 1.5 for a laptop each and a phone for half
+    pub devices_per_user: f64,
+}
+
+impl Default for HeadcountModel {
+    fn default() -> Self {
+        Self {
+            departments: DEFAULT_HEADCOUNTS
+                .iter()
+                .map(|&(name, count)| (name.to_string(), count))
+                .collect(),
+            default: 25,
+            devices_per_user: 1.5,
+        }
+    }
+}
+
+impl HeadcountModel {
+    /// Load a model from a JSON file
+    ///
+    /// Fields left out keep their built-in values; a `departments` map
+    /// replaces the built-in one as a whole.
+    pub fn load<P: AsRef<Path>>(path: P) -> Result<Self> {
+        let content = std::fs::read_to_string(path)?;
+        let model: HeadcountModel = serde_json::from_str(&content)?;
+        model.validate()?;
+        Ok(model)
+    }
+
+    /// Check the model for values no department could have
+    pub fn validate(&self) -> Result<()> {
+        if !self.devices_per_user.is_finite() || !(0.0..=10.0).contains(&self.devices_per_user) {
+            return Err(ConfigError::invalid_parameter(
+                "devices_per_user",
+                format!("must be between 0 and 10, got {}", self.devices_per_user),
+            ));
+        }
+        Ok(())
+    }
+
+    /// Headcount of a department
+    pub fn headcount(&self, department: &str) -> u32 {
+        self.departments
+            .get(department)
+            .copied()
+            .unwrap_or(self.default)
+    }
+}
+
+/// What one VLAN gets from its department's headcount
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct DepartmentPlan {
+    /// VLAN the share is assigned to
+    pub vlan_id: u16,
+    /// Department owning the VLAN
+    pub department: String,
+    /// People on the VLAN
+    pub users: u32,
+    /// Hosts in the VLAN subnet, capped at the usable addresses of a /24
+    pub devices: u16,
+    /// Firewall rules added for the VLAN's staff services
+    pub rules: u16,
+}
+
+/// Department a VLAN belongs to, from the start of its description
+pub fn vlan_department(config: &VlanConfig) -> String {
+    DEPARTMENTS
+        .iter()
+        .filter(|name| {
+            config
+                .description
+                .strip_prefix(**name)
+                .is_some_and(|rest| rest.is_empty() || rest.starts_with(' '))
+        })
+        .max_by_key(|name| name.len())
+        .map(|name| name.to_string())
+        .unwrap_or_else(|| {
+            let first = config.description.split(' ').next().unwrap_or_default();
+            if first.is_empty() { "Unknown" } else { first }.to_string()
+        })
+}
+
+/// Split each department's headcount across its VLANs
+///
+/// Plans follow the order of `configs`. Earlier VLANs of a department get the
+/// remainder of an uneven split.
+pub fn plan_departments(model: &HeadcountModel, configs: &[VlanConfig]) -> Vec<DepartmentPlan> {
+    let departments: Vec<String> = configs.iter().map(vlan_department).collect();
+    let mut vlans_per_department: HashMap<&str, u32> = HashMap::new();
+    for department in &departments {
+        *vlans_per_department.entry(department).or_default() += 1;
+    }
+
+    let mut seen: HashMap<&str, u32> = HashMap::new();
+    configs
+        .iter()
+        .zip(&departments)
+        .map(|(config, department)| {
+            let vlans = vlans_per_department[department.as_str()];
+            let position = seen.entry(department).or_default();
+            let headcount = model.headcount(department);
+            let users = headcount / vlans + u32::from(*position < headcount % vlans);
+            *position += 1;
+
+            let devices = (f64::from(users) * model.devices_per_user).ceil();
+            DepartmentPlan {
+                vlan_id: config.vlan_id,
+                department: department.clone(),
+                users,
+                devices: devices.min(f64::from(USABLE_HOSTS)) as u16,
+                rules: users
+                    .div_ceil(USERS_PER_RULE)
+                    .min(STAFF_SERVICES.len() as u32) as u16,
+            }
+        })
+        .collect()
+}
+
+/// Populate each VLAN subnet with its planned devices
+pub fn populate_by_headcount(
+    configs: &[VlanConfig],
+    plans: &[DepartmentPlan],
+    seed: Option<u64>,
+) -> Result<Vec<SubnetPopulation>> {
+    let mut rng = RngStreams::new(seed).stream("headcount-hosts");
+    configs
+        .iter()
+        .zip(plans)
+        .map(|(config, plan)| populate_subnet_hosts(config, usize::from(plan.devices), &mut rng))
+        .collect()
+}
+
+/// Staff service rules of each VLAN, numbered after its existing rules
+pub fn headcount_rules(
+    configs: &[VlanConfig],
+    plans: &[DepartmentPlan],
+    existing: &[FirewallRule],
+) -> Result<Vec<FirewallRule>> {
+    let mut rules = Vec::new();
+    for (config, plan) in configs.iter().zip(plans) {
+        let last = existing
+            .iter()
+            .filter(|rule| rule.vlan_id == Some(config.vlan_id))
+            .map(|rule| rule.priority)
+            .max()
+            .unwrap_or(0);
+        for (index, (service, protocol, port)) in
+            STAFF_SERVICES[..usize::from(plan.rules)].iter().enumerate()
+        {
+            rules.push(FirewallRule::new(
+                format!("rule_v{}_staff_{:02}", config.vlan_id, index + 1),
+                config.ip_network.clone(),
+                "any".to_string(),
+                protocol.to_string(),
+                port.to_string(),
+                "pass".to_string(),
+                "out".to_string(),
+                format!("Allow {} staff {service}", plan.department),
+                false,
+                Some(config.vlan_id),
+                last + index as u16 + 1,
+                format!("vlan{}", config.vlan_id),
+            )?);
+        }
+    }
+    Ok(rules)
+}
+
+/// A local user account of a department
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct DepartmentUser {
+    /// Login name
+    pub name: String,
+    /// Full name, written as the user's description
+    pub full_name: String,
+    /// Department the user belongs to
+    pub department: String,
+    /// VLAN the user's devices sit on
+    pub vlan_id: u16,
+    /// User ID
+    pub uid: u32,
+}
+
+/// Generate the planned users of every VLAN
+///
+/// Login names are the first initial and last name, numbered on collision.
+pub fn generate_users(plans: &[DepartmentPlan], seed: Option<u64>) -> Vec<DepartmentUser> {
+    let mut rng = RngStreams::new(seed).stream("headcount-users");
+    let total = plans.iter().map(|plan| plan.users as usize).sum();
+    let mut users = Vec::with_capacity(total);
+    let mut taken = HashSet::with_capacity(total);
+
+    for plan in plans {
+        for _ in 0..plan.users {
+            let first: String = FirstName().fake_with_rng(&mut rng);
+            let last: String = LastName().fake_with_rng(&mut rng);
+            let login: String = first
+                .chars()
+                .take(1)
+                .chain(last.chars())
+                .filter(char::is_ascii_alphanumeric)
+                .collect::<String>()
+                .to_lowercase();
+            let mut name = login.clone();
+            let mut suffix = 1;
+            while !taken.insert(name.clone()) {
+                suffix += 1;
+                name = format!("{login}{suffix}");
+            }
+            users.push(DepartmentUser {
+                name,
+                full_name: format!("{first} {last}"),
+                department: plan.department.clone(),
+                vlan_id: plan.vlan_id,
+                uid: FIRST_ID + users.len() as u32,
+            });
+        }
+    }
+    users
+}
+
+/// Group name of a department
+pub fn group_name(department: &str) -> String {
+    department.to_lowercase().replace(' ', "-")
+}
+
+/// Render users and one group per department as an OPNsense `<system>` section
+pub fn render_users(users: &[DepartmentUser]) -> String {
+    let mut groups: Vec<(&str, Vec<u32>)> = Vec::new();
+    for user in users {
+        match groups.iter_mut().find(|(name, _)| *name == user.department) {
+            Some((_, members)) => members.push(user.uid),
+            None => groups.push((&user.department, vec![user.uid])),
+        }
+    }
+
+    let mut out = String::from("<system>\n");
+    for (index, (department, members)) in groups.iter().enumerate() {
+        let members: Vec<String> = members.iter().map(u32::to_string).collect();
+        out.push_str(&format!(
+            "  <group>\n    <name>{}</name>\n    <description>{} staff</description>\n    \
+             <scope>user</scope>\n    <gid>{}</gid>\n    <member>{}</member>\n    \
+             <priv/>\n  </group>\n",
+            escape_xml_string(&group_name(department)),
+            escape_xml_string(department),
+            FIRST_ID + index as u32,
+            members.join(",")
+        ));
+    }
+    for user in users {
+        out.push_str(&format!(
+            "  <user>\n    <name>{}</name>\n    <descr>{}</descr>\n    <scope>user</scope>\n    \
+             <groupname>{}</groupname>\n    <uid>{}</uid>\n    <expires/>\n    \
+             <authorizedkeys/>\n  </user>\n",
+            escape_xml_string(&user.name),
+            escape_xml_string(&user.full_name),
+            escape_xml_string(&group_name(&user.department)),
+            user.uid
+        ));
+    }
+    out.push_str("</system>\n");
+    out
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn configs() -> Vec<VlanConfig> {
+        [
+            (100, "Sales VLAN 100"),
+            (101, "Legal VLAN 101"),
+            (102, "Sales VLAN 102"),
+            (103, "Customer Service VLAN 103"),
+        ]
+        .into_iter()
+        .enumerate()
+        .map(|(i, (id, description))| {
+            VlanConfig::new(id, format!("10.6.{i}.x"), description.to_string(), 1).unwrap()
+        })
+        .collect()
+    }
+
+    #[test]
+    fn test_subsystems_scale_with_headcount() {
+        let mut model = HeadcountModel::default();
+        model.departments.insert("Sales".to_string(), 201);
+        let plans = plan_departments(&model, &configs());
+
+        let users: Vec<u32> = plans.iter().map(|p| p.users).collect();
+        assert_eq!(users, [101, 10, 100, 90]);
+        assert_eq!(plans[1].department, "Legal");
+        assert_eq!(plans[3].department, "Customer Service");
+        assert_eq!((plans[0].devices, plans[1].devices), (152, 15));
+        assert_eq!((plans[0].rules, plans[1].rules), (5, 1));
+
+        let populations = populate_by_headcount(&configs(), &plans, Some(3)).unwrap();
+        assert_eq!(populations[0].occupied(), 152);
+        assert_eq!(populations[1].occupied(), 15);
+
+        let rules = headcount_rules(&configs(), &plans, &[]).unwrap();
+        assert_eq!(rules.iter().filter(|r| r.vlan_id == Some(100)).count(), 5);
+        assert_eq!(rules.iter().filter(|r| r.vlan_id == Some(101)).count(), 1);
+        assert!(rules.iter().all(|r| r.validate().is_ok()));
+    }
+
+    #[test]
+    fn test_users_are_unique_and_grouped() {
+        let plans = plan_departments(&HeadcountModel::default(), &configs());
+        let users = generate_users(&plans, Some(8));
+        assert_eq!(users, generate_users(&plans, Some(8)));
+        assert_eq!(users.len(), 300);
+        assert_eq!(users.iter().filter(|u| u.department == "Legal").count(), 10);
+        let names: HashSet<&str> = users.iter().map(|u| u.name.as_str()).collect();
+        assert_eq!(names.len(), users.len());
+
+        let xml = render_users(&users);
+        assert_eq!(xml.matches("<group>").count(), 3);
+        assert!(xml.contains("<name>customer-service</name>"));
+        assert_eq!(xml.matches("<user>").count(), 300);
+    }
+
+    #[test]
+    fn test_model_rejects_bad_device_ratio() {
+        let model = HeadcountModel {
+            devices_per_user: -1.0,
+            ..HeadcountModel::default()
+        };
+        assert!(model.validate().is_err());
+        let partial: HeadcountModel = serde_json::from_str(r#"{"default": 7}"#).unwrap();
+        assert_eq!(partial.headcount("Sales"), 200);
+        assert_eq!(partial.headcount("Facilities"), 7);
+    }
+}
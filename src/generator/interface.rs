@@ -0,0 +1,237 @@
+//! Interface link-layer profiles for generated VLANs
+//!
+//! Every generated VLAN otherwise carries the same default MTU, no MSS clamp,
+//! and priority code point 0. [`assign_interface_profiles`] gives each VLAN a
+//! [`VlanType`] and derives the values real networks use for that type: jumbo
+//! frames on storage, 1492 with MSS clamping on PPPoE uplinks, and 802.1p
+//! priorities for voice and management traffic.
+
+use crate::generator::RngStreams;
+use crate::generator::vlan::VlanConfig;
+use rand::prelude::*;
+use serde::{Deserialize, Serialize};
+use std::fmt;
+
+/// Standard Ethernet MTU
+pub const ETHERNET_MTU: u16 = 1500;
+
+/// Jumbo frame MTU used on storage networks
+pub const JUMBO_MTU: u16 = 9000;
+
+/// PPPoE MTU (Ethernet MTU minus the 8-byte PPPoE header)
+pub const PPPOE_MTU: u16 = 1492;
+
+/// IPv4 plus TCP header bytes subtracted from the MTU for MSS clamping
+const TCP_IP_HEADER: u16 = 40;
+
+/// Purpose of a VLAN, which determines its link-layer settings
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash, PartialOrd, Ord, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum VlanType {
+    /// General user traffic
+    Data,
+    /// VoIP phones and media
+    Voice,
+    /// iSCSI/NFS storage with jumbo frames
+    Storage,
+    /// Switch, hypervisor, and out-of-band management
+    Management,
+    /// Isolated guest access
+    Guest,
+    /// PPPoE uplink to an ISP
+    Pppoe,
+}
+
+impl VlanType {
+    /// All types in declaration order
+    pub const ALL: [VlanType; 6] = [
+        VlanType::Data,
+        VlanType::Voice,
+        VlanType::Storage,
+        VlanType::Management,
+        VlanType::Guest,
+        VlanType::Pppoe,
+    ];
+
+    /// Relative frequency of the type in a typical enterprise network
+    fn weight(self) -> u32 {
+        match self {
+            VlanType::Data => 50,
+            VlanType::Voice => 20,
+            VlanType::Storage => 10,
+            VlanType::Management => 10,
+            VlanType::Guest => 7,
+            VlanType::Pppoe => 3,
+        }
+    }
+
+    /// Type named by a keyword in the description, if any
+    ///
+    /// Lets descriptions from an input CSV such as "VoIP Floor 2" or
+    /// "iSCSI Storage" keep their obvious type instead of a random one.
+    pub fn from_description(description: &str) -> Option<Self> {
+        const KEYWORDS: &[(&str, VlanType)] = &[
+            ("voip", VlanType::Voice),
+            ("voice", VlanType::Voice),
+            ("phone", VlanType::Voice),
+            ("storage", VlanType::Storage),
+            ("iscsi", VlanType::Storage),
+            ("nfs", VlanType::Storage),
+            ("san", VlanType::Storage),
+            ("mgmt", VlanType::Management),
+            ("management", VlanType::Management),
+            ("oob", VlanType::Management),
+            ("guest", VlanType::Guest),
+            ("visitor", VlanType::Guest),
+            ("pppoe", VlanType::Pppoe),
+            ("dsl", VlanType::Pppoe),
+        ];
+        description
+            .split(|c: char| !c.is_ascii_alphanumeric())
+            .map(str::to_ascii_lowercase)
+            .find_map(|word| {
+                KEYWORDS
+                    .iter()
+                    .find(|(keyword, _)| *keyword == word)
+                    .map(|(_, vlan_type)| *vlan_type)
+            })
+    }
+
+    /// Link-layer settings for this type
+    pub fn profile(self) -> InterfaceProfile {
+        let (mtu, mss, pcp) = match self {
+            VlanType::Data => (ETHERNET_MTU, None, 0),
+            VlanType::Voice => (ETHERNET_MTU, None, 5),
+            VlanType::Storage => (JUMBO_MTU, None, 3),
+            VlanType::Management => (ETHERNET_MTU, None, 6),
+            VlanType::Guest => (ETHERNET_MTU, None, 1),
+            VlanType::Pppoe => (PPPOE_MTU, Some(PPPOE_MTU - TCP_IP_HEADER), 0),
+        };
+        InterfaceProfile {
+            vlan_type: self,
+            mtu,
+            mss,
+            pcp,
+        }
+    }
+}
+
+impl fmt::Display for VlanType {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        let name = match self {
+            VlanType::Data => "data",
+            VlanType::Voice => "voice",
+            VlanType::Storage => "storage",
+            VlanType::Management => "management",
+            VlanType::Guest => "guest",
+            VlanType::Pppoe => "pppoe",
+        };
+        f.write_str(name)
+    }
+}
+
+/// Link-layer settings for one VLAN interface
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct InterfaceProfile {
+    /// Type the settings were derived from
+    pub vlan_type: VlanType,
+    /// Interface MTU in bytes
+    pub mtu: u16,
+    /// TCP MSS clamp, when the path needs one
+    pub mss: Option<u16>,
+    /// 802.1p priority code point (0-7)
+    pub pcp: u8,
+}
+
+/// Interface profile assigned to a generated VLAN
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct VlanInterface {
+    /// VLAN the profile belongs to
+    pub vlan_id: u16,
+    /// Link-layer settings
+    pub profile: InterfaceProfile,
+}
+
+/// Assign a type and interface profile to each VLAN
+///
+/// Types named in the description win; the rest are drawn with typical
+/// enterprise frequencies from an RNG seeded with `seed`, so VLAN generation
+/// itself is unaffected.
+pub fn assign_interface_profiles(configs: &[VlanConfig], seed: Option<u64>) -> Vec<VlanInterface> {
+    let mut rng = RngStreams::new(seed).stream("interface-profiles");
+    let total: u32 = VlanType::ALL.iter().map(|t| t.weight()).sum();
+
+    configs
+        .iter()
+        .map(|config| {
+            // Always draw so a description match doesn't shift later VLANs
+            let mut roll = rng.random_range(0..total);
+            let drawn = VlanType::ALL
+                .into_iter()
+                .find(|t| {
+                    if roll < t.weight() {
+                        return true;
+                    }
+                    roll -= t.weight();
+                    false
+                })
+                .unwrap_or(VlanType::Data);
+            let vlan_type = VlanType::from_description(&config.description).unwrap_or(drawn);
+            VlanInterface {
+                vlan_id: config.vlan_id,
+                profile: vlan_type.profile(),
+            }
+        })
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_profiles_follow_type() {
+        assert_eq!(VlanType::Storage.profile().mtu, JUMBO_MTU);
+        assert_eq!(VlanType::Voice.profile().pcp, 5);
+        let pppoe = VlanType::Pppoe.profile();
+        assert_eq!(pppoe.mtu, PPPOE_MTU);
+        assert_eq!(pppoe.mss, Some(1452));
+        assert!(VlanType::ALL.iter().all(|t| t.profile().pcp <= 7));
+    }
+
+    #[test]
+    fn test_description_keywords() {
+        assert_eq!(
+            VlanType::from_description("VoIP Floor 2"),
+            Some(VlanType::Voice)
+        );
+        assert_eq!(
+            VlanType::from_description("iSCSI-A"),
+            Some(VlanType::Storage)
+        );
+        assert_eq!(VlanType::from_description("Sales VLAN 100"), None);
+        // Whole words only
+        assert_eq!(VlanType::from_description("Sandbox"), None);
+    }
+
+    #[test]
+    fn test_assignment_is_seeded_and_varied() {
+        let configs: Vec<VlanConfig> = (0..200)
+            .map(|i| {
+                VlanConfig::new(
+                    100 + i,
+                    format!("10.1.{i}.x"),
+                    format!("IT VLAN {}", 100 + i),
+                    1,
+                )
+                .unwrap()
+            })
+            .collect();
+        let first = assign_interface_profiles(&configs, Some(7));
+        assert_eq!(first, assign_interface_profiles(&configs, Some(7)));
+        assert_eq!(first.len(), configs.len());
+        for vlan_type in [VlanType::Data, VlanType::Voice, VlanType::Storage] {
+            assert!(first.iter().any(|v| v.profile.vlan_type == vlan_type));
+        }
+    }
+}
@@ -0,0 +1,292 @@
+//! Labels attached to generated objects
+//!
+//! Large generated datasets are easier to slice when every object says where
+//! it belongs. [`assign_labels`] tags each VLAN with a `site`, a network
+//! `tier`, and the synthetic `batch` ID of the run; firewall rules, hosts, and
+//! interfaces inherit the labels of their VLAN. A [`LabelSelector`] such as
+//! `site=hq,tier!=core` then picks out a subset to emit or apply.
+
+use crate::Result;
+use crate::generator::{RngStreams, VlanConfig};
+use crate::model::ConfigError;
+use rand::prelude::*;
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+use std::fmt;
+use std::str::FromStr;
+
+/// VLANs per site when splitting a run into sites
+const VLANS_PER_SITE: usize = 25;
+
+/// Most sites a run is split into
+const MAX_SITES: usize = 12;
+
+/// Network tiers with their relative frequency
+const TIERS: &[(&str, u32)] = &[("access", 60), ("distribution", 25), ("core", 15)];
+
+/// Key/value labels of one object, ordered by key
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(transparent)]
+pub struct Labels(BTreeMap<String, String>);
+
+impl Labels {
+    /// Create an empty label set
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Set a label, replacing any previous value
+    pub fn insert<K: Into<String>, V: Into<String>>(&mut self, key: K, value: V) {
+        self.0.insert(key.into(), value.into());
+    }
+
+    /// Value of a label
+    pub fn get(&self, key: &str) -> Option<&str> {
+        self.0.get(key).map(String::as_str)
+    }
+
+    /// Whether no labels are set
+    pub fn is_empty(&self) -> bool {
+        self.0.is_empty()
+    }
+
+    /// Append the labels to a description, e.g. `"Sales VLAN 100 [batch=... site=hq tier=core]"`
+    pub fn annotate(&self, description: &str) -> String {
+        if self.is_empty() {
+            return description.to_string();
+        }
+        let labels: Vec<String> = self.0.iter().map(|(k, v)| format!("{k}={v}")).collect();
+        format!("{description} [{}]", labels.join(" "))
+    }
+}
+
+impl fmt::Display for Labels {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        for (index, (key, value)) in self.0.iter().enumerate() {
+            if index > 0 {
+                f.write_str(",")?;
+            }
+            write!(f, "{key}={value}")?;
+        }
+        Ok(())
+    }
+}
+
+/// Labels of every VLAN in a run
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub struct LabelSet {
+    /// Synthetic batch ID shared by every object of the run
+    pub batch: String,
+    /// Labels by VLAN ID
+    pub vlans: BTreeMap<u16, Labels>,
+}
+
+impl LabelSet {
+    /// Labels of a VLAN, if it was labeled
+    pub fn get(&self, vlan_id: u16) -> Option<&Labels> {
+        self.vlans.get(&vlan_id)
+    }
+
+    /// Whether the VLAN's labels satisfy the selector
+    ///
+    /// Unlabeled VLANs, and objects without a VLAN, match only selectors made
+    /// entirely of `!=` terms.
+    pub fn selects(&self, vlan_id: Option<u16>, selector: &LabelSelector) -> bool {
+        let empty = Labels::new();
+        let labels = vlan_id.and_then(|id| self.get(id)).unwrap_or(&empty);
+        selector.matches(labels)
+    }
+}
+
+/// Assign site, tier, and batch labels to each VLAN
+///
+/// Sites own contiguous blocks of VLANs in generation order, the first being
+/// `hq` and the rest `branch-NN`. Tiers and the batch ID are drawn from an RNG
+/// seeded with `seed`, so VLAN generation itself is unaffected.
+pub fn assign_labels(configs: &[VlanConfig], seed: Option<u64>) -> LabelSet {
+    let mut rng = RngStreams::new(seed).stream("vlan-labels");
+    let batch = format!("batch-{:08x}", rng.random::<u32>());
+    let sites = configs.len().div_ceil(VLANS_PER_SITE).clamp(1, MAX_SITES);
+    let total: u32 = TIERS.iter().map(|(_, weight)| weight).sum();
+
+    let vlans = configs
+        .iter()
+        .enumerate()
+        .map(|(index, config)| {
+            let site = index * sites / configs.len();
+            let mut roll = rng.random_range(0..total);
+            let tier = TIERS
+                .iter()
+                .find(|(_, weight)| {
+                    if roll < *weight {
+                        return true;
+                    }
+                    roll -= weight;
+                    false
+                })
+                .map_or("access", |(tier, _)| *tier);
+
+            let mut labels = Labels::new();
+            labels.insert(
+                "site",
+                match site {
+                    0 => "hq".to_string(),
+                    n => format!("branch-{n:02}"),
+                },
+            );
+            labels.insert("tier", tier);
+            labels.insert("batch", batch.clone());
+            (config.vlan_id, labels)
+        })
+        .collect();
+
+    LabelSet { batch, vlans }
+}
+
+/// Comparison in a selector term
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum SelectorOp {
+    Eq,
+    Ne,
+}
+
+/// Conjunction of `key=value` and `key!=value` terms
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct LabelSelector {
+    terms: Vec<(String, SelectorOp, String)>,
+}
+
+impl LabelSelector {
+    /// Combine two selectors; both must match
+    pub fn and(mut self, other: LabelSelector) -> Self {
+        self.terms.extend(other.terms);
+        self
+    }
+
+    /// Whether the labels satisfy every term
+    pub fn matches(&self, labels: &Labels) -> bool {
+        self.terms.iter().all(|(key, op, value)| {
+            let equal = labels.get(key) == Some(value.as_str());
+            match op {
+                SelectorOp::Eq => equal,
+                SelectorOp::Ne => !equal,
+            }
+        })
+    }
+}
+
+impl FromStr for LabelSelector {
+    type Err = ConfigError;
+
+    /// Parse comma-separated `key=value` and `key!=value` terms
+    fn from_str(spec: &str) -> Result<Self> {
+        let terms = spec
+            .split(',')
+            .map(str::trim)
+            .filter(|term| !term.is_empty())
+            .map(|term| {
+                let (key, op, value) = match term.split_once("!=") {
+                    Some((key, value)) => (key, SelectorOp::Ne, value),
+                    None => match term.split_once('=') {
+                        Some((key, value)) => (key, SelectorOp::Eq, value),
+                        None => {
+                            return Err(ConfigError::invalid_parameter(
+                                "filter",
+                                format!("'{term}' is not a key=value or key!=value term"),
+                            ));
+                        }
+                    },
+                };
+                let (key, value) = (key.trim(), value.trim());
+                if key.is_empty() || value.is_empty() {
+                    return Err(ConfigError::invalid_parameter(
+                        "filter",
+                        format!("'{term}' needs both a label key and a value"),
+                    ));
+                }
+                Ok((key.to_string(), op, value.to_string()))
+            })
+            .collect::<Result<Vec<_>>>()?;
+
+        if terms.is_empty() {
+            return Err(ConfigError::invalid_parameter(
+                "filter",
+                "selector has no terms",
+            ));
+        }
+        Ok(Self { terms })
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn configs(count: u16) -> Vec<VlanConfig> {
+        (0..count)
+            .map(|i| {
+                VlanConfig::new(
+                    100 + i,
+                    format!("10.1.{i}.x"),
+                    format!("IT VLAN {}", 100 + i),
+                    1,
+                )
+                .unwrap()
+            })
+            .collect()
+    }
+
+    #[test]
+    fn test_assign_labels_splits_sites_and_shares_batch() {
+        let configs = configs(60);
+        let labels = assign_labels(&configs, Some(42));
+        assert_eq!(labels, assign_labels(&configs, Some(42)));
+        assert_eq!(labels.vlans.len(), 60);
+
+        let first = labels.get(100).unwrap();
+        let last = labels.get(159).unwrap();
+        assert_eq!(first.get("site"), Some("hq"));
+        assert_eq!(last.get("site"), Some("branch-02"));
+        assert!(
+            labels
+                .vlans
+                .values()
+                .all(|l| l.get("batch") == Some(labels.batch.as_str()))
+        );
+    }
+
+    #[test]
+    fn test_selector_matching() {
+        let mut labels = Labels::new();
+        labels.insert("site", "hq");
+        labels.insert("tier", "core");
+
+        let selector: LabelSelector = "site=hq".parse().unwrap();
+        assert!(selector.matches(&labels));
+        let selector = selector.and("tier!=core".parse().unwrap());
+        assert!(!selector.matches(&labels));
+        assert!(
+            "tier!=access"
+                .parse::<LabelSelector>()
+                .unwrap()
+                .matches(&Labels::new())
+        );
+
+        assert!("site".parse::<LabelSelector>().is_err());
+        assert!("=hq".parse::<LabelSelector>().is_err());
+        assert!("".parse::<LabelSelector>().is_err());
+    }
+
+    #[test]
+    fn test_annotate_and_display() {
+        let mut labels = Labels::new();
+        labels.insert("tier", "core");
+        labels.insert("site", "hq");
+        assert_eq!(labels.to_string(), "site=hq,tier=core");
+        assert_eq!(
+            labels.annotate("Sales VLAN 100"),
+            "Sales VLAN 100 [site=hq tier=core]"
+        );
+        assert_eq!(Labels::new().annotate("Sales VLAN 100"), "Sales VLAN 100");
+    }
+}
@@ -0,0 +1,482 @@
+//! Link aggregation (LAGG) and bridge spanning-tree parameters
+//!
+//! Switch-integration documentation expects LACP and STP fields on every LAGG
+//! and bridge. [`LaggParameters`] and [`BridgeStpParameters`] hold those
+//! fields, draw plausible values, and validate them against the constraints
+//! FreeBSD and IEEE 802.1D place on them. [`LinkLayer::plan`] builds LAGG
+//! and bridge interfaces carrying them, and [`render_laggs`] and
+//! [`render_bridges`] emit their `config.xml` entries.
+
+use crate::Result;
+use crate::generator::RngStreams;
+use crate::model::ConfigError;
+use rand::prelude::*;
+use serde::{Deserialize, Serialize};
+use std::fmt;
+use std::ops::RangeInclusive;
+
+/// Most LAGG or bridge interfaces one run adds
+pub const MAX_LINK_INTERFACES: u8 = 16;
+
+/// Driver name of the physical ports LAGGs and bridges are built from
+const PORT_DRIVER: &str = "igb";
+
+/// LACPDU transmission rate
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum LacpRate {
+    /// One LACPDU every 30 seconds
+    Slow,
+    /// One LACPDU every second
+    Fast,
+}
+
+impl fmt::Display for LacpRate {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(match self {
+            LacpRate::Slow => "slow",
+            LacpRate::Fast => "fast",
+        })
+    }
+}
+
+/// Header layers hashed to pick the egress port
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash, Serialize, Deserialize)]
+pub enum HashPolicy {
+    /// Source and destination MAC
+    #[serde(rename = "l2")]
+    L2,
+    /// Source and destination IP
+    #[serde(rename = "l3")]
+    L3,
+    /// Source and destination ports
+    #[serde(rename = "l4")]
+    L4,
+    /// MAC and IP
+    #[serde(rename = "l2,l3")]
+    L2L3,
+    /// IP and ports, the usual choice for routed traffic
+    #[serde(rename = "l3,l4")]
+    L3L4,
+    /// MAC, IP, and ports (FreeBSD default)
+    #[serde(rename = "l2,l3,l4")]
+    L2L3L4,
+}
+
+impl HashPolicy {
+    /// Policies with their relative frequency in production configurations
+    const WEIGHTED: [(HashPolicy, u32); 6] = [
+        (HashPolicy::L2L3L4, 40),
+        (HashPolicy::L3L4, 30),
+        (HashPolicy::L2L3, 15),
+        (HashPolicy::L2, 10),
+        (HashPolicy::L3, 3),
+        (HashPolicy::L4, 2),
+    ];
+}
+
+impl fmt::Display for HashPolicy {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(match self {
+            HashPolicy::L2 => "l2",
+            HashPolicy::L3 => "l3",
+            HashPolicy::L4 => "l4",
+            HashPolicy::L2L3 => "l2,l3",
+            HashPolicy::L3L4 => "l3,l4",
+            HashPolicy::L2L3L4 => "l2,l3,l4",
+        })
+    }
+}
+
+/// LACP settings of a LAGG interface
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct LaggParameters {
+    /// LACPDU rate
+    pub lacp_rate: LacpRate,
+    /// Egress hash policy
+    pub hash_policy: HashPolicy,
+    /// Use strict mode, bringing the LAGG down until all ports agree
+    pub lacp_strict: bool,
+    /// Number of member ports
+    pub member_count: u8,
+}
+
+/// Member ports per LAGG
+const LAGG_MEMBERS: RangeInclusive<u8> = 2..=8;
+
+impl LaggParameters {
+    /// Draw plausible LACP settings
+    pub fn random<R: Rng + ?Sized>(rng: &mut R) -> Self {
+        let total: u32 = HashPolicy::WEIGHTED.iter().map(|(_, w)| w).sum();
+        let mut roll = rng.random_range(0..total);
+        let mut hash_policy = HashPolicy::L2L3L4;
+        for (policy, weight) in HashPolicy::WEIGHTED {
+            if roll < weight {
+                hash_policy = policy;
+                break;
+            }
+            roll -= weight;
+        }
+
+        Self {
+            lacp_rate: if rng.random_bool(0.7) {
+                LacpRate::Fast
+            } else {
+                LacpRate::Slow
+            },
+            hash_policy,
+            lacp_strict: rng.random_bool(0.2),
+            // Pairs and quads dominate; larger bundles are rare
+            member_count: *[2, 2, 2, 4, 4, 8].choose(rng).unwrap_or(&2),
+        }
+    }
+
+    /// Validate the settings
+    pub fn validate(&self) -> Result<()> {
+        if !LAGG_MEMBERS.contains(&self.member_count) {
+            return Err(ConfigError::invalid_parameter(
+                "member_count",
+                format!(
+                    "LAGG needs {}-{} member ports, got {}",
+                    LAGG_MEMBERS.start(),
+                    LAGG_MEMBERS.end(),
+                    self.member_count
+                ),
+            ));
+        }
+        Ok(())
+    }
+}
+
+/// Spanning-tree protocol of a bridge
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum StpProtocol {
+    /// IEEE 802.1D spanning tree
+    Stp,
+    /// IEEE 802.1w rapid spanning tree
+    Rstp,
+}
+
+impl fmt::Display for StpProtocol {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(match self {
+            StpProtocol::Stp => "stp",
+            StpProtocol::Rstp => "rstp",
+        })
+    }
+}
+
+/// Spanning-tree settings of a bridge interface
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct BridgeStpParameters {
+    /// Protocol
+    pub protocol: StpProtocol,
+    /// Bridge priority, a multiple of 4096 from 0 to 61440
+    pub priority: u16,
+    /// Hello time in seconds (1-2)
+    pub hello_time: u8,
+    /// Forward delay in seconds (4-30)
+    pub forward_delay: u8,
+    /// Max age in seconds (6-40)
+    pub max_age: u8,
+    /// Transmit hold count (1-10)
+    pub hold_count: u8,
+}
+
+impl Default for BridgeStpParameters {
+    /// IEEE 802.1D defaults
+    fn default() -> Self {
+        Self {
+            protocol: StpProtocol::Rstp,
+            priority: 32768,
+            hello_time: 2,
+            forward_delay: 15,
+            max_age: 20,
+            hold_count: 6,
+        }
+    }
+}
+
+impl BridgeStpParameters {
+    /// Draw plausible spanning-tree settings
+    ///
+    /// Most bridges keep the defaults; some are tuned with a lower priority
+    /// (to win root election) and shorter timers. Timers always satisfy
+    /// `2 * (forward_delay - 1) >= max_age >= 2 * (hello_time + 1)`.
+    pub fn random<R: Rng + ?Sized>(rng: &mut R) -> Self {
+        let defaults = Self::default();
+        let protocol = if rng.random_bool(0.85) {
+            StpProtocol::Rstp
+        } else {
+            StpProtocol::Stp
+        };
+        if rng.random_bool(0.6) {
+            return Self {
+                protocol,
+                ..defaults
+            };
+        }
+
+        let hello_time: u8 = rng.random_range(1..=2);
+        let max_age = rng.random_range(2 * (hello_time + 1)..=20).max(6);
+        let forward_delay = rng.random_range(max_age.div_ceil(2) + 1..=30).max(4);
+        Self {
+            protocol,
+            priority: 4096 * rng.random_range(0..=15),
+            hello_time,
+            forward_delay,
+            max_age,
+            hold_count: rng.random_range(1..=10),
+        }
+    }
+
+    /// Validate the settings against IEEE 802.1D limits
+    pub fn validate(&self) -> Result<()> {
+        let check = |field: &str, value: u8, range: RangeInclusive<u8>| {
+            if range.contains(&value) {
+                Ok(())
+            } else {
+                Err(ConfigError::invalid_parameter(
+                    field,
+                    format!(
+                        "must be between {} and {}, got {value}",
+                        range.start(),
+                        range.end()
+                    ),
+                ))
+            }
+        };
+        check("hello_time", self.hello_time, 1..=2)?;
+        check("forward_delay", self.forward_delay, 4..=30)?;
+        check("max_age", self.max_age, 6..=40)?;
+        check("hold_count", self.hold_count, 1..=10)?;
+
+        if self.priority % 4096 != 0 || self.priority > 61440 {
+            return Err(ConfigError::invalid_parameter(
+                "priority",
+                format!(
+                    "must be a multiple of 4096 up to 61440, got {}",
+                    self.priority
+                ),
+            ));
+        }
+        if u16::from(self.max_age) > 2 * (u16::from(self.forward_delay) - 1)
+            || self.max_age < 2 * (self.hello_time + 1)
+        {
+            return Err(ConfigError::invalid_parameter(
+                "max_age",
+                format!(
+                    "{} violates 2 * (forward_delay - 1) >= max_age >= 2 * (hello_time + 1)",
+                    self.max_age
+                ),
+            ));
+        }
+        Ok(())
+    }
+}
+
+/// A LAGG interface bundling physical ports with LACP
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Lagg {
+    /// Device name, e.g. `lagg0`
+    pub device: String,
+    /// Member ports
+    pub members: Vec<String>,
+    /// LACP settings
+    pub parameters: LaggParameters,
+}
+
+/// A bridge with spanning tree enabled on every member
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Bridge {
+    /// Device name, e.g. `bridge0`
+    pub device: String,
+    /// Member ports
+    pub members: Vec<String>,
+    /// Spanning-tree settings
+    pub stp: BridgeStpParameters,
+}
+
+/// LAGG and bridge interfaces of one configuration
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub struct LinkLayer {
+    /// LAGG interfaces
+    pub laggs: Vec<Lagg>,
+    /// Bridge interfaces
+    pub bridges: Vec<Bridge>,
+}
+
+impl LinkLayer {
+    /// Plan `laggs` LAGGs and `bridges` two-port bridges on dedicated ports
+    ///
+    /// Ports are numbered in order (`igb0`, `igb1`, ...), LAGG members first,
+    /// so no port belongs to two interfaces.
+    pub fn plan(laggs: u8, bridges: u8, seed: Option<u64>) -> Result<Self> {
+        for (field, count) in [("laggs", laggs), ("bridges", bridges)] {
+            if count > MAX_LINK_INTERFACES {
+                return Err(ConfigError::invalid_parameter(
+                    field,
+                    format!("at most {MAX_LINK_INTERFACES} interfaces are supported, got {count}"),
+                ));
+            }
+        }
+
+        let streams = RngStreams::new(seed);
+        let mut next_port = 0u16;
+        let mut take_ports = |count: u8| -> Vec<String> {
+            (0..count)
+                .map(|_| {
+                    next_port += 1;
+                    format!("{PORT_DRIVER}{}", next_port - 1)
+                })
+                .collect()
+        };
+
+        let laggs = (0..laggs)
+            .map(|index| {
+                let parameters =
+                    LaggParameters::random(&mut streams.stream_for("laggs", u64::from(index)));
+                Lagg {
+                    device: format!("lagg{index}"),
+                    members: take_ports(parameters.member_count),
+                    parameters,
+                }
+            })
+            .collect();
+        let bridges = (0..bridges)
+            .map(|index| Bridge {
+                device: format!("bridge{index}"),
+                members: take_ports(2),
+                stp: BridgeStpParameters::random(
+                    &mut streams.stream_for("bridges", u64::from(index)),
+                ),
+            })
+            .collect();
+        Ok(Self { laggs, bridges })
+    }
+}
+
+/// `<lagg>` entries for the `<laggs>` section of `config.xml`
+pub fn render_laggs(laggs: &[Lagg]) -> String {
+    let mut out = String::new();
+    for (index, lagg) in laggs.iter().enumerate() {
+        let params = &lagg.parameters;
+        out.push_str(&format!(
+            "    <lagg>\n      <members>{}</members>\n      <laggif>{}</laggif>\n      \
+             <proto>lacp</proto>\n      <descr>LACP uplink {}</descr>\n      \
+             <lacp_fast_timeout>{}</lacp_fast_timeout>\n      <lagghash>{}</lagghash>\n      \
+             <lacp_strict>{}</lacp_strict>\n    </lagg>\n",
+            lagg.members.join(","),
+            lagg.device,
+            index + 1,
+            u8::from(params.lacp_rate == LacpRate::Fast),
+            params.hash_policy,
+            u8::from(params.lacp_strict)
+        ));
+    }
+    out
+}
+
+/// `<bridged>` entries for the `<bridges>` section of `config.xml`
+pub fn render_bridges(bridges: &[Bridge]) -> String {
+    let mut out = String::new();
+    for (index, bridge) in bridges.iter().enumerate() {
+        let members = bridge.members.join(",");
+        let stp = &bridge.stp;
+        out.push_str(&format!(
+            "    <bridged>\n      <members>{members}</members>\n      \
+             <descr>Bridge {}</descr>\n      <bridgeif>{}</bridgeif>\n      \
+             <proto>{}</proto>\n      <stp>{members}</stp>\n      <priority>{}</priority>\n      \
+             <hellotime>{}</hellotime>\n      <fwdelay>{}</fwdelay>\n      \
+             <maxage>{}</maxage>\n      <holdcnt>{}</holdcnt>\n    </bridged>\n",
+            index + 1,
+            bridge.device,
+            stp.protocol,
+            stp.priority,
+            stp.hello_time,
+            stp.forward_delay,
+            stp.max_age,
+            stp.hold_count
+        ));
+    }
+    out
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use rand_chacha::ChaCha8Rng;
+
+    #[test]
+    fn test_random_parameters_are_valid() {
+        let mut rng = ChaCha8Rng::seed_from_u64(42);
+        for _ in 0..500 {
+            LaggParameters::random(&mut rng).validate().unwrap();
+            BridgeStpParameters::random(&mut rng).validate().unwrap();
+        }
+        BridgeStpParameters::default().validate().unwrap();
+    }
+
+    #[test]
+    fn test_invalid_stp_timers_rejected() {
+        let params = BridgeStpParameters {
+            max_age: 40,
+            forward_delay: 15,
+            ..BridgeStpParameters::default()
+        };
+        assert!(params.validate().is_err());
+
+        let params = BridgeStpParameters {
+            priority: 1000,
+            ..BridgeStpParameters::default()
+        };
+        assert!(params.validate().is_err());
+    }
+
+    #[test]
+    fn test_hash_policy_names() {
+        assert_eq!(HashPolicy::L2L3L4.to_string(), "l2,l3,l4");
+        assert_eq!(
+            serde_json::to_string(&HashPolicy::L3L4).unwrap(),
+            "\"l3,l4\""
+        );
+    }
+
+    #[test]
+    fn test_plan_uses_distinct_ports() {
+        let links = LinkLayer::plan(3, 2, Some(42)).unwrap();
+        assert_eq!(links.laggs.len(), 3);
+        assert_eq!(links.bridges.len(), 2);
+
+        let mut ports: Vec<&String> = links
+            .laggs
+            .iter()
+            .flat_map(|lagg| &lagg.members)
+            .chain(links.bridges.iter().flat_map(|bridge| &bridge.members))
+            .collect();
+        let total = ports.len();
+        ports.sort();
+        ports.dedup();
+        assert_eq!(ports.len(), total);
+        assert_eq!(links, LinkLayer::plan(3, 2, Some(42)).unwrap());
+        assert!(LinkLayer::plan(MAX_LINK_INTERFACES + 1, 0, None).is_err());
+    }
+
+    #[test]
+    fn test_render_entries() {
+        let links = LinkLayer::plan(1, 1, Some(7)).unwrap();
+        let laggs = render_laggs(&links.laggs);
+        assert!(laggs.starts_with("    <lagg>\n"));
+        assert!(laggs.contains("<laggif>lagg0</laggif>"));
+        assert!(laggs.contains(&format!(
+            "<lagghash>{}</lagghash>",
+            links.laggs[0].parameters.hash_policy
+        )));
+
+        let bridges = render_bridges(&links.bridges);
+        let stp = links.bridges[0].stp;
+        assert!(bridges.contains(&format!("<proto>{}</proto>", stp.protocol)));
+        assert!(bridges.contains(&format!("<maxage>{}</maxage>", stp.max_age)));
+    }
+}
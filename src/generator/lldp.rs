@@ -0,0 +1,420 @@
+//! Switch port inventory in LLDP neighbor style
+//!
+//! Documentation and topology tools join the firewall configuration with the
+//! switch inventory, usually through what LLDP reports on each port.
+//! [`build_lldp_inventory`] invents the switching the generated VLANs would
+//! run on: the firewall's VLAN parent is trunked to a core switch, and every
+//! department gets access switches uplinked to the core, one for every few of
+//! its VLANs. [`PortMapping`] ties each VLAN interface to those switches and
+//! ports, and [`render_lldp_neighbors`] gives every device's neighbor table in
+//! the JSON layout of `lldpctl -f json`.
+//!
+//! Switches come from a few vendors with their own port naming, and ports
+//! past one switch's 48 continue on the next stack member. Management
+//! addresses come from 100.64.0.0/16, clear of the generated VLAN networks.
+
+use crate::Result;
+use crate::generator::{RngStreams, VlanConfig};
+use crate::model::ConfigError;
+use rand::prelude::*;
+use serde::{Deserialize, Serialize};
+use serde_json::{Value, json};
+use std::collections::BTreeMap;
+
+/// VLANs sharing one access switch
+const VLANS_PER_SWITCH: usize = 4;
+
+/// Ports of one switch or stack member
+const PORTS_PER_MEMBER: u16 = 48;
+
+/// LLDP time-to-live in seconds
+const LLDP_TTL: u16 = 120;
+
+/// Switch vendor, which determines descriptions and port names
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum SwitchVendor {
+    /// Cisco Catalyst, IOS XE
+    Cisco,
+    /// Juniper EX, Junos
+    Juniper,
+    /// HPE Aruba CX
+    Aruba,
+}
+
+impl SwitchVendor {
+    /// Every vendor
+    pub const ALL: [SwitchVendor; 3] = [
+        SwitchVendor::Cisco,
+        SwitchVendor::Juniper,
+        SwitchVendor::Aruba,
+    ];
+
+    /// LLDP system description
+    pub fn description(self) -> &'static str {
+        match self {
+            SwitchVendor::Cisco => {
+                "Cisco IOS Software [Dublin], Catalyst L3 Switch Software (CAT9K_IOSXE), \
+                 Version 17.12.2"
+            }
+            SwitchVendor::Juniper => {
+                "Juniper Networks, Inc. ex4300-48p Ethernet Switch, JUNOS 21.4R3"
+            }
+            SwitchVendor::Aruba => "Aruba JL659A 6300M 48SR5 CL6 PoE 4SFP56 Swch, FL.10.13.1000",
+        }
+    }
+
+    /// Name of 10G port `n`, counted from 1 across stack members
+    pub fn fiber_port(self, n: u16) -> String {
+        let (member, index) = (
+            (n - 1) / PORTS_PER_MEMBER + 1,
+            (n - 1) % PORTS_PER_MEMBER + 1,
+        );
+        match self {
+            SwitchVendor::Cisco => format!("Te{member}/0/{index}"),
+            SwitchVendor::Juniper => format!("xe-{}/0/{}", member - 1, index - 1),
+            SwitchVendor::Aruba => format!("{member}/1/{index}"),
+        }
+    }
+
+    /// Name of an access switch's uplink port
+    pub fn uplink_port(self) -> &'static str {
+        match self {
+            SwitchVendor::Cisco => "Te1/1/1",
+            SwitchVendor::Juniper => "xe-0/2/0",
+            SwitchVendor::Aruba => "1/1/49",
+        }
+    }
+
+    /// Range of an access switch's copper ports `first` to `last`, counted from 1
+    pub fn access_ports(self, first: u16, last: u16) -> String {
+        match self {
+            SwitchVendor::Cisco => format!("Gi1/0/{first}-{last}"),
+            SwitchVendor::Juniper => format!("ge-0/0/{}-{}", first - 1, last - 1),
+            SwitchVendor::Aruba => format!("1/1/{first}-1/1/{last}"),
+        }
+    }
+}
+
+/// A generated switch
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Switch {
+    /// LLDP system name
+    pub name: String,
+    /// Vendor
+    pub vendor: SwitchVendor,
+    /// LLDP chassis ID, a MAC address
+    pub chassis_id: String,
+    /// Management address
+    pub mgmt_ip: String,
+}
+
+/// An access switch and where it connects to the core
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct AccessSwitch {
+    /// The switch
+    pub switch: Switch,
+    /// Core port the uplink lands on
+    pub core_port: String,
+    /// VLANs the switch carries
+    pub vlans: Vec<u16>,
+}
+
+/// Switch ports serving one VLAN interface, one CSV row
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct PortMapping {
+    /// VLAN tag
+    pub vlan_id: u16,
+    /// Firewall interface, e.g. `opt6`
+    pub interface: String,
+    /// VLAN device, e.g. `mismatch0_vlan100`
+    pub device: String,
+    /// Firewall port the VLAN is trunked on
+    pub local_port: String,
+    /// Core switch seen on the local port
+    pub neighbor: String,
+    /// Chassis ID of the core switch
+    pub neighbor_chassis_id: String,
+    /// Core port facing the firewall
+    pub neighbor_port: String,
+    /// Management address of the core switch
+    pub neighbor_mgmt_ip: String,
+    /// Access switch the VLAN's hosts attach to
+    pub access_switch: String,
+    /// Chassis ID of the access switch
+    pub access_chassis_id: String,
+    /// Management address of the access switch
+    pub access_mgmt_ip: String,
+    /// Core port facing the access switch
+    pub core_port: String,
+    /// Access switch port facing the core
+    pub uplink_port: String,
+    /// Access switch ports the VLAN is untagged on, a share of the switch
+    pub access_ports: String,
+}
+
+/// Switches behind the firewall and the port of every VLAN
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct LldpInventory {
+    /// Firewall system name
+    pub firewall: String,
+    /// Firewall port trunked to the core
+    pub local_port: String,
+    /// Core switch
+    pub core: Switch,
+    /// Core port facing the firewall
+    pub core_port: String,
+    /// Access switches, in core port order
+    pub access: Vec<AccessSwitch>,
+    /// One mapping per VLAN, in VLAN order
+    pub mappings: Vec<PortMapping>,
+}
+
+/// Build the switching behind `vlans`, which hang off `parent`
+///
+/// VLAN interfaces are numbered from `opt{opt_counter}` in the given order,
+/// as the generated configurations number them.
+pub fn build_lldp_inventory(
+    vlans: &[VlanConfig],
+    firewall: &str,
+    parent: &str,
+    opt_counter: u16,
+    seed: Option<u64>,
+) -> Result<LldpInventory> {
+    if vlans.is_empty() {
+        return Err(ConfigError::validation(
+            "A switch inventory needs at least one VLAN",
+        ));
+    }
+    let mut rng = RngStreams::new(seed).stream("lldp-inventory");
+    let core = switch("core-sw-01".to_string(), 0, &mut rng);
+
+    let mut departments: BTreeMap<String, Vec<u16>> = BTreeMap::new();
+    for vlan in vlans {
+        let department = vlan.description.split(' ').next().unwrap_or("unknown");
+        departments
+            .entry(department.to_lowercase())
+            .or_default()
+            .push(vlan.vlan_id);
+    }
+    let mut access = Vec::new();
+    for (department, ids) in &departments {
+        for (number, chunk) in ids.chunks(VLANS_PER_SWITCH).enumerate() {
+            let index = access.len() as u16 + 1;
+            access.push(AccessSwitch {
+                switch: switch(
+                    format!("{department}-sw-{:02}", number + 1),
+                    index,
+                    &mut rng,
+                ),
+                // Port 1 faces the firewall
+                core_port: core.vendor.fiber_port(index + 1),
+                vlans: chunk.to_vec(),
+            });
+        }
+    }
+
+    let mut mappings = Vec::with_capacity(vlans.len());
+    for (index, vlan) in vlans.iter().enumerate() {
+        let Some(access_switch) = access.iter().find(|a| a.vlans.contains(&vlan.vlan_id)) else {
+            continue;
+        };
+        let vendor = access_switch.switch.vendor;
+        let share = PORTS_PER_MEMBER / access_switch.vlans.len() as u16;
+        let position = access_switch
+            .vlans
+            .iter()
+            .position(|&id| id == vlan.vlan_id);
+        let first = position.unwrap_or(0) as u16 * share + 1;
+        mappings.push(PortMapping {
+            vlan_id: vlan.vlan_id,
+            interface: format!("opt{}", usize::from(opt_counter) + index),
+            device: format!("{parent}_vlan{}", vlan.vlan_id),
+            local_port: parent.to_string(),
+            neighbor: core.name.clone(),
+            neighbor_chassis_id: core.chassis_id.clone(),
+            neighbor_port: core.vendor.fiber_port(1),
+            neighbor_mgmt_ip: core.mgmt_ip.clone(),
+            access_switch: access_switch.switch.name.clone(),
+            access_chassis_id: access_switch.switch.chassis_id.clone(),
+            access_mgmt_ip: access_switch.switch.mgmt_ip.clone(),
+            core_port: access_switch.core_port.clone(),
+            uplink_port: vendor.uplink_port().to_string(),
+            access_ports: vendor.access_ports(first, first + share - 1),
+        });
+    }
+
+    Ok(LldpInventory {
+        firewall: firewall.to_string(),
+        local_port: parent.to_string(),
+        core_port: core.vendor.fiber_port(1),
+        core,
+        access,
+        mappings,
+    })
+}
+
+/// Draw a switch's vendor; `index` numbers its chassis ID and address
+fn switch<R: Rng + ?Sized>(name: String, index: u16, rng: &mut R) -> Switch {
+    Switch {
+        name,
+        vendor: SwitchVendor::ALL
+            .choose(rng)
+            .copied()
+            .unwrap_or(SwitchVendor::Cisco),
+        chassis_id: format!("02:4c:{:02x}:{:02x}:00:01", index >> 8, index & 0xff),
+        mgmt_ip: format!("100.64.{}.{}", (index + 1) >> 8, (index + 1) & 0xff),
+    }
+}
+
+/// Neighbor tables of the firewall and every switch, keyed by system name
+///
+/// Each table has the layout of `lldpctl -f json`; the firewall's lists the
+/// VLANs tagged on its trunk.
+pub fn render_lldp_neighbors(inventory: &LldpInventory) -> Value {
+    let core = &inventory.core;
+    let firewall_vlans: Vec<Value> = inventory
+        .mappings
+        .iter()
+        .map(|m| json!({"vlan-id": m.vlan_id.to_string(), "pvid": false, "value": m.device}))
+        .collect();
+
+    let mut core_ports = BTreeMap::new();
+    core_ports.insert(
+        inventory.core_port.clone(),
+        json!({
+            "via": "LLDP",
+            "chassis": {inventory.firewall.clone(): {
+                "id": {"type": "mac", "value": "02:4c:ff:ff:00:01"},
+                "descr": "OPNsense",
+                "capability": [{"type": "Router", "enabled": true}],
+            }},
+            "port": {
+                "id": {"type": "ifname", "value": inventory.local_port},
+                "descr": inventory.local_port,
+                "ttl": LLDP_TTL.to_string(),
+            },
+        }),
+    );
+    let mut tables = BTreeMap::new();
+    for access in &inventory.access {
+        let uplink = access.switch.vendor.uplink_port();
+        let seen = neighbor(&access.switch, uplink, &access.vlans);
+        core_ports.insert(access.core_port.clone(), seen);
+        let mut ports = BTreeMap::new();
+        ports.insert(
+            uplink.to_string(),
+            neighbor(core, &access.core_port, &access.vlans),
+        );
+        tables.insert(
+            access.switch.name.clone(),
+            json!({"lldp": {"interface": ports}}),
+        );
+    }
+
+    let mut firewall_ports = BTreeMap::new();
+    let mut trunk = neighbor(core, &inventory.core_port, &[]);
+    trunk["vlan"] = Value::Array(firewall_vlans);
+    firewall_ports.insert(inventory.local_port.clone(), trunk);
+    tables.insert(
+        inventory.firewall.clone(),
+        json!({"lldp": {"interface": firewall_ports}}),
+    );
+    tables.insert(
+        core.name.clone(),
+        json!({"lldp": {"interface": core_ports}}),
+    );
+    json!(tables)
+}
+
+/// Neighbor entry for `switch` seen on its `port`, tagging `vlans`
+fn neighbor(switch: &Switch, port: &str, vlans: &[u16]) -> Value {
+    let vlans: Vec<Value> = vlans
+        .iter()
+        .map(|id| json!({"vlan-id": id.to_string(), "pvid": false, "value": format!("vlan{id}")}))
+        .collect();
+    json!({
+        "via": "LLDP",
+        "chassis": {switch.name.clone(): {
+            "id": {"type": "mac", "value": switch.chassis_id},
+            "descr": switch.vendor.description(),
+            "mgmt-ip": switch.mgmt_ip,
+            "capability": [{"type": "Bridge", "enabled": true}],
+        }},
+        "port": {
+            "id": {"type": "ifname", "value": port},
+            "descr": port,
+            "ttl": LLDP_TTL.to_string(),
+        },
+        "vlan": vlans,
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn vlans() -> Vec<VlanConfig> {
+        (0..11u16)
+            .map(|i| {
+                let department = if i < 9 { "Sales" } else { "IT" };
+                let id = 100 + i;
+                VlanConfig::new(
+                    id,
+                    format!("10.7.{i}.x"),
+                    format!("{department} VLAN {id}"),
+                    1,
+                )
+                .unwrap()
+            })
+            .collect()
+    }
+
+    #[test]
+    fn test_vlans_map_to_department_switches() {
+        let inventory = build_lldp_inventory(&vlans(), "fw01", "igb1", 6, Some(4)).unwrap();
+        assert_eq!(
+            inventory,
+            build_lldp_inventory(&vlans(), "fw01", "igb1", 6, Some(4)).unwrap()
+        );
+        let names: Vec<&str> = inventory
+            .access
+            .iter()
+            .map(|a| a.switch.name.as_str())
+            .collect();
+        assert_eq!(
+            names,
+            ["it-sw-01", "sales-sw-01", "sales-sw-02", "sales-sw-03"]
+        );
+
+        assert_eq!(inventory.mappings.len(), 11);
+        let first = &inventory.mappings[0];
+        assert_eq!(
+            (first.interface.as_str(), first.device.as_str()),
+            ("opt6", "igb1_vlan100")
+        );
+        assert_eq!(first.access_switch, "sales-sw-01");
+        assert!(first.access_ports.ends_with("1-12") || first.access_ports.ends_with("0-11"));
+        assert_eq!(inventory.mappings[10].interface, "opt16");
+        assert!(build_lldp_inventory(&[], "fw01", "igb1", 6, None).is_err());
+    }
+
+    #[test]
+    fn test_neighbor_tables_are_symmetric() {
+        let inventory = build_lldp_inventory(&vlans(), "fw01", "igb1", 6, Some(4)).unwrap();
+        let tables = render_lldp_neighbors(&inventory);
+        let trunk = &tables["fw01"]["lldp"]["interface"]["igb1"];
+        assert!(trunk["chassis"]["core-sw-01"].is_object());
+        assert_eq!(trunk["vlan"].as_array().unwrap().len(), 11);
+
+        for access in &inventory.access {
+            let seen = &tables["core-sw-01"]["lldp"]["interface"][access.core_port.as_str()];
+            assert!(seen["chassis"][access.switch.name.as_str()].is_object());
+            let uplink = access.switch.vendor.uplink_port();
+            let back = &tables[access.switch.name.as_str()]["lldp"]["interface"][uplink];
+            assert_eq!(back["port"]["id"]["value"], access.core_port.as_str());
+        }
+        assert_eq!(SwitchVendor::Cisco.fiber_port(49), "Te2/0/1");
+        assert_eq!(SwitchVendor::Juniper.fiber_port(2), "xe-0/0/1");
+    }
+}
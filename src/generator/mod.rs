@@ -1,14 +1,66 @@
 //! Data generation modules for network configurations
 
+pub mod accounting;
+pub mod alias;
+pub mod arbitrary;
+pub mod budget;
+pub mod carp;
+pub mod churn;
+pub mod compat;
+pub mod density;
 pub mod departments;
+pub mod description;
+pub mod dns;
+pub mod feeds;
+pub mod fingerprint;
 pub mod firewall;
+pub mod headcount;
+pub mod interface;
+pub mod label;
+pub mod link;
+pub mod lldp;
 pub mod nat;
 pub mod performance;
+pub mod stream;
 pub mod vlan;
 pub mod vpn;
 
+pub use accounting::{AccountingRecord, PortalLimits, TerminateCause, generate_accounting};
+pub use alias::{AliasType, NestedAlias, generate_nested_aliases, render_nested_aliases};
+pub use arbitrary::Arbitrary;
+pub use budget::{SectionBudgets, Truncation};
+pub use carp::{
+    CarpEvent, CarpState, CarpTimeline, CarpVip, HaNode, Incident, IncidentKind, plan_carp_vips,
+    render_carp_log, render_carp_vips, simulate_failovers,
+};
+pub use churn::{ChurnEngine, ChurnEvent};
+pub use compat::{Flavor, Section, Target, UnsupportedPolicy};
+pub use density::{HostDensity, HostOverride, SubnetPopulation, populate_subnets};
+pub use description::{DescriptionStyle, DescriptionStyler, DescriptionStyles};
+pub use dns::{
+    DnsOverrides, OverrideAlias, UnboundHost, generate_dns_overrides, render_dns_overrides,
+};
+pub use feeds::{FeedKind, ThreatFeed, generate_threat_feeds, render_feed_aliases};
+pub use fingerprint::{Device, DeviceClass, DeviceRegistry};
 pub use firewall::{FirewallComplexity, FirewallGenerator, FirewallRule, generate_firewall_rules};
+pub use headcount::{
+    DepartmentPlan, DepartmentUser, HeadcountModel, generate_users, headcount_rules,
+    plan_departments, populate_by_headcount, render_users,
+};
+pub use interface::{InterfaceProfile, VlanInterface, VlanType, assign_interface_profiles};
+pub use label::{LabelSelector, LabelSet, Labels, assign_labels};
+pub use link::{
+    Bridge, BridgeStpParameters, HashPolicy, LacpRate, Lagg, LaggParameters, LinkLayer,
+    StpProtocol, render_bridges, render_laggs,
+};
+pub use lldp::{
+    AccessSwitch, LldpInventory, PortMapping, Switch, SwitchVendor, build_lldp_inventory,
+    render_lldp_neighbors,
+};
 pub use nat::{NatGenerator, NatMapping, NatRuleType, generate_nat_mappings};
 pub use performance::{PerformanceMetrics, PerformantConfigGenerator};
+pub use stream::RngStreams;
 pub use vlan::{VlanConfig, VlanGenerator};
-pub use vpn::{VpnConfig, VpnGenerator, VpnType, generate_vpn_configurations};
+pub use vpn::{
+    VpnConfig, VpnGenerator, VpnType, generate_vpn_configurations, generate_vpn_configurations_with,
+};
@@ -5,6 +5,7 @@
 
 use crate::model::ConfigError;
 use rand::prelude::*;
+use rand_chacha::ChaCha12Rng;
 use serde::{Deserialize, Serialize};
 use std::collections::HashSet;
 use uuid::Uuid;
@@ -64,6 +65,7 @@ impl NatMapping {
     /// Create a new NAT mapping with validation
     #[allow(clippy::too_many_arguments)]
     pub fn new(
+        id: Uuid,
         rule_type: NatRuleType,
         name: String,
         source: String,
@@ -79,7 +81,7 @@ pub fn new(
         vlan_id: Option<u16>,
     ) -> NatResult<Self> {
         let mapping = Self {
-            id: Uuid::new_v4().to_string(),
+            id: id.to_string(),
             rule_type,
             name,
             source,
@@ -199,9 +201,9 @@ pub fn new() -> Self {
     /// Create a new NAT generator with a specific seed for reproducibility
     pub fn new_with_seed(seed: Option<u64>) -> Self {
         let rng: Box<dyn RngCore> = if let Some(seed) = seed {
-            Box::new(StdRng::seed_from_u64(seed))
+            Box::new(ChaCha12Rng::seed_from_u64(seed))
         } else {
-            Box::new(StdRng::from_rng(&mut rand::rng()))
+            Box::new(ChaCha12Rng::from_rng(&mut rand::rng()))
         };
 
         Self {
@@ -229,7 +231,10 @@ pub fn generate_single(&mut self, rule_type: Option<NatRuleType>) -> NatResult<N
             None
         };
 
+        let id = self.random_uuid();
+
         NatMapping::new(
+            id,
             rule_type,
             name,
             source,
@@ -329,10 +334,15 @@ fn generate_unique_name(&mut self, rule_type: &NatRuleType) -> String {
                 NatRuleType::OneToOneNat => "1to1-NAT",
                 NatRuleType::OutboundNat => "Outbound",
             },
-            Uuid::new_v4().to_string().split('-').next().unwrap()
+            self.random_uuid().to_string().split('-').next().unwrap()
         )
     }
 
+    /// Generate a UUID from the seeded RNG
+    fn random_uuid(&mut self) -> Uuid {
+        uuid::Builder::from_random_bytes(self.rng.random()).into_uuid()
+    }
+
     /// Generate random protocol
     fn random_protocol(&mut self) -> String {
         match self.rng.random_range(0..4) {
@@ -547,6 +557,7 @@ mod tests {
     #[test]
     fn test_nat_mapping_creation() {
         let mapping = NatMapping::new(
+            Uuid::nil(),
             NatRuleType::PortForward,
             "Web-Server-Forward".to_string(),
             "any".to_string(),
@@ -572,6 +583,7 @@ fn test_nat_mapping_creation() {
     #[test]
     fn test_nat_mapping_validation_invalid_protocol() {
         let mapping = NatMapping::new(
+            Uuid::nil(),
             NatRuleType::PortForward,
             "Test-Forward".to_string(),
             "any".to_string(),
@@ -599,6 +611,7 @@ fn test_nat_mapping_validation_invalid_protocol() {
     #[test]
     fn test_nat_mapping_validation_invalid_vlan() {
         let mapping = NatMapping::new(
+            Uuid::nil(),
             NatRuleType::PortForward,
             "Test-Forward".to_string(),
             "any".to_string(),
@@ -655,6 +668,19 @@ fn test_nat_generator_batch() {
         }
     }
 
+    #[test]
+    fn test_nat_generator_seeded_ids() {
+        let first = NatGenerator::new_with_seed(Some(42))
+            .generate_batch(5)
+            .unwrap();
+        let second = NatGenerator::new_with_seed(Some(42))
+            .generate_batch(5)
+            .unwrap();
+
+        let ids: Vec<_> = first.iter().map(|m| &m.id).collect();
+        assert_eq!(ids, second.iter().map(|m| &m.id).collect::<Vec<_>>());
+    }
+
     #[test]
     fn test_port_validation() {
         let mapping = NatMapping {
@@ -2,13 +2,14 @@
 
 use crate::Result;
 use crate::generator::departments;
+use crate::model::options::PrefixStrategy;
 use crate::model::{ConfigError, VlanError, VlanResult};
 use crate::utils::rfc1918;
 use indicatif::ProgressBar;
 use ipnetwork::Ipv4Network;
 use rand::prelude::*;
 use rand::{RngCore, SeedableRng};
-use rand_chacha::ChaCha8Rng;
+use rand_chacha::{ChaCha8Rng, ChaCha12Rng};
 use serde::{Deserialize, Serialize};
 use std::collections::HashSet;
 
@@ -24,7 +25,7 @@ pub struct StaticReservation {
 }
 
 /// DHCP server configuration with realistic enterprise settings
-#[derive(Debug, Clone, Serialize, Deserialize)]
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
 pub struct DhcpServerConfig {
     /// Enable DHCP server
     pub enabled: bool,
@@ -240,7 +241,7 @@ pub fn subnet_mask(&self) -> &'static str {
     /// Extract the three-octet base prefix from the IP network string.
     ///
     /// Handles both "10.1.2.x" and "10.1.2.0/24" formats, returning "10.1.2".
-    fn network_base(&self) -> Result<&str> {
+    pub(crate) fn network_base(&self) -> Result<&str> {
         self.ip_network
             .strip_suffix(".x")
             .or_else(|| self.ip_network.strip_suffix(".0/24"))
@@ -406,6 +407,8 @@ pub struct VlanGenerator {
     rng: Box<dyn RngCore>,
     used_vlan_ids: HashSet<u16>,
     used_networks: HashSet<String>,
+    prefix_strategy: PrefixStrategy,
+    address_usage: rfc1918::AddressSpaceUsage,
 }
 
 impl VlanGenerator {
@@ -421,24 +424,51 @@ pub fn new(seed: Option<u64>) -> Self {
             rng,
             used_vlan_ids: HashSet::new(),
             used_networks: HashSet::new(),
+            prefix_strategy: PrefixStrategy::default(),
+            address_usage: rfc1918::AddressSpaceUsage::new(),
         }
     }
 
-    /// Create a new generator with StdRng for compatibility
-    pub fn new_with_std_rng(seed: Option<u64>) -> Self {
+    /// Create a new generator with ChaCha12Rng
+    ///
+    /// This is the stream `StdRng` produced in earlier releases, pinned to a
+    /// named algorithm so seeded output no longer depends on the `rand` version.
+    pub fn new_with_chacha12(seed: Option<u64>) -> Self {
         let rng: Box<dyn RngCore> = if let Some(seed) = seed {
-            Box::new(StdRng::seed_from_u64(seed))
+            Box::new(ChaCha12Rng::seed_from_u64(seed))
         } else {
-            Box::new(StdRng::from_rng(&mut rand::rng()))
+            Box::new(ChaCha12Rng::from_rng(&mut rand::rng()))
         };
 
         Self {
             rng,
             used_vlan_ids: HashSet::new(),
             used_networks: HashSet::new(),
+            prefix_strategy: PrefixStrategy::default(),
+            address_usage: rfc1918::AddressSpaceUsage::new(),
+        }
+    }
+
+    /// Select the RFC 1918 ranges new networks are drawn from
+    pub fn with_prefix_strategy(mut self, strategy: PrefixStrategy) -> Self {
+        self.prefix_strategy = strategy;
+        self
+    }
+
+    /// Mark an existing configuration's VLAN ID and network as used
+    pub fn reserve(&mut self, config: &VlanConfig) {
+        self.used_vlan_ids.insert(config.vlan_id);
+        self.used_networks.insert(config.ip_network.clone());
+        if let Ok(network) = config.as_ipv4_network() {
+            self.address_usage.record(&network);
         }
     }
 
+    /// Address space consumed by networks generated or reserved so far
+    pub fn address_usage(&self) -> &rfc1918::AddressSpaceUsage {
+        &self.address_usage
+    }
+
     /// Generate a single VLAN configuration
     pub fn generate_single(&mut self) -> Result<VlanConfig> {
         const MAX_ATTEMPTS: usize = 1000;
@@ -556,12 +586,28 @@ fn generate_unique_vlan_id_enhanced(&mut self, max_attempts: usize) -> VlanResul
     /// Generate unique IP network
     pub fn generate_unique_ip_network(&mut self, max_attempts: usize) -> Result<String> {
         for _ in 0..max_attempts {
-            // Generate Class A private network (10.0.0.0/8)
-            let second_octet = self.rng.random_range(1..=254);
-            let third_octet = self.rng.random_range(1..=254);
-            let network = format!("10.{second_octet}.{third_octet}.x");
+            let base = match self.next_prefix_class() {
+                rfc1918::Rfc1918Class::A => {
+                    let second_octet = self.rng.random_range(1..=254);
+                    let third_octet = self.rng.random_range(1..=254);
+                    format!("10.{second_octet}.{third_octet}")
+                }
+                rfc1918::Rfc1918Class::B => {
+                    let second_octet = self.rng.random_range(16..=31);
+                    let third_octet = self.rng.random_range(1..=254);
+                    format!("172.{second_octet}.{third_octet}")
+                }
+                rfc1918::Rfc1918Class::C => {
+                    let third_octet = self.rng.random_range(1..=254);
+                    format!("192.168.{third_octet}")
+                }
+            };
+            let network = format!("{base}.x");
 
             if self.used_networks.insert(network.clone()) {
+                if let Ok(parsed) = format!("{base}.0/24").parse::<Ipv4Network>() {
+                    self.address_usage.record(&parsed);
+                }
                 return Ok(network);
             }
         }
@@ -569,6 +615,29 @@ pub fn generate_unique_ip_network(&mut self, max_attempts: usize) -> Result<Stri
         Err(ConfigError::resource_exhausted("IP networks"))
     }
 
+    /// RFC 1918 class for the next network according to the prefix strategy
+    ///
+    /// Class A draws no random numbers, so output for the default strategy is
+    /// unchanged from earlier releases for the same seed.
+    fn next_prefix_class(&mut self) -> rfc1918::Rfc1918Class {
+        match self.prefix_strategy {
+            PrefixStrategy::ClassA => rfc1918::Rfc1918Class::A,
+            PrefixStrategy::ClassB => rfc1918::Rfc1918Class::B,
+            PrefixStrategy::ClassC => rfc1918::Rfc1918Class::C,
+            // Same proportions as the enhanced RFC 1918 generator
+            PrefixStrategy::Mixed => {
+                if self.rng.random_bool(0.8) {
+                    rfc1918::Rfc1918Class::A
+                } else if self.rng.random_bool(0.6) {
+                    rfc1918::Rfc1918Class::B
+                } else {
+                    rfc1918::Rfc1918Class::C
+                }
+            }
+            PrefixStrategy::Auto => self.address_usage.least_utilized(),
+        }
+    }
+
     /// Generate unique RFC 1918 network using ipnetwork types
     fn generate_unique_rfc1918_network(&mut self, max_attempts: usize) -> VlanResult<Ipv4Network> {
         for _ in 0..max_attempts {
@@ -622,13 +691,22 @@ fn generate_description_enhanced(&mut self, vlan_id: u16) -> String {
     }
 }
 
-/// Generate multiple VLAN configurations using legacy StdRng for compatibility
+/// RFC 1918 address-space consumption of a set of configurations
+///
+/// Configurations whose network cannot be parsed are skipped.
+pub fn address_space_usage(configs: &[VlanConfig]) -> rfc1918::AddressSpaceUsage {
+    rfc1918::AddressSpaceUsage::from_networks(
+        configs.iter().filter_map(|c| c.as_ipv4_network().ok()),
+    )
+}
+
+/// Generate multiple VLAN configurations using ChaCha12Rng for compatibility
 pub fn generate_vlan_configurations(
     count: u16,
     seed: Option<u64>,
     progress_bar: Option<&ProgressBar>,
 ) -> Result<Vec<VlanConfig>> {
-    let mut generator = VlanGenerator::new_with_std_rng(seed);
+    let mut generator = VlanGenerator::new_with_chacha12(seed);
     let mut configs = Vec::with_capacity(count as usize);
 
     for i in 0..count {
@@ -670,7 +748,7 @@ pub fn generate_vlan_configurations_from_ranges(
     seed: Option<u64>,
     progress_bar: Option<&ProgressBar>,
 ) -> Result<Vec<VlanConfig>> {
-    let mut generator = VlanGenerator::new_with_std_rng(seed);
+    let mut generator = VlanGenerator::new_with_chacha12(seed);
 
     // Calculate total number of VLANs for progress tracking and pre-allocation
     let total_vlans: u32 = vlan_ranges
@@ -709,9 +787,11 @@ pub fn generate_vlan_configurations_from_ranges_with_wan(
     vlan_ranges: &[(u16, u16)],
     seed: Option<u64>,
     wan_strategy: Option<&crate::cli::WanAssignmentStrategy>,
+    prefix_strategy: PrefixStrategy,
     progress_bar: Option<&ProgressBar>,
 ) -> Result<Vec<VlanConfig>> {
-    let mut generator = VlanGenerator::new_with_std_rng(seed);
+    let mut generator =
+        VlanGenerator::new_with_chacha12(seed).with_prefix_strategy(prefix_strategy);
 
     // Calculate total number of VLANs for progress tracking and pre-allocation
     let total_vlans: u32 = vlan_ranges
@@ -756,9 +836,11 @@ pub fn generate_vlan_configurations_with_wan(
     count: u16,
     seed: Option<u64>,
     wan_strategy: Option<&crate::cli::WanAssignmentStrategy>,
+    prefix_strategy: PrefixStrategy,
     progress_bar: Option<&ProgressBar>,
 ) -> Result<Vec<VlanConfig>> {
-    let mut generator = VlanGenerator::new_with_std_rng(seed);
+    let mut generator =
+        VlanGenerator::new_with_chacha12(seed).with_prefix_strategy(prefix_strategy);
     let mut configs = Vec::with_capacity(count as usize);
 
     for i in 0..count {
@@ -781,6 +863,105 @@ pub fn generate_vlan_configurations_with_wan(
     Ok(configs)
 }
 
+/// Generate VLAN configurations by count, reusing a previous run where possible
+///
+/// Previous configurations are kept verbatim and in their original order (up to
+/// `count`); only the missing configurations are newly generated, avoiding the
+/// VLAN IDs and networks already in use. This keeps regenerated fixtures
+/// byte-identical apart from the actual delta.
+pub fn generate_vlan_configurations_minimizing_diff(
+    previous: &[VlanConfig],
+    count: u16,
+    seed: Option<u64>,
+    wan_strategy: Option<&crate::cli::WanAssignmentStrategy>,
+    prefix_strategy: PrefixStrategy,
+    progress_bar: Option<&ProgressBar>,
+) -> Result<Vec<VlanConfig>> {
+    let mut generator =
+        VlanGenerator::new_with_chacha12(seed).with_prefix_strategy(prefix_strategy);
+    for config in previous {
+        generator.reserve(config);
+    }
+
+    let count = count as usize;
+    let mut configs: Vec<VlanConfig> = previous.iter().take(count).cloned().collect();
+    if let Some(pb) = progress_bar {
+        pb.set_position(configs.len() as u64);
+    }
+
+    while configs.len() < count {
+        let index = configs.len();
+        let vlan_id = generator.generate_unique_vlan_id(1000)?;
+        let ip_network = generator.generate_unique_ip_network(1000)?;
+        let description = generator.generate_description(vlan_id);
+        let wan_assignment =
+            generator.generate_wan_assignment(wan_strategy, Some(index), Some(count));
+
+        configs.push(VlanConfig::new(
+            vlan_id,
+            ip_network,
+            description,
+            wan_assignment,
+        )?);
+
+        if let Some(pb) = progress_bar {
+            pb.set_position(configs.len() as u64);
+        }
+    }
+
+    Ok(configs)
+}
+
+/// Generate VLAN configurations from ranges, reusing a previous run where possible
+///
+/// VLAN IDs present in the previous run are reproduced exactly; IDs that are new
+/// to the range get freshly generated networks that do not collide with reused ones.
+pub fn generate_vlan_configurations_from_ranges_minimizing_diff(
+    previous: &[VlanConfig],
+    vlan_ranges: &[(u16, u16)],
+    seed: Option<u64>,
+    wan_strategy: Option<&crate::cli::WanAssignmentStrategy>,
+    prefix_strategy: PrefixStrategy,
+    progress_bar: Option<&ProgressBar>,
+) -> Result<Vec<VlanConfig>> {
+    let mut generator =
+        VlanGenerator::new_with_chacha12(seed).with_prefix_strategy(prefix_strategy);
+    for config in previous {
+        generator.reserve(config);
+    }
+
+    let total_vlans: u32 = vlan_ranges
+        .iter()
+        .map(|(start, end)| u32::from(*end) - u32::from(*start) + 1)
+        .sum();
+    let mut configs = Vec::with_capacity(total_vlans as usize);
+
+    for (start, end) in vlan_ranges {
+        for vlan_id in *start..=*end {
+            let config = match previous.iter().find(|c| c.vlan_id == vlan_id) {
+                Some(existing) => existing.clone(),
+                None => {
+                    let ip_network = generator.generate_unique_ip_network(1000)?;
+                    let description = generator.generate_description(vlan_id);
+                    let wan_assignment = generator.generate_wan_assignment(
+                        wan_strategy,
+                        Some(configs.len()),
+                        Some(total_vlans as usize),
+                    );
+                    VlanConfig::new(vlan_id, ip_network, description, wan_assignment)?
+                }
+            };
+            configs.push(config);
+
+            if let Some(pb) = progress_bar {
+                pb.set_position(configs.len() as u64);
+            }
+        }
+    }
+
+    Ok(configs)
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -1649,4 +1830,112 @@ fn test_dhcp_server_config_complete() {
         assert!(dhcp_config.ntp_servers.len() >= 3);
         assert!(dhcp_config.static_reservations.len() >= 2);
     }
+
+    // ===== Minimize-diff Tests =====
+
+    #[test]
+    fn test_minimizing_diff_keeps_previous_and_adds_delta() {
+        let previous = generate_vlan_configurations(10, Some(42), None).unwrap();
+        let configs = generate_vlan_configurations_minimizing_diff(
+            &previous,
+            15,
+            Some(7),
+            None,
+            PrefixStrategy::ClassA,
+            None,
+        )
+        .unwrap();
+
+        assert_eq!(configs.len(), 15);
+        assert_eq!(&configs[..10], &previous[..]);
+
+        let ids: HashSet<u16> = configs.iter().map(|c| c.vlan_id).collect();
+        let networks: HashSet<&str> = configs.iter().map(|c| c.ip_network.as_str()).collect();
+        assert_eq!(ids.len(), 15);
+        assert_eq!(networks.len(), 15);
+    }
+
+    #[test]
+    fn test_minimizing_diff_truncates_when_shrinking() {
+        let previous = generate_vlan_configurations(10, Some(42), None).unwrap();
+        let configs = generate_vlan_configurations_minimizing_diff(
+            &previous,
+            4,
+            None,
+            None,
+            PrefixStrategy::ClassA,
+            None,
+        )
+        .unwrap();
+        assert_eq!(&configs[..], &previous[..4]);
+    }
+
+    #[test]
+    fn test_ranges_minimizing_diff_reuses_matching_ids() {
+        let previous =
+            generate_vlan_configurations_from_ranges(&[(100, 104)], Some(1), None).unwrap();
+        let configs = generate_vlan_configurations_from_ranges_minimizing_diff(
+            &previous,
+            &[(100, 106)],
+            Some(2),
+            None,
+            PrefixStrategy::ClassA,
+            None,
+        )
+        .unwrap();
+
+        assert_eq!(configs.len(), 7);
+        assert_eq!(&configs[..5], &previous[..]);
+        assert_eq!(configs[5].vlan_id, 105);
+        assert!(
+            previous
+                .iter()
+                .all(|p| p.ip_network != configs[6].ip_network)
+        );
+    }
+
+    #[test]
+    fn test_prefix_strategy_restricts_class() {
+        for (strategy, prefix) in [
+            (PrefixStrategy::ClassA, "10."),
+            (PrefixStrategy::ClassB, "172."),
+            (PrefixStrategy::ClassC, "192.168."),
+        ] {
+            let configs =
+                generate_vlan_configurations_with_wan(20, Some(3), None, strategy, None).unwrap();
+            assert!(
+                configs.iter().all(|c| c.ip_network.starts_with(prefix)),
+                "{strategy:?} produced a network outside {prefix}"
+            );
+            for config in &configs {
+                assert!(config.validate_rfc1918().is_ok());
+            }
+        }
+    }
+
+    #[test]
+    fn test_prefix_strategy_default_matches_legacy_output() {
+        let legacy =
+            generate_vlan_configurations_with_wan(10, Some(42), None, PrefixStrategy::ClassA, None)
+                .unwrap();
+        let plain = generate_vlan_configurations(10, Some(42), None).unwrap();
+        assert_eq!(legacy, plain);
+    }
+
+    #[test]
+    fn test_auto_prefix_strategy_balances_utilization() {
+        let mut generator = VlanGenerator::new(Some(5)).with_prefix_strategy(PrefixStrategy::Auto);
+        for _ in 0..30 {
+            generator.generate_unique_ip_network(1000).unwrap();
+        }
+        let usage = generator.address_usage();
+        // Every class gets used, and the small class C block is never the most loaded by count
+        for class in rfc1918::Rfc1918Class::ALL {
+            assert!(usage.usage(class).used_subnets > 0, "{class:?} unused");
+        }
+        assert!(
+            usage.usage(rfc1918::Rfc1918Class::C).used_subnets
+                < usage.usage(rfc1918::Rfc1918Class::A).used_subnets
+        );
+    }
 }
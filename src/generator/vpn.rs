@@ -5,6 +5,7 @@
 
 use crate::model::ConfigError;
 use rand::prelude::*;
+use rand_chacha::ChaCha12Rng;
 use serde::{Deserialize, Serialize};
 use std::collections::HashSet;
 use uuid::Uuid;
@@ -53,6 +54,7 @@ impl VpnConfig {
     /// Create a new VPN configuration with validation
     #[allow(clippy::too_many_arguments)]
     pub fn new(
+        id: Uuid,
         vpn_type: VpnType,
         name: String,
         server: String,
@@ -66,7 +68,7 @@ pub fn new(
         enabled: bool,
     ) -> VpnResult<Self> {
         let config = Self {
-            id: Uuid::new_v4().to_string(),
+            id: id.to_string(),
             vpn_type,
             name,
             server,
@@ -145,6 +147,7 @@ pub struct VpnGenerator {
     rng: Box<dyn RngCore>,
     used_ports: HashSet<u16>,
     used_names: HashSet<String>,
+    substitutions: Vec<(VpnType, VpnType)>,
 }
 
 impl VpnGenerator {
@@ -156,18 +159,27 @@ pub fn new() -> Self {
     /// Create a new VPN generator with a specific seed for reproducibility
     pub fn new_with_seed(seed: Option<u64>) -> Self {
         let rng: Box<dyn RngCore> = if let Some(seed) = seed {
-            Box::new(StdRng::seed_from_u64(seed))
+            Box::new(ChaCha12Rng::seed_from_u64(seed))
         } else {
-            Box::new(StdRng::from_rng(&mut rand::rng()))
+            Box::new(ChaCha12Rng::from_rng(&mut rand::rng()))
         };
 
         Self {
             rng,
             used_ports: HashSet::new(),
             used_names: HashSet::new(),
+            substitutions: Vec::new(),
         }
     }
 
+    /// Generate `replacement` tunnels wherever a random type would be `unsupported`
+    ///
+    /// Used to downgrade tunnels a targeted OPNsense release cannot load.
+    pub fn with_substitution(mut self, unsupported: VpnType, replacement: VpnType) -> Self {
+        self.substitutions.push((unsupported, replacement));
+        self
+    }
+
     /// Generate a single VPN configuration
     pub fn generate_single(&mut self, vpn_type: Option<VpnType>) -> VpnResult<VpnConfig> {
         let vpn_type = vpn_type.unwrap_or_else(|| self.random_vpn_type());
@@ -181,8 +193,10 @@ pub fn generate_single(&mut self, vpn_type: Option<VpnType>) -> VpnResult<VpnCon
         let client_subnet = self.generate_client_subnet();
         let dns_servers = self.generate_dns_servers();
         let enabled = self.rng.random_bool(0.85); // 85% chance of being enabled
+        let id = self.random_uuid();
 
         VpnConfig::new(
+            id,
             vpn_type,
             name,
             server,
@@ -211,11 +225,15 @@ pub fn generate_batch(&mut self, count: u16) -> VpnResult<Vec<VpnConfig>> {
 
     /// Generate a random VPN type
     fn random_vpn_type(&mut self) -> VpnType {
-        match self.rng.random_range(0..3) {
+        let vpn_type = match self.rng.random_range(0..3) {
             0 => VpnType::OpenVPN,
             1 => VpnType::WireGuard,
             _ => VpnType::IPSec,
-        }
+        };
+        self.substitutions
+            .iter()
+            .find(|(unsupported, _)| *unsupported == vpn_type)
+            .map_or(vpn_type, |(_, replacement)| replacement.clone())
     }
 
     /// Generate a unique VPN name
@@ -271,10 +289,15 @@ fn generate_unique_name(&mut self, vpn_type: &VpnType) -> String {
                 VpnType::WireGuard => "WireGuard",
                 VpnType::IPSec => "IPSec",
             },
-            Uuid::new_v4().to_string().split('-').next().unwrap()
+            self.random_uuid().to_string().split('-').next().unwrap()
         )
     }
 
+    /// Generate a UUID from the seeded RNG
+    fn random_uuid(&mut self) -> Uuid {
+        uuid::Builder::from_random_bytes(self.rng.random()).into_uuid()
+    }
+
     /// Generate a server address (IP or hostname)
     fn generate_server_address(&mut self) -> String {
         if self.rng.random_bool(0.4) {
@@ -404,7 +427,7 @@ fn generate_key_identifier(&mut self, vpn_type: &VpnType) -> String {
         match vpn_type {
             VpnType::OpenVPN => format!(
                 "openvpn-cert-{}",
-                Uuid::new_v4().to_string().split('-').next().unwrap()
+                self.random_uuid().to_string().split('-').next().unwrap()
             ),
             VpnType::WireGuard => {
                 // Generate realistic WireGuard public key format (base64, 44 chars)
@@ -420,11 +443,11 @@ fn generate_key_identifier(&mut self, vpn_type: &VpnType) -> String {
             VpnType::IPSec => {
                 // Generate PSK or certificate identifier
                 if self.rng.random_bool(0.6) {
-                    format!("psk-{}", Uuid::new_v4())
+                    format!("psk-{}", self.random_uuid())
                 } else {
                     format!(
                         "ipsec-cert-{}",
-                        Uuid::new_v4().to_string().split('-').next().unwrap()
+                        self.random_uuid().to_string().split('-').next().unwrap()
                     )
                 }
             }
@@ -508,7 +531,15 @@ pub fn generate_vpn_configurations(
     seed: Option<u64>,
     progress_bar: Option<&indicatif::ProgressBar>,
 ) -> VpnResult<Vec<VpnConfig>> {
-    let mut generator = VpnGenerator::new_with_seed(seed);
+    generate_vpn_configurations_with(VpnGenerator::new_with_seed(seed), count, progress_bar)
+}
+
+/// Generate multiple VPN configurations from a configured generator
+pub fn generate_vpn_configurations_with(
+    mut generator: VpnGenerator,
+    count: u16,
+    progress_bar: Option<&indicatif::ProgressBar>,
+) -> VpnResult<Vec<VpnConfig>> {
     let mut configs = Vec::with_capacity(count as usize);
 
     for i in 0..count {
@@ -530,6 +561,7 @@ mod tests {
     #[test]
     fn test_vpn_config_creation() {
         let config = VpnConfig::new(
+            Uuid::nil(),
             VpnType::OpenVPN,
             "Test-VPN".to_string(),
             "vpn.example.com".to_string(),
@@ -553,6 +585,7 @@ fn test_vpn_config_creation() {
     #[test]
     fn test_vpn_config_validation_invalid_port() {
         let config = VpnConfig::new(
+            Uuid::nil(),
             VpnType::OpenVPN,
             "Test-VPN".to_string(),
             "vpn.example.com".to_string(),
@@ -578,6 +611,7 @@ fn test_vpn_config_validation_invalid_port() {
     #[test]
     fn test_vpn_config_validation_invalid_protocol() {
         let config = VpnConfig::new(
+            Uuid::nil(),
             VpnType::WireGuard,
             "Test-VPN".to_string(),
             "vpn.example.com".to_string(),
@@ -634,4 +668,30 @@ fn test_vpn_generator_batch() {
             // Ports might not be unique across different VPN types, so we only check within type
         }
     }
+
+    #[test]
+    fn test_vpn_generator_seeded_ids() {
+        let first = VpnGenerator::new_with_seed(Some(42))
+            .generate_batch(5)
+            .unwrap();
+        let second = VpnGenerator::new_with_seed(Some(42))
+            .generate_batch(5)
+            .unwrap();
+
+        for (a, b) in first.iter().zip(&second) {
+            assert_eq!(a.id, b.id);
+            assert_eq!(a.key_identifier, b.key_identifier);
+        }
+    }
+
+    #[test]
+    fn test_vpn_generator_substitution() {
+        let generator = VpnGenerator::new_with_seed(Some(42))
+            .with_substitution(VpnType::WireGuard, VpnType::OpenVPN);
+        let configs = generate_vpn_configurations_with(generator, 30, None).unwrap();
+
+        assert_eq!(configs.len(), 30);
+        assert!(configs.iter().all(|c| c.vpn_type != VpnType::WireGuard));
+        assert!(configs.iter().any(|c| c.vpn_type == VpnType::OpenVPN));
+    }
 }
@@ -1,7 +1,9 @@
 //! CSV input/output operations
 
 use crate::Result;
-use crate::generator::{FirewallRule, VlanConfig};
+use crate::generator::{
+    AccountingRecord, FirewallRule, PortMapping, SubnetPopulation, VlanConfig, VlanInterface,
+};
 use csv::{Reader, Writer, WriterBuilder};
 use lazy_static::lazy_static;
 use serde::{Deserialize, Serialize};
@@ -307,6 +309,92 @@ pub fn write_firewall_rules_csv<P: AsRef<Path>>(rules: &[FirewallRule], path: P)
     Ok(())
 }
 
+/// Write generated hosts to a CSV file, one row per occupied address
+///
+/// The `mac` column is empty for hosts inside the dynamic DHCP pool, which
+/// have a host override and alias membership but no static mapping.
+pub fn write_host_population_csv<P: AsRef<Path>>(
+    populations: &[SubnetPopulation],
+    path: P,
+) -> Result<()> {
+    let file = File::create(path)?;
+    let mut writer = Writer::from_writer(BufWriter::new(file));
+
+    writer.write_record(["vlan_id", "ip_addr", "hostname", "domain", "mac", "alias"])?;
+
+    for population in populations {
+        let alias = population.alias_name();
+        let vlan_id = population.vlan_id.to_string();
+        for host in &population.host_overrides {
+            let mac = population
+                .reservations
+                .iter()
+                .find(|r| r.ip_addr == host.ip_addr)
+                .map_or("", |r| r.mac.as_str());
+            writer.write_record([
+                vlan_id.as_str(),
+                host.ip_addr.as_str(),
+                host.hostname.as_str(),
+                host.domain.as_str(),
+                mac,
+                alias.as_str(),
+            ])?;
+        }
+    }
+
+    writer.flush()?;
+    Ok(())
+}
+
+/// Write RADIUS accounting records to a CSV file, one row per session
+pub fn write_accounting_csv<P: AsRef<Path>>(records: &[AccountingRecord], path: P) -> Result<()> {
+    let file = File::create(path)?;
+    let mut writer = Writer::from_writer(BufWriter::new(file));
+    for record in records {
+        writer.serialize(record)?;
+    }
+    writer.flush()?;
+    Ok(())
+}
+
+/// Write switch port mappings to a CSV file, one row per VLAN interface
+pub fn write_port_mappings_csv<P: AsRef<Path>>(mappings: &[PortMapping], path: P) -> Result<()> {
+    let file = File::create(path)?;
+    let mut writer = Writer::from_writer(BufWriter::new(file));
+    for mapping in mappings {
+        writer.serialize(mapping)?;
+    }
+    writer.flush()?;
+    Ok(())
+}
+
+/// Write interface profiles assigned by `--interface-realism` to a CSV file
+///
+/// The mss cell is empty for interfaces without MSS clamping.
+pub fn write_interface_profiles_csv<P: AsRef<Path>>(
+    interfaces: &[VlanInterface],
+    path: P,
+) -> Result<()> {
+    let file = File::create(path)?;
+    let mut writer = Writer::from_writer(BufWriter::new(file));
+
+    writer.write_record(["vlan_id", "type", "mtu", "mss", "pcp"])?;
+
+    for interface in interfaces {
+        let profile = &interface.profile;
+        writer.write_record([
+            interface.vlan_id.to_string(),
+            profile.vlan_type.to_string(),
+            profile.mtu.to_string(),
+            profile.mss.map(|mss| mss.to_string()).unwrap_or_default(),
+            profile.pcp.to_string(),
+        ])?;
+    }
+
+    writer.flush()?;
+    Ok(())
+}
+
 /// Read firewall rules from a CSV file
 pub fn read_firewall_rules_csv<P: AsRef<Path>>(path: P) -> Result<Vec<FirewallRule>> {
     let file = File::open(path)?;
@@ -464,6 +552,58 @@ fn test_csv_round_trip() {
         }
     }
 
+    #[test]
+    fn test_write_host_population_csv() {
+        let configs = vec![
+            VlanConfig::new(100, "10.1.2.x".to_string(), "IT VLAN 100".to_string(), 1).unwrap(),
+        ];
+        let density = crate::generator::HostDensity::new(1.0).unwrap();
+        let populations = crate::generator::populate_subnets(&configs, density, Some(1)).unwrap();
+
+        let temp_file = NamedTempFile::new().unwrap();
+        write_host_population_csv(&populations, temp_file.path()).unwrap();
+
+        let content = std::fs::read_to_string(temp_file.path()).unwrap();
+        let lines: Vec<&str> = content.lines().collect();
+        assert_eq!(lines[0], "vlan_id,ip_addr,hostname,domain,mac,alias");
+        assert_eq!(lines.len(), 1 + 253);
+        assert_eq!(
+            lines[1],
+            "100,10.1.2.2,it-host-002,it.company.local,02:00:00:64:00:02,VLAN100_HOSTS"
+        );
+        assert!(content.contains("100,10.1.2.150,it-host-150,it.company.local,,VLAN100_HOSTS"));
+    }
+
+    #[test]
+    fn test_write_interface_profiles_csv() {
+        use crate::generator::{VlanInterface, VlanType};
+
+        let interfaces = vec![
+            VlanInterface {
+                vlan_id: 100,
+                profile: VlanType::Storage.profile(),
+            },
+            VlanInterface {
+                vlan_id: 7,
+                profile: VlanType::Pppoe.profile(),
+            },
+        ];
+
+        let temp_file = NamedTempFile::new().unwrap();
+        write_interface_profiles_csv(&interfaces, temp_file.path()).unwrap();
+
+        let content = std::fs::read_to_string(temp_file.path()).unwrap();
+        let lines: Vec<&str> = content.lines().collect();
+        assert_eq!(
+            lines,
+            vec![
+                "vlan_id,type,mtu,mss,pcp",
+                "100,storage,9000,,3",
+                "7,pppoe,1492,1452,0"
+            ]
+        );
+    }
+
     #[test]
     fn test_csv_record_conversion() {
         let config =
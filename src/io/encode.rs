@@ -0,0 +1,334 @@
+//! Output encoders for generated datasets
+//!
+//! An [`Encoder`] turns a [`Dataset`] into bytes. Encoders are looked up by
+//! name in an [`EncoderRegistry`]; the default registry holds the built-in
+//! XML, JSON, and protobuf encoders, and library users can register their own
+//! under a new name or replace a built-in one.
+//!
+//! The protobuf encoding is experimental: it follows [`DATASET_PROTO`] and is
+//! written by hand on the wire-format level, so consumers that only need the
+//! structured data can read it with generated bindings instead of parsing XML.
+
+use crate::Result;
+use crate::generator::{FirewallRule, VlanConfig};
+use crate::model::ConfigError;
+use crate::xml::config_from_default;
+use serde::{Deserialize, Serialize};
+
+/// Schema of the experimental protobuf encoding
+pub const DATASET_PROTO: &str = r#"syntax = "proto3";
+
+package opnsense_config_faker.v1;
+
+message Dataset {
+  repeated Vlan vlans = 1;
+  repeated FirewallRule firewall_rules = 2;
+}
+
+message Vlan {
+  uint32 vlan_id = 1;
+  string ip_network = 2;
+  string description = 3;
+  uint32 wan_assignment = 4;
+}
+
+message FirewallRule {
+  string rule_id = 1;
+  string source = 2;
+  string destination = 3;
+  string protocol = 4;
+  string ports = 5;
+  string action = 6;
+  string direction = 7;
+  string description = 8;
+  bool log = 9;
+  optional uint32 vlan_id = 10;
+  uint32 priority = 11;
+  string interface = 12;
+}
+"#;
+
+/// Structured data of one generation run
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Dataset {
+    /// Generated VLANs
+    pub vlans: Vec<VlanConfig>,
+    /// Generated firewall rules, empty unless requested
+    pub firewall_rules: Vec<FirewallRule>,
+}
+
+/// Encoding of a [`Dataset`]
+pub trait Encoder: Send + Sync {
+    /// Name the encoder is selected by, e.g. `json`
+    fn name(&self) -> &'static str;
+
+    /// File extension of encoded output, without the dot
+    fn extension(&self) -> &'static str;
+
+    /// Whether the encoding may still change incompatibly
+    fn is_experimental(&self) -> bool {
+        false
+    }
+
+    /// Encode a dataset
+    fn encode(&self, dataset: &Dataset) -> Result<Vec<u8>>;
+}
+
+/// Encoders by name
+pub struct EncoderRegistry {
+    encoders: Vec<Box<dyn Encoder>>,
+}
+
+impl EncoderRegistry {
+    /// Registry without any encoders
+    pub fn empty() -> Self {
+        Self {
+            encoders: Vec::new(),
+        }
+    }
+
+    /// Add an encoder, replacing and returning one registered under the same name
+    pub fn register(&mut self, encoder: Box<dyn Encoder>) -> Option<Box<dyn Encoder>> {
+        match self
+            .encoders
+            .iter()
+            .position(|e| e.name() == encoder.name())
+        {
+            Some(index) => Some(std::mem::replace(&mut self.encoders[index], encoder)),
+            None => {
+                self.encoders.push(encoder);
+                None
+            }
+        }
+    }
+
+    /// Encoder registered under `name`
+    pub fn get(&self, name: &str) -> Option<&dyn Encoder> {
+        self.encoders
+            .iter()
+            .find(|e| e.name() == name)
+            .map(|e| e.as_ref())
+    }
+
+    /// Encoder registered under `name`, or an error listing the known names
+    pub fn require(&self, name: &str) -> Result<&dyn Encoder> {
+        self.get(name).ok_or_else(|| {
+            ConfigError::invalid_parameter(
+                "encoder",
+                format!(
+                    "Unknown encoder '{name}'; available: {}",
+                    self.names().join(", ")
+                ),
+            )
+        })
+    }
+
+    /// Names of the registered encoders in registration order
+    pub fn names(&self) -> Vec<&'static str> {
+        self.encoders.iter().map(|e| e.name()).collect()
+    }
+}
+
+impl Default for EncoderRegistry {
+    /// Registry with the built-in XML, JSON, and protobuf encoders
+    fn default() -> Self {
+        let mut registry = Self::empty();
+        registry.register(Box::new(XmlEncoder::default()));
+        registry.register(Box::new(JsonEncoder));
+        registry.register(Box::new(ProtobufEncoder));
+        registry
+    }
+}
+
+/// OPNsense configuration built from the factory default
+///
+/// Carries the VLANs with their interfaces and DHCP ranges; firewall rules
+/// are only part of the JSON and protobuf encodings.
+#[derive(Debug, Clone, Copy)]
+pub struct XmlEncoder {
+    /// Number of the first `opt` interface
+    pub opt_counter: u16,
+}
+
+impl Default for XmlEncoder {
+    fn default() -> Self {
+        Self { opt_counter: 6 }
+    }
+}
+
+impl Encoder for XmlEncoder {
+    fn name(&self) -> &'static str {
+        "xml"
+    }
+
+    fn extension(&self) -> &'static str {
+        "xml"
+    }
+
+    fn encode(&self, dataset: &Dataset) -> Result<Vec<u8>> {
+        Ok(config_from_default(&dataset.vlans, self.opt_counter, None)?.into_bytes())
+    }
+}
+
+/// Pretty-printed JSON of the dataset
+#[derive(Debug, Clone, Copy, Default)]
+pub struct JsonEncoder;
+
+impl Encoder for JsonEncoder {
+    fn name(&self) -> &'static str {
+        "json"
+    }
+
+    fn extension(&self) -> &'static str {
+        "json"
+    }
+
+    fn encode(&self, dataset: &Dataset) -> Result<Vec<u8>> {
+        let mut json = serde_json::to_vec_pretty(dataset)
+            .map_err(|e| ConfigError::config(format!("Failed to encode dataset as JSON: {e}")))?;
+        json.push(b'\n');
+        Ok(json)
+    }
+}
+
+/// Protobuf `Dataset` message as described by [`DATASET_PROTO`]
+#[derive(Debug, Clone, Copy, Default)]
+pub struct ProtobufEncoder;
+
+impl Encoder for ProtobufEncoder {
+    fn name(&self) -> &'static str {
+        "protobuf"
+    }
+
+    fn extension(&self) -> &'static str {
+        "pb"
+    }
+
+    fn is_experimental(&self) -> bool {
+        true
+    }
+
+    fn encode(&self, dataset: &Dataset) -> Result<Vec<u8>> {
+        let mut out = Vec::new();
+        for vlan in &dataset.vlans {
+            let mut message = Vec::new();
+            put_uint(&mut message, 1, u64::from(vlan.vlan_id));
+            put_string(&mut message, 2, &vlan.ip_network);
+            put_string(&mut message, 3, &vlan.description);
+            put_uint(&mut message, 4, u64::from(vlan.wan_assignment));
+            put_bytes(&mut out, 1, &message);
+        }
+        for rule in &dataset.firewall_rules {
+            let mut message = Vec::new();
+            put_string(&mut message, 1, &rule.rule_id);
+            put_string(&mut message, 2, &rule.source);
+            put_string(&mut message, 3, &rule.destination);
+            put_string(&mut message, 4, &rule.protocol);
+            put_string(&mut message, 5, &rule.ports);
+            put_string(&mut message, 6, &rule.action);
+            put_string(&mut message, 7, &rule.direction);
+            put_string(&mut message, 8, &rule.description);
+            put_uint(&mut message, 9, u64::from(rule.log));
+            if let Some(vlan_id) = rule.vlan_id {
+                // Explicit presence: written even when zero
+                put_key(&mut message, 10, WIRE_VARINT);
+                put_varint(&mut message, u64::from(vlan_id));
+            }
+            put_uint(&mut message, 11, u64::from(rule.priority));
+            put_string(&mut message, 12, &rule.interface);
+            put_bytes(&mut out, 2, &message);
+        }
+        Ok(out)
+    }
+}
+
+const WIRE_VARINT: u64 = 0;
+const WIRE_LEN: u64 = 2;
+
+fn put_varint(out: &mut Vec<u8>, mut value: u64) {
+    while value >= 0x80 {
+        out.push((value as u8) | 0x80);
+        value >>= 7;
+    }
+    out.push(value as u8);
+}
+
+fn put_key(out: &mut Vec<u8>, field: u64, wire_type: u64) {
+    put_varint(out, (field << 3) | wire_type);
+}
+
+/// Scalar field; proto3 leaves out zero values
+fn put_uint(out: &mut Vec<u8>, field: u64, value: u64) {
+    if value != 0 {
+        put_key(out, field, WIRE_VARINT);
+        put_varint(out, value);
+    }
+}
+
+/// String field; proto3 leaves out empty strings
+fn put_string(out: &mut Vec<u8>, field: u64, value: &str) {
+    if !value.is_empty() {
+        put_bytes(out, field, value.as_bytes());
+    }
+}
+
+fn put_bytes(out: &mut Vec<u8>, field: u64, value: &[u8]) {
+    put_key(out, field, WIRE_LEN);
+    put_varint(out, value.len() as u64);
+    out.extend_from_slice(value);
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn dataset() -> Dataset {
+        Dataset {
+            vlans: vec![VlanConfig::new(300, "10.1.2.x".into(), "Sales".into(), 1).unwrap()],
+            firewall_rules: Vec::new(),
+        }
+    }
+
+    #[test]
+    fn test_default_registry_and_replacement() {
+        let mut registry = EncoderRegistry::default();
+        assert_eq!(registry.names(), vec!["xml", "json", "protobuf"]);
+        assert!(
+            registry
+                .require("yaml")
+                .unwrap_err()
+                .to_string()
+                .contains("xml, json")
+        );
+
+        let previous = registry.register(Box::new(XmlEncoder { opt_counter: 10 }));
+        assert_eq!(previous.unwrap().name(), "xml");
+        assert_eq!(registry.names().len(), 3);
+        let xml = registry.get("xml").unwrap().encode(&dataset()).unwrap();
+        assert!(String::from_utf8(xml).unwrap().contains("<opt10>"));
+    }
+
+    #[test]
+    fn test_protobuf_wire_format() {
+        let encoded = ProtobufEncoder.encode(&dataset()).unwrap();
+        let mut expected = vec![0x0A, 22, 0x08, 0xAC, 0x02, 0x12, 8];
+        expected.extend_from_slice(b"10.1.2.x");
+        expected.extend_from_slice(&[0x1A, 5]);
+        expected.extend_from_slice(b"Sales");
+        expected.extend_from_slice(&[0x20, 1]);
+        assert_eq!(encoded, expected);
+        assert!(
+            ProtobufEncoder
+                .encode(&Dataset::default())
+                .unwrap()
+                .is_empty()
+        );
+    }
+
+    #[test]
+    fn test_json_roundtrip() {
+        let json = JsonEncoder.encode(&dataset()).unwrap();
+        let back: Dataset = serde_json::from_slice(&json).unwrap();
+        assert_eq!(back, dataset());
+    }
+}
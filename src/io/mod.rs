@@ -1,3 +1,8 @@
 //! Input/output handling for CSV and other formats
 
+pub mod backup;
 pub mod csv;
+pub mod encode;
+pub mod previous;
+pub mod report;
+pub mod signing;
@@ -0,0 +1,417 @@
+//! Loading of previously generated configurations
+//!
+//! Used by `--minimize-diff` so that a re-run can reproduce the unchanged part
+//! of an earlier scenario exactly. A previous run can be supplied as the CSV it
+//! produced, a single XML file, or a directory of generated XML files, each of
+//! which may be an encrypted backup.
+
+use crate::Result;
+use crate::generator::VlanConfig;
+use crate::io::backup::read_config_content;
+use crate::io::csv::read_csv;
+use crate::model::ConfigError;
+use quick_xml::Reader;
+use quick_xml::events::{BytesStart, Event};
+use std::collections::{HashMap, HashSet};
+use std::fs;
+use std::net::Ipv4Addr;
+use std::path::Path;
+
+/// Load VLAN configurations from a previous CSV file, XML file, or XML directory
+///
+/// Encrypted XML outputs are decrypted with `passphrase` first.
+pub fn load_previous_configs<P: AsRef<Path>>(
+    path: P,
+    passphrase: Option<&str>,
+) -> Result<Vec<VlanConfig>> {
+    let path = path.as_ref();
+
+    if !path.exists() {
+        return Err(ConfigError::ConfigNotFound {
+            path: path.display().to_string(),
+        });
+    }
+
+    let configs = if path.is_dir() {
+        load_previous_directory(path, passphrase)?
+    } else {
+        match path.extension().and_then(|ext| ext.to_str()) {
+            Some(ext) if ext.eq_ignore_ascii_case("csv") => read_csv(path)?,
+            _ => load_previous_xml(path, passphrase)?,
+        }
+    };
+
+    if configs.is_empty() {
+        return Err(ConfigError::validation(format!(
+            "No VLAN configurations found in previous output '{}'",
+            path.display()
+        )));
+    }
+
+    Ok(dedup_by_vlan_id(configs))
+}
+
+/// Load every XML file in a directory, in file name order
+fn load_previous_directory(dir: &Path, passphrase: Option<&str>) -> Result<Vec<VlanConfig>> {
+    let mut files: Vec<_> = fs::read_dir(dir)?
+        .filter_map(|entry| entry.ok().map(|e| e.path()))
+        .filter(|p| {
+            p.extension()
+                .and_then(|ext| ext.to_str())
+                .is_some_and(|ext| ext.eq_ignore_ascii_case("xml"))
+        })
+        .collect();
+    files.sort();
+
+    let mut configs = Vec::new();
+    for file in files {
+        configs.extend(load_previous_xml(&file, passphrase)?);
+    }
+    Ok(configs)
+}
+
+/// Read one XML output, decrypting it when it is an encrypted backup
+fn load_previous_xml(path: &Path, passphrase: Option<&str>) -> Result<Vec<VlanConfig>> {
+    let content = read_config_content(fs::read_to_string(path)?, passphrase)?;
+    parse_vlans_from_xml(&content)
+}
+
+/// Extract VLAN configurations from `<vlan>` elements in an XML document
+///
+/// All layouts the generator writes are understood:
+///
+/// - factory-default output, where a `<vlan>` has a `<tag>` and a `<vlanif>`
+///   whose interface under `/opnsense/interfaces` carries the gateway address
+/// - streaming output, `<vlan id=".." wan=".." description="..">` with a
+///   `<network>` child
+/// - template output with `vlanid`/`tag`, `subnet`, `descr`, and `wan` children,
+///   or the VLAN ID as an `id` attribute and the description as text
+///
+/// Elements without a VLAN ID or a network are skipped.
+pub fn parse_vlans_from_xml(content: &str) -> Result<Vec<VlanConfig>> {
+    // Text is not trimmed here: entity references split text into several
+    // events, and trimming each piece would drop the spaces around them
+    let mut reader = Reader::from_str(content);
+
+    let mut path: Vec<String> = Vec::new();
+    let mut found = Vec::new();
+    // The <vlan> element being read and its depth in `path`
+    let mut vlan: Option<(usize, VlanFields)> = None;
+    let mut interface = InterfaceFields::default();
+    // Interface device name to gateway address
+    let mut addresses = HashMap::new();
+
+    loop {
+        match reader.read_event() {
+            Ok(Event::Start(start)) => {
+                let name = String::from_utf8_lossy(start.name().as_ref()).to_string();
+                path.push(name);
+                if vlan.is_none() && path.last().is_some_and(|name| name == "vlan") {
+                    vlan = Some((path.len(), VlanFields::from_attributes(&start)?));
+                } else if is_interface(&path) {
+                    interface = InterfaceFields::default();
+                }
+            }
+            Ok(Event::Empty(start)) => {
+                if vlan.is_none() && start.name().as_ref() == b"vlan" {
+                    found.push(VlanFields::from_attributes(&start)?);
+                }
+            }
+            Ok(Event::End(_)) => {
+                if vlan.as_ref().is_some_and(|(depth, _)| *depth == path.len()) {
+                    found.extend(vlan.take().map(|(_, fields)| fields));
+                } else if is_interface(&path) {
+                    let interface = std::mem::take(&mut interface);
+                    addresses.insert(interface.device.trim().to_string(), interface.address);
+                }
+                path.pop();
+            }
+            Ok(Event::Text(text)) => {
+                let text = String::from_utf8_lossy(&text);
+                append_text(&path, &mut vlan, &mut interface, &text);
+            }
+            Ok(Event::CData(data)) => {
+                let data = String::from_utf8_lossy(&data);
+                append_text(&path, &mut vlan, &mut interface, &data);
+            }
+            Ok(Event::GeneralRef(entity)) => {
+                let resolved = resolve_entity(&String::from_utf8_lossy(&entity));
+                append_text(&path, &mut vlan, &mut interface, &resolved);
+            }
+            Ok(Event::Eof) => break,
+            Ok(_) => {}
+            Err(e) => {
+                return Err(ConfigError::xml_event_parsing(format!(
+                    "Failed to parse previous XML at position {}: {e}",
+                    reader.buffer_position()
+                )));
+            }
+        }
+    }
+
+    Ok(found
+        .iter()
+        .filter_map(|fields| fields.to_config(&addresses))
+        .collect())
+}
+
+/// Whether `path` is an interface entry such as `/opnsense/interfaces/opt6`
+fn is_interface(path: &[String]) -> bool {
+    matches!(path, [root, section, name] if root == "opnsense" && section == "interfaces" && name != "vlan")
+}
+
+/// Route text at `path` to the VLAN or interface being read
+fn append_text(
+    path: &[String],
+    vlan: &mut Option<(usize, VlanFields)>,
+    interface: &mut InterfaceFields,
+    text: &str,
+) {
+    if let Some((depth, fields)) = vlan {
+        if path.len() == *depth {
+            fields.text.push_str(text);
+        } else if path.len() == *depth + 1
+            && let Some(field) = path.last()
+        {
+            fields.append(field, text);
+        }
+    } else if path.len() == 4 && is_interface(&path[..3]) {
+        match path[3].as_str() {
+            "if" => interface.device.push_str(text),
+            "ipaddr" => interface.address.push_str(text),
+            _ => {}
+        }
+    }
+}
+
+/// Collected values of a `<vlan>` element
+#[derive(Default)]
+struct VlanFields {
+    vlan_id: String,
+    subnet: String,
+    description: String,
+    wan: String,
+    /// Device name of the VLAN interface, used to find its gateway
+    device: String,
+    /// Text directly inside the element, a description in template output
+    text: String,
+}
+
+impl VlanFields {
+    /// Start from the `id`, `wan`, `description`, and `network` attributes
+    fn from_attributes(start: &BytesStart) -> Result<Self> {
+        let mut fields = Self::default();
+        for attribute in start.attributes().flatten() {
+            let value = attribute
+                .unescape_value()
+                .map_err(|e| ConfigError::xml_event_parsing(e.to_string()))?;
+            let key = match attribute.key.as_ref() {
+                b"id" => "vlanid",
+                b"description" => "descr",
+                key => std::str::from_utf8(key).unwrap_or_default(),
+            };
+            fields.append(key, &value);
+        }
+        Ok(fields)
+    }
+
+    fn append(&mut self, field: &str, value: &str) {
+        let target = match field {
+            "vlanid" | "tag" => &mut self.vlan_id,
+            "subnet" | "network" => &mut self.subnet,
+            "descr" => &mut self.description,
+            "wan" => &mut self.wan,
+            "vlanif" => &mut self.device,
+            _ => return,
+        };
+        target.push_str(value);
+    }
+
+    /// Build the configuration, taking the network from the gateway address
+    /// of the VLAN's interface when the element has none
+    fn to_config(&self, addresses: &HashMap<String, String>) -> Option<VlanConfig> {
+        let vlan_id = self.vlan_id.trim().parse().ok()?;
+        let wan = self.wan.trim().parse().unwrap_or(1);
+        let subnet = match self.subnet.trim() {
+            "" => network_from_gateway(addresses.get(self.device.trim())?)?,
+            subnet => subnet.to_string(),
+        };
+        let description = match self.description.trim() {
+            "" => self.text.trim(),
+            description => description,
+        };
+        VlanConfig::new(vlan_id, subnet, description.to_string(), wan).ok()
+    }
+}
+
+/// Child values of an interface entry
+#[derive(Default)]
+struct InterfaceFields {
+    device: String,
+    address: String,
+}
+
+/// Turn a gateway address like `10.1.2.1` into the network `10.1.2.x`
+fn network_from_gateway(gateway: &str) -> Option<String> {
+    let address: Ipv4Addr = gateway.trim().parse().ok()?;
+    let [a, b, c, _] = address.octets();
+    Some(format!("{a}.{b}.{c}.x"))
+}
+
+/// Resolve a predefined or numeric XML entity name (without `&` and `;`)
+pub(crate) fn resolve_entity(name: &str) -> String {
+    match name {
+        "amp" => "&".to_string(),
+        "lt" => "<".to_string(),
+        "gt" => ">".to_string(),
+        "quot" => "\"".to_string(),
+        "apos" => "'".to_string(),
+        _ => {
+            let code = if let Some(hex) = name.strip_prefix("#x") {
+                u32::from_str_radix(hex, 16).ok()
+            } else if let Some(dec) = name.strip_prefix('#') {
+                dec.parse().ok()
+            } else {
+                None
+            };
+            code.and_then(char::from_u32)
+                .map(|c| c.to_string())
+                .unwrap_or_else(|| format!("&{name};"))
+        }
+    }
+}
+
+/// Keep the first occurrence of each VLAN ID, preserving order
+fn dedup_by_vlan_id(configs: Vec<VlanConfig>) -> Vec<VlanConfig> {
+    let mut seen = HashSet::new();
+    configs
+        .into_iter()
+        .filter(|c| seen.insert(c.vlan_id))
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::io::backup::encrypt_config;
+    use crate::io::csv::write_csv;
+    use crate::xml::config_from_default;
+    use tempfile::TempDir;
+
+    const PREVIOUS_XML: &str = r#"<?xml version="1.0"?>
+<opnsense>
+  <vlans>
+    <vlan>
+      <vlanid>100</vlanid>
+      <descr>Sales &amp; Marketing VLAN 100</descr>
+      <subnet>10.1.2.x</subnet>
+      <dhcp><gateway>10.1.2.1</gateway></dhcp>
+    </vlan>
+    <vlan>
+      <tag>200</tag>
+      <descr>IT VLAN 200</descr>
+      <subnet>10.3.4.x</subnet>
+      <wan>2</wan>
+    </vlan>
+    <vlan>
+      <tag>300</tag>
+      <descr>No subnet, skipped</descr>
+    </vlan>
+  </vlans>
+</opnsense>"#;
+
+    #[test]
+    fn test_parse_vlans_from_xml() {
+        let configs = parse_vlans_from_xml(PREVIOUS_XML).unwrap();
+        assert_eq!(configs.len(), 2);
+        assert_eq!(configs[0].vlan_id, 100);
+        assert_eq!(configs[0].description, "Sales & Marketing VLAN 100");
+        assert_eq!(configs[0].wan_assignment, 1);
+        assert_eq!(configs[1].vlan_id, 200);
+        assert_eq!(configs[1].ip_network, "10.3.4.x");
+        assert_eq!(configs[1].wan_assignment, 2);
+    }
+
+    #[test]
+    fn test_parse_vlans_from_factory_default_output() {
+        let configs = vec![
+            VlanConfig::new(
+                100,
+                "10.1.2.x".to_string(),
+                "Sales & Ops VLAN 100".to_string(),
+                1,
+            )
+            .unwrap(),
+            VlanConfig::new(250, "172.16.9.x".to_string(), "IT VLAN 250".to_string(), 1).unwrap(),
+        ];
+        let xml = config_from_default(&configs, 6, None).unwrap();
+        assert_eq!(parse_vlans_from_xml(&xml).unwrap(), configs);
+    }
+
+    #[test]
+    fn test_parse_vlans_from_attributes() {
+        let xml = r#"<opnsense><interfaces>
+    <vlan id="300" wan="2" description="Lab &amp; Test">
+      <network>10.9.8.x</network>
+    </vlan>
+  </interfaces></opnsense>"#;
+        let configs = parse_vlans_from_xml(xml).unwrap();
+        assert_eq!(
+            configs,
+            vec![
+                VlanConfig::new(300, "10.9.8.x".to_string(), "Lab & Test".to_string(), 2).unwrap()
+            ]
+        );
+    }
+
+    #[test]
+    fn test_load_previous_from_encrypted_xml() {
+        let dir = TempDir::new().unwrap();
+        let path = dir.path().join("firewall_1.xml");
+        let configs = vec![
+            VlanConfig::new(100, "10.1.2.x".to_string(), "A VLAN 100".to_string(), 1).unwrap(),
+        ];
+        let xml = config_from_default(&configs, 6, None).unwrap();
+        fs::write(&path, encrypt_config(&xml, "secret", Some(7), 0).unwrap()).unwrap();
+
+        assert_eq!(
+            load_previous_configs(&path, Some("secret")).unwrap(),
+            configs
+        );
+        assert!(load_previous_configs(&path, None).is_err());
+    }
+
+    #[test]
+    fn test_load_previous_from_csv() {
+        let dir = TempDir::new().unwrap();
+        let path = dir.path().join("previous.csv");
+        let configs = vec![
+            VlanConfig::new(100, "10.1.2.x".to_string(), "A VLAN 100".to_string(), 1).unwrap(),
+            VlanConfig::new(200, "10.3.4.x".to_string(), "B VLAN 200".to_string(), 3).unwrap(),
+        ];
+        write_csv(&configs, &path).unwrap();
+
+        assert_eq!(load_previous_configs(&path, None).unwrap(), configs);
+    }
+
+    #[test]
+    fn test_load_previous_from_directory_dedups() {
+        let dir = TempDir::new().unwrap();
+        fs::write(dir.path().join("a.xml"), PREVIOUS_XML).unwrap();
+        fs::write(dir.path().join("b.xml"), PREVIOUS_XML).unwrap();
+        fs::write(dir.path().join("notes.txt"), "ignored").unwrap();
+
+        let configs = load_previous_configs(dir.path(), None).unwrap();
+        assert_eq!(configs.len(), 2);
+    }
+
+    #[test]
+    fn test_load_previous_errors() {
+        let dir = TempDir::new().unwrap();
+        assert!(load_previous_configs(dir.path().join("missing.xml"), None).is_err());
+
+        let empty = dir.path().join("empty.xml");
+        fs::write(&empty, "<opnsense/>").unwrap();
+        assert!(load_previous_configs(&empty, None).is_err());
+    }
+}
@@ -0,0 +1,192 @@
+//! Shared rendering layer for inspection output
+//!
+//! Inspection commands build a [`Report`] of named columns and string cells and
+//! hand it to [`Report::render`], so every command supports the same
+//! `--format table|csv|json` choices with identical conventions: CSV has a
+//! header row, JSON is an array of objects keyed by column name, and the table
+//! form is aligned plain text for humans.
+
+use crate::Result;
+use crate::model::ConfigError;
+use clap::ValueEnum;
+use serde_json::{Map, Value};
+
+/// Output format for inspection reports
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq, ValueEnum)]
+pub enum ReportFormat {
+    /// Aligned plain-text table
+    #[default]
+    Table,
+    /// Comma-separated values with a header row
+    Csv,
+    /// JSON array of objects keyed by column name
+    Json,
+}
+
+/// Tabular report rendered in any [`ReportFormat`]
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct Report {
+    columns: Vec<String>,
+    rows: Vec<Vec<String>>,
+}
+
+impl Report {
+    /// Create an empty report with the given column names
+    pub fn new<I, S>(columns: I) -> Self
+    where
+        I: IntoIterator<Item = S>,
+        S: Into<String>,
+    {
+        Self {
+            columns: columns.into_iter().map(Into::into).collect(),
+            rows: Vec::new(),
+        }
+    }
+
+    /// Append a row; it must have exactly one cell per column
+    pub fn push_row<I, S>(&mut self, row: I) -> Result<()>
+    where
+        I: IntoIterator<Item = S>,
+        S: ToString,
+    {
+        let row: Vec<String> = row.into_iter().map(|cell| cell.to_string()).collect();
+        if row.len() != self.columns.len() {
+            return Err(ConfigError::validation(format!(
+                "Report row has {} cells but the report has {} columns",
+                row.len(),
+                self.columns.len()
+            )));
+        }
+        self.rows.push(row);
+        Ok(())
+    }
+
+    /// Column names
+    pub fn columns(&self) -> &[String] {
+        &self.columns
+    }
+
+    /// Rows, in insertion order
+    pub fn rows(&self) -> &[Vec<String>] {
+        &self.rows
+    }
+
+    /// Whether the report has no rows
+    pub fn is_empty(&self) -> bool {
+        self.rows.is_empty()
+    }
+
+    /// Render the report in the requested format
+    pub fn render(&self, format: ReportFormat) -> Result<String> {
+        match format {
+            ReportFormat::Table => Ok(self.render_table()),
+            ReportFormat::Csv => self.render_csv(),
+            ReportFormat::Json => self.render_json(),
+        }
+    }
+
+    fn render_table(&self) -> String {
+        let mut widths: Vec<usize> = self.columns.iter().map(|c| c.chars().count()).collect();
+        for row in &self.rows {
+            for (width, cell) in widths.iter_mut().zip(row) {
+                *width = (*width).max(cell.chars().count());
+            }
+        }
+
+        let format_line = |cells: &[String]| -> String {
+            let padded: Vec<String> = cells
+                .iter()
+                .zip(&widths)
+                .map(|(cell, width)| format!("{cell:<width$}"))
+                .collect();
+            padded.join("  ").trim_end().to_string()
+        };
+
+        let mut out = format_line(&self.columns);
+        out.push('\n');
+        let rule: Vec<String> = widths.iter().map(|w| "-".repeat(*w)).collect();
+        out.push_str(&rule.join("  "));
+        out.push('\n');
+        for row in &self.rows {
+            out.push_str(&format_line(row));
+            out.push('\n');
+        }
+        out
+    }
+
+    fn render_csv(&self) -> Result<String> {
+        let mut writer = csv::Writer::from_writer(Vec::new());
+        writer.write_record(&self.columns)?;
+        for row in &self.rows {
+            writer.write_record(row)?;
+        }
+        let bytes = writer
+            .into_inner()
+            .map_err(|e| ConfigError::config(format!("Failed to flush CSV report: {e}")))?;
+        String::from_utf8(bytes)
+            .map_err(|e| ConfigError::config(format!("CSV report is not valid UTF-8: {e}")))
+    }
+
+    fn render_json(&self) -> Result<String> {
+        let records: Vec<Value> = self
+            .rows
+            .iter()
+            .map(|row| {
+                let object: Map<String, Value> = self
+                    .columns
+                    .iter()
+                    .cloned()
+                    .zip(row.iter().map(|cell| Value::String(cell.clone())))
+                    .collect();
+                Value::Object(object)
+            })
+            .collect();
+        let mut json = serde_json::to_string_pretty(&records)?;
+        json.push('\n');
+        Ok(json)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn sample() -> Report {
+        let mut report = Report::new(["metric", "value"]);
+        report.push_row(["valid configurations", "12"]).unwrap();
+        report.push_row(["errors", "0"]).unwrap();
+        report
+    }
+
+    #[test]
+    fn test_render_table_aligns_columns() {
+        let table = sample().render(ReportFormat::Table).unwrap();
+        let lines: Vec<&str> = table.lines().collect();
+        assert_eq!(lines[0], "metric                value");
+        assert_eq!(lines[1], "--------------------  -----");
+        assert_eq!(lines[3], "errors                0");
+    }
+
+    #[test]
+    fn test_render_csv_quotes_and_headers() {
+        let mut report = Report::new(["name", "note"]);
+        report.push_row(["a", "x, y"]).unwrap();
+        let csv = report.render(ReportFormat::Csv).unwrap();
+        assert_eq!(csv, "name,note\na,\"x, y\"\n");
+    }
+
+    #[test]
+    fn test_render_json_objects() {
+        let json = sample().render(ReportFormat::Json).unwrap();
+        let parsed: Value = serde_json::from_str(&json).unwrap();
+        assert_eq!(parsed[0]["metric"], "valid configurations");
+        assert_eq!(parsed[1]["value"], "0");
+    }
+
+    #[test]
+    fn test_push_row_rejects_wrong_width() {
+        let mut report = Report::new(["a", "b"]);
+        assert!(report.push_row(["only one"]).is_err());
+        assert!(report.is_empty());
+    }
+}
@@ -0,0 +1,161 @@
+//! Detached signatures for generated manifests
+//!
+//! Where fixtures gate release pipelines, consumers need to know that a pack
+//! really came from a given faker version and set of profiles. Signing the
+//! manifest, which records both and the SHA-256 of every file, attests the
+//! whole pack. Signatures are made by the standard tools, `ssh-keygen -Y
+//! sign` for SSH keys and `cosign sign-blob` for cosign keys, so consumers
+//! verify them with the same tools and no faker install.
+
+use crate::Result;
+use crate::model::ConfigError;
+use clap::ValueEnum;
+use std::io::ErrorKind;
+use std::path::{Path, PathBuf};
+use std::process::Command;
+
+/// Namespace of SSH signatures, so they cannot be replayed as e.g. git signatures
+pub const SIGNATURE_NAMESPACE: &str = "opnsense-config-faker";
+
+/// Kind of signing key
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq, ValueEnum)]
+pub enum Signer {
+    /// SSH key, signed with `ssh-keygen -Y sign`
+    #[default]
+    Ssh,
+    /// cosign key pair, signed with `cosign sign-blob`
+    Cosign,
+}
+
+impl Signer {
+    /// Program that makes the signature
+    pub fn program(self) -> &'static str {
+        match self {
+            Signer::Ssh => "ssh-keygen",
+            Signer::Cosign => "cosign",
+        }
+    }
+
+    /// Command signing `file` with `key`; the signature goes to [`signature_path`]
+    pub fn command(self, key: &Path, file: &Path) -> Command {
+        let mut command = Command::new(self.program());
+        match self {
+            Signer::Ssh => {
+                command
+                    .args(["-Y", "sign", "-n", SIGNATURE_NAMESPACE, "-f"])
+                    .arg(key)
+                    .arg(file);
+            }
+            // Signing must work offline, so nothing is uploaded to the Rekor
+            // transparency log
+            Signer::Cosign => {
+                command
+                    .args(["sign-blob", "--yes", "--tlog-upload=false", "--key"])
+                    .arg(key)
+                    .arg("--output-signature")
+                    .arg(signature_path(file))
+                    .arg(file);
+            }
+        }
+        command
+    }
+
+    /// Command consumers run to verify the signature of `file`
+    ///
+    /// `file` is given as it appears to the consumer, usually relative to
+    /// the pack root.
+    pub fn verify_hint(self, file: &str) -> String {
+        match self {
+            Signer::Ssh => format!(
+                "ssh-keygen -Y verify -f allowed_signers -I <signer> -n {SIGNATURE_NAMESPACE} \
+                 -s {file}.sig < {file}"
+            ),
+            Signer::Cosign => {
+                format!(
+                    "cosign verify-blob --key cosign.pub --insecure-ignore-tlog=true \
+                     --signature {file}.sig {file}"
+                )
+            }
+        }
+    }
+}
+
+/// Detached signature written next to `file`
+pub fn signature_path(file: &Path) -> PathBuf {
+    let mut name = file.as_os_str().to_os_string();
+    name.push(".sig");
+    PathBuf::from(name)
+}
+
+/// Sign `file` with `key` and return the signature path
+pub fn sign_file(signer: Signer, key: &Path, file: &Path) -> Result<PathBuf> {
+    if !key.exists() {
+        return Err(ConfigError::invalid_parameter(
+            "sign-key",
+            format!("Signing key {} does not exist", key.display()),
+        ));
+    }
+    let output = signer.command(key, file).output().map_err(|e| {
+        if e.kind() == ErrorKind::NotFound {
+            ConfigError::config(format!(
+                "{} is required for signing but was not found",
+                signer.program()
+            ))
+        } else {
+            e.into()
+        }
+    })?;
+    if !output.status.success() {
+        return Err(ConfigError::config(format!(
+            "{} failed to sign {}: {}",
+            signer.program(),
+            file.display(),
+            String::from_utf8_lossy(&output.stderr).trim()
+        )));
+    }
+    Ok(signature_path(file))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_sign_commands() {
+        let key = Path::new("keys/release");
+        let file = Path::new("pack/manifest.json");
+        assert_eq!(signature_path(file), Path::new("pack/manifest.json.sig"));
+
+        let ssh = Signer::Ssh.command(key, file);
+        assert_eq!(ssh.get_program(), "ssh-keygen");
+        let args: Vec<_> = ssh.get_args().collect();
+        assert_eq!(
+            args,
+            [
+                "-Y",
+                "sign",
+                "-n",
+                SIGNATURE_NAMESPACE,
+                "-f",
+                "keys/release",
+                "pack/manifest.json"
+            ]
+        );
+
+        let cosign = Signer::Cosign.command(key, file);
+        let args: Vec<_> = cosign.get_args().collect();
+        assert_eq!(args[2], "--tlog-upload=false");
+        assert_eq!(args[5], "--output-signature");
+        assert_eq!(args[6], "pack/manifest.json.sig");
+    }
+
+    #[test]
+    fn test_missing_key_is_reported() {
+        let err = sign_file(
+            Signer::Ssh,
+            Path::new("no/such/key"),
+            Path::new("manifest.json"),
+        );
+        assert!(err.unwrap_err().to_string().contains("no/such/key"));
+    }
+}
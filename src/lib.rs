@@ -30,10 +30,13 @@
 //! # Ok::<(), Box<dyn std::error::Error>>(())
 //! ```
 
+pub mod apply;
 pub mod cli;
 pub mod generator;
 pub mod io;
 pub mod model;
+pub mod query;
+pub mod simulate;
 pub mod utils;
 pub mod validate;
 pub mod xml;
@@ -6,32 +6,115 @@
 
 use anyhow::{Context, Result};
 use clap::Parser;
-use opnsense_config_faker::cli::{Cli, Commands};
+use opnsense_config_faker::cli::i18n::{Msg, tr};
+use opnsense_config_faker::cli::{Cli, Commands, flags};
 
 fn main() -> Result<()> {
-    let cli = Cli::parse();
+    // Accept renamed flags under their old names until the shims are removed
+    let (args, deprecations) = flags::apply_shims(std::env::args_os());
+    let cli = Cli::parse_from(args);
+
+    // Resolve theme, color, language, and progress settings before anything is printed
+    opnsense_config_faker::cli::theme::init(cli.global.theme, cli.global.no_color);
+    opnsense_config_faker::cli::i18n::init(cli.global.lang);
+    opnsense_config_faker::cli::progress::init(cli.global.progress);
+
+    flags::report(&deprecations, cli.global.strict_flags)
+        .context("Deprecated flags used with --strict-flags")?;
+
+    // Remove temporary workspaces if the run is interrupted
+    opnsense_config_faker::utils::workspace::install_signal_cleanup()
+        .context("Failed to set up workspace cleanup")?;
 
     // Execute command with rich context
     match cli.command {
         Commands::Generate(args) => {
             opnsense_config_faker::cli::commands::generate::execute_with_global(args, &cli.global)
-                .context("Failed to generate configurations")?
+                .context(tr(Msg::GenerateFailed))?
         }
         Commands::Completions { shell } => {
             opnsense_config_faker::cli::commands::completions::execute(shell)
-                .context("Failed to generate shell completions")?
+                .context(tr(Msg::CompletionsFailed))?
         }
         Commands::Validate(args) => {
             opnsense_config_faker::cli::commands::validate::execute_with_global(args, &cli.global)
-                .context("Failed to validate configurations")?
+                .context(tr(Msg::ValidateFailed))?
+        }
+        Commands::InitFixtures(args) => {
+            opnsense_config_faker::cli::commands::init_fixtures::execute(args, &cli.global)
+                .context(tr(Msg::InitFixturesFailed))?
+        }
+        Commands::ReproCheck(args) => {
+            opnsense_config_faker::cli::commands::repro_check::execute(args, &cli.global)
+                .context(tr(Msg::ReproCheckFailed))?
+        }
+        Commands::Query(args) => {
+            opnsense_config_faker::cli::commands::query::execute(args, &cli.global)
+                .context(tr(Msg::QueryFailed))?
+        }
+        Commands::Summary(args) => {
+            opnsense_config_faker::cli::commands::summary::execute(args, &cli.global)
+                .context(tr(Msg::SummaryFailed))?
+        }
+        Commands::Extract(args) => {
+            opnsense_config_faker::cli::commands::extract::execute(args, &cli.global)
+                .context(tr(Msg::ExtractFailed))?
+        }
+        Commands::Soak(args) => {
+            opnsense_config_faker::cli::commands::soak::execute(args, &cli.global)
+                .context(tr(Msg::SoakFailed))?
+        }
+        Commands::Diff(args) => {
+            opnsense_config_faker::cli::commands::diff::execute(args, &cli.global)
+                .context(tr(Msg::DiffFailed))?
+        }
+        Commands::Compose(args) => {
+            opnsense_config_faker::cli::commands::compose::execute(args, &cli.global)
+                .context(tr(Msg::ComposeFailed))?
+        }
+        Commands::Schema(args) => {
+            opnsense_config_faker::cli::commands::schema::execute(args, &cli.global)
+                .context(tr(Msg::SchemaFailed))?
+        }
+        Commands::View(args) => {
+            opnsense_config_faker::cli::commands::view::execute(args, &cli.global)
+                .context(tr(Msg::ViewFailed))?
+        }
+        Commands::Fuzz(args) => {
+            opnsense_config_faker::cli::commands::fuzz::execute(args, &cli.global)
+                .context(tr(Msg::FuzzFailed))?
+        }
+        Commands::ReleasePack(args) => {
+            opnsense_config_faker::cli::commands::release_pack::execute(args, &cli.global)
+                .context(tr(Msg::ReleasePackFailed))?
+        }
+        Commands::Audit(args) => {
+            opnsense_config_faker::cli::commands::audit::execute(args, &cli.global)
+                .context(tr(Msg::AuditFailed))?
+        }
+        Commands::Simulate(args) => {
+            opnsense_config_faker::cli::commands::simulate::execute(args, &cli.global)
+                .context(tr(Msg::SimulateFailed))?
+        }
+        Commands::Export(args) => {
+            opnsense_config_faker::cli::commands::export::execute(args, &cli.global)
+                .context(tr(Msg::ExportFailed))?
+        }
+        Commands::Score(args) => {
+            opnsense_config_faker::cli::commands::score::execute(args, &cli.global)
+                .context(tr(Msg::ScoreFailed))?
+        }
+        Commands::Apply(args) => {
+            opnsense_config_faker::cli::commands::apply::execute(args, &cli.global)
+                .context(tr(Msg::ApplyFailed))?
         }
         Commands::Csv(args) => {
             opnsense_config_faker::cli::commands::deprecated::handle_deprecated_csv(args)
-                .context("Failed to process CSV command")?
+                .context(tr(Msg::CsvCommandFailed))?
         }
         Commands::Xml(args) => {
             opnsense_config_faker::cli::commands::deprecated::handle_deprecated_xml(args)
-                .context("Failed to process XML command")?
+                .context(tr(Msg::XmlCommandFailed))?
         }
     }
 
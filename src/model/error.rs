@@ -21,6 +21,10 @@ pub enum ConfigError {
     #[error("JSON operation failed: {0}")]
     Json(#[from] serde_json::Error),
 
+    /// YAML deserialization failed
+    #[error("YAML parsing failed: {0}")]
+    Yaml(#[from] serde_norway::Error),
+
     /// VLAN configuration generation failed
     #[error("VLAN generation failed: {message}")]
     VlanGeneration { message: String },
@@ -61,10 +65,28 @@ pub enum ConfigError {
     #[error("Invalid parameter '{parameter}': {reason}")]
     InvalidParameter { parameter: String, reason: String },
 
+    /// One or more generation options violate their constraints
+    #[error("Invalid options: {}", format_option_errors(errors))]
+    InvalidOptions {
+        errors: Vec<crate::model::options::OptionError>,
+    },
+
     /// Resource exhaustion (e.g., ran out of unique VLAN IDs)
     #[error("Resource exhaustion: {resource}")]
     ResourceExhausted { resource: String },
 
+    /// Encrypted backup processing failed
+    #[error("Encrypted backup error: {message}")]
+    Encryption { message: String },
+
+    /// Applying configuration to a firewall failed
+    #[error("Apply failed: {message}")]
+    Apply { message: String },
+
+    /// Query expression could not be parsed or evaluated
+    #[error("Invalid query: {message}")]
+    InvalidQuery { message: String },
+
     /// Generic configuration error
     #[error("Configuration error: {message}")]
     Config { message: String },
@@ -99,6 +121,27 @@ pub fn config<S: Into<String>>(message: S) -> Self {
         }
     }
 
+    /// Create a new encrypted backup error
+    pub fn encryption<S: Into<String>>(message: S) -> Self {
+        Self::Encryption {
+            message: message.into(),
+        }
+    }
+
+    /// Create a new apply error
+    pub fn apply<S: Into<String>>(message: S) -> Self {
+        Self::Apply {
+            message: message.into(),
+        }
+    }
+
+    /// Create a new invalid query error
+    pub fn invalid_query<S: Into<String>>(message: S) -> Self {
+        Self::InvalidQuery {
+            message: message.into(),
+        }
+    }
+
     /// Create a new invalid parameter error
     pub fn invalid_parameter<S: Into<String>, R: Into<String>>(parameter: S, reason: R) -> Self {
         Self::InvalidParameter {
@@ -107,6 +150,11 @@ pub fn invalid_parameter<S: Into<String>, R: Into<String>>(parameter: S, reason:
         }
     }
 
+    /// Create a new invalid options error
+    pub fn invalid_options(errors: Vec<crate::model::options::OptionError>) -> Self {
+        Self::InvalidOptions { errors }
+    }
+
     /// Create a new resource exhausted error
     pub fn resource_exhausted<S: Into<String>>(resource: S) -> Self {
         Self::ResourceExhausted {
@@ -145,3 +193,12 @@ pub fn xml_namespace<S: Into<String>>(message: S) -> Self {
         }
     }
 }
+
+/// Join option errors into a single line for display
+fn format_option_errors(errors: &[crate::model::options::OptionError]) -> String {
+    errors
+        .iter()
+        .map(ToString::to_string)
+        .collect::<Vec<_>>()
+        .join("; ")
+}
@@ -1,7 +1,12 @@
 //! Data models and structures for OPNsense configuration generation
 
 pub mod error;
+pub mod options;
+pub mod scenario;
+pub mod schema;
+pub mod snippet;
 pub mod vlan_error;
 
 pub use error::ConfigError;
+pub use options::{Constraint, GenerationOptions, OptionError};
 pub use vlan_error::{VlanError, VlanResult};
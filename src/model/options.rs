@@ -0,0 +1,922 @@
+//! Library-level validation of generation options
+//!
+//! Embedding applications build [`GenerationOptions`] and call
+//! [`GenerationOptions::validate`] before generating anything. Every violated
+//! rule is reported as an [`OptionError`] carrying the field, the constraint,
+//! and the provided value, so callers can render their own messages instead of
+//! parsing strings.
+
+use crate::generator::accounting::{MAX_ACCOUNTING_DAYS, MAX_PORTAL_TIMEOUT, PortalLimits};
+use crate::generator::alias::MAX_ALIAS_DEPTH;
+use crate::generator::carp::MAX_CARP_INCIDENTS;
+use crate::generator::dns::MAX_DNS_OVERRIDES;
+use crate::generator::feeds::MAX_THREAT_FEEDS;
+use crate::generator::link::MAX_LINK_INTERFACES;
+use crate::generator::{
+    DescriptionStyles, Flavor, LabelSelector, SectionBudgets, Target, UnsupportedPolicy,
+};
+use crate::io::encode::EncoderRegistry;
+use crate::model::ConfigError;
+use crate::model::scenario::ScenarioFormat;
+use clap::ValueEnum;
+use std::fmt;
+use std::path::PathBuf;
+
+/// Largest count accepted by the generator
+pub const MAX_COUNT: u16 = 10_000;
+
+/// Maximum number of unique VLAN IDs that can be generated
+/// VLAN IDs range from 10-4094, giving us 4085 unique values
+pub const MAX_UNIQUE_VLAN_IDS: u16 = 4085;
+
+/// Accepted firewall rule complexity levels
+const COMPLEXITY_LEVELS: &[&str] = &["basic", "intermediate", "advanced"];
+
+/// A rule an option value must satisfy
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum Constraint {
+    /// Value must lie within `min..=max`
+    Range { min: u64, max: u64 },
+    /// Value must not exceed `max`; `reason` explains where the limit comes from
+    AtMost { max: u64, reason: &'static str },
+    /// Value must be one of `allowed`
+    OneOf { allowed: Vec<&'static str> },
+    /// Value must match a syntax, e.g. a VLAN range specification
+    Format {
+        expected: &'static str,
+        detail: String,
+    },
+    /// Option must be set when `field` has `value`
+    RequiredWhen {
+        field: &'static str,
+        value: &'static str,
+    },
+    /// Option needs `field` to be set as well
+    Requires { field: &'static str },
+    /// Option cannot be combined with `field`
+    ConflictsWith { field: &'static str },
+    /// Option is not supported when `field` has `value`
+    UnsupportedWith {
+        field: &'static str,
+        value: &'static str,
+    },
+}
+
+impl fmt::Display for Constraint {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            Constraint::Range { min, max } => write!(f, "must be between {min} and {max}"),
+            Constraint::AtMost { max, reason } => write!(f, "must be at most {max} ({reason})"),
+            Constraint::OneOf { allowed } => write!(f, "must be one of: {}", allowed.join(", ")),
+            Constraint::Format { expected, detail } => {
+                write!(f, "must be {expected}: {detail}")
+            }
+            Constraint::RequiredWhen { field, value } => {
+                write!(f, "is required when {field} is {value}")
+            }
+            Constraint::Requires { field } => write!(f, "requires {field}"),
+            Constraint::ConflictsWith { field } => write!(f, "cannot be combined with {field}"),
+            Constraint::UnsupportedWith { field, value } => {
+                write!(f, "is not supported when {field} is {value}")
+            }
+        }
+    }
+}
+
+/// A single violated option rule
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct OptionError {
+    /// Option name as used in the public API (e.g. `count`)
+    pub field: &'static str,
+    /// Rule that was violated
+    pub constraint: Constraint,
+    /// Provided value, or `None` when the option was missing
+    pub value: Option<String>,
+}
+
+impl OptionError {
+    fn new(field: &'static str, constraint: Constraint, value: Option<String>) -> Self {
+        Self {
+            field,
+            constraint,
+            value,
+        }
+    }
+}
+
+impl fmt::Display for OptionError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "{} {}", self.field, self.constraint)?;
+        if let Some(value) = &self.value {
+            write!(f, " (got '{value}')")?;
+        }
+        Ok(())
+    }
+}
+
+impl std::error::Error for OptionError {}
+
+/// Parameters for one generation run, independent of the CLI
+#[derive(Debug, Clone, PartialEq)]
+pub struct GenerationOptions {
+    /// Output format
+    pub format: ScenarioFormat,
+    /// Number of VLAN configurations (ignored when `vlan_range` is set)
+    pub count: Option<u16>,
+    /// VLAN range specification such as `"100-150,200"`
+    pub vlan_range: Option<String>,
+    /// Base configuration (XML format only)
+    pub base_config: Option<PathBuf>,
+    /// Start from the embedded factory-default configuration (XML only)
+    pub from_default: bool,
+    /// Existing CSV input (XML format only)
+    pub csv_file: Option<PathBuf>,
+    /// Firewall number used in file names
+    pub firewall_nr: u16,
+    /// OPT interface counter starting value
+    pub opt_counter: u16,
+    /// Include firewall rules
+    pub include_firewall_rules: bool,
+    /// Firewall rules per VLAN
+    pub firewall_rules_per_vlan: Option<u16>,
+    /// Firewall rule complexity level
+    pub firewall_rule_complexity: String,
+    /// Encrypt output as an OPNsense backup
+    pub backup_passphrase: Option<String>,
+    /// Reuse a previous run to minimize the diff
+    pub minimize_diff: bool,
+    /// Previous output for `minimize_diff`
+    pub previous: Option<PathBuf>,
+    /// RFC 1918 ranges used for VLAN networks
+    pub prefix_strategy: PrefixStrategy,
+    /// Target subnet occupancy in percent of usable addresses
+    pub host_density: Option<u8>,
+    /// Scale users, hosts, and rules with department headcounts
+    pub headcount: bool,
+    /// Headcount model replacing the built-in one (requires `headcount`)
+    pub headcount_model: Option<PathBuf>,
+    /// Days of RADIUS accounting history for the users (requires `headcount`)
+    pub radius_accounting: Option<u16>,
+    /// Captive portal limits the accounting sessions respect
+    pub portal_limits: PortalLimits,
+    /// Assign VLAN types with realistic MTU, MSS, and PCP values
+    pub interface_realism: bool,
+    /// Wording of VLAN and firewall rule descriptions
+    pub description_styles: DescriptionStyles,
+    /// Tag generated objects with site, tier, and batch labels
+    pub labels: bool,
+    /// Emit only objects whose labels match (requires `labels`)
+    pub label_filter: Option<LabelSelector>,
+    /// Number of synthetic threat-intel feeds with URL-table aliases
+    pub threat_feeds: Option<u16>,
+    /// Base URL the feeds are served from (requires `threat_feeds`)
+    pub feed_url: Option<String>,
+    /// Levels of nested aliases above the per-VLAN aliases
+    pub alias_depth: Option<u8>,
+    /// Number of failover incidents of an HA pair to log
+    pub carp_events: Option<u16>,
+    /// Number of additional Unbound host overrides and aliases
+    pub dns_overrides: Option<u32>,
+    /// Map every VLAN interface to upstream switches and ports
+    pub lldp_inventory: bool,
+    /// Number of LACP LAGG interfaces added to XML output
+    pub laggs: Option<u8>,
+    /// Number of spanning-tree bridges added to XML output
+    pub bridges: Option<u8>,
+    /// Encoders the dataset is additionally written with, by registry name
+    pub encoders: Vec<String>,
+    /// OPNsense release to generate for, e.g. `"24.7"`
+    pub opnsense_version: Option<String>,
+    /// Edition of the targeted release
+    pub flavor: Flavor,
+    /// Handling of sections the targeted release does not support
+    pub on_unsupported: UnsupportedPolicy,
+    /// Caps on rules, aliases, and reservations
+    pub budgets: SectionBudgets,
+}
+
+impl Default for GenerationOptions {
+    fn default() -> Self {
+        Self {
+            format: ScenarioFormat::Csv,
+            count: Some(10),
+            vlan_range: None,
+            base_config: None,
+            from_default: false,
+            csv_file: None,
+            firewall_nr: 1,
+            opt_counter: 6,
+            include_firewall_rules: false,
+            firewall_rules_per_vlan: None,
+            firewall_rule_complexity: "intermediate".to_string(),
+            backup_passphrase: None,
+            minimize_diff: false,
+            previous: None,
+            prefix_strategy: PrefixStrategy::default(),
+            host_density: None,
+            headcount: false,
+            headcount_model: None,
+            radius_accounting: None,
+            portal_limits: PortalLimits::default(),
+            interface_realism: false,
+            description_styles: DescriptionStyles::default(),
+            labels: false,
+            label_filter: None,
+            threat_feeds: None,
+            feed_url: None,
+            alias_depth: None,
+            carp_events: None,
+            dns_overrides: None,
+            lldp_inventory: false,
+            laggs: None,
+            bridges: None,
+            encoders: Vec::new(),
+            opnsense_version: None,
+            flavor: Flavor::default(),
+            on_unsupported: UnsupportedPolicy::default(),
+            budgets: SectionBudgets::default(),
+        }
+    }
+}
+
+impl GenerationOptions {
+    /// Check every rule, returning all violations rather than the first
+    pub fn check(&self) -> Vec<OptionError> {
+        let mut errors = Vec::new();
+        let xml = self.format == ScenarioFormat::Xml;
+
+        if let Some(count) = self.count {
+            if !(1..=MAX_COUNT).contains(&count) {
+                errors.push(OptionError::new(
+                    "count",
+                    Constraint::Range {
+                        min: 1,
+                        max: MAX_COUNT as u64,
+                    },
+                    Some(count.to_string()),
+                ));
+            } else if xml && count > MAX_UNIQUE_VLAN_IDS {
+                errors.push(OptionError::new(
+                    "count",
+                    Constraint::AtMost {
+                        max: MAX_UNIQUE_VLAN_IDS as u64,
+                        reason: "unique VLAN IDs 10-4094 for XML output",
+                    },
+                    Some(count.to_string()),
+                ));
+            }
+        }
+
+        if let Some(count) = self.count
+            && u32::from(count) > self.prefix_strategy.network_capacity()
+        {
+            errors.push(OptionError::new(
+                "count",
+                Constraint::AtMost {
+                    max: self.prefix_strategy.network_capacity() as u64,
+                    reason: "unique /24 networks available to the prefix strategy",
+                },
+                Some(count.to_string()),
+            ));
+        }
+
+        if let Some(range) = &self.vlan_range {
+            if self.count.is_some() {
+                errors.push(OptionError::new(
+                    "vlan_range",
+                    Constraint::ConflictsWith { field: "count" },
+                    Some(range.clone()),
+                ));
+            }
+            match parse_vlan_range(range) {
+                Ok(ranges) => {
+                    let total: u64 = ranges.iter().map(|(s, e)| (e - s + 1) as u64).sum();
+                    if total > self.prefix_strategy.network_capacity() as u64 {
+                        errors.push(OptionError::new(
+                            "vlan_range",
+                            Constraint::AtMost {
+                                max: self.prefix_strategy.network_capacity() as u64,
+                                reason: "unique /24 networks available to the prefix strategy",
+                            },
+                            Some(range.clone()),
+                        ));
+                    }
+                    if xml && total > MAX_UNIQUE_VLAN_IDS as u64 {
+                        errors.push(OptionError::new(
+                            "vlan_range",
+                            Constraint::AtMost {
+                                max: MAX_UNIQUE_VLAN_IDS as u64,
+                                reason: "VLANs per XML configuration",
+                            },
+                            Some(range.clone()),
+                        ));
+                    }
+                }
+                Err(detail) => errors.push(OptionError::new(
+                    "vlan_range",
+                    Constraint::Format {
+                        expected: "a VLAN range such as \"100-150\" or \"10,20,30-40\"",
+                        detail,
+                    },
+                    Some(range.clone()),
+                )),
+            }
+        } else if self.count.is_none() && self.csv_file.is_none() {
+            errors.push(OptionError::new(
+                "count",
+                Constraint::Requires {
+                    field: "count, vlan_range, or csv_file",
+                },
+                None,
+            ));
+        }
+
+        if xml && self.base_config.is_none() && !self.from_default {
+            errors.push(OptionError::new(
+                "base_config",
+                Constraint::RequiredWhen {
+                    field: "format",
+                    value: "xml",
+                },
+                None,
+            ));
+        }
+
+        if self.from_default {
+            if self.base_config.is_some() {
+                errors.push(OptionError::new(
+                    "from_default",
+                    Constraint::ConflictsWith {
+                        field: "base_config",
+                    },
+                    Some("true".to_string()),
+                ));
+            }
+            if !xml {
+                errors.push(OptionError::new(
+                    "from_default",
+                    Constraint::UnsupportedWith {
+                        field: "format",
+                        value: "csv",
+                    },
+                    Some("true".to_string()),
+                ));
+            }
+        }
+
+        if !xml {
+            if let Some(csv_file) = &self.csv_file {
+                errors.push(OptionError::new(
+                    "csv_file",
+                    Constraint::UnsupportedWith {
+                        field: "format",
+                        value: "csv",
+                    },
+                    Some(csv_file.display().to_string()),
+                ));
+            }
+            if self.backup_passphrase.is_some() {
+                // Never echo the passphrase back
+                errors.push(OptionError::new(
+                    "backup_passphrase",
+                    Constraint::UnsupportedWith {
+                        field: "format",
+                        value: "csv",
+                    },
+                    None,
+                ));
+            }
+        }
+
+        if !(1..=999).contains(&self.firewall_nr) {
+            errors.push(OptionError::new(
+                "firewall_nr",
+                Constraint::Range { min: 1, max: 999 },
+                Some(self.firewall_nr.to_string()),
+            ));
+        }
+
+        if !(1..=99).contains(&self.opt_counter) {
+            errors.push(OptionError::new(
+                "opt_counter",
+                Constraint::Range { min: 1, max: 99 },
+                Some(self.opt_counter.to_string()),
+            ));
+        }
+
+        if !COMPLEXITY_LEVELS.contains(&self.firewall_rule_complexity.to_lowercase().as_str()) {
+            errors.push(OptionError::new(
+                "firewall_rule_complexity",
+                Constraint::OneOf {
+                    allowed: COMPLEXITY_LEVELS.to_vec(),
+                },
+                Some(self.firewall_rule_complexity.clone()),
+            ));
+        }
+
+        if let Some(density) = self.host_density
+            && density > 100
+        {
+            errors.push(OptionError::new(
+                "host_density",
+                Constraint::Range { min: 0, max: 100 },
+                Some(density.to_string()),
+            ));
+        }
+        if self.headcount
+            && let Some(density) = self.host_density
+        {
+            errors.push(OptionError::new(
+                "host_density",
+                Constraint::ConflictsWith { field: "headcount" },
+                Some(density.to_string()),
+            ));
+        }
+        if let Some(model) = &self.headcount_model
+            && !self.headcount
+        {
+            errors.push(OptionError::new(
+                "headcount_model",
+                Constraint::Requires { field: "headcount" },
+                Some(model.display().to_string()),
+            ));
+        }
+        if let Some(days) = self.radius_accounting {
+            if !(1..=MAX_ACCOUNTING_DAYS).contains(&days) {
+                errors.push(OptionError::new(
+                    "radius_accounting",
+                    Constraint::Range {
+                        min: 1,
+                        max: u64::from(MAX_ACCOUNTING_DAYS),
+                    },
+                    Some(days.to_string()),
+                ));
+            }
+            if !self.headcount {
+                errors.push(OptionError::new(
+                    "radius_accounting",
+                    Constraint::Requires { field: "headcount" },
+                    Some(days.to_string()),
+                ));
+            }
+        }
+        for (field, minutes) in [
+            ("session_timeout", self.portal_limits.hard_timeout),
+            ("idle_timeout", self.portal_limits.idle_timeout),
+        ] {
+            if !(1..=MAX_PORTAL_TIMEOUT).contains(&minutes) {
+                errors.push(OptionError::new(
+                    field,
+                    Constraint::Range {
+                        min: 1,
+                        max: u64::from(MAX_PORTAL_TIMEOUT),
+                    },
+                    Some(minutes.to_string()),
+                ));
+            }
+        }
+
+        if let Some(feeds) = self.threat_feeds
+            && !(1..=MAX_THREAT_FEEDS).contains(&feeds)
+        {
+            errors.push(OptionError::new(
+                "threat_feeds",
+                Constraint::Range {
+                    min: 1,
+                    max: u64::from(MAX_THREAT_FEEDS),
+                },
+                Some(feeds.to_string()),
+            ));
+        }
+        if let Some(url) = &self.feed_url
+            && self.threat_feeds.is_none()
+        {
+            errors.push(OptionError::new(
+                "feed_url",
+                Constraint::Requires {
+                    field: "threat_feeds",
+                },
+                Some(url.clone()),
+            ));
+        }
+
+        if let Some(depth) = self.alias_depth
+            && !(1..=MAX_ALIAS_DEPTH).contains(&depth)
+        {
+            errors.push(OptionError::new(
+                "alias_depth",
+                Constraint::Range {
+                    min: 1,
+                    max: u64::from(MAX_ALIAS_DEPTH),
+                },
+                Some(depth.to_string()),
+            ));
+        }
+
+        if let Some(incidents) = self.carp_events
+            && !(1..=MAX_CARP_INCIDENTS).contains(&incidents)
+        {
+            errors.push(OptionError::new(
+                "carp_events",
+                Constraint::Range {
+                    min: 1,
+                    max: u64::from(MAX_CARP_INCIDENTS),
+                },
+                Some(incidents.to_string()),
+            ));
+        }
+
+        if let Some(count) = self.dns_overrides
+            && !(1..=MAX_DNS_OVERRIDES).contains(&count)
+        {
+            errors.push(OptionError::new(
+                "dns_overrides",
+                Constraint::Range {
+                    min: 1,
+                    max: u64::from(MAX_DNS_OVERRIDES),
+                },
+                Some(count.to_string()),
+            ));
+        }
+
+        for (field, count) in [("laggs", self.laggs), ("bridges", self.bridges)] {
+            let Some(count) = count else {
+                continue;
+            };
+            if !(1..=MAX_LINK_INTERFACES).contains(&count) {
+                errors.push(OptionError::new(
+                    field,
+                    Constraint::Range {
+                        min: 1,
+                        max: u64::from(MAX_LINK_INTERFACES),
+                    },
+                    Some(count.to_string()),
+                ));
+            }
+            if !xml {
+                errors.push(OptionError::new(
+                    field,
+                    Constraint::UnsupportedWith {
+                        field: "format",
+                        value: "csv",
+                    },
+                    Some(count.to_string()),
+                ));
+            }
+        }
+
+        let registry = EncoderRegistry::default();
+        for name in &self.encoders {
+            if registry.get(name).is_none() {
+                errors.push(OptionError::new(
+                    "encoders",
+                    Constraint::OneOf {
+                        allowed: registry.names(),
+                    },
+                    Some(name.clone()),
+                ));
+            }
+        }
+        if xml && !self.encoders.is_empty() {
+            errors.push(OptionError::new(
+                "encoders",
+                Constraint::UnsupportedWith {
+                    field: "format",
+                    value: "xml",
+                },
+                Some(self.encoders.join(",")),
+            ));
+        }
+
+        if let Some(version) = &self.opnsense_version
+            && let Err(e) = Target::parse(version, self.flavor)
+        {
+            errors.push(OptionError::new(
+                "opnsense_version",
+                Constraint::Format {
+                    expected: "an OPNsense release of the flavor, e.g. \"24.7\" or \"24.10\"",
+                    detail: match e {
+                        ConfigError::InvalidParameter { reason, .. } => reason,
+                        other => other.to_string(),
+                    },
+                },
+                Some(version.clone()),
+            ));
+        }
+
+        if self.minimize_diff && self.previous.is_none() {
+            errors.push(OptionError::new(
+                "minimize_diff",
+                Constraint::Requires { field: "previous" },
+                Some("true".to_string()),
+            ));
+        }
+        if let Some(filter) = &self.label_filter
+            && !self.labels
+        {
+            errors.push(OptionError::new(
+                "label_filter",
+                Constraint::Requires { field: "labels" },
+                Some(format!("{filter:?}")),
+            ));
+        }
+        if let Some(previous) = &self.previous {
+            if !self.minimize_diff {
+                errors.push(OptionError::new(
+                    "previous",
+                    Constraint::Requires {
+                        field: "minimize_diff",
+                    },
+                    Some(previous.display().to_string()),
+                ));
+            }
+            if self.csv_file.is_some() {
+                errors.push(OptionError::new(
+                    "previous",
+                    Constraint::ConflictsWith { field: "csv_file" },
+                    Some(previous.display().to_string()),
+                ));
+            }
+        }
+
+        errors
+    }
+
+    /// Validate the options, failing with every violated rule
+    pub fn validate(&self) -> crate::Result<()> {
+        let errors = self.check();
+        if errors.is_empty() {
+            Ok(())
+        } else {
+            Err(ConfigError::invalid_options(errors))
+        }
+    }
+}
+
+/// RFC 1918 address plan used for generated VLAN networks
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq, ValueEnum)]
+pub enum PrefixStrategy {
+    /// Use 10.0.0.0/8 only
+    #[default]
+    ClassA,
+    /// Use 172.16.0.0/12 only
+    ClassB,
+    /// Use 192.168.0.0/16 only
+    ClassC,
+    /// Mix all classes, mostly 10.0.0.0/8 with some 172.16.0.0/12 and 192.168.0.0/16
+    Mixed,
+    /// Pick the least-utilized class for each new network
+    Auto,
+}
+
+impl PrefixStrategy {
+    /// Maximum number of distinct /24 networks the strategy can produce
+    pub fn network_capacity(self) -> u32 {
+        match self {
+            PrefixStrategy::ClassA => 254 * 254,
+            PrefixStrategy::ClassB => 16 * 254,
+            PrefixStrategy::ClassC => 254,
+            PrefixStrategy::Mixed | PrefixStrategy::Auto => 254 * 254 + 16 * 254 + 254,
+        }
+    }
+}
+
+/// Parse VLAN range specification into individual ranges
+/// Supports formats like "100-150", "10,20,30-40", "100"
+pub fn parse_vlan_range(range_str: &str) -> Result<Vec<(u16, u16)>, String> {
+    let mut ranges = Vec::new();
+
+    for part in range_str.split(',') {
+        let part = part.trim();
+        if part.is_empty() {
+            continue;
+        }
+
+        if part.contains('-') {
+            let parts: Vec<&str> = part.split('-').collect();
+            if parts.len() != 2 {
+                return Err(format!("Invalid range format: '{}'", part));
+            }
+
+            let start: u16 = parts[0]
+                .trim()
+                .parse()
+                .map_err(|_| format!("Invalid start VLAN ID: '{}'", parts[0]))?;
+            let end: u16 = parts[1]
+                .trim()
+                .parse()
+                .map_err(|_| format!("Invalid end VLAN ID: '{}'", parts[1]))?;
+
+            if start > end {
+                return Err(format!(
+                    "Start VLAN ID {} must be less than or equal to end VLAN ID {}",
+                    start, end
+                ));
+            }
+
+            if !(10..=4094).contains(&start) || !(10..=4094).contains(&end) {
+                return Err(format!(
+                    "VLAN IDs must be between 10 and 4094, got range {}-{}",
+                    start, end
+                ));
+            }
+
+            ranges.push((start, end));
+        } else {
+            let vlan_id: u16 = part
+                .parse()
+                .map_err(|_| format!("Invalid VLAN ID: '{}'", part))?;
+
+            if !(10..=4094).contains(&vlan_id) {
+                return Err(format!("VLAN ID {} must be between 10 and 4094", vlan_id));
+            }
+
+            ranges.push((vlan_id, vlan_id));
+        }
+    }
+
+    if ranges.is_empty() {
+        return Err("No valid VLAN ranges found".to_string());
+    }
+
+    Ok(ranges)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_default_options_are_valid() {
+        assert!(GenerationOptions::default().validate().is_ok());
+    }
+
+    #[test]
+    fn test_xml_count_exceeding_unique_vlans() {
+        let options = GenerationOptions {
+            format: ScenarioFormat::Xml,
+            count: Some(5000),
+            base_config: Some(PathBuf::from("config.xml")),
+            ..Default::default()
+        };
+        let errors = options.check();
+        assert_eq!(errors.len(), 1);
+        assert_eq!(errors[0].field, "count");
+        assert_eq!(errors[0].value.as_deref(), Some("5000"));
+        assert!(matches!(
+            errors[0].constraint,
+            Constraint::AtMost { max: 4085, .. }
+        ));
+    }
+
+    #[test]
+    fn test_collects_all_violations() {
+        let options = GenerationOptions {
+            format: ScenarioFormat::Xml,
+            count: Some(10),
+            vlan_range: Some("5-20".to_string()),
+            firewall_rule_complexity: "extreme".to_string(),
+            ..Default::default()
+        };
+        let fields: Vec<&str> = options.check().iter().map(|e| e.field).collect();
+        assert_eq!(
+            fields,
+            vec![
+                "vlan_range",
+                "vlan_range",
+                "base_config",
+                "firewall_rule_complexity"
+            ]
+        );
+
+        match options.validate().unwrap_err() {
+            ConfigError::InvalidOptions { errors } => assert_eq!(errors.len(), 4),
+            other => panic!("Expected InvalidOptions, got: {other:?}"),
+        }
+    }
+
+    #[test]
+    fn test_link_interfaces_need_xml() {
+        let options = GenerationOptions {
+            laggs: Some(2),
+            bridges: Some(17),
+            ..Default::default()
+        };
+        let errors = options.check();
+        let fields: Vec<&str> = errors.iter().map(|e| e.field).collect();
+        assert_eq!(fields, vec!["laggs", "bridges", "bridges"]);
+        assert!(matches!(
+            errors[1].constraint,
+            Constraint::Range { min: 1, max: 16 }
+        ));
+    }
+
+    #[test]
+    fn test_opnsense_version_matches_flavor() {
+        let options = GenerationOptions {
+            opnsense_version: Some("24.4".to_string()),
+            ..Default::default()
+        };
+        let errors = options.check();
+        assert_eq!(errors.len(), 1);
+        assert_eq!(errors[0].field, "opnsense_version");
+
+        let business = GenerationOptions {
+            flavor: Flavor::Business,
+            ..options
+        };
+        assert!(business.validate().is_ok());
+    }
+
+    #[test]
+    fn test_backup_passphrase_not_echoed() {
+        let options = GenerationOptions {
+            backup_passphrase: Some("secret".to_string()),
+            ..Default::default()
+        };
+        let errors = options.check();
+        assert_eq!(errors[0].field, "backup_passphrase");
+        assert!(errors[0].value.is_none());
+        assert!(!errors[0].to_string().contains("secret"));
+    }
+
+    #[test]
+    fn test_error_display() {
+        let error = OptionError::new(
+            "firewall_nr",
+            Constraint::Range { min: 1, max: 999 },
+            Some("0".to_string()),
+        );
+        assert_eq!(
+            error.to_string(),
+            "firewall_nr must be between 1 and 999 (got '0')"
+        );
+    }
+
+    #[test]
+    fn test_count_exceeding_prefix_strategy_capacity() {
+        let options = GenerationOptions {
+            count: Some(300),
+            prefix_strategy: PrefixStrategy::ClassC,
+            ..Default::default()
+        };
+        let errors = options.check();
+        assert_eq!(errors.len(), 1);
+        assert_eq!(
+            errors[0].constraint,
+            Constraint::AtMost {
+                max: 254,
+                reason: "unique /24 networks available to the prefix strategy",
+            }
+        );
+    }
+
+    #[test]
+    fn test_host_density_above_full_rejected() {
+        let options = GenerationOptions {
+            host_density: Some(120),
+            ..Default::default()
+        };
+        let errors = options.check();
+        assert_eq!(errors.len(), 1);
+        assert_eq!(errors[0].field, "host_density");
+        assert_eq!(errors[0].constraint, Constraint::Range { min: 0, max: 100 });
+    }
+
+    #[test]
+    fn test_unknown_encoder_rejected() {
+        let options = GenerationOptions {
+            encoders: vec!["json".to_string(), "yaml".to_string()],
+            ..Default::default()
+        };
+        let errors = options.check();
+        assert_eq!(errors.len(), 1);
+        assert_eq!(errors[0].value.as_deref(), Some("yaml"));
+        assert_eq!(
+            errors[0].constraint,
+            Constraint::OneOf {
+                allowed: vec!["xml", "json", "protobuf"],
+            }
+        );
+    }
+
+    #[test]
+    fn test_parse_vlan_range() {
+        // Test single VLAN
+        let ranges = parse_vlan_range("100").unwrap();
+        assert_eq!(ranges, vec![(100, 100)]);
+
+        // Test simple range
+        let ranges = parse_vlan_range("100-150").unwrap();
+        assert_eq!(ranges, vec![(100, 150)]);
+
+        // Test multiple ranges
+        let ranges = parse_vlan_range("10,20-30,40").unwrap();
+        assert_eq!(ranges, vec![(10, 10), (20, 30), (40, 40)]);
+
+        // Test invalid range
+        assert!(parse_vlan_range("150-100").is_err());
+        assert!(parse_vlan_range("5-10").is_err()); // Below minimum
+        assert!(parse_vlan_range("4095-5000").is_err()); // Above maximum
+    }
+}
@@ -0,0 +1,315 @@
+//! Scenario definitions for reproducible fixture generation
+//!
+//! A scenario captures the `generate` parameters for one fixture set so it can
+//! be versioned alongside the generated output and re-run deterministically.
+//! Instead of random VLANs, a scenario can list `blocks`: instances of
+//! reusable [snippets](crate::model::snippet) that the `compose` command
+//! expands into a VLAN CSV.
+
+use crate::Result;
+use crate::generator::SectionBudgets;
+use crate::model::ConfigError;
+use crate::model::snippet::SnippetInstance;
+use serde::{Deserialize, Serialize};
+use std::fs;
+use std::path::Path;
+
+/// Output format of a scenario
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum ScenarioFormat {
+    Csv,
+    Xml,
+}
+
+impl ScenarioFormat {
+    /// Value accepted by `generate --format`
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            ScenarioFormat::Csv => "csv",
+            ScenarioFormat::Xml => "xml",
+        }
+    }
+}
+
+/// A named, seeded set of generation parameters
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct Scenario {
+    /// Scenario name (used for output naming)
+    pub name: String,
+
+    /// Free-form description of what the scenario covers
+    #[serde(default)]
+    pub description: String,
+
+    /// Output format
+    pub format: ScenarioFormat,
+
+    /// Number of random VLAN configurations (zero when `blocks` are used)
+    #[serde(default)]
+    pub count: u16,
+
+    /// Random seed; scenarios are always seeded so output is reproducible
+    pub seed: u64,
+
+    /// Output file (CSV) or directory (XML), relative to the fixture root
+    pub output: String,
+
+    /// Base configuration, relative to the fixture root (XML format only)
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub base_config: Option<String>,
+
+    /// Include firewall rules
+    #[serde(default)]
+    pub include_firewall_rules: bool,
+
+    /// Snippet instances composing the VLANs instead of random generation
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub blocks: Vec<SnippetInstance>,
+
+    /// Per-section caps (`max_rules`, `max_aliases`, `max_reservations`)
+    #[serde(flatten, default)]
+    pub budgets: SectionBudgets,
+}
+
+impl Scenario {
+    /// Load a scenario from a JSON file
+    pub fn load<P: AsRef<Path>>(path: P) -> Result<Self> {
+        let content = fs::read_to_string(path.as_ref())?;
+        let scenario: Scenario = serde_json::from_str(&content)?;
+        scenario.validate()?;
+        Ok(scenario)
+    }
+
+    /// Validate scenario fields
+    pub fn validate(&self) -> Result<()> {
+        if self.name.trim().is_empty() {
+            return Err(ConfigError::invalid_parameter(
+                "name",
+                "Scenario name must not be empty",
+            ));
+        }
+        if self.count == 0 && self.blocks.is_empty() {
+            return Err(ConfigError::invalid_parameter(
+                "count",
+                format!("Scenario '{}' must generate at least one VLAN", self.name),
+            ));
+        }
+        if self.count != 0 && !self.blocks.is_empty() {
+            return Err(ConfigError::invalid_parameter(
+                "count",
+                format!(
+                    "Scenario '{}' composes its VLANs from blocks and must not set count",
+                    self.name
+                ),
+            ));
+        }
+        if self.format == ScenarioFormat::Xml && self.base_config.is_none() {
+            return Err(ConfigError::invalid_parameter(
+                "base_config",
+                format!(
+                    "Scenario '{}' uses XML format but has no base_config",
+                    self.name
+                ),
+            ));
+        }
+        Ok(())
+    }
+
+    /// Whether the VLANs are composed from snippet blocks
+    pub fn is_composed(&self) -> bool {
+        !self.blocks.is_empty()
+    }
+
+    /// CSV the `compose` command writes for a composed scenario
+    ///
+    /// CSV scenarios compose straight into their output; XML scenarios
+    /// compose into `vlans.csv` in the output directory, which `generate`
+    /// then reads.
+    pub fn composed_csv(&self) -> String {
+        match self.format {
+            ScenarioFormat::Csv => self.output.clone(),
+            ScenarioFormat::Xml => format!("{}/vlans.csv", self.output.trim_end_matches('/')),
+        }
+    }
+
+    /// Command lines that reproduce this scenario from the fixture root
+    ///
+    /// `scenario_file` is the path of the scenario file itself, which
+    /// `compose` reads. Composed CSV scenarios need no `generate` step.
+    pub fn to_commands(&self, scenario_file: &str) -> Vec<Vec<String>> {
+        if !self.is_composed() {
+            return vec![self.to_generate_args()];
+        }
+
+        let compose = vec![
+            "compose".to_string(),
+            scenario_file.to_string(),
+            "--output".to_string(),
+            self.composed_csv(),
+        ];
+        match self.format {
+            ScenarioFormat::Csv => vec![compose],
+            ScenarioFormat::Xml => vec![compose, self.to_generate_args()],
+        }
+    }
+
+    /// Command-line arguments for `generate` that reproduce this scenario
+    ///
+    /// Composed scenarios read their VLANs from [`composed_csv`](Self::composed_csv).
+    pub fn to_generate_args(&self) -> Vec<String> {
+        let mut args = vec![
+            "generate".to_string(),
+            "--format".to_string(),
+            self.format.as_str().to_string(),
+        ];
+        if self.is_composed() {
+            args.push("--csv-file".to_string());
+            args.push(self.composed_csv());
+        } else {
+            args.push("--count".to_string());
+            args.push(self.count.to_string());
+        }
+        args.push("--seed".to_string());
+        args.push(self.seed.to_string());
+
+        match self.format {
+            ScenarioFormat::Csv => {
+                args.push("--output".to_string());
+                args.push(self.output.clone());
+            }
+            ScenarioFormat::Xml => {
+                args.push("--output-dir".to_string());
+                args.push(self.output.clone());
+                if let Some(base) = &self.base_config {
+                    args.push("--base-config".to_string());
+                    args.push(base.clone());
+                }
+            }
+        }
+
+        if self.include_firewall_rules {
+            args.push("--include-firewall-rules".to_string());
+        }
+        let caps = [
+            ("--max-rules", self.budgets.max_rules),
+            ("--max-aliases", self.budgets.max_aliases),
+            ("--max-reservations", self.budgets.max_reservations),
+        ];
+        for (flag, cap) in caps {
+            if let Some(cap) = cap {
+                args.push(flag.to_string());
+                args.push(cap.to_string());
+            }
+        }
+
+        args.push("--force".to_string());
+        args
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn csv_scenario() -> Scenario {
+        Scenario {
+            name: "small".to_string(),
+            description: String::new(),
+            format: ScenarioFormat::Csv,
+            count: 10,
+            seed: 42,
+            output: "generated/small.csv".to_string(),
+            base_config: None,
+            include_firewall_rules: false,
+            blocks: Vec::new(),
+            budgets: SectionBudgets::default(),
+        }
+    }
+
+    #[test]
+    fn test_scenario_json_roundtrip() {
+        let scenario = csv_scenario();
+        let json = serde_json::to_string(&scenario).unwrap();
+        assert!(json.contains(r#""format":"csv""#));
+        let parsed: Scenario = serde_json::from_str(&json).unwrap();
+        assert_eq!(parsed, scenario);
+    }
+
+    #[test]
+    fn test_to_generate_args() {
+        let args = csv_scenario().to_generate_args();
+        assert_eq!(
+            args,
+            vec![
+                "generate",
+                "--format",
+                "csv",
+                "--count",
+                "10",
+                "--seed",
+                "42",
+                "--output",
+                "generated/small.csv",
+                "--force"
+            ]
+        );
+    }
+
+    #[test]
+    fn test_scenario_budgets() {
+        let json = r#"{"name":"paged","format":"csv","count":4,"seed":1,
+            "output":"generated/paged.csv","max_rules":50}"#;
+        let scenario: Scenario = serde_json::from_str(json).unwrap();
+        assert_eq!(scenario.budgets.max_rules, Some(50));
+        let args = scenario.to_generate_args();
+        assert!(args.windows(2).any(|pair| pair == ["--max-rules", "50"]));
+        assert!(!args.contains(&"--max-aliases".to_string()));
+    }
+
+    #[test]
+    fn test_xml_scenario_requires_base_config() {
+        let mut scenario = csv_scenario();
+        scenario.format = ScenarioFormat::Xml;
+        assert!(scenario.validate().is_err());
+
+        scenario.base_config = Some("base/config.xml".to_string());
+        assert!(scenario.validate().is_ok());
+        assert!(
+            scenario
+                .to_generate_args()
+                .contains(&"--base-config".to_string())
+        );
+    }
+
+    #[test]
+    fn test_composed_scenario_commands() {
+        let mut scenario = csv_scenario();
+        scenario.blocks = vec![SnippetInstance {
+            snippet: "guest-bundle".to_string(),
+            params: Default::default(),
+        }];
+        assert!(scenario.validate().is_err());
+
+        scenario.count = 0;
+        assert!(scenario.validate().is_ok());
+        assert_eq!(
+            scenario.to_commands("scenarios/small.json"),
+            vec![vec![
+                "compose",
+                "scenarios/small.json",
+                "--output",
+                "generated/small.csv"
+            ]]
+        );
+
+        scenario.format = ScenarioFormat::Xml;
+        scenario.output = "generated/small".to_string();
+        scenario.base_config = Some("base/config.xml".to_string());
+        let commands = scenario.to_commands("scenarios/small.json");
+        assert_eq!(commands.len(), 2);
+        assert_eq!(commands[0][3], "generated/small/vlans.csv");
+        assert!(commands[1].contains(&"--csv-file".to_string()));
+        assert!(!commands[1].contains(&"--count".to_string()));
+    }
+}
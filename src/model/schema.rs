@@ -0,0 +1,232 @@
+//! JSON Schemas for user-authored input files
+//!
+//! Editors and CI validators check seed data and scenario files against these
+//! schemas. They are built from the same constants the loaders enforce and
+//! carry the crate version in their `$id`, so `schema export` from an
+//! installed faker always describes exactly what that version accepts.
+
+use crate::model::options::MAX_UNIQUE_VLAN_IDS;
+use serde_json::{Value, json};
+use std::fmt;
+
+/// JSON Schema dialect of every exported schema
+pub const SCHEMA_DIALECT: &str = "https://json-schema.org/draft/2020-12/schema";
+
+/// Input file a schema describes
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum SchemaKind {
+    /// VLAN seed records, as read by `generate --csv-file`
+    Seed,
+    /// Scenario definitions, as read by `compose` and written by `init-fixtures`
+    Scenario,
+}
+
+impl SchemaKind {
+    /// Short name used in the schema id and title
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            SchemaKind::Seed => "seed",
+            SchemaKind::Scenario => "scenario",
+        }
+    }
+}
+
+impl fmt::Display for SchemaKind {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(self.as_str())
+    }
+}
+
+/// JSON Schema for one kind of input file
+pub fn json_schema(kind: SchemaKind) -> Value {
+    let mut schema = match kind {
+        SchemaKind::Seed => seed_schema(),
+        SchemaKind::Scenario => scenario_schema(),
+    };
+    schema["$schema"] = json!(SCHEMA_DIALECT);
+    schema["$id"] = json!(format!(
+        "urn:opnsense-config-faker:{}:{kind}",
+        env!("CARGO_PKG_VERSION")
+    ));
+    schema
+}
+
+/// Seed data: the rows of a VLAN CSV, keyed by column header
+fn seed_schema() -> Value {
+    json!({
+        "title": "VLAN seed data",
+        "description": "Rows of a VLAN CSV as read by `generate --csv-file`, keyed by column header",
+        "type": "array",
+        "items": {
+            "type": "object",
+            "properties": {
+                "VLAN": {
+                    "description": "VLAN ID (IEEE 802.1Q)",
+                    "type": "integer",
+                    "minimum": 10,
+                    "maximum": 4094
+                },
+                "IP Range": {
+                    "description": "RFC 1918 /24 network, as 10.1.2.x or 10.1.2.0/24",
+                    "type": "string",
+                    "pattern": r"^\d{1,3}\.\d{1,3}\.\d{1,3}\.(x|0/24)$"
+                },
+                "Beschreibung": {
+                    "description": "VLAN description",
+                    "type": "string"
+                },
+                "WAN": {
+                    "description": "WAN interface the VLAN is assigned to",
+                    "type": "integer",
+                    "minimum": 1,
+                    "maximum": 3
+                }
+            },
+            "required": ["VLAN", "IP Range", "Beschreibung", "WAN"],
+            "additionalProperties": false
+        }
+    })
+}
+
+fn scenario_schema() -> Value {
+    json!({
+        "title": "Scenario",
+        "description": "Seeded generation parameters for one fixture set",
+        "type": "object",
+        "properties": {
+            "name": {
+                "description": "Scenario name, used for output naming",
+                "type": "string",
+                "pattern": r"\S"
+            },
+            "description": {
+                "description": "What the scenario covers",
+                "type": "string",
+                "default": ""
+            },
+            "format": {
+                "description": "Output format",
+                "enum": ["csv", "xml"]
+            },
+            "count": {
+                "description": "Number of random VLANs; zero or absent when blocks are used",
+                "type": "integer",
+                "minimum": 0,
+                "maximum": MAX_UNIQUE_VLAN_IDS,
+                "default": 0
+            },
+            "seed": {
+                "description": "Random seed",
+                "type": "integer",
+                "minimum": 0,
+                "maximum": u64::MAX
+            },
+            "output": {
+                "description": "Output file (CSV) or directory (XML), relative to the fixture root",
+                "type": "string"
+            },
+            "base_config": {
+                "description": "Base configuration relative to the fixture root (XML format only)",
+                "type": "string"
+            },
+            "include_firewall_rules": {
+                "description": "Include firewall rules",
+                "type": "boolean",
+                "default": false
+            },
+            "blocks": {
+                "description": "Snippet instances composing the VLANs instead of random generation",
+                "type": "array",
+                "items": { "$ref": "#/$defs/block" }
+            }
+        },
+        "required": ["name", "format", "seed", "output"],
+        "additionalProperties": false,
+        "allOf": [
+            {
+                "description": "A scenario has either a count or blocks",
+                "oneOf": [
+                    {
+                        "properties": {
+                            "count": { "minimum": 1 },
+                            "blocks": { "maxItems": 0 }
+                        },
+                        "required": ["count"]
+                    },
+                    {
+                        "properties": {
+                            "count": { "const": 0 },
+                            "blocks": { "minItems": 1 }
+                        },
+                        "required": ["blocks"]
+                    }
+                ]
+            },
+            {
+                "description": "XML scenarios need a base configuration",
+                "if": {
+                    "properties": { "format": { "const": "xml" } },
+                    "required": ["format"]
+                },
+                "then": { "required": ["base_config"] }
+            }
+        ],
+        "$defs": {
+            "block": {
+                "description": "One instance of a snippet",
+                "type": "object",
+                "properties": {
+                    "snippet": {
+                        "description": "Name of the snippet",
+                        "type": "string"
+                    },
+                    "params": {
+                        "description": "Parameter values for this instance",
+                        "type": "object",
+                        "additionalProperties": { "type": ["integer", "string"] }
+                    }
+                },
+                "required": ["snippet"],
+                "additionalProperties": false
+            }
+        }
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::model::scenario::Scenario;
+
+    #[test]
+    fn test_schema_header() {
+        for kind in [SchemaKind::Seed, SchemaKind::Scenario] {
+            let schema = json_schema(kind);
+            assert_eq!(schema["$schema"], SCHEMA_DIALECT);
+            let id = schema["$id"].as_str().unwrap();
+            assert!(id.contains(env!("CARGO_PKG_VERSION")));
+            assert!(id.ends_with(kind.as_str()));
+        }
+    }
+
+    #[test]
+    fn test_scenario_schema_covers_every_field() {
+        let scenario: Scenario = serde_json::from_value(json!({
+            "name": "s",
+            "format": "xml",
+            "seed": 1,
+            "output": "out",
+            "base_config": "base.xml",
+            "blocks": [{ "snippet": "guest-bundle", "params": { "vlan": 100 } }]
+        }))
+        .unwrap();
+        let serialized = serde_json::to_value(&scenario).unwrap();
+        let schema = json_schema(SchemaKind::Scenario);
+        for field in serialized.as_object().unwrap().keys() {
+            assert!(
+                schema["properties"].get(field).is_some(),
+                "{field} missing from schema"
+            );
+        }
+    }
+}
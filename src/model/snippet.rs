@@ -0,0 +1,434 @@
+//! Reusable building blocks for scenario composition
+//!
+//! A snippet describes a bundle of VLANs that appears many times in a large
+//! fixture, such as a "standard guest VLAN bundle" per site. Its fields are
+//! templates with `{param}` placeholders; a scenario instantiates the snippet
+//! once per site with different parameters instead of repeating the VLANs.
+//! Snippet files are YAML (`.yaml` or `.yml`) or JSON (`.json`):
+//!
+//! ```yaml
+//! name: guest-bundle
+//! params:
+//!   site: HQ
+//! vlans:
+//!   - vlan_id: "{vlan}"
+//!     ip_network: "10.{octet}.1.x"
+//!     description: "{site} Guest"
+//!   - vlan_id: "{vlan+1}"
+//!     ip_network: "10.{octet}.2.x"
+//!     description: "{site} IoT"
+//! ```
+//!
+//! `params` holds defaults; placeholders without a default must be given by
+//! every instance. `{name+N}` and `{name-N}` add to or subtract from a
+//! numeric parameter, so one base VLAN ID can number a whole bundle.
+
+use crate::Result;
+use crate::generator::VlanConfig;
+use crate::model::ConfigError;
+use serde::{Deserialize, Serialize};
+use std::collections::{BTreeMap, HashMap};
+use std::fmt;
+use std::fs;
+use std::path::Path;
+
+/// Parameter value, written in JSON as a number or a string
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(untagged)]
+pub enum ParamValue {
+    Number(i64),
+    Text(String),
+}
+
+impl fmt::Display for ParamValue {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            ParamValue::Number(n) => write!(f, "{n}"),
+            ParamValue::Text(s) => f.write_str(s),
+        }
+    }
+}
+
+/// Parameters by name
+pub type Params = BTreeMap<String, ParamValue>;
+
+/// One VLAN of a snippet; every field but the WAN assignment is a template
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct SnippetVlan {
+    /// VLAN ID, e.g. `"{vlan}"` or `"{vlan+1}"`
+    pub vlan_id: String,
+
+    /// IP network in `"10.x.x.x"` format, e.g. `"10.{octet}.1.x"`
+    pub ip_network: String,
+
+    /// Description, e.g. `"{site} Guest"`
+    pub description: String,
+
+    /// WAN assignment (1-3)
+    #[serde(default = "default_wan_assignment")]
+    pub wan_assignment: u8,
+}
+
+fn default_wan_assignment() -> u8 {
+    1
+}
+
+/// A named, parameterized bundle of VLANs
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Snippet {
+    /// Name instances refer to the snippet by
+    pub name: String,
+
+    /// Free-form description of the bundle
+    #[serde(default)]
+    pub description: String,
+
+    /// Default parameter values
+    #[serde(default, skip_serializing_if = "BTreeMap::is_empty")]
+    pub params: Params,
+
+    /// VLANs created by each instance
+    pub vlans: Vec<SnippetVlan>,
+}
+
+impl Snippet {
+    /// Load a snippet from a YAML or JSON file, chosen by extension
+    pub fn load<P: AsRef<Path>>(path: P) -> Result<Self> {
+        let content = fs::read_to_string(path.as_ref())?;
+        let snippet: Snippet = if is_yaml_path(path.as_ref()) {
+            serde_norway::from_str(&content)?
+        } else {
+            serde_json::from_str(&content)?
+        };
+        snippet.validate()?;
+        Ok(snippet)
+    }
+
+    /// Validate snippet fields
+    pub fn validate(&self) -> Result<()> {
+        if self.name.trim().is_empty() {
+            return Err(ConfigError::invalid_parameter(
+                "name",
+                "Snippet name must not be empty",
+            ));
+        }
+        if self.vlans.is_empty() {
+            return Err(ConfigError::invalid_parameter(
+                "vlans",
+                format!("Snippet '{}' must define at least one VLAN", self.name),
+            ));
+        }
+        Ok(())
+    }
+
+    /// VLANs of one instance, with `params` overriding the defaults
+    pub fn instantiate(&self, params: &Params) -> Result<Vec<VlanConfig>> {
+        let mut values = self.params.clone();
+        values.extend(params.iter().map(|(k, v)| (k.clone(), v.clone())));
+
+        self.vlans
+            .iter()
+            .map(|vlan| {
+                let vlan_id = expand(&vlan.vlan_id, &values)?;
+                let vlan_id = vlan_id.parse::<u16>().map_err(|_| {
+                    ConfigError::invalid_parameter(
+                        "vlan_id",
+                        format!("Snippet '{}' expands VLAN ID to '{vlan_id}'", self.name),
+                    )
+                })?;
+                VlanConfig::new(
+                    vlan_id,
+                    expand(&vlan.ip_network, &values)?,
+                    expand(&vlan.description, &values)?,
+                    vlan.wan_assignment,
+                )
+            })
+            .collect()
+    }
+}
+
+/// A use of a snippet within a scenario
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct SnippetInstance {
+    /// Name of the snippet
+    pub snippet: String,
+
+    /// Parameter values for this instance
+    #[serde(default, skip_serializing_if = "BTreeMap::is_empty")]
+    pub params: Params,
+}
+
+/// Snippets available to scenarios, by name
+#[derive(Debug, Clone, Default)]
+pub struct SnippetLibrary {
+    snippets: BTreeMap<String, Snippet>,
+}
+
+impl SnippetLibrary {
+    /// Create an empty library
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Load every `*.yaml`, `*.yml`, and `*.json` snippet in a directory
+    pub fn load_dir<P: AsRef<Path>>(dir: P) -> Result<Self> {
+        let mut paths: Vec<_> = fs::read_dir(dir.as_ref())?
+            .filter_map(|entry| entry.ok().map(|e| e.path()))
+            .filter(|path| is_yaml_path(path) || path.extension().is_some_and(|ext| ext == "json"))
+            .collect();
+        paths.sort();
+
+        let mut library = Self::new();
+        for path in paths {
+            let snippet = Snippet::load(&path).map_err(|e| {
+                ConfigError::config(format!("Failed to load snippet {}: {e}", path.display()))
+            })?;
+            library.insert(snippet)?;
+        }
+        Ok(library)
+    }
+
+    /// Add a snippet, rejecting duplicate names
+    pub fn insert(&mut self, snippet: Snippet) -> Result<()> {
+        snippet.validate()?;
+        if self.snippets.contains_key(&snippet.name) {
+            return Err(ConfigError::invalid_parameter(
+                "name",
+                format!("Snippet '{}' is defined more than once", snippet.name),
+            ));
+        }
+        self.snippets.insert(snippet.name.clone(), snippet);
+        Ok(())
+    }
+
+    /// Look up a snippet by name
+    pub fn get(&self, name: &str) -> Option<&Snippet> {
+        self.snippets.get(name)
+    }
+
+    /// Number of snippets
+    pub fn len(&self) -> usize {
+        self.snippets.len()
+    }
+
+    /// Whether the library has no snippets
+    pub fn is_empty(&self) -> bool {
+        self.snippets.is_empty()
+    }
+
+    /// VLANs of all instances in order
+    ///
+    /// Fails when a snippet is unknown or two instances produce the same VLAN
+    /// ID or network.
+    pub fn compose(&self, instances: &[SnippetInstance]) -> Result<Vec<VlanConfig>> {
+        let mut configs = Vec::new();
+        let mut vlan_ids: HashMap<u16, usize> = HashMap::new();
+        let mut networks: HashMap<String, usize> = HashMap::new();
+
+        for (index, instance) in instances.iter().enumerate() {
+            let block = index + 1;
+            let snippet = self.get(&instance.snippet).ok_or_else(|| {
+                ConfigError::invalid_parameter(
+                    "snippet",
+                    format!("Block {block} uses unknown snippet '{}'", instance.snippet),
+                )
+            })?;
+
+            for config in snippet.instantiate(&instance.params)? {
+                if let Some(other) = vlan_ids.insert(config.vlan_id, block) {
+                    return Err(ConfigError::validation(format!(
+                        "VLAN ID {} is created by both block {other} and block {block}",
+                        config.vlan_id
+                    )));
+                }
+                if let Some(other) = networks.insert(config.ip_network.clone(), block) {
+                    return Err(ConfigError::validation(format!(
+                        "Network {} is created by both block {other} and block {block}",
+                        config.ip_network
+                    )));
+                }
+                configs.push(config);
+            }
+        }
+
+        Ok(configs)
+    }
+}
+
+/// Whether a snippet file is YAML, judged by its extension
+fn is_yaml_path(path: &Path) -> bool {
+    path.extension()
+        .is_some_and(|ext| ext == "yaml" || ext == "yml")
+}
+
+/// Replace `{name}`, `{name+N}`, and `{name-N}` placeholders
+fn expand(template: &str, params: &Params) -> Result<String> {
+    let mut out = String::with_capacity(template.len());
+    let mut rest = template;
+
+    while let Some(start) = rest.find('{') {
+        out.push_str(&rest[..start]);
+        let end = rest[start..].find('}').ok_or_else(|| {
+            ConfigError::invalid_parameter(
+                "template",
+                format!("Unclosed placeholder in '{template}'"),
+            )
+        })? + start;
+        out.push_str(&substitute(&rest[start + 1..end], params, template)?);
+        rest = &rest[end + 1..];
+    }
+
+    out.push_str(rest);
+    Ok(out)
+}
+
+/// Value of one placeholder expression
+fn substitute(expression: &str, params: &Params, template: &str) -> Result<String> {
+    let (name, offset) = match expression.find(['+', '-']) {
+        Some(position) => {
+            let offset = expression[position..].trim().parse::<i64>().map_err(|_| {
+                ConfigError::invalid_parameter(
+                    "template",
+                    format!("Invalid offset in '{{{expression}}}' of '{template}'"),
+                )
+            })?;
+            (expression[..position].trim(), Some(offset))
+        }
+        None => (expression.trim(), None),
+    };
+
+    let value = params.get(name).ok_or_else(|| {
+        ConfigError::invalid_parameter(
+            name,
+            format!("Parameter '{name}' used in '{template}' has no value"),
+        )
+    })?;
+
+    match offset {
+        None => Ok(value.to_string()),
+        Some(offset) => {
+            let base = match value {
+                ParamValue::Number(n) => Some(*n),
+                ParamValue::Text(s) => s.trim().parse::<i64>().ok(),
+            }
+            .ok_or_else(|| {
+                ConfigError::invalid_parameter(
+                    name,
+                    format!("Parameter '{name}' must be a number to apply an offset"),
+                )
+            })?;
+            Ok((base + offset).to_string())
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    fn guest_bundle() -> Snippet {
+        serde_json::from_str(
+            r#"{
+                "name": "guest-bundle",
+                "params": { "site": "HQ" },
+                "vlans": [
+                    { "vlan_id": "{vlan}", "ip_network": "10.{octet}.1.x", "description": "{site} Guest" },
+                    { "vlan_id": "{vlan+1}", "ip_network": "10.{octet}.2.x", "description": "{site} IoT", "wan_assignment": 2 }
+                ]
+            }"#,
+        )
+        .unwrap()
+    }
+
+    fn instance(vlan: i64, octet: i64, site: Option<&str>) -> SnippetInstance {
+        let mut params = Params::new();
+        params.insert("vlan".to_string(), ParamValue::Number(vlan));
+        params.insert("octet".to_string(), ParamValue::Number(octet));
+        if let Some(site) = site {
+            params.insert("site".to_string(), ParamValue::Text(site.to_string()));
+        }
+        SnippetInstance {
+            snippet: "guest-bundle".to_string(),
+            params,
+        }
+    }
+
+    #[test]
+    fn test_instantiate_expands_placeholders() {
+        let configs = guest_bundle()
+            .instantiate(&instance(100, 20, None).params)
+            .unwrap();
+        assert_eq!(configs.len(), 2);
+        assert_eq!(configs[0].vlan_id, 100);
+        assert_eq!(configs[0].ip_network, "10.20.1.x");
+        assert_eq!(configs[0].description, "HQ Guest");
+        assert_eq!(configs[1].vlan_id, 101);
+        assert_eq!(configs[1].wan_assignment, 2);
+    }
+
+    #[test]
+    fn test_compose_instances() {
+        let mut library = SnippetLibrary::new();
+        library.insert(guest_bundle()).unwrap();
+
+        let configs = library
+            .compose(&[
+                instance(100, 20, Some("Branch A")),
+                instance(200, 21, Some("Branch B")),
+            ])
+            .unwrap();
+        let ids: Vec<u16> = configs.iter().map(|c| c.vlan_id).collect();
+        assert_eq!(ids, vec![100, 101, 200, 201]);
+        assert_eq!(configs[2].description, "Branch B Guest");
+    }
+
+    #[test]
+    fn test_compose_rejects_conflicts_and_unknown_snippets() {
+        let mut library = SnippetLibrary::new();
+        library.insert(guest_bundle()).unwrap();
+        assert!(library.insert(guest_bundle()).is_err());
+
+        let overlap = library.compose(&[instance(100, 20, None), instance(101, 21, None)]);
+        assert!(overlap.unwrap_err().to_string().contains("VLAN ID 101"));
+
+        let unknown = SnippetInstance {
+            snippet: "missing".to_string(),
+            params: Params::new(),
+        };
+        assert!(library.compose(&[unknown]).is_err());
+    }
+
+    #[test]
+    fn test_load_dir_reads_yaml_and_json() {
+        let dir = TempDir::new().unwrap();
+        let yaml = "\
+name: guest-bundle
+params:
+  site: HQ  # default
+vlans:
+  - vlan_id: \"{vlan}\"
+    ip_network: \"10.{octet}.1.x\"
+    description: \"{site} Guest\"
+";
+        fs::write(dir.path().join("guest.yaml"), yaml).unwrap();
+        fs::write(
+            dir.path().join("voice.json"),
+            r#"{"name": "voice", "vlans": [{"vlan_id": "{vlan}", "ip_network": "10.9.9.x", "description": "Voice"}]}"#,
+        )
+        .unwrap();
+        fs::write(dir.path().join("README.md"), "not a snippet").unwrap();
+
+        let library = SnippetLibrary::load_dir(dir.path()).unwrap();
+        assert_eq!(library.len(), 2);
+        let snippet = library.get("guest-bundle").unwrap();
+        assert_eq!(snippet.params, guest_bundle().params);
+        assert_eq!(snippet.vlans[..], guest_bundle().vlans[..1]);
+    }
+
+    #[test]
+    fn test_missing_parameter_is_reported() {
+        let error = guest_bundle().instantiate(&Params::new()).unwrap_err();
+        assert!(error.to_string().contains("'vlan'"));
+    }
+}
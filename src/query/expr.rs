@@ -0,0 +1,442 @@
+//! Expression language for `query --where`
+//!
+//! ```text
+//! expr       = and { "or" and }
+//! and        = unary { "and" unary }
+//! unary      = "not" unary | "(" expr ")" | predicate
+//! predicate  = "duplicate" FIELD | FIELD op VALUE
+//! op         = "=" | "!=" | "<" | "<=" | ">" | ">=" | "contains" | "overlaps" | "within"
+//! ```
+//!
+//! Keywords are case-insensitive. Values are bare words or quoted with `'` or
+//! `"`. `overlaps` and `within` take an IPv4 network in CIDR notation.
+
+use crate::Result;
+use crate::model::ConfigError;
+use ipnetwork::Ipv4Network;
+use std::fmt;
+
+/// Comparison operator
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Op {
+    /// Equal; numeric when both sides are numbers, otherwise case-insensitive
+    Eq,
+    /// Not equal
+    Ne,
+    /// Numerically less than
+    Lt,
+    /// Numerically less than or equal
+    Le,
+    /// Numerically greater than
+    Gt,
+    /// Numerically greater than or equal
+    Ge,
+    /// Case-insensitive substring match
+    Contains,
+    /// Network shares at least one address with the given network
+    Overlaps,
+    /// Network lies entirely inside the given network
+    Within,
+}
+
+impl fmt::Display for Op {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        let symbol = match self {
+            Op::Eq => "=",
+            Op::Ne => "!=",
+            Op::Lt => "<",
+            Op::Le => "<=",
+            Op::Gt => ">",
+            Op::Ge => ">=",
+            Op::Contains => "contains",
+            Op::Overlaps => "overlaps",
+            Op::Within => "within",
+        };
+        f.write_str(symbol)
+    }
+}
+
+/// Parsed query expression
+#[derive(Debug, Clone, PartialEq)]
+pub enum Expr {
+    /// Both sides match
+    And(Box<Expr>, Box<Expr>),
+    /// Either side matches
+    Or(Box<Expr>, Box<Expr>),
+    /// Inner expression does not match
+    Not(Box<Expr>),
+    /// Field compared against a literal
+    Compare {
+        field: String,
+        op: Op,
+        value: String,
+    },
+    /// Field value occurs in more than one record
+    Duplicate { field: String },
+}
+
+impl Expr {
+    /// Parse an expression
+    pub fn parse(input: &str) -> Result<Self> {
+        let tokens = tokenize(input)?;
+        let mut parser = Parser { tokens, pos: 0 };
+        let expr = parser.parse_or()?;
+        if let Some(token) = parser.peek() {
+            return Err(ConfigError::invalid_query(format!(
+                "unexpected '{token}' after complete expression"
+            )));
+        }
+        Ok(expr)
+    }
+
+    /// Field names referenced by the expression, in order of appearance
+    pub fn fields(&self) -> Vec<&str> {
+        let mut fields = Vec::new();
+        self.collect_fields(&mut fields);
+        fields
+    }
+
+    fn collect_fields<'a>(&'a self, fields: &mut Vec<&'a str>) {
+        match self {
+            Expr::And(left, right) | Expr::Or(left, right) => {
+                left.collect_fields(fields);
+                right.collect_fields(fields);
+            }
+            Expr::Not(inner) => inner.collect_fields(fields),
+            Expr::Compare { field, .. } | Expr::Duplicate { field } => {
+                if !fields.contains(&field.as_str()) {
+                    fields.push(field);
+                }
+            }
+        }
+    }
+}
+
+/// Compare a record value against a literal
+pub fn compare(actual: &str, op: Op, expected: &str) -> bool {
+    let numbers = actual
+        .trim()
+        .parse::<f64>()
+        .ok()
+        .zip(expected.trim().parse::<f64>().ok());
+    match op {
+        Op::Eq => match numbers {
+            Some((a, b)) => a == b,
+            None => actual.trim().eq_ignore_ascii_case(expected.trim()),
+        },
+        Op::Ne => !compare(actual, Op::Eq, expected),
+        Op::Lt => numbers.is_some_and(|(a, b)| a < b),
+        Op::Le => numbers.is_some_and(|(a, b)| a <= b),
+        Op::Gt => numbers.is_some_and(|(a, b)| a > b),
+        Op::Ge => numbers.is_some_and(|(a, b)| a >= b),
+        Op::Contains => actual.to_lowercase().contains(&expected.to_lowercase()),
+        Op::Overlaps | Op::Within => {
+            let (Some(value), Some(target)) = (parse_network(actual), parse_network(expected))
+            else {
+                return false;
+            };
+            if op == Op::Overlaps {
+                value.contains(target.network()) || target.contains(value.network())
+            } else {
+                target.contains(value.network()) && target.contains(value.broadcast())
+            }
+        }
+    }
+}
+
+/// Interpret a value as an IPv4 network
+///
+/// Accepts CIDR notation, a bare address (a /32), and the generator's
+/// `a.b.c.x` form (a /24). Anything else, such as `any`, is not a network.
+pub fn parse_network(value: &str) -> Option<Ipv4Network> {
+    let value = value.trim();
+    if let Some(prefix) = value.strip_suffix(".x") {
+        return format!("{prefix}.0/24").parse().ok();
+    }
+    value.parse().ok()
+}
+
+#[derive(Debug, Clone, PartialEq)]
+enum Token {
+    Word(String),
+    Quoted(String),
+    Symbol(&'static str),
+}
+
+impl fmt::Display for Token {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            Token::Word(word) => f.write_str(word),
+            Token::Quoted(text) => write!(f, "\"{text}\""),
+            Token::Symbol(symbol) => f.write_str(symbol),
+        }
+    }
+}
+
+fn tokenize(input: &str) -> Result<Vec<Token>> {
+    let mut tokens = Vec::new();
+    let mut chars = input.char_indices().peekable();
+
+    while let Some(&(start, c)) = chars.peek() {
+        match c {
+            c if c.is_whitespace() => {
+                chars.next();
+            }
+            '(' | ')' => {
+                chars.next();
+                tokens.push(Token::Symbol(if c == '(' { "(" } else { ")" }));
+            }
+            '=' => {
+                chars.next();
+                tokens.push(Token::Symbol("="));
+            }
+            '!' | '<' | '>' => {
+                chars.next();
+                let with_eq = chars.next_if(|&(_, next)| next == '=').is_some();
+                let symbol = match (c, with_eq) {
+                    ('!', true) => "!=",
+                    ('<', true) => "<=",
+                    ('<', false) => "<",
+                    ('>', true) => ">=",
+                    ('>', false) => ">",
+                    _ => {
+                        return Err(ConfigError::invalid_query(format!(
+                            "expected '!=' at position {}",
+                            start + 1
+                        )));
+                    }
+                };
+                tokens.push(Token::Symbol(symbol));
+            }
+            '"' | '\'' => {
+                chars.next();
+                let mut text = String::new();
+                let mut closed = false;
+                for (_, next) in chars.by_ref() {
+                    if next == c {
+                        closed = true;
+                        break;
+                    }
+                    text.push(next);
+                }
+                if !closed {
+                    return Err(ConfigError::invalid_query(format!(
+                        "unterminated string starting at position {}",
+                        start + 1
+                    )));
+                }
+                tokens.push(Token::Quoted(text));
+            }
+            _ => {
+                let mut word = String::new();
+                while let Some(&(_, next)) = chars.peek() {
+                    if next.is_whitespace() || "()=!<>\"'".contains(next) {
+                        break;
+                    }
+                    word.push(next);
+                    chars.next();
+                }
+                tokens.push(Token::Word(word));
+            }
+        }
+    }
+
+    Ok(tokens)
+}
+
+struct Parser {
+    tokens: Vec<Token>,
+    pos: usize,
+}
+
+impl Parser {
+    fn peek(&self) -> Option<&Token> {
+        self.tokens.get(self.pos)
+    }
+
+    fn next(&mut self) -> Option<Token> {
+        let token = self.tokens.get(self.pos).cloned();
+        self.pos += 1;
+        token
+    }
+
+    fn eat_keyword(&mut self, keyword: &str) -> bool {
+        if matches!(self.peek(), Some(Token::Word(w)) if w.eq_ignore_ascii_case(keyword)) {
+            self.pos += 1;
+            true
+        } else {
+            false
+        }
+    }
+
+    fn parse_or(&mut self) -> Result<Expr> {
+        let mut expr = self.parse_and()?;
+        while self.eat_keyword("or") {
+            expr = Expr::Or(Box::new(expr), Box::new(self.parse_and()?));
+        }
+        Ok(expr)
+    }
+
+    fn parse_and(&mut self) -> Result<Expr> {
+        let mut expr = self.parse_unary()?;
+        while self.eat_keyword("and") {
+            expr = Expr::And(Box::new(expr), Box::new(self.parse_unary()?));
+        }
+        Ok(expr)
+    }
+
+    fn parse_unary(&mut self) -> Result<Expr> {
+        if self.eat_keyword("not") {
+            return Ok(Expr::Not(Box::new(self.parse_unary()?)));
+        }
+        if self.peek() == Some(&Token::Symbol("(")) {
+            self.pos += 1;
+            let expr = self.parse_or()?;
+            return match self.next() {
+                Some(Token::Symbol(")")) => Ok(expr),
+                Some(token) => Err(ConfigError::invalid_query(format!(
+                    "expected ')' but found '{token}'"
+                ))),
+                None => Err(ConfigError::invalid_query("missing ')'")),
+            };
+        }
+        if self.eat_keyword("duplicate") {
+            let field = self.expect_field("duplicate")?;
+            return Ok(Expr::Duplicate { field });
+        }
+        self.parse_comparison()
+    }
+
+    fn parse_comparison(&mut self) -> Result<Expr> {
+        let field = self.expect_field("expression start")?;
+        let op = match self.next() {
+            Some(Token::Symbol("=")) => Op::Eq,
+            Some(Token::Symbol("!=")) => Op::Ne,
+            Some(Token::Symbol("<")) => Op::Lt,
+            Some(Token::Symbol("<=")) => Op::Le,
+            Some(Token::Symbol(">")) => Op::Gt,
+            Some(Token::Symbol(">=")) => Op::Ge,
+            Some(Token::Word(w)) if w.eq_ignore_ascii_case("contains") => Op::Contains,
+            Some(Token::Word(w)) if w.eq_ignore_ascii_case("overlaps") => Op::Overlaps,
+            Some(Token::Word(w)) if w.eq_ignore_ascii_case("within") => Op::Within,
+            Some(token) => {
+                return Err(ConfigError::invalid_query(format!(
+                    "expected an operator after '{field}' but found '{token}'"
+                )));
+            }
+            None => {
+                return Err(ConfigError::invalid_query(format!(
+                    "expected an operator after '{field}'"
+                )));
+            }
+        };
+        let value = match self.next() {
+            Some(Token::Word(w) | Token::Quoted(w)) => w,
+            Some(token) => {
+                return Err(ConfigError::invalid_query(format!(
+                    "expected a value after '{field} {op}' but found '{token}'"
+                )));
+            }
+            None => {
+                return Err(ConfigError::invalid_query(format!(
+                    "expected a value after '{field} {op}'"
+                )));
+            }
+        };
+        if matches!(op, Op::Overlaps | Op::Within) && parse_network(&value).is_none() {
+            return Err(ConfigError::invalid_query(format!(
+                "'{value}' is not an IPv4 network (expected CIDR such as 10.20.0.0/16)"
+            )));
+        }
+        Ok(Expr::Compare { field, op, value })
+    }
+
+    fn expect_field(&mut self, context: &str) -> Result<String> {
+        match self.next() {
+            Some(Token::Word(w)) => Ok(w.to_lowercase()),
+            Some(token) => Err(ConfigError::invalid_query(format!(
+                "expected a field name after {context} but found '{token}'"
+            ))),
+            None => Err(ConfigError::invalid_query(format!(
+                "expected a field name after {context}"
+            ))),
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn compare_expr(field: &str, op: Op, value: &str) -> Expr {
+        Expr::Compare {
+            field: field.to_string(),
+            op,
+            value: value.to_string(),
+        }
+    }
+
+    #[test]
+    fn test_parse_precedence() {
+        let expr = Expr::parse("vlan_id > 100 and not wan = 2 or duplicate subnet").unwrap();
+        assert_eq!(
+            expr,
+            Expr::Or(
+                Box::new(Expr::And(
+                    Box::new(compare_expr("vlan_id", Op::Gt, "100")),
+                    Box::new(Expr::Not(Box::new(compare_expr("wan", Op::Eq, "2")))),
+                )),
+                Box::new(Expr::Duplicate {
+                    field: "subnet".to_string()
+                }),
+            )
+        );
+        assert_eq!(expr.fields(), vec!["vlan_id", "wan", "subnet"]);
+    }
+
+    #[test]
+    fn test_parse_quoted_values_and_parentheses() {
+        let expr =
+            Expr::parse("(description CONTAINS 'Sales Dept') AND subnet overlaps 10.20.0.0/16")
+                .unwrap();
+        assert_eq!(
+            expr,
+            Expr::And(
+                Box::new(compare_expr("description", Op::Contains, "Sales Dept")),
+                Box::new(compare_expr("subnet", Op::Overlaps, "10.20.0.0/16")),
+            )
+        );
+    }
+
+    #[test]
+    fn test_parse_errors() {
+        assert!(Expr::parse("").is_err());
+        assert!(Expr::parse("vlan_id").is_err());
+        assert!(Expr::parse("vlan_id =").is_err());
+        assert!(Expr::parse("(vlan_id = 1").is_err());
+        assert!(Expr::parse("subnet overlaps banana").is_err());
+        assert!(Expr::parse("description = 'open").is_err());
+        assert!(Expr::parse("vlan_id = 1 2").is_err());
+    }
+
+    #[test]
+    fn test_compare_numbers_and_strings() {
+        assert!(compare("100", Op::Eq, "100.0"));
+        assert!(compare("Pass", Op::Eq, "pass"));
+        assert!(compare("99", Op::Lt, "100"));
+        assert!(!compare("abc", Op::Lt, "100"));
+        assert!(compare("IT VLAN 100", Op::Contains, "vlan"));
+        assert!(compare("a", Op::Ne, "b"));
+    }
+
+    #[test]
+    fn test_compare_networks() {
+        assert!(compare("10.20.5.0/24", Op::Overlaps, "10.20.0.0/16"));
+        assert!(compare("10.20.5.x", Op::Within, "10.20.0.0/16"));
+        assert!(compare("10.0.0.0/8", Op::Overlaps, "10.20.0.0/16"));
+        assert!(!compare("10.0.0.0/8", Op::Within, "10.20.0.0/16"));
+        assert!(!compare("10.21.0.0/24", Op::Overlaps, "10.20.0.0/16"));
+        assert!(compare("10.20.1.7", Op::Within, "10.20.1.0/24"));
+        assert!(!compare("any", Op::Overlaps, "10.0.0.0/8"));
+    }
+}
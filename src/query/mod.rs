@@ -0,0 +1,407 @@
+//! Queryable index over generated configurations
+//!
+//! [`QueryIndex`] loads VLANs, firewall rules, and hosts from generated output
+//! into flat tables and counts every field value as it goes, so `duplicate`
+//! predicates are answered from the index instead of rescanning. Queries are
+//! written in the small language in [`expr`] and return a [`Report`], which the
+//! `query` command renders as a table, CSV, or JSON; `summary` renders the
+//! record counts the same way.
+
+pub mod expr;
+pub mod pointer;
+
+use crate::Result;
+use crate::generator::{FirewallRule, SubnetPopulation, VlanConfig};
+use crate::io::csv::{read_csv, read_firewall_rules_csv};
+use crate::io::previous::parse_vlans_from_xml;
+use crate::io::report::Report;
+use crate::model::ConfigError;
+use clap::ValueEnum;
+use std::collections::{BTreeMap, HashMap};
+use std::fs;
+use std::path::Path;
+
+pub use expr::{Expr, Op};
+pub use pointer::JsonPointer;
+
+/// Kind of record a query runs against
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq, PartialOrd, Ord, Hash, ValueEnum)]
+pub enum RecordKind {
+    /// VLANs: vlan_id, subnet, description, wan, gateway
+    #[default]
+    Vlan,
+    /// Firewall rules from a rules CSV
+    Rule,
+    /// Hosts from a `--host-density` hosts CSV
+    Host,
+}
+
+impl RecordKind {
+    /// Plural name used in messages
+    pub fn plural(self) -> &'static str {
+        match self {
+            RecordKind::Vlan => "VLANs",
+            RecordKind::Rule => "rules",
+            RecordKind::Host => "hosts",
+        }
+    }
+}
+
+/// Columns of VLAN records
+const VLAN_COLUMNS: &[&str] = &["vlan_id", "subnet", "description", "wan", "gateway"];
+
+/// Columns of firewall rule records, matching the rules CSV
+const RULE_COLUMNS: &[&str] = &[
+    "rule_id",
+    "source",
+    "destination",
+    "protocol",
+    "ports",
+    "action",
+    "direction",
+    "description",
+    "log",
+    "vlan_id",
+    "priority",
+    "interface",
+];
+
+/// Columns of host records, matching the hosts CSV
+const HOST_COLUMNS: &[&str] = &["vlan_id", "ip_addr", "hostname", "domain", "mac", "alias"];
+
+/// Records of one kind with per-column value counts
+#[derive(Debug, Default)]
+struct Table {
+    columns: Vec<String>,
+    rows: Vec<Vec<String>>,
+    /// Occurrences of each normalized value, keyed by column index
+    value_counts: HashMap<(usize, String), usize>,
+}
+
+impl Table {
+    fn new(columns: &[&str]) -> Self {
+        Self {
+            columns: columns.iter().map(|c| c.to_string()).collect(),
+            ..Self::default()
+        }
+    }
+
+    fn push(&mut self, row: Vec<String>) {
+        for (index, value) in row.iter().enumerate() {
+            *self
+                .value_counts
+                .entry((index, normalize(value)))
+                .or_insert(0) += 1;
+        }
+        self.rows.push(row);
+    }
+
+    fn column(&self, field: &str) -> Option<usize> {
+        self.columns.iter().position(|c| c == field)
+    }
+
+    fn matches(&self, row: &[String], expr: &Expr) -> bool {
+        match expr {
+            Expr::And(left, right) => self.matches(row, left) && self.matches(row, right),
+            Expr::Or(left, right) => self.matches(row, left) || self.matches(row, right),
+            Expr::Not(inner) => !self.matches(row, inner),
+            Expr::Compare { field, op, value } => self
+                .column(field)
+                .is_some_and(|index| expr::compare(&row[index], *op, value)),
+            Expr::Duplicate { field } => self.column(field).is_some_and(|index| {
+                self.value_counts
+                    .get(&(index, normalize(&row[index])))
+                    .is_some_and(|count| *count > 1)
+            }),
+        }
+    }
+}
+
+/// Value as used for duplicate detection
+pub(crate) fn normalize(value: &str) -> String {
+    // Networks compare by address, so 10.1.2.x and 10.1.2.0/24 are the same
+    match expr::parse_network(value) {
+        Some(network) if value.contains('/') || value.ends_with(".x") => network.to_string(),
+        _ => value.trim().to_lowercase(),
+    }
+}
+
+/// Index of VLANs, rules, and hosts for querying
+#[derive(Debug, Default)]
+pub struct QueryIndex {
+    tables: BTreeMap<RecordKind, Table>,
+}
+
+impl QueryIndex {
+    /// Create an empty index
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Load a generated CSV file, XML file, or directory of them
+    ///
+    /// CSV files are recognized by their header as VLAN, firewall rule, or
+    /// host files. XML files contribute their VLANs. Directories are read one
+    /// level deep, in file name order.
+    pub fn load<P: AsRef<Path>>(path: P) -> Result<Self> {
+        let path = path.as_ref();
+        if !path.exists() {
+            return Err(ConfigError::ConfigNotFound {
+                path: path.display().to_string(),
+            });
+        }
+
+        let mut index = Self::new();
+        if path.is_dir() {
+            let mut files: Vec<_> = fs::read_dir(path)?
+                .filter_map(|entry| entry.ok().map(|e| e.path()))
+                .filter(|p| p.is_file())
+                .collect();
+            files.sort();
+            for file in files {
+                let ext = file
+                    .extension()
+                    .and_then(|ext| ext.to_str())
+                    .map(str::to_ascii_lowercase);
+                if matches!(ext.as_deref(), Some("csv" | "xml")) {
+                    index.load_file(&file)?;
+                }
+            }
+        } else {
+            index.load_file(path)?;
+        }
+        Ok(index)
+    }
+
+    fn load_file(&mut self, path: &Path) -> Result<()> {
+        let is_csv = path
+            .extension()
+            .and_then(|ext| ext.to_str())
+            .is_some_and(|ext| ext.eq_ignore_ascii_case("csv"));
+        if !is_csv {
+            self.add_vlans(&parse_vlans_from_xml(&fs::read_to_string(path)?)?);
+            return Ok(());
+        }
+
+        let mut reader = csv::Reader::from_path(path)?;
+        let headers: Vec<String> = reader.headers()?.iter().map(str::to_string).collect();
+        match headers.first().map(String::as_str) {
+            Some("VLAN") => self.add_vlans(&read_csv(path)?),
+            Some("rule_id") => self.add_rules(&read_firewall_rules_csv(path)?),
+            Some("vlan_id") if headers.iter().any(|h| h == "ip_addr") => {
+                let table = self.table_mut(RecordKind::Host);
+                for record in reader.records() {
+                    table.push(record?.iter().map(str::to_string).collect());
+                }
+            }
+            _ => {
+                return Err(ConfigError::validation(format!(
+                    "'{}' is not a generated VLAN, firewall rule, or hosts CSV file",
+                    path.display()
+                )));
+            }
+        }
+        Ok(())
+    }
+
+    fn table_mut(&mut self, kind: RecordKind) -> &mut Table {
+        self.tables.entry(kind).or_insert_with(|| {
+            Table::new(match kind {
+                RecordKind::Vlan => VLAN_COLUMNS,
+                RecordKind::Rule => RULE_COLUMNS,
+                RecordKind::Host => HOST_COLUMNS,
+            })
+        })
+    }
+
+    /// Add VLAN records
+    pub fn add_vlans(&mut self, configs: &[VlanConfig]) {
+        let table = self.table_mut(RecordKind::Vlan);
+        for config in configs {
+            let subnet = config
+                .as_ipv4_network()
+                .map(|n| n.to_string())
+                .unwrap_or_else(|_| config.ip_network.clone());
+            table.push(vec![
+                config.vlan_id.to_string(),
+                subnet,
+                config.description.clone(),
+                config.wan_assignment.to_string(),
+                config.gateway_ip().unwrap_or_default(),
+            ]);
+        }
+    }
+
+    /// Add firewall rule records
+    pub fn add_rules(&mut self, rules: &[FirewallRule]) {
+        let table = self.table_mut(RecordKind::Rule);
+        for rule in rules {
+            table.push(vec![
+                rule.rule_id.clone(),
+                rule.source.clone(),
+                rule.destination.clone(),
+                rule.protocol.clone(),
+                rule.ports.clone(),
+                rule.action.clone(),
+                rule.direction.clone(),
+                rule.description.clone(),
+                rule.log.to_string(),
+                rule.vlan_id.map(|id| id.to_string()).unwrap_or_default(),
+                rule.priority.to_string(),
+                rule.interface.clone(),
+            ]);
+        }
+    }
+
+    /// Add host records
+    pub fn add_hosts(&mut self, populations: &[SubnetPopulation]) {
+        let table = self.table_mut(RecordKind::Host);
+        for population in populations {
+            for host in &population.host_overrides {
+                let mac = population
+                    .reservations
+                    .iter()
+                    .find(|r| r.ip_addr == host.ip_addr)
+                    .map(|r| r.mac.clone())
+                    .unwrap_or_default();
+                table.push(vec![
+                    population.vlan_id.to_string(),
+                    host.ip_addr.clone(),
+                    host.hostname.clone(),
+                    host.domain.clone(),
+                    mac,
+                    population.alias_name(),
+                ]);
+            }
+        }
+    }
+
+    /// Number of records of a kind
+    pub fn len(&self, kind: RecordKind) -> usize {
+        self.tables.get(&kind).map_or(0, |t| t.rows.len())
+    }
+
+    /// Whether the index holds no records at all
+    pub fn is_empty(&self) -> bool {
+        self.tables.values().all(|t| t.rows.is_empty())
+    }
+
+    /// Records of `kind` matching `expr` (all records when `None`)
+    pub fn query(&self, kind: RecordKind, expr: Option<&Expr>) -> Result<Report> {
+        let empty = Table::new(match kind {
+            RecordKind::Vlan => VLAN_COLUMNS,
+            RecordKind::Rule => RULE_COLUMNS,
+            RecordKind::Host => HOST_COLUMNS,
+        });
+        let table = self.tables.get(&kind).unwrap_or(&empty);
+
+        if let Some(expr) = expr
+            && let Some(unknown) = expr
+                .fields()
+                .into_iter()
+                .find(|f| table.column(f).is_none())
+        {
+            return Err(ConfigError::invalid_query(format!(
+                "unknown field '{unknown}' for {}; available: {}",
+                kind.plural(),
+                table.columns.join(", ")
+            )));
+        }
+
+        let mut report = Report::new(table.columns.iter().cloned());
+        for row in &table.rows {
+            if expr.is_none_or(|expr| table.matches(row, expr)) {
+                report.push_row(row.iter().cloned())?;
+            }
+        }
+        Ok(report)
+    }
+
+    /// Number of records of every kind, one row per kind
+    pub fn summary(&self) -> Result<Report> {
+        let mut report = Report::new(["kind", "records"]);
+        for kind in RecordKind::value_variants() {
+            let name = kind
+                .to_possible_value()
+                .map(|value| value.get_name().to_string())
+                .unwrap_or_default();
+            report.push_row([name, self.len(*kind).to_string()])?;
+        }
+        Ok(report)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn index() -> QueryIndex {
+        let mut index = QueryIndex::new();
+        index.add_vlans(&[
+            VlanConfig::new(100, "10.20.1.x".into(), "IT VLAN 100".into(), 1).unwrap(),
+            VlanConfig::new(200, "10.20.2.x".into(), "Sales VLAN 200".into(), 2).unwrap(),
+            VlanConfig::new(300, "10.30.1.x".into(), "HR VLAN 300".into(), 1).unwrap(),
+            VlanConfig::new(400, "10.20.1.0/24".into(), "IT VLAN 400".into(), 3).unwrap(),
+        ]);
+        index
+    }
+
+    fn vlan_ids(report: &Report) -> Vec<&str> {
+        report.rows().iter().map(|row| row[0].as_str()).collect()
+    }
+
+    #[test]
+    fn test_subnet_overlaps_query() {
+        let expr = Expr::parse("subnet overlaps 10.20.0.0/16").unwrap();
+        let report = index().query(RecordKind::Vlan, Some(&expr)).unwrap();
+        assert_eq!(vlan_ids(&report), vec!["100", "200", "400"]);
+    }
+
+    #[test]
+    fn test_duplicate_subnet_uses_index() {
+        let expr = Expr::parse("duplicate subnet").unwrap();
+        let report = index().query(RecordKind::Vlan, Some(&expr)).unwrap();
+        assert_eq!(vlan_ids(&report), vec!["100", "400"]);
+    }
+
+    #[test]
+    fn test_boolean_combination() {
+        let expr = Expr::parse("wan = 1 and not description contains hr").unwrap();
+        let report = index().query(RecordKind::Vlan, Some(&expr)).unwrap();
+        assert_eq!(vlan_ids(&report), vec!["100"]);
+    }
+
+    #[test]
+    fn test_unknown_field_rejected() {
+        let expr = Expr::parse("color = blue").unwrap();
+        let error = index().query(RecordKind::Vlan, Some(&expr)).unwrap_err();
+        assert!(error.to_string().contains("available: vlan_id, subnet"));
+    }
+
+    #[test]
+    fn test_summary_counts_every_kind() {
+        let report = index().summary().unwrap();
+        let rows: Vec<(&str, &str)> = report
+            .rows()
+            .iter()
+            .map(|row| (row[0].as_str(), row[1].as_str()))
+            .collect();
+        assert_eq!(rows, vec![("vlan", "4"), ("rule", "0"), ("host", "0")]);
+    }
+
+    #[test]
+    fn test_query_other_kinds() {
+        let mut index = index();
+        let configs =
+            vec![VlanConfig::new(100, "10.20.1.x".into(), "IT VLAN 100".into(), 1).unwrap()];
+        let density = crate::generator::HostDensity::new(0.5).unwrap();
+        index.add_hosts(&crate::generator::populate_subnets(&configs, density, Some(3)).unwrap());
+
+        let expr = Expr::parse("ip_addr within 10.20.1.0/25 and mac != ''").unwrap();
+        let report = index.query(RecordKind::Host, Some(&expr)).unwrap();
+        assert!(!report.is_empty());
+        assert!(report.rows().iter().all(|row| !row[4].is_empty()));
+
+        assert!(index.query(RecordKind::Rule, None).unwrap().is_empty());
+    }
+}
@@ -0,0 +1,172 @@
+//! JSON Pointer lookups with a wildcard extension
+//!
+//! Pointers follow RFC 6901 (`/0/subnet`, with `~1` for `/` and `~0` for `~`
+//! inside keys). A segment of exactly `*` additionally matches every element
+//! of an array or every member of an object, so `/*/subnet` extracts the subnet
+//! of each record in a JSON dataset.
+
+use crate::Result;
+use crate::model::ConfigError;
+use serde_json::Value;
+
+/// Compiled JSON pointer
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct JsonPointer {
+    segments: Vec<Segment>,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+enum Segment {
+    Key(String),
+    Wildcard,
+}
+
+impl JsonPointer {
+    /// Parse a pointer; the empty string selects the whole document
+    pub fn parse(pointer: &str) -> Result<Self> {
+        if pointer.is_empty() {
+            return Ok(Self {
+                segments: Vec::new(),
+            });
+        }
+        let Some(rest) = pointer.strip_prefix('/') else {
+            return Err(ConfigError::invalid_query(format!(
+                "JSON pointer '{pointer}' must be empty or start with /"
+            )));
+        };
+
+        let segments = rest
+            .split('/')
+            .map(|raw| {
+                if raw == "*" {
+                    return Ok(Segment::Wildcard);
+                }
+                let mut key = String::with_capacity(raw.len());
+                let mut chars = raw.chars();
+                while let Some(c) = chars.next() {
+                    if c != '~' {
+                        key.push(c);
+                        continue;
+                    }
+                    match chars.next() {
+                        Some('0') => key.push('~'),
+                        Some('1') => key.push('/'),
+                        _ => {
+                            return Err(ConfigError::invalid_query(format!(
+                                "JSON pointer '{pointer}' has an invalid escape in '{raw}'; use ~0 or ~1"
+                            )));
+                        }
+                    }
+                }
+                Ok(Segment::Key(key))
+            })
+            .collect::<Result<Vec<_>>>()?;
+
+        Ok(Self { segments })
+    }
+
+    /// Resolve against a document, returning each match with its concrete pointer
+    pub fn resolve<'a>(&self, document: &'a Value) -> Vec<(String, &'a Value)> {
+        let mut matches = Vec::new();
+        collect(&self.segments, document, String::new(), &mut matches);
+        matches
+    }
+}
+
+fn collect<'a>(
+    segments: &[Segment],
+    value: &'a Value,
+    path: String,
+    matches: &mut Vec<(String, &'a Value)>,
+) {
+    let Some((segment, rest)) = segments.split_first() else {
+        matches.push((path, value));
+        return;
+    };
+    match (segment, value) {
+        (Segment::Wildcard, Value::Array(items)) => {
+            for (index, item) in items.iter().enumerate() {
+                collect(rest, item, format!("{path}/{index}"), matches);
+            }
+        }
+        (Segment::Wildcard, Value::Object(members)) => {
+            for (key, member) in members {
+                collect(rest, member, format!("{path}/{}", escape(key)), matches);
+            }
+        }
+        (Segment::Key(key), Value::Array(items)) => {
+            if let Some(item) = key.parse::<usize>().ok().and_then(|i| items.get(i)) {
+                collect(rest, item, format!("{path}/{key}"), matches);
+            }
+        }
+        (Segment::Key(key), Value::Object(members)) => {
+            if let Some(member) = members.get(key) {
+                collect(rest, member, format!("{path}/{}", escape(key)), matches);
+            }
+        }
+        _ => {}
+    }
+}
+
+fn escape(key: &str) -> String {
+    key.replace('~', "~0").replace('/', "~1")
+}
+
+/// Render a matched value: strings bare, other scalars as JSON, containers compact
+pub fn display_value(value: &Value) -> String {
+    match value {
+        Value::String(s) => s.clone(),
+        other => other.to_string(),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serde_json::json;
+
+    #[test]
+    fn test_pointer_resolves_rfc6901_paths() {
+        let doc = json!({"a/b": {"m~n": 3}, "list": [10, 20]});
+        let pointer = JsonPointer::parse("/a~1b/m~0n").unwrap();
+        let matches = pointer.resolve(&doc);
+        assert_eq!(matches, vec![("/a~1b/m~0n".to_string(), &json!(3))]);
+        assert_eq!(
+            JsonPointer::parse("/list/1").unwrap().resolve(&doc)[0].1,
+            &json!(20)
+        );
+        assert!(
+            JsonPointer::parse("/list/5")
+                .unwrap()
+                .resolve(&doc)
+                .is_empty()
+        );
+        assert_eq!(JsonPointer::parse("").unwrap().resolve(&doc).len(), 1);
+    }
+
+    #[test]
+    fn test_wildcard_expands_arrays() {
+        let doc = json!([
+            {"vlan_id": 10, "subnet": "10.1.2.0/24"},
+            {"vlan_id": 11, "subnet": "10.1.3.0/24"}
+        ]);
+        let matches = JsonPointer::parse("/*/subnet").unwrap().resolve(&doc);
+        let values: Vec<_> = matches
+            .iter()
+            .map(|(p, v)| (p.as_str(), display_value(v)))
+            .collect();
+        assert_eq!(
+            values,
+            vec![
+                ("/0/subnet", "10.1.2.0/24".to_string()),
+                ("/1/subnet", "10.1.3.0/24".to_string())
+            ]
+        );
+    }
+
+    #[test]
+    fn test_invalid_pointers_rejected() {
+        assert!(JsonPointer::parse("subnet").is_err());
+        assert!(JsonPointer::parse("/a~2").is_err());
+    }
+}
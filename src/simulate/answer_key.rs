@@ -0,0 +1,192 @@
+//! Ground-truth reachability of generated configurations
+//!
+//! An [`AnswerKey`] states what the generated firewall rules intend: for
+//! every ordered pair of VLANs, and from every VLAN to the internet, whether
+//! each service of the [traffic matrix](crate::simulate::change::SERVICES)
+//! passes and which rule decides it. Third-party analysis tools can be
+//! scored against it. Verdicts follow the evaluation described in
+//! [`crate::simulate`], between the matrix hosts `.10` (source) and `.20`
+//! (destination) of each VLAN.
+
+use crate::generator::{FirewallRule, VlanConfig};
+use crate::simulate::change::{EXTERNAL_HOST, SERVICES, matrix_hosts};
+use crate::simulate::{Flow, NetworkModel, Verdict, interface_name};
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+use std::net::Ipv4Addr;
+
+/// Format version of the answer key
+pub const ANSWER_KEY_VERSION: u32 = 1;
+
+/// Intended reachability of one generated configuration
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct AnswerKey {
+    /// Format version, see [`ANSWER_KEY_VERSION`]
+    pub version: u32,
+    /// Generator name and version
+    pub generator: String,
+    /// Seed of the generation run, if one was given
+    pub seed: Option<u64>,
+    /// Address standing in for the internet
+    pub external_host: Ipv4Addr,
+    /// Services checked per pair, as `tcp/443` or `icmp`
+    pub services: Vec<String>,
+    /// VLANs of the configuration
+    pub vlans: Vec<AnswerKeyVlan>,
+    /// One entry per ordered pair
+    pub reachability: Vec<Reachability>,
+}
+
+/// A VLAN as referenced by [`Reachability`]
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct AnswerKeyVlan {
+    /// VLAN ID
+    pub vlan_id: u16,
+    /// Network in CIDR notation
+    pub network: String,
+    /// Interface the VLAN's rules are on
+    pub interface: String,
+    /// Source address of flows from this VLAN
+    pub source_host: Ipv4Addr,
+    /// Destination address of flows to this VLAN
+    pub destination_host: Ipv4Addr,
+}
+
+/// Intended outcome of every service from one VLAN to another
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Reachability {
+    /// Source VLAN ID
+    pub from_vlan: u16,
+    /// Destination VLAN ID; `null` for the external host
+    pub to_vlan: Option<u16>,
+    /// Outcome per service
+    pub services: BTreeMap<String, Outcome>,
+}
+
+impl Reachability {
+    /// Services that pass
+    pub fn allowed(&self) -> impl Iterator<Item = &str> {
+        self.services
+            .iter()
+            .filter(|(_, outcome)| outcome.verdict == Verdict::Pass)
+            .map(|(service, _)| service.as_str())
+    }
+}
+
+/// Intended outcome of one service
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Outcome {
+    /// Whether the flow passes
+    pub verdict: Verdict,
+    /// Id of the deciding rule; `null` when the default deny decides
+    pub rule: Option<String>,
+}
+
+impl AnswerKey {
+    /// Trace every pair of the configuration's VLANs through its rules
+    pub fn build(vlans: &[VlanConfig], rules: &[FirewallRule], seed: Option<u64>) -> Self {
+        let model = NetworkModel::new(vlans.to_vec(), rules.to_vec());
+        let hosts = matrix_hosts(&model);
+
+        let vlans = hosts
+            .iter()
+            .filter_map(|&(vlan_id, source_host, destination_host)| {
+                let vlan = model.vlans().iter().find(|v| v.vlan_id == vlan_id)?;
+                Some(AnswerKeyVlan {
+                    vlan_id,
+                    network: vlan.as_ipv4_network().ok()?.to_string(),
+                    interface: interface_name(vlan),
+                    source_host,
+                    destination_host,
+                })
+            })
+            .collect();
+
+        let mut reachability = Vec::new();
+        for &(from_vlan, source, _) in &hosts {
+            let targets = hosts
+                .iter()
+                .filter(|&&(id, _, _)| id != from_vlan)
+                .map(|&(id, _, destination)| (Some(id), destination))
+                .chain([(None, EXTERNAL_HOST)]);
+            for (to_vlan, destination) in targets {
+                let services = SERVICES
+                    .iter()
+                    .map(|&(protocol, port)| {
+                        let trace = model.trace(&Flow {
+                            source,
+                            destination,
+                            protocol: protocol.to_string(),
+                            port,
+                        });
+                        let outcome = Outcome {
+                            verdict: trace.verdict,
+                            rule: trace
+                                .deciding_rule()
+                                .map(|index| model.rules()[index].rule_id.clone()),
+                        };
+                        (service_name(protocol, port), outcome)
+                    })
+                    .collect();
+                reachability.push(Reachability {
+                    from_vlan,
+                    to_vlan,
+                    services,
+                });
+            }
+        }
+
+        Self {
+            version: ANSWER_KEY_VERSION,
+            generator: format!("opnsense-config-faker {}", crate::VERSION),
+            seed,
+            external_host: EXTERNAL_HOST,
+            services: SERVICES
+                .iter()
+                .map(|&(p, port)| service_name(p, port))
+                .collect(),
+            vlans,
+            reachability,
+        }
+    }
+}
+
+fn service_name(protocol: &str, port: Option<u16>) -> String {
+    match port {
+        Some(port) => format!("{protocol}/{port}"),
+        None => protocol.to_string(),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::generator::firewall::{FirewallComplexity, generate_firewall_rules};
+
+    #[test]
+    fn test_answer_key_follows_generated_rules() {
+        let vlans = vec![
+            VlanConfig::new(120, "10.10.20.x".to_string(), "Sales".to_string(), 1).unwrap(),
+            VlanConfig::new(340, "192.168.40.x".to_string(), "IT".to_string(), 1).unwrap(),
+        ];
+        let rules = generate_firewall_rules(&vlans, FirewallComplexity::Basic, Some(7), None, None)
+            .unwrap();
+        let key = AnswerKey::build(&vlans, &rules, Some(7));
+
+        assert_eq!(key.vlans.len(), 2);
+        // Two VLANs, each to the other and to the internet
+        assert_eq!(key.reachability.len(), 4);
+        let to_internet = key
+            .reachability
+            .iter()
+            .find(|r| r.from_vlan == 120 && r.to_vlan.is_none())
+            .unwrap();
+        // Basic rules allow DNS and web access out of each VLAN
+        let allowed: Vec<&str> = to_internet.allowed().collect();
+        assert_eq!(allowed, ["tcp/443", "tcp/80", "udp/53"]);
+        assert!(to_internet.services["tcp/22"].rule.is_none());
+
+        let json = serde_json::to_string(&key).unwrap();
+        assert_eq!(serde_json::from_str::<AnswerKey>(&json).unwrap(), key);
+    }
+}
@@ -0,0 +1,355 @@
+//! What-if analysis of a firewall rule change
+//!
+//! [`analyze_change`] traces a traffic matrix through a model before and
+//! after adding one rule and reports every flow the rule touches:
+//!
+//! - `verdict-change`: the new rule decides and the flow now passes where it
+//!   was blocked, or the other way around
+//! - `takes-over`: the new rule decides with the same verdict, so the rule
+//!   that decided before is shadowed for this flow
+//! - `shadowed`: the flow matches the new rule, but an earlier rule still
+//!   decides it
+//!
+//! The matrix ([`sample_flows`]) pairs a host of every VLAN with a host of
+//! every other VLAN and an external address over common services, and is
+//! sampled with a seed when it is larger than requested.
+//!
+//! Rules to add are written as
+//! `<pass|block|reject> [tcp|udp|icmp|any] from <addr> to <addr> [port <ports>]
+//! on <interface> [priority <n>]`, e.g.
+//! `block tcp from 10.10.20.x to any port 445 on vlan120`. Without a priority
+//! the rule goes first on its interface.
+
+use crate::Result;
+use crate::generator::FirewallRule;
+use crate::model::ConfigError;
+use crate::simulate::{Flow, NetworkModel, Verdict};
+use rand::SeedableRng;
+use rand::seq::index;
+use rand_chacha::ChaCha8Rng;
+use serde::Serialize;
+use std::collections::BTreeSet;
+use std::fmt;
+use std::net::Ipv4Addr;
+
+/// External address used as a destination, from TEST-NET-3
+pub const EXTERNAL_HOST: Ipv4Addr = Ipv4Addr::new(203, 0, 113, 10);
+
+/// Services of the traffic matrix
+pub const SERVICES: &[(&str, Option<u16>)] = &[
+    ("tcp", Some(22)),
+    ("tcp", Some(80)),
+    ("tcp", Some(443)),
+    ("tcp", Some(445)),
+    ("tcp", Some(3389)),
+    ("udp", Some(53)),
+    ("udp", Some(123)),
+    ("icmp", None),
+];
+
+/// Host number of the source address within a VLAN
+const SOURCE_HOST: u32 = 10;
+
+/// Host number of the destination address within a VLAN
+const DESTINATION_HOST: u32 = 20;
+
+/// Rule id given to parsed rules
+const WHAT_IF_RULE_ID: &str = "what-if";
+
+/// How the new rule affects a flow
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Serialize)]
+#[serde(rename_all = "kebab-case")]
+pub enum ImpactKind {
+    /// The new rule decides and the verdict changes
+    VerdictChange,
+    /// The new rule decides with the verdict unchanged
+    TakesOver,
+    /// The flow matches the new rule, but an earlier rule decides
+    Shadowed,
+}
+
+impl fmt::Display for ImpactKind {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(match self {
+            ImpactKind::VerdictChange => "verdict-change",
+            ImpactKind::TakesOver => "takes-over",
+            ImpactKind::Shadowed => "shadowed",
+        })
+    }
+}
+
+/// A flow the new rule touches
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct FlowImpact {
+    /// The flow
+    pub flow: Flow,
+    /// How it is affected
+    pub kind: ImpactKind,
+    /// Verdict without the new rule
+    pub before: Verdict,
+    /// Verdict with the new rule
+    pub after: Verdict,
+    /// Rule that decided without the new rule, the one that still decides
+    /// for `shadowed`; an index into [`NetworkModel::rules`]
+    pub other_rule: Option<usize>,
+}
+
+/// Result of [`analyze_change`]
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct ChangeReport {
+    /// Flows traced
+    pub flows: usize,
+    /// Affected flows, verdict changes first
+    pub impacts: Vec<FlowImpact>,
+    /// Rules that decided some traced flow before the change and none after,
+    /// as indexes into [`NetworkModel::rules`]
+    pub retired_rules: Vec<usize>,
+}
+
+impl ChangeReport {
+    /// Number of impacts of one kind
+    pub fn count(&self, kind: ImpactKind) -> usize {
+        self.impacts
+            .iter()
+            .filter(|impact| impact.kind == kind)
+            .count()
+    }
+}
+
+/// Parse a rule written as described in the [module docs](self)
+pub fn parse_rule_spec(spec: &str) -> Result<FirewallRule> {
+    let invalid = |reason: String| ConfigError::invalid_parameter("add-rule", reason);
+    let mut tokens = spec.split_whitespace().peekable();
+
+    let action = tokens
+        .next()
+        .map(str::to_lowercase)
+        .ok_or_else(|| invalid("the rule is empty".to_string()))?;
+    let protocol = match tokens.peek().map(|t| t.to_lowercase()) {
+        Some(p) if ["tcp", "udp", "icmp", "any"].contains(&p.as_str()) => {
+            tokens.next();
+            p
+        }
+        _ => "any".to_string(),
+    };
+
+    let mut value = |keyword: &str, required: bool| -> Result<Option<String>> {
+        match tokens.peek() {
+            Some(token) if token.eq_ignore_ascii_case(keyword) => {
+                tokens.next();
+                let value = tokens
+                    .next()
+                    .ok_or_else(|| invalid(format!("'{keyword}' needs a value")))?;
+                Ok(Some(value.to_string()))
+            }
+            _ if required => Err(invalid(format!(
+                "expected '{keyword}' in '{spec}', e.g. 'block tcp from 10.1.2.x to any \
+                 port 445 on vlan12'"
+            ))),
+            _ => Ok(None),
+        }
+    };
+    let source = value("from", true)?.unwrap_or_default();
+    let destination = value("to", true)?.unwrap_or_default();
+    let ports = value("port", false)?.unwrap_or_else(|| "any".to_string());
+    let interface = value("on", true)?.unwrap_or_default().to_lowercase();
+    let priority = match value("priority", false)? {
+        Some(p) => p
+            .parse::<u16>()
+            .ok()
+            .filter(|&p| p > 0)
+            .ok_or_else(|| invalid(format!("priority '{p}' is not a positive number")))?,
+        None => 1,
+    };
+    if let Some(extra) = tokens.next() {
+        return Err(invalid(format!("unexpected '{extra}' in '{spec}'")));
+    }
+
+    let vlan_id = interface
+        .strip_prefix("vlan")
+        .and_then(|id| id.parse().ok());
+    FirewallRule::new(
+        WHAT_IF_RULE_ID.to_string(),
+        source,
+        destination,
+        protocol,
+        ports,
+        action,
+        "in".to_string(),
+        format!("what-if: {spec}"),
+        false,
+        vlan_id,
+        priority,
+        interface,
+    )
+}
+
+/// Source and destination host of each VLAN in the traffic matrix, with its
+/// VLAN ID
+pub fn matrix_hosts(model: &NetworkModel) -> Vec<(u16, Ipv4Addr, Ipv4Addr)> {
+    model
+        .vlans()
+        .iter()
+        .filter_map(|vlan| {
+            let base = u32::from(vlan.as_ipv4_network().ok()?.network());
+            Some((
+                vlan.vlan_id,
+                Ipv4Addr::from(base + SOURCE_HOST),
+                Ipv4Addr::from(base + DESTINATION_HOST),
+            ))
+        })
+        .collect()
+}
+
+/// Traffic matrix of the model's VLANs, sampled down to `samples` flows
+pub fn sample_flows(model: &NetworkModel, samples: usize, seed: u64) -> Vec<Flow> {
+    let hosts = matrix_hosts(model);
+    let vlans = hosts.len();
+    // Per source: every other VLAN plus the external host
+    let total = vlans * vlans * SERVICES.len();
+
+    let flow = |i: usize| {
+        let (protocol, port) = SERVICES[i % SERVICES.len()];
+        let pair = i / SERVICES.len();
+        let (source, target) = (pair / vlans, pair % vlans);
+        let destination = match target {
+            t if t + 1 == vlans => EXTERNAL_HOST,
+            t if t >= source => hosts[t + 1].2,
+            t => hosts[t].2,
+        };
+        Flow {
+            source: hosts[source].1,
+            destination,
+            protocol: protocol.to_string(),
+            port,
+        }
+    };
+
+    if total <= samples {
+        return (0..total).map(flow).collect();
+    }
+    let mut rng = ChaCha8Rng::seed_from_u64(seed);
+    let mut picked = index::sample(&mut rng, total, samples).into_vec();
+    picked.sort_unstable();
+    picked.into_iter().map(flow).collect()
+}
+
+/// Trace `flows` with and without `rule` and report what changes
+pub fn analyze_change(model: &NetworkModel, rule: FirewallRule, flows: &[Flow]) -> ChangeReport {
+    let mut changed = model.clone();
+    let new_rule = changed.insert_rule(rule);
+
+    let mut impacts = Vec::new();
+    let mut deciding_before = BTreeSet::new();
+    let mut deciding_after = BTreeSet::new();
+    for flow in flows {
+        let before = model.trace(flow);
+        let after = changed.trace(flow);
+        deciding_before.extend(before.deciding_rule());
+        deciding_after.extend(after.deciding_rule());
+
+        let matches_new = after
+            .checks
+            .iter()
+            .any(|check| check.matched.contains(&new_rule));
+        if !matches_new {
+            continue;
+        }
+        let (kind, other_rule) = if after.deciding_rule() == Some(new_rule) {
+            let kind = if after.verdict != before.verdict {
+                ImpactKind::VerdictChange
+            } else {
+                ImpactKind::TakesOver
+            };
+            (kind, before.deciding_rule())
+        } else {
+            (ImpactKind::Shadowed, after.deciding_rule())
+        };
+        impacts.push(FlowImpact {
+            flow: flow.clone(),
+            kind,
+            before: before.verdict,
+            after: after.verdict,
+            other_rule,
+        });
+    }
+    impacts.sort_by_key(|impact| impact.kind);
+
+    ChangeReport {
+        flows: flows.len(),
+        impacts,
+        retired_rules: deciding_before
+            .difference(&deciding_after)
+            .copied()
+            .collect(),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::generator::VlanConfig;
+
+    fn model() -> NetworkModel {
+        let vlans = vec![
+            VlanConfig::new(120, "10.10.20.x".to_string(), "Sales".to_string(), 1).unwrap(),
+            VlanConfig::new(340, "192.168.40.x".to_string(), "Servers".to_string(), 1).unwrap(),
+        ];
+        let rules = vec![
+            parse_rule_spec("block tcp from 10.10.20.x to any port 22 on vlan120 priority 1")
+                .unwrap(),
+            parse_rule_spec("pass any from 10.10.20.x to any on vlan120 priority 2").unwrap(),
+        ];
+        NetworkModel::new(vlans, rules)
+    }
+
+    #[test]
+    fn test_parse_rule_spec() {
+        let rule =
+            parse_rule_spec("reject udp from any to 10.1.2.x port 53,123 on VLAN12").unwrap();
+        assert_eq!(rule.action, "reject");
+        assert_eq!(rule.protocol, "udp");
+        assert_eq!(rule.ports, "53,123");
+        assert_eq!(rule.interface, "vlan12");
+        assert_eq!(rule.vlan_id, Some(12));
+        assert_eq!(rule.priority, 1);
+
+        assert!(parse_rule_spec("block tcp to any on vlan12").is_err());
+        assert!(parse_rule_spec("allow tcp from any to any on vlan12").is_err());
+        assert!(parse_rule_spec("block from any to any on vlan12 now").is_err());
+    }
+
+    #[test]
+    fn test_sample_flows_covers_small_matrix() {
+        let model = model();
+        let flows = sample_flows(&model, 1000, 7);
+        assert_eq!(flows.len(), 2 * 2 * SERVICES.len());
+        assert!(flows.iter().any(|f| f.destination == EXTERNAL_HOST));
+        assert!(flows.iter().all(|f| f.source != f.destination));
+
+        let sampled = sample_flows(&model, 5, 7);
+        assert_eq!(sampled.len(), 5);
+        assert_eq!(sampled, sample_flows(&model, 5, 7));
+    }
+
+    #[test]
+    fn test_analyze_change_classifies_flows() {
+        let model = model();
+        let flows = sample_flows(&model, 1000, 7);
+        let rule =
+            parse_rule_spec("block tcp from 10.10.20.x to any port 22,445 on vlan120").unwrap();
+        let report = analyze_change(&model, rule, &flows);
+
+        // Port 445 from sales: passed before, blocked now (2 destinations)
+        assert_eq!(report.count(ImpactKind::VerdictChange), 2);
+        // Port 22: still blocked, now by the new rule
+        assert_eq!(report.count(ImpactKind::TakesOver), 2);
+        assert_eq!(report.retired_rules, [0]);
+
+        let rule =
+            parse_rule_spec("pass tcp from any to any port 22 on vlan120 priority 3").unwrap();
+        let report = analyze_change(&model, rule, &flows);
+        assert_eq!(report.count(ImpactKind::Shadowed), 2);
+        assert!(report.retired_rules.is_empty());
+    }
+}
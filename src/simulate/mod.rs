@@ -0,0 +1,649 @@
+//! Offline traffic simulation over generated configurations
+//!
+//! [`NetworkModel`] holds the VLANs, firewall rules, and port forwards of
+//! generated output, and [`NetworkModel::trace`] follows one [`Flow`]
+//! through it the way the firewall would:
+//!
+//! 1. A flow between two addresses of the same VLAN is switched, not routed,
+//!    and never reaches the filter.
+//! 2. A flow from outside every VLAN enters on the WAN. A port forward
+//!    matching its destination and port rewrites the destination and admits
+//!    it, as the forward's associated filter rule would.
+//! 3. The rules of the ingress interface are checked in priority order and
+//!    the first match decides; without a match the default deny blocks.
+//! 4. A flow to another VLAN is also checked against that VLAN's interface,
+//!    where a matching block or reject rule stops it. A flow to an address
+//!    outside every VLAN leaves through the source VLAN's WAN.
+//!
+//! Generated rules sit on the interface of the VLAN they were written for,
+//! so rule direction is reported but not used for matching. Rule addresses
+//! are `any`, an address, or a network (`10.1.2.x` or CIDR); aliases never
+//! match.
+//!
+//! [`change`] compares traces before and after adding a rule, and
+//! [`answer_key`] records the intended reachability of generated output.
+
+pub mod answer_key;
+pub mod change;
+
+use crate::Result;
+use crate::generator::{FirewallRule, VlanConfig};
+use crate::io::csv::{read_csv, read_firewall_rules_csv};
+use crate::io::previous::parse_vlans_from_xml;
+use crate::model::ConfigError;
+use crate::query::expr::parse_network;
+use crate::xml::tree::ConfigTree;
+use serde::{Deserialize, Serialize};
+use std::fmt;
+use std::fs;
+use std::net::Ipv4Addr;
+use std::path::Path;
+
+/// Interface name of traffic entering or leaving through a WAN
+pub const WAN_INTERFACE: &str = "wan";
+
+/// Traffic to evaluate
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct Flow {
+    /// Source address
+    pub source: Ipv4Addr,
+    /// Destination address
+    pub destination: Ipv4Addr,
+    /// Protocol in lowercase: tcp, udp, or icmp
+    pub protocol: String,
+    /// Destination port; `None` only matches rules for any port
+    pub port: Option<u16>,
+}
+
+impl fmt::Display for Flow {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "{} → {} {}",
+            self.source, self.destination, self.protocol
+        )?;
+        if let Some(port) = self.port {
+            write!(f, "/{port}")?;
+        }
+        Ok(())
+    }
+}
+
+/// Destination NAT from the WAN to an internal host
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct PortForward {
+    /// Protocol in lowercase, `any` for every protocol
+    pub protocol: String,
+    /// Public address; `None` forwards every destination
+    pub destination: Option<Ipv4Addr>,
+    /// Public ports, as in a rule (`443`, `8000:8080`, `any`)
+    pub ports: String,
+    /// Internal address traffic is forwarded to
+    pub target: Ipv4Addr,
+    /// Internal port; `None` keeps the original port
+    pub local_port: Option<u16>,
+    /// Description
+    pub description: String,
+}
+
+impl PortForward {
+    fn matches(&self, flow: &Flow) -> bool {
+        protocol_matches(&self.protocol, &flow.protocol)
+            && self.destination.is_none_or(|d| d == flow.destination)
+            && port_matches(&self.ports, flow.port)
+    }
+}
+
+/// How a trace ended
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum Verdict {
+    /// The flow reaches its destination
+    Pass,
+    /// A rule or the default deny stops the flow
+    Block,
+    /// Neither end is behind the firewall
+    NotRouted,
+}
+
+impl fmt::Display for Verdict {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(match self {
+            Verdict::Pass => "pass",
+            Verdict::Block => "block",
+            Verdict::NotRouted => "not routed",
+        })
+    }
+}
+
+/// Rule evaluation on one interface
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct InterfaceCheck {
+    /// Interface name, `vlan<id>` or [`WAN_INTERFACE`]
+    pub interface: String,
+    /// Whether the flow enters (true) or leaves through the interface
+    pub ingress: bool,
+    /// Indexes into [`NetworkModel::rules`] of every matching rule, in
+    /// evaluation order
+    pub matched: Vec<usize>,
+    /// Index of the rule that decided; the first match on ingress, the
+    /// first blocking match on egress
+    pub decided_by: Option<usize>,
+}
+
+/// Outcome of following a flow through the model
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct PathTrace {
+    /// Flow as given
+    pub flow: Flow,
+    /// Flow after destination NAT, with the index of the port forward
+    pub translated: Option<(Flow, usize)>,
+    /// Interface the flow enters on
+    pub ingress: String,
+    /// Interface the flow leaves through; `None` when it is not routed
+    pub egress: Option<String>,
+    /// Rule checks in the order they ran
+    pub checks: Vec<InterfaceCheck>,
+    /// Result
+    pub verdict: Verdict,
+    /// Why the trace ended the way it did
+    pub reason: String,
+}
+
+impl PathTrace {
+    /// Rule that decided the verdict, as an index into [`NetworkModel::rules`]
+    pub fn deciding_rule(&self) -> Option<usize> {
+        self.checks.iter().rev().find_map(|check| check.decided_by)
+    }
+}
+
+/// VLANs, firewall rules, and port forwards traffic is evaluated against
+#[derive(Debug, Clone, Default)]
+pub struct NetworkModel {
+    vlans: Vec<VlanConfig>,
+    rules: Vec<FirewallRule>,
+    forwards: Vec<PortForward>,
+}
+
+impl NetworkModel {
+    /// Model of the given VLANs and rules
+    pub fn new(vlans: Vec<VlanConfig>, rules: Vec<FirewallRule>) -> Self {
+        Self {
+            vlans,
+            rules,
+            forwards: Vec::new(),
+        }
+    }
+
+    /// Add port forwards
+    pub fn with_port_forwards(mut self, forwards: Vec<PortForward>) -> Self {
+        self.forwards.extend(forwards);
+        self
+    }
+
+    /// Load generated output: a VLAN or rules CSV, an XML configuration, or
+    /// a directory of them
+    ///
+    /// CSV files are recognized by their header and others are skipped. XML
+    /// files contribute their VLANs and the port forwards under `<nat>`.
+    /// Directories are read one level deep, in file name order; a VLAN seen
+    /// twice keeps its first definition.
+    pub fn load<P: AsRef<Path>>(path: P) -> Result<Self> {
+        let path = path.as_ref();
+        if !path.exists() {
+            return Err(ConfigError::ConfigNotFound {
+                path: path.display().to_string(),
+            });
+        }
+
+        let mut model = Self::default();
+        if path.is_dir() {
+            let mut files: Vec<_> = fs::read_dir(path)?
+                .filter_map(|entry| entry.ok().map(|e| e.path()))
+                .filter(|p| p.is_file())
+                .collect();
+            files.sort();
+            for file in files {
+                model.load_file(&file)?;
+            }
+        } else {
+            model.load_file(path)?;
+        }
+        Ok(model)
+    }
+
+    fn load_file(&mut self, path: &Path) -> Result<()> {
+        let ext = path
+            .extension()
+            .and_then(|ext| ext.to_str())
+            .map(str::to_ascii_lowercase);
+        match ext.as_deref() {
+            Some("xml") => {
+                let content = fs::read_to_string(path)?;
+                self.add_vlans(parse_vlans_from_xml(&content)?);
+                self.forwards
+                    .extend(parse_port_forwards(&ConfigTree::parse(&content)?));
+            }
+            Some("csv") => {
+                let mut reader = csv::Reader::from_path(path)?;
+                match reader.headers()?.get(0) {
+                    Some("VLAN") => self.add_vlans(read_csv(path)?),
+                    Some("rule_id") => self.rules.extend(read_firewall_rules_csv(path)?),
+                    _ => {}
+                }
+            }
+            _ => {}
+        }
+        Ok(())
+    }
+
+    fn add_vlans(&mut self, vlans: Vec<VlanConfig>) {
+        for vlan in vlans {
+            if !self.vlans.iter().any(|v| v.vlan_id == vlan.vlan_id) {
+                self.vlans.push(vlan);
+            }
+        }
+    }
+
+    /// Add a rule at its priority on its interface
+    ///
+    /// Rules of the same interface at or below that priority move down by
+    /// one. Returns the index of the new rule; existing indexes stay valid.
+    pub fn insert_rule(&mut self, rule: FirewallRule) -> usize {
+        for existing in &mut self.rules {
+            if existing.interface.eq_ignore_ascii_case(&rule.interface)
+                && existing.priority >= rule.priority
+            {
+                existing.priority = existing.priority.saturating_add(1);
+            }
+        }
+        self.rules.push(rule);
+        self.rules.len() - 1
+    }
+
+    /// VLANs in load order
+    pub fn vlans(&self) -> &[VlanConfig] {
+        &self.vlans
+    }
+
+    /// Firewall rules in load order
+    pub fn rules(&self) -> &[FirewallRule] {
+        &self.rules
+    }
+
+    /// Port forwards in load order
+    pub fn port_forwards(&self) -> &[PortForward] {
+        &self.forwards
+    }
+
+    /// VLAN whose network holds `address`
+    pub fn vlan_of(&self, address: Ipv4Addr) -> Option<&VlanConfig> {
+        self.vlans
+            .iter()
+            .find(|vlan| vlan.as_ipv4_network().is_ok_and(|n| n.contains(address)))
+    }
+
+    /// Rules of an interface in evaluation order, as indexes into [`Self::rules`]
+    pub fn interface_rules(&self, interface: &str) -> Vec<usize> {
+        let mut indexes: Vec<usize> = (0..self.rules.len())
+            .filter(|&i| self.rules[i].interface.eq_ignore_ascii_case(interface))
+            .collect();
+        indexes.sort_by_key(|&i| self.rules[i].priority);
+        indexes
+    }
+
+    /// Follow a flow through the model
+    pub fn trace(&self, flow: &Flow) -> PathTrace {
+        let source_vlan = self.vlan_of(flow.source);
+        let mut trace = PathTrace {
+            flow: flow.clone(),
+            translated: None,
+            ingress: source_vlan.map_or(WAN_INTERFACE.to_string(), interface_name),
+            egress: None,
+            checks: Vec::new(),
+            verdict: Verdict::Block,
+            reason: String::new(),
+        };
+
+        // Destination NAT applies to traffic arriving on the WAN
+        let mut effective = flow.clone();
+        if source_vlan.is_none()
+            && let Some(index) = self.forwards.iter().position(|f| f.matches(flow))
+        {
+            let forward = &self.forwards[index];
+            effective.destination = forward.target;
+            effective.port = forward.local_port.or(flow.port);
+            trace.translated = Some((effective.clone(), index));
+        }
+        let destination_vlan = self.vlan_of(effective.destination);
+
+        match (source_vlan, destination_vlan) {
+            (None, None) => {
+                trace.verdict = Verdict::NotRouted;
+                trace.reason = "neither address is in a generated VLAN".to_string();
+                return trace;
+            }
+            (Some(source), Some(destination)) if source.vlan_id == destination.vlan_id => {
+                trace.egress = Some(trace.ingress.clone());
+                trace.verdict = Verdict::Pass;
+                trace.reason = format!(
+                    "both addresses are in VLAN {}; the traffic is switched, not filtered",
+                    source.vlan_id
+                );
+                return trace;
+            }
+            _ => {}
+        }
+        trace.egress = Some(destination_vlan.map_or(WAN_INTERFACE.to_string(), interface_name));
+
+        let ingress = self.check(&trace.ingress, true, &effective);
+        let decided = ingress.decided_by;
+        trace.checks.push(ingress);
+        let admitted_by = match (decided, &trace.translated) {
+            (Some(index), _) if !is_pass(&self.rules[index]) => {
+                trace.reason = format!(
+                    "blocked on {} by rule {}",
+                    trace.ingress,
+                    rule_label(self, index)
+                );
+                return trace;
+            }
+            (Some(index), _) => format!("rule {}", rule_label(self, index)),
+            (None, Some((_, index))) => {
+                format!(
+                    "port forward {}",
+                    forward_label(&self.forwards[*index], *index)
+                )
+            }
+            (None, None) => {
+                trace.reason = format!("no rule on {} matches; default deny", trace.ingress);
+                return trace;
+            }
+        };
+
+        if let Some(destination) = destination_vlan {
+            let egress = self.check(&interface_name(destination), false, &effective);
+            let blocked = egress.decided_by;
+            trace.checks.push(egress);
+            if let Some(index) = blocked {
+                trace.reason = format!(
+                    "blocked on {} by rule {}",
+                    interface_name(destination),
+                    rule_label(self, index)
+                );
+                return trace;
+            }
+        }
+
+        trace.verdict = Verdict::Pass;
+        trace.reason = match destination_vlan {
+            Some(destination) => {
+                format!(
+                    "passed by {admitted_by} and routed to VLAN {}",
+                    destination.vlan_id
+                )
+            }
+            None => format!(
+                "passed by {admitted_by} and leaves through WAN {}",
+                source_vlan.map_or(1, |v| v.wan_assignment)
+            ),
+        };
+        trace
+    }
+
+    fn check(&self, interface: &str, ingress: bool, flow: &Flow) -> InterfaceCheck {
+        let matched: Vec<usize> = self
+            .interface_rules(interface)
+            .into_iter()
+            .filter(|&i| rule_matches(&self.rules[i], flow))
+            .collect();
+        let decided_by = if ingress {
+            matched.first().copied()
+        } else {
+            // Return traffic state from the ingress pass lets everything else out
+            matched
+                .first()
+                .copied()
+                .filter(|&i| !is_pass(&self.rules[i]))
+        };
+        InterfaceCheck {
+            interface: interface.to_string(),
+            ingress,
+            matched,
+            decided_by,
+        }
+    }
+}
+
+/// Interface name generated rules use for a VLAN
+pub fn interface_name(vlan: &VlanConfig) -> String {
+    format!("vlan{}", vlan.vlan_id)
+}
+
+/// Whether a rule matches a flow's addresses, protocol, and port
+pub fn rule_matches(rule: &FirewallRule, flow: &Flow) -> bool {
+    address_matches(&rule.source, flow.source)
+        && address_matches(&rule.destination, flow.destination)
+        && protocol_matches(&rule.protocol, &flow.protocol)
+        && (rule.protocol.eq_ignore_ascii_case("icmp") || port_matches(&rule.ports, flow.port))
+}
+
+/// Whether a rule address (`any`, an address, or a network) holds `address`
+pub fn address_matches(spec: &str, address: Ipv4Addr) -> bool {
+    let spec = spec.trim();
+    spec.eq_ignore_ascii_case("any") || parse_network(spec).is_some_and(|n| n.contains(address))
+}
+
+/// Whether a rule port list (`any`, `80,443`, `1024:65535`) holds `port`
+///
+/// A flow without a port only matches `any`.
+pub fn port_matches(spec: &str, port: Option<u16>) -> bool {
+    let spec = spec.trim();
+    if spec.is_empty() || spec.eq_ignore_ascii_case("any") {
+        return true;
+    }
+    let Some(port) = port else {
+        return false;
+    };
+    spec.split(',').any(|item| {
+        let item = item.trim();
+        match item.split_once([':', '-']) {
+            Some((start, end)) => match (start.trim().parse::<u16>(), end.trim().parse::<u16>()) {
+                (Ok(start), Ok(end)) => (start..=end).contains(&port),
+                _ => false,
+            },
+            None => item.parse::<u16>().is_ok_and(|p| p == port),
+        }
+    })
+}
+
+fn protocol_matches(spec: &str, protocol: &str) -> bool {
+    spec.eq_ignore_ascii_case("any") || spec.eq_ignore_ascii_case(protocol)
+}
+
+fn is_pass(rule: &FirewallRule) -> bool {
+    rule.action.eq_ignore_ascii_case("pass")
+}
+
+/// `<rule_id> (<description>)`
+pub fn rule_label(model: &NetworkModel, index: usize) -> String {
+    let rule = &model.rules[index];
+    format!("{} ({})", rule.rule_id, rule.description)
+}
+
+fn forward_label(forward: &PortForward, index: usize) -> String {
+    if forward.description.is_empty() {
+        format!("#{}", index + 1)
+    } else {
+        format!("#{} ({})", index + 1, forward.description)
+    }
+}
+
+/// Port forwards under `<nat>`, skipping disabled ones and those without an
+/// address target
+pub fn parse_port_forwards(tree: &ConfigTree) -> Vec<PortForward> {
+    let mut forwards = Vec::new();
+    for id in 0..tree.len() {
+        let node = tree.node(id);
+        if node.name != "rule" || node.parent.is_none_or(|p| tree.node(p).name != "nat") {
+            continue;
+        }
+        if tree.child_value(id, "disabled").is_some_and(|d| d == "1") {
+            continue;
+        }
+        let Some(target) = tree.child_value(id, "target").and_then(|t| t.parse().ok()) else {
+            continue;
+        };
+        let destination = node
+            .children
+            .iter()
+            .copied()
+            .find(|&c| tree.node(c).name == "destination");
+        let public = destination.and_then(|d| {
+            tree.child_value(d, "address")
+                .or_else(|| tree.child_value(d, "network"))
+                .and_then(|a| a.parse().ok())
+        });
+        forwards.push(PortForward {
+            protocol: tree
+                .child_value(id, "protocol")
+                .unwrap_or("any")
+                .to_lowercase(),
+            destination: public,
+            ports: destination
+                .and_then(|d| tree.child_value(d, "port"))
+                .unwrap_or("any")
+                .to_string(),
+            target,
+            local_port: tree
+                .child_value(id, "local-port")
+                .and_then(|p| p.parse().ok()),
+            description: tree
+                .child_value(id, "descr")
+                .unwrap_or_default()
+                .to_string(),
+        });
+    }
+    forwards
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn rule(
+        id: &str,
+        source: &str,
+        destination: &str,
+        ports: &str,
+        action: &str,
+        vlan: u16,
+    ) -> FirewallRule {
+        FirewallRule::new(
+            id.to_string(),
+            source.to_string(),
+            destination.to_string(),
+            "tcp".to_string(),
+            ports.to_string(),
+            action.to_string(),
+            "in".to_string(),
+            format!("{action} {ports}"),
+            false,
+            Some(vlan),
+            0,
+            format!("vlan{vlan}"),
+        )
+        .unwrap()
+    }
+
+    fn model() -> NetworkModel {
+        let vlans = vec![
+            VlanConfig::new(120, "10.10.20.x".to_string(), "Sales".to_string(), 2).unwrap(),
+            VlanConfig::new(340, "192.168.40.x".to_string(), "Servers".to_string(), 1).unwrap(),
+        ];
+        let mut rules = vec![
+            rule("r1", "10.10.20.x", "any", "22", "block", 120),
+            rule("r2", "10.10.20.x", "any", "80,443", "pass", 120),
+            rule("r3", "any", "192.168.40.x", "3389", "block", 340),
+            rule("r4", "10.10.20.x", "any", "any", "pass", 120),
+        ];
+        for (priority, rule) in rules.iter_mut().enumerate() {
+            rule.priority = priority as u16 + 1;
+        }
+        NetworkModel::new(vlans, rules)
+    }
+
+    fn flow(source: &str, destination: &str, port: u16) -> Flow {
+        Flow {
+            source: source.parse().unwrap(),
+            destination: destination.parse().unwrap(),
+            protocol: "tcp".to_string(),
+            port: Some(port),
+        }
+    }
+
+    #[test]
+    fn test_trace_first_match_and_egress_block() {
+        let model = model();
+
+        let trace = model.trace(&flow("10.10.20.5", "192.168.40.10", 443));
+        assert_eq!(trace.verdict, Verdict::Pass);
+        assert_eq!(trace.egress.as_deref(), Some("vlan340"));
+        assert_eq!(trace.checks[0].matched, [1, 3]);
+        assert_eq!(trace.deciding_rule(), Some(1));
+
+        let trace = model.trace(&flow("10.10.20.5", "192.168.40.10", 22));
+        assert_eq!(trace.verdict, Verdict::Block);
+        assert_eq!(trace.deciding_rule(), Some(0));
+
+        // Passed on ingress by r4, stopped where it leaves by r3
+        let trace = model.trace(&flow("10.10.20.5", "192.168.40.10", 3389));
+        assert_eq!(trace.verdict, Verdict::Block);
+        assert_eq!(trace.checks[1].decided_by, Some(2));
+
+        // No rules on the servers VLAN pass anything out of it
+        let trace = model.trace(&flow("192.168.40.10", "8.8.8.8", 443));
+        assert_eq!(trace.verdict, Verdict::Block);
+        assert!(trace.reason.contains("default deny"));
+
+        assert_eq!(
+            model.trace(&flow("10.10.20.5", "10.10.20.6", 22)).verdict,
+            Verdict::Pass
+        );
+        assert_eq!(
+            model.trace(&flow("1.1.1.1", "8.8.8.8", 22)).verdict,
+            Verdict::NotRouted
+        );
+    }
+
+    #[test]
+    fn test_port_forward_admits_wan_traffic() {
+        let tree = ConfigTree::parse(
+            "<opnsense><nat><rule><protocol>tcp</protocol><target>192.168.40.10</target>\
+             <local-port>8443</local-port><destination><address>203.0.113.5</address>\
+             <port>443</port></destination></rule></nat></opnsense>",
+        )
+        .unwrap();
+        let model = model().with_port_forwards(parse_port_forwards(&tree));
+
+        let trace = model.trace(&flow("198.51.100.7", "203.0.113.5", 443));
+        assert_eq!(trace.verdict, Verdict::Pass);
+        assert_eq!(trace.ingress, "wan");
+        let (translated, _) = trace.translated.unwrap();
+        assert_eq!(translated.port, Some(8443));
+
+        let trace = model.trace(&flow("198.51.100.7", "203.0.113.5", 80));
+        assert_eq!(trace.verdict, Verdict::NotRouted);
+    }
+
+    #[test]
+    fn test_port_matching() {
+        assert!(port_matches("any", None));
+        assert!(port_matches("80,443", Some(443)));
+        assert!(port_matches("6881:6889,51413", Some(6885)));
+        assert!(!port_matches("80,443", Some(8080)));
+        assert!(!port_matches("443", None));
+        assert!(address_matches("10.10.20.x", "10.10.20.9".parse().unwrap()));
+        assert!(!address_matches("NET_ALIAS", "10.10.20.9".parse().unwrap()));
+    }
+}
@@ -1,3 +1,5 @@
 //! Utility functions for network operations
 
+pub mod repro;
 pub mod rfc1918;
+pub mod workspace;
@@ -0,0 +1,143 @@
+//! Content digests for checking byte-for-byte reproducibility
+//!
+//! A [`TreeDigest`] fingerprints every file under an output directory. Paths
+//! are recorded relative to the root with `/` separators and hashed in sorted
+//! order, so the combined digest of identical output is the same on Linux,
+//! macOS, and Windows and can be compared across machines.
+
+use crate::Result;
+use sha2::{Digest, Sha256};
+use std::fs;
+use std::path::Path;
+
+/// SHA-256 digest of one output file
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct FileDigest {
+    /// Path relative to the digested root, `/`-separated
+    pub path: String,
+    /// Lowercase hex SHA-256 of the file contents
+    pub sha256: String,
+}
+
+/// Digests of every file under a directory
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct TreeDigest {
+    files: Vec<FileDigest>,
+    combined: String,
+}
+
+impl TreeDigest {
+    /// Per-file digests, sorted by path
+    pub fn files(&self) -> &[FileDigest] {
+        &self.files
+    }
+
+    /// Digest over all paths and contents
+    pub fn combined(&self) -> &str {
+        &self.combined
+    }
+
+    /// Paths whose content differs from `other`, or that exist in only one tree
+    pub fn differing_files(&self, other: &TreeDigest) -> Vec<String> {
+        let mut paths: Vec<String> = self
+            .files
+            .iter()
+            .filter(|f| !other.files.contains(f))
+            .chain(other.files.iter().filter(|f| !self.files.contains(f)))
+            .map(|f| f.path.clone())
+            .collect();
+        paths.sort();
+        paths.dedup();
+        paths
+    }
+}
+
+/// Digest every regular file below `root`
+pub fn digest_tree(root: &Path) -> Result<TreeDigest> {
+    let mut files = Vec::new();
+    collect_files(root, "", &mut files)?;
+    files.sort_by(|a, b| a.path.cmp(&b.path));
+
+    let mut hasher = Sha256::new();
+    for file in &files {
+        hasher.update(file.path.as_bytes());
+        hasher.update([0u8]);
+        hasher.update(file.sha256.as_bytes());
+        hasher.update([b'\n']);
+    }
+
+    Ok(TreeDigest {
+        files,
+        combined: to_hex(&hasher.finalize()),
+    })
+}
+
+fn collect_files(dir: &Path, prefix: &str, files: &mut Vec<FileDigest>) -> Result<()> {
+    for entry in fs::read_dir(dir)? {
+        let entry = entry?;
+        let name = entry.file_name().to_string_lossy().into_owned();
+        let relative = if prefix.is_empty() {
+            name
+        } else {
+            format!("{prefix}/{name}")
+        };
+
+        let file_type = entry.file_type()?;
+        if file_type.is_dir() {
+            collect_files(&entry.path(), &relative, files)?;
+        } else if file_type.is_file() {
+            let contents = fs::read(entry.path())?;
+            files.push(FileDigest {
+                path: relative,
+                sha256: to_hex(&Sha256::digest(&contents)),
+            });
+        }
+    }
+    Ok(())
+}
+
+fn to_hex(bytes: &[u8]) -> String {
+    bytes.iter().map(|b| format!("{b:02x}")).collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_identical_trees_share_digest() {
+        let a = TempDir::new().unwrap();
+        let b = TempDir::new().unwrap();
+        for dir in [a.path(), b.path()] {
+            fs::create_dir(dir.join("sub")).unwrap();
+            fs::write(dir.join("vlans.csv"), "100,10.1.2.x\n").unwrap();
+            fs::write(dir.join("sub/fw.xml"), "<opnsense/>\n").unwrap();
+        }
+
+        let first = digest_tree(a.path()).unwrap();
+        let second = digest_tree(b.path()).unwrap();
+        assert_eq!(first.combined(), second.combined());
+        assert_eq!(first.files()[0].path, "sub/fw.xml");
+        assert!(first.differing_files(&second).is_empty());
+    }
+
+    #[test]
+    fn test_differing_files_reports_changed_and_missing() {
+        let a = TempDir::new().unwrap();
+        let b = TempDir::new().unwrap();
+        fs::write(a.path().join("same.csv"), "x").unwrap();
+        fs::write(b.path().join("same.csv"), "x").unwrap();
+        fs::write(a.path().join("changed.csv"), "1").unwrap();
+        fs::write(b.path().join("changed.csv"), "2").unwrap();
+        fs::write(a.path().join("only_a.csv"), "a").unwrap();
+
+        let first = digest_tree(a.path()).unwrap();
+        let second = digest_tree(b.path()).unwrap();
+        assert_ne!(first.combined(), second.combined());
+        assert_eq!(
+            first.differing_files(&second),
+            vec!["changed.csv".to_string(), "only_a.csv".to_string()]
+        );
+    }
+}
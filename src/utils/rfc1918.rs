@@ -2,6 +2,7 @@
 
 use crate::model::{VlanError, VlanResult};
 use ipnetwork::Ipv4Network;
+use std::collections::{BTreeMap, BTreeSet};
 use std::net::Ipv4Addr;
 
 /// RFC 1918 private address ranges
@@ -120,6 +121,147 @@ pub fn generate_random_class_c_network<R: rand::Rng>(rng: &mut R) -> Ipv4Network
         .expect("Generated network should be valid")
 }
 
+/// One of the three RFC 1918 private address blocks
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash, PartialOrd, Ord)]
+pub enum Rfc1918Class {
+    /// 10.0.0.0/8
+    A,
+    /// 172.16.0.0/12
+    B,
+    /// 192.168.0.0/16
+    C,
+}
+
+impl Rfc1918Class {
+    /// All classes, largest first
+    pub const ALL: [Rfc1918Class; 3] = [Rfc1918Class::A, Rfc1918Class::B, Rfc1918Class::C];
+
+    /// The full address block of this class
+    pub fn block(self) -> Ipv4Network {
+        let (addr, prefix) = match self {
+            Rfc1918Class::A => (Ipv4Addr::new(10, 0, 0, 0), 8),
+            Rfc1918Class::B => (Ipv4Addr::new(172, 16, 0, 0), 12),
+            Rfc1918Class::C => (Ipv4Addr::new(192, 168, 0, 0), 16),
+        };
+        Ipv4Network::new(addr, prefix).expect("RFC 1918 prefixes are valid")
+    }
+
+    /// Number of /24 subnets the class can hold
+    pub fn subnet_capacity(self) -> u32 {
+        1 << (24 - self.block().prefix())
+    }
+
+    /// Class containing an address, if it is RFC 1918
+    pub fn of(addr: Ipv4Addr) -> Option<Self> {
+        Self::ALL
+            .into_iter()
+            .find(|class| class.block().contains(addr))
+    }
+}
+
+/// Utilization of one RFC 1918 class, measured in /24 subnets
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct ClassUsage {
+    /// The class measured
+    pub class: Rfc1918Class,
+    /// Distinct /24 subnets in use
+    pub used_subnets: u32,
+}
+
+impl ClassUsage {
+    /// Fraction of the class in use (0.0 to 1.0)
+    pub fn fraction(&self) -> f64 {
+        self.used_subnets as f64 / self.class.subnet_capacity() as f64
+    }
+
+    /// Percentage in hundredths of a percent, rounded half up
+    ///
+    /// Integer arithmetic keeps printed values identical across platforms.
+    pub fn percent_hundredths(&self) -> u64 {
+        let capacity = self.class.subnet_capacity() as u64;
+        (self.used_subnets as u64 * 10_000 + capacity / 2) / capacity
+    }
+}
+
+impl std::fmt::Display for ClassUsage {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        let hundredths = self.percent_hundredths();
+        write!(
+            f,
+            "{}.{:02}% of {} ({} /24 subnets)",
+            hundredths / 100,
+            hundredths % 100,
+            self.class.block(),
+            self.used_subnets
+        )
+    }
+}
+
+/// Address-space consumption of a run, per RFC 1918 class
+#[derive(Debug, Clone, Default)]
+pub struct AddressSpaceUsage {
+    subnets: BTreeMap<Rfc1918Class, BTreeSet<u32>>,
+}
+
+impl AddressSpaceUsage {
+    /// Create an empty tracker
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Build usage from a set of networks
+    pub fn from_networks<I: IntoIterator<Item = Ipv4Network>>(networks: I) -> Self {
+        let mut usage = Self::new();
+        for network in networks {
+            usage.record(&network);
+        }
+        usage
+    }
+
+    /// Record a network; every /24 it covers counts once. Non-RFC 1918
+    /// networks are ignored.
+    pub fn record(&mut self, network: &Ipv4Network) {
+        let Some(class) = Rfc1918Class::of(network.network()) else {
+            return;
+        };
+        let first = u32::from(network.network()) >> 8;
+        let last = u32::from(network.broadcast()) >> 8;
+        self.subnets.entry(class).or_default().extend(first..=last);
+    }
+
+    /// Usage of one class
+    pub fn usage(&self, class: Rfc1918Class) -> ClassUsage {
+        ClassUsage {
+            class,
+            used_subnets: self.subnets.get(&class).map_or(0, |s| s.len() as u32),
+        }
+    }
+
+    /// Usage of every class that has at least one subnet in use
+    pub fn classes_in_use(&self) -> Vec<ClassUsage> {
+        Rfc1918Class::ALL
+            .into_iter()
+            .map(|class| self.usage(class))
+            .filter(|usage| usage.used_subnets > 0)
+            .collect()
+    }
+
+    /// Class with the lowest utilization fraction; ties go to the larger class
+    pub fn least_utilized(&self) -> Rfc1918Class {
+        Rfc1918Class::ALL
+            .into_iter()
+            .map(|class| self.usage(class))
+            .min_by(|a, b| {
+                // Cross-multiply to compare fractions exactly
+                let lhs = a.used_subnets as u64 * b.class.subnet_capacity() as u64;
+                let rhs = b.used_subnets as u64 * a.class.subnet_capacity() as u64;
+                lhs.cmp(&rhs)
+            })
+            .map(|usage| usage.class)
+            .unwrap_or(Rfc1918Class::A)
+    }
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -257,4 +399,52 @@ fn test_class_ranges() {
         assert_eq!(ranges.class_c.0, Ipv4Addr::new(192, 168, 0, 0));
         assert_eq!(ranges.class_c.1, Ipv4Addr::new(192, 168, 255, 255));
     }
+
+    #[test]
+    fn test_rfc1918_class_lookup_and_capacity() {
+        assert_eq!(
+            Rfc1918Class::of(Ipv4Addr::new(10, 1, 2, 3)),
+            Some(Rfc1918Class::A)
+        );
+        assert_eq!(
+            Rfc1918Class::of(Ipv4Addr::new(172, 20, 0, 1)),
+            Some(Rfc1918Class::B)
+        );
+        assert_eq!(
+            Rfc1918Class::of(Ipv4Addr::new(192, 168, 9, 1)),
+            Some(Rfc1918Class::C)
+        );
+        assert_eq!(Rfc1918Class::of(Ipv4Addr::new(8, 8, 8, 8)), None);
+
+        assert_eq!(Rfc1918Class::A.subnet_capacity(), 65_536);
+        assert_eq!(Rfc1918Class::B.subnet_capacity(), 4_096);
+        assert_eq!(Rfc1918Class::C.subnet_capacity(), 256);
+    }
+
+    #[test]
+    fn test_address_space_usage() {
+        let networks = [
+            "192.168.1.0/24",
+            "192.168.2.0/24",
+            "192.168.1.0/24",
+            "10.0.0.0/23",
+        ]
+        .iter()
+        .map(|n| n.parse::<Ipv4Network>().unwrap());
+        let usage = AddressSpaceUsage::from_networks(networks);
+
+        assert_eq!(usage.usage(Rfc1918Class::C).used_subnets, 2);
+        assert_eq!(usage.usage(Rfc1918Class::A).used_subnets, 2);
+        assert_eq!(usage.classes_in_use().len(), 2);
+        assert_eq!(
+            usage.usage(Rfc1918Class::C).to_string(),
+            "0.78% of 192.168.0.0/16 (2 /24 subnets)"
+        );
+        assert_eq!(usage.least_utilized(), Rfc1918Class::B);
+    }
+
+    #[test]
+    fn test_least_utilized_prefers_larger_class_on_tie() {
+        assert_eq!(AddressSpaceUsage::new().least_utilized(), Rfc1918Class::A);
+    }
 }
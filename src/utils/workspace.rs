@@ -0,0 +1,265 @@
+//! Concurrency-safe temporary workspaces for commands with intermediate files
+//!
+//! `repro-check` runs each generation in its own workspace; other commands
+//! that need scratch files should do the same. Every workspace is a freshly
+//! created, uniquely named directory under the system temp dir, so several
+//! instances running in the same CI job never collide. Workspaces are removed
+//! on drop and, once [`install_signal_cleanup`] has run, on SIGINT (Ctrl-C)
+//! and SIGTERM as well. Setting `keep` (the global `--keep-temp` flag) leaves
+//! them on disk for debugging.
+
+use crate::Result;
+use crate::model::ConfigError;
+use signal_hook::consts::{SIGINT, SIGTERM};
+use signal_hook::flag;
+use std::env;
+use std::fs;
+use std::io::ErrorKind;
+use std::path::{Path, PathBuf};
+use std::sync::atomic::{AtomicU64, AtomicUsize, Ordering};
+use std::sync::{Arc, Mutex};
+use std::thread;
+use std::time::{Duration, SystemTime, UNIX_EPOCH};
+
+/// Prefix of every workspace directory name
+const WORKSPACE_PREFIX: &str = "opnsense-config-faker";
+
+/// Attempts before giving up on finding an unused directory name
+const MAX_CREATE_ATTEMPTS: u32 = 16;
+
+/// How often the cleanup thread checks for a pending termination signal
+const SIGNAL_POLL_INTERVAL: Duration = Duration::from_millis(50);
+
+/// Per-process counter making names unique within one process
+static COUNTER: AtomicU64 = AtomicU64::new(0);
+
+/// Live workspaces to remove when a termination signal arrives
+static LIVE_WORKSPACES: Mutex<Vec<PathBuf>> = Mutex::new(Vec::new());
+
+/// A uniquely named temporary directory owned by one command invocation
+#[derive(Debug)]
+pub struct Workspace {
+    path: PathBuf,
+    keep: bool,
+}
+
+impl Workspace {
+    /// Create a workspace under the system temp directory
+    ///
+    /// `label` identifies the command (e.g. `"repro-check"`) in the directory name.
+    pub fn create(label: &str, keep: bool) -> Result<Self> {
+        Self::create_in(&env::temp_dir(), label, keep)
+    }
+
+    /// Create a workspace under a specific parent directory
+    pub fn create_in(parent: &Path, label: &str, keep: bool) -> Result<Self> {
+        fs::create_dir_all(parent)?;
+        let label = sanitize_label(label);
+
+        for _ in 0..MAX_CREATE_ATTEMPTS {
+            let path = parent.join(unique_name(&label));
+            // create_dir (not create_dir_all) fails if the name is taken, which
+            // makes creation atomic across processes
+            match fs::create_dir(&path) {
+                Ok(()) => {
+                    if !keep {
+                        register(&path);
+                    }
+                    return Ok(Self { path, keep });
+                }
+                Err(e) if e.kind() == ErrorKind::AlreadyExists => continue,
+                Err(e) => return Err(e.into()),
+            }
+        }
+
+        Err(ConfigError::resource_exhausted(format!(
+            "unique workspace directory names in {}",
+            parent.display()
+        )))
+    }
+
+    /// Workspace root directory
+    pub fn path(&self) -> &Path {
+        &self.path
+    }
+
+    /// Path of an entry inside the workspace
+    pub fn join<P: AsRef<Path>>(&self, relative: P) -> PathBuf {
+        self.path.join(relative)
+    }
+
+    /// Create a subdirectory inside the workspace
+    pub fn subdir<P: AsRef<Path>>(&self, relative: P) -> Result<PathBuf> {
+        let dir = self.path.join(relative);
+        fs::create_dir_all(&dir)?;
+        Ok(dir)
+    }
+
+    /// Whether the workspace is kept on disk after use
+    pub fn is_kept(&self) -> bool {
+        self.keep
+    }
+
+    /// Keep the workspace and return its path, e.g. after a failure worth inspecting
+    pub fn persist(mut self) -> PathBuf {
+        self.keep = true;
+        unregister(&self.path);
+        self.path.clone()
+    }
+}
+
+impl Drop for Workspace {
+    fn drop(&mut self) {
+        if self.keep {
+            return;
+        }
+        unregister(&self.path);
+        // Best effort: a leftover temp dir must not turn success into failure
+        let _ = fs::remove_dir_all(&self.path);
+    }
+}
+
+/// Remove every live workspace; called from the signal handler
+pub fn cleanup_all() {
+    let paths = match LIVE_WORKSPACES.lock() {
+        Ok(mut live) => std::mem::take(&mut *live),
+        Err(poisoned) => std::mem::take(&mut *poisoned.into_inner()),
+    };
+    for path in paths {
+        let _ = fs::remove_dir_all(path);
+    }
+}
+
+/// Remove live workspaces and exit when SIGINT or SIGTERM arrives
+///
+/// The signal handlers only record which signal arrived; a background thread
+/// notices it and does the cleanup, because removing directories is not
+/// async-signal-safe.
+pub fn install_signal_cleanup() -> Result<()> {
+    let pending = Arc::new(AtomicUsize::new(0));
+    for signal in [SIGINT, SIGTERM] {
+        // The value stored is the conventional 128 + signal exit status
+        flag::register_usize(signal, Arc::clone(&pending), 128 + signal as usize)
+            .map_err(|e| ConfigError::config(format!("Failed to install signal handler: {e}")))?;
+    }
+
+    thread::Builder::new()
+        .name("workspace-cleanup".to_string())
+        .spawn(move || {
+            loop {
+                let status = pending.load(Ordering::SeqCst);
+                if status != 0 {
+                    cleanup_all();
+                    std::process::exit(status as i32);
+                }
+                thread::sleep(SIGNAL_POLL_INTERVAL);
+            }
+        })
+        .map_err(|e| ConfigError::config(format!("Failed to start signal handler thread: {e}")))?;
+    Ok(())
+}
+
+fn register(path: &Path) {
+    if let Ok(mut live) = LIVE_WORKSPACES.lock() {
+        live.push(path.to_path_buf());
+    }
+}
+
+fn unregister(path: &Path) {
+    if let Ok(mut live) = LIVE_WORKSPACES.lock() {
+        live.retain(|p| p != path);
+    }
+}
+
+/// Build a directory name unique across processes and threads
+fn unique_name(label: &str) -> String {
+    let nanos = SystemTime::now()
+        .duration_since(UNIX_EPOCH)
+        .map(|d| d.subsec_nanos())
+        .unwrap_or_default();
+    let counter = COUNTER.fetch_add(1, Ordering::Relaxed);
+    format!(
+        "{WORKSPACE_PREFIX}-{label}-{}-{counter}-{nanos:08x}",
+        std::process::id()
+    )
+}
+
+/// Restrict labels to characters that are safe in file names on every platform
+fn sanitize_label(label: &str) -> String {
+    let cleaned: String = label
+        .chars()
+        .map(|c| {
+            if c.is_ascii_alphanumeric() || c == '-' || c == '_' {
+                c
+            } else {
+                '_'
+            }
+        })
+        .collect();
+    if cleaned.is_empty() {
+        "work".to_string()
+    } else {
+        cleaned
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_workspace_removed_on_drop() {
+        let parent = TempDir::new().unwrap();
+        let path = {
+            let ws = Workspace::create_in(parent.path(), "repro-check", false).unwrap();
+            fs::write(ws.join("intermediate.xml"), "<x/>").unwrap();
+            assert!(ws.path().is_dir());
+            ws.path().to_path_buf()
+        };
+        assert!(!path.exists());
+    }
+
+    #[test]
+    fn test_workspace_kept_when_requested() {
+        let parent = TempDir::new().unwrap();
+        let path = {
+            let ws = Workspace::create_in(parent.path(), "repro-check", true).unwrap();
+            assert!(ws.is_kept());
+            ws.path().to_path_buf()
+        };
+        assert!(path.exists());
+
+        let ws = Workspace::create_in(parent.path(), "repro-check", false).unwrap();
+        let persisted = ws.persist();
+        assert!(persisted.exists());
+    }
+
+    #[test]
+    fn test_workspaces_are_unique_across_threads() {
+        let parent = TempDir::new().unwrap();
+        let parent_path = parent.path().to_path_buf();
+        let handles: Vec<_> = (0..8)
+            .map(|_| {
+                let parent_path = parent_path.clone();
+                std::thread::spawn(move || {
+                    Workspace::create_in(&parent_path, "repro-check", true)
+                        .unwrap()
+                        .path()
+                        .to_path_buf()
+                })
+            })
+            .collect();
+
+        let mut paths: Vec<PathBuf> = handles.into_iter().map(|h| h.join().unwrap()).collect();
+        paths.sort();
+        paths.dedup();
+        assert_eq!(paths.len(), 8);
+    }
+
+    #[test]
+    fn test_sanitize_label() {
+        assert_eq!(sanitize_label("a/b c"), "a_b_c");
+        assert_eq!(sanitize_label(""), "work");
+    }
+}
@@ -0,0 +1,407 @@
+//! User-defined lint rules for OPNsense configurations
+//!
+//! Organizations encode their own standards as rules in a YAML file, checked
+//! by `validate --rules` against generated and real `config.xml` files alike:
+//!
+//! ```yaml
+//! rules:
+//!   - id: vlan-tag-unique
+//!     path: //vlans/vlan/tag
+//!     predicate: not duplicate value
+//!     severity: error
+//!     message: "VLAN tag {value} is used more than once"
+//! ```
+//!
+//! Files with a `.json` extension are read as JSON instead.
+//!
+//! `path` selects nodes with the [XPath subset](crate::xml::xpath) of
+//! `extract`. `predicate` uses the [`query --where`](crate::query::expr)
+//! language over the fields `value` (the node's text), `path` (its absolute
+//! path), and `count` (how many nodes the path matched); every matched node
+//! must satisfy it. A rule with `"required": true` also fails when the path
+//! matches nothing. `{value}` and `{path}` in the message are replaced with
+//! the offending node's.
+
+use crate::Result;
+use crate::model::ConfigError;
+use crate::query::Expr;
+use crate::query::expr;
+use crate::xml::{XPath, XPathMatch};
+use serde::{Deserialize, Serialize};
+use std::collections::{HashMap, HashSet};
+use std::fmt;
+use std::fs;
+use std::path::Path;
+
+/// Fields a predicate may reference
+const FIELDS: &[&str] = &["value", "path", "count"];
+
+/// How serious a violated rule is
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, PartialOrd, Ord, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Severity {
+    /// Noteworthy, never fails validation
+    Info,
+    /// Deviation from a standard, never fails validation
+    #[default]
+    Warning,
+    /// Violation that fails validation
+    Error,
+}
+
+impl fmt::Display for Severity {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(match self {
+            Severity::Info => "info",
+            Severity::Warning => "warning",
+            Severity::Error => "error",
+        })
+    }
+}
+
+/// One rule as written in a rules file
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct LintRule {
+    /// Identifier shown with every finding
+    pub id: String,
+    /// XPath selecting the nodes to check
+    pub path: String,
+    /// Condition every selected node must satisfy
+    pub predicate: String,
+    /// Severity of a violation
+    #[serde(default)]
+    pub severity: Severity,
+    /// Message shown for a violation; `{value}` and `{path}` are substituted
+    pub message: String,
+    /// Report a violation when the path matches nothing
+    #[serde(default)]
+    pub required: bool,
+}
+
+/// Contents of a rules file
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub struct LintRuleFile {
+    /// Rules in the order they are checked
+    pub rules: Vec<LintRule>,
+}
+
+impl LintRuleFile {
+    /// Load a YAML (or `.json`) rules file without compiling it
+    pub fn load<P: AsRef<Path>>(path: P) -> Result<Self> {
+        let content = fs::read_to_string(path.as_ref())?;
+        if path.as_ref().extension().is_some_and(|ext| ext == "json") {
+            Ok(serde_json::from_str(&content)?)
+        } else {
+            Ok(serde_norway::from_str(&content)?)
+        }
+    }
+}
+
+/// A rule violation
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct LintFinding {
+    /// Rule that was violated
+    pub rule: String,
+    /// Severity of the rule
+    pub severity: Severity,
+    /// Path of the offending node, empty for a required path with no match
+    pub path: String,
+    /// Message with placeholders substituted
+    pub message: String,
+}
+
+/// Rule with its path and predicate parsed
+#[derive(Debug, Clone)]
+struct CompiledRule {
+    rule: LintRule,
+    xpath: XPath,
+    predicate: Expr,
+}
+
+/// Parsed, checked set of lint rules
+#[derive(Debug, Clone, Default)]
+pub struct LintRuleSet {
+    rules: Vec<CompiledRule>,
+}
+
+impl LintRuleSet {
+    /// Load and compile a rules file
+    pub fn load<P: AsRef<Path>>(path: P) -> Result<Self> {
+        Self::new(LintRuleFile::load(path)?.rules)
+    }
+
+    /// Compile rules, rejecting duplicate ids and invalid paths or predicates
+    pub fn new(rules: Vec<LintRule>) -> Result<Self> {
+        let mut set = Self::default();
+        set.extend(rules)?;
+        Ok(set)
+    }
+
+    /// Add rules from another file
+    pub fn extend(&mut self, rules: Vec<LintRule>) -> Result<()> {
+        let mut ids: HashSet<String> = self.rules.iter().map(|r| r.rule.id.clone()).collect();
+        for rule in rules {
+            if rule.id.trim().is_empty() {
+                return Err(ConfigError::invalid_parameter(
+                    "id",
+                    "Lint rule id must not be empty",
+                ));
+            }
+            if !ids.insert(rule.id.clone()) {
+                return Err(ConfigError::invalid_parameter(
+                    "id",
+                    format!("Lint rule '{}' is defined more than once", rule.id),
+                ));
+            }
+            let invalid = |what: &str, e: ConfigError| {
+                ConfigError::invalid_parameter(
+                    what,
+                    format!("Lint rule '{}' has an invalid {what}: {e}", rule.id),
+                )
+            };
+            let xpath = XPath::parse(&rule.path).map_err(|e| invalid("path", e))?;
+            let predicate = Expr::parse(&rule.predicate).map_err(|e| invalid("predicate", e))?;
+            if let Some(field) = predicate.fields().into_iter().find(|f| !FIELDS.contains(f)) {
+                return Err(ConfigError::invalid_parameter(
+                    "predicate",
+                    format!(
+                        "Lint rule '{}' uses unknown field '{field}'; available: {}",
+                        rule.id,
+                        FIELDS.join(", ")
+                    ),
+                ));
+            }
+            self.rules.push(CompiledRule {
+                rule,
+                xpath,
+                predicate,
+            });
+        }
+        Ok(())
+    }
+
+    /// Number of rules
+    pub fn len(&self) -> usize {
+        self.rules.len()
+    }
+
+    /// Whether the set has no rules
+    pub fn is_empty(&self) -> bool {
+        self.rules.is_empty()
+    }
+
+    /// Check a configuration, returning findings in rule order
+    pub fn check(&self, xml: &str) -> Result<Vec<LintFinding>> {
+        let mut findings = Vec::new();
+        for compiled in &self.rules {
+            let rule = &compiled.rule;
+            let matches = compiled.xpath.evaluate_str(xml)?;
+            if matches.is_empty() && rule.required {
+                findings.push(LintFinding {
+                    rule: rule.id.clone(),
+                    severity: rule.severity,
+                    path: String::new(),
+                    message: format!(
+                        "{} (no node matches {})",
+                        rule.message
+                            .replace("{value}", "")
+                            .replace("{path}", &rule.path),
+                        rule.path
+                    ),
+                });
+                continue;
+            }
+
+            let records = Records::new(&matches);
+            for node in &matches {
+                if !records.matches(node, &compiled.predicate) {
+                    findings.push(LintFinding {
+                        rule: rule.id.clone(),
+                        severity: rule.severity,
+                        path: node.path.clone(),
+                        message: rule
+                            .message
+                            .replace("{value}", &node.value)
+                            .replace("{path}", &node.path),
+                    });
+                }
+            }
+        }
+        Ok(findings)
+    }
+}
+
+/// Matched nodes of one rule with value counts for `duplicate`
+struct Records {
+    count: String,
+    value_counts: HashMap<(&'static str, String), usize>,
+}
+
+impl Records {
+    fn new(matches: &[XPathMatch]) -> Self {
+        let mut value_counts = HashMap::new();
+        for node in matches {
+            for (field, value) in [("value", &node.value), ("path", &node.path)] {
+                *value_counts
+                    .entry((field, crate::query::normalize(value)))
+                    .or_insert(0) += 1;
+            }
+        }
+        Self {
+            count: matches.len().to_string(),
+            value_counts,
+        }
+    }
+
+    fn field<'a>(&'a self, node: &'a XPathMatch, field: &str) -> Option<&'a str> {
+        match field {
+            "value" => Some(node.value.as_str()),
+            "path" => Some(node.path.as_str()),
+            "count" => Some(self.count.as_str()),
+            _ => None,
+        }
+    }
+
+    fn matches(&self, node: &XPathMatch, predicate: &Expr) -> bool {
+        match predicate {
+            Expr::And(left, right) => self.matches(node, left) && self.matches(node, right),
+            Expr::Or(left, right) => self.matches(node, left) || self.matches(node, right),
+            Expr::Not(inner) => !self.matches(node, inner),
+            Expr::Compare { field, op, value } => self
+                .field(node, field)
+                .is_some_and(|actual| expr::compare(actual, *op, value)),
+            Expr::Duplicate { field } => {
+                let Some(key) = FIELDS.iter().find(|f| **f == field.as_str()) else {
+                    return false;
+                };
+                self.field(node, key).is_some_and(|value| {
+                    self.value_counts
+                        .get(&(*key, crate::query::normalize(value)))
+                        .is_some_and(|count| *count > 1)
+                })
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const CONFIG: &str = "<opnsense><vlans>\
+        <vlan><tag>100</tag><descr>IT VLAN 100</descr></vlan>\
+        <vlan><tag>200</tag><descr>guest</descr></vlan>\
+        <vlan><tag>100</tag><descr>Sales VLAN 100</descr></vlan>\
+        </vlans></opnsense>";
+
+    fn rule(id: &str, path: &str, predicate: &str, severity: Severity) -> LintRule {
+        LintRule {
+            id: id.to_string(),
+            path: path.to_string(),
+            predicate: predicate.to_string(),
+            severity,
+            message: "{path} has {value}".to_string(),
+            required: false,
+        }
+    }
+
+    #[test]
+    fn test_rules_report_violations() {
+        let rules = LintRuleSet::new(vec![
+            rule(
+                "unique-tag",
+                "//vlan/tag",
+                "not duplicate value",
+                Severity::Error,
+            ),
+            rule(
+                "descr",
+                "//vlan/descr",
+                "value contains 'VLAN'",
+                Severity::Warning,
+            ),
+            rule(
+                "tag-range",
+                "//vlan/tag",
+                "value >= 10 and value <= 4094",
+                Severity::Error,
+            ),
+            rule("limit", "//vlan", "count <= 2", Severity::Info),
+        ])
+        .unwrap();
+
+        let findings = rules.check(CONFIG).unwrap();
+        let ids: Vec<&str> = findings.iter().map(|f| f.rule.as_str()).collect();
+        assert_eq!(
+            ids,
+            vec![
+                "unique-tag",
+                "unique-tag",
+                "descr",
+                "limit",
+                "limit",
+                "limit"
+            ]
+        );
+        assert_eq!(findings[2].message, "/opnsense/vlans/vlan/descr has guest");
+        assert_eq!(findings[0].severity, Severity::Error);
+    }
+
+    #[test]
+    fn test_required_rule_without_match() {
+        let hostname = "/opnsense/system/hostname";
+        let mut required = rule("hostname", hostname, "value != ''", Severity::Error);
+        required.required = true;
+        let optional = rule("dns", "//dnsserver", "value != ''", Severity::Error);
+
+        let findings = LintRuleSet::new(vec![required, optional])
+            .unwrap()
+            .check(CONFIG)
+            .unwrap();
+        assert_eq!(findings.len(), 1);
+        assert!(findings[0].message.contains("no node matches"));
+    }
+
+    #[test]
+    fn test_invalid_rules_are_rejected() {
+        let unknown_field = rule("x", "//vlan/tag", "vlan_id = 1", Severity::Error);
+        assert!(LintRuleSet::new(vec![unknown_field]).is_err());
+
+        let bad_path = rule("x", "vlan[1]", "value = 1", Severity::Error);
+        assert!(LintRuleSet::new(vec![bad_path]).is_err());
+
+        let duplicate = rule("x", "//vlan/tag", "value = 1", Severity::Error);
+        assert!(LintRuleSet::new(vec![duplicate.clone(), duplicate]).is_err());
+    }
+
+    #[test]
+    fn test_rule_file_defaults() {
+        let file: LintRuleFile = serde_json::from_str(
+            r#"{"rules": [{"id": "a", "path": "//vlan", "predicate": "count > 0", "message": "m"}]}"#,
+        )
+        .unwrap();
+        assert_eq!(file.rules[0].severity, Severity::Warning);
+        assert!(!file.rules[0].required);
+    }
+
+    #[test]
+    fn test_rule_file_loads_yaml() {
+        let dir = tempfile::TempDir::new().unwrap();
+        let path = dir.path().join("rules.yaml");
+        let content = r#"
+rules:
+  - id: limit
+    path: //vlan
+    predicate: count <= 2
+    severity: info
+    message: "{path} exceeds the limit"
+"#;
+        fs::write(&path, content).unwrap();
+
+        let file = LintRuleFile::load(&path).unwrap();
+        assert_eq!(file.rules[0].id, "limit");
+        assert_eq!(file.rules[0].predicate, "count <= 2");
+        assert_eq!(file.rules[0].severity, Severity::Info);
+        assert_eq!(file.rules[0].message, "{path} exceeds the limit");
+    }
+}
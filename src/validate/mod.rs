@@ -1,4 +1,15 @@
 //! Validation framework for configuration consistency
+//!
+//! [`ValidationEngine`] checks generated VLAN data; [`lint`] checks any
+//! configuration against user-defined rules and [`policy`] against an
+//! organizational policy file. [`secrets`] audits the strength and reuse of
+//! credentials across configurations, and [`score`] rates a configuration's
+//! health with a tunable model.
+
+pub mod lint;
+pub mod policy;
+pub mod score;
+pub mod secrets;
 
 use crate::Result;
 use crate::generator::VlanConfig;
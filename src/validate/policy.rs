@@ -0,0 +1,713 @@
+//! Organizational policy files
+//!
+//! A policy states what a company's lab standard allows, and both `generate
+//! --policy` and `validate --policy` enforce it:
+//!
+//! ```json
+//! {
+//!   "name": "lab-standard",
+//!   "vlan_ranges": [{ "range": "100-199", "quota": 50 }, { "range": "300-399" }],
+//!   "prefixes": [{ "prefix": "10.20.0.0/16", "quota": 100 }],
+//!   "forbidden_ports": ["23", "135-139", "445"],
+//!   "naming": { "vlan": "^[A-Z][A-Za-z]+ VLAN \\d+$", "rule": "^[A-Z]" },
+//!   "secrets": { "min_length": 20, "min_classes": 4, "min_entropy_bits": 80 }
+//! }
+//! ```
+//!
+//! VLAN IDs must lie in one of `vlan_ranges` and networks in one of
+//! `prefixes`; an optional `quota` caps how many VLANs one entry may hold.
+//! Pass rules must not name a `forbidden_ports` port (single ports or
+//! ranges). VLAN and firewall rule descriptions must match the `naming`
+//! regular expressions. `secrets` sets the complexity `audit secrets`
+//! requires, see [`SecretRules`]. Every section is optional.
+//!
+//! Generation conforms where it can: VLAN IDs are taken from the allowed
+//! ranges, networks outside the allowed prefixes are moved into them, and
+//! pass rules naming forbidden ports are dropped. Whatever still violates the
+//! policy afterwards, such as a description the naming rules reject, fails
+//! the run.
+
+use crate::Result;
+use crate::generator::{FirewallRule, VlanConfig};
+use crate::model::ConfigError;
+use crate::validate::secrets::SecretRules;
+use crate::xml::tree::ConfigTree;
+use ipnetwork::Ipv4Network;
+use regex::Regex;
+use serde::{Deserialize, Serialize};
+use std::collections::HashSet;
+use std::fmt;
+use std::fs;
+use std::net::Ipv4Addr;
+use std::path::Path;
+
+/// Private ranges generated networks must stay within
+const RFC1918: [&str; 3] = ["10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"];
+
+/// Allowed VLAN ID range as written in a policy file
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct VlanRangeQuota {
+    /// Inclusive range such as `"100-199"`, or a single ID
+    pub range: String,
+    /// Most VLANs the range may hold
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub quota: Option<u32>,
+}
+
+/// Allowed network prefix as written in a policy file
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct PrefixQuota {
+    /// Private IPv4 prefix of length /24 or shorter, e.g. `"10.20.0.0/16"`
+    pub prefix: String,
+    /// Most VLAN networks the prefix may hold
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub quota: Option<u32>,
+}
+
+/// Naming rules as written in a policy file
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub struct NamingRules {
+    /// Pattern VLAN descriptions must match
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub vlan: Option<String>,
+    /// Pattern firewall rule descriptions must match
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub rule: Option<String>,
+}
+
+/// Contents of a policy file
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub struct PolicyFile {
+    /// Name shown in violations
+    #[serde(default)]
+    pub name: String,
+    /// Allowed VLAN ID ranges; empty allows every ID
+    #[serde(default)]
+    pub vlan_ranges: Vec<VlanRangeQuota>,
+    /// Allowed network prefixes; empty allows every private network
+    #[serde(default)]
+    pub prefixes: Vec<PrefixQuota>,
+    /// Ports pass rules must not name, e.g. `"23"` or `"135-139"`
+    #[serde(default)]
+    pub forbidden_ports: Vec<String>,
+    /// Description patterns
+    #[serde(default)]
+    pub naming: NamingRules,
+    /// Complexity required of secrets
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub secrets: Option<SecretRules>,
+}
+
+/// A policy rule an object does not satisfy
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct PolicyViolation {
+    /// Policy section, e.g. `vlan-range` or `naming`
+    pub constraint: &'static str,
+    /// Offending object, e.g. `VLAN 120`
+    pub subject: String,
+    /// What is wrong
+    pub message: String,
+}
+
+impl fmt::Display for PolicyViolation {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "[{}] {}: {}",
+            self.constraint, self.subject, self.message
+        )
+    }
+}
+
+/// Parsed, checked policy
+#[derive(Debug, Clone)]
+pub struct Policy {
+    name: String,
+    vlan_ranges: Vec<(u16, u16, Option<u32>)>,
+    prefixes: Vec<(Ipv4Network, Option<u32>)>,
+    forbidden_ports: Vec<(u16, u16)>,
+    vlan_naming: Option<Regex>,
+    rule_naming: Option<Regex>,
+    secrets: Option<SecretRules>,
+}
+
+impl Policy {
+    /// Load and compile a policy file
+    pub fn load<P: AsRef<Path>>(path: P) -> Result<Self> {
+        let content = fs::read_to_string(path.as_ref())?;
+        Self::compile(serde_json::from_str(&content)?)
+    }
+
+    /// Check a policy file and parse its ranges, prefixes, and patterns
+    pub fn compile(file: PolicyFile) -> Result<Self> {
+        let mut vlan_ranges = Vec::new();
+        for entry in &file.vlan_ranges {
+            let (start, end) = parse_span(&entry.range, 10, 4094)
+                .map_err(|reason| ConfigError::invalid_parameter("vlan_ranges", reason))?;
+            vlan_ranges.push((start, end, entry.quota));
+        }
+
+        let private = RFC1918
+            .iter()
+            .map(|p| p.parse::<Ipv4Network>())
+            .collect::<std::result::Result<Vec<_>, _>>()
+            .map_err(|e| ConfigError::config(format!("Invalid private range: {e}")))?;
+        let mut prefixes = Vec::new();
+        for entry in &file.prefixes {
+            let network: Ipv4Network = entry.prefix.parse().map_err(|e| {
+                ConfigError::invalid_parameter("prefixes", format!("'{}': {e}", entry.prefix))
+            })?;
+            if network.prefix() > 24 || !private.iter().any(|p| p.contains(network.network())) {
+                return Err(ConfigError::invalid_parameter(
+                    "prefixes",
+                    format!(
+                        "'{}' must be a private IPv4 prefix of length /24 or shorter",
+                        entry.prefix
+                    ),
+                ));
+            }
+            let network = Ipv4Network::new(network.network(), network.prefix()).map_err(|e| {
+                ConfigError::invalid_parameter("prefixes", format!("'{}': {e}", entry.prefix))
+            })?;
+            prefixes.push((network, entry.quota));
+        }
+
+        let forbidden_ports = file
+            .forbidden_ports
+            .iter()
+            .map(|p| parse_span(p, 1, 65535))
+            .collect::<std::result::Result<_, _>>()
+            .map_err(|reason| ConfigError::invalid_parameter("forbidden_ports", reason))?;
+
+        let regex = |field: &'static str, pattern: &Option<String>| {
+            pattern
+                .as_deref()
+                .map(Regex::new)
+                .transpose()
+                .map_err(|e| ConfigError::invalid_parameter(field, e.to_string()))
+        };
+
+        Ok(Self {
+            name: if file.name.is_empty() {
+                "policy".to_string()
+            } else {
+                file.name.clone()
+            },
+            vlan_ranges,
+            prefixes,
+            forbidden_ports,
+            vlan_naming: regex("naming.vlan", &file.naming.vlan)?,
+            rule_naming: regex("naming.rule", &file.naming.rule)?,
+            secrets: file.secrets,
+        })
+    }
+
+    /// Policy name
+    pub fn name(&self) -> &str {
+        &self.name
+    }
+
+    /// Complexity required of secrets, if the policy sets any
+    pub fn secret_rules(&self) -> Option<SecretRules> {
+        self.secrets
+    }
+
+    /// `--vlan-range` specification of `count` IDs from the allowed ranges
+    ///
+    /// IDs are taken from the start of each range in order, up to its quota.
+    /// Returns `None` when the policy does not restrict VLAN IDs.
+    pub fn vlan_range_for(&self, count: u16) -> Result<Option<String>> {
+        if self.vlan_ranges.is_empty() {
+            return Ok(None);
+        }
+        let mut remaining = u32::from(count);
+        let mut parts = Vec::new();
+        for &(start, end, quota) in &self.vlan_ranges {
+            if remaining == 0 {
+                break;
+            }
+            let size = u32::from(end - start) + 1;
+            let take = remaining.min(quota.unwrap_or(size).min(size));
+            if take > 0 {
+                parts.push(format!("{start}-{}", u32::from(start) + take - 1));
+                remaining -= take;
+            }
+        }
+        if remaining > 0 {
+            return Err(ConfigError::invalid_parameter(
+                "count",
+                format!(
+                    "Policy '{}' allows at most {} VLANs, {count} requested",
+                    self.name,
+                    u32::from(count) - remaining
+                ),
+            ));
+        }
+        Ok(Some(parts.join(",")))
+    }
+
+    /// Move VLAN networks into the allowed prefixes
+    ///
+    /// Networks that already lie in an allowed prefix with quota to spare are
+    /// kept, so reused fixtures stay stable; the others get the first free
+    /// /24 of the first prefix with room.
+    pub fn conform_networks(&self, configs: Vec<VlanConfig>) -> Result<Vec<VlanConfig>> {
+        if self.prefixes.is_empty() {
+            return Ok(configs);
+        }
+        let mut used: HashSet<Ipv4Addr> = configs.iter().filter_map(network_of).collect();
+        let mut usage = vec![0u32; self.prefixes.len()];
+        let has_room = |usage: &[u32], index: usize| {
+            self.prefixes[index]
+                .1
+                .is_none_or(|quota| usage[index] < quota)
+        };
+
+        let mut pending = Vec::new();
+        for (position, config) in configs.iter().enumerate() {
+            let index = network_of(config).and_then(|net| self.prefix_index(net));
+            match index {
+                Some(index) if has_room(&usage, index) => usage[index] += 1,
+                _ => pending.push(position),
+            }
+        }
+
+        let mut configs = configs;
+        let mut cursors = vec![0u32; self.prefixes.len()];
+        for position in pending {
+            let mut assigned = None;
+            for index in 0..self.prefixes.len() {
+                if !has_room(&usage, index) {
+                    continue;
+                }
+                let (prefix, _) = self.prefixes[index];
+                let subnets = 1u32 << (24 - prefix.prefix());
+                while cursors[index] < subnets {
+                    let base = u32::from(prefix.network()) + (cursors[index] << 8);
+                    cursors[index] += 1;
+                    let candidate = Ipv4Addr::from(base);
+                    // 10.0.0.0/24 is reserved by the generator's validation
+                    if candidate.octets()[..3] != [10, 0, 0] && used.insert(candidate) {
+                        assigned = Some((index, candidate));
+                        break;
+                    }
+                }
+                if assigned.is_some() {
+                    break;
+                }
+            }
+            let Some((index, network)) = assigned else {
+                return Err(ConfigError::validation(format!(
+                    "Policy '{}' prefixes have no room for {} VLAN networks",
+                    self.name,
+                    configs.len()
+                )));
+            };
+            usage[index] += 1;
+            let [a, b, c, _] = network.octets();
+            configs[position].ip_network = format!("{a}.{b}.{c}.x");
+        }
+        Ok(configs)
+    }
+
+    /// Drop pass rules that name a forbidden port, returning how many were dropped
+    pub fn conform_rules(&self, rules: &mut Vec<FirewallRule>) -> usize {
+        let before = rules.len();
+        rules.retain(|rule| self.forbidden_port(rule).is_none());
+        before - rules.len()
+    }
+
+    /// Check VLANs against the ranges, prefixes, quotas, and VLAN naming
+    pub fn check_vlans(&self, configs: &[VlanConfig]) -> Vec<PolicyViolation> {
+        let vlans: Vec<VlanFacts> = configs
+            .iter()
+            .map(|c| VlanFacts {
+                id: c.vlan_id,
+                network: network_of(c),
+                description: c.description.clone(),
+            })
+            .collect();
+        self.check_vlan_facts(&vlans)
+    }
+
+    /// Check firewall rules against the forbidden ports and rule naming
+    pub fn check_rules(&self, rules: &[FirewallRule]) -> Vec<PolicyViolation> {
+        let mut violations = Vec::new();
+        for rule in rules {
+            let subject = format!("rule {}", rule.rule_id);
+            if let Some((start, end)) = self.forbidden_port(rule) {
+                violations.push(PolicyViolation {
+                    constraint: "forbidden-port",
+                    subject: subject.clone(),
+                    message: format!(
+                        "passes {} within forbidden {}",
+                        rule.ports,
+                        span(start, end)
+                    ),
+                });
+            }
+            if let Some(violation) = self.check_name(&self.rule_naming, &subject, &rule.description)
+            {
+                violations.push(violation);
+            }
+        }
+        violations
+    }
+
+    /// Check a configuration: its VLANs, their interface networks, and its pass rules
+    pub fn check_xml(&self, content: &str) -> Result<Vec<PolicyViolation>> {
+        let tree = &ConfigTree::parse(content)?;
+
+        // VLAN networks live on the interface using the VLAN device
+        let mut vlans = Vec::new();
+        for id in elements(tree, "vlan", "vlans") {
+            let Some(tag) = tree.child_value(id, "tag").and_then(|t| t.parse().ok()) else {
+                continue;
+            };
+            let device = tree.child_value(id, "vlanif");
+            let network = (0..tree.len())
+                .filter(|&i| {
+                    tree.node(i)
+                        .parent
+                        .is_some_and(|p| tree.node(p).name == "interfaces")
+                })
+                .find(|&i| device.is_some() && tree.child_value(i, "if") == device)
+                .and_then(|i| tree.child_value(i, "ipaddr"))
+                .and_then(|ip| ip.parse::<Ipv4Addr>().ok())
+                .map(|ip| {
+                    let [a, b, c, _] = ip.octets();
+                    Ipv4Addr::new(a, b, c, 0)
+                });
+            vlans.push(VlanFacts {
+                id: tag,
+                network,
+                description: tree
+                    .child_value(id, "descr")
+                    .unwrap_or_default()
+                    .to_string(),
+            });
+        }
+        let mut violations = self.check_vlan_facts(&vlans);
+
+        for (index, id) in elements(tree, "rule", "filter").enumerate() {
+            let subject = format!("rule {}", index + 1);
+            let pass = tree.child_value(id, "type").is_none_or(|t| t == "pass");
+            let port = tree
+                .node(id)
+                .children
+                .iter()
+                .find(|&&c| tree.node(c).name == "destination")
+                .and_then(|&d| tree.child_value(d, "port"));
+            if pass
+                && let Some(port) = port
+                && let Some((start, end)) = self.forbidden_in(port)
+            {
+                violations.push(PolicyViolation {
+                    constraint: "forbidden-port",
+                    subject: subject.clone(),
+                    message: format!("passes {port} within forbidden {}", span(start, end)),
+                });
+            }
+            let descr = tree.child_value(id, "descr").unwrap_or_default();
+            if let Some(violation) = self.check_name(&self.rule_naming, &subject, descr) {
+                violations.push(violation);
+            }
+        }
+        Ok(violations)
+    }
+
+    fn check_vlan_facts(&self, vlans: &[VlanFacts]) -> Vec<PolicyViolation> {
+        let mut violations = Vec::new();
+        let mut range_usage = vec![0u32; self.vlan_ranges.len()];
+        let mut prefix_usage = vec![0u32; self.prefixes.len()];
+
+        for vlan in vlans {
+            let subject = format!("VLAN {}", vlan.id);
+            if !self.vlan_ranges.is_empty() {
+                match self
+                    .vlan_ranges
+                    .iter()
+                    .position(|&(s, e, _)| (s..=e).contains(&vlan.id))
+                {
+                    Some(index) => range_usage[index] += 1,
+                    None => violations.push(PolicyViolation {
+                        constraint: "vlan-range",
+                        subject: subject.clone(),
+                        message: format!("ID is outside the allowed ranges {}", self.ranges()),
+                    }),
+                }
+            }
+            if !self.prefixes.is_empty() {
+                match vlan.network.and_then(|n| self.prefix_index(n)) {
+                    Some(index) => prefix_usage[index] += 1,
+                    None => violations.push(PolicyViolation {
+                        constraint: "prefix",
+                        subject: subject.clone(),
+                        message: format!(
+                            "network {} is outside the allowed prefixes",
+                            vlan.network
+                                .map_or("unknown".to_string(), |n| format!("{n}/24"))
+                        ),
+                    }),
+                }
+            }
+            if let Some(violation) = self.check_name(&self.vlan_naming, &subject, &vlan.description)
+            {
+                violations.push(violation);
+            }
+        }
+
+        for (&(start, end, quota), used) in self.vlan_ranges.iter().zip(range_usage) {
+            if let Some(quota) = quota.filter(|&q| used > q) {
+                violations.push(PolicyViolation {
+                    constraint: "quota",
+                    subject: format!("VLAN range {}", span(start, end)),
+                    message: format!("holds {used} VLANs, quota is {quota}"),
+                });
+            }
+        }
+        for (&(prefix, quota), used) in self.prefixes.iter().zip(prefix_usage) {
+            if let Some(quota) = quota.filter(|&q| used > q) {
+                violations.push(PolicyViolation {
+                    constraint: "quota",
+                    subject: format!("prefix {prefix}"),
+                    message: format!("holds {used} VLAN networks, quota is {quota}"),
+                });
+            }
+        }
+        violations
+    }
+
+    fn check_name(
+        &self,
+        pattern: &Option<Regex>,
+        subject: &str,
+        description: &str,
+    ) -> Option<PolicyViolation> {
+        let pattern = pattern.as_ref()?;
+        (!pattern.is_match(description)).then(|| PolicyViolation {
+            constraint: "naming",
+            subject: subject.to_string(),
+            message: format!("description '{description}' does not match /{pattern}/"),
+        })
+    }
+
+    fn prefix_index(&self, network: Ipv4Addr) -> Option<usize> {
+        self.prefixes.iter().position(|(p, _)| p.contains(network))
+    }
+
+    /// Forbidden span a pass rule's ports overlap
+    fn forbidden_port(&self, rule: &FirewallRule) -> Option<(u16, u16)> {
+        if !rule.action.eq_ignore_ascii_case("pass") {
+            return None;
+        }
+        self.forbidden_in(&rule.ports)
+    }
+
+    /// Forbidden span overlapping a port list such as `"80,443"` or
+    /// `"1024:65535"`; `any` names no particular port
+    fn forbidden_in(&self, ports: &str) -> Option<(u16, u16)> {
+        ports
+            .split(',')
+            .filter_map(|item| parse_span(&item.trim().replace(':', "-"), 0, 65535).ok())
+            .find_map(|(start, end)| {
+                self.forbidden_ports
+                    .iter()
+                    .copied()
+                    .find(|&(fs, fe)| start <= fe && fs <= end)
+            })
+    }
+
+    fn ranges(&self) -> String {
+        let ranges: Vec<String> = self
+            .vlan_ranges
+            .iter()
+            .map(|&(s, e, _)| span(s, e))
+            .collect();
+        ranges.join(", ")
+    }
+}
+
+/// What the checks need to know about a VLAN
+struct VlanFacts {
+    id: u16,
+    network: Option<Ipv4Addr>,
+    description: String,
+}
+
+/// Elements called `name` whose parent is called `parent`
+fn elements<'a>(
+    tree: &'a ConfigTree,
+    name: &'a str,
+    parent: &'a str,
+) -> impl Iterator<Item = usize> + 'a {
+    (0..tree.len()).filter(move |&id| {
+        let node = tree.node(id);
+        node.name == name && node.parent.is_some_and(|p| tree.node(p).name == parent)
+    })
+}
+
+/// Network address of a VLAN's /24
+fn network_of(config: &VlanConfig) -> Option<Ipv4Addr> {
+    config.as_ipv4_network().ok().map(|n| n.network())
+}
+
+/// Inclusive span such as `"100-199"` or a single number within `min..=max`
+fn parse_span(text: &str, min: u16, max: u16) -> std::result::Result<(u16, u16), String> {
+    let number = |part: &str| {
+        part.trim()
+            .parse::<u16>()
+            .ok()
+            .filter(|n| (min..=max).contains(n))
+            .ok_or_else(|| format!("'{text}' is not a number or range within {min}-{max}"))
+    };
+    let (start, end) = match text.split_once('-') {
+        Some((start, end)) => (number(start)?, number(end)?),
+        None => {
+            let n = number(text)?;
+            (n, n)
+        }
+    };
+    if start > end {
+        return Err(format!("'{text}' starts after it ends"));
+    }
+    Ok((start, end))
+}
+
+fn span(start: u16, end: u16) -> String {
+    if start == end {
+        start.to_string()
+    } else {
+        format!("{start}-{end}")
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn policy() -> Policy {
+        Policy::compile(PolicyFile {
+            name: "lab".to_string(),
+            vlan_ranges: vec![
+                VlanRangeQuota {
+                    range: "100-199".to_string(),
+                    quota: Some(2),
+                },
+                VlanRangeQuota {
+                    range: "300-399".to_string(),
+                    quota: None,
+                },
+            ],
+            prefixes: vec![PrefixQuota {
+                prefix: "10.20.0.0/16".to_string(),
+                quota: None,
+            }],
+            forbidden_ports: vec!["23".to_string(), "135-139".to_string()],
+            naming: NamingRules {
+                vlan: Some(r"^[A-Z]\w+ VLAN \d+$".to_string()),
+                rule: None,
+            },
+            secrets: None,
+        })
+        .unwrap()
+    }
+
+    fn vlan(id: u16, network: &str, description: &str) -> VlanConfig {
+        VlanConfig::new(id, network.to_string(), description.to_string(), 1).unwrap()
+    }
+
+    #[test]
+    fn test_vlan_range_respects_quotas() {
+        let policy = policy();
+        assert_eq!(
+            policy.vlan_range_for(5).unwrap().unwrap(),
+            "100-101,300-302"
+        );
+        assert!(policy.vlan_range_for(200).is_err());
+
+        let file = PolicyFile {
+            prefixes: vec![PrefixQuota {
+                prefix: "8.8.0.0/16".to_string(),
+                quota: None,
+            }],
+            ..Default::default()
+        };
+        assert!(Policy::compile(file).is_err());
+    }
+
+    #[test]
+    fn test_networks_conform_to_prefixes() {
+        let policy = policy();
+        let configs = vec![
+            vlan(100, "10.20.5.x", "Sales VLAN 100"),
+            vlan(101, "192.168.1.x", "Ops VLAN 101"),
+        ];
+        let configs = policy.conform_networks(configs).unwrap();
+        assert_eq!(configs[0].ip_network, "10.20.5.x");
+        assert_eq!(configs[1].ip_network, "10.20.0.x");
+        assert!(policy.check_vlans(&configs).is_empty());
+    }
+
+    #[test]
+    fn test_violations_reported() {
+        let policy = policy();
+        let configs = vec![
+            vlan(100, "10.20.1.x", "Sales VLAN 100"),
+            vlan(101, "10.20.2.x", "Sales VLAN 101"),
+            vlan(102, "10.20.3.x", "sales"),
+            vlan(500, "10.30.1.x", "Guest VLAN 500"),
+        ];
+        let constraints: Vec<&str> = policy
+            .check_vlans(&configs)
+            .iter()
+            .map(|v| v.constraint)
+            .collect();
+        assert_eq!(constraints, vec!["naming", "vlan-range", "prefix", "quota"]);
+    }
+
+    #[test]
+    fn test_forbidden_ports() {
+        let policy = policy();
+        let rule = |action: &str, ports: &str| {
+            FirewallRule::new(
+                "r1".into(),
+                "any".into(),
+                "any".into(),
+                "TCP".into(),
+                ports.into(),
+                action.into(),
+                "In".into(),
+                "Test".into(),
+                false,
+                None,
+                1,
+                "lan".into(),
+            )
+            .unwrap()
+        };
+        let mut rules = vec![
+            rule("pass", "80,443"),
+            rule("pass", "130:140"),
+            rule("block", "23"),
+            rule("pass", "any"),
+        ];
+        assert_eq!(policy.check_rules(&rules).len(), 1);
+        assert_eq!(policy.conform_rules(&mut rules), 1);
+        assert_eq!(rules.len(), 3);
+    }
+
+    #[test]
+    fn test_check_xml() {
+        let xml = "<opnsense><interfaces><opt6><if>vtnet1_vlan150</if>\
+            <ipaddr>192.168.7.1</ipaddr></opt6></interfaces>\
+            <vlans><vlan><tag>150</tag><descr>Sales VLAN 150</descr>\
+            <vlanif>vtnet1_vlan150</vlanif></vlan></vlans>\
+            <filter><rule><type>pass</type><destination><port>23</port></destination>\
+            <descr>Telnet</descr></rule></filter></opnsense>";
+        let violations = policy().check_xml(xml).unwrap();
+        let constraints: Vec<&str> = violations.iter().map(|v| v.constraint).collect();
+        assert_eq!(constraints, vec!["prefix", "forbidden-port"]);
+        assert!(violations[0].message.contains("192.168.7.0/24"));
+    }
+}
@@ -0,0 +1,700 @@
+//! Health scores of configurations
+//!
+//! Teams gate which fixtures their test suites accept on one number.
+//! [`score`] rates a configuration from 0 to 100 as the weighted mean of
+//! three components:
+//!
+//! - lint: 100 less a penalty per [lint](crate::validate::lint) finding,
+//!   by severity
+//! - complexity: how well metrics such as the number of rules or the alias
+//!   nesting depth fall into their target ranges
+//! - coverage: the weighted share of subsystems the configuration populates
+//!
+//! A [`ScoreModel`] file, YAML or JSON, tunes everything: component weights,
+//! the passing threshold, lint rules and penalties, metric targets, and
+//! subsystem weights. Sections left out of the file keep the built-in model's
+//! values; a section that is given replaces the built-in one entirely.
+
+use crate::Result;
+use crate::model::ConfigError;
+use crate::validate::lint::{LintFinding, LintRule, LintRuleSet, Severity};
+use crate::xml::XPath;
+use crate::xml::graph::{DependencyGraph, NodeKind, Relation};
+use crate::xml::tree::ConfigTree;
+use serde::{Deserialize, Serialize};
+use std::collections::{BTreeMap, HashMap, HashSet};
+use std::fs;
+use std::path::Path;
+
+/// Metrics a complexity target may name
+pub const METRICS: &[&str] = &[
+    "elements",
+    "depth",
+    "vlans",
+    "interfaces",
+    "rules",
+    "aliases",
+    "references_per_object",
+    "alias_depth",
+];
+
+/// Subsystems coverage may weigh, with the paths that populate them
+pub const SUBSYSTEMS: &[(&str, &[&str])] = &[
+    ("vlans", &["//vlans/vlan"]),
+    ("interfaces", &["/opnsense/interfaces/*"]),
+    ("dhcp", &["//dhcpd/*/range"]),
+    ("firewall_rules", &["//filter/rule"]),
+    ("aliases", &["//aliases/alias"]),
+    ("nat", &["//nat/rule", "//nat/outbound/rule"]),
+    (
+        "vpn",
+        &[
+            "//openvpn-server",
+            "//openvpn-client",
+            "//ipsec/phase1",
+            "//wireguard/server/servers/server",
+        ],
+    ),
+    (
+        "dns_overrides",
+        &["//unboundplus/hosts/host", "//unbound/hosts"],
+    ),
+    ("users", &["/opnsense/system/user"]),
+    ("carp", &["//virtualip/vip"]),
+    ("certificates", &["/opnsense/cert"]),
+];
+
+/// Weights of the three components; only their ratio matters
+#[derive(Debug, Clone, Copy, PartialEq, Serialize, Deserialize)]
+#[serde(default, deny_unknown_fields)]
+pub struct ComponentWeights {
+    /// Weight of the lint component
+    pub lint: f64,
+    /// Weight of the complexity component
+    pub complexity: f64,
+    /// Weight of the coverage component
+    pub coverage: f64,
+}
+
+impl Default for ComponentWeights {
+    fn default() -> Self {
+        Self {
+            lint: 0.4,
+            complexity: 0.3,
+            coverage: 0.3,
+        }
+    }
+}
+
+/// Points one finding of each severity costs
+#[derive(Debug, Clone, Copy, PartialEq, Serialize, Deserialize)]
+#[serde(default, deny_unknown_fields)]
+pub struct Penalties {
+    /// Penalty per error
+    pub error: f64,
+    /// Penalty per warning
+    pub warning: f64,
+    /// Penalty per info finding
+    pub info: f64,
+}
+
+impl Default for Penalties {
+    fn default() -> Self {
+        Self {
+            error: 20.0,
+            warning: 5.0,
+            info: 1.0,
+        }
+    }
+}
+
+impl Penalties {
+    fn of(&self, severity: Severity) -> f64 {
+        match severity {
+            Severity::Error => self.error,
+            Severity::Warning => self.warning,
+            Severity::Info => self.info,
+        }
+    }
+}
+
+/// Lint rules and what their findings cost
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+#[serde(default, deny_unknown_fields)]
+pub struct LintScoring {
+    /// Rules checked, in the format of `validate --rules` files
+    pub rules: Vec<LintRule>,
+    /// Penalty per finding
+    pub penalties: Penalties,
+}
+
+impl Default for LintScoring {
+    fn default() -> Self {
+        Self {
+            rules: default_rules(),
+            penalties: Penalties::default(),
+        }
+    }
+}
+
+/// Range a metric should fall into
+#[derive(Debug, Clone, Copy, PartialEq, Serialize, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub struct MetricTarget {
+    /// Lowest value scoring full points
+    #[serde(default)]
+    pub min: Option<f64>,
+    /// Highest value scoring full points
+    #[serde(default)]
+    pub max: Option<f64>,
+    /// Weight within the complexity component
+    #[serde(default = "default_weight")]
+    pub weight: f64,
+}
+
+fn default_weight() -> f64 {
+    1.0
+}
+
+impl MetricTarget {
+    fn at_least(min: f64) -> Self {
+        Self {
+            min: Some(min),
+            max: None,
+            weight: 1.0,
+        }
+    }
+
+    fn at_most(max: f64) -> Self {
+        Self {
+            min: None,
+            max: Some(max),
+            weight: 1.0,
+        }
+    }
+
+    /// Points for `value`: full inside the range, proportionally less outside
+    pub fn score(&self, value: f64) -> f64 {
+        match (self.min, self.max) {
+            (Some(min), _) if value < min => 100.0 * value / min,
+            (_, Some(max)) if value > max => 100.0 * max / value,
+            _ => 100.0,
+        }
+    }
+}
+
+/// Scoring model as read from a model file
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+#[serde(default, deny_unknown_fields)]
+pub struct ScoreModel {
+    /// Weights of the components
+    pub weights: ComponentWeights,
+    /// Lowest passing score
+    pub threshold: f64,
+    /// Lint rules and penalties
+    pub lint: LintScoring,
+    /// Target ranges by metric name
+    pub complexity: BTreeMap<String, MetricTarget>,
+    /// Weights by subsystem name
+    pub coverage: BTreeMap<String, f64>,
+}
+
+impl Default for ScoreModel {
+    fn default() -> Self {
+        let complexity = [
+            ("vlans", MetricTarget::at_least(2.0)),
+            ("rules", MetricTarget::at_least(5.0)),
+            ("aliases", MetricTarget::at_least(1.0)),
+            ("references_per_object", MetricTarget::at_least(1.0)),
+            ("depth", MetricTarget::at_most(10.0)),
+            ("alias_depth", MetricTarget::at_most(8.0)),
+        ];
+        let coverage = [
+            ("vlans", 3.0),
+            ("interfaces", 2.0),
+            ("dhcp", 2.0),
+            ("firewall_rules", 3.0),
+            ("aliases", 1.0),
+            ("nat", 1.0),
+            ("vpn", 1.0),
+            ("dns_overrides", 1.0),
+            ("users", 1.0),
+            ("carp", 1.0),
+        ];
+        Self {
+            weights: ComponentWeights::default(),
+            threshold: 70.0,
+            lint: LintScoring::default(),
+            complexity: complexity
+                .into_iter()
+                .map(|(name, target)| (name.to_string(), target))
+                .collect(),
+            coverage: coverage
+                .into_iter()
+                .map(|(name, weight)| (name.to_string(), weight))
+                .collect(),
+        }
+    }
+}
+
+impl ScoreModel {
+    /// Load and check a YAML (or `.json`) model file
+    pub fn load<P: AsRef<Path>>(path: P) -> Result<Self> {
+        let content = fs::read_to_string(path.as_ref())?;
+        let model: ScoreModel = if path.as_ref().extension().is_some_and(|ext| ext == "json") {
+            serde_json::from_str(&content)?
+        } else {
+            serde_norway::from_str(&content)?
+        };
+        model.validate()?;
+        Ok(model)
+    }
+
+    /// Reject negative weights, unknown names, and empty ranges
+    pub fn validate(&self) -> Result<()> {
+        let weights = self.weights;
+        let penalties = self.lint.penalties;
+        for (name, weight) in [
+            ("weights.lint", weights.lint),
+            ("weights.complexity", weights.complexity),
+            ("weights.coverage", weights.coverage),
+            ("lint.penalties.error", penalties.error),
+            ("lint.penalties.warning", penalties.warning),
+            ("lint.penalties.info", penalties.info),
+        ] {
+            check_weight(name, weight)?;
+        }
+        if weights.lint + weights.complexity + weights.coverage <= 0.0 {
+            return Err(ConfigError::invalid_parameter(
+                "weights",
+                "At least one component needs a positive weight",
+            ));
+        }
+        if !(0.0..=100.0).contains(&self.threshold) {
+            return Err(ConfigError::invalid_parameter(
+                "threshold",
+                format!("{} is outside 0-100", self.threshold),
+            ));
+        }
+
+        for (name, target) in &self.complexity {
+            if !METRICS.contains(&name.as_str()) {
+                return Err(ConfigError::invalid_parameter(
+                    "complexity",
+                    format!("Unknown metric '{name}'; available: {}", METRICS.join(", ")),
+                ));
+            }
+            check_weight(&format!("complexity.{name}.weight"), target.weight)?;
+            let bounds = [target.min, target.max];
+            if bounds
+                .iter()
+                .flatten()
+                .any(|bound| !bound.is_finite() || *bound < 0.0)
+                || target
+                    .min
+                    .zip(target.max)
+                    .is_some_and(|(min, max)| min > max)
+            {
+                return Err(ConfigError::invalid_parameter(
+                    "complexity",
+                    format!("Metric '{name}' needs 0 <= min <= max"),
+                ));
+            }
+        }
+        for (name, weight) in &self.coverage {
+            if !SUBSYSTEMS.iter().any(|(subsystem, _)| subsystem == name) {
+                let names: Vec<&str> = SUBSYSTEMS.iter().map(|(name, _)| *name).collect();
+                return Err(ConfigError::invalid_parameter(
+                    "coverage",
+                    format!(
+                        "Unknown subsystem '{name}'; available: {}",
+                        names.join(", ")
+                    ),
+                ));
+            }
+            check_weight(&format!("coverage.{name}"), *weight)?;
+        }
+        Ok(())
+    }
+}
+
+fn check_weight(name: &str, weight: f64) -> Result<()> {
+    if !weight.is_finite() || weight < 0.0 {
+        return Err(ConfigError::invalid_parameter(
+            name,
+            format!("{weight} must be a non-negative number"),
+        ));
+    }
+    Ok(())
+}
+
+/// Built-in lint rules
+fn default_rules() -> Vec<LintRule> {
+    let rule = |id: &str, path: &str, predicate: &str, severity, message: &str| LintRule {
+        id: id.to_string(),
+        path: path.to_string(),
+        predicate: predicate.to_string(),
+        severity,
+        message: message.to_string(),
+        required: false,
+    };
+    vec![
+        rule(
+            "vlan-tag-unique",
+            "//vlans/vlan/tag",
+            "not duplicate value",
+            Severity::Error,
+            "VLAN tag {value} is used more than once",
+        ),
+        rule(
+            "vlan-described",
+            "//vlans/vlan/descr",
+            "value != ''",
+            Severity::Warning,
+            "VLAN at {path} has no description",
+        ),
+        rule(
+            "interface-described",
+            "/opnsense/interfaces/*/descr",
+            "value != ''",
+            Severity::Info,
+            "Interface at {path} has no description",
+        ),
+        rule(
+            "rule-described",
+            "//filter/rule/descr",
+            "value != ''",
+            Severity::Info,
+            "Firewall rule at {path} has no description",
+        ),
+        LintRule {
+            required: true,
+            ..rule(
+                "hostname-set",
+                "/opnsense/system/hostname",
+                "value != 'OPNsense'",
+                Severity::Info,
+                "Hostname is still the factory default",
+            )
+        },
+    ]
+}
+
+/// Score of one component
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct ComponentScore {
+    /// `lint`, `complexity`, or `coverage`
+    pub name: &'static str,
+    /// Weight from the model
+    pub weight: f64,
+    /// Points from 0 to 100
+    pub score: f64,
+}
+
+/// Measured metric and its points
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct MetricScore {
+    /// Metric name
+    pub name: String,
+    /// Measured value
+    pub value: f64,
+    /// Target range and weight
+    pub target: MetricTarget,
+    /// Points from 0 to 100
+    pub score: f64,
+}
+
+/// Whether a weighed subsystem is populated
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct SubsystemCoverage {
+    /// Subsystem name
+    pub name: String,
+    /// Weight from the model
+    pub weight: f64,
+    /// Number of entries found
+    pub entries: usize,
+}
+
+/// Score of a configuration with everything it is derived from
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct ScoreReport {
+    /// Overall points from 0 to 100, to one decimal
+    pub score: f64,
+    /// Lowest passing score
+    pub threshold: f64,
+    /// Whether the score reaches the threshold
+    pub passed: bool,
+    /// The three components
+    pub components: Vec<ComponentScore>,
+    /// Lint findings in rule order
+    pub findings: Vec<LintFinding>,
+    /// Metrics with targets in the model
+    pub metrics: Vec<MetricScore>,
+    /// Subsystems with weights in the model
+    pub subsystems: Vec<SubsystemCoverage>,
+}
+
+/// Score `xml` with `model`, checking `rules` for the lint component
+///
+/// `rules` is usually the model's own rules, compiled and possibly extended.
+pub fn score(xml: &str, model: &ScoreModel, rules: &LintRuleSet) -> Result<ScoreReport> {
+    model.validate()?;
+    let findings = rules.check(xml)?;
+    let penalty: f64 = findings
+        .iter()
+        .map(|finding| model.lint.penalties.of(finding.severity))
+        .sum();
+    let lint = (100.0 - penalty).max(0.0);
+
+    let measured = measure(xml)?;
+    let metrics: Vec<MetricScore> = model
+        .complexity
+        .iter()
+        .map(|(name, target)| {
+            let value = measured.get(name.as_str()).copied().unwrap_or(0.0);
+            MetricScore {
+                name: name.clone(),
+                value,
+                target: *target,
+                score: round(target.score(value)),
+            }
+        })
+        .collect();
+    let complexity = weighted_mean(metrics.iter().map(|m| (m.target.weight, m.score)));
+
+    let mut subsystems = Vec::new();
+    for (name, weight) in &model.coverage {
+        let paths = SUBSYSTEMS
+            .iter()
+            .find(|(subsystem, _)| subsystem == name)
+            .map_or(&[][..], |(_, paths)| *paths);
+        let mut entries = 0;
+        for path in paths {
+            entries += XPath::parse(path)?.evaluate_str(xml)?.len();
+        }
+        subsystems.push(SubsystemCoverage {
+            name: name.clone(),
+            weight: *weight,
+            entries,
+        });
+    }
+    let coverage = weighted_mean(subsystems.iter().map(|s| {
+        let points = if s.entries > 0 { 100.0 } else { 0.0 };
+        (s.weight, points)
+    }));
+
+    let weights = model.weights;
+    let components = vec![
+        ComponentScore {
+            name: "lint",
+            weight: weights.lint,
+            score: round(lint),
+        },
+        ComponentScore {
+            name: "complexity",
+            weight: weights.complexity,
+            score: round(complexity),
+        },
+        ComponentScore {
+            name: "coverage",
+            weight: weights.coverage,
+            score: round(coverage),
+        },
+    ];
+    let total = round(weighted_mean(
+        components.iter().map(|c| (c.weight, c.score)),
+    ));
+    Ok(ScoreReport {
+        score: total,
+        threshold: model.threshold,
+        passed: total >= model.threshold,
+        components,
+        findings,
+        metrics,
+        subsystems,
+    })
+}
+
+/// Measure every metric in [`METRICS`]
+fn measure(xml: &str) -> Result<HashMap<&'static str, f64>> {
+    let tree = ConfigTree::parse(xml)?;
+    let graph = DependencyGraph::from_tree(&tree);
+    let kinds = graph.kind_counts();
+    let kind = |kind: NodeKind| kinds.get(&kind).copied().unwrap_or(0) as f64;
+    let depth = (0..tree.len())
+        .map(|id| tree.node(id).depth)
+        .max()
+        .unwrap_or(0);
+
+    Ok(HashMap::from([
+        ("elements", tree.len() as f64),
+        ("depth", depth as f64),
+        ("vlans", kind(NodeKind::Vlan)),
+        ("interfaces", kind(NodeKind::Interface)),
+        ("rules", kind(NodeKind::Rule)),
+        ("aliases", kind(NodeKind::Alias)),
+        (
+            "references_per_object",
+            graph.edges.len() as f64 / graph.nodes.len().max(1) as f64,
+        ),
+        ("alias_depth", alias_depth(&graph) as f64),
+    ]))
+}
+
+/// Longest chain of aliases listing aliases; cycles end a chain
+fn alias_depth(graph: &DependencyGraph) -> usize {
+    let mut nested: HashMap<&str, Vec<&str>> = HashMap::new();
+    for edge in &graph.edges {
+        if edge.relation == Relation::UsesAlias && edge.source.starts_with("alias:") {
+            nested
+                .entry(edge.source.as_str())
+                .or_default()
+                .push(edge.target.as_str());
+        }
+    }
+    let mut depths = HashMap::new();
+    let mut visiting = HashSet::new();
+    let aliases: Vec<&str> = nested.keys().copied().collect();
+    aliases
+        .into_iter()
+        .map(|alias| chain(alias, &nested, &mut depths, &mut visiting))
+        .max()
+        .unwrap_or(0)
+}
+
+fn chain<'a>(
+    alias: &'a str,
+    nested: &HashMap<&'a str, Vec<&'a str>>,
+    depths: &mut HashMap<&'a str, usize>,
+    visiting: &mut HashSet<&'a str>,
+) -> usize {
+    if let Some(&depth) = depths.get(alias) {
+        return depth;
+    }
+    if !visiting.insert(alias) {
+        return 0;
+    }
+    let depth = nested.get(alias).map_or(0, |members| {
+        members
+            .iter()
+            .map(|member| 1 + chain(*member, nested, depths, visiting))
+            .max()
+            .unwrap_or(0)
+    });
+    visiting.remove(alias);
+    depths.insert(alias, depth);
+    depth
+}
+
+/// Mean of `(weight, points)` pairs, 100 when nothing is weighed
+fn weighted_mean(items: impl Iterator<Item = (f64, f64)>) -> f64 {
+    let (weights, sum) = items.fold((0.0, 0.0), |(weights, sum), (weight, points)| {
+        (weights + weight, sum + weight * points)
+    });
+    if weights > 0.0 { sum / weights } else { 100.0 }
+}
+
+fn round(points: f64) -> f64 {
+    (points * 10.0).round() / 10.0
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::xml::FACTORY_DEFAULT_CONFIG;
+
+    fn rules(model: &ScoreModel) -> LintRuleSet {
+        LintRuleSet::new(model.lint.rules.clone()).unwrap()
+    }
+
+    #[test]
+    fn test_populated_config_outscores_factory_default() {
+        let model = ScoreModel::default();
+        let stock = score(FACTORY_DEFAULT_CONFIG, &model, &rules(&model)).unwrap();
+        let vlans = [(100, "Sales"), (101, "IT"), (101, "")];
+        let mut xml = FACTORY_DEFAULT_CONFIG
+            .replace("<hostname>OPNsense</hostname>", "<hostname>fw01</hostname>");
+        let entries: String = vlans
+            .iter()
+            .map(|(tag, descr)| format!("<vlan><tag>{tag}</tag><descr>{descr}</descr></vlan>"))
+            .collect();
+        xml = xml.replace(
+            "</opnsense>",
+            &format!("<vlans>{entries}</vlans></opnsense>"),
+        );
+        let populated = score(&xml, &model, &rules(&model)).unwrap();
+
+        let ids: Vec<&str> = populated.findings.iter().map(|f| f.rule.as_str()).collect();
+        assert_eq!(ids.iter().filter(|id| **id == "vlan-tag-unique").count(), 2);
+        assert!(ids.contains(&"vlan-described"));
+        assert!(!ids.contains(&"hostname-set"));
+        let vlan_coverage = populated
+            .subsystems
+            .iter()
+            .find(|s| s.name == "vlans")
+            .unwrap();
+        assert_eq!(vlan_coverage.entries, 3);
+
+        let component = |report: &ScoreReport, name: &str| {
+            report
+                .components
+                .iter()
+                .find(|c| c.name == name)
+                .unwrap()
+                .score
+        };
+        assert!(component(&populated, "coverage") > component(&stock, "coverage"));
+        assert!(component(&populated, "lint") < component(&stock, "lint"));
+        assert!((0.0..=100.0).contains(&populated.score));
+    }
+
+    #[test]
+    fn test_model_file_overrides_and_validation() {
+        let model: ScoreModel = serde_json::from_str(
+            r#"{"threshold": 90, "weights": {"lint": 0, "complexity": 0, "coverage": 1},
+                "coverage": {"interfaces": 1}}"#,
+        )
+        .unwrap();
+        model.validate().unwrap();
+        assert_eq!(model.lint, LintScoring::default());
+        let report = score(FACTORY_DEFAULT_CONFIG, &model, &rules(&model)).unwrap();
+        assert_eq!(report.score, 100.0);
+        assert!(report.passed);
+
+        for invalid in [
+            r#"{"coverage": {"printers": 1}}"#,
+            r#"{"complexity": {"rules": {"min": 10, "max": 5}}}"#,
+            r#"{"weights": {"lint": 0, "complexity": 0, "coverage": 0}}"#,
+            r#"{"threshold": 120}"#,
+        ] {
+            let model: ScoreModel = serde_json::from_str(invalid).unwrap();
+            assert!(model.validate().is_err(), "{invalid}");
+        }
+        assert!(serde_json::from_str::<ScoreModel>(r#"{"bonus": 1}"#).is_err());
+
+        let target = MetricTarget::at_least(4.0);
+        assert_eq!((target.score(2.0), target.score(9.0)), (50.0, 100.0));
+    }
+
+    #[test]
+    fn test_model_file_loads_yaml() {
+        let dir = tempfile::TempDir::new().unwrap();
+        let path = dir.path().join("default.yaml");
+        let content = r#"
+threshold: 75
+weights: { lint: 0.5, complexity: 0.2, coverage: 0.3 }
+complexity:
+  rules: { min: 20, max: 2000 }
+coverage:
+  vlans: 3
+  dhcp: 2
+"#;
+        fs::write(&path, content).unwrap();
+
+        let model = ScoreModel::load(&path).unwrap();
+        assert_eq!(model.threshold, 75.0);
+        assert_eq!(model.weights.coverage, 0.3);
+        assert_eq!(model.coverage.len(), 2);
+        assert_eq!(model.lint, LintScoring::default());
+    }
+}
@@ -0,0 +1,337 @@
+//! Strength and reuse audit of configuration secrets
+//!
+//! Secrets are found by element name ([`SECRET_ELEMENTS`]): passwords,
+//! pre-shared keys, private keys, RADIUS secrets, SNMP communities. Each
+//! plaintext secret is checked against [`SecretRules`]:
+//!
+//! - `too-short`: fewer characters than `min_length`
+//! - `few-classes`: fewer of lowercase, uppercase, digits, and symbols than
+//!   `min_classes`
+//! - `low-entropy`: an estimated strength below `min_entropy_bits`, taken as
+//!   the length times the Shannon entropy of its character distribution, so
+//!   repeated patterns score low
+//!
+//! Password hashes (`$2b$…`, `$6$…`) cannot be measured and only take part
+//! in the `duplicate` check, which reports every value used in more than one
+//! place across all audited files. Tests that assume independent devices are
+//! invalidated when a fleet shares one PSK or admin password.
+//!
+//! Findings name where a secret is but never include its value.
+
+use crate::Result;
+use crate::model::ConfigError;
+use crate::xml::tree::ConfigTree;
+use serde::{Deserialize, Serialize};
+use std::collections::{BTreeMap, HashMap, HashSet};
+use std::fmt;
+use std::fs;
+use std::path::Path;
+
+/// Element names holding secrets
+pub const SECRET_ELEMENTS: &[&str] = &[
+    "password",
+    "passwd",
+    "passphrase",
+    "pre-shared-key",
+    "presharedkey",
+    "psk",
+    "privkey",
+    "privatekey",
+    "secret",
+    "shared_secret",
+    "radius_secret",
+    "authkey",
+    "rocommunity",
+    "rwcommunity",
+];
+
+/// Prefixes of crypt-style password hashes
+const HASH_PREFIXES: &[&str] = &["$1$", "$2a$", "$2b$", "$2y$", "$5$", "$6$", "$argon2"];
+
+/// Complexity required of plaintext secrets
+///
+/// Also read from the `secrets` section of a [policy](crate::validate::policy)
+/// file; omitted fields keep their defaults.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(default)]
+pub struct SecretRules {
+    /// Fewest characters
+    pub min_length: usize,
+    /// Fewest character classes out of lowercase, uppercase, digits, symbols
+    pub min_classes: u8,
+    /// Lowest estimated strength in bits
+    pub min_entropy_bits: u32,
+}
+
+impl Default for SecretRules {
+    fn default() -> Self {
+        Self {
+            min_length: 16,
+            min_classes: 3,
+            min_entropy_bits: 64,
+        }
+    }
+}
+
+/// A secret found in a configuration
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Secret {
+    /// File the secret was read from
+    pub file: String,
+    /// Element path within the file
+    pub path: String,
+    /// Secret value
+    pub value: String,
+}
+
+impl Secret {
+    /// Whether the value is a password hash rather than the secret itself
+    pub fn is_hash(&self) -> bool {
+        HASH_PREFIXES
+            .iter()
+            .any(|prefix| self.value.starts_with(prefix))
+    }
+
+    /// `file:path` of the secret
+    pub fn location(&self) -> String {
+        format!("{}:{}", self.file, self.path)
+    }
+}
+
+/// A secret that fails a rule or is reused
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct SecretFinding {
+    /// Failed check: `too-short`, `few-classes`, `low-entropy`, or `duplicate`
+    pub check: &'static str,
+    /// Where the secret is, see [`Secret::location`]
+    pub location: String,
+    /// What is wrong
+    pub message: String,
+}
+
+impl fmt::Display for SecretFinding {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "[{}] {}: {}", self.check, self.location, self.message)
+    }
+}
+
+/// Secrets of one parsed configuration, in document order
+pub fn collect_secrets(tree: &ConfigTree, file: &str) -> Vec<Secret> {
+    (0..tree.len())
+        .map(|id| tree.node(id))
+        .filter(|node| SECRET_ELEMENTS.contains(&node.name.to_ascii_lowercase().as_str()))
+        .filter_map(|node| {
+            let value = node.value.as_deref().filter(|v| !v.is_empty())?;
+            Some(Secret {
+                file: file.to_string(),
+                path: node.path.clone(),
+                value: value.to_string(),
+            })
+        })
+        .collect()
+}
+
+/// Secrets of a configuration file, or of every XML file in a directory
+///
+/// A directory stands for a fleet and is read one level deep, in file name
+/// order.
+pub fn load_secrets<P: AsRef<Path>>(path: P) -> Result<Vec<Secret>> {
+    let path = path.as_ref();
+    if !path.exists() {
+        return Err(ConfigError::ConfigNotFound {
+            path: path.display().to_string(),
+        });
+    }
+
+    let files = if path.is_dir() {
+        let mut files: Vec<_> = fs::read_dir(path)?
+            .filter_map(|entry| entry.ok().map(|e| e.path()))
+            .filter(|p| {
+                p.extension()
+                    .and_then(|ext| ext.to_str())
+                    .is_some_and(|ext| ext.eq_ignore_ascii_case("xml"))
+            })
+            .collect();
+        files.sort();
+        files
+    } else {
+        vec![path.to_path_buf()]
+    };
+
+    let mut secrets = Vec::new();
+    for file in files {
+        let tree = ConfigTree::parse(&fs::read_to_string(&file)?)?;
+        let name = file
+            .file_name()
+            .unwrap_or(file.as_os_str())
+            .to_string_lossy();
+        secrets.extend(collect_secrets(&tree, &name));
+    }
+    Ok(secrets)
+}
+
+/// Check secrets against the rules and for reuse
+///
+/// Rule findings come first, in input order, followed by one `duplicate`
+/// finding per reused value at its first location.
+pub fn audit(secrets: &[Secret], rules: &SecretRules) -> Vec<SecretFinding> {
+    let mut findings = Vec::new();
+    for secret in secrets.iter().filter(|s| !s.is_hash()) {
+        let finding = |check, message| SecretFinding {
+            check,
+            location: secret.location(),
+            message,
+        };
+        let length = secret.value.chars().count();
+        if length < rules.min_length {
+            findings.push(finding(
+                "too-short",
+                format!(
+                    "{length} characters, at least {} required",
+                    rules.min_length
+                ),
+            ));
+        }
+        let classes = char_classes(&secret.value);
+        if classes < rules.min_classes {
+            findings.push(finding(
+                "few-classes",
+                format!(
+                    "{classes} character classes, at least {} required",
+                    rules.min_classes
+                ),
+            ));
+        }
+        let bits = entropy_bits(&secret.value);
+        if bits < f64::from(rules.min_entropy_bits) {
+            findings.push(finding(
+                "low-entropy",
+                format!(
+                    "about {bits:.0} bits, at least {} required",
+                    rules.min_entropy_bits
+                ),
+            ));
+        }
+    }
+
+    let mut uses: HashMap<&str, Vec<usize>> = HashMap::new();
+    for (index, secret) in secrets.iter().enumerate() {
+        uses.entry(secret.value.as_str()).or_default().push(index);
+    }
+    // Keyed by first use so reports are stable
+    let reused: BTreeMap<usize, &Vec<usize>> = uses
+        .values()
+        .filter(|group| group.len() > 1)
+        .map(|group| (group[0], group))
+        .collect();
+    for (&first, group) in &reused {
+        let first = &secrets[first];
+        let files: HashSet<&str> = group.iter().map(|&i| secrets[i].file.as_str()).collect();
+        let what = if first.is_hash() {
+            "password hash"
+        } else {
+            "secret"
+        };
+        let others: Vec<String> = group[1..].iter().map(|&i| secrets[i].location()).collect();
+        findings.push(SecretFinding {
+            check: "duplicate",
+            location: first.location(),
+            message: format!(
+                "same {what} in {} places across {} file(s), also at {}",
+                group.len(),
+                files.len(),
+                others.join(", ")
+            ),
+        });
+    }
+    findings
+}
+
+/// Estimated strength in bits: length times the Shannon entropy per character
+pub fn entropy_bits(value: &str) -> f64 {
+    let mut counts: HashMap<char, usize> = HashMap::new();
+    for c in value.chars() {
+        *counts.entry(c).or_default() += 1;
+    }
+    let length = value.chars().count() as f64;
+    let per_char: f64 = counts
+        .values()
+        .map(|&count| {
+            let p = count as f64 / length;
+            -p * p.log2()
+        })
+        .sum();
+    length * per_char
+}
+
+/// Number of character classes used: lowercase, uppercase, digits, symbols
+pub fn char_classes(value: &str) -> u8 {
+    let classes = [
+        value.chars().any(|c| c.is_lowercase()),
+        value.chars().any(|c| c.is_uppercase()),
+        value.chars().any(|c| c.is_ascii_digit()),
+        value.chars().any(|c| !c.is_alphanumeric()),
+    ];
+    classes.iter().filter(|&&used| used).count() as u8
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn secret(file: &str, path: &str, value: &str) -> Secret {
+        Secret {
+            file: file.to_string(),
+            path: path.to_string(),
+            value: value.to_string(),
+        }
+    }
+
+    #[test]
+    fn test_collect_secrets_by_element_name() {
+        let tree = ConfigTree::parse(
+            "<opnsense><system><user><name>root</name>\
+             <password>$2b$10$abc</password></user></system>\
+             <ipsec><phase1><pre-shared-key>hunter2</pre-shared-key></phase1></ipsec>\
+             <snmpd><rocommunity></rocommunity></snmpd></opnsense>",
+        )
+        .unwrap();
+        let secrets = collect_secrets(&tree, "fw1.xml");
+        assert_eq!(secrets.len(), 2);
+        assert!(secrets[0].is_hash());
+        assert_eq!(secrets[1].value, "hunter2");
+        assert!(secrets[1].location().starts_with("fw1.xml:/opnsense/ipsec"));
+    }
+
+    #[test]
+    fn test_audit_flags_weak_and_shared_secrets() {
+        let strong = "q7#Vn2!pLx9@Rt4$Wz";
+        let secrets = [
+            secret("fw1.xml", "/psk", "aaaaaaaaaaaaaaaaaaaa"),
+            secret("fw1.xml", "/password", "$2b$10$same"),
+            secret("fw2.xml", "/psk", strong),
+            secret("fw2.xml", "/password", "$2b$10$same"),
+            secret("fw3.xml", "/psk", strong),
+        ];
+        let findings = audit(&secrets, &SecretRules::default());
+        let checks: Vec<(&str, &str)> = findings
+            .iter()
+            .map(|f| (f.check, f.location.as_str()))
+            .collect();
+        assert_eq!(
+            checks,
+            [
+                ("few-classes", "fw1.xml:/psk"),
+                ("low-entropy", "fw1.xml:/psk"),
+                ("duplicate", "fw1.xml:/password"),
+                ("duplicate", "fw2.xml:/psk"),
+            ]
+        );
+        assert!(findings[2].message.contains("password hash"));
+        assert!(findings.iter().all(|f| !f.to_string().contains(strong)));
+
+        assert!(entropy_bits(strong) > 64.0);
+        assert_eq!(entropy_bits("aaaa"), 0.0);
+        assert_eq!(char_classes("ab1!"), 3);
+    }
+}
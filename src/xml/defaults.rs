@@ -0,0 +1,134 @@
+//! Embedded OPNsense factory-default configuration
+//!
+//! Real configurations start as the `config.xml` OPNsense ships with and grow
+//! as interfaces, VLANs, and DHCP ranges are added. [`FACTORY_DEFAULT_CONFIG`]
+//! is that stock configuration; [`config_from_default`] adds generated
+//! sections to it without touching anything else, so a diff against the
+//! factory default shows exactly what was generated.
+
+use crate::Result;
+use crate::generator::{VlanConfig, VlanInterface};
+use crate::model::ConfigError;
+use crate::xml::template::escape_xml_string;
+
+/// Stock OPNsense factory-default `config.xml`
+pub const FACTORY_DEFAULT_CONFIG: &str = include_str!("factory_default.xml");
+
+/// Physical LAN device of the factory default, used as the VLAN parent
+pub(crate) const PARENT_INTERFACE: &str = "mismatch0";
+
+/// Build a configuration from the factory default with the VLANs added
+///
+/// Each VLAN becomes a `<vlans>` entry, an `opt` interface numbered from
+/// `opt_counter`, and a DHCP range. When interface profiles are given, their
+/// MTU and priority code point are set as well.
+pub fn config_from_default(
+    configs: &[VlanConfig],
+    opt_counter: u16,
+    interfaces: Option<&[VlanInterface]>,
+) -> Result<String> {
+    let mut vlans = String::new();
+    let mut opt_interfaces = String::new();
+    let mut dhcp = String::new();
+
+    for (index, config) in configs.iter().enumerate() {
+        let opt = format!("opt{}", opt_counter as usize + index);
+        let device = format!("{PARENT_INTERFACE}_vlan{}", config.vlan_id);
+        let descr = escape_xml_string(&config.description);
+        let profile = interfaces
+            .and_then(|interfaces| interfaces.iter().find(|i| i.vlan_id == config.vlan_id))
+            .map(|i| i.profile);
+        let pcp = profile.map_or(0, |p| p.pcp);
+        let mtu = profile.map(|p| p.mtu.to_string()).unwrap_or_default();
+
+        vlans.push_str(&format!(
+            "    <vlan>\n      <if>{PARENT_INTERFACE}</if>\n      <tag>{}</tag>\n      \
+             <pcp>{pcp}</pcp>\n      <descr>{descr}</descr>\n      <vlanif>{device}</vlanif>\n    \
+             </vlan>\n",
+            config.vlan_id
+        ));
+        opt_interfaces.push_str(&format!(
+            "    <{opt}>\n      <if>{device}</if>\n      <descr>{descr}</descr>\n      \
+             <enable>1</enable>\n      <ipaddr>{}</ipaddr>\n      <subnet>24</subnet>\n      \
+             <mtu>{mtu}</mtu>\n    </{opt}>\n",
+            escape_xml_string(&config.gateway_ip()?)
+        ));
+        dhcp.push_str(&format!(
+            "    <{opt}>\n      <enable/>\n      <range>\n        <from>{}</from>\n        \
+             <to>{}</to>\n      </range>\n    </{opt}>\n",
+            escape_xml_string(&config.dhcp_range_start()?),
+            escape_xml_string(&config.dhcp_range_end()?)
+        ));
+    }
+
+    let mut result = FACTORY_DEFAULT_CONFIG.to_string();
+    insert_before(&mut result, "  </interfaces>", &opt_interfaces)?;
+    insert_before(&mut result, "  </dhcpd>", &dhcp)?;
+    if !vlans.is_empty() {
+        insert_before(
+            &mut result,
+            "</opnsense>",
+            &format!("  <vlans>\n{vlans}  </vlans>\n"),
+        )?;
+    }
+    Ok(result)
+}
+
+/// Insert `content` before the first occurrence of `marker`
+fn insert_before(document: &mut String, marker: &str, content: &str) -> Result<()> {
+    let position = document.find(marker).ok_or_else(|| {
+        ConfigError::config(format!(
+            "Factory default configuration has no '{}'",
+            marker.trim()
+        ))
+    })?;
+    document.insert_str(position, content);
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::xml::diff::{ChangeKind, diff_configs};
+
+    #[test]
+    fn test_factory_default_is_stock() {
+        assert!(FACTORY_DEFAULT_CONFIG.contains("<hostname>OPNsense</hostname>"));
+        assert!(!FACTORY_DEFAULT_CONFIG.contains("<vlans>"));
+        assert!(!FACTORY_DEFAULT_CONFIG.contains("{{"));
+    }
+
+    #[test]
+    fn test_config_from_default_only_adds() {
+        let configs = vec![
+            VlanConfig::new(
+                100,
+                "10.1.2.x".to_string(),
+                "Sales & Ops VLAN 100".to_string(),
+                1,
+            )
+            .unwrap(),
+            VlanConfig::new(200, "10.1.3.x".to_string(), "IT VLAN 200".to_string(), 2).unwrap(),
+        ];
+        let config = config_from_default(&configs, 6, None).unwrap();
+        assert!(config.contains("<descr>Sales &amp; Ops VLAN 100</descr>"));
+        assert!(config.contains("<opt7>"));
+
+        let changes = diff_configs(FACTORY_DEFAULT_CONFIG, &config).unwrap();
+        assert!(!changes.is_empty());
+        assert!(changes.iter().all(|c| c.kind == ChangeKind::Added));
+        let tag = changes
+            .iter()
+            .find(|c| c.path == "/opnsense/vlans/vlan[2]/tag")
+            .unwrap();
+        assert_eq!(tag.new.as_deref(), Some("200"));
+    }
+
+    #[test]
+    fn test_empty_config_is_factory_default() {
+        assert_eq!(
+            config_from_default(&[], 6, None).unwrap(),
+            FACTORY_DEFAULT_CONFIG
+        );
+    }
+}
@@ -0,0 +1,263 @@
+//! Structural comparison of OPNsense configurations
+//!
+//! [`flatten`] reduces a document to its leaf values keyed by path, such as
+//! `/opnsense/interfaces/lan/ipaddr`. Repeated siblings are numbered from the
+//! second occurrence (`/opnsense/filter/rule[2]/type`), so a section that only
+//! gains entries keeps the paths of its existing ones. [`diff_configs`] then
+//! reports which paths were added, removed, or changed; formatting, comments,
+//! and attribute order do not matter.
+
+use crate::Result;
+use crate::io::previous::resolve_entity;
+use crate::model::ConfigError;
+use quick_xml::Reader;
+use quick_xml::events::{BytesStart, Event};
+use serde::Serialize;
+use std::collections::HashMap;
+use std::fmt;
+
+/// Kind of difference at one path
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "lowercase")]
+pub enum ChangeKind {
+    /// Present only in the new document
+    Added,
+    /// Present only in the old document
+    Removed,
+    /// Present in both with different values
+    Changed,
+}
+
+impl fmt::Display for ChangeKind {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(match self {
+            ChangeKind::Added => "added",
+            ChangeKind::Removed => "removed",
+            ChangeKind::Changed => "changed",
+        })
+    }
+}
+
+/// Difference of one leaf value
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct ConfigChange {
+    /// What happened to the value
+    pub kind: ChangeKind,
+    /// Path of the element or attribute
+    pub path: String,
+    /// Value in the old document
+    pub old: Option<String>,
+    /// Value in the new document
+    pub new: Option<String>,
+}
+
+/// Element being read while flattening
+struct Frame {
+    path: String,
+    text: String,
+    has_children: bool,
+    child_counts: HashMap<String, usize>,
+}
+
+/// Leaf values of a document as (path, value) pairs in document order
+///
+/// Elements without child elements yield their trimmed text (empty for
+/// `<enable/>`); attributes yield `path/@name`.
+pub fn flatten(content: &str) -> Result<Vec<(String, String)>> {
+    let mut reader = Reader::from_str(content);
+    let mut stack: Vec<Frame> = Vec::new();
+    let mut leaves = Vec::new();
+
+    loop {
+        let event = reader.read_event().map_err(|e| {
+            ConfigError::xml_event_parsing(format!(
+                "Failed to parse XML at position {}: {e}",
+                reader.buffer_position()
+            ))
+        })?;
+        match event {
+            Event::Start(ref start) => {
+                let path = child_path(&mut stack, start);
+                push_attributes(start, &path, &mut leaves)?;
+                stack.push(Frame {
+                    path,
+                    text: String::new(),
+                    has_children: false,
+                    child_counts: HashMap::new(),
+                });
+            }
+            Event::Empty(ref start) => {
+                let path = child_path(&mut stack, start);
+                push_attributes(start, &path, &mut leaves)?;
+                leaves.push((path, String::new()));
+            }
+            Event::End(_) => {
+                if let Some(frame) = stack.pop()
+                    && !frame.has_children
+                {
+                    leaves.push((frame.path, frame.text.trim().to_string()));
+                }
+            }
+            Event::Text(ref text) => {
+                if let Some(frame) = stack.last_mut() {
+                    frame.text.push_str(&String::from_utf8_lossy(text));
+                }
+            }
+            Event::CData(ref data) => {
+                if let Some(frame) = stack.last_mut() {
+                    frame.text.push_str(&String::from_utf8_lossy(data));
+                }
+            }
+            Event::GeneralRef(ref entity) => {
+                if let Some(frame) = stack.last_mut() {
+                    frame
+                        .text
+                        .push_str(&resolve_entity(&String::from_utf8_lossy(entity)));
+                }
+            }
+            Event::Eof => break,
+            _ => {}
+        }
+    }
+
+    Ok(leaves)
+}
+
+/// Compare two documents leaf by leaf
+///
+/// Additions and changes are listed in the order of the new document,
+/// followed by removals in the order of the old one.
+pub fn diff_configs(old: &str, new: &str) -> Result<Vec<ConfigChange>> {
+    Ok(diff_leaves(&flatten(old)?, &flatten(new)?))
+}
+
+/// Compare two [flattened](flatten) documents
+pub fn diff_leaves(
+    old_leaves: &[(String, String)],
+    new_leaves: &[(String, String)],
+) -> Vec<ConfigChange> {
+    let old_values: HashMap<&str, &str> = old_leaves
+        .iter()
+        .map(|(path, value)| (path.as_str(), value.as_str()))
+        .collect();
+    let new_values: HashMap<&str, &str> = new_leaves
+        .iter()
+        .map(|(path, value)| (path.as_str(), value.as_str()))
+        .collect();
+
+    let mut changes = Vec::new();
+    for (path, value) in new_leaves {
+        match old_values.get(path.as_str()) {
+            None => changes.push(ConfigChange {
+                kind: ChangeKind::Added,
+                path: path.clone(),
+                old: None,
+                new: Some(value.clone()),
+            }),
+            Some(old) if old != value => changes.push(ConfigChange {
+                kind: ChangeKind::Changed,
+                path: path.clone(),
+                old: Some(old.to_string()),
+                new: Some(value.clone()),
+            }),
+            Some(_) => {}
+        }
+    }
+    for (path, value) in old_leaves {
+        if !new_values.contains_key(path.as_str()) {
+            changes.push(ConfigChange {
+                kind: ChangeKind::Removed,
+                path: path.clone(),
+                old: Some(value.clone()),
+                new: None,
+            });
+        }
+    }
+
+    changes
+}
+
+/// Path of a new child of the innermost open element
+fn child_path(stack: &mut [Frame], start: &BytesStart<'_>) -> String {
+    let name = String::from_utf8_lossy(start.name().as_ref()).into_owned();
+    let Some(parent) = stack.last_mut() else {
+        return format!("/{name}");
+    };
+    parent.has_children = true;
+    let count = parent.child_counts.entry(name.clone()).or_default();
+    *count += 1;
+    match *count {
+        1 => format!("{}/{name}", parent.path),
+        n => format!("{}/{name}[{n}]", parent.path),
+    }
+}
+
+fn push_attributes(
+    start: &BytesStart<'_>,
+    path: &str,
+    leaves: &mut Vec<(String, String)>,
+) -> Result<()> {
+    for attribute in start.attributes().flatten() {
+        let value = attribute
+            .unescape_value()
+            .map_err(|e| ConfigError::xml_event_parsing(e.to_string()))?;
+        leaves.push((
+            format!(
+                "{path}/@{}",
+                String::from_utf8_lossy(attribute.key.as_ref())
+            ),
+            value.into_owned(),
+        ));
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_flatten_paths() {
+        let leaves = flatten(
+            r#"<opnsense><filter><rule><type>pass</type></rule><rule uuid="b"><type>block</type></rule></filter><rrd><enable/></rrd><descr>A &amp; B</descr></opnsense>"#,
+        )
+        .unwrap();
+        assert_eq!(
+            leaves,
+            vec![
+                ("/opnsense/filter/rule/type".to_string(), "pass".to_string()),
+                (
+                    "/opnsense/filter/rule[2]/@uuid".to_string(),
+                    "b".to_string()
+                ),
+                (
+                    "/opnsense/filter/rule[2]/type".to_string(),
+                    "block".to_string()
+                ),
+                ("/opnsense/rrd/enable".to_string(), String::new()),
+                ("/opnsense/descr".to_string(), "A & B".to_string()),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_diff_ignores_formatting() {
+        let old = "<opnsense>\n  <system>\n    <hostname>fw</hostname>\n  </system>\n</opnsense>";
+        let new = "<opnsense><system><hostname>fw</hostname></system></opnsense>";
+        assert!(diff_configs(old, new).unwrap().is_empty());
+    }
+
+    #[test]
+    fn test_diff_reports_changes() {
+        let old = "<opnsense><a>1</a><b>2</b></opnsense>";
+        let new = "<opnsense><a>1</a><b>3</b><c>4</c></opnsense>";
+        let changes = diff_configs(old, new).unwrap();
+        let kinds: Vec<ChangeKind> = changes.iter().map(|c| c.kind).collect();
+        assert_eq!(kinds, vec![ChangeKind::Changed, ChangeKind::Added]);
+        assert_eq!(changes[0].old.as_deref(), Some("2"));
+
+        let reversed = diff_configs(new, old).unwrap();
+        assert_eq!(reversed.last().unwrap().kind, ChangeKind::Removed);
+        assert_eq!(reversed.last().unwrap().path, "/opnsense/c");
+    }
+}
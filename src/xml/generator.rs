@@ -59,7 +59,7 @@ pub trait XMLGenerator: Send + Sync {
 
     /// Get component identifier for debugging
     fn component_id(&self) -> String {
-        format!("{}_{}", self.component_type(), uuid::Uuid::new_v4())
+        self.component_type().to_string()
     }
 
     /// Check if this generator supports streaming output
@@ -0,0 +1,615 @@
+//! Object dependency graph of an OPNsense configuration
+//!
+//! [`DependencyGraph::from_tree`] collects the objects of a configuration and
+//! the references between them, for impact analysis:
+//!
+//! - firewall rules use interfaces, aliases, and literal addresses
+//! - aliases contain nested aliases and hosts
+//! - interfaces are assigned VLANs or physical ports, and VLANs sit on
+//!   their parent device
+//! - services such as the web GUI use certificates, which are signed by
+//!   certificate authorities
+//!
+//! Edges point from the dependent object to what it depends on. The graph is
+//! serialized as JSON or as [GraphML](http://graphml.graphdrawing.org/).
+
+use crate::xml::template::escape_xml_string;
+use crate::xml::tree::ConfigTree;
+use serde::Serialize;
+use std::collections::{BTreeMap, HashMap, HashSet};
+use std::fmt;
+use std::fmt::Write as _;
+
+/// Kind of configuration object
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Serialize)]
+#[serde(rename_all = "kebab-case")]
+pub enum NodeKind {
+    /// Firewall filter rule
+    Rule,
+    /// Firewall alias
+    Alias,
+    /// Address, network, or host name used by a rule or alias
+    Host,
+    /// Assigned interface such as `lan` or `opt6`
+    Interface,
+    /// VLAN device
+    Vlan,
+    /// Physical device a VLAN or interface sits on
+    Port,
+    /// Service configured with a certificate
+    Service,
+    /// Certificate
+    Certificate,
+    /// Certificate authority
+    Authority,
+}
+
+impl fmt::Display for NodeKind {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(match self {
+            NodeKind::Rule => "rule",
+            NodeKind::Alias => "alias",
+            NodeKind::Host => "host",
+            NodeKind::Interface => "interface",
+            NodeKind::Vlan => "vlan",
+            NodeKind::Port => "port",
+            NodeKind::Service => "service",
+            NodeKind::Certificate => "certificate",
+            NodeKind::Authority => "authority",
+        })
+    }
+}
+
+/// How one object depends on another
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Serialize)]
+#[serde(rename_all = "kebab-case")]
+pub enum Relation {
+    /// Rule is on, or addresses, an interface
+    UsesInterface,
+    /// Rule or alias refers to an alias
+    UsesAlias,
+    /// Rule addresses a literal host or network
+    Addresses,
+    /// Alias lists a host or network
+    Contains,
+    /// Interface is assigned a VLAN
+    Assigned,
+    /// Interface or VLAN sits on a device
+    Parent,
+    /// Service uses a certificate or authority
+    UsesCertificate,
+    /// Certificate is signed by an authority
+    SignedBy,
+}
+
+impl fmt::Display for Relation {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(match self {
+            Relation::UsesInterface => "uses-interface",
+            Relation::UsesAlias => "uses-alias",
+            Relation::Addresses => "addresses",
+            Relation::Contains => "contains",
+            Relation::Assigned => "assigned",
+            Relation::Parent => "parent",
+            Relation::UsesCertificate => "uses-certificate",
+            Relation::SignedBy => "signed-by",
+        })
+    }
+}
+
+/// One object of the configuration
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct GraphNode {
+    /// Unique id, `<kind>:<key>`
+    pub id: String,
+    /// Kind of object
+    pub kind: NodeKind,
+    /// Human-readable name
+    pub label: String,
+    /// Element path, `None` for objects only named by references
+    pub path: Option<String>,
+}
+
+/// Dependency of one object on another
+#[derive(Debug, Clone, PartialEq, Eq, PartialOrd, Ord, Serialize)]
+pub struct GraphEdge {
+    /// Id of the dependent object
+    pub source: String,
+    /// Id of the object depended on
+    pub target: String,
+    /// Kind of dependency
+    pub relation: Relation,
+}
+
+/// Objects and dependencies of a configuration
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize)]
+pub struct DependencyGraph {
+    /// Objects in kind and document order
+    pub nodes: Vec<GraphNode>,
+    /// Dependencies, sorted and without duplicates
+    pub edges: Vec<GraphEdge>,
+}
+
+impl DependencyGraph {
+    /// Collect the objects of a parsed configuration
+    pub fn from_tree(tree: &ConfigTree) -> Self {
+        let mut builder = Builder::new(tree);
+        builder.collect();
+        builder.finish()
+    }
+
+    /// Number of nodes per kind
+    pub fn kind_counts(&self) -> BTreeMap<NodeKind, usize> {
+        let mut counts = BTreeMap::new();
+        for node in &self.nodes {
+            *counts.entry(node.kind).or_default() += 1;
+        }
+        counts
+    }
+
+    /// Render as a GraphML document
+    ///
+    /// Node kind, label, and path and the edge relation are GraphML data
+    /// keys, so tools such as yEd or NetworkX read them as attributes.
+    pub fn to_graphml(&self) -> String {
+        let mut out = String::from(
+            "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n\
+             <graphml xmlns=\"http://graphml.graphdrawing.org/xmlns\">\n",
+        );
+        for (id, target) in [("kind", "node"), ("label", "node"), ("path", "node")] {
+            let _ = writeln!(
+                out,
+                "  <key id=\"{id}\" for=\"{target}\" attr.name=\"{id}\" attr.type=\"string\"/>"
+            );
+        }
+        out.push_str(
+            "  <key id=\"relation\" for=\"edge\" attr.name=\"relation\" attr.type=\"string\"/>\n",
+        );
+        out.push_str("  <graph id=\"opnsense\" edgedefault=\"directed\">\n");
+        for node in &self.nodes {
+            let _ = writeln!(out, "    <node id=\"{}\">", escape_xml_string(&node.id));
+            let _ = writeln!(out, "      <data key=\"kind\">{}</data>", node.kind);
+            let _ = writeln!(
+                out,
+                "      <data key=\"label\">{}</data>",
+                escape_xml_string(&node.label)
+            );
+            if let Some(path) = &node.path {
+                let path = escape_xml_string(path);
+                let _ = writeln!(out, "      <data key=\"path\">{path}</data>");
+            }
+            out.push_str("    </node>\n");
+        }
+        for edge in &self.edges {
+            let _ = writeln!(
+                out,
+                "    <edge source=\"{}\" target=\"{}\">",
+                escape_xml_string(&edge.source),
+                escape_xml_string(&edge.target)
+            );
+            let _ = writeln!(out, "      <data key=\"relation\">{}</data>", edge.relation);
+            out.push_str("    </edge>\n");
+        }
+        out.push_str("  </graph>\n</graphml>\n");
+        out
+    }
+}
+
+/// Ids of the named objects a value can refer to
+#[derive(Default)]
+struct Names {
+    aliases: HashMap<String, String>,
+    interfaces: HashMap<String, String>,
+    vlans: HashMap<String, String>,
+    certificates: HashMap<String, String>,
+}
+
+struct Builder<'a> {
+    tree: &'a ConfigTree,
+    names: Names,
+    /// Interface elements and their node ids
+    interface_elements: Vec<(usize, String)>,
+    ids: HashSet<String>,
+    nodes: Vec<GraphNode>,
+    edges: Vec<GraphEdge>,
+}
+
+impl<'a> Builder<'a> {
+    fn new(tree: &'a ConfigTree) -> Self {
+        Self {
+            tree,
+            names: Names::default(),
+            interface_elements: Vec::new(),
+            ids: HashSet::new(),
+            nodes: Vec::new(),
+            edges: Vec::new(),
+        }
+    }
+
+    fn collect(&mut self) {
+        // Named objects first, so references resolve regardless of order
+        for id in 0..self.tree.len() {
+            let node = self.tree.node(id);
+            let parent = node.parent.map(|p| self.tree.node(p));
+            match node.name.as_str() {
+                "alias" => {
+                    if let Some(name) = self.tree.child_value(id, "name") {
+                        let key = self.add(NodeKind::Alias, name, name, Some(id));
+                        self.names.aliases.insert(name.to_string(), key);
+                    }
+                }
+                "vlan" => {
+                    if let Some(device) = self.tree.child_value(id, "vlanif") {
+                        let label = match self.tree.child_value(id, "descr") {
+                            Some(descr) if !descr.is_empty() => format!("{device} ({descr})"),
+                            _ => device.to_string(),
+                        };
+                        let key = self.add(NodeKind::Vlan, device, &label, Some(id));
+                        self.names.vlans.insert(device.to_string(), key);
+                    }
+                }
+                "cert" | "ca" if parent.is_some_and(|p| p.depth == 0) => {
+                    if let Some(refid) = self.tree.child_value(id, "refid") {
+                        let kind = match node.name.as_str() {
+                            "ca" => NodeKind::Authority,
+                            _ => NodeKind::Certificate,
+                        };
+                        let label = self.tree.child_value(id, "descr").unwrap_or(refid);
+                        let key = self.add(kind, refid, label, Some(id));
+                        self.names.certificates.insert(refid.to_string(), key);
+                    }
+                }
+                _ if parent.is_some_and(|p| p.name == "interfaces" && p.depth == 1) => {
+                    let label = match self.tree.child_value(id, "descr") {
+                        Some(descr) if !descr.is_empty() => format!("{} ({descr})", node.name),
+                        _ => node.name.clone(),
+                    };
+                    let key = self.add(NodeKind::Interface, &node.name, &label, Some(id));
+                    self.names.interfaces.insert(node.name.clone(), key.clone());
+                    self.interface_elements.push((id, key));
+                }
+                _ => {}
+            }
+        }
+
+        for id in 0..self.tree.len() {
+            let node = self.tree.node(id);
+            match node.name.as_str() {
+                "alias" => self.link_alias(id),
+                "vlan" => self.link_vlan(id),
+                "rule" if self.tree.ancestors(id).iter().any(|&a| self.is_filter(a)) => {
+                    self.link_rule(id)
+                }
+                "cert" => self.link_signer(id),
+                name if name.ends_with("certref") || name == "caref" => self.link_service(id),
+                _ => {}
+            }
+        }
+        for (element, key) in std::mem::take(&mut self.interface_elements) {
+            self.link_interface(element, &key);
+        }
+    }
+
+    /// Whether an element holds filter rules (`filter` or the MVC `Filter`)
+    fn is_filter(&self, id: usize) -> bool {
+        self.tree.node(id).name.eq_ignore_ascii_case("filter")
+    }
+
+    fn add(&mut self, kind: NodeKind, key: &str, label: &str, element: Option<usize>) -> String {
+        let id = format!("{kind}:{key}");
+        if self.ids.insert(id.clone()) {
+            self.nodes.push(GraphNode {
+                id: id.clone(),
+                kind,
+                label: label.to_string(),
+                path: element.map(|e| self.tree.node(e).path.clone()),
+            });
+        }
+        id
+    }
+
+    fn edge(&mut self, source: &str, target: String, relation: Relation) {
+        self.edges.push(GraphEdge {
+            source: source.to_string(),
+            target,
+            relation,
+        });
+    }
+
+    fn link_alias(&mut self, id: usize) {
+        let Some(name) = self.tree.child_value(id, "name") else {
+            return;
+        };
+        let source = format!("{}:{name}", NodeKind::Alias);
+        // Port and URL aliases list no hosts
+        let lists_hosts = self
+            .tree
+            .child_value(id, "type")
+            .is_none_or(|kind| matches!(kind, "host" | "network" | "networkgroup"));
+        let content = self.tree.child_value(id, "content").unwrap_or_default();
+        for member in content
+            .split(['\n', ','])
+            .map(str::trim)
+            .filter(|m| !m.is_empty())
+        {
+            if let Some(target) = self.names.aliases.get(member) {
+                self.edge(&source, target.clone(), Relation::UsesAlias);
+            } else if lists_hosts {
+                let target = self.add(NodeKind::Host, member, member, None);
+                self.edge(&source, target, Relation::Contains);
+            }
+        }
+    }
+
+    fn link_rule(&mut self, id: usize) {
+        // Rules are keyed by uuid where they have one, else by path
+        let key = self
+            .tree
+            .node(id)
+            .attributes
+            .iter()
+            .find(|(name, _)| name == "uuid")
+            .map(|(_, uuid)| uuid.clone())
+            .unwrap_or_else(|| self.tree.node(id).path.clone());
+        let label = self
+            .tree
+            .child_value(id, "descr")
+            .filter(|d| !d.is_empty())
+            .unwrap_or(&key)
+            .to_string();
+        let source = self.add(NodeKind::Rule, &key, &label, Some(id));
+
+        for interface in self
+            .tree
+            .child_value(id, "interface")
+            .unwrap_or_default()
+            .split(',')
+        {
+            if let Some(target) = self.names.interfaces.get(interface) {
+                self.edge(&source, target.clone(), Relation::UsesInterface);
+            }
+        }
+        let endpoints: Vec<usize> = self
+            .tree
+            .node(id)
+            .children
+            .iter()
+            .copied()
+            .filter(|&c| matches!(self.tree.node(c).name.as_str(), "source" | "destination"))
+            .collect();
+        for endpoint in endpoints {
+            for field in ["address", "network"] {
+                if let Some(value) = self.tree.child_value(endpoint, field) {
+                    self.link_address(&source, value);
+                }
+            }
+        }
+    }
+
+    /// Link a rule to what a source or destination value names
+    fn link_address(&mut self, source: &str, value: &str) {
+        let value = value.trim_start_matches('!');
+        // `lanip` is the interface address of `lan`
+        let interface = self.names.interfaces.get(value).or_else(|| {
+            value
+                .strip_suffix("ip")
+                .and_then(|i| self.names.interfaces.get(i))
+        });
+        if let Some(target) = self.names.aliases.get(value) {
+            self.edge(source, target.clone(), Relation::UsesAlias);
+        } else if let Some(target) = interface {
+            self.edge(source, target.clone(), Relation::UsesInterface);
+        } else if !value.is_empty() && value != "any" {
+            let target = self.add(NodeKind::Host, value, value, None);
+            self.edge(source, target, Relation::Addresses);
+        }
+    }
+
+    /// Link an interface to the VLAN or port in its `<if>`
+    fn link_interface(&mut self, id: usize, source: &str) {
+        let Some(device) = self.tree.child_value(id, "if").filter(|d| !d.is_empty()) else {
+            return;
+        };
+        match self.names.vlans.get(device) {
+            Some(target) => self.edge(source, target.clone(), Relation::Assigned),
+            None => {
+                let target = self.add(NodeKind::Port, device, device, None);
+                self.edge(source, target, Relation::Parent);
+            }
+        }
+    }
+
+    /// Link a VLAN to its parent device, which can itself be a VLAN (QinQ)
+    fn link_vlan(&mut self, id: usize) {
+        let (Some(device), Some(parent)) = (
+            self.tree.child_value(id, "vlanif"),
+            self.tree.child_value(id, "if"),
+        ) else {
+            return;
+        };
+        let source = format!("{}:{device}", NodeKind::Vlan);
+        let target = match self.names.vlans.get(parent) {
+            Some(vlan) => vlan.clone(),
+            None => self.add(NodeKind::Port, parent, parent, None),
+        };
+        self.edge(&source, target, Relation::Parent);
+    }
+
+    fn link_signer(&mut self, id: usize) {
+        let (Some(refid), Some(caref)) = (
+            self.tree.child_value(id, "refid"),
+            self.tree.child_value(id, "caref"),
+        ) else {
+            return;
+        };
+        let Some(source) = self.names.certificates.get(refid).cloned() else {
+            return;
+        };
+        if let Some(target) = self.names.certificates.get(caref) {
+            self.edge(&source, target.clone(), Relation::SignedBy);
+        }
+    }
+
+    /// Link the element holding a certificate reference as a service
+    fn link_service(&mut self, id: usize) {
+        let node = self.tree.node(id);
+        let Some(parent) = node.parent else {
+            return;
+        };
+        let owner = self.tree.node(parent);
+        if matches!(owner.name.as_str(), "cert" | "ca") {
+            return;
+        }
+        let Some(target) = node
+            .value
+            .as_ref()
+            .and_then(|r| self.names.certificates.get(r))
+        else {
+            return;
+        };
+        let target = target.clone();
+        let label = self
+            .tree
+            .child_value(parent, "description")
+            .or_else(|| self.tree.child_value(parent, "descr"))
+            .filter(|d| !d.is_empty())
+            .map_or_else(
+                || owner.path.trim_start_matches('/').to_string(),
+                str::to_string,
+            );
+        let path = owner.path.clone();
+        let source = self.add(NodeKind::Service, &path, &label, Some(parent));
+        self.edge(&source, target, Relation::UsesCertificate);
+    }
+
+    fn finish(mut self) -> DependencyGraph {
+        self.nodes.sort_by_key(|node| node.kind);
+        self.edges.sort();
+        self.edges.dedup();
+        DependencyGraph {
+            nodes: self.nodes,
+            edges: self.edges,
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const CONFIG: &str = r#"<opnsense>
+  <system><webgui><ssl-certref>c1</ssl-certref></webgui></system>
+  <interfaces>
+    <lan><if>em1</if></lan>
+    <opt6><if>em1_vlan100</if><descr>Sales</descr></opt6>
+  </interfaces>
+  <vlans><vlan><if>em1</if><tag>100</tag><vlanif>em1_vlan100</vlanif></vlan></vlans>
+  <filter>
+    <rule uuid="r1">
+      <interface>opt6</interface>
+      <source><address>SALES_NETS</address></source>
+      <destination><address>192.0.2.7</address></destination>
+    </rule>
+    <rule><interface>lan</interface><source><network>lan</network></source></rule>
+  </filter>
+  <aliases>
+    <alias><name>SALES_NETS</name><type>network</type><content>10.1.0.0/24
+BRANCH_NETS</content></alias>
+    <alias><name>BRANCH_NETS</name><type>network</type><content>10.2.0.0/24</content></alias>
+    <alias><name>WEB</name><type>port</type><content>443</content></alias>
+  </aliases>
+  <ca><refid>ca1</refid><descr>Lab CA</descr></ca>
+  <cert><refid>c1</refid><descr>Web GUI</descr><caref>ca1</caref></cert>
+</opnsense>"#;
+
+    fn has_edge(graph: &DependencyGraph, source: &str, target: &str, relation: Relation) -> bool {
+        graph
+            .edges
+            .iter()
+            .any(|e| e.source == source && e.target == target && e.relation == relation)
+    }
+
+    #[test]
+    fn test_graph_follows_rules_interfaces_and_certificates() {
+        let graph = DependencyGraph::from_tree(&ConfigTree::parse(CONFIG).unwrap());
+
+        assert!(has_edge(
+            &graph,
+            "rule:r1",
+            "interface:opt6",
+            Relation::UsesInterface
+        ));
+        assert!(has_edge(
+            &graph,
+            "rule:r1",
+            "alias:SALES_NETS",
+            Relation::UsesAlias
+        ));
+        assert!(has_edge(
+            &graph,
+            "rule:r1",
+            "host:192.0.2.7",
+            Relation::Addresses
+        ));
+        assert!(has_edge(
+            &graph,
+            "alias:SALES_NETS",
+            "alias:BRANCH_NETS",
+            Relation::UsesAlias
+        ));
+        assert!(has_edge(
+            &graph,
+            "alias:BRANCH_NETS",
+            "host:10.2.0.0/24",
+            Relation::Contains
+        ));
+        assert!(has_edge(
+            &graph,
+            "interface:opt6",
+            "vlan:em1_vlan100",
+            Relation::Assigned
+        ));
+        assert!(has_edge(
+            &graph,
+            "vlan:em1_vlan100",
+            "port:em1",
+            Relation::Parent
+        ));
+        assert!(has_edge(
+            &graph,
+            "interface:lan",
+            "port:em1",
+            Relation::Parent
+        ));
+        assert!(has_edge(
+            &graph,
+            "service:/opnsense/system/webgui",
+            "certificate:c1",
+            Relation::UsesCertificate
+        ));
+        assert!(has_edge(
+            &graph,
+            "certificate:c1",
+            "authority:ca1",
+            Relation::SignedBy
+        ));
+        // Port aliases list no hosts
+        assert!(!graph.nodes.iter().any(|n| n.id == "host:443"));
+        assert_eq!(graph.kind_counts()[&NodeKind::Rule], 2);
+    }
+
+    #[test]
+    fn test_graphml_is_well_formed() {
+        let graph = DependencyGraph::from_tree(&ConfigTree::parse(CONFIG).unwrap());
+        let graphml = graph.to_graphml();
+        let parsed = ConfigTree::parse(&graphml).unwrap();
+        let nodes = (0..parsed.len())
+            .filter(|&i| parsed.node(i).name == "node")
+            .count();
+        let edges = (0..parsed.len())
+            .filter(|&i| parsed.node(i).name == "edge")
+            .count();
+        assert_eq!(nodes, graph.nodes.len());
+        assert_eq!(edges, graph.edges.len());
+    }
+}
@@ -0,0 +1,79 @@
+//! LAGG and bridge sections of generated configurations
+//!
+//! [`add_link_layer`] inserts the interfaces planned by
+//! [`LinkLayer::plan`](crate::generator::LinkLayer::plan) into a finished
+//! `config.xml`, extending the `<laggs>` and `<bridges>` sections a base
+//! configuration may already have.
+
+use crate::Result;
+use crate::generator::{LinkLayer, render_bridges, render_laggs};
+use crate::model::ConfigError;
+
+/// Add LAGG and bridge interfaces to a configuration
+///
+/// Entries join an existing `<laggs>` or `<bridges>` section, so base
+/// configurations that already define some keep them; otherwise the section
+/// is added at the end of the document.
+pub fn add_link_layer(document: &str, links: &LinkLayer) -> Result<String> {
+    let mut result = document.to_string();
+    add_to_section(&mut result, "laggs", &render_laggs(&links.laggs))?;
+    add_to_section(&mut result, "bridges", &render_bridges(&links.bridges))?;
+    Ok(result)
+}
+
+/// Append entries to a top-level section, creating it when missing
+fn add_to_section(document: &mut String, section: &str, entries: &str) -> Result<()> {
+    if entries.is_empty() {
+        return Ok(());
+    }
+    if let Some(position) = document.find(&format!("</{section}>")) {
+        // Keep the closing tag on its own line with its indentation
+        let line_start = document[..position].rfind('\n').map_or(0, |i| i + 1);
+        if document[line_start..position].trim().is_empty() {
+            document.insert_str(line_start, entries);
+        } else {
+            document.insert_str(position, &format!("\n{entries}"));
+        }
+        return Ok(());
+    }
+    let empty = format!("<{section}/>");
+    if let Some(position) = document.find(&empty) {
+        document.replace_range(
+            position..position + empty.len(),
+            &format!("<{section}>\n{entries}  </{section}>"),
+        );
+        return Ok(());
+    }
+    let position = document.find("</opnsense>").ok_or_else(|| {
+        ConfigError::config("Configuration has no </opnsense> to add interfaces before")
+    })?;
+    document.insert_str(
+        position,
+        &format!("  <{section}>\n{entries}  </{section}>\n"),
+    );
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_add_link_layer() {
+        let links = LinkLayer::plan(2, 1, Some(42)).unwrap();
+        let base = "<opnsense>\n  <system/>\n</opnsense>\n";
+        let config = add_link_layer(base, &links).unwrap();
+        assert!(config.starts_with("<opnsense>\n  <system/>\n  <laggs>\n    <lagg>\n"));
+        assert!(config.contains("<laggif>lagg1</laggif>"));
+        assert!(config.ends_with("    </bridged>\n  </bridges>\n</opnsense>\n"));
+
+        // Existing sections are extended rather than duplicated
+        let base = "<opnsense>\n  <laggs>\n    <lagg><laggif>lagg9</laggif></lagg>\n  </laggs>\n  \
+                    <bridges/>\n</opnsense>\n";
+        let config = add_link_layer(base, &links).unwrap();
+        assert_eq!(config.matches("<laggs>").count(), 1);
+        assert_eq!(config.matches("<bridges>").count(), 1);
+        assert!(config.contains("lagg9</laggif></lagg>\n    <lagg>\n"));
+        assert!(config.contains("    </bridged>\n  </bridges>\n"));
+    }
+}
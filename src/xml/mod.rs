@@ -1,17 +1,29 @@
 //! XML processing and generation for OPNsense configurations
 
 pub mod builder;
+pub mod defaults;
+pub mod diff;
 pub mod engine;
 pub mod error;
 pub mod generator;
+pub mod graph;
 pub mod injection;
+pub mod link;
+pub mod recover;
+pub mod roundtrip;
 pub mod streaming;
 pub mod template;
+pub mod tree;
+pub mod xpath;
 
 // Re-export key types for convenient usage
 pub use builder::OPNsenseConfigBuilder;
+pub use defaults::{FACTORY_DEFAULT_CONFIG, config_from_default};
+pub use diff::{ChangeKind, ConfigChange, diff_configs};
 pub use engine::XMLEngine;
 pub use generator::{ComponentType, XMLGenerator};
 pub use injection::XMLInjector;
+pub use link::add_link_layer;
 pub use streaming::StreamingXmlGenerator;
 pub use template::{XmlTemplate, escape_xml_string};
+pub use xpath::{XPath, XPathMatch};
@@ -0,0 +1,372 @@
+//! Salvaging damaged configuration exports
+//!
+//! Real-world backups are not always well-formed: a byte-order mark added by
+//! an editor, a download cut off mid-document, syslog lines a collection
+//! script interleaved with the XML, or data appended after the document
+//! element. [`recover`] repairs what it can so the rest of the configuration
+//! can still be read, and lists every change as a [`Repair`] so nothing is
+//! dropped silently.
+//!
+//! Log lines are recognized by position. OPNsense never writes mixed content,
+//! so text lines standing between two tag lines are dropped, unless they sit
+//! between an opening tag and its own closing tag, where they are the
+//! element's value. Lines starting with a syslog priority such as `<13>` are
+//! dropped wherever they appear.
+
+use quick_xml::Reader;
+use quick_xml::events::Event;
+use std::fmt;
+
+/// Longest excerpt of dropped text shown in a repair
+const EXCERPT_CHARS: usize = 60;
+
+/// Salvaged document and what was changed to get it
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Recovery {
+    /// Repaired document
+    pub content: String,
+    /// Changes in input order
+    pub repairs: Vec<Repair>,
+}
+
+/// What a repair did
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum RepairKind {
+    /// Dropped a byte-order mark
+    ByteOrderMark,
+    /// Replaced bytes that are not valid UTF-8
+    InvalidUtf8,
+    /// Dropped a line of log output
+    LogLine,
+    /// Dropped data after the document element
+    TrailingData,
+    /// Dropped the incomplete end of a truncated document
+    TruncatedTail,
+    /// Closed an element left open by truncation
+    UnclosedElement,
+}
+
+/// One change made to salvage a document
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Repair {
+    /// Line of the input the change applies to
+    pub line: usize,
+    /// What was done
+    pub kind: RepairKind,
+    /// Start of the dropped text, or the name of the closed element
+    pub excerpt: String,
+    /// Number of bytes dropped
+    pub bytes: usize,
+}
+
+impl fmt::Display for Repair {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "line {}: ", self.line)?;
+        match self.kind {
+            RepairKind::ByteOrderMark => write!(f, "dropped byte-order mark"),
+            RepairKind::InvalidUtf8 => write!(f, "replaced invalid UTF-8 bytes"),
+            RepairKind::LogLine => write!(f, "dropped log line `{}`", self.excerpt),
+            RepairKind::TrailingData => write!(
+                f,
+                "dropped {} bytes after the document element, starting `{}`",
+                self.bytes, self.excerpt
+            ),
+            RepairKind::TruncatedTail => write!(
+                f,
+                "dropped {} bytes of incomplete markup, starting `{}`",
+                self.bytes, self.excerpt
+            ),
+            RepairKind::UnclosedElement => {
+                write!(
+                    f,
+                    "closed element <{}> left open by truncation",
+                    self.excerpt
+                )
+            }
+        }
+    }
+}
+
+/// Salvage a document that may not be valid UTF-8
+pub fn recover_bytes(bytes: &[u8]) -> Recovery {
+    let invalid = match std::str::from_utf8(bytes) {
+        Ok(content) => return recover(content),
+        Err(e) => e.valid_up_to(),
+    };
+    let mut recovery = recover(&String::from_utf8_lossy(bytes));
+    recovery.repairs.push(Repair {
+        line: bytes[..invalid].iter().filter(|&&b| b == b'\n').count() + 1,
+        kind: RepairKind::InvalidUtf8,
+        excerpt: String::new(),
+        bytes: 0,
+    });
+    recovery.repairs.sort_by_key(|repair| repair.line);
+    recovery
+}
+
+/// Salvage a document
+///
+/// A well-formed document comes back unchanged and without repairs.
+pub fn recover(content: &str) -> Recovery {
+    let mut repairs = Vec::new();
+    let content = match content.strip_prefix('\u{feff}') {
+        Some(rest) => {
+            repairs.push(Repair {
+                line: 1,
+                kind: RepairKind::ByteOrderMark,
+                excerpt: String::new(),
+                bytes: '\u{feff}'.len_utf8(),
+            });
+            rest
+        }
+        None => content,
+    };
+
+    let (kept, line_numbers) = drop_log_lines(content, &mut repairs);
+    let content = close_document(&kept, &line_numbers, &mut repairs);
+    Recovery { content, repairs }
+}
+
+/// Remove log lines; returns the rest and the input line of each kept line
+fn drop_log_lines(content: &str, repairs: &mut Vec<Repair>) -> (String, Vec<usize>) {
+    let lines: Vec<&str> = content.split_inclusive('\n').collect();
+    let mut kept = String::with_capacity(content.len());
+    let mut line_numbers = Vec::with_capacity(lines.len());
+    let mut previous: Option<&str> = None;
+    let mut index = 0;
+    while index < lines.len() {
+        let trimmed = lines[index].trim();
+        if is_syslog_line(trimmed) {
+            repairs.push(log_line(index, trimmed));
+            index += 1;
+            continue;
+        }
+        if trimmed.is_empty() || trimmed.starts_with('<') {
+            kept.push_str(lines[index]);
+            line_numbers.push(index + 1);
+            if !trimmed.is_empty() {
+                previous = Some(trimmed);
+            }
+            index += 1;
+            continue;
+        }
+
+        // A run of text lines up to the next tag line
+        let end = (index..lines.len())
+            .find(|&i| lines[i].trim_start().starts_with('<'))
+            .unwrap_or(lines.len());
+        let next = lines.get(end).map(|line| line.trim());
+        let garbage = match (previous, next) {
+            (None, Some(_)) => true,
+            (Some(previous), Some(next)) => {
+                previous.ends_with('>') && !encloses_value(previous, next)
+            }
+            (_, None) => false,
+        };
+        for (offset, line) in lines[index..end].iter().enumerate() {
+            if garbage && !line.trim().is_empty() {
+                repairs.push(log_line(index + offset, line.trim()));
+            } else {
+                kept.push_str(line);
+                line_numbers.push(index + offset + 1);
+            }
+        }
+        if !garbage {
+            previous = lines[index..end]
+                .iter()
+                .map(|l| l.trim())
+                .rfind(|l| !l.is_empty());
+        }
+        index = end;
+    }
+    (kept, line_numbers)
+}
+
+/// Whether a line starts with a syslog priority like `<13>`
+fn is_syslog_line(line: &str) -> bool {
+    line.strip_prefix('<')
+        .and_then(|rest| rest.split_once('>'))
+        .is_some_and(|(priority, _)| {
+            (1..=3).contains(&priority.len()) && priority.bytes().all(|b| b.is_ascii_digit())
+        })
+}
+
+/// Whether `previous` opens the element that `next` closes
+fn encloses_value(previous: &str, next: &str) -> bool {
+    let Some(tag) = previous.strip_prefix('<') else {
+        return false;
+    };
+    if tag.starts_with(['/', '?', '!']) || tag.ends_with("/>") || tag.contains('<') {
+        return false;
+    }
+    let name = tag
+        .split(|c: char| c.is_whitespace() || c == '>')
+        .next()
+        .unwrap_or_default();
+    next.strip_prefix("</")
+        .and_then(|rest| rest.strip_prefix(name))
+        .is_some_and(|rest| rest.trim_start().starts_with('>'))
+}
+
+fn log_line(index: usize, line: &str) -> Repair {
+    Repair {
+        line: index + 1,
+        kind: RepairKind::LogLine,
+        excerpt: excerpt(line),
+        bytes: line.len(),
+    }
+}
+
+fn excerpt(text: &str) -> String {
+    let text = text.trim();
+    match text.char_indices().nth(EXCERPT_CHARS) {
+        Some((end, _)) => format!("{}…", &text[..end]),
+        None => text.to_string(),
+    }
+}
+
+/// Cut the document after its last complete event and close what is open
+///
+/// A truncated leaf element is dropped as a whole rather than kept with a
+/// partial value.
+fn close_document(content: &str, line_numbers: &[usize], repairs: &mut Vec<Repair>) -> String {
+    let line_at = |offset: usize| {
+        let index = content[..offset].matches('\n').count();
+        line_numbers
+            .get(index)
+            .or(line_numbers.last())
+            .copied()
+            .unwrap_or(1)
+    };
+
+    let mut reader = Reader::from_str(content);
+    // Name, start offset, and whether it has child elements
+    let mut open: Vec<(String, usize, bool)> = Vec::new();
+    let mut complete = 0;
+    let mut root_closed = false;
+    loop {
+        match reader.read_event() {
+            Ok(Event::Start(start)) => {
+                if let Some(parent) = open.last_mut() {
+                    parent.2 = true;
+                }
+                let name = String::from_utf8_lossy(start.name().as_ref()).into_owned();
+                open.push((name, complete, false));
+            }
+            Ok(Event::End(_)) => {
+                open.pop();
+                root_closed = open.is_empty();
+            }
+            Ok(Event::Empty(_)) => match open.last_mut() {
+                Some(parent) => parent.2 = true,
+                None => root_closed = true,
+            },
+            Ok(Event::Eof) | Err(_) => break,
+            Ok(_) => {}
+        }
+        complete = reader.buffer_position() as usize;
+        if root_closed {
+            break;
+        }
+    }
+    if let Some(&(_, start, false)) = open.last() {
+        complete = start;
+        open.pop();
+    }
+
+    let (document, tail) = content.split_at(complete);
+    let dropped = tail.trim();
+    if dropped.is_empty() && open.is_empty() {
+        return content.to_string();
+    }
+    if !dropped.is_empty() {
+        let start = complete + (tail.len() - tail.trim_start().len());
+        repairs.push(Repair {
+            line: line_at(start),
+            kind: if root_closed {
+                RepairKind::TrailingData
+            } else {
+                RepairKind::TruncatedTail
+            },
+            excerpt: excerpt(dropped),
+            bytes: dropped.len(),
+        });
+    }
+
+    let mut document = document.to_string();
+    let line = line_at(complete);
+    while let Some((name, _, _)) = open.pop() {
+        document.push_str(&format!("</{name}>"));
+        repairs.push(Repair {
+            line,
+            kind: RepairKind::UnclosedElement,
+            excerpt: name,
+            bytes: 0,
+        });
+    }
+    if !document.ends_with('\n') {
+        document.push('\n');
+    }
+    document
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::xml::tree::ConfigTree;
+
+    #[test]
+    fn test_damaged_export_is_salvaged() {
+        let damaged = "\u{feff}<?xml version=\"1.0\"?>\n\
+            <opnsense>\n\
+            <system>\n\
+            <hostname>fw01</hostname>\n\
+            Jan 14 03:12:01 fw01 configd.py: [a1b2] generate template\n\
+            <13>Jan 14 03:12:02 fw01 backup: chunk 4 of 9\n\
+            <domain>lab.local</domain>\n\
+            </system>\n\
+            <vlans>\n\
+            <vlan>\n\
+            <vlanif>vlan0.10</vlanif>\n\
+            <descr>Sa";
+        let recovery = recover(damaged);
+        let kinds: Vec<(usize, RepairKind)> =
+            recovery.repairs.iter().map(|r| (r.line, r.kind)).collect();
+        assert_eq!(
+            kinds,
+            [
+                (1, RepairKind::ByteOrderMark),
+                (5, RepairKind::LogLine),
+                (6, RepairKind::LogLine),
+                (12, RepairKind::TruncatedTail),
+                (12, RepairKind::UnclosedElement),
+                (12, RepairKind::UnclosedElement),
+                (12, RepairKind::UnclosedElement),
+            ]
+        );
+        assert_eq!(
+            recovery.repairs[3].to_string(),
+            "line 12: dropped 9 bytes of incomplete markup, starting `<descr>Sa`"
+        );
+
+        let tree = ConfigTree::parse(&recovery.content).unwrap();
+        let domain = (0..tree.len())
+            .find(|&id| tree.node(id).name == "domain")
+            .unwrap();
+        assert_eq!(tree.node(domain).value.as_deref(), Some("lab.local"));
+        assert!((0..tree.len()).any(|id| tree.node(id).path == "/opnsense/vlans/vlan/vlanif"));
+    }
+
+    #[test]
+    fn test_well_formed_documents_are_unchanged() {
+        let document = "<opnsense>\n<system>\n<motd>\nWelcome\n</motd>\n</system>\n</opnsense>\n";
+        let recovery = recover(document);
+        assert_eq!(recovery.content, document);
+        assert!(recovery.repairs.is_empty());
+
+        let appended = format!("{document}Jan 14 03:12:01 fw01 sshd[411]: session closed\n");
+        let recovery = recover(&appended);
+        assert_eq!(recovery.content, document);
+        assert_eq!(recovery.repairs[0].kind, RepairKind::TrailingData);
+    }
+}
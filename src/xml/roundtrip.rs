@@ -0,0 +1,418 @@
+//! Differential round-trip checks between XML emitters and parsers
+//!
+//! Every section the generator writes is also read back somewhere: by
+//! `--minimize-diff`, by `diff`, or by `query`. [`check_roundtrip`] emits a
+//! set of VLANs through each emitter, parses the result with the matching
+//! parser, and compares what comes back with the model, so an asymmetry
+//! between the two sides (an escaping bug, a renamed element, lost
+//! whitespace) shows up as a [`Mismatch`] rather than as a corrupted fixture.
+//! [`run_roundtrip`] repeats this for random model instances; the
+//! `fuzz roundtrip` command and the `roundtrip` cargo-fuzz target drive it.
+//!
+//! Emitters transliterate German umlauts (`ä` becomes `ae`) on purpose, and
+//! parsers trim surrounding whitespace, so both are applied to the expected
+//! values before comparing.
+
+use crate::generator::{RngStreams, VlanConfig, generate_threat_feeds, render_feed_aliases};
+use crate::io::previous::parse_vlans_from_xml;
+use crate::xml::diff::flatten;
+use crate::xml::template::{XmlTemplate, escape_xml_string};
+use crate::xml::{config_from_default, tree::ConfigTree};
+use rand::prelude::*;
+use std::collections::{HashMap, HashSet};
+
+/// Template exercising every placeholder `parse_vlans_from_xml` reads back
+const VLAN_TEMPLATE: &str = "<opnsense><vlans><vlan><vlanid>{{VLAN_ID}}</vlanid>\
+     <subnet>{{IP_NETWORK}}</subnet><descr>{{DESCRIPTION}}</descr>\
+     <wan>{{WAN_ASSIGNMENT}}</wan></vlan></vlans></opnsense>";
+
+/// Description fragments, chosen to stress escaping and whitespace handling
+const FRAGMENTS: &[&str] = &[
+    "Sales", "VLAN", "a", "Z", "7", " ", "  ", "\t", "-", "/", "&", "<", ">", "\"", "'", "&amp;",
+    "]]>", "ä", "Ö", "ß", "é", "日本", "🔥", "#", ";",
+];
+
+/// Feed base URLs, including characters that need escaping
+const FEED_URLS: &[&str] = &[
+    "http://10.0.0.5:8080/feeds",
+    "file:///srv/lab feeds/",
+    "https://feeds.lab.example/list?token=a&format=<plain>",
+];
+
+/// One value that did not survive a round trip
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Mismatch {
+    /// Emitter/parser pair, e.g. `factory-default`
+    pub check: &'static str,
+    /// Path or field that differs
+    pub field: String,
+    /// Value from the model
+    pub expected: String,
+    /// Value read back, or the parse error
+    pub actual: String,
+}
+
+/// Random case with at least one mismatch
+#[derive(Debug, Clone)]
+pub struct FailedCase {
+    /// Index of the case within the run
+    pub iteration: u32,
+    /// Model instance of the case
+    pub vlans: Vec<VlanConfig>,
+    /// Everything that differed
+    pub mismatches: Vec<Mismatch>,
+}
+
+/// Outcome of a round-trip run
+#[derive(Debug, Clone)]
+pub struct RoundtripReport {
+    /// Seed reproducing the whole run
+    pub root_seed: u64,
+    /// Number of cases checked
+    pub iterations: u32,
+    /// Cases with mismatches
+    pub failures: Vec<FailedCase>,
+}
+
+/// Check random model instances
+///
+/// Case `i` draws from its own [`RngStreams`] stream, so a run with the same
+/// seed and more iterations repeats every earlier case.
+pub fn run_roundtrip(iterations: u32, seed: Option<u64>, max_vlans: u16) -> RoundtripReport {
+    let streams = RngStreams::new(seed);
+    let mut failures = Vec::new();
+    for iteration in 0..iterations {
+        let mut rng = streams.stream_for("fuzz-roundtrip", u64::from(iteration));
+        let vlans = random_vlans(&mut rng, max_vlans);
+        let mut mismatches = check_roundtrip(&vlans);
+        mismatches.extend(check_feed_aliases(&mut rng));
+        if !mismatches.is_empty() {
+            failures.push(FailedCase {
+                iteration,
+                vlans,
+                mismatches,
+            });
+        }
+    }
+    RoundtripReport {
+        root_seed: streams.root_seed(),
+        iterations,
+        failures,
+    }
+}
+
+/// Random VLANs with unique IDs, valid networks, and awkward descriptions
+pub fn random_vlans<R: Rng + ?Sized>(rng: &mut R, max_vlans: u16) -> Vec<VlanConfig> {
+    let count = rng.random_range(1..=max_vlans.max(1));
+    let mut ids = HashSet::new();
+    let mut vlans = Vec::with_capacity(usize::from(count));
+    while vlans.len() < usize::from(count) {
+        let vlan_id = rng.random_range(10..=4094);
+        if !ids.insert(vlan_id) {
+            continue;
+        }
+        let prefix = match rng.random_range(0..3) {
+            0 => format!(
+                "10.{}.{}",
+                rng.random_range(0..=255),
+                rng.random_range(0..=255)
+            ),
+            1 => format!(
+                "172.{}.{}",
+                rng.random_range(16..=31),
+                rng.random_range(0..=255)
+            ),
+            _ => format!("192.168.{}", rng.random_range(0..=255)),
+        };
+        let ip_network = if rng.random_bool(0.5) {
+            format!("{prefix}.x")
+        } else {
+            format!("{prefix}.0/24")
+        };
+        let description: String = (0..rng.random_range(0..12))
+            .map(|_| FRAGMENTS[rng.random_range(0..FRAGMENTS.len())])
+            .collect();
+        let wan = rng.random_range(1..=3);
+        if let Ok(vlan) = VlanConfig::new(vlan_id, ip_network, description, wan) {
+            vlans.push(vlan);
+        }
+    }
+    vlans
+}
+
+/// Emit the VLANs through every VLAN emitter and compare what parses back
+pub fn check_roundtrip(vlans: &[VlanConfig]) -> Vec<Mismatch> {
+    let mut mismatches = check_template(vlans);
+    mismatches.extend(check_factory_default(vlans));
+    mismatches.extend(check_tree(vlans));
+    mismatches
+}
+
+/// Template emitter against the `--minimize-diff` parser
+fn check_template(vlans: &[VlanConfig]) -> Vec<Mismatch> {
+    const CHECK: &str = "template";
+    let template = match XmlTemplate::new(VLAN_TEMPLATE.to_string()) {
+        Ok(template) => template,
+        Err(e) => return vec![emit_error(CHECK, e)],
+    };
+
+    let mut mismatches = Vec::new();
+    for vlan in vlans {
+        let field = |name: &str| format!("vlan {}/{name}", vlan.vlan_id);
+        let parsed = template
+            .apply_configuration(vlan, 1, 6)
+            .and_then(|xml| parse_vlans_from_xml(&xml));
+        let parsed = match parsed {
+            Ok(parsed) => parsed,
+            Err(e) => {
+                mismatches.push(Mismatch {
+                    check: CHECK,
+                    field: field("document"),
+                    expected: "one parsed VLAN".to_string(),
+                    actual: e.to_string(),
+                });
+                continue;
+            }
+        };
+        let [back] = parsed.as_slice() else {
+            mismatches.push(Mismatch {
+                check: CHECK,
+                field: field("document"),
+                expected: "one parsed VLAN".to_string(),
+                actual: format!("{} parsed VLANs", parsed.len()),
+            });
+            continue;
+        };
+        compare(
+            &mut mismatches,
+            CHECK,
+            field("vlanid"),
+            vlan.vlan_id,
+            back.vlan_id,
+        );
+        compare(
+            &mut mismatches,
+            CHECK,
+            field("subnet"),
+            &vlan.ip_network,
+            &back.ip_network,
+        );
+        compare(
+            &mut mismatches,
+            CHECK,
+            field("descr"),
+            expected_text(&vlan.description),
+            back.description.clone(),
+        );
+        compare(
+            &mut mismatches,
+            CHECK,
+            field("wan"),
+            vlan.wan_assignment,
+            back.wan_assignment,
+        );
+    }
+    mismatches
+}
+
+/// Factory-default emitter against the diff parser
+fn check_factory_default(vlans: &[VlanConfig]) -> Vec<Mismatch> {
+    const CHECK: &str = "factory-default";
+    let leaves = match config_from_default(vlans, 6, None).and_then(|xml| flatten(&xml)) {
+        Ok(leaves) => leaves.into_iter().collect::<HashMap<_, _>>(),
+        Err(e) => return vec![emit_error(CHECK, e)],
+    };
+
+    let mut mismatches = Vec::new();
+    for (index, vlan) in vlans.iter().enumerate() {
+        let vlan_path = match index {
+            0 => "/opnsense/vlans/vlan".to_string(),
+            n => format!("/opnsense/vlans/vlan[{}]", n + 1),
+        };
+        let opt = format!("opt{}", 6 + index);
+        let expected = [
+            (format!("{vlan_path}/tag"), Ok(vlan.vlan_id.to_string())),
+            (
+                format!("{vlan_path}/descr"),
+                Ok(expected_text(&vlan.description)),
+            ),
+            (
+                format!("/opnsense/interfaces/{opt}/descr"),
+                Ok(expected_text(&vlan.description)),
+            ),
+            (
+                format!("/opnsense/interfaces/{opt}/ipaddr"),
+                vlan.gateway_ip(),
+            ),
+            (
+                format!("/opnsense/dhcpd/{opt}/range/from"),
+                vlan.dhcp_range_start(),
+            ),
+            (
+                format!("/opnsense/dhcpd/{opt}/range/to"),
+                vlan.dhcp_range_end(),
+            ),
+        ];
+        for (path, value) in expected {
+            let Ok(value) = value else {
+                continue;
+            };
+            let actual = leaves
+                .get(&path)
+                .cloned()
+                .unwrap_or_else(|| "<missing>".to_string());
+            compare(&mut mismatches, CHECK, path, value, actual);
+        }
+    }
+    mismatches
+}
+
+/// Factory-default emitter against the `view` element tree
+fn check_tree(vlans: &[VlanConfig]) -> Vec<Mismatch> {
+    const CHECK: &str = "tree";
+    let tree = match config_from_default(vlans, 6, None).and_then(|xml| ConfigTree::parse(&xml)) {
+        Ok(tree) => tree,
+        Err(e) => return vec![emit_error(CHECK, e)],
+    };
+
+    let parsed: Vec<(Option<&str>, Option<&str>)> = (0..tree.len())
+        .filter(|&id| tree.node(id).path.starts_with("/opnsense/vlans/vlan"))
+        .filter(|&id| tree.node(id).name == "vlan")
+        .map(|id| (tree.child_value(id, "tag"), tree.child_value(id, "descr")))
+        .collect();
+    let mut mismatches = Vec::new();
+    compare(
+        &mut mismatches,
+        CHECK,
+        "vlan count".to_string(),
+        vlans.len(),
+        parsed.len(),
+    );
+    for (vlan, (tag, descr)) in vlans.iter().zip(parsed) {
+        let field = |name: &str| format!("vlan {}/{name}", vlan.vlan_id);
+        compare(
+            &mut mismatches,
+            CHECK,
+            field("tag"),
+            vlan.vlan_id.to_string(),
+            tag.unwrap_or("<missing>").to_string(),
+        );
+        compare(
+            &mut mismatches,
+            CHECK,
+            field("descr"),
+            expected_text(&vlan.description),
+            descr.unwrap_or("<missing>").to_string(),
+        );
+    }
+    mismatches
+}
+
+/// Feed alias emitter against the diff parser
+fn check_feed_aliases<R: Rng + ?Sized>(rng: &mut R) -> Vec<Mismatch> {
+    const CHECK: &str = "feed-aliases";
+    let seed = rng.random();
+    let base_url = FEED_URLS[rng.random_range(0..FEED_URLS.len())];
+    let feeds = match generate_threat_feeds(rng.random_range(1..=4), Some(seed)) {
+        Ok(feeds) => feeds,
+        Err(e) => return vec![emit_error(CHECK, e)],
+    };
+    let leaves = match flatten(&render_feed_aliases(&feeds, base_url, Some(seed))) {
+        Ok(leaves) => leaves.into_iter().collect::<HashMap<_, _>>(),
+        Err(e) => return vec![emit_error(CHECK, e)],
+    };
+
+    let mut mismatches = Vec::new();
+    for (index, feed) in feeds.iter().enumerate() {
+        let alias = match index {
+            0 => "/aliases/alias".to_string(),
+            n => format!("/aliases/alias[{}]", n + 1),
+        };
+        let content = format!("{}/{}", base_url.trim_end_matches('/'), feed.file_name());
+        for (name, expected) in [
+            ("name", feed.alias_name()),
+            ("content", expected_text(&content)),
+            ("description", expected_text(&feed.description)),
+        ] {
+            let path = format!("{alias}/{name}");
+            let actual = leaves
+                .get(&path)
+                .cloned()
+                .unwrap_or_else(|| "<missing>".to_string());
+            compare(&mut mismatches, CHECK, path, expected, actual);
+        }
+    }
+    mismatches
+}
+
+/// Value a parser should read back for text written by an emitter
+fn expected_text(text: &str) -> String {
+    escape_xml_string(text)
+        .replace("&lt;", "<")
+        .replace("&gt;", ">")
+        .replace("&quot;", "\"")
+        .replace("&apos;", "'")
+        .replace("&amp;", "&")
+        .trim()
+        .to_string()
+}
+
+fn compare<T: PartialEq + ToString>(
+    mismatches: &mut Vec<Mismatch>,
+    check: &'static str,
+    field: String,
+    expected: T,
+    actual: T,
+) {
+    if expected != actual {
+        mismatches.push(Mismatch {
+            check,
+            field,
+            expected: expected.to_string(),
+            actual: actual.to_string(),
+        });
+    }
+}
+
+fn emit_error(check: &'static str, error: impl std::fmt::Display) -> Mismatch {
+    Mismatch {
+        check,
+        field: "document".to_string(),
+        expected: "well-formed output".to_string(),
+        actual: error.to_string(),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_roundtrip_run_is_clean() {
+        let report = run_roundtrip(50, Some(7), 12);
+        assert_eq!(report.root_seed, 7);
+        assert!(
+            report.failures.is_empty(),
+            "{:#?}",
+            report.failures.first().map(|f| &f.mismatches)
+        );
+    }
+
+    #[test]
+    fn test_awkward_descriptions_survive() {
+        let vlans = vec![
+            VlanConfig::new(100, "10.1.2.x".into(), "  Sales & <Ops> \"ä\" ".into(), 2).unwrap(),
+            VlanConfig::new(200, "192.168.3.0/24".into(), String::new(), 1).unwrap(),
+        ];
+        assert_eq!(check_roundtrip(&vlans), vec![]);
+        assert_eq!(expected_text(" ä & ß "), "ae & ss");
+    }
+
+    #[test]
+    fn test_mismatch_is_reported() {
+        let mut mismatches = Vec::new();
+        compare(&mut mismatches, "template", "vlan 1/descr".into(), "a", "b");
+        assert_eq!(mismatches[0].expected, "a");
+        assert_eq!(mismatches[0].actual, "b");
+    }
+}
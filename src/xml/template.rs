@@ -1,7 +1,7 @@
 //! XML template processing for OPNsense configurations
 
 use crate::Result;
-use crate::generator::VlanConfig;
+use crate::generator::{InterfaceProfile, VlanConfig};
 use crate::model::ConfigError;
 
 /// XML template processor for OPNsense configurations
@@ -21,6 +21,14 @@ pub fn new(base_content: String) -> Result<Self> {
             ));
         }
 
+        // Normalize line endings so a base config checked out with CRLF (e.g.
+        // git autocrlf on Windows) produces the same bytes as on Unix
+        let base_content = if base_content.contains('\r') {
+            base_content.replace("\r\n", "\n")
+        } else {
+            base_content
+        };
+
         Ok(Self { base_content })
     }
 
@@ -62,6 +70,27 @@ pub fn apply_configuration(
 
         Ok(result)
     }
+
+    /// Apply a VLAN configuration together with its interface profile
+    ///
+    /// In addition to the placeholders of [`apply_configuration`](Self::apply_configuration),
+    /// replaces `{{VLAN_TYPE}}`, `{{MTU}}`, `{{MSS}}` (empty without clamping),
+    /// and `{{VLAN_PCP}}`.
+    pub fn apply_configuration_with_interface(
+        &self,
+        config: &VlanConfig,
+        profile: &InterfaceProfile,
+        firewall_nr: u16,
+        opt_counter: u16,
+    ) -> Result<String> {
+        let result = self.apply_configuration(config, firewall_nr, opt_counter)?;
+        let mss = profile.mss.map(|mss| mss.to_string()).unwrap_or_default();
+        Ok(result
+            .replace("{{VLAN_TYPE}}", &profile.vlan_type.to_string())
+            .replace("{{MTU}}", &profile.mtu.to_string())
+            .replace("{{MSS}}", &mss)
+            .replace("{{VLAN_PCP}}", &profile.pcp.to_string()))
+    }
 }
 
 /// Escape XML special characters in a string
@@ -95,6 +124,21 @@ pub fn escape_xml_string(input: &str) -> String {
 mod tests {
     use super::*;
 
+    #[test]
+    fn test_xml_template_normalizes_crlf() {
+        let unix =
+            XmlTemplate::new("<opnsense>\n<vlan>{{VLAN_ID}}</vlan>\n</opnsense>\n".into()).unwrap();
+        let windows =
+            XmlTemplate::new("<opnsense>\r\n<vlan>{{VLAN_ID}}</vlan>\r\n</opnsense>\r\n".into())
+                .unwrap();
+        let config =
+            VlanConfig::new(100, "10.1.2.x".to_string(), "IT VLAN 100".to_string(), 1).unwrap();
+        assert_eq!(
+            unix.apply_configuration(&config, 1, 6).unwrap(),
+            windows.apply_configuration(&config, 1, 6).unwrap()
+        );
+    }
+
     #[test]
     fn test_xml_template_creation() {
         let xml_content = r#"<?xml version="1.0"?>
@@ -133,6 +177,32 @@ fn test_apply_configuration() {
         assert!(result.contains("<gateway>10.1.2.1</gateway>"));
     }
 
+    #[test]
+    fn test_apply_configuration_with_interface() {
+        use crate::generator::VlanType;
+
+        let xml_content = r#"<opnsense>
+    <vlan><tag>{{VLAN_ID}}</tag><pcp>{{VLAN_PCP}}</pcp></vlan>
+    <opt{{OPT_COUNTER}}><mtu>{{MTU}}</mtu><mss>{{MSS}}</mss></opt{{OPT_COUNTER}}>
+</opnsense>"#;
+
+        let template = XmlTemplate::new(xml_content.to_string()).unwrap();
+        let config =
+            VlanConfig::new(7, "10.1.2.x".to_string(), "DSL Uplink".to_string(), 1).unwrap();
+
+        let result = template
+            .apply_configuration_with_interface(&config, &VlanType::Pppoe.profile(), 1, 6)
+            .unwrap();
+        assert!(result.contains("<vlan><tag>7</tag><pcp>0</pcp></vlan>"));
+        assert!(result.contains("<opt6><mtu>1492</mtu><mss>1452</mss></opt6>"));
+
+        let result = template
+            .apply_configuration_with_interface(&config, &VlanType::Voice.profile(), 1, 6)
+            .unwrap();
+        assert!(result.contains("<pcp>5</pcp>"));
+        assert!(result.contains("<mtu>1500</mtu><mss></mss>"));
+    }
+
     #[test]
     fn test_escape_xml_string() {
         assert_eq!(escape_xml_string("Hello & World"), "Hello &amp; World");
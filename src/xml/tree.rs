@@ -0,0 +1,338 @@
+//! Navigable element tree of an OPNsense configuration
+//!
+//! [`ConfigTree`] parses a document into an arena of [`TreeNode`]s for
+//! interactive browsing. Paths follow the [diff](crate::xml::diff) convention,
+//! numbering repeated siblings from the second occurrence. Besides the
+//! structure the tree indexes named objects so values can be followed to what
+//! they refer to:
+//!
+//! - aliases by `<name>`, so a rule's source or destination address leads to
+//!   the alias and an alias's `<content>` leads to nested aliases
+//! - interfaces by their element name (`lan`, `opt6`), as used in `<interface>`
+//! - VLANs by their `<vlanif>` device, as used in an interface's `<if>`
+
+use crate::Result;
+use crate::io::previous::resolve_entity;
+use crate::model::ConfigError;
+use quick_xml::Reader;
+use quick_xml::events::{BytesStart, Event};
+use std::collections::HashMap;
+
+/// One element of the document
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct TreeNode {
+    /// Element name
+    pub name: String,
+    /// Absolute path with repeated siblings numbered
+    pub path: String,
+    /// Trimmed text of an element without child elements
+    pub value: Option<String>,
+    /// Attributes in document order
+    pub attributes: Vec<(String, String)>,
+    /// Enclosing element, `None` for the document element
+    pub parent: Option<usize>,
+    /// Child elements in document order
+    pub children: Vec<usize>,
+    /// Nesting depth, zero for the document element
+    pub depth: usize,
+}
+
+/// Parsed configuration with a cross-reference index
+#[derive(Debug, Clone, Default)]
+pub struct ConfigTree {
+    nodes: Vec<TreeNode>,
+    named: HashMap<String, Vec<usize>>,
+}
+
+impl ConfigTree {
+    /// Parse a document
+    pub fn parse(content: &str) -> Result<Self> {
+        let mut reader = Reader::from_str(content);
+        let mut tree = Self::default();
+        let mut stack: Vec<(usize, String, HashMap<String, usize>)> = Vec::new();
+
+        loop {
+            let event = reader.read_event().map_err(|e| {
+                ConfigError::xml_event_parsing(format!(
+                    "Failed to parse XML at position {}: {e}",
+                    reader.buffer_position()
+                ))
+            })?;
+            match event {
+                Event::Start(ref start) => {
+                    let id = tree.open(&mut stack, start)?;
+                    stack.push((id, String::new(), HashMap::new()));
+                }
+                Event::Empty(ref start) => {
+                    let id = tree.open(&mut stack, start)?;
+                    tree.nodes[id].value = Some(String::new());
+                }
+                Event::End(_) => {
+                    if let Some((id, text, _)) = stack.pop()
+                        && tree.nodes[id].children.is_empty()
+                    {
+                        tree.nodes[id].value = Some(text.trim().to_string());
+                    }
+                }
+                Event::Text(ref text) => {
+                    if let Some((_, buffer, _)) = stack.last_mut() {
+                        buffer.push_str(&String::from_utf8_lossy(text));
+                    }
+                }
+                Event::CData(ref data) => {
+                    if let Some((_, buffer, _)) = stack.last_mut() {
+                        buffer.push_str(&String::from_utf8_lossy(data));
+                    }
+                }
+                Event::GeneralRef(ref entity) => {
+                    if let Some((_, buffer, _)) = stack.last_mut() {
+                        buffer.push_str(&resolve_entity(&String::from_utf8_lossy(entity)));
+                    }
+                }
+                Event::Eof => break,
+                _ => {}
+            }
+        }
+
+        if tree.nodes.is_empty() {
+            return Err(ConfigError::xml_event_parsing("Document has no elements"));
+        }
+        tree.index();
+        Ok(tree)
+    }
+
+    /// Add a node for a new element below the innermost open one
+    fn open(
+        &mut self,
+        stack: &mut [(usize, String, HashMap<String, usize>)],
+        start: &BytesStart<'_>,
+    ) -> Result<usize> {
+        let name = String::from_utf8_lossy(start.name().as_ref()).into_owned();
+        let id = self.nodes.len();
+        let (parent, path, depth) = match stack.last_mut() {
+            Some((parent, _, counts)) => {
+                let count = counts.entry(name.clone()).or_default();
+                *count += 1;
+                let parent_node = &mut self.nodes[*parent];
+                parent_node.children.push(id);
+                let path = match *count {
+                    1 => format!("{}/{name}", parent_node.path),
+                    n => format!("{}/{name}[{n}]", parent_node.path),
+                };
+                (Some(*parent), path, parent_node.depth + 1)
+            }
+            None => (None, format!("/{name}"), 0),
+        };
+
+        let mut attributes = Vec::new();
+        for attribute in start.attributes().flatten() {
+            let value = attribute
+                .unescape_value()
+                .map_err(|e| ConfigError::xml_event_parsing(e.to_string()))?;
+            attributes.push((
+                String::from_utf8_lossy(attribute.key.as_ref()).into_owned(),
+                value.into_owned(),
+            ));
+        }
+
+        self.nodes.push(TreeNode {
+            name,
+            path,
+            value: None,
+            attributes,
+            parent,
+            children: Vec::new(),
+            depth,
+        });
+        Ok(id)
+    }
+
+    /// Record the named objects values can refer to
+    fn index(&mut self) {
+        let mut named: HashMap<String, Vec<usize>> = HashMap::new();
+        for (id, node) in self.nodes.iter().enumerate() {
+            let parent = node.parent.map(|p| self.nodes[p].name.as_str());
+            let key = match (parent, node.name.as_str()) {
+                (_, "alias") => self.child_value(id, "name"),
+                (_, "vlan") => self.child_value(id, "vlanif"),
+                (Some("interfaces"), _) if self.nodes[node.parent.unwrap_or(0)].depth == 1 => {
+                    Some(node.name.as_str())
+                }
+                _ => None,
+            };
+            if let Some(key) = key.filter(|k| !k.is_empty()) {
+                named.entry(key.to_string()).or_default().push(id);
+            }
+        }
+        self.named = named;
+    }
+
+    /// Value of the first child element called `name`
+    pub fn child_value(&self, id: usize, name: &str) -> Option<&str> {
+        self.nodes[id]
+            .children
+            .iter()
+            .map(|&child| &self.nodes[child])
+            .find(|child| child.name == name)
+            .and_then(|child| child.value.as_deref())
+    }
+
+    /// Number of elements
+    pub fn len(&self) -> usize {
+        self.nodes.len()
+    }
+
+    /// Whether the tree has no elements
+    pub fn is_empty(&self) -> bool {
+        self.nodes.is_empty()
+    }
+
+    /// Element by id; the document element is id 0
+    pub fn node(&self, id: usize) -> &TreeNode {
+        &self.nodes[id]
+    }
+
+    /// Enclosing elements of a node, outermost first
+    pub fn ancestors(&self, id: usize) -> Vec<usize> {
+        let mut ancestors = Vec::new();
+        let mut current = self.nodes[id].parent;
+        while let Some(parent) = current {
+            ancestors.push(parent);
+            current = self.nodes[parent].parent;
+        }
+        ancestors.reverse();
+        ancestors
+    }
+
+    /// Whether `ancestor` encloses `id` or is `id`
+    pub fn contains(&self, ancestor: usize, id: usize) -> bool {
+        ancestor == id || self.ancestors(id).contains(&ancestor)
+    }
+
+    /// Next node after `after` in document order whose name, value, or an
+    /// attribute contains `query`, ignoring case; wraps around
+    pub fn search(&self, query: &str, after: usize) -> Option<usize> {
+        let query = query.to_lowercase();
+        if query.is_empty() {
+            return None;
+        }
+        let matches = |node: &TreeNode| {
+            node.name.to_lowercase().contains(&query)
+                || node
+                    .value
+                    .as_ref()
+                    .is_some_and(|v| v.to_lowercase().contains(&query))
+                || node
+                    .attributes
+                    .iter()
+                    .any(|(_, v)| v.to_lowercase().contains(&query))
+        };
+        (after + 1..self.nodes.len())
+            .chain(0..=after.min(self.nodes.len() - 1))
+            .find(|&id| matches(&self.nodes[id]))
+    }
+
+    /// Named objects the values in a node refer to, in document order
+    ///
+    /// For an element with children, the values of all its descendants are
+    /// followed, so a firewall rule leads to the aliases and interfaces it
+    /// uses. References back into the node itself are left out.
+    pub fn references(&self, id: usize) -> Vec<usize> {
+        let mut references = Vec::new();
+        let mut pending = vec![id];
+        while let Some(current) = pending.pop() {
+            let node = &self.nodes[current];
+            pending.extend(node.children.iter().rev());
+            let Some(value) = &node.value else {
+                continue;
+            };
+            for token in value.split(|c: char| c.is_whitespace() || c == ',') {
+                let targets = self.named.get(token.trim_start_matches('!'));
+                for &target in targets.into_iter().flatten() {
+                    if !self.contains(id, target)
+                        && !self.contains(target, id)
+                        && !references.contains(&target)
+                    {
+                        references.push(target);
+                    }
+                }
+            }
+        }
+        references.sort_unstable();
+        references
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const CONFIG: &str = r#"<opnsense>
+  <interfaces>
+    <lan><if>em1</if></lan>
+    <opt6><if>em1_vlan100</if><descr>Sales</descr></opt6>
+  </interfaces>
+  <vlans><vlan uuid="v1"><if>em1</if><tag>100</tag><vlanif>em1_vlan100</vlanif></vlan></vlans>
+  <filter>
+    <rule><interface>opt6</interface><source><address>SALES_NETS</address></source></rule>
+    <rule><interface>lan</interface><destination><any/></destination></rule>
+  </filter>
+  <aliases>
+    <alias><name>SALES_NETS</name><content>10.1.0.0/24
+BRANCH_NETS</content></alias>
+    <alias><name>BRANCH_NETS</name><content>10.2.0.0/24</content></alias>
+  </aliases>
+</opnsense>"#;
+
+    fn find(tree: &ConfigTree, path: &str) -> usize {
+        (0..tree.len())
+            .find(|&id| tree.node(id).path == path)
+            .unwrap()
+    }
+
+    #[test]
+    fn test_parse_structure() {
+        let tree = ConfigTree::parse(CONFIG).unwrap();
+        let rule = find(&tree, "/opnsense/filter/rule[2]");
+        assert_eq!(tree.node(rule).depth, 2);
+        assert_eq!(tree.node(rule).children.len(), 2);
+        assert_eq!(tree.node(rule).value, None);
+
+        let vlan = find(&tree, "/opnsense/vlans/vlan");
+        assert_eq!(
+            tree.node(vlan).attributes,
+            vec![("uuid".into(), "v1".into())]
+        );
+        assert_eq!(tree.child_value(vlan, "tag"), Some("100"));
+        assert_eq!(
+            tree.ancestors(vlan),
+            vec![0, find(&tree, "/opnsense/vlans")]
+        );
+        assert!(ConfigTree::parse("").is_err());
+    }
+
+    #[test]
+    fn test_rule_alias_member_references() {
+        let tree = ConfigTree::parse(CONFIG).unwrap();
+        let rule = find(&tree, "/opnsense/filter/rule");
+        let opt6 = find(&tree, "/opnsense/interfaces/opt6");
+        let sales = find(&tree, "/opnsense/aliases/alias");
+        let branch = find(&tree, "/opnsense/aliases/alias[2]");
+        assert_eq!(tree.references(rule), vec![opt6, sales]);
+        assert_eq!(tree.references(sales), vec![branch]);
+        assert_eq!(
+            tree.references(opt6),
+            vec![find(&tree, "/opnsense/vlans/vlan")]
+        );
+    }
+
+    #[test]
+    fn test_search_wraps_around() {
+        let tree = ConfigTree::parse(CONFIG).unwrap();
+        let first = tree.search("sales", 0).unwrap();
+        assert_eq!(tree.node(first).path, "/opnsense/interfaces/opt6/descr");
+        let last = find(&tree, "/opnsense/aliases/alias[2]/content");
+        assert_eq!(tree.search("SALES", last), Some(first));
+        assert_eq!(tree.search("nothing", 0), None);
+    }
+}
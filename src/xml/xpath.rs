@@ -0,0 +1,399 @@
+//! Streaming evaluation of a practical XPath subset
+//!
+//! Supported expressions are absolute location paths made of child (`/`) and
+//! descendant (`//`) steps naming an element or `*`, optionally ending in
+//! `@attribute` or `text()`:
+//!
+//! ```text
+//! /opnsense/system/hostname
+//! //dhcpd/*/range
+//! //vlan/@uuid
+//! //interfaces/*/descr/text()
+//! ```
+//!
+//! Predicates, functions other than `text()`, and relative paths are rejected.
+//! Documents are read as an event stream rather than a tree, so very large
+//! generated configurations are searched in constant memory apart from the
+//! matched values.
+
+use crate::Result;
+use crate::io::previous::resolve_entity;
+use crate::model::ConfigError;
+use quick_xml::Reader;
+use quick_xml::Writer;
+use quick_xml::events::{BytesStart, Event};
+use std::io::BufRead;
+
+/// Compiled XPath expression
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct XPath {
+    steps: Vec<Step>,
+    target: Target,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum Axis {
+    Child,
+    Descendant,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+struct Step {
+    axis: Axis,
+    /// Element name, or `None` for `*`
+    name: Option<String>,
+}
+
+impl Step {
+    fn accepts(&self, name: &str) -> bool {
+        self.name.as_deref().is_none_or(|n| n == name)
+    }
+}
+
+/// What is extracted from a matched element
+#[derive(Debug, Clone, PartialEq, Eq)]
+enum Target {
+    /// Text of a leaf element, or the XML fragment of an element with children
+    Element,
+    /// Direct text content
+    Text,
+    /// Value of the named attribute
+    Attribute(String),
+}
+
+/// One extracted value
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct XPathMatch {
+    /// Absolute path of the matched node, e.g. `/opnsense/dhcpd/opt6/range`
+    pub path: String,
+    /// Extracted value
+    pub value: String,
+}
+
+/// Element being captured while its content streams past
+struct Capture {
+    depth: usize,
+    path: String,
+    text: String,
+    fragment: Writer<Vec<u8>>,
+    has_children: bool,
+}
+
+impl XPath {
+    /// Compile an expression
+    pub fn parse(expr: &str) -> Result<Self> {
+        let expr = expr.trim();
+        if !expr.starts_with('/') {
+            return Err(ConfigError::invalid_query(format!(
+                "XPath '{expr}' must be absolute (start with / or //)"
+            )));
+        }
+        let body = expr.strip_suffix("/text()").unwrap_or(expr);
+        if let Some(c) = body.chars().find(|c| "[]()|=".contains(*c)) {
+            return Err(ConfigError::invalid_query(format!(
+                "XPath '{expr}' uses '{c}', which is not supported; only element, *, @attribute, and text() steps are"
+            )));
+        }
+
+        let mut steps = Vec::new();
+        let mut target = Target::Element;
+        let mut rest = expr;
+        while !rest.is_empty() {
+            let (axis, after) = match rest.strip_prefix("//") {
+                Some(after) => (Axis::Descendant, after),
+                None => (Axis::Child, &rest[1..]),
+            };
+            let end = after.find('/').unwrap_or(after.len());
+            let name = &after[..end];
+            rest = &after[end..];
+
+            if name.is_empty() {
+                return Err(ConfigError::invalid_query(format!(
+                    "XPath '{expr}' has an empty step"
+                )));
+            }
+            let is_last = rest.is_empty();
+            if name == "text()" || name.starts_with('@') {
+                if !is_last || axis == Axis::Descendant || steps.is_empty() {
+                    return Err(ConfigError::invalid_query(format!(
+                        "'{name}' must be the final child step of XPath '{expr}'"
+                    )));
+                }
+                target = match name.strip_prefix('@') {
+                    Some("") => {
+                        return Err(ConfigError::invalid_query(format!(
+                            "XPath '{expr}' has an empty attribute name"
+                        )));
+                    }
+                    Some(attribute) => Target::Attribute(attribute.to_string()),
+                    None => Target::Text,
+                };
+                break;
+            }
+            steps.push(Step {
+                axis,
+                name: (name != "*").then(|| name.to_string()),
+            });
+        }
+
+        Ok(Self { steps, target })
+    }
+
+    /// Whether the open element path (root first) is selected by the steps
+    fn selects(&self, names: &[String]) -> bool {
+        fn matches(steps: &[Step], names: &[String]) -> bool {
+            let Some((step, rest)) = steps.split_first() else {
+                return names.is_empty();
+            };
+            match step.axis {
+                Axis::Child => names
+                    .split_first()
+                    .is_some_and(|(name, tail)| step.accepts(name) && matches(rest, tail)),
+                Axis::Descendant => (0..names.len())
+                    .any(|skip| step.accepts(&names[skip]) && matches(rest, &names[skip + 1..])),
+            }
+        }
+        matches(&self.steps, names)
+    }
+
+    /// Evaluate against an XML string
+    pub fn evaluate_str(&self, xml: &str) -> Result<Vec<XPathMatch>> {
+        self.evaluate(xml.as_bytes())
+    }
+
+    /// Evaluate against a streamed XML document
+    pub fn evaluate<R: BufRead>(&self, reader: R) -> Result<Vec<XPathMatch>> {
+        let mut reader = Reader::from_reader(reader);
+        let mut buf = Vec::new();
+        let mut stack: Vec<String> = Vec::new();
+        let mut captures: Vec<Capture> = Vec::new();
+        let mut matches = Vec::new();
+
+        loop {
+            let event = reader.read_event_into(&mut buf).map_err(|e| {
+                ConfigError::xml_event_parsing(format!(
+                    "Failed to parse XML at position {}: {e}",
+                    reader.buffer_position()
+                ))
+            })?;
+            match event {
+                Event::Start(ref start) => {
+                    for capture in &mut captures {
+                        capture.has_children = true;
+                        capture.fragment.write_event(event.clone())?;
+                    }
+                    stack.push(element_name(start));
+                    if self.selects(&stack) {
+                        self.on_selected(start, &stack, &mut captures, &mut matches, false)?;
+                    }
+                }
+                Event::Empty(ref start) => {
+                    for capture in &mut captures {
+                        capture.has_children = true;
+                        capture.fragment.write_event(event.clone())?;
+                    }
+                    stack.push(element_name(start));
+                    if self.selects(&stack) {
+                        self.on_selected(start, &stack, &mut captures, &mut matches, true)?;
+                    }
+                    stack.pop();
+                }
+                Event::End(_) => {
+                    let depth = stack.len();
+                    while captures.last().is_some_and(|c| c.depth == depth) {
+                        let mut capture = captures.pop().ok_or_else(|| {
+                            ConfigError::xml_event_parsing(format!(
+                                "Lost track of a selected element at position {}",
+                                reader.buffer_position()
+                            ))
+                        })?;
+                        capture.fragment.write_event(event.clone())?;
+                        matches.push(capture.finish(&self.target));
+                    }
+                    for capture in &mut captures {
+                        capture.fragment.write_event(event.clone())?;
+                    }
+                    stack.pop();
+                }
+                Event::Text(ref text) => {
+                    let raw = String::from_utf8_lossy(text);
+                    let depth = stack.len();
+                    for capture in &mut captures {
+                        if capture.depth == depth {
+                            capture.text.push_str(&raw);
+                        }
+                        if !raw.trim().is_empty() {
+                            capture.fragment.write_event(event.clone())?;
+                        }
+                    }
+                }
+                Event::CData(ref data) => {
+                    let raw = String::from_utf8_lossy(data);
+                    let depth = stack.len();
+                    for capture in &mut captures {
+                        if capture.depth == depth {
+                            capture.text.push_str(&raw);
+                        }
+                        capture.fragment.write_event(event.clone())?;
+                    }
+                }
+                Event::GeneralRef(ref entity) => {
+                    let resolved = resolve_entity(&String::from_utf8_lossy(entity));
+                    let depth = stack.len();
+                    for capture in &mut captures {
+                        if capture.depth == depth {
+                            capture.text.push_str(&resolved);
+                        }
+                        capture.fragment.write_event(event.clone())?;
+                    }
+                }
+                Event::Eof => break,
+                _ => {}
+            }
+            buf.clear();
+        }
+
+        Ok(matches)
+    }
+
+    fn on_selected(
+        &self,
+        start: &BytesStart<'_>,
+        stack: &[String],
+        captures: &mut Vec<Capture>,
+        matches: &mut Vec<XPathMatch>,
+        empty: bool,
+    ) -> Result<()> {
+        let path = format!("/{}", stack.join("/"));
+        match &self.target {
+            Target::Attribute(name) => {
+                for attribute in start.attributes().flatten() {
+                    if attribute.key.as_ref() == name.as_bytes() {
+                        let value = attribute
+                            .unescape_value()
+                            .map_err(|e| ConfigError::xml_event_parsing(e.to_string()))?;
+                        matches.push(XPathMatch {
+                            path: format!("{path}/@{name}"),
+                            value: value.into_owned(),
+                        });
+                    }
+                }
+            }
+            Target::Element | Target::Text if empty => matches.push(XPathMatch {
+                path: match self.target {
+                    Target::Text => format!("{path}/text()"),
+                    _ => path,
+                },
+                value: String::new(),
+            }),
+            Target::Element | Target::Text => {
+                let mut fragment = Writer::new(Vec::new());
+                fragment.write_event(Event::Start(start.to_owned()))?;
+                captures.push(Capture {
+                    depth: stack.len(),
+                    path,
+                    text: String::new(),
+                    fragment,
+                    has_children: false,
+                });
+            }
+        }
+        Ok(())
+    }
+}
+
+impl Capture {
+    fn finish(self, target: &Target) -> XPathMatch {
+        match target {
+            Target::Text => XPathMatch {
+                path: format!("{}/text()", self.path),
+                value: self.text.trim().to_string(),
+            },
+            _ if !self.has_children => XPathMatch {
+                path: self.path,
+                value: self.text.trim().to_string(),
+            },
+            _ => XPathMatch {
+                path: self.path,
+                value: String::from_utf8_lossy(&self.fragment.into_inner()).into_owned(),
+            },
+        }
+    }
+}
+
+fn element_name(start: &BytesStart<'_>) -> String {
+    String::from_utf8_lossy(start.name().as_ref()).into_owned()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const CONFIG: &str = r#"<?xml version="1.0"?>
+<opnsense>
+  <system><hostname>fw1</hostname></system>
+  <dhcpd>
+    <opt6>
+      <range><from>10.1.2.100</from><to>10.1.2.200</to></range>
+    </opt6>
+    <opt7>
+      <range><from>10.1.3.100</from><to>10.1.3.200</to></range>
+    </opt7>
+  </dhcpd>
+  <vlans>
+    <vlan uuid="a-1"><descr>IT &amp; Ops</descr></vlan>
+    <vlan uuid="b-2"><descr/></vlan>
+  </vlans>
+</opnsense>"#;
+
+    fn values(expr: &str) -> Vec<String> {
+        XPath::parse(expr)
+            .unwrap()
+            .evaluate_str(CONFIG)
+            .unwrap()
+            .into_iter()
+            .map(|m| m.value)
+            .collect()
+    }
+
+    #[test]
+    fn test_child_path_selects_leaf_text() {
+        let matches = XPath::parse("/opnsense/system/hostname")
+            .unwrap()
+            .evaluate_str(CONFIG)
+            .unwrap();
+        assert_eq!(matches.len(), 1);
+        assert_eq!(matches[0].path, "/opnsense/system/hostname");
+        assert_eq!(matches[0].value, "fw1");
+    }
+
+    #[test]
+    fn test_descendant_wildcard_returns_fragments() {
+        let matches = XPath::parse("//dhcpd/*/range")
+            .unwrap()
+            .evaluate_str(CONFIG)
+            .unwrap();
+        assert_eq!(matches.len(), 2);
+        assert_eq!(matches[0].path, "/opnsense/dhcpd/opt6/range");
+        assert_eq!(
+            matches[0].value,
+            "<range><from>10.1.2.100</from><to>10.1.2.200</to></range>"
+        );
+        assert_eq!(values("//range/to"), vec!["10.1.2.200", "10.1.3.200"]);
+    }
+
+    #[test]
+    fn test_attribute_and_text_targets() {
+        assert_eq!(values("//vlan/@uuid"), vec!["a-1", "b-2"]);
+        assert_eq!(values("//vlan/descr/text()"), vec!["IT & Ops", ""]);
+    }
+
+    #[test]
+    fn test_unsupported_syntax_rejected() {
+        assert!(XPath::parse("opnsense/system").is_err());
+        assert!(XPath::parse("//vlan[1]").is_err());
+        assert!(XPath::parse("//vlan/@uuid/descr").is_err());
+        assert!(XPath::parse("/opnsense//").is_err());
+        assert!(XPath::parse("//count(vlan)").is_err());
+    }
+}
@@ -27,6 +27,8 @@ pub struct TestOutput {
 /// - `TERM=dumb` to disable Rich terminal formatting
 /// - `CARGO_TERM_COLOR=never` to disable Cargo colored output
 /// - `NO_COLOR=1` to disable all color output
+/// - `LC_ALL=C` to keep messages in English regardless of the host locale
+/// - `OPNSENSE_CONFIG_FAKER_PROGRESS=none` to keep plain progress lines out of stderr
 ///
 /// # Example
 /// ```
@@ -62,6 +64,11 @@ pub fn new() -> Self {
         env_vars.insert("TERM".to_string(), "dumb".to_string());
         env_vars.insert("CARGO_TERM_COLOR".to_string(), "never".to_string());
         env_vars.insert("NO_COLOR".to_string(), "1".to_string());
+        env_vars.insert("LC_ALL".to_string(), "C".to_string());
+        env_vars.insert(
+            "OPNSENSE_CONFIG_FAKER_PROGRESS".to_string(),
+            "none".to_string(),
+        );
 
         Self { command, env_vars }
     }
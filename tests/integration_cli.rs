@@ -201,6 +201,108 @@ fn test_generate_csv_with_force() {
     assert_no_ansi_escapes(&output.stderr);
 }
 
+#[test]
+fn test_generate_summary_localized() {
+    let temp_dir = create_temp_dir("csv_lang_test");
+    let output_file = temp_dir.path().join("lang.csv");
+
+    let german = cli_command()
+        .arg("generate")
+        .arg("--format")
+        .arg("csv")
+        .arg("--count")
+        .arg("3")
+        .arg("--output")
+        .arg(&output_file)
+        .arg("--seed")
+        .arg("42")
+        .arg("--lang")
+        .arg("de")
+        .run_success();
+    assert!(german.normalized_stdout().contains("Konfigurationen: 3"));
+
+    // Without --lang the locale environment decides
+    let spanish = cli_command()
+        .arg("generate")
+        .arg("--format")
+        .arg("csv")
+        .arg("--count")
+        .arg("3")
+        .arg("--output")
+        .arg(&output_file)
+        .arg("--force")
+        .arg("--seed")
+        .arg("42")
+        .env("LC_ALL", "es_ES.UTF-8")
+        .run_success();
+    assert!(spanish.normalized_stdout().contains("Configuraciones: 3"));
+}
+
+#[test]
+fn test_generate_plain_progress() {
+    let temp_dir = create_temp_dir("csv_plain_progress_test");
+    let output_file = temp_dir.path().join("progress.csv");
+
+    let output = cli_command()
+        .arg("generate")
+        .arg("--format")
+        .arg("csv")
+        .arg("--count")
+        .arg("5")
+        .arg("--output")
+        .arg(&output_file)
+        .arg("--seed")
+        .arg("42")
+        .arg("--progress")
+        .arg("plain")
+        .run_success();
+
+    assert!(
+        output
+            .stderr
+            .contains("Generating VLAN configurations... [")
+    );
+    assert!(output.stderr.contains("Generated 5 VLAN configurations"));
+    assert!(!output.stderr.contains('\r'));
+    assert_no_ansi_escapes(&output.stderr);
+}
+
+#[test]
+fn test_deprecated_flag_shim() {
+    let temp_dir = create_temp_dir("csv_flag_shim_test");
+    let output_file = temp_dir.path().join("shim.csv");
+
+    let output = cli_command()
+        .arg("generate")
+        .arg("--format")
+        .arg("csv")
+        .arg("--count")
+        .arg("3")
+        .arg("--output")
+        .arg(&output_file)
+        .arg("--include-firewall-rules")
+        .arg("--complexity")
+        .arg("basic")
+        .run_success();
+    output.assert_stderr_contains("warning[deprecated-flag]: generate --complexity is deprecated");
+
+    let output = cli_command()
+        .arg("--strict-flags")
+        .arg("generate")
+        .arg("--format")
+        .arg("csv")
+        .arg("--count")
+        .arg("3")
+        .arg("--output")
+        .arg(&output_file)
+        .arg("--force")
+        .arg("--complexity")
+        .arg("basic")
+        .run_failure();
+    output.assert_stderr_contains("Deprecated flags are not allowed: --complexity");
+    assert!(!output.stdout.contains("Summary"));
+}
+
 #[test]
 fn test_generate_csv_without_force_fails() {
     let temp_dir = create_temp_dir("csv_no_force_test");
@@ -299,6 +401,126 @@ fn test_generate_xml_with_base_config() {
     assert_no_ansi_escapes(&output.stderr);
 }
 
+/// Generate a factory-default XML file, optionally as an encrypted backup
+fn generate_from_default(output_dir: &std::path::Path, count: &str, extra: &[&str]) -> String {
+    cli_command()
+        .arg("generate")
+        .arg("--format")
+        .arg("xml")
+        .arg("--from-default")
+        .arg("--seed")
+        .arg("42")
+        .arg("--count")
+        .arg(count)
+        .arg("--output-dir")
+        .arg(output_dir)
+        .args(extra)
+        .run_success()
+        .normalized_stdout()
+}
+
+/// The `<vlans>` section of a generated configuration
+fn vlans_section(xml: &str) -> &str {
+    let start = xml.find("<vlans>").expect("generated XML has VLANs");
+    let end = xml.find("</vlans>").expect("generated XML has VLANs");
+    &xml[start..end]
+}
+
+#[test]
+fn test_seeded_generate_is_byte_identical() {
+    let temp_dir = create_temp_dir("seeded_generate");
+    let first = temp_dir.path().join("first");
+    let second = temp_dir.path().join("second");
+    let extra = [
+        "--include-firewall-rules",
+        "--vpn-count",
+        "3",
+        "--nat-mappings",
+        "3",
+    ];
+    generate_from_default(&first, "5", &extra);
+    generate_from_default(&second, "5", &extra);
+
+    let mut names: Vec<_> = fs::read_dir(&first)
+        .unwrap()
+        .map(|entry| entry.unwrap().file_name())
+        .collect();
+    names.sort();
+    assert!(!names.is_empty());
+    for name in names {
+        assert_eq!(
+            fs::read(first.join(&name)).unwrap(),
+            fs::read(second.join(&name)).unwrap(),
+            "{name:?} differs between runs with the same seed"
+        );
+    }
+}
+
+#[test]
+fn test_minimize_diff_reads_generated_xml() {
+    let temp_dir = create_temp_dir("minimize_diff_xml");
+    let first = temp_dir.path().join("first");
+    let second = temp_dir.path().join("second");
+    generate_from_default(&first, "3", &[]);
+
+    let previous = first.join("firewall_1.xml");
+    let previous_arg = previous.to_str().unwrap();
+    let stdout = generate_from_default(
+        &second,
+        "5",
+        &["--minimize-diff", "--previous", previous_arg],
+    );
+    assert!(
+        stdout.contains("(3 previous configurations)"),
+        "Expected the three generated VLANs to be reused, got: {stdout}"
+    );
+
+    // The earlier VLANs are reproduced verbatim, followed by the new ones
+    let before = fs::read_to_string(&previous).unwrap();
+    let after = fs::read_to_string(second.join("firewall_1.xml")).unwrap();
+    assert!(vlans_section(&after).starts_with(vlans_section(&before)));
+    assert_eq!(vlans_section(&after).matches("<vlan>").count(), 5);
+}
+
+#[test]
+fn test_minimize_diff_reads_encrypted_xml() {
+    let temp_dir = create_temp_dir("minimize_diff_encrypted");
+    let first = temp_dir.path().join("first");
+    let second = temp_dir.path().join("second");
+    generate_from_default(&first, "3", &["--backup-passphrase", "lab-secret"]);
+
+    let previous = first.join("firewall_1.xml");
+    let previous_arg = previous.to_str().unwrap();
+    let stdout = generate_from_default(
+        &second,
+        "4",
+        &[
+            "--minimize-diff",
+            "--previous",
+            previous_arg,
+            "--backup-passphrase",
+            "lab-secret",
+        ],
+    );
+    assert!(
+        stdout.contains("(3 previous configurations)"),
+        "Expected the encrypted VLANs to be reused, got: {stdout}"
+    );
+
+    // Without the passphrase the encrypted output cannot be read
+    cli_command()
+        .arg("generate")
+        .arg("--format")
+        .arg("xml")
+        .arg("--from-default")
+        .arg("--output-dir")
+        .arg(temp_dir.path().join("third"))
+        .arg("--minimize-diff")
+        .arg("--previous")
+        .arg(previous_arg)
+        .run_failure();
+}
+
 #[test]
 fn test_generate_xml_missing_base_config_fails() {
     let output = cli_command()
@@ -200,6 +200,54 @@ fn test_xml_generation_custom_parameters() {
     drop(base_config_file);
 }
 
+/// Test XML generation with LACP LAGG and spanning-tree bridge interfaces
+#[test]
+fn test_xml_generation_link_layer() {
+    let temp_dir = TempDir::new().expect("Failed to create temp directory");
+    let temp_dir_path = temp_dir.path();
+
+    let base_config_content = create_base_config_xml();
+    let (base_config_file, base_config_path) = create_temp_xml("base_config_", base_config_content)
+        .expect("Failed to create base config file");
+
+    cli_command()
+        .arg("generate")
+        .arg("--format")
+        .arg("xml")
+        .arg("--count")
+        .arg("3")
+        .arg("--base-config")
+        .arg(&base_config_path)
+        .arg("--output-dir")
+        .arg(temp_dir_path)
+        .arg("--laggs")
+        .arg("2")
+        .arg("--bridges")
+        .arg("1")
+        .arg("--seed")
+        .arg("42")
+        .run_success();
+
+    let mut xml_files: Vec<_> = fs::read_dir(temp_dir_path)
+        .expect("Failed to read output directory")
+        .filter_map(|entry| entry.ok())
+        .map(|entry| entry.path())
+        .filter(|path| path.extension().and_then(|ext| ext.to_str()) == Some("xml"))
+        .collect();
+    xml_files.sort();
+    assert_eq!(xml_files.len(), 3, "Should have generated 3 XML files");
+
+    let xml_content = fs::read_to_string(&xml_files[0]).expect("Failed to read generated XML file");
+    let normalized_xml = xml_content.replace("\r\n", "\n").replace('\r', "\n");
+
+    let laggs_section = extract_xml_section(&normalized_xml, "laggs");
+    let bridges_section = extract_xml_section(&normalized_xml, "bridges");
+    assert_snapshot!("xml_generation_laggs_section", laggs_section);
+    assert_snapshot!("xml_generation_bridges_section", bridges_section);
+
+    drop(base_config_file);
+}
+
 /// Test XML generation with empty count (should fail validation)
 #[test]
 fn test_xml_generation_validation_error() {